@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// adminClient talks to the server's admin API
+type adminClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// newAdminClient builds an admin client from the --admin-url and --admin-token
+// flags. The token falls back to KII_ADMIN_TOKEN and then to admin.token.
+func newAdminClient(cmd *cobra.Command) (*adminClient, error) {
+	baseURL, _ := cmd.Flags().GetString("admin-url")
+	token, _ := cmd.Flags().GetString("admin-token")
+
+	if token == "" {
+		token = os.Getenv("KII_ADMIN_TOKEN")
+	}
+	if token == "" {
+		cfg, err := loadServerConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config: %w", err)
+		}
+		token = cfg.Admin.Token
+	}
+	if token == "" {
+		return nil, fmt.Errorf("admin token not set (use --admin-token, KII_ADMIN_TOKEN or admin.token)")
+	}
+
+	return &adminClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		http:    &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// do sends an authenticated request and decodes a JSON response into out (if non-nil)
+func (c *adminClient) do(ctx context.Context, method, path string, out any) error {
+	resp, err := c.send(ctx, c.http, method, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// stream sends an authenticated GET request and copies the response to w.
+// Streams can outlast the client timeout, so only ctx bounds them.
+func (c *adminClient) stream(ctx context.Context, path string, w io.Writer) error {
+	resp, err := c.send(ctx, &http.Client{Transport: c.http.Transport}, http.MethodGet, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// send sends an authenticated request with client, returning the response
+// unless it is an error
+func (c *adminClient) send(ctx context.Context, client *http.Client, method, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("admin request failed: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("admin API returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// addAdminFlags registers the flags used by newAdminClient
+func addAdminFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("admin-url", "http://localhost:8080", "base URL of the server's admin API")
+	cmd.PersistentFlags().String("admin-token", "", "admin API bearer token (defaults to $KII_ADMIN_TOKEN or admin.token)")
+}
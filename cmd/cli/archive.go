@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var archiveCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:   "archive",
+	Short: "List and restore ledger entries pruned to the object store.",
+}
+
+var archiveListCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:          "list",
+	Short:        "List archive segments in sequence order.",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		client, err := newAdminClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		var resp struct {
+			Segments []string `json:"segments"`
+		}
+		if err := client.do(cmd.Context(), http.MethodGet, "/admin/archives", &resp); err != nil {
+			return err
+		}
+		for _, segment := range resp.Segments {
+			_, _ = fmt.Fprintln(cmd.OutOrStdout(), segment)
+		}
+		return nil
+	},
+}
+
+var archiveGetCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:          "get <segment>...",
+	Short:        "Write the entries of archive segments as NDJSON, in the format of the ledger export.",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAdminClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = cmd.OutOrStdout()
+		if out, _ := cmd.Flags().GetString("out"); out != "" {
+			f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+			if err != nil {
+				return fmt.Errorf("failed to create output file: %w", err)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		for _, segment := range args {
+			if err := client.stream(cmd.Context(), "/admin/archives/"+url.PathEscape(segment), w); err != nil {
+				return fmt.Errorf("failed to read segment %q: %w", segment, err)
+			}
+		}
+		return nil
+	},
+}
+
+func init() { //nolint:gochecknoinits
+	addAdminFlags(archiveCmd)
+	archiveGetCmd.Flags().String("out", "", "file to write the entries to (default: stdout)")
+	archiveCmd.AddCommand(archiveListCmd, archiveGetCmd)
+	rootCmd.AddCommand(archiveCmd)
+}
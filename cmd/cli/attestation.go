@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/infrastructure/attestation"
+
+	"github.com/spf13/cobra"
+)
+
+var attestationCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:   "attestation",
+	Short: "Create attestation keys and verify balance attestations.",
+}
+
+var attestationKeygenCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:   "keygen",
+	Short: "Generate an Ed25519 key for signing balance attestations.",
+	Long: `Generate an Ed25519 private key for attestation.keyFile.
+
+The PEM-encoded key is printed to stdout, or written with --out to a file
+readable only by its owner.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		key, err := attestation.GenerateKey()
+		if err != nil {
+			return fmt.Errorf("failed to generate key: %w", err)
+		}
+
+		out, _ := cmd.Flags().GetString("out")
+		if out == "" {
+			_, err := cmd.OutOrStdout().Write(key)
+			return err
+		}
+		if err := os.WriteFile(out, key, 0o600); err != nil {
+			return fmt.Errorf("failed to write key: %w", err)
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Wrote attestation key to %s\n", out)
+		return nil
+	},
+}
+
+var attestationVerifyCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:   "verify",
+	Short: "Check a balance attestation offline.",
+	Long: `Check a balance attestation against the service's public keys.
+
+The keys are read from --jwks, a file or the URL of the server's
+/.well-known/jwks.json; only fetching them needs network access. On success
+the attested balances are printed.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		tokenFile, _ := cmd.Flags().GetString("token-file")
+		jwks, _ := cmd.Flags().GetString("jwks")
+		if tokenFile == "" || jwks == "" {
+			return fmt.Errorf("--token-file and --jwks are required")
+		}
+
+		token, err := readInput(tokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read attestation: %w", err)
+		}
+		keys, err := readJWKS(jwks)
+		if err != nil {
+			return fmt.Errorf("failed to read keys: %w", err)
+		}
+
+		payload, err := attestation.Verify(strings.TrimSpace(string(token)), keys)
+		if err != nil {
+			return err
+		}
+		var attested entity.BalanceAttestation
+		if err := json.Unmarshal(payload, &attested); err != nil {
+			return fmt.Errorf("attestation payload: %w", err)
+		}
+
+		out := cmd.OutOrStdout()
+		_, _ = fmt.Fprintln(out, "Attestation valid")
+		_, _ = fmt.Fprintf(out, "  user:      %s\n", attested.User)
+		_, _ = fmt.Fprintf(out, "  timestamp: %s\n", attested.Timestamp.Format(time.RFC3339))
+		assets := make([]string, 0, len(attested.Balances))
+		for asset := range attested.Balances {
+			assets = append(assets, asset)
+		}
+		sort.Strings(assets)
+		for _, asset := range assets {
+			_, _ = fmt.Fprintf(out, "  %s: %s\n", asset, attested.Balances[asset])
+		}
+		return nil
+	},
+}
+
+// readJWKS reads a JSON Web Key Set from a file or an http(s) URL
+func readJWKS(source string) ([]attestation.JWK, error) {
+	var raw []byte
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		client := &http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("GET %s: %s", source, resp.Status)
+		}
+		if raw, err = io.ReadAll(resp.Body); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if raw, err = readInput(source); err != nil {
+			return nil, err
+		}
+	}
+
+	var set struct {
+		Keys []attestation.JWK `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, err
+	}
+	return set.Keys, nil
+}
+
+func init() { //nolint:gochecknoinits
+	attestationKeygenCmd.Flags().String("out", "", "file to write the private key to (default: stdout)")
+	attestationVerifyCmd.Flags().String("token-file", "", "file with the attestation returned by GET /attestation/{user} (- for stdin)")
+	attestationVerifyCmd.Flags().String("jwks", "", "file or URL with the server's public keys, e.g. https://kii.example.com/.well-known/jwks.json")
+	attestationCmd.AddCommand(attestationKeygenCmd, attestationVerifyCmd)
+	rootCmd.AddCommand(attestationCmd)
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"kii.com/internal/infrastructure/validator"
+)
+
+// signedWebhook is a webhook delivery with its signing headers, which can be
+// (re)sent as-is
+type signedWebhook struct {
+	body      []byte
+	timestamp string
+	nonce     string
+	signature string
+}
+
+// newSignedWebhook signs body with secret using the current time and a fresh nonce
+func newSignedWebhook(secret string, body []byte) (signedWebhook, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := uuid.New().String()
+
+	signature, err := validator.ComputeSignature(secret, timestamp, nonce, body)
+	if err != nil {
+		return signedWebhook{}, fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	return signedWebhook{body: body, timestamp: timestamp, nonce: nonce, signature: signature}, nil
+}
+
+// request builds a POST /webhook request carrying the delivery
+func (s signedWebhook) request(ctx context.Context, baseURL string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+"/webhook", bytes.NewReader(s.body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Timestamp", s.timestamp)
+	req.Header.Set("X-Nonce", s.nonce)
+	req.Header.Set("X-Signature", s.signature)
+
+	return req, nil
+}
+
+// newSignedWebhookRequest builds a POST /webhook request signed with secret
+func newSignedWebhookRequest(ctx context.Context, baseURL, secret string, body []byte) (*http.Request, error) {
+	webhook, err := newSignedWebhook(secret, body)
+	if err != nil {
+		return nil, err
+	}
+	return webhook.request(ctx, baseURL)
+}
+
+// resolveSecret returns the flag value, falling back to the configured secret
+func resolveSecret(secret string) (string, error) {
+	if secret != "" {
+		return secret, nil
+	}
+	cfg, err := loadServerConfig()
+	if err != nil {
+		return "", fmt.Errorf("failed to load config: %w", err)
+	}
+	return cfg.Webhook.HMACSecret, nil
+}
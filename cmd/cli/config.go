@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"kii.com/internal/infrastructure/config"
+)
+
+var configCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:   "config",
+	Short: "Inspect the server configuration.",
+}
+
+var configShowCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:   "show",
+	Short: "Print the server configuration with secrets masked.",
+	Long: `Print the server configuration as YAML, with secrets masked. Settings
+are layered, each over the one before: the built-in defaults, app-config,
+the <CONFIG_ENV> file, remote config, KII_ environment variables (and their
+_FILE variants) and the server flags.
+
+Without --resolved only the defaults and config files are shown; with it,
+the effective configuration the server would run with. Comparing the two
+shows which settings are overridden.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		resolved, _ := cmd.Flags().GetBool("resolved")
+
+		var opts []config.LoadOption
+		if !resolved {
+			opts = append(opts, config.FilesOnly())
+		}
+		cfg, err := loadServerConfig(opts...)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if resolved {
+			if err := applyServerFlags(cmd, cfg); err != nil {
+				return err
+			}
+		}
+
+		out := cmd.OutOrStdout()
+		if err := writeConfigSources(out, resolved); err != nil {
+			return err
+		}
+		return config.Dump(out, cfg)
+	},
+}
+
+var configValidateCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:   "validate",
+	Short: "Check the server configuration without starting the server.",
+	Long: `Load the effective server configuration, as kii server would, with remote
+config, environment variables and the server flags applied, and report the
+first setting it would refuse to start with, such as two webhook sources
+sharing a secret. It exits with an error if the configuration is invalid.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cfg, err := loadServerConfig()
+		if err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+		if err := applyServerFlags(cmd, cfg); err != nil {
+			return err
+		}
+		// A flag may have changed the secret of POST /webhook
+		if err := config.ValidateSecrets(cfg); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+		_, _ = fmt.Fprintln(cmd.OutOrStdout(), "Configuration is valid")
+		return nil
+	},
+}
+
+// writeConfigSources writes where the configuration came from as YAML
+// comments: the config files found and, when resolved, the KII_ variables
+// set
+func writeConfigSources(w io.Writer, resolved bool) error {
+	dir := serverConfigDir()
+	_, _ = fmt.Fprintf(w, "# config dir: %s\n", dir)
+	for _, name := range []string{"app-config", config.Env()} {
+		path, err := config.FindConfigFile(dir, name)
+		if err != nil {
+			return err
+		}
+		if path == "" {
+			path = "(not found)"
+		}
+		_, _ = fmt.Fprintf(w, "# %s: %s\n", name, path)
+	}
+	if !resolved {
+		return nil
+	}
+
+	var names []string
+	for _, env := range os.Environ() {
+		if name, _, _ := strings.Cut(env, "="); strings.HasPrefix(name, "KII_") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		names = []string{"(none)"}
+	}
+	_, _ = fmt.Fprintf(w, "# environment: %s\n", strings.Join(names, ", "))
+	return nil
+}
+
+func init() { //nolint:gochecknoinits
+	configShowCmd.Flags().Bool("resolved", false,
+		"show the effective configuration, with remote config, environment variables and server flags applied")
+	addServerFlags(configShowCmd)
+	configCmd.AddCommand(configShowCmd)
+	addServerFlags(configValidateCmd)
+	configCmd.AddCommand(configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
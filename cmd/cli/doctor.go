@@ -0,0 +1,334 @@
+package cli
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"kii.com/internal/infrastructure/config"
+)
+
+const (
+	minHMACSecretBytes = 32
+	certExpiryWarning  = 30 * 24 * time.Hour
+	// ntpEpochOffset is the number of seconds between 1900-01-01 and 1970-01-01
+	ntpEpochOffset = 2208988800
+)
+
+// checkStatus is the outcome of a doctor check
+type checkStatus string
+
+const (
+	checkPass checkStatus = "PASS"
+	checkWarn checkStatus = "WARN"
+	checkFail checkStatus = "FAIL"
+	checkSkip checkStatus = "SKIP"
+)
+
+// checkResult is the outcome of a single doctor check with a short explanation
+type checkResult struct {
+	status checkStatus
+	detail string
+}
+
+// doctorCheck is a named environment check
+type doctorCheck struct {
+	name string
+	run  func(ctx context.Context) checkResult
+}
+
+var doctorCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:   "doctor",
+	Short: "Diagnose configuration and environment problems.",
+	Long: `Run a series of environment checks and print a pass/fail report:
+configuration sanity, storage backend connectivity, clock skew against an
+NTP server (relevant to the timestamp tolerance), TLS certificate expiry and
+reachability of a running server. Exits non-zero if any check fails.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		cfg, err := loadServerConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		ntpServer, _ := cmd.Flags().GetString("ntp-server")
+		certFile, _ := cmd.Flags().GetString("tls-cert")
+		serverURL, _ := cmd.Flags().GetString("url")
+
+		checks := []doctorCheck{
+			{name: "config: HMAC secret", run: func(context.Context) checkResult { return checkHMACSecret(cfg) }},
+			{name: "config: timestamp tolerance", run: func(context.Context) checkResult { return checkTolerance(cfg) }},
+			{name: "config: server port", run: func(context.Context) checkResult { return checkPort(cfg) }},
+			{name: "config: admin API", run: func(context.Context) checkResult { return checkAdmin(cfg) }},
+			{name: "storage backend", run: func(ctx context.Context) checkResult { return checkStorage(ctx, cfg) }},
+			{name: "config: cluster mode", run: func(context.Context) checkResult { return checkCluster(cfg) }},
+			{name: "clock skew (" + ntpServer + ")", run: func(ctx context.Context) checkResult { return checkClockSkew(ctx, ntpServer, cfg) }},
+			{name: "TLS certificate", run: func(ctx context.Context) checkResult { return checkCertificate(ctx, certFile, serverURL) }},
+			{name: "server reachable", run: func(ctx context.Context) checkResult { return checkServer(ctx, serverURL) }},
+		}
+
+		dirStatus := ""
+		if !configDirFound() {
+			dirStatus = ", not found: embedded defaults and environment variables only"
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Config directory: %s (CONFIG_ENV=%s%s)\n\n", serverConfigDir(), config.Env(), dirStatus)
+
+		failed := 0
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		for _, check := range checks {
+			ctx, cancel := context.WithTimeout(cmd.Context(), 5*time.Second)
+			result := check.run(ctx)
+			cancel()
+
+			if result.status == checkFail {
+				failed++
+			}
+			_, _ = fmt.Fprintf(w, "[%s]\t%s\t%s\n", result.status, check.name, result.detail)
+		}
+		_ = w.Flush()
+
+		if failed > 0 {
+			return fmt.Errorf("%d check(s) failed", failed)
+		}
+		return nil
+	},
+}
+
+func checkHMACSecret(cfg *config.Config) checkResult {
+	switch {
+	case cfg.Webhook.HMACSecret == config.DefaultHMACSecret:
+		return checkResult{checkFail, "using the built-in default secret; generate one with `kii gen-secret`"}
+	case len(cfg.Webhook.HMACSecret) < minHMACSecretBytes:
+		return checkResult{checkWarn, fmt.Sprintf("secret is %d bytes, recommend at least %d", len(cfg.Webhook.HMACSecret), minHMACSecretBytes)}
+	default:
+		return checkResult{checkPass, fmt.Sprintf("%d bytes", len(cfg.Webhook.HMACSecret))}
+	}
+}
+
+func checkTolerance(cfg *config.Config) checkResult {
+	tolerance := cfg.Webhook.TimestampTolerance
+	// Nonces are remembered for the longest tolerance of any endpoint plus
+	// the margin
+	longest := tolerance
+	for _, source := range cfg.Sources {
+		longest = max(longest, source.TimestampTolerance)
+	}
+	retention := longest + cfg.Webhook.NonceRetentionMargin
+	switch {
+	case tolerance < 30*time.Second:
+		return checkResult{checkWarn, fmt.Sprintf("%s is very tight; minor sender clock skew will cause rejections", tolerance)}
+	case tolerance > time.Hour:
+		return checkResult{checkWarn, fmt.Sprintf("%s is very loose; used nonces are kept for %s, growing the nonce store", tolerance, retention)}
+	default:
+		return checkResult{checkPass, fmt.Sprintf("%s, nonces kept for %s", tolerance, retention)}
+	}
+}
+
+func checkPort(cfg *config.Config) checkResult {
+	if cfg.Server.DisableTCP {
+		return checkResult{checkSkip, "TCP disabled, serving on unix socket " + cfg.Server.UnixSocket}
+	}
+	port, err := strconv.Atoi(cfg.Server.Port)
+	if err != nil || port <= 0 || port > 65535 {
+		return checkResult{checkFail, fmt.Sprintf("%q is not a valid port", cfg.Server.Port)}
+	}
+	return checkResult{checkPass, cfg.Server.Port}
+}
+
+func checkAdmin(cfg *config.Config) checkResult {
+	switch {
+	case cfg.Admin.Token == "":
+		return checkResult{checkSkip, "admin API disabled"}
+	case len(cfg.Admin.Token) < 16:
+		return checkResult{checkWarn, "admin token is shorter than 16 characters"}
+	default:
+		return checkResult{checkPass, "enabled"}
+	}
+}
+
+func checkStorage(_ context.Context, cfg *config.Config) checkResult {
+	switch cfg.Storage.Backend {
+	case "memory":
+		return checkResult{checkWarn, "in-memory backend; balances are lost on restart"}
+	default:
+		return checkResult{checkFail, fmt.Sprintf("unsupported backend %q", cfg.Storage.Backend)}
+	}
+}
+
+func checkCluster(cfg *config.Config) checkResult {
+	switch {
+	case !cfg.Cluster.Enabled:
+		return checkResult{checkSkip, "single-instance mode"}
+	case cfg.Storage.Backend == "memory":
+		return checkResult{checkFail, "in-memory ledger and nonce store cannot be shared between replicas; the server will refuse to start"}
+	default:
+		return checkResult{checkFail, "nonce store is in-memory; the server will refuse to start"}
+	}
+}
+
+func checkClockSkew(ctx context.Context, server string, cfg *config.Config) checkResult {
+	if server == "" {
+		return checkResult{checkSkip, "no NTP server configured"}
+	}
+
+	offset, err := queryNTPOffset(ctx, server)
+	if err != nil {
+		return checkResult{checkWarn, fmt.Sprintf("could not query NTP server: %v", err)}
+	}
+
+	// webhook.clockOffset already corrects part of the skew
+	offset -= cfg.Webhook.ClockOffset
+	abs := offset.Abs()
+	detail := fmt.Sprintf("local clock is off by %s (tolerance %s)", offset.Round(time.Millisecond), cfg.Webhook.TimestampTolerance)
+	if cfg.Webhook.ClockOffset != 0 {
+		detail = fmt.Sprintf("local clock is off by %s after the configured %s offset (tolerance %s)",
+			offset.Round(time.Millisecond), cfg.Webhook.ClockOffset, cfg.Webhook.TimestampTolerance)
+	}
+	switch {
+	case abs > cfg.Webhook.TimestampTolerance/2:
+		return checkResult{checkFail, detail}
+	case abs > time.Second:
+		return checkResult{checkWarn, detail}
+	default:
+		return checkResult{checkPass, detail}
+	}
+}
+
+// withDefaultPort adds port to host unless it has one. IPv6 addresses may be
+// given bare or in brackets.
+func withDefaultPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), port)
+}
+
+// queryNTPOffset performs a single SNTP (RFC 4330) exchange and returns the
+// offset to add to the local clock to match the server
+func queryNTPOffset(ctx context.Context, server string) (time.Duration, error) {
+	server = withDefaultPort(server, "123")
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", server)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	// LI = 0, VN = 4, Mode = 3 (client)
+	request := make([]byte, 48)
+	request[0] = 0x23
+
+	sent := time.Now()
+	if _, err := conn.Write(request); err != nil {
+		return 0, err
+	}
+	response := make([]byte, 48)
+	if _, err := conn.Read(response); err != nil {
+		return 0, err
+	}
+	received := time.Now()
+
+	ntpTime := func(b []byte) time.Time {
+		seconds := binary.BigEndian.Uint32(b[0:4])
+		fraction := binary.BigEndian.Uint32(b[4:8])
+		nanos := (int64(fraction) * 1e9) >> 32
+		return time.Unix(int64(seconds)-ntpEpochOffset, nanos)
+	}
+	serverReceived := ntpTime(response[32:40])
+	serverSent := ntpTime(response[40:48])
+	if serverSent.IsZero() || serverSent.Unix() <= 0 {
+		return 0, errors.New("invalid NTP response")
+	}
+
+	return (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2, nil
+}
+
+func checkCertificate(ctx context.Context, certFile, serverURL string) checkResult {
+	var cert *x509.Certificate
+
+	switch {
+	case certFile != "":
+		raw, err := os.ReadFile(certFile)
+		if err != nil {
+			return checkResult{checkFail, err.Error()}
+		}
+		block, _ := pem.Decode(raw)
+		if block == nil {
+			return checkResult{checkFail, "no PEM certificate found in " + certFile}
+		}
+		if cert, err = x509.ParseCertificate(block.Bytes); err != nil {
+			return checkResult{checkFail, err.Error()}
+		}
+	case strings.HasPrefix(serverURL, "https://"):
+		host := strings.TrimPrefix(serverURL, "https://")
+		host, _, _ = strings.Cut(host, "/")
+		host = withDefaultPort(host, "443")
+		dialer := &tls.Dialer{Config: &tls.Config{InsecureSkipVerify: true}} //nolint:gosec // only inspecting expiry
+		conn, err := dialer.DialContext(ctx, "tcp", host)
+		if err != nil {
+			return checkResult{checkFail, err.Error()}
+		}
+		defer conn.Close()
+		cert = conn.(*tls.Conn).ConnectionState().PeerCertificates[0]
+	default:
+		return checkResult{checkSkip, "no certificate given (--tls-cert or an https --url)"}
+	}
+
+	remaining := time.Until(cert.NotAfter)
+	detail := fmt.Sprintf("%s expires %s", cert.Subject.CommonName, cert.NotAfter.Format(time.DateOnly))
+	switch {
+	case remaining <= 0:
+		return checkResult{checkFail, detail + " (expired)"}
+	case remaining < certExpiryWarning:
+		return checkResult{checkWarn, detail + fmt.Sprintf(" (in %d days)", int(remaining.Hours()/24))}
+	default:
+		return checkResult{checkPass, detail}
+	}
+}
+
+func checkServer(ctx context.Context, serverURL string) checkResult {
+	if serverURL == "" {
+		return checkResult{checkSkip, "no --url given"}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(serverURL, "/")+"/balance/kii-doctor", nil)
+	if err != nil {
+		return checkResult{checkFail, err.Error()}
+	}
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return checkResult{checkFail, err.Error()}
+	}
+	defer resp.Body.Close()
+
+	detail := fmt.Sprintf("%s in %s", resp.Status, time.Since(start).Round(time.Millisecond))
+	if resp.StatusCode != http.StatusOK {
+		return checkResult{checkFail, detail}
+	}
+	return checkResult{checkPass, detail}
+}
+
+func init() { //nolint:gochecknoinits
+	doctorCmd.Flags().String("ntp-server", "pool.ntp.org", "NTP server used to measure local clock skew (empty to skip)")
+	doctorCmd.Flags().String("tls-cert", "", "PEM certificate file to check for expiry")
+	doctorCmd.Flags().String("url", "", "base URL of a running server to probe")
+	rootCmd.AddCommand(doctorCmd)
+}
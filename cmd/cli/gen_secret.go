@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"kii.com/internal/infrastructure/audit"
+	"kii.com/internal/infrastructure/config"
+	"kii.com/internal/infrastructure/logger"
+
+	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v3"
+)
+
+const minSecretBytes = 16
+
+var genSecretCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:   "gen-secret",
+	Short: "Generate a random HMAC secret.",
+	Long: `Generate a cryptographically strong HMAC secret.
+
+By default the secret is printed to stdout. Use --export to print a shell
+export statement, or --write to store it as webhook.hmacSecret in the
+config file for the current CONFIG_ENV.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		length, _ := cmd.Flags().GetInt("length")
+		encoding, _ := cmd.Flags().GetString("encoding")
+		export, _ := cmd.Flags().GetBool("export")
+		write, _ := cmd.Flags().GetBool("write")
+
+		secret, err := generateSecret(length, encoding)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		switch {
+		case write:
+			path, err := envConfigFile()
+			if err != nil {
+				return err
+			}
+			if err := writeConfigSecret(path, secret); err != nil {
+				return fmt.Errorf("failed to write secret to %s: %w", path, err)
+			}
+			_, _ = fmt.Fprintf(out, "Wrote webhook.hmacSecret to %s\n", path)
+			if err := auditSecretRotation(cmd.Context(), path, secret); err != nil {
+				return err
+			}
+		case export:
+			_, _ = fmt.Fprintf(out, "export KII_WEBHOOK_HMAC_SECRET=%s\n", secret)
+		default:
+			_, _ = fmt.Fprintln(out, secret)
+		}
+
+		return nil
+	},
+}
+
+// generateSecret returns length random bytes in the requested encoding
+func generateSecret(length int, encoding string) (string, error) {
+	if length < minSecretBytes {
+		return "", fmt.Errorf("secret length must be at least %d bytes", minSecretBytes)
+	}
+
+	buf := make([]byte, length)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to read random bytes: %w", err)
+	}
+
+	switch encoding {
+	case "hex":
+		return hex.EncodeToString(buf), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(buf), nil
+	case "base64url":
+		return base64.RawURLEncoding.EncodeToString(buf), nil
+	default:
+		return "", fmt.Errorf("unsupported encoding %q (want hex, base64 or base64url)", encoding)
+	}
+}
+
+// envConfigFile returns the YAML config file for CONFIG_ENV, which is created
+// as <CONFIG_ENV>.yaml if there is none yet. Only YAML files are rewritten.
+func envConfigFile() (string, error) {
+	path, err := config.FindConfigFile(serverConfigDir(), config.Env())
+	if err != nil {
+		return "", err
+	}
+	switch filepath.Ext(path) {
+	case "":
+		return filepath.Join(serverConfigDir(), config.Env()+".yaml"), nil
+	case ".yaml", ".yml":
+		return path, nil
+	default:
+		return "", fmt.Errorf("--write only supports YAML config files, not %s", path)
+	}
+}
+
+// writeConfigSecret sets webhook.hmacSecret in a YAML config file, keeping the
+// rest of the document intact. The file is created if it does not exist.
+func writeConfigSecret(path, secret string) error {
+	var doc yaml.Node
+	raw, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(raw) > 0 {
+		if err := yaml.Unmarshal(raw, &doc); err != nil {
+			return fmt.Errorf("failed to parse config: %w", err)
+		}
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+
+	webhook := mappingChild(doc.Content[0], "webhook")
+	setMappingScalar(webhook, "hmacSecret", secret)
+
+	var encoded bytes.Buffer
+	encoder := yaml.NewEncoder(&encoded)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, encoded.Bytes(), 0o600)
+}
+
+// auditSecretRotation records a written secret in the configured audit sink,
+// identifying it by fingerprint only
+func auditSecretRotation(ctx context.Context, path, secret string) error {
+	cfg, err := loadServerConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	auditLog, err := audit.Open(cfg.Audit, logger.NewLogger())
+	if err != nil {
+		return err
+	}
+	defer auditLog.Close()
+
+	auditLog.Record(ctx, audit.Event{
+		Type: audit.EventSecretRotated,
+		Details: map[string]string{
+			"config_file": path,
+			"fingerprint": audit.Fingerprint(secret),
+		},
+	})
+	return nil
+}
+
+// mappingChild returns the mapping stored under key, creating it if needed
+func mappingChild(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, child)
+	return child
+}
+
+// setMappingScalar sets key to a string scalar value in a mapping node
+func setMappingScalar(node *yaml.Node, key, value string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = &yaml.Node{Kind: yaml.ScalarNode, Value: value, Style: yaml.DoubleQuotedStyle}
+			return
+		}
+	}
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Value: value, Style: yaml.DoubleQuotedStyle})
+}
+
+func init() { //nolint:gochecknoinits
+	genSecretCmd.Flags().Int("length", 32, "number of random bytes")
+	genSecretCmd.Flags().String("encoding", "hex", "output encoding: hex, base64 or base64url")
+	genSecretCmd.Flags().Bool("export", false, "print a shell export statement")
+	genSecretCmd.Flags().Bool("write", false, "write the secret into the config file for CONFIG_ENV")
+	genSecretCmd.MarkFlagsMutuallyExclusive("export", "write")
+	rootCmd.AddCommand(genSecretCmd)
+}
@@ -0,0 +1,249 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/cobra"
+
+	"kii.com/internal/domain/entity"
+)
+
+var loadtestCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:   "loadtest",
+	Short: "Generate signed webhook traffic and report latency.",
+	Long: `Send signed webhooks to a running server at a target rate and report
+latency percentiles, throughput and error rates.
+
+Payloads are drawn uniformly from --users user IDs, the --assets list and
+amounts between --min-amount and --max-amount.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		opts := loadtestOptions{}
+		opts.url, _ = cmd.Flags().GetString("url")
+		opts.rps, _ = cmd.Flags().GetInt("rps")
+		opts.duration, _ = cmd.Flags().GetDuration("duration")
+		opts.concurrency, _ = cmd.Flags().GetInt("concurrency")
+		opts.users, _ = cmd.Flags().GetInt("users")
+		opts.assets, _ = cmd.Flags().GetStringSlice("assets")
+		minAmount, _ := cmd.Flags().GetString("min-amount")
+		maxAmount, _ := cmd.Flags().GetString("max-amount")
+		secret, _ := cmd.Flags().GetString("secret")
+
+		if opts.rps <= 0 || opts.concurrency <= 0 || opts.users <= 0 || len(opts.assets) == 0 {
+			return fmt.Errorf("--rps, --concurrency and --users must be positive and --assets non-empty")
+		}
+		if opts.rps > int(time.Second) {
+			return fmt.Errorf("--rps must be at most %d", int(time.Second))
+		}
+
+		var err error
+		if opts.minAmount, err = decimal.NewFromString(minAmount); err != nil {
+			return fmt.Errorf("invalid --min-amount: %w", err)
+		}
+		if opts.maxAmount, err = decimal.NewFromString(maxAmount); err != nil {
+			return fmt.Errorf("invalid --max-amount: %w", err)
+		}
+		if opts.maxAmount.LessThan(opts.minAmount) {
+			return fmt.Errorf("--max-amount must not be less than --min-amount")
+		}
+		if opts.secret, err = resolveSecret(secret); err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Sending %d req/s to %s for %s with %d workers...\n",
+			opts.rps, opts.url, opts.duration, opts.concurrency)
+
+		result := runLoadtest(ctx, opts)
+		result.print(cmd.OutOrStdout())
+
+		return nil
+	},
+}
+
+type loadtestOptions struct {
+	url         string
+	secret      string
+	rps         int
+	duration    time.Duration
+	concurrency int
+	users       int
+	assets      []string
+	minAmount   decimal.Decimal
+	maxAmount   decimal.Decimal
+}
+
+// randomPayload draws a webhook payload from the configured distribution
+func (o loadtestOptions) randomPayload() entity.WebhookRequest {
+	spread := o.maxAmount.Sub(o.minAmount)
+	amount := o.minAmount.Add(spread.Mul(decimal.NewFromFloat(rand.Float64()))) //nolint:gosec
+	return entity.WebhookRequest{
+		User:   fmt.Sprintf("loadtest-user-%d", rand.IntN(o.users)),   //nolint:gosec
+		Asset:  strings.TrimSpace(o.assets[rand.IntN(len(o.assets))]), //nolint:gosec
+		Amount: amount.StringFixed(8),
+	}
+}
+
+// loadtestResult aggregates the outcome of a load test run
+type loadtestResult struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	statuses  map[int]int
+	errors    map[string]int
+	dropped   int
+	elapsed   time.Duration
+}
+
+func (r *loadtestResult) record(latency time.Duration, status int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.latencies = append(r.latencies, latency)
+	if err != nil {
+		r.errors[err.Error()]++
+		return
+	}
+	r.statuses[status]++
+}
+
+func (r *loadtestResult) print(w io.Writer) {
+	total := len(r.latencies)
+	failed := 0
+	for _, count := range r.errors {
+		failed += count
+	}
+	for status, count := range r.statuses {
+		if status >= http.StatusBadRequest {
+			failed += count
+		}
+	}
+
+	_, _ = fmt.Fprintf(w, "\nRequests:    %d in %s (%.1f req/s)\n", total, r.elapsed.Round(time.Millisecond),
+		float64(total)/r.elapsed.Seconds())
+	if r.dropped > 0 {
+		_, _ = fmt.Fprintf(w, "Dropped:     %d (workers saturated, raise --concurrency)\n", r.dropped)
+	}
+	if total == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(w, "Error rate:  %.2f%%\n", 100*float64(failed)/float64(total))
+
+	slices.Sort(r.latencies)
+	_, _ = fmt.Fprintln(w, "Latency:")
+	for _, p := range []float64{50, 90, 95, 99} {
+		_, _ = fmt.Fprintf(w, "  p%-4v %s\n", p, percentile(r.latencies, p))
+	}
+	_, _ = fmt.Fprintf(w, "  max   %s\n", r.latencies[total-1])
+
+	_, _ = fmt.Fprintln(w, "Status codes:")
+	codes := make([]int, 0, len(r.statuses))
+	for status := range r.statuses {
+		codes = append(codes, status)
+	}
+	sort.Ints(codes)
+	for _, status := range codes {
+		_, _ = fmt.Fprintf(w, "  %d: %d\n", status, r.statuses[status])
+	}
+	for msg, count := range r.errors {
+		_, _ = fmt.Fprintf(w, "  error %q: %d\n", msg, count)
+	}
+}
+
+// percentile returns the p-th percentile of sorted latencies (nearest rank)
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted))*p/100+0.5) - 1
+	idx = max(0, min(idx, len(sorted)-1))
+	return sorted[idx]
+}
+
+// runLoadtest dispatches requests at opts.rps until the duration elapses or ctx is cancelled
+func runLoadtest(ctx context.Context, opts loadtestOptions) *loadtestResult {
+	result := &loadtestResult{statuses: make(map[int]int), errors: make(map[string]int)}
+	client := &http.Client{Timeout: 30 * time.Second}
+	jobs := make(chan struct{}, opts.concurrency)
+
+	var wg sync.WaitGroup
+	for range opts.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				body, _ := json.Marshal(opts.randomPayload())
+				req, err := newSignedWebhookRequest(ctx, opts.url, opts.secret, body)
+				if err != nil {
+					result.record(0, 0, err)
+					continue
+				}
+
+				start := time.Now()
+				resp, err := client.Do(req)
+				latency := time.Since(start)
+				if err != nil {
+					result.record(latency, 0, err)
+					continue
+				}
+				_, _ = io.Copy(io.Discard, resp.Body)
+				_ = resp.Body.Close()
+				result.record(latency, resp.StatusCode, nil)
+			}
+		}()
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(time.Second / time.Duration(opts.rps))
+	deadline := time.NewTimer(opts.duration)
+	defer ticker.Stop()
+	defer deadline.Stop()
+
+dispatch:
+	for {
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case <-deadline.C:
+			break dispatch
+		case <-ticker.C:
+			select {
+			case jobs <- struct{}{}:
+			default:
+				result.dropped++
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	result.elapsed = time.Since(start)
+
+	return result
+}
+
+func init() { //nolint:gochecknoinits
+	loadtestCmd.Flags().String("url", "http://localhost:8080", "base URL of the target server")
+	loadtestCmd.Flags().String("secret", "", "HMAC secret (defaults to the configured webhook.hmacSecret)")
+	loadtestCmd.Flags().Int("rps", 100, "target requests per second")
+	loadtestCmd.Flags().Duration("duration", 30*time.Second, "test duration")
+	loadtestCmd.Flags().Int("concurrency", 10, "number of concurrent workers")
+	loadtestCmd.Flags().Int("users", 100, "number of distinct users to spread entries across")
+	loadtestCmd.Flags().StringSlice("assets", []string{"BTC", "ETH", "USDT"}, "assets to draw from")
+	loadtestCmd.Flags().String("min-amount", "0.00000001", "minimum entry amount")
+	loadtestCmd.Flags().String("max-amount", "100", "maximum entry amount")
+	rootCmd.AddCommand(loadtestCmd)
+}
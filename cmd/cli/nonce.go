@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"kii.com/internal/domain/entity"
+)
+
+var nonceCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:   "nonce",
+	Short: "Inspect and manage the replay-protection nonce store.",
+}
+
+var nonceListCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:          "list",
+	Short:        "List tracked nonces, newest first.",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		client, err := newAdminClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		prefix, _ := cmd.Flags().GetString("prefix")
+		limit, _ := cmd.Flags().GetInt("limit")
+		query := url.Values{}
+		query.Set("prefix", prefix)
+		query.Set("limit", fmt.Sprint(limit))
+
+		var resp struct {
+			Total  int                  `json:"total"`
+			Nonces []entity.NonceRecord `json:"nonces"`
+		}
+		if err := client.do(cmd.Context(), http.MethodGet, "/admin/nonces?"+query.Encode(), &resp); err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "TENANT\tNONCE\tTIMESTAMP\tAGE")
+		for _, record := range resp.Nonces {
+			tenant := record.Tenant
+			if tenant == "" {
+				tenant = "default"
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", tenant, record.Nonce, record.Timestamp.Format(time.RFC3339),
+				time.Since(record.Timestamp).Round(time.Second))
+		}
+		_ = w.Flush()
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "\nShowing %d of %d tracked nonces\n", len(resp.Nonces), resp.Total)
+
+		return nil
+	},
+}
+
+var noncePurgeCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:   "purge [nonce...]",
+	Short: "Remove specific nonces, or all of them with --all.",
+	Long: `Remove nonces from the replay-protection store so a legitimate resend
+that was blocked can be accepted. Pass the nonces to remove, with --tenant for
+those used by a webhook source, or --all to clear the entire store.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		all, _ := cmd.Flags().GetBool("all")
+		if all == (len(args) > 0) {
+			return fmt.Errorf("pass either one or more nonces or --all")
+		}
+
+		client, err := newAdminClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if all {
+			var resp struct {
+				Purged int `json:"purged"`
+			}
+			if err := client.do(cmd.Context(), http.MethodDelete, "/admin/nonces", &resp); err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(out, "Purged %d nonces\n", resp.Purged)
+			return nil
+		}
+
+		var query string
+		if tenant, _ := cmd.Flags().GetString("tenant"); tenant != "" {
+			query = "?tenant=" + url.QueryEscape(tenant)
+		}
+		for _, nonce := range args {
+			if err := client.do(cmd.Context(), http.MethodDelete, "/admin/nonces/"+url.PathEscape(nonce)+query, nil); err != nil {
+				return fmt.Errorf("failed to purge nonce %q: %w", nonce, err)
+			}
+			_, _ = fmt.Fprintf(out, "Purged nonce %s\n", nonce)
+		}
+
+		return nil
+	},
+}
+
+func init() { //nolint:gochecknoinits
+	addAdminFlags(nonceCmd)
+	nonceListCmd.Flags().String("prefix", "", "only list nonces starting with this prefix")
+	nonceListCmd.Flags().Int("limit", 100, "maximum number of nonces to list (0 for all)")
+	noncePurgeCmd.Flags().Bool("all", false, "purge every tracked nonce")
+	noncePurgeCmd.Flags().String("tenant", "", "webhook source that used the nonces (default: the default endpoint)")
+	nonceCmd.AddCommand(nonceListCmd, noncePurgeCmd)
+	rootCmd.AddCommand(nonceCmd)
+}
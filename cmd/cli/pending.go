@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"kii.com/internal/domain/entity"
+)
+
+var pendingCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:   "pending",
+	Short: "Inspect, approve and reject entries awaiting approval.",
+}
+
+var pendingListCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:          "list",
+	Short:        "List entries awaiting approval, oldest first.",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		client, err := newAdminClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		path := "/admin/pending"
+		if policy, _ := cmd.Flags().GetString("policy"); policy != "" {
+			path += "?policy=" + url.QueryEscape(policy)
+		}
+		var resp struct {
+			Pending []entity.PendingEntry `json:"pending"`
+		}
+		if err := client.do(cmd.Context(), http.MethodGet, path, &resp); err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "ID\tSOURCE\tUSER\tASSET\tAMOUNT\tAGE\tPOLICY\tREASON")
+		for _, pending := range resp.Pending {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", pending.ID, pending.Source,
+				pending.Entry.User, pending.Entry.Asset, pending.Entry.Amount,
+				time.Since(pending.CreatedAt).Round(time.Second), pending.Policy, pending.Reason)
+		}
+		_ = w.Flush()
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "\n%d entries awaiting approval\n", len(resp.Pending))
+
+		return nil
+	},
+}
+
+var pendingRejectCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:          "reject <id>...",
+	Short:        "Discard entries awaiting approval so they are never applied.",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAdminClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range args {
+			if err := client.do(cmd.Context(), http.MethodDelete, "/admin/pending/"+url.PathEscape(id), nil); err != nil {
+				return fmt.Errorf("failed to reject pending entry %q: %w", id, err)
+			}
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Rejected pending entry %s\n", id)
+		}
+
+		return nil
+	},
+}
+
+var pendingApproveCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:          "approve <id>...",
+	Short:        "Apply entries awaiting approval after reviewing them.",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newAdminClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range args {
+			if err := client.do(cmd.Context(), http.MethodPost, "/admin/pending/"+url.PathEscape(id)+"/approve", nil); err != nil {
+				return fmt.Errorf("failed to approve pending entry %q: %w", id, err)
+			}
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Approved pending entry %s\n", id)
+		}
+
+		return nil
+	},
+}
+
+func init() { //nolint:gochecknoinits
+	addAdminFlags(pendingCmd)
+	pendingListCmd.Flags().String("policy", "", "only list entries parked by this policy: approval, velocity or anomaly")
+	pendingCmd.AddCommand(pendingListCmd, pendingApproveCmd, pendingRejectCmd)
+	rootCmd.AddCommand(pendingCmd)
+}
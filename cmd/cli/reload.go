@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"kii.com/internal/infrastructure/config"
+	"kii.com/internal/infrastructure/logger"
+	"kii.com/server"
+)
+
+// configReloader re-reads the server config and applies the settings that
+// can change without a restart: log level, timestamp tolerances, debug
+// capture sources and the TLS certificate. Command-line flags keep taking
+// precedence.
+type configReloader struct {
+	cmd *cobra.Command
+	// logLevel is the active level; configuredLevel is the level from config,
+	// which SIGUSR2 toggles back to
+	logLevel        *slog.LevelVar
+	configuredLevel *slog.LevelVar
+	server          *server.Server
+	logger          logger.Logger
+}
+
+// reload validates the whole new config before applying any of it, so a bad
+// config is rejected and the running one kept. The server applies the
+// settings other than the log level.
+func (r *configReloader) reload() error {
+	cfg, err := loadServerConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := applyServerFlags(r.cmd, cfg); err != nil {
+		return err
+	}
+
+	level, err := logger.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return err
+	}
+	if err := r.server.Reload(cfg); err != nil {
+		return err
+	}
+
+	r.configuredLevel.Set(level)
+	r.logLevel.Set(level)
+
+	r.logger.LogWarning(context.TODO(), "Configuration reloaded",
+		"log_level", strings.ToLower(level.String()),
+		"timestamp_tolerance", cfg.Webhook.TimestampTolerance.String(),
+		"capture_sources", cfg.Debug.CaptureSources)
+	return nil
+}
+
+// reloadOnSignal reloads the config each time SIGHUP is received. The
+// returned function stops watching.
+func reloadOnSignal(r *configReloader) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-signals:
+				if err := r.reload(); err != nil {
+					r.logger.LogError(context.TODO(), "Configuration reload rejected, keeping current config", err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+// watchRemoteConfig fetches the remote config document every
+// remote.WatchInterval and reloads the config when it changes. The returned
+// function stops watching.
+func watchRemoteConfig(r *configReloader, remote config.Remote) func() {
+	ticker := time.NewTicker(remote.WatchInterval)
+	done := make(chan struct{})
+
+	go func() {
+		// Baseline to compare against; a failed fetch leaves it empty, so the
+		// next successful one reloads
+		last, _ := config.FetchRemote(remote)
+		failing := false
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				settings, err := config.FetchRemote(remote)
+				if err != nil {
+					// Log once per outage rather than on every poll
+					if !failing {
+						r.logger.LogError(context.TODO(), "Failed to fetch remote config, keeping current config", err)
+					}
+					failing = true
+					continue
+				}
+				failing = false
+				if reflect.DeepEqual(settings, last) {
+					continue
+				}
+
+				last = settings
+				if err := r.reload(); err != nil {
+					r.logger.LogError(context.TODO(), "Configuration reload rejected, keeping current config", err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
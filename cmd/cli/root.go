@@ -1,8 +1,11 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"runtime"
+	"runtime/debug"
 
 	"github.com/spf13/cobra"
 )
@@ -14,11 +17,21 @@ const (
 	Verbal = "Initial"
 )
 
+// Build metadata, injected at build time via
+// -ldflags "-X kii.com/cmd/cli.GitCommit=<sha> -X kii.com/cmd/cli.BuildDate=<rfc3339>"
+var (
+	GitCommit = "" //nolint:gochecknoglobals
+	BuildDate = "" //nolint:gochecknoglobals
+)
+
 var rootCmd = &cobra.Command{ //nolint:gochecknoglobals
 	Use:  "kii",
 	Long: "Kii - Signed Webhook Challenge Service",
 }
 
+// configDir is the --config-dir flag shared by all commands
+var configDir string //nolint:gochecknoglobals
+
 // Run enters into the cobra command to start the service.
 func Run() error {
 	// Check if the CONFIG_ENV environment variable is set
@@ -33,14 +46,73 @@ func Run() error {
 	return nil
 }
 
+// VersionInfo describes the running binary
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Verbal    string `json:"verbal"`
+	GitCommit string `json:"gitCommit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// Version returns the version information of the running binary. When the
+// commit was not injected via ldflags, the VCS revision recorded by the Go
+// toolchain is used instead.
+func Version() VersionInfo {
+	info := VersionInfo{
+		Version:   fmt.Sprintf("%s.%s.%s", Major, Minor, Fix),
+		Verbal:    Verbal,
+		GitCommit: GitCommit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range buildInfo.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.GitCommit == "":
+				info.GitCommit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+	if info.GitCommit == "" {
+		info.GitCommit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+
+	return info
+}
+
 var versionCmd = &cobra.Command{ //nolint:gochecknoglobals
 	Use:   "version",
 	Short: "Describes version.",
-	Run: func(_ *cobra.Command, _ []string) {
-		fmt.Printf("Version: %s.%s.%s %s\n", Major, Minor, Fix, Verbal)
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		info := Version()
+
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(info)
+		}
+
+		out := cmd.OutOrStdout()
+		_, _ = fmt.Fprintf(out, "Version: %s %s\n", info.Version, info.Verbal)
+		_, _ = fmt.Fprintf(out, "Commit: %s\n", info.GitCommit)
+		_, _ = fmt.Fprintf(out, "Built: %s\n", info.BuildDate)
+		_, err := fmt.Fprintf(out, "Go: %s %s\n", info.GoVersion, info.Platform)
+		return err
 	},
 }
 
 func init() { //nolint:gochecknoinits
+	rootCmd.PersistentFlags().StringVar(&configDir, "config-dir", "",
+		"directory containing app-config and <CONFIG_ENV> config files (.yaml, .yml, .toml or .json) (default: cmd/config/server next to the binary, or $KII_CONFIG_DIR)")
+	versionCmd.Flags().Bool("json", false, "print version information as JSON")
 	rootCmd.AddCommand(versionCmd)
 }
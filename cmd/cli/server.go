@@ -3,19 +3,20 @@ package cli
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
-	"kii.com/internal/application/usecase"
 	"kii.com/internal/infrastructure/config"
-	httphandler "kii.com/internal/infrastructure/http"
+	"kii.com/internal/infrastructure/errorreporting"
 	"kii.com/internal/infrastructure/logger"
-	"kii.com/internal/infrastructure/repository"
-	"kii.com/internal/infrastructure/validator"
+	"kii.com/internal/infrastructure/tracing"
+	"kii.com/server"
 
 	"github.com/spf13/cobra"
 )
@@ -25,105 +26,292 @@ const serverDir = "server"
 var apiServerCmd = &cobra.Command{
 	Use:   "server",
 	Short: "Run API Server.",
-	RunE: func(_ *cobra.Command, _ []string) error {
-		// Initialize logger
-		appLogger := logger.NewLogger()
-
-		// Get config directory (relative to where the binary is run from)
-		configDir := filepath.Join("cmd", "config", serverDir)
-		if _, err := os.Stat(configDir); os.IsNotExist(err) {
-			// Try absolute path from project root
-			configDir = filepath.Join(".", "cmd", "config", serverDir)
-		}
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		// Initialize logger; the level is set from config below and can be
+		// changed at runtime through the admin API or SIGUSR2
+		logLevel := new(slog.LevelVar)
+		appLogger := logger.NewLoggerWithLevel(logLevel)
 
 		// Load configuration
-		cfg, err := config.LoadConfig(configDir)
+		cfg, err := loadServerConfig()
 		if err != nil {
 			appLogger.LogError(context.TODO(), "Failed to load config", err)
 			return fmt.Errorf("failed to load config: %w", err)
 		}
 
+		// Command-line flags take precedence over file and env config
+		if err := applyServerFlags(cmd, cfg); err != nil {
+			appLogger.LogError(context.TODO(), "Invalid server flags", err)
+			return err
+		}
+
+		configuredLevel, err := logger.ParseLevel(cfg.Log.Level)
+		if err != nil {
+			appLogger.LogError(context.TODO(), "Invalid log level", err)
+			return err
+		}
+		logLevel.Set(configuredLevel)
+		// The configured level is kept separately so SIGUSR2 can toggle back
+		// to it after a SIGHUP reload changes it
+		configuredLogLevel := new(slog.LevelVar)
+		configuredLogLevel.Set(configuredLevel)
+
+		// Switch to the configured backend; the startup logger above is only
+		// used until the config is loaded
+		appLogger, err = logger.New(cfg.Log.Backend, cfg.Log.Format, logLevel)
+		if err != nil {
+			return fmt.Errorf("failed to initialize logger: %w", err)
+		}
+		if cfg.Log.SampleRate > 1 {
+			appLogger = logger.NewSamplingLogger(appLogger)
+		}
+
+		// Errors logged anywhere are also shipped to Sentry when configured
+		if cfg.ErrorReporting.SentryDSN != "" {
+			reporter, err := errorreporting.NewSentryReporter(cfg.ErrorReporting, Version().Version)
+			if err != nil {
+				appLogger.LogError(context.TODO(), "Failed to initialize error reporting", err)
+				return err
+			}
+			defer reporter.Flush(2 * time.Second)
+			appLogger = logger.NewReportingLogger(appLogger, reporter)
+		}
+		stopLevelToggle := toggleDebugOnSignal(logLevel, configuredLogLevel, appLogger)
+		defer stopLevelToggle()
+
 		appLogger.LogInfo(context.TODO(), "Configuration loaded",
+			"config_dir", serverConfigDir(),
 			"port", cfg.Server.Port,
-			"timestamp_tolerance", cfg.Webhook.TimestampTolerance.String())
-
-		// Initialize infrastructure adapters
-		ledgerRepo := repository.NewInMemoryLedger(appLogger)
-		webhookValidator := validator.NewHMACValidator(
-			cfg.Webhook.HMACSecret,
-			cfg.Webhook.TimestampTolerance,
-			appLogger,
-		)
-
-		// Initialize use cases
-		processWebhookUseCase := usecase.NewProcessWebhookUseCase(
-			webhookValidator,
-			ledgerRepo,
-		)
-		getBalanceUseCase := usecase.NewGetBalanceUseCase(ledgerRepo)
-
-		// Initialize HTTP handler
-		handler := httphandler.NewHandler(
-			processWebhookUseCase,
-			getBalanceUseCase,
-			webhookValidator,
-			appLogger,
-		)
-
-		// Setup routes
-		mux := handler.SetupRoutes()
-
-		// Create HTTP server
-		addr := ":" + cfg.Server.Port
-		server := &http.Server{
-			Addr:         addr,
-			Handler:      mux,
-			ReadTimeout:  15 * time.Second,
-			WriteTimeout: 15 * time.Second,
-			IdleTimeout:  60 * time.Second,
+			"unix_socket", cfg.Server.UnixSocket,
+			"timestamp_tolerance", cfg.Webhook.TimestampTolerance.String(),
+			"storage_backend", cfg.Storage.Backend,
+			"log_level", cfg.Log.Level,
+			"log_backend", cfg.Log.Backend,
+			"remote_config", cfg.Remote.Provider)
+		if !configDirFound() {
+			appLogger.LogInfo(context.TODO(), "Config directory not found, using embedded defaults and environment variables only",
+				"config_dir", serverConfigDir())
+		}
+
+		// Initialize tracing (no-op unless tracing.enabled)
+		shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing, Version().Version)
+		if err != nil {
+			appLogger.LogError(context.TODO(), "Failed to initialize tracing", err)
+			return err
+		}
+		defer func() {
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(flushCtx); err != nil {
+				appLogger.LogError(context.TODO(), "Failed to flush traces", err)
+			}
+		}()
+
+		// Assemble the webhook receiver and ledger from the config
+		serverOpts := []server.Option{server.WithLogger(appLogger), server.WithLogLevel(logLevel)}
+		if mock, _ := cmd.Flags().GetBool("mock"); mock {
+			serverOpts = append(serverOpts, server.WithMock())
+		}
+		if readOnly, _ := cmd.Flags().GetBool("read-only"); readOnly {
+			serverOpts = append(serverOpts, server.WithReadOnly())
+		}
+		srv, err := server.New(cfg, serverOpts...)
+		if err != nil {
+			appLogger.LogError(context.TODO(), "Failed to initialize server", err)
+			return err
+		}
+
+		// SIGHUP reloads the settings that can change without a restart
+		reloader := &configReloader{
+			cmd:             cmd,
+			logLevel:        logLevel,
+			configuredLevel: configuredLogLevel,
+			server:          srv,
+			logger:          appLogger,
+		}
+		stopReload := reloadOnSignal(reloader)
+		defer stopReload()
+		if cfg.Remote.Provider != "" {
+			stopRemoteWatch := watchRemoteConfig(reloader, cfg.Remote)
+			defer stopRemoteWatch()
 		}
 
 		// Channel to capture termination signals
 		signalChan := make(chan os.Signal, 1)
-		signal.Notify(signalChan, os.Interrupt, syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
+		signal.Notify(signalChan, os.Interrupt, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
 
 		// Error channel to capture errors from server
 		errChan := make(chan error, 1)
 
 		// Start server in a goroutine
 		go func() {
-			appLogger.LogInfo(context.TODO(), "Starting server",
-				"address", addr,
-				"timestamp_tolerance", cfg.Webhook.TimestampTolerance.String())
-			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 				errChan <- err
 			}
 		}()
 
-		// Graceful shutdown
-		select {
-		case <-signalChan:
-			appLogger.LogInfo(context.TODO(), "Received termination signal. Initiating graceful shutdown...")
-
-			// Create shutdown context with timeout
-			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
+		// SIGUSR1 hands the listeners over to a new copy of the binary, then
+		// drains like a graceful shutdown; SIGUSR2 toggles the log level
+		handoverChan := make(chan os.Signal, 1)
+		signal.Notify(handoverChan, syscall.SIGUSR1)
+		defer signal.Stop(handoverChan)
 
-			if err := server.Shutdown(shutdownCtx); err != nil {
-				appLogger.LogError(context.TODO(), "Server forced to shutdown", err)
-				return err
+		// Graceful shutdown
+		var serveErr error
+	wait:
+		for {
+			select {
+			case <-signalChan:
+				appLogger.LogInfo(context.TODO(), "Received termination signal. Initiating graceful shutdown...")
+				break wait
+			case <-handoverChan:
+				appLogger.LogInfo(context.TODO(), "Received handover signal. Starting the new binary...")
+				if err := handOver(srv, cfg.Server.HandoverTimeout); err != nil {
+					appLogger.LogError(context.TODO(), "Handover failed, still serving", err)
+					continue
+				}
+				break wait
+			case serveErr = <-errChan:
+				appLogger.LogError(context.TODO(), "Server error", serveErr)
+				break wait
 			}
+		}
 
-			appLogger.LogInfo(context.TODO(), "Server stopped gracefully")
-		case err := <-errChan:
-			appLogger.LogError(context.TODO(), "Server error", err)
+		// Create shutdown context with timeout
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			appLogger.LogError(context.TODO(), "Server forced to shutdown", err)
 			return err
 		}
+		if serveErr != nil {
+			return serveErr
+		}
 
+		appLogger.LogInfo(context.TODO(), "Server stopped gracefully")
 		return nil
 	},
 }
 
+// handOver hands the server's listeners over to a new process, waiting at
+// most timeout for it to serve
+func handOver(srv *server.Server, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return srv.Handover(ctx)
+}
+
+// loadServerConfig loads the server configuration for the current CONFIG_ENV
+func loadServerConfig(opts ...config.LoadOption) (*config.Config, error) {
+	return server.LoadConfig(serverConfigDir(), opts...)
+}
+
+// serverConfigDir returns the server config directory. It is taken from
+// --config-dir, then KII_CONFIG_DIR, and finally defaults to cmd/config/server
+// next to the executable, independent of the working directory.
+func serverConfigDir() string {
+	if configDir != "" {
+		return configDir
+	}
+	if dir := os.Getenv("KII_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return filepath.Join(filepath.Dir(exe), "cmd", "config", serverDir)
+}
+
+// configDirFound reports whether the server config directory exists. The
+// server runs without one, from the embedded defaults and environment
+// variables.
+func configDirFound() bool {
+	info, err := os.Stat(serverConfigDir())
+	return err == nil && info.IsDir()
+}
+
+// addServerFlags registers the flags applyServerFlags reads on cmd
+func addServerFlags(cmd *cobra.Command) {
+	cmd.Flags().String("port", "", "port to listen on (overrides server.port)")
+	cmd.Flags().String("hmac-secret-file", "", "file containing the HMAC secret (overrides webhook.hmacSecret)")
+	cmd.Flags().Duration("tolerance", 0, "timestamp tolerance, e.g. 5m (overrides webhook.timestampTolerance)")
+	cmd.Flags().String("backend", "", "storage backend: memory (overrides storage.backend)")
+	cmd.Flags().String("log-level", "", "log level: debug, info, warn or error (overrides log.level)")
+}
+
+// applyServerFlags overrides the loaded config with explicitly set server flags
+func applyServerFlags(cmd *cobra.Command, cfg *config.Config) error {
+	flags := cmd.Flags()
+
+	if flags.Changed("port") {
+		cfg.Server.Port, _ = flags.GetString("port")
+	}
+	if flags.Changed("tolerance") {
+		tolerance, _ := flags.GetDuration("tolerance")
+		if tolerance <= 0 {
+			return fmt.Errorf("--tolerance must be positive")
+		}
+		cfg.Webhook.TimestampTolerance = tolerance
+	}
+	if flags.Changed("hmac-secret-file") {
+		path, _ := flags.GetString("hmac-secret-file")
+		secret, err := config.ReadSecretFile(path)
+		if err != nil {
+			return fmt.Errorf("--hmac-secret-file: %w", err)
+		}
+		cfg.Webhook.HMACSecret = secret
+		cfg.Webhook.HMACSecretFile = path
+	}
+	if flags.Changed("backend") {
+		cfg.Storage.Backend, _ = flags.GetString("backend")
+	}
+	if flags.Changed("log-level") {
+		cfg.Log.Level, _ = flags.GetString("log-level")
+	}
+
+	return nil
+}
+
+// toggleDebugOnSignal switches between debug and the configured level each
+// time SIGUSR2 is received. The returned function stops watching.
+func toggleDebugOnSignal(level, configured *slog.LevelVar, appLogger logger.Logger) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR2)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-signals:
+				next := slog.LevelDebug
+				if level.Level() == slog.LevelDebug {
+					next = configured.Level()
+				}
+				level.Set(next)
+				appLogger.LogWarning(context.TODO(), "Log level changed by SIGUSR2", "level", strings.ToLower(next.String()))
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
 func init() { //nolint:gochecknoinits
+	addServerFlags(apiServerCmd)
+	apiServerCmd.Flags().Bool("mock", false,
+		"sandbox for partners: apply webhooks whether or not they validate, reporting it in X-Validation-Report, and persist nothing")
+	apiServerCmd.Flags().Bool("read-only", false,
+		"read-only replica: serve balances and history from a store another server writes, and reject webhooks with 405")
 	rootCmd.AddCommand(apiServerCmd)
 }
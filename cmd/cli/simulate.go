@@ -0,0 +1,262 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/cobra"
+
+	"kii.com/internal/domain/entity"
+)
+
+// simulatedKind is the kind of delivery the simulator sends
+type simulatedKind int
+
+const (
+	simulatedValid simulatedKind = iota
+	simulatedInvalidSignature
+	simulatedReplay
+)
+
+// replayBufferSize bounds how many past deliveries are kept for replays
+const replayBufferSize = 256
+
+var simulateCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:   "simulate",
+	Short: "Stream realistic signed webhook traffic to a server.",
+	Long: `Continuously send signed webhooks to a running server until interrupted
+(or --duration elapses), for soak testing and demo environments.
+
+Traffic is spread over --users users and the --assets list with Poisson
+arrivals around --rate per second. A share of deliveries are withdrawals
+(negative amounts), carry an invalid signature, or replay an earlier
+delivery. Every response is checked against the expected outcome and a
+summary is printed each --report-interval.`,
+	SilenceUsage: true,
+	PreRunE: func(cmd *cobra.Command, _ []string) error {
+		invalidRatio, _ := cmd.Flags().GetFloat64("invalid-ratio")
+		replayRatio, _ := cmd.Flags().GetFloat64("replay-ratio")
+		withdrawRatio, _ := cmd.Flags().GetFloat64("withdraw-ratio")
+		if invalidRatio < 0 || replayRatio < 0 || invalidRatio+replayRatio > 1 {
+			return fmt.Errorf("--invalid-ratio and --replay-ratio must be non-negative and sum to at most 1")
+		}
+		if withdrawRatio < 0 || withdrawRatio > 1 {
+			return fmt.Errorf("--withdraw-ratio must be between 0 and 1")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		sim := &simulator{client: &http.Client{Timeout: 10 * time.Second}}
+		sim.url, _ = cmd.Flags().GetString("url")
+		sim.rate, _ = cmd.Flags().GetFloat64("rate")
+		sim.users, _ = cmd.Flags().GetInt("users")
+		sim.assets, _ = cmd.Flags().GetStringSlice("assets")
+		sim.invalidRatio, _ = cmd.Flags().GetFloat64("invalid-ratio")
+		sim.replayRatio, _ = cmd.Flags().GetFloat64("replay-ratio")
+		sim.withdrawRatio, _ = cmd.Flags().GetFloat64("withdraw-ratio")
+		duration, _ := cmd.Flags().GetDuration("duration")
+		reportInterval, _ := cmd.Flags().GetDuration("report-interval")
+		secret, _ := cmd.Flags().GetString("secret")
+
+		if sim.rate <= 0 || sim.users <= 0 || len(sim.assets) == 0 || reportInterval <= 0 {
+			return fmt.Errorf("--rate, --users and --report-interval must be positive and --assets non-empty")
+		}
+
+		var err error
+		if sim.secret, err = resolveSecret(secret); err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+		if duration > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, duration)
+			defer cancel()
+		}
+
+		out := cmd.OutOrStdout()
+		_, _ = fmt.Fprintf(out, "Simulating ~%.1f webhooks/s against %s (Ctrl+C to stop)\n", sim.rate, sim.url)
+		sim.run(ctx, out, reportInterval)
+		_, _ = fmt.Fprintln(out, "Final: "+sim.summary())
+
+		return nil
+	},
+}
+
+// simulator generates a continuous stream of webhook deliveries
+type simulator struct {
+	url           string
+	secret        string
+	rate          float64
+	users         int
+	assets        []string
+	invalidRatio  float64
+	replayRatio   float64
+	withdrawRatio float64
+	client        *http.Client
+
+	mu      sync.Mutex
+	history []signedWebhook
+
+	sent       [3]atomic.Uint64
+	unexpected atomic.Uint64
+	failed     atomic.Uint64
+}
+
+// run sends deliveries until ctx is done, reporting progress periodically
+func (s *simulator) run(ctx context.Context, out io.Writer, reportInterval time.Duration) {
+	report := time.NewTicker(reportInterval)
+	defer report.Stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		// Exponential inter-arrival times give a Poisson arrival process
+		wait := time.Duration(rand.ExpFloat64() / s.rate * float64(time.Second)) //nolint:gosec
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-report.C:
+			timer.Stop()
+			_, _ = fmt.Fprintln(out, time.Now().Format(time.TimeOnly)+" "+s.summary())
+		case <-timer.C:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.deliver(ctx)
+			}()
+		}
+	}
+}
+
+// deliver sends one delivery of a randomly chosen kind and checks the response
+func (s *simulator) deliver(ctx context.Context) {
+	kind := simulatedValid
+	switch roll := rand.Float64(); { //nolint:gosec
+	case roll < s.invalidRatio:
+		kind = simulatedInvalidSignature
+	case roll < s.invalidRatio+s.replayRatio:
+		kind = simulatedReplay
+	}
+
+	webhook, ok := s.nextWebhook(kind)
+	if !ok {
+		kind = simulatedValid
+		webhook, ok = s.nextWebhook(kind)
+		if !ok {
+			s.failed.Add(1)
+			return
+		}
+	}
+
+	req, err := webhook.request(ctx, s.url)
+	if err != nil {
+		s.failed.Add(1)
+		return
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.failed.Add(1)
+		}
+		return
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	s.sent[kind].Add(1)
+	wantStatus := http.StatusUnauthorized
+	if kind == simulatedValid {
+		wantStatus = http.StatusOK
+		s.remember(webhook)
+	}
+	if resp.StatusCode != wantStatus {
+		s.unexpected.Add(1)
+	}
+}
+
+// nextWebhook builds a delivery of the given kind; replays need history
+func (s *simulator) nextWebhook(kind simulatedKind) (signedWebhook, bool) {
+	if kind == simulatedReplay {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if len(s.history) == 0 {
+			return signedWebhook{}, false
+		}
+		return s.history[rand.IntN(len(s.history))], true //nolint:gosec
+	}
+
+	amount := decimal.NewFromFloat(rand.ExpFloat64() * 10).Round(8) //nolint:gosec
+	if rand.Float64() < s.withdrawRatio {                           //nolint:gosec
+		amount = amount.Neg()
+	}
+	body, _ := json.Marshal(entity.WebhookRequest{
+		User:   fmt.Sprintf("sim-user-%d", rand.IntN(s.users)),        //nolint:gosec
+		Asset:  strings.TrimSpace(s.assets[rand.IntN(len(s.assets))]), //nolint:gosec
+		Amount: amount.StringFixed(8),
+	})
+
+	webhook, err := newSignedWebhook(s.secret, body)
+	if err != nil {
+		return signedWebhook{}, false
+	}
+	if kind == simulatedInvalidSignature {
+		// Flip the last hex digit so the signature is well-formed but wrong
+		last := webhook.signature[len(webhook.signature)-1]
+		flipped := byte('0')
+		if last == '0' {
+			flipped = '1'
+		}
+		webhook.signature = webhook.signature[:len(webhook.signature)-1] + string(flipped)
+	}
+
+	return webhook, true
+}
+
+// remember keeps a bounded history of accepted deliveries for replays
+func (s *simulator) remember(webhook signedWebhook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.history) < replayBufferSize {
+		s.history = append(s.history, webhook)
+		return
+	}
+	s.history[rand.IntN(replayBufferSize)] = webhook //nolint:gosec
+}
+
+func (s *simulator) summary() string {
+	return fmt.Sprintf("valid=%d invalid_signature=%d replays=%d unexpected_responses=%d transport_errors=%d",
+		s.sent[simulatedValid].Load(), s.sent[simulatedInvalidSignature].Load(), s.sent[simulatedReplay].Load(),
+		s.unexpected.Load(), s.failed.Load())
+}
+
+func init() { //nolint:gochecknoinits
+	simulateCmd.Flags().String("url", "http://localhost:8080", "base URL of the target server")
+	simulateCmd.Flags().String("secret", "", "HMAC secret (defaults to the configured webhook.hmacSecret)")
+	simulateCmd.Flags().Float64("rate", 5, "average webhooks per second")
+	simulateCmd.Flags().Duration("duration", 0, "stop after this long (0 runs until interrupted)")
+	simulateCmd.Flags().Int("users", 50, "number of distinct users")
+	simulateCmd.Flags().StringSlice("assets", []string{"BTC", "ETH", "USDT"}, "assets to draw from")
+	simulateCmd.Flags().Float64("invalid-ratio", 0.02, "share of deliveries sent with an invalid signature")
+	simulateCmd.Flags().Float64("replay-ratio", 0.02, "share of deliveries that replay an earlier delivery")
+	simulateCmd.Flags().Float64("withdraw-ratio", 0.2, "share of valid deliveries with a negative amount")
+	simulateCmd.Flags().Duration("report-interval", 10*time.Second, "how often to print a summary")
+	rootCmd.AddCommand(simulateCmd)
+}
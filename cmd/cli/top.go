@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"kii.com/internal/infrastructure/metrics"
+)
+
+// adminStats mirrors the GET /admin/stats response
+type adminStats struct {
+	metrics.Snapshot
+	NonceStoreSize int `json:"nonceStoreSize"`
+}
+
+var topCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:   "top",
+	Short: "Live terminal dashboard of server activity.",
+	Long: `Poll the admin stats endpoint and show request rates, validation failure
+reasons, top users by entry volume and nonce store size. Press Ctrl+C to exit.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		client, err := newAdminClient(cmd)
+		if err != nil {
+			return err
+		}
+		interval, _ := cmd.Flags().GetDuration("interval")
+		users, _ := cmd.Flags().GetInt("users")
+		if interval <= 0 {
+			return fmt.Errorf("--interval must be positive")
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var previous *adminStats
+		var previousAt time.Time
+		for {
+			var current adminStats
+			err := client.do(ctx, http.MethodGet, fmt.Sprintf("/admin/stats?top=%d", users), &current)
+			now := time.Now()
+
+			var screen strings.Builder
+			renderTop(&screen, client.baseURL, &current, previous, now.Sub(previousAt), err)
+			// Clear the screen and move the cursor home before redrawing
+			_, _ = fmt.Fprint(cmd.OutOrStdout(), "\033[H\033[2J"+screen.String())
+
+			if err == nil {
+				previous, previousAt = &current, now
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	},
+}
+
+// renderTop draws one dashboard frame. Rates are derived from the previous poll.
+func renderTop(w io.Writer, target string, current, previous *adminStats, elapsed time.Duration, pollErr error) {
+	_, _ = fmt.Fprintf(w, "kii top - %s - %s\n\n", target, time.Now().Format(time.TimeOnly))
+	if pollErr != nil {
+		_, _ = fmt.Fprintf(w, "error: %v\n", pollErr)
+		return
+	}
+
+	rate := func(now, before uint64) string {
+		if previous == nil || elapsed <= 0 || now < before {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f/s", float64(now-before)/elapsed.Seconds())
+	}
+	var prevRequests, prevEntries uint64
+	if previous != nil {
+		prevRequests, prevEntries = previous.Requests, previous.Entries
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "Uptime\t%s\n", (time.Duration(current.UptimeSeconds) * time.Second).String())
+	_, _ = fmt.Fprintf(tw, "Requests\t%d\t%s\n", current.Requests, rate(current.Requests, prevRequests))
+	_, _ = fmt.Fprintf(tw, "Entries applied\t%d\t%s\n", current.Entries, rate(current.Entries, prevEntries))
+	_, _ = fmt.Fprintf(tw, "Nonce store size\t%d\n", current.NonceStoreSize)
+	_ = tw.Flush()
+
+	_, _ = fmt.Fprintln(w, "\nStatus codes")
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, status := range sortedKeys(current.RequestsByStatus) {
+		var before uint64
+		if previous != nil {
+			before = previous.RequestsByStatus[status]
+		}
+		_, _ = fmt.Fprintf(tw, "  %d\t%d\t%s\n", status, current.RequestsByStatus[status], rate(current.RequestsByStatus[status], before))
+	}
+	_ = tw.Flush()
+
+	_, _ = fmt.Fprintln(w, "\nValidation failures")
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, reason := range sortedKeys(current.ValidationFailures) {
+		var before uint64
+		if previous != nil {
+			before = previous.ValidationFailures[reason]
+		}
+		_, _ = fmt.Fprintf(tw, "  %s\t%d\t%s\n", reason, current.ValidationFailures[reason], rate(current.ValidationFailures[reason], before))
+	}
+	_ = tw.Flush()
+
+	_, _ = fmt.Fprintln(w, "\nTop users by entries")
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, user := range current.TopUsers {
+		_, _ = fmt.Fprintf(tw, "  %s\t%d\n", user.User, user.Entries)
+	}
+	_ = tw.Flush()
+}
+
+// sortedKeys returns the keys of m in ascending order
+func sortedKeys[K int | string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+func init() { //nolint:gochecknoinits
+	addAdminFlags(topCmd)
+	topCmd.Flags().Duration("interval", 2*time.Second, "refresh interval")
+	topCmd.Flags().Int("users", 10, "number of top users to show")
+	rootCmd.AddCommand(topCmd)
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"kii.com/internal/infrastructure/metrics"
+)
+
+var usageCmd = &cobra.Command{ //nolint:gochecknoglobals
+	Use:   "usage",
+	Short: "Show the monthly usage report per tenant.",
+	Long: `Show webhooks accepted, data volume and validation failures per tenant
+(webhook source) for a month, for billing and capacity planning. The default
+/webhook endpoint is reported as tenant "default".`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		client, err := newAdminClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		query := url.Values{}
+		if month, _ := cmd.Flags().GetString("month"); month != "" {
+			query.Set("month", month)
+		}
+		var report struct {
+			metrics.UsageReport
+			Months []string `json:"months"`
+		}
+		if err := client.do(cmd.Context(), http.MethodGet, "/admin/usage?"+query.Encode(), &report); err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			encoder := json.NewEncoder(out)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(report.UsageReport)
+		}
+
+		_, _ = fmt.Fprintf(out, "Usage for %s\n\n", report.Month)
+		var total metrics.TenantUsage
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "TENANT\tWEBHOOKS\tBYTES\tVALIDATION FAILURES")
+		for _, usage := range report.Tenants {
+			_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", usage.Tenant, usage.Webhooks, usage.Bytes, usage.ValidationFailures)
+			total.Webhooks += usage.Webhooks
+			total.Bytes += usage.Bytes
+			total.ValidationFailures += usage.ValidationFailures
+		}
+		_, _ = fmt.Fprintf(w, "total\t%d\t%d\t%d\n", total.Webhooks, total.Bytes, total.ValidationFailures)
+		_ = w.Flush()
+		_, _ = fmt.Fprintf(out, "\nMonths with usage: %v\n", report.Months)
+
+		return nil
+	},
+}
+
+func init() { //nolint:gochecknoinits
+	addAdminFlags(usageCmd)
+	usageCmd.Flags().String("month", "", "month to report, as YYYY-MM (default: current month)")
+	usageCmd.Flags().Bool("json", false, "print the report as JSON")
+	rootCmd.AddCommand(usageCmd)
+}
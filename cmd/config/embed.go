@@ -0,0 +1,13 @@
+// Package config embeds the default configuration files, so the binary runs
+// from any working directory without a config directory.
+package config
+
+import (
+	_ "embed"
+)
+
+// ServerDefaults is server/app-config.yaml, the base server configuration
+// that config files and environment variables are layered over
+//
+//go:embed server/app-config.yaml
+var ServerDefaults []byte //nolint:gochecknoglobals
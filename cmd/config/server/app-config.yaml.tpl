@@ -1,6 +1,209 @@
 server:
   port: "8080"
+  readTimeout: "15s"
+  readHeaderTimeout: "5s"
+  writeTimeout: "15s"
+  idleTimeout: "60s"
+  maxHeaderBytes: 1048576
+  disableKeepAlives: false
+  maxConnections: 0
+  shutdownTimeout: "30s"
+  handoverTimeout: "30s"
+  unixSocket: ""
+  unixSocketMode: "0660"
+  unixSocketGroup: ""
+  disableTcp: false
+  proxyProtocol: false
+  proxyProtocolSources: []
+  tlsCertFile: ""
+  tlsKeyFile: ""
+  disableHttp2: false
+  h2c: false
+  http2MaxConcurrentStreams: 250
 
 webhook:
   hmacSecret: "default-secret-key-change-in-production"
+  hmacSecretFile: ""
   timestampTolerance: "5m"
+  clockOffset: "0s"
+  nonceStorePath: ""
+  nonceRetentionMargin: "5m"
+  lenientAmounts: false
+  maxBodyBytes: 0
+  canary:
+    secret: ""
+    secretFile: ""
+    scheme: ""
+    timestampFormat: ""
+    headers:
+      timestamp: ""
+      nonce: ""
+      signature: ""
+
+storage:
+  backend: "memory"
+  batchSize: 0
+  batchWindow: "5ms"
+  readTimeout: "5s"
+  writeTimeout: "5s"
+  shadow:
+    backend: ""
+    compareInterval: "1m"
+    queueSize: 1000
+  retry:
+    maxAttempts: 3
+    backoff: "50ms"
+  circuitBreaker:
+    failureThreshold: 5
+    openTimeout: "30s"
+
+admin:
+  token: ""
+
+tracing:
+  enabled: false
+  endpoint: ""
+  insecure: false
+  serviceName: "kii"
+  sampleRatio: 1
+
+debug:
+  enabled: false
+  captureSources: []
+  signatureHints: false
+
+mirror:
+  url: ""
+  secret: ""
+  secretFile: ""
+  queueSize: 1000
+  timeout: "5s"
+
+events:
+  publisher: ""
+  queueSize: 1000
+  timeout: "5s"
+  kafka:
+    restProxyUrl: ""
+    topic: "kii.balances"
+  nats:
+    url: ""
+    subject: "kii.balances"
+
+analytics:
+  interval: "5m"
+  maxRows: 100000
+  objectStore:
+    backend: ""
+    dir: ""
+    endpoint: ""
+    region: ""
+    bucket: ""
+    prefix: ""
+    accessKeyId: ""
+    secretAccessKey: ""
+    serverSideEncryption: ""
+    kmsKeyId: ""
+    customerKey: ""
+
+audit:
+  sink: ""
+  path: ""
+  syslogNetwork: ""
+  syslogAddress: ""
+
+log:
+  level: "info"
+  backend: "slog"
+  format: "json"
+  sampleRate: 1
+
+errorReporting:
+  sentryDsn: ""
+  environment: ""
+  sampleRate: 1
+
+accessLog:
+  path: ""
+  format: "combined"
+
+metrics:
+  backend: ""
+  address: "127.0.0.1:8125"
+  prefix: "kii."
+  tags: []
+
+workers:
+  poolSize: 16
+  queueDepth: 1024
+
+cluster:
+  enabled: false
+
+usage:
+  path: ""
+
+approval:
+  threshold: ""
+  pendingTTL: "24h"
+  distinctSources: true
+
+users:
+  pattern: ""
+  maxLength: 0
+  case: "preserve"
+
+velocity:
+  action: "reject"
+  rules: []
+
+duplicates:
+  window: "0s"
+  action: "log"
+
+freezes:
+  path: ""
+
+anomaly:
+  amountFactor: 0
+  minHistory: 5
+  burstCount: 0
+  burstWindow: "1m"
+
+attestation:
+  keyFile: ""
+  keyId: ""
+
+retention:
+  interval: "0s"
+  idleAfter: "0s"
+  archivePath: ""
+  maxAge: "0s"
+  objectStore:
+    backend: ""
+    dir: ""
+    endpoint: ""
+    region: ""
+    bucket: ""
+    prefix: ""
+    accessKeyId: ""
+    secretAccessKey: ""
+    serverSideEncryption: ""
+    kmsKeyId: ""
+    customerKey: ""
+
+remote:
+  provider: ""
+  endpoint: ""
+  path: ""
+  format: "yaml"
+  timeout: "5s"
+  watchInterval: "30s"
+
+errors:
+  messages: {}
+  locales: {}
+
+sources: {}
+
+assets: {}
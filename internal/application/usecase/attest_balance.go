@@ -0,0 +1,52 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+)
+
+// AttestBalanceUseCase handles signed balance attestations
+type AttestBalanceUseCase struct {
+	repository port.LedgerRepository
+	signer     port.AttestationSigner
+	clock      port.Clock
+}
+
+// NewAttestBalanceUseCase creates a new AttestBalanceUseCase signing with
+// signer and timestamping with clock
+func NewAttestBalanceUseCase(repository port.LedgerRepository, signer port.AttestationSigner, clock port.Clock) *AttestBalanceUseCase {
+	return &AttestBalanceUseCase{
+		repository: repository,
+		signer:     signer,
+		clock:      clock,
+	}
+}
+
+// Execute returns the user's current balances as a signed JWS
+func (uc *AttestBalanceUseCase) Execute(ctx context.Context, user string) (_ string, err error) {
+	ctx, span := tracer.Start(ctx, "AttestBalanceUseCase.Execute", trace.WithAttributes(attribute.String("ledger.user", user)))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	balance, err := uc.repository.GetBalance(ctx, user)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(entity.BalanceAttestation{
+		User:      balance.User,
+		Balances:  balance.Balances,
+		Timestamp: uc.clock.Now().UTC(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode attestation: %w", err)
+	}
+	return uc.signer.Sign(payload)
+}
@@ -0,0 +1,91 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"kii.com/internal/domain/entity"
+)
+
+// fixedClock is a Clock stopped at a point in time
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+// mockSigner is a mock implementation of AttestationSigner
+type mockSigner struct {
+	signFunc func(payload []byte) (string, error)
+}
+
+func (m *mockSigner) Sign(payload []byte) (string, error) {
+	return m.signFunc(payload)
+}
+
+func TestAttestBalanceUseCase_Execute(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	errSign := errors.New("sign error")
+
+	tests := []struct {
+		name          string
+		repositoryErr error
+		signErr       error
+		wantErr       error
+	}{
+		{
+			name: "signed attestation",
+		},
+		{
+			name:          "repository error",
+			repositoryErr: errors.New("repository error"),
+			wantErr:       errors.New("repository error"),
+		},
+		{
+			name:    "signer error",
+			signErr: errSign,
+			wantErr: errSign,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &mockBalanceRepository{
+				getBalanceFunc: func(ctx context.Context, user string) (*entity.BalanceResponse, error) {
+					return &entity.BalanceResponse{User: user, Balances: map[string]string{"BTC": "1.5"}}, tt.repositoryErr
+				},
+			}
+			var signed []byte
+			signer := &mockSigner{signFunc: func(payload []byte) (string, error) {
+				signed = payload
+				return "header.payload.signature", tt.signErr
+			}}
+
+			useCase := NewAttestBalanceUseCase(repository, signer, fixedClock(now))
+			token, err := useCase.Execute(context.Background(), "user1")
+
+			if tt.wantErr != nil {
+				if err == nil || err.Error() != tt.wantErr.Error() {
+					t.Fatalf("Execute() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if token != "header.payload.signature" {
+				t.Errorf("Execute() = %q, want the signer's token", token)
+			}
+			var attestation entity.BalanceAttestation
+			if err := json.Unmarshal(signed, &attestation); err != nil {
+				t.Fatalf("signed payload %s: %v", signed, err)
+			}
+			if attestation.User != "user1" || attestation.Balances["BTC"] != "1.5" || !attestation.Timestamp.Equal(now) {
+				t.Errorf("signed attestation = %+v, want user1 with BTC 1.5 at %v", attestation, now)
+			}
+		})
+	}
+}
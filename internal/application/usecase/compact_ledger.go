@@ -0,0 +1,58 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+)
+
+// CompactLedgerUseCase handles ledger compaction, keeping the ledger's
+// footprint bounded over years of operation
+type CompactLedgerUseCase struct {
+	repository port.LedgerRepository
+	archive    port.UserArchive
+	idleAfter  time.Duration
+	clock      port.Clock
+}
+
+// NewCompactLedgerUseCase creates a new CompactLedgerUseCase. Users without
+// entries for idleAfter are moved to archive; a zero idleAfter only removes
+// zero balances.
+func NewCompactLedgerUseCase(repository port.LedgerRepository, archive port.UserArchive, idleAfter time.Duration, clock port.Clock) *CompactLedgerUseCase {
+	return &CompactLedgerUseCase{
+		repository: repository,
+		archive:    archive,
+		idleAfter:  idleAfter,
+		clock:      clock,
+	}
+}
+
+// Execute removes zero balances and archives idle users
+func (uc *CompactLedgerUseCase) Execute(ctx context.Context) (_ entity.CompactionResult, err error) {
+	ctx, span := tracer.Start(ctx, "CompactLedgerUseCase.Execute")
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	compactor, ok := uc.repository.(port.LedgerCompactor)
+	if !ok {
+		return entity.CompactionResult{}, entity.ErrCompactionUnsupported
+	}
+
+	var idleSince time.Time
+	if uc.idleAfter > 0 {
+		idleSince = uc.clock.Now().Add(-uc.idleAfter)
+	}
+	result, err := compactor.Compact(ctx, idleSince, func(user entity.ArchivedUser) error {
+		return uc.archive.Archive(ctx, user)
+	})
+	span.SetAttributes(
+		attribute.Int("ledger.zero_balances", result.ZeroBalances),
+		attribute.Int("ledger.archived_users", result.ArchivedUsers),
+		attribute.Int("ledger.removed_users", result.RemovedUsers))
+	return result, err
+}
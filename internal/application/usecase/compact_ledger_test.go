@@ -0,0 +1,98 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"kii.com/internal/domain/entity"
+)
+
+// mockCompactingRepository is a mock LedgerRepository that can be compacted
+type mockCompactingRepository struct {
+	mockBalanceRepository
+	idleSince time.Time
+}
+
+func (m *mockCompactingRepository) Compact(ctx context.Context, idleSince time.Time, archive func(entity.ArchivedUser) error) (entity.CompactionResult, error) {
+	m.idleSince = idleSince
+	if idleSince.IsZero() {
+		return entity.CompactionResult{ZeroBalances: 1}, nil
+	}
+	if err := archive(entity.ArchivedUser{User: "idle"}); err != nil {
+		return entity.CompactionResult{ZeroBalances: 1}, err
+	}
+	return entity.CompactionResult{ZeroBalances: 1, ArchivedUsers: 1}, nil
+}
+
+// mockUserArchive is a mock implementation of UserArchive
+type mockUserArchive struct {
+	archived []string
+	err      error
+}
+
+func (m *mockUserArchive) Archive(ctx context.Context, user entity.ArchivedUser) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.archived = append(m.archived, user.User)
+	return nil
+}
+
+func TestCompactLedgerUseCase_Execute(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	errArchive := errors.New("archive error")
+
+	tests := []struct {
+		name          string
+		idleAfter     time.Duration
+		archiveErr    error
+		wantIdleSince time.Time
+		wantArchived  int
+		wantErr       error
+	}{
+		{
+			name: "zero balances only",
+		},
+		{
+			name:          "idle users archived",
+			idleAfter:     90 * 24 * time.Hour,
+			wantIdleSince: now.Add(-90 * 24 * time.Hour),
+			wantArchived:  1,
+		},
+		{
+			name:          "archive error",
+			idleAfter:     time.Hour,
+			archiveErr:    errArchive,
+			wantIdleSince: now.Add(-time.Hour),
+			wantErr:       errArchive,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockCompactingRepository{}
+			archive := &mockUserArchive{err: tt.archiveErr}
+			useCase := NewCompactLedgerUseCase(repo, archive, tt.idleAfter, fixedClock(now))
+
+			result, err := useCase.Execute(context.Background())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Execute() error = %v, want %v", err, tt.wantErr)
+			}
+			if !repo.idleSince.Equal(tt.wantIdleSince) {
+				t.Errorf("idleSince = %v, want %v", repo.idleSince, tt.wantIdleSince)
+			}
+			if len(archive.archived) != tt.wantArchived || result.ArchivedUsers != tt.wantArchived {
+				t.Errorf("archived %v (result %+v), want %d users", archive.archived, result, tt.wantArchived)
+			}
+		})
+	}
+}
+
+func TestCompactLedgerUseCase_Execute_Unsupported(t *testing.T) {
+	useCase := NewCompactLedgerUseCase(&mockBalanceRepository{}, &mockUserArchive{}, 0, fixedClock(time.Now()))
+	if _, err := useCase.Execute(context.Background()); !errors.Is(err, entity.ErrCompactionUnsupported) {
+		t.Errorf("Execute() error = %v, want %v", err, entity.ErrCompactionUnsupported)
+	}
+}
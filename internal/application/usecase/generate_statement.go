@@ -0,0 +1,122 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+)
+
+// statementDecimals is the number of decimals of statement balances, as the
+// ledger reports balances
+const statementDecimals = 8
+
+// errStatementComplete stops a listing at the last entry the balance read
+// for a statement covers
+var errStatementComplete = errors.New("statement complete")
+
+// GenerateStatementUseCase handles per-user periodic statements
+type GenerateStatementUseCase struct {
+	repository port.LedgerRepository
+	clock      port.Clock
+}
+
+// NewGenerateStatementUseCase creates a new GenerateStatementUseCase, telling
+// periods that have started with clock
+func NewGenerateStatementUseCase(repository port.LedgerRepository, clock port.Clock) *GenerateStatementUseCase {
+	return &GenerateStatementUseCase{
+		repository: repository,
+		clock:      clock,
+	}
+}
+
+// Execute generates user's statement for period, a day as 2026-10-14 or a
+// month as 2026-10. Balances are worked back from the current ones, so a
+// statement stays correct once entries from before the period have been
+// pruned; entries applied within or after it must still be in the ledger.
+func (uc *GenerateStatementUseCase) Execute(ctx context.Context, user, period string) (_ *entity.Statement, err error) {
+	ctx, span := tracer.Start(ctx, "GenerateStatementUseCase.Execute", trace.WithAttributes(
+		attribute.String("ledger.user", user),
+		attribute.String("ledger.period", period)))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	from, to, err := entity.ParseStatementPeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	if from.After(uc.clock.Now()) {
+		return nil, entity.ErrInvalidPeriod.WithDetail("%s has not started", period)
+	}
+	history, ok := uc.repository.(port.LedgerHistoryRepository)
+	if !ok {
+		return nil, entity.ErrHistoryUnsupported
+	}
+
+	balance, err := uc.repository.GetBalance(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	closing := make(map[string]decimal.Decimal)
+	for asset, amount := range balance.Balances {
+		value, err := decimal.NewFromString(amount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s balance of %s: %w", asset, user, err)
+		}
+		closing[asset] = value
+	}
+
+	// Entries applied after the balance was read are left out, so that the
+	// balances and entries match
+	statement := &entity.Statement{User: user, Period: period, From: from, To: to, Entries: []entity.LedgerEntry{}}
+	within := make(map[string]decimal.Decimal)
+	err = history.EachEntry(ctx, user, 0, func(entry entity.LedgerEntry) error {
+		if balance.Sequence > 0 && entry.Sequence > balance.Sequence {
+			return errStatementComplete
+		}
+		if entry.AppliedAt.Before(from) {
+			return nil
+		}
+		amount, err := decimal.NewFromString(entry.Amount)
+		if err != nil {
+			return fmt.Errorf("invalid amount of entry %d: %w", entry.Sequence, err)
+		}
+		if !entry.AppliedAt.Before(to) {
+			closing[entry.Asset] = closing[entry.Asset].Sub(amount)
+			return nil
+		}
+		within[entry.Asset] = within[entry.Asset].Add(amount)
+		statement.Entries = append(statement.Entries, entry)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStatementComplete) {
+		return nil, err
+	}
+
+	statement.OpeningBalances = make(map[string]string)
+	statement.ClosingBalances = make(map[string]string)
+	for asset, value := range closing {
+		opening := value.Sub(within[asset])
+		if _, active := within[asset]; !active && value.IsZero() && opening.IsZero() {
+			continue
+		}
+		statement.OpeningBalances[asset] = opening.StringFixed(statementDecimals)
+		statement.ClosingBalances[asset] = value.StringFixed(statementDecimals)
+	}
+	for asset, sum := range within {
+		if _, ok := closing[asset]; !ok {
+			// Only possible if the balance dropped the asset as zero
+			statement.OpeningBalances[asset] = sum.Neg().StringFixed(statementDecimals)
+			statement.ClosingBalances[asset] = decimal.Zero.StringFixed(statementDecimals)
+		}
+	}
+	span.SetAttributes(attribute.Int("ledger.entries", len(statement.Entries)))
+	return statement, nil
+}
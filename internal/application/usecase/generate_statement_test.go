@@ -0,0 +1,104 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"testing"
+	"time"
+
+	"kii.com/internal/domain/entity"
+)
+
+func TestGenerateStatementUseCase_Execute(t *testing.T) {
+	day := func(d, h int) time.Time {
+		return time.Date(2026, 10, d, h, 0, 0, 0, time.UTC)
+	}
+	repo := &mockHistoryRepository{
+		mockBalanceRepository: mockBalanceRepository{
+			getBalanceFunc: func(ctx context.Context, user string) (*entity.BalanceResponse, error) {
+				return &entity.BalanceResponse{User: user, Balances: map[string]string{"BTC": "3.50000000", "ETH": "2.00000000"}, Sequence: 5}, nil
+			},
+		},
+		entries: []entity.LedgerEntry{
+			{Sequence: 1, User: "user1", Asset: "BTC", Amount: "1", AppliedAt: day(13, 9)},
+			{Sequence: 2, User: "user1", Asset: "BTC", Amount: "2", AppliedAt: day(14, 9)},
+			{Sequence: 3, User: "user1", Asset: "ETH", Amount: "2", AppliedAt: day(14, 23)},
+			{Sequence: 4, User: "user1", Asset: "BTC", Amount: "0.5", AppliedAt: day(15, 9)},
+			// Applied after the balance was read
+			{Sequence: 6, User: "user1", Asset: "BTC", Amount: "10", AppliedAt: day(15, 10)},
+		},
+	}
+	useCase := NewGenerateStatementUseCase(repo, fixedClock(day(15, 12)))
+
+	tests := []struct {
+		name        string
+		period      string
+		wantOpening map[string]string
+		wantClosing map[string]string
+		wantEntries int
+	}{
+		{
+			name:        "past day",
+			period:      "2026-10-14",
+			wantOpening: map[string]string{"BTC": "1.00000000", "ETH": "0.00000000"},
+			wantClosing: map[string]string{"BTC": "3.00000000", "ETH": "2.00000000"},
+			wantEntries: 2,
+		},
+		{
+			name:        "current day",
+			period:      "2026-10-15",
+			wantOpening: map[string]string{"BTC": "3.00000000", "ETH": "2.00000000"},
+			wantClosing: map[string]string{"BTC": "3.50000000", "ETH": "2.00000000"},
+			wantEntries: 1,
+		},
+		{
+			name:        "day without entries",
+			period:      "2026-10-12",
+			wantOpening: map[string]string{},
+			wantClosing: map[string]string{},
+		},
+		{
+			name:        "month",
+			period:      "2026-10",
+			wantOpening: map[string]string{"BTC": "0.00000000", "ETH": "0.00000000"},
+			wantClosing: map[string]string{"BTC": "3.50000000", "ETH": "2.00000000"},
+			wantEntries: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statement, err := useCase.Execute(context.Background(), "user1", tt.period)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if !maps.Equal(statement.OpeningBalances, tt.wantOpening) {
+				t.Errorf("OpeningBalances = %v, want %v", statement.OpeningBalances, tt.wantOpening)
+			}
+			if !maps.Equal(statement.ClosingBalances, tt.wantClosing) {
+				t.Errorf("ClosingBalances = %v, want %v", statement.ClosingBalances, tt.wantClosing)
+			}
+			if len(statement.Entries) != tt.wantEntries {
+				t.Errorf("Entries = %v, want %d of them", statement.Entries, tt.wantEntries)
+			}
+		})
+	}
+}
+
+func TestGenerateStatementUseCase_Errors(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+
+	// Periods that do not parse or have not started
+	history := NewGenerateStatementUseCase(&mockHistoryRepository{}, fixedClock(now))
+	for _, period := range []string{"2026-10-16", "2026-11", "yesterday", "2026-13-01"} {
+		if _, err := history.Execute(context.Background(), "user1", period); !errors.Is(err, entity.ErrInvalidPeriod) {
+			t.Errorf("Execute(%q) error = %v, want %v", period, err, entity.ErrInvalidPeriod)
+		}
+	}
+
+	noHistory := NewGenerateStatementUseCase(&mockBalanceRepository{}, fixedClock(now))
+	if _, err := noHistory.Execute(context.Background(), "user1", "2026-10-14"); !errors.Is(err, entity.ErrHistoryUnsupported) {
+		t.Errorf("Execute() error = %v, want %v", err, entity.ErrHistoryUnsupported)
+	}
+}
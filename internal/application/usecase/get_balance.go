@@ -3,6 +3,9 @@ package usecase
 import (
 	"context"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"kii.com/internal/domain/entity"
 	"kii.com/internal/domain/port"
 )
@@ -20,6 +23,11 @@ func NewGetBalanceUseCase(repository port.LedgerRepository) *GetBalanceUseCase {
 }
 
 // Execute retrieves the balance for a user
-func (uc *GetBalanceUseCase) Execute(ctx context.Context, user string) (*entity.BalanceResponse, error) {
+func (uc *GetBalanceUseCase) Execute(ctx context.Context, user string) (_ *entity.BalanceResponse, err error) {
+	ctx, span := tracer.Start(ctx, "GetBalanceUseCase.Execute", trace.WithAttributes(attribute.String("ledger.user", user)))
+	defer func() {
+		endSpan(span, err)
+	}()
+
 	return uc.repository.GetBalance(ctx, user)
 }
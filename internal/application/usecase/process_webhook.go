@@ -2,6 +2,14 @@ package usecase
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"kii.com/internal/domain/entity"
 	"kii.com/internal/domain/port"
@@ -11,42 +19,551 @@ import (
 type ProcessWebhookUseCase struct {
 	validator  port.WebhookValidator
 	repository port.LedgerRepository
+	approval   *approvalPolicy
+	users      *entity.UserPolicy
+	amounts    *entity.AmountPolicy
+	velocity   *velocityPolicy
+	anomaly    *anomalyPolicy
+	freezes    port.AssetFreezeStore
+	events     port.EventPublisher
+	unitOfWork port.UnitOfWork
+	holds      *holdPolicy
+}
+
+// holdPolicy sets the amounts of parked debits aside in repo for as long as
+// they stay pending, at most ttl
+type holdPolicy struct {
+	repo port.LedgerHoldRepository
+	ttl  time.Duration
+}
+
+// approvalPolicy parks entries whose absolute amount exceeds threshold until
+// a second webhook approves them
+type approvalPolicy struct {
+	threshold       decimal.Decimal
+	store           port.PendingEntryStore
+	distinctSources bool
+}
+
+// anomalyPolicy holds entries detector finds suspicious in review
+type anomalyPolicy struct {
+	detector port.AnomalyDetector
+	review   port.PendingEntryStore
+}
+
+// ProcessWebhookOption configures optional ProcessWebhookUseCase behavior
+type ProcessWebhookOption func(*ProcessWebhookUseCase)
+
+// WithApproval parks entries whose absolute amount exceeds threshold in
+// store instead of applying them. A parked entry is applied once a second
+// webhook with the same entry approves it; with distinctSources that webhook
+// must come from a different source, i.e. be signed with a different key.
+func WithApproval(threshold decimal.Decimal, store port.PendingEntryStore, distinctSources bool) ProcessWebhookOption {
+	return func(uc *ProcessWebhookUseCase) {
+		uc.approval = &approvalPolicy{
+			threshold:       threshold.Abs(),
+			store:           store,
+			distinctSources: distinctSources,
+		}
+	}
+}
+
+// WithUserPolicy normalizes the user of every entry with policy and rejects
+// entries whose user it does not allow
+func WithUserPolicy(policy entity.UserPolicy) ProcessWebhookOption {
+	return func(uc *ProcessWebhookUseCase) {
+		uc.users = &policy
+	}
+}
+
+// WithAmountPolicy rounds the amount of every entry to the precision of its
+// asset with policy before any other policy sees it
+func WithAmountPolicy(policy entity.AmountPolicy) ProcessWebhookOption {
+	return func(uc *ProcessWebhookUseCase) {
+		uc.amounts = &policy
+	}
+}
+
+// WithAnomalyDetector asks detector about every new entry before it is
+// applied and parks suspicious ones in review until they are approved. When
+// approvals or velocity reviews are enabled too, review must be their store.
+func WithAnomalyDetector(detector port.AnomalyDetector, review port.PendingEntryStore) ProcessWebhookOption {
+	return func(uc *ProcessWebhookUseCase) {
+		uc.anomaly = &anomalyPolicy{detector: detector, review: review}
+	}
+}
+
+// WithAssetFreezes rejects entries in an asset frozen in store, and the
+// webhooks and approvals they are part of, until it is unfrozen
+func WithAssetFreezes(store port.AssetFreezeStore) ProcessWebhookOption {
+	return func(uc *ProcessWebhookUseCase) {
+		uc.freezes = store
+	}
+}
+
+// WithEventPublisher announces every entry applied, including approved ones,
+// to publisher
+func WithEventPublisher(publisher port.EventPublisher) ProcessWebhookOption {
+	return func(uc *ProcessWebhookUseCase) {
+		uc.events = publisher
+	}
+}
+
+// WithUnitOfWork applies the entries of batches and trades in a transaction
+// of unitOfWork instead of with AddEntries, so that the repository itself
+// need not apply batches
+func WithUnitOfWork(unitOfWork port.UnitOfWork) ProcessWebhookOption {
+	return func(uc *ProcessWebhookUseCase) {
+		uc.unitOfWork = unitOfWork
+	}
+}
+
+// WithHolds sets the amount of every debit parked for approval or review
+// aside in repo, with the pending entry's ID, so that the user's available
+// balance accounts for it. Approving the entry captures the hold; it expires
+// after ttl, as the pending entry does, unless released first. repo must be
+// the repository of the use case.
+func WithHolds(repo port.LedgerHoldRepository, ttl time.Duration) ProcessWebhookOption {
+	return func(uc *ProcessWebhookUseCase) {
+		uc.holds = &holdPolicy{repo: repo, ttl: ttl}
+	}
 }
 
 // NewProcessWebhookUseCase creates a new ProcessWebhookUseCase
 func NewProcessWebhookUseCase(
 	validator port.WebhookValidator,
 	repository port.LedgerRepository,
+	opts ...ProcessWebhookOption,
 ) *ProcessWebhookUseCase {
-	return &ProcessWebhookUseCase{
+	uc := &ProcessWebhookUseCase{
 		validator:  validator,
 		repository: repository,
 	}
+	for _, opt := range opts {
+		opt(uc)
+	}
+	return uc
 }
 
-// ProcessWebhookRequest contains the request data for processing a webhook
+// ProcessWebhookRequest contains the request data for processing a webhook.
+// Source names the webhook source the request came from. ApprovalID, when
+// set, approves that pending entry instead of submitting a new one.
 type ProcessWebhookRequest struct {
 	WebhookRequest *entity.WebhookRequest
 	HTTPRequest    interface {
 		Header() map[string][]string
 		Body() []byte
 	}
+	Source     string
+	ApprovalID string
 }
 
 // Execute processes a webhook request
-func (uc *ProcessWebhookUseCase) Execute(ctx context.Context, req ProcessWebhookRequest) error {
+func (uc *ProcessWebhookUseCase) Execute(ctx context.Context, req ProcessWebhookRequest) (err error) {
+	ctx, span := tracer.Start(ctx, "ProcessWebhookUseCase.Execute")
+	defer func() {
+		endSpan(span, err)
+	}()
+
 	// Validate webhook request entity
 	if err := req.WebhookRequest.Validate(); err != nil {
 		return err
 	}
+	if uc.users != nil {
+		if err := applyUserPolicy(*uc.users, req.WebhookRequest); err != nil {
+			return err
+		}
+	}
+	if uc.amounts != nil {
+		if err := applyAmountPolicy(*uc.amounts, req.WebhookRequest); err != nil {
+			return err
+		}
+	}
+	if uc.freezes != nil {
+		if err := uc.checkFrozen(req.WebhookRequest.LedgerEntries()...); err != nil {
+			return err
+		}
+	}
+	if req.WebhookRequest.IsMultiEntry() {
+		entries := req.WebhookRequest.LedgerEntries()
+		span.SetAttributes(attribute.Int("ledger.batch_size", len(entries)))
+		return uc.executeBatch(ctx, req.ApprovalID, req.Source, entries)
+	}
+	span.SetAttributes(
+		attribute.String("ledger.user", req.WebhookRequest.User),
+		attribute.String("ledger.asset", req.WebhookRequest.Asset),
+	)
 
 	// Create ledger entry
-	entry := entity.LedgerEntry{
-		User:   req.WebhookRequest.User,
-		Asset:  req.WebhookRequest.Asset,
-		Amount: req.WebhookRequest.Amount,
+	entry := req.WebhookRequest.LedgerEntries()[0]
+
+	if req.ApprovalID != "" {
+		return uc.approve(ctx, req, entry)
+	}
+
+	// Park high-value entries until they are approved
+	if uc.approval != nil && uc.approval.requires(entry) {
+		return uc.park(ctx, uc.approval.store, entry, req.Source, entity.PolicyApproval, "amount above approval threshold "+uc.approval.threshold.String())
+	}
+
+	// Hold suspicious entries for review
+	if uc.anomaly != nil {
+		reason, err := uc.anomaly.detector.Inspect(ctx, entry)
+		if err != nil {
+			return fmt.Errorf("anomaly detection: %w", err)
+		}
+		if reason != "" {
+			span.SetAttributes(attribute.String("ledger.anomaly", reason))
+			return uc.park(ctx, uc.anomaly.review, entry, req.Source, entity.PolicyAnomaly, reason)
+		}
+	}
+
+	// Hold back credits over a velocity limit
+	release := func() {}
+	if uc.velocity != nil {
+		var err error
+		if release, err = uc.velocity.reserve([]entity.LedgerEntry{entry}, time.Now()); err != nil {
+			if uc.velocity.review == nil || !errors.Is(err, entity.ErrVelocityExceeded) {
+				return err
+			}
+			return uc.park(ctx, uc.velocity.review, entry, req.Source, entity.PolicyVelocity, err.Error())
+		}
 	}
 
 	// Add to repository
-	return uc.repository.AddEntry(ctx, entry)
+	ctx, applied := port.WithAppliedEntries(ctx)
+	if err := uc.repository.AddEntry(ctx, entry); err != nil {
+		release()
+		return err
+	}
+	uc.recordAnomaly(ctx, entry)
+	uc.publish(ctx, req.Source, "", numbered(applied, entry)...)
+	return nil
+}
+
+// checkFrozen returns ErrAssetFrozen for the first of entries in a frozen
+// asset
+func (uc *ProcessWebhookUseCase) checkFrozen(entries ...entity.LedgerEntry) error {
+	for _, entry := range entries {
+		if _, frozen := uc.freezes.Frozen(entry.Asset); frozen {
+			return entity.ErrAssetFrozen.WithDetail("%s", entry.Asset)
+		}
+	}
+	return nil
+}
+
+// park adds entry to store until it is approved, recording the policy that
+// held it back and why, and returns the ApprovalRequiredError to answer with.
+// A debit's amount is held before the entry is parked, so it is set aside
+// before the entry can be approved; the hold is released if parking fails.
+func (uc *ProcessWebhookUseCase) park(ctx context.Context, store port.PendingEntryStore, entry entity.LedgerEntry, source string, policy entity.PendingPolicy, reason string) error {
+	id := uuid.New().String()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("ledger.pending_id", id))
+	if err := uc.hold(ctx, id, entry); err != nil {
+		return err
+	}
+	err := store.Add(entity.PendingEntry{
+		ID:        id,
+		Entry:     entry,
+		Source:    source,
+		Policy:    policy,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		if releaseErr := uc.ReleaseHold(ctx, id); releaseErr != nil {
+			return fmt.Errorf("park entry: %w (hold not released: %v)", err, releaseErr)
+		}
+		return fmt.Errorf("park entry: %w", err)
+	}
+	return &entity.ApprovalRequiredError{ID: id, Policy: policy, Reason: reason}
+}
+
+// hold sets the amount of entry, to be parked as id, aside if it is a debit
+func (uc *ProcessWebhookUseCase) hold(ctx context.Context, id string, entry entity.LedgerEntry) error {
+	if uc.holds == nil {
+		return nil
+	}
+	// Credits set nothing aside; amounts that do not parse are left to the
+	// repository to reject on approval
+	amount, err := decimal.NewFromString(entry.Amount)
+	if err != nil || !amount.IsNegative() {
+		return nil
+	}
+	err = uc.holds.repo.PlaceHold(ctx, entity.Hold{
+		ID:        id,
+		User:      entry.User,
+		Asset:     entry.Asset,
+		Amount:    amount.Neg().String(),
+		ExpiresAt: time.Now().Add(uc.holds.ttl),
+	})
+	if err != nil {
+		return fmt.Errorf("hold parked entry: %w", err)
+	}
+	return nil
+}
+
+// ReleaseHold releases the hold of the pending entry id once it is rejected,
+// so the amount is available again
+func (uc *ProcessWebhookUseCase) ReleaseHold(ctx context.Context, id string) error {
+	if uc.holds == nil {
+		return nil
+	}
+	_, err := uc.holds.repo.ReleaseHold(ctx, id)
+	return err
+}
+
+// executeBatch applies every entry of a batch or trade or none of them.
+// Approvals apply to single entries, so a batch cannot approve one or be
+// parked.
+func (uc *ProcessWebhookUseCase) executeBatch(ctx context.Context, approvalID, source string, entries []entity.LedgerEntry) error {
+	if approvalID != "" {
+		return entity.ErrApprovalMismatch
+	}
+	if uc.approval != nil {
+		for _, entry := range entries {
+			if uc.approval.requires(entry) {
+				return entity.ErrBatchApproval
+			}
+		}
+	}
+
+	if _, ok := uc.repository.(port.BatchLedgerRepository); !ok && uc.unitOfWork == nil {
+		return entity.ErrBatchUnsupported
+	}
+	if uc.anomaly != nil {
+		for _, entry := range entries {
+			reason, err := uc.anomaly.detector.Inspect(ctx, entry)
+			if err != nil {
+				return fmt.Errorf("anomaly detection: %w", err)
+			}
+			if reason != "" {
+				return entity.ErrBatchApproval.WithDetail("%s", reason)
+			}
+		}
+	}
+
+	release := func() {}
+	if uc.velocity != nil {
+		var err error
+		if release, err = uc.velocity.reserve(entries, time.Now()); err != nil {
+			if uc.velocity.review != nil && errors.Is(err, entity.ErrVelocityExceeded) {
+				return entity.ErrBatchApproval.WithDetail("%v", err)
+			}
+			return err
+		}
+	}
+	ctx, applied := port.WithAppliedEntries(ctx)
+	if err := uc.applyAtomically(ctx, entries); err != nil {
+		release()
+		return err
+	}
+	uc.recordAnomaly(ctx, entries...)
+	uc.publish(ctx, source, uuid.New().String(), numbered(applied, entries...)...)
+	return nil
+}
+
+// applyAtomically applies every entry or none of them: in a transaction of
+// the unit of work set with WithUnitOfWork, or else with one AddEntries of
+// the repository
+func (uc *ProcessWebhookUseCase) applyAtomically(ctx context.Context, entries []entity.LedgerEntry) error {
+	if uc.unitOfWork == nil {
+		return uc.repository.(port.BatchLedgerRepository).AddEntries(ctx, entries)
+	}
+	return uc.unitOfWork.Do(ctx, func(tx port.LedgerRepository) error {
+		for _, entry := range entries {
+			if err := tx.AddEntry(ctx, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// recordAnomaly adds applied entries to the anomaly detector's history, so
+// only entries that made it into the ledger shape what is usual
+func (uc *ProcessWebhookUseCase) recordAnomaly(ctx context.Context, entries ...entity.LedgerEntry) {
+	if uc.anomaly == nil {
+		return
+	}
+	for _, entry := range entries {
+		uc.anomaly.detector.Record(ctx, entry)
+	}
+}
+
+// numbered returns entries as the repository recorded them in applied, with
+// their sequences, or entries themselves if it did not record each of them
+func numbered(applied *port.AppliedEntries, entries ...entity.LedgerEntry) []entity.LedgerEntry {
+	if recorded := applied.Entries(); len(recorded) == len(entries) {
+		return recorded
+	}
+	return entries
+}
+
+// publish announces entries applied from source, as one batch when batch is
+// set
+func (uc *ProcessWebhookUseCase) publish(ctx context.Context, source, batch string, entries ...entity.LedgerEntry) {
+	if uc.events == nil {
+		return
+	}
+	appliedAt := time.Now()
+	for _, entry := range entries {
+		uc.events.Publish(ctx, entity.BalanceEvent{
+			ID:        uuid.New().String(),
+			Sequence:  entry.Sequence,
+			Source:    source,
+			Batch:     batch,
+			User:      entry.User,
+			Asset:     entry.Asset,
+			Amount:    entry.Amount,
+			Labels:    entry.Labels,
+			AppliedAt: appliedAt,
+		})
+	}
+}
+
+// applyUserPolicy normalizes the users of req and its batch items in place
+func applyUserPolicy(policy entity.UserPolicy, req *entity.WebhookRequest) error {
+	for i := range req.Entries {
+		if err := applyUserPolicy(policy, &req.Entries[i]); err != nil {
+			return entity.ErrorAt(fmt.Sprintf("entries[%d]", i), err)
+		}
+	}
+	if len(req.Entries) > 0 {
+		return nil
+	}
+	user, err := policy.Apply(req.User)
+	if err != nil {
+		return err
+	}
+	req.User = user
+	return nil
+}
+
+// applyAmountPolicy rounds the amounts of req, its batch items and its legs
+// in place
+func applyAmountPolicy(policy entity.AmountPolicy, req *entity.WebhookRequest) error {
+	for i := range req.Entries {
+		if err := applyAmountPolicy(policy, &req.Entries[i]); err != nil {
+			return entity.ErrorAt(fmt.Sprintf("entries[%d]", i), err)
+		}
+	}
+	for i := range req.Legs {
+		amount, err := policy.Apply(req.Legs[i].Asset, req.Legs[i].Amount)
+		if err != nil {
+			return entity.ErrorAt(fmt.Sprintf("legs[%d]", i), err)
+		}
+		req.Legs[i].Amount = amount
+	}
+	if req.IsMultiEntry() {
+		return nil
+	}
+	amount, err := policy.Apply(req.Asset, req.Amount)
+	if err != nil {
+		return err
+	}
+	req.Amount = amount
+	return nil
+}
+
+// approve applies the pending entry req.ApprovalID, which must match entry
+func (uc *ProcessWebhookUseCase) approve(ctx context.Context, req ProcessWebhookRequest, entry entity.LedgerEntry) error {
+	store := uc.pendingStore()
+	if store == nil {
+		return entity.ErrPendingNotFound
+	}
+	// Only entries parked for approval can be approved by a webhook; those
+	// held for review are released by an operator with ApprovePending, so a
+	// sender cannot release what its own webhooks had held back
+	pending, ok := store.Get(req.ApprovalID)
+	if !ok || pending.Policy != entity.PolicyApproval {
+		return entity.ErrPendingNotFound
+	}
+	if pending.Entry != entry {
+		return entity.ErrApprovalMismatch
+	}
+	if uc.approval != nil && uc.approval.distinctSources && pending.Source == req.Source {
+		return entity.ErrApprovalSameSource
+	}
+	return uc.applyPending(ctx, store, pending)
+}
+
+// ApprovePending applies the pending entry id on an operator's decision,
+// without a second webhook, and returns it
+func (uc *ProcessWebhookUseCase) ApprovePending(ctx context.Context, id string) (_ entity.PendingEntry, err error) {
+	ctx, span := tracer.Start(ctx, "ProcessWebhookUseCase.ApprovePending")
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	store := uc.pendingStore()
+	if store == nil {
+		return entity.PendingEntry{}, entity.ErrPendingNotFound
+	}
+	pending, ok := store.Get(id)
+	if !ok {
+		return entity.PendingEntry{}, entity.ErrPendingNotFound
+	}
+	if uc.freezes != nil {
+		if err := uc.checkFrozen(pending.Entry); err != nil {
+			return pending, err
+		}
+	}
+	return pending, uc.applyPending(ctx, store, pending)
+}
+
+// applyPending removes pending from store and applies its entry
+func (uc *ProcessWebhookUseCase) applyPending(ctx context.Context, store port.PendingEntryStore, pending entity.PendingEntry) error {
+	// Claim the entry so a concurrent approval cannot apply it twice
+	if !store.Delete(pending.ID) {
+		return entity.ErrPendingNotFound
+	}
+
+	apply := uc.repository.AddEntry
+	if uc.holds != nil {
+		// The entry replaces its hold, if it has one, in one step
+		apply = func(ctx context.Context, entry entity.LedgerEntry) error {
+			return uc.holds.repo.CaptureHold(ctx, pending.ID, entry)
+		}
+	}
+	ctx, applied := port.WithAppliedEntries(ctx)
+	if err := apply(ctx, pending.Entry); err != nil {
+		// Keep it pending so the approval can be retried
+		if addErr := store.Add(pending); addErr != nil {
+			return fmt.Errorf("%w (entry no longer pending: %v)", err, addErr)
+		}
+		return err
+	}
+	// Approved credits count towards later velocity limits
+	if uc.velocity != nil {
+		uc.velocity.record(pending.Entry, time.Now())
+	}
+	uc.recordAnomaly(ctx, pending.Entry)
+	uc.publish(ctx, pending.Source, "", numbered(applied, pending.Entry)...)
+	return nil
+}
+
+// pendingStore returns the store entries are parked in for approval, nil
+// if none are. Approvals, velocity and anomaly reviews share one store.
+func (uc *ProcessWebhookUseCase) pendingStore() port.PendingEntryStore {
+	if uc.approval != nil {
+		return uc.approval.store
+	}
+	if uc.velocity != nil && uc.velocity.review != nil {
+		return uc.velocity.review
+	}
+	if uc.anomaly != nil {
+		return uc.anomaly.review
+	}
+	return nil
+}
+
+// requires reports whether entry needs approval. Amounts that do not parse
+// are left to the repository to reject.
+func (p *approvalPolicy) requires(entry entity.LedgerEntry) bool {
+	amount, err := decimal.NewFromString(entry.Amount)
+	if err != nil {
+		return false
+	}
+	return amount.Abs().GreaterThan(p.threshold)
 }
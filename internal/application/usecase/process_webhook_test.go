@@ -5,8 +5,12 @@ import (
 	"errors"
 	"net/http"
 	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
 
 	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
 )
 
 // mockWebhookValidator is a mock implementation of WebhookValidator
@@ -142,6 +146,820 @@ func TestProcessWebhookUseCase_Execute(t *testing.T) {
 	}
 }
 
+// mockPendingStore is a map-backed PendingEntryStore
+type mockPendingStore map[string]entity.PendingEntry
+
+func (m mockPendingStore) Add(entry entity.PendingEntry) error {
+	m[entry.ID] = entry
+	return nil
+}
+
+func (m mockPendingStore) Get(id string) (entity.PendingEntry, bool) {
+	entry, ok := m[id]
+	return entry, ok
+}
+
+func (m mockPendingStore) Delete(id string) bool {
+	_, ok := m[id]
+	delete(m, id)
+	return ok
+}
+
+func (m mockPendingStore) List() []entity.PendingEntry {
+	entries := make([]entity.PendingEntry, 0, len(m))
+	for _, entry := range m {
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestProcessWebhookUseCase_Approval(t *testing.T) {
+	var applied []entity.LedgerEntry
+	repository := &mockWebhookRepository{
+		addEntryFunc: func(ctx context.Context, entry entity.LedgerEntry) error {
+			applied = append(applied, entry)
+			return nil
+		},
+	}
+	store := mockPendingStore{}
+	useCase := NewProcessWebhookUseCase(&mockWebhookValidator{}, repository,
+		WithApproval(decimal.RequireFromString("1000"), store, true))
+	ctx := context.Background()
+	execute := func(amount, source, approvalID string) error {
+		return useCase.Execute(ctx, ProcessWebhookRequest{
+			WebhookRequest: &entity.WebhookRequest{User: "user1", Asset: "BTC", Amount: amount},
+			Source:         source,
+			ApprovalID:     approvalID,
+		})
+	}
+
+	// Amounts up to the threshold, credit or debit, are applied directly
+	for _, amount := range []string{"1000", "-1000", "999.99"} {
+		if err := execute(amount, "default", ""); err != nil {
+			t.Fatalf("Execute(%s) error = %v", amount, err)
+		}
+	}
+	if len(applied) != 3 {
+		t.Fatalf("applied %d entries, want 3", len(applied))
+	}
+
+	// Above it, credit or debit, the entry is parked
+	err := execute("-1000.01", "default", "")
+	var approvalRequired *entity.ApprovalRequiredError
+	if !errors.As(err, &approvalRequired) {
+		t.Fatalf("Execute(-1000.01) error = %v, want ApprovalRequiredError", err)
+	}
+	id := approvalRequired.ID
+	if len(applied) != 3 || len(store) != 1 {
+		t.Fatalf("applied %d entries with %d pending, want 3 and 1", len(applied), len(store))
+	}
+	if approvalRequired.Policy != entity.PolicyApproval || store[id].Policy != entity.PolicyApproval {
+		t.Errorf("policy = %q, pending %q, want %q", approvalRequired.Policy, store[id].Policy, entity.PolicyApproval)
+	}
+
+	rejected := []struct {
+		name       string
+		amount     string
+		source     string
+		approvalID string
+		wantErr    error
+	}{
+		{"unknown ID", "-1000.01", "partner", "nope", entity.ErrPendingNotFound},
+		{"different payload", "-1000.02", "partner", id, entity.ErrApprovalMismatch},
+		{"same source", "-1000.01", "default", id, entity.ErrApprovalSameSource},
+	}
+	for _, tt := range rejected {
+		if err := execute(tt.amount, tt.source, tt.approvalID); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Execute() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+	if len(applied) != 3 {
+		t.Fatalf("rejected approvals applied the entry")
+	}
+
+	if err := execute("-1000.01", "partner", id); err != nil {
+		t.Fatalf("approving Execute() error = %v", err)
+	}
+	if len(applied) != 4 || applied[3].Amount != "-1000.01" || len(store) != 0 {
+		t.Errorf("after approval applied = %v with %d pending, want the entry applied once", applied, len(store))
+	}
+	if err := execute("-1000.01", "partner", id); !errors.Is(err, entity.ErrPendingNotFound) {
+		t.Errorf("second approval error = %v, want ErrPendingNotFound", err)
+	}
+}
+
+// mockHoldRepository is a mockWebhookRepository that also keeps holds
+type mockHoldRepository struct {
+	mockWebhookRepository
+	holds    map[string]entity.Hold
+	captured []string
+	placeErr error
+}
+
+func (m *mockHoldRepository) PlaceHold(ctx context.Context, hold entity.Hold) error {
+	if m.placeErr != nil {
+		return m.placeErr
+	}
+	m.holds[hold.ID] = hold
+	return nil
+}
+
+func (m *mockHoldRepository) ReleaseHold(ctx context.Context, id string) (bool, error) {
+	_, ok := m.holds[id]
+	delete(m.holds, id)
+	return ok, nil
+}
+
+func (m *mockHoldRepository) CaptureHold(ctx context.Context, id string, entry entity.LedgerEntry) error {
+	delete(m.holds, id)
+	m.captured = append(m.captured, id)
+	return m.AddEntry(ctx, entry)
+}
+
+func TestProcessWebhookUseCase_Holds(t *testing.T) {
+	var applied []entity.LedgerEntry
+	repo := &mockHoldRepository{
+		mockWebhookRepository: mockWebhookRepository{
+			addEntryFunc: func(ctx context.Context, entry entity.LedgerEntry) error {
+				applied = append(applied, entry)
+				return nil
+			},
+		},
+		holds: make(map[string]entity.Hold),
+	}
+	store := mockPendingStore{}
+	useCase := NewProcessWebhookUseCase(&mockWebhookValidator{}, repo,
+		WithApproval(decimal.RequireFromString("1000"), store, false),
+		WithHolds(repo, time.Hour))
+	ctx := context.Background()
+	park := func(amount string) string {
+		t.Helper()
+		err := useCase.Execute(ctx, ProcessWebhookRequest{
+			WebhookRequest: &entity.WebhookRequest{User: "user1", Asset: "BTC", Amount: amount},
+			Source:         "default",
+		})
+		var approvalRequired *entity.ApprovalRequiredError
+		if !errors.As(err, &approvalRequired) {
+			t.Fatalf("Execute(%s) error = %v, want ApprovalRequiredError", amount, err)
+		}
+		return approvalRequired.ID
+	}
+
+	// Parked debits set their amount aside, parked credits do not
+	debit := park("-1500")
+	hold, ok := repo.holds[debit]
+	if !ok || hold.User != "user1" || hold.Asset != "BTC" || hold.Amount != "1500" || hold.ExpiresAt.IsZero() {
+		t.Fatalf("holds = %+v, want 1500 BTC of user1 held as %s", repo.holds, debit)
+	}
+	credit := park("2000")
+	if _, ok := repo.holds[credit]; ok {
+		t.Errorf("credit %s was held", credit)
+	}
+
+	// Approving captures the hold with the entry
+	if _, err := useCase.ApprovePending(ctx, debit); err != nil {
+		t.Fatalf("ApprovePending() error = %v", err)
+	}
+	if len(repo.holds) != 0 || len(repo.captured) != 1 || len(applied) != 1 || applied[0].Amount != "-1500" {
+		t.Errorf("after approval holds = %v, captured = %v, applied = %v, want the hold captured", repo.holds, repo.captured, applied)
+	}
+
+	// Rejecting releases it
+	rejected := park("-3000")
+	store.Delete(rejected)
+	if err := useCase.ReleaseHold(ctx, rejected); err != nil || len(repo.holds) != 0 {
+		t.Errorf("ReleaseHold() = %v with holds %v, want the hold released", err, repo.holds)
+	}
+
+	// A debit that cannot be held is not parked either
+	repo.placeErr = errors.New("storage down")
+	err := useCase.Execute(ctx, ProcessWebhookRequest{
+		WebhookRequest: &entity.WebhookRequest{User: "user1", Asset: "BTC", Amount: "-5000"},
+	})
+	if !errors.Is(err, repo.placeErr) {
+		t.Errorf("Execute() error = %v, want %v", err, repo.placeErr)
+	}
+	if len(store) != 1 {
+		t.Errorf("pending = %v, want only the parked credit", store)
+	}
+	repo.placeErr = nil
+
+	// The hold is placed before the entry is parked, and released if
+	// parking fails
+	parkErr := errors.New("pending store down")
+	failing := &failingPendingStore{mockPendingStore: mockPendingStore{}, err: parkErr, before: func(entry entity.PendingEntry) {
+		if _, ok := repo.holds[entry.ID]; !ok {
+			t.Errorf("entry %s parked before its hold was placed", entry.ID)
+		}
+	}}
+	useCase = NewProcessWebhookUseCase(&mockWebhookValidator{}, repo,
+		WithApproval(decimal.RequireFromString("1000"), failing, false),
+		WithHolds(repo, time.Hour))
+	err = useCase.Execute(ctx, ProcessWebhookRequest{
+		WebhookRequest: &entity.WebhookRequest{User: "user1", Asset: "BTC", Amount: "-5000"},
+	})
+	if !errors.Is(err, parkErr) {
+		t.Errorf("Execute() error = %v, want %v", err, parkErr)
+	}
+	if len(repo.holds) != 0 || len(failing.mockPendingStore) != 0 {
+		t.Errorf("holds = %v, pending = %v, want neither", repo.holds, failing.mockPendingStore)
+	}
+}
+
+// failingPendingStore is a mockPendingStore that calls before with each
+// entry added, then fails to add it with err
+type failingPendingStore struct {
+	mockPendingStore
+	err    error
+	before func(entry entity.PendingEntry)
+}
+
+func (m *failingPendingStore) Add(entry entity.PendingEntry) error {
+	m.before(entry)
+	return m.err
+}
+
+// mockBatchRepository is a mockWebhookRepository that also applies batches
+type mockBatchRepository struct {
+	mockWebhookRepository
+	addEntriesFunc func(ctx context.Context, entries []entity.LedgerEntry) error
+}
+
+func (m *mockBatchRepository) AddEntries(ctx context.Context, entries []entity.LedgerEntry) error {
+	if m.addEntriesFunc != nil {
+		return m.addEntriesFunc(ctx, entries)
+	}
+	return nil
+}
+
+// mockUnitOfWork applies the entries added in a transaction with commitFunc
+type mockUnitOfWork struct {
+	commitFunc func(entries []entity.LedgerEntry) error
+}
+
+func (m *mockUnitOfWork) Do(ctx context.Context, fn func(tx port.LedgerRepository) error) error {
+	var entries []entity.LedgerEntry
+	tx := &mockWebhookRepository{addEntryFunc: func(ctx context.Context, entry entity.LedgerEntry) error {
+		entries = append(entries, entry)
+		return nil
+	}}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return m.commitFunc(entries)
+}
+
+func TestProcessWebhookUseCase_Batch(t *testing.T) {
+	batch := &entity.WebhookRequest{Entries: []entity.WebhookRequest{
+		{User: "user1", Asset: "BTC", Amount: "1.5"},
+		{User: "user2", Asset: "ETH", Amount: "-2"},
+	}}
+	var applied []entity.LedgerEntry
+	batchRepo := &mockBatchRepository{
+		addEntriesFunc: func(ctx context.Context, entries []entity.LedgerEntry) error {
+			applied = append(applied, entries...)
+			return nil
+		},
+	}
+	unitOfWork := &mockUnitOfWork{commitFunc: func(entries []entity.LedgerEntry) error {
+		applied = append(applied, entries...)
+		return nil
+	}}
+	errCommit := errors.New("commit failed")
+	failingUnitOfWork := &mockUnitOfWork{commitFunc: func(entries []entity.LedgerEntry) error {
+		return errCommit
+	}}
+
+	tests := []struct {
+		name       string
+		repository port.LedgerRepository
+		opts       []ProcessWebhookOption
+		approvalID string
+		wantErr    error
+	}{
+		{name: "applied as one batch", repository: batchRepo},
+		{name: "repository without batch support", repository: &mockWebhookRepository{}, wantErr: entity.ErrBatchUnsupported},
+		{
+			name:       "applied in a unit of work",
+			repository: &mockWebhookRepository{},
+			opts:       []ProcessWebhookOption{WithUnitOfWork(unitOfWork)},
+		},
+		{
+			name:       "unit of work fails",
+			repository: batchRepo,
+			opts:       []ProcessWebhookOption{WithUnitOfWork(failingUnitOfWork)},
+			wantErr:    errCommit,
+		},
+		{
+			name:       "entry above the approval threshold",
+			repository: batchRepo,
+			opts:       []ProcessWebhookOption{WithApproval(decimal.RequireFromString("1"), mockPendingStore{}, false)},
+			wantErr:    entity.ErrBatchApproval,
+		},
+		{name: "approval ID", repository: batchRepo, approvalID: "pending-1", wantErr: entity.ErrApprovalMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applied = nil
+			useCase := NewProcessWebhookUseCase(&mockWebhookValidator{}, tt.repository, tt.opts...)
+			err := useCase.Execute(context.Background(), ProcessWebhookRequest{
+				WebhookRequest: batch,
+				ApprovalID:     tt.approvalID,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Execute() error = %v, want %v", err, tt.wantErr)
+			}
+			wantApplied := 0
+			if tt.wantErr == nil {
+				wantApplied = 2
+			}
+			if len(applied) != wantApplied {
+				t.Errorf("applied %d entries, want %d", len(applied), wantApplied)
+			}
+		})
+	}
+}
+
+func TestProcessWebhookUseCase_UserPolicy(t *testing.T) {
+	pattern, err := entity.CompileUserPattern(`[a-z0-9]+`)
+	if err != nil {
+		t.Fatalf("CompileUserPattern() error = %v", err)
+	}
+	var applied []entity.LedgerEntry
+	repository := &mockBatchRepository{
+		mockWebhookRepository: mockWebhookRepository{
+			addEntryFunc: func(ctx context.Context, entry entity.LedgerEntry) error {
+				applied = append(applied, entry)
+				return nil
+			},
+		},
+		addEntriesFunc: func(ctx context.Context, entries []entity.LedgerEntry) error {
+			applied = append(applied, entries...)
+			return nil
+		},
+	}
+	useCase := NewProcessWebhookUseCase(&mockWebhookValidator{}, repository,
+		WithUserPolicy(entity.UserPolicy{Pattern: pattern, MaxLength: 8, Case: entity.UserCaseLower}))
+
+	tests := []struct {
+		name     string
+		request  *entity.WebhookRequest
+		wantErr  error
+		wantUser []string
+	}{
+		{
+			name:     "normalized",
+			request:  &entity.WebhookRequest{User: "User1", Asset: "BTC", Amount: "1"},
+			wantUser: []string{"user1"},
+		},
+		{
+			name:    "rejected",
+			request: &entity.WebhookRequest{User: "user-1", Asset: "BTC", Amount: "1"},
+			wantErr: entity.ErrInvalidUser,
+		},
+		{
+			name: "batch normalized",
+			request: &entity.WebhookRequest{Entries: []entity.WebhookRequest{
+				{User: "USER1", Asset: "BTC", Amount: "1"},
+				{User: "User2", Legs: []entity.Leg{{Asset: "USDT", Amount: "-1"}, {Asset: "BTC", Amount: "1"}}},
+			}},
+			wantUser: []string{"user1", "user2", "user2"},
+		},
+		{
+			name: "batch item rejected",
+			request: &entity.WebhookRequest{Entries: []entity.WebhookRequest{
+				{User: "user1", Asset: "BTC", Amount: "1"},
+				{User: "averylonguser", Asset: "BTC", Amount: "1"},
+			}},
+			wantErr: entity.ErrInvalidUser,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applied = nil
+			err := useCase.Execute(context.Background(), ProcessWebhookRequest{WebhookRequest: tt.request})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Execute() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(applied) != len(tt.wantUser) {
+				t.Fatalf("applied %v, want users %v", applied, tt.wantUser)
+			}
+			for i, entry := range applied {
+				if entry.User != tt.wantUser[i] {
+					t.Errorf("applied[%d].User = %q, want %q", i, entry.User, tt.wantUser[i])
+				}
+			}
+		})
+	}
+}
+
+func TestProcessWebhookUseCase_AmountPolicy(t *testing.T) {
+	var applied []entity.LedgerEntry
+	repository := &mockBatchRepository{
+		mockWebhookRepository: mockWebhookRepository{
+			addEntryFunc: func(ctx context.Context, entry entity.LedgerEntry) error {
+				applied = append(applied, entry)
+				return nil
+			},
+		},
+		addEntriesFunc: func(ctx context.Context, entries []entity.LedgerEntry) error {
+			applied = append(applied, entries...)
+			return nil
+		},
+	}
+	useCase := NewProcessWebhookUseCase(&mockWebhookValidator{}, repository,
+		WithAmountPolicy(entity.AmountPolicy{
+			Assets:  map[string]entity.AssetPrecision{"usdc": {Scale: 2, Rounding: entity.RoundTruncate}},
+			Default: entity.AssetPrecision{Scale: 8, Rounding: entity.RoundHalfUp},
+		}))
+
+	tests := []struct {
+		name       string
+		request    *entity.WebhookRequest
+		wantErr    error
+		wantAmount []string
+	}{
+		{
+			name:       "within scale",
+			request:    &entity.WebhookRequest{User: "user1", Asset: "USDC", Amount: "1.5"},
+			wantAmount: []string{"1.5"},
+		},
+		{
+			name:       "rounded",
+			request:    &entity.WebhookRequest{User: "user1", Asset: "USDC", Amount: "1.239"},
+			wantAmount: []string{"1.23"},
+		},
+		{
+			name: "batch and legs rounded",
+			request: &entity.WebhookRequest{Entries: []entity.WebhookRequest{
+				{User: "user1", Asset: "BTC", Amount: "0.123456785"},
+				{User: "user2", Legs: []entity.Leg{{Asset: "usdc", Amount: "-10.009"}, {Asset: "BTC", Amount: "0.0001"}}},
+			}},
+			wantAmount: []string{"0.12345679", "-10.00", "0.0001"},
+		},
+		{
+			name: "leg not a number",
+			request: &entity.WebhookRequest{User: "user1", Legs: []entity.Leg{
+				{Asset: "USDC", Amount: "-1"}, {Asset: "BTC", Amount: "lots"},
+			}},
+			wantErr: entity.ErrInvalidAmount,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applied = nil
+			err := useCase.Execute(context.Background(), ProcessWebhookRequest{WebhookRequest: tt.request})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Execute() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(applied) != len(tt.wantAmount) {
+				t.Fatalf("applied %v, want amounts %v", applied, tt.wantAmount)
+			}
+			for i, entry := range applied {
+				if entry.Amount != tt.wantAmount[i] {
+					t.Errorf("applied[%d].Amount = %q, want %q", i, entry.Amount, tt.wantAmount[i])
+				}
+			}
+		})
+	}
+}
+
+// mockAnomalyDetector finds entries of its user suspicious, keeping the
+// entries recorded as applied in recorded if set
+type mockAnomalyDetector struct {
+	suspicious string
+	err        error
+	recorded   *[]entity.LedgerEntry
+}
+
+func (m mockAnomalyDetector) Inspect(ctx context.Context, entry entity.LedgerEntry) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+	if entry.User == m.suspicious {
+		return "suspicious user", nil
+	}
+	return "", nil
+}
+
+func (m mockAnomalyDetector) Record(ctx context.Context, entry entity.LedgerEntry) {
+	if m.recorded != nil {
+		*m.recorded = append(*m.recorded, entry)
+	}
+}
+
+func TestProcessWebhookUseCase_Anomaly(t *testing.T) {
+	var applied []entity.LedgerEntry
+	repository := &mockBatchRepository{
+		mockWebhookRepository: mockWebhookRepository{
+			addEntryFunc: func(ctx context.Context, entry entity.LedgerEntry) error {
+				applied = append(applied, entry)
+				return nil
+			},
+		},
+		addEntriesFunc: func(ctx context.Context, entries []entity.LedgerEntry) error {
+			applied = append(applied, entries...)
+			return nil
+		},
+	}
+	store := mockPendingStore{}
+	var recorded []entity.LedgerEntry
+	useCase := NewProcessWebhookUseCase(&mockWebhookValidator{}, repository,
+		WithAnomalyDetector(mockAnomalyDetector{suspicious: "mallory", recorded: &recorded}, store))
+	ctx := context.Background()
+	execute := func(req *entity.WebhookRequest) error {
+		return useCase.Execute(ctx, ProcessWebhookRequest{WebhookRequest: req, Source: "default"})
+	}
+
+	if err := execute(&entity.WebhookRequest{User: "user1", Asset: "BTC", Amount: "1"}); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	err := execute(&entity.WebhookRequest{User: "mallory", Asset: "BTC", Amount: "1"})
+	var approvalRequired *entity.ApprovalRequiredError
+	if !errors.As(err, &approvalRequired) {
+		t.Fatalf("Execute(mallory) error = %v, want ApprovalRequiredError", err)
+	}
+	if pending := store[approvalRequired.ID]; pending.Reason != "suspicious user" || pending.Policy != entity.PolicyAnomaly || len(applied) != 1 {
+		t.Fatalf("pending = %+v with %d applied, want held with its reason", pending, len(applied))
+	}
+
+	batch := &entity.WebhookRequest{Entries: []entity.WebhookRequest{
+		{User: "user1", Asset: "BTC", Amount: "1"},
+		{User: "mallory", Asset: "BTC", Amount: "1"},
+	}}
+	if err := execute(batch); !errors.Is(err, entity.ErrBatchApproval) {
+		t.Errorf("Execute(batch) error = %v, want %v", err, entity.ErrBatchApproval)
+	}
+	// Held and rejected entries are not recorded as applied
+	if len(recorded) != 1 || recorded[0].User != "user1" {
+		t.Errorf("recorded = %v, want only the applied entry", recorded)
+	}
+
+	// Held entries are for an operator to review: a webhook echoing the
+	// pending ID cannot release one, from the sender or any other source
+	for _, source := range []string{"default", "partner"} {
+		err := useCase.Execute(ctx, ProcessWebhookRequest{
+			WebhookRequest: &entity.WebhookRequest{User: "mallory", Asset: "BTC", Amount: "1"},
+			Source:         source,
+			ApprovalID:     approvalRequired.ID,
+		})
+		if !errors.Is(err, entity.ErrPendingNotFound) || len(applied) != 1 || len(store) != 1 {
+			t.Errorf("approving Execute() from %s error = %v with %d applied, want %v and nothing applied",
+				source, err, len(applied), entity.ErrPendingNotFound)
+		}
+	}
+
+	// An operator approves the held entry without a second webhook
+	pending, err := useCase.ApprovePending(ctx, approvalRequired.ID)
+	if err != nil {
+		t.Fatalf("ApprovePending() error = %v", err)
+	}
+	if len(applied) != 2 || applied[1] != pending.Entry || len(store) != 0 {
+		t.Errorf("after approval applied = %v with %d pending, want the entry applied once", applied, len(store))
+	}
+	if len(recorded) != 2 || recorded[1] != pending.Entry {
+		t.Errorf("after approval recorded = %v, want the approved entry recorded", recorded)
+	}
+	if _, err := useCase.ApprovePending(ctx, approvalRequired.ID); !errors.Is(err, entity.ErrPendingNotFound) {
+		t.Errorf("second ApprovePending() error = %v, want %v", err, entity.ErrPendingNotFound)
+	}
+
+	// A failing detector stops entries instead of letting them through
+	detectorErr := errors.New("detector unavailable")
+	failing := NewProcessWebhookUseCase(&mockWebhookValidator{}, repository,
+		WithAnomalyDetector(mockAnomalyDetector{err: detectorErr}, store))
+	err = failing.Execute(ctx, ProcessWebhookRequest{WebhookRequest: &entity.WebhookRequest{User: "user1", Asset: "BTC", Amount: "1"}})
+	if !errors.Is(err, detectorErr) || len(applied) != 2 {
+		t.Errorf("Execute() with failing detector error = %v, applied %d, want %v and nothing applied", err, len(applied), detectorErr)
+	}
+}
+
+// mockFreezeStore is an AssetFreezeStore of the assets frozen, by name
+type mockFreezeStore map[string]entity.AssetFreeze
+
+func (m mockFreezeStore) Frozen(asset string) (entity.AssetFreeze, bool) {
+	freeze, ok := m[asset]
+	return freeze, ok
+}
+
+func (m mockFreezeStore) Freeze(freeze entity.AssetFreeze) error {
+	m[freeze.Asset] = freeze
+	return nil
+}
+
+func (m mockFreezeStore) Unfreeze(asset string) (bool, error) {
+	_, ok := m[asset]
+	delete(m, asset)
+	return ok, nil
+}
+
+func (m mockFreezeStore) List() []entity.AssetFreeze {
+	freezes := make([]entity.AssetFreeze, 0, len(m))
+	for _, freeze := range m {
+		freezes = append(freezes, freeze)
+	}
+	return freezes
+}
+
+func TestProcessWebhookUseCase_Freezes(t *testing.T) {
+	var applied []entity.LedgerEntry
+	repository := &mockBatchRepository{
+		mockWebhookRepository: mockWebhookRepository{
+			addEntryFunc: func(ctx context.Context, entry entity.LedgerEntry) error {
+				applied = append(applied, entry)
+				return nil
+			},
+		},
+		addEntriesFunc: func(ctx context.Context, entries []entity.LedgerEntry) error {
+			applied = append(applied, entries...)
+			return nil
+		},
+	}
+	freezes := mockFreezeStore{"ETH": {Asset: "ETH", Reason: "chain halt"}}
+	pending := mockPendingStore{}
+	useCase := NewProcessWebhookUseCase(&mockWebhookValidator{}, repository,
+		WithApproval(decimal.RequireFromString("100"), pending, false),
+		WithAssetFreezes(freezes))
+	ctx := context.Background()
+	execute := func(req *entity.WebhookRequest) error {
+		return useCase.Execute(ctx, ProcessWebhookRequest{WebhookRequest: req, Source: "default"})
+	}
+
+	tests := []struct {
+		name    string
+		req     *entity.WebhookRequest
+		wantErr error
+	}{
+		{name: "other asset", req: &entity.WebhookRequest{User: "user1", Asset: "BTC", Amount: "1"}},
+		{name: "frozen asset", req: &entity.WebhookRequest{User: "user1", Asset: "ETH", Amount: "1"}, wantErr: entity.ErrAssetFrozen},
+		{
+			name: "batch with a frozen asset",
+			req: &entity.WebhookRequest{Entries: []entity.WebhookRequest{
+				{User: "user1", Asset: "BTC", Amount: "1"},
+				{User: "user2", Asset: "ETH", Amount: "1"},
+			}},
+			wantErr: entity.ErrAssetFrozen,
+		},
+		{
+			name: "trade with a frozen leg",
+			req: &entity.WebhookRequest{User: "user1", Legs: []entity.Leg{
+				{Asset: "BTC", Amount: "-1"},
+				{Asset: "ETH", Amount: "20"},
+			}},
+			wantErr: entity.ErrAssetFrozen,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applied = nil
+			err := execute(tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Execute() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil && len(applied) > 0 {
+				t.Errorf("applied %v, want nothing", applied)
+			}
+		})
+	}
+
+	// An entry parked before the freeze waits until the asset is unfrozen
+	pending["pending-1"] = entity.PendingEntry{ID: "pending-1", Entry: entity.LedgerEntry{User: "user1", Asset: "ETH", Amount: "500"}}
+	applied = nil
+	if _, err := useCase.ApprovePending(ctx, "pending-1"); !errors.Is(err, entity.ErrAssetFrozen) {
+		t.Fatalf("ApprovePending() error = %v, want %v", err, entity.ErrAssetFrozen)
+	}
+	if len(applied) != 0 || len(pending) != 1 {
+		t.Errorf("applied %v with %d pending, want the entry kept pending", applied, len(pending))
+	}
+	delete(freezes, "ETH")
+	if _, err := useCase.ApprovePending(ctx, "pending-1"); err != nil || len(applied) != 1 {
+		t.Errorf("ApprovePending() after unfreezing error = %v, applied %v", err, applied)
+	}
+}
+
+// eventRecorder is an EventPublisher recording the events published
+type eventRecorder []entity.BalanceEvent
+
+func (r *eventRecorder) Publish(ctx context.Context, event entity.BalanceEvent) {
+	*r = append(*r, event)
+}
+
+func TestProcessWebhookUseCase_Events(t *testing.T) {
+	failing := false
+	var sequence uint64
+	// The repository numbers the entries it applies, as the ledger does
+	apply := func(ctx context.Context, entries ...entity.LedgerEntry) {
+		for _, entry := range entries {
+			sequence++
+			entry.Sequence = sequence
+			port.RecordApplied(ctx, entry)
+		}
+	}
+	repository := &mockBatchRepository{
+		mockWebhookRepository: mockWebhookRepository{
+			addEntryFunc: func(ctx context.Context, entry entity.LedgerEntry) error {
+				if failing {
+					return errors.New("repository error")
+				}
+				apply(ctx, entry)
+				return nil
+			},
+		},
+		addEntriesFunc: func(ctx context.Context, entries []entity.LedgerEntry) error {
+			apply(ctx, entries...)
+			return nil
+		},
+	}
+	var events eventRecorder
+	store := mockPendingStore{}
+	useCase := NewProcessWebhookUseCase(&mockWebhookValidator{}, repository,
+		WithApproval(decimal.RequireFromString("1000"), store, false),
+		WithEventPublisher(&events))
+	ctx := context.Background()
+	execute := func(req *entity.WebhookRequest, approvalID string) error {
+		return useCase.Execute(ctx, ProcessWebhookRequest{WebhookRequest: req, Source: "partner", ApprovalID: approvalID})
+	}
+
+	if err := execute(&entity.WebhookRequest{User: "user1", Asset: "BTC", Amount: "1.5"}, ""); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(events) != 1 || events[0].User != "user1" || events[0].Amount != "1.5" || events[0].Source != "partner" ||
+		events[0].ID == "" || events[0].Batch != "" || events[0].AppliedAt.IsZero() || events[0].Sequence != 1 {
+		t.Fatalf("events = %+v, want one for the entry", events)
+	}
+
+	// Entries applied together share a batch ID
+	events = nil
+	batch := &entity.WebhookRequest{Entries: []entity.WebhookRequest{
+		{User: "user1", Asset: "BTC", Amount: "1"},
+		{User: "user2", Asset: "ETH", Amount: "-2"},
+	}}
+	if err := execute(batch, ""); err != nil {
+		t.Fatalf("Execute(batch) error = %v", err)
+	}
+	if len(events) != 2 || events[0].Batch == "" || events[0].Batch != events[1].Batch || events[0].ID == events[1].ID ||
+		events[0].Sequence != 2 || events[1].Sequence != 3 {
+		t.Fatalf("events = %+v, want two in one batch", events)
+	}
+
+	// Parked and failed entries are not announced until they are applied
+	events = nil
+	var approvalRequired *entity.ApprovalRequiredError
+	if err := execute(&entity.WebhookRequest{User: "user1", Asset: "BTC", Amount: "5000"}, ""); !errors.As(err, &approvalRequired) {
+		t.Fatalf("Execute() error = %v, want ApprovalRequiredError", err)
+	}
+	failing = true
+	if _, err := useCase.ApprovePending(ctx, approvalRequired.ID); err == nil {
+		t.Fatal("ApprovePending() error = nil, want the repository error")
+	}
+	if len(events) != 0 {
+		t.Fatalf("events = %+v, want none", events)
+	}
+	failing = false
+	if _, err := useCase.ApprovePending(ctx, approvalRequired.ID); err != nil {
+		t.Fatalf("ApprovePending() error = %v", err)
+	}
+	if len(events) != 1 || events[0].Amount != "5000" || events[0].Source != "partner" || events[0].Sequence != 4 {
+		t.Errorf("events = %+v, want the approved entry from its source", events)
+	}
+}
+
+func TestProcessWebhookUseCase_Labels(t *testing.T) {
+	var applied []entity.LedgerEntry
+	repository := &mockWebhookRepository{
+		addEntryFunc: func(ctx context.Context, entry entity.LedgerEntry) error {
+			applied = append(applied, entry)
+			return nil
+		},
+	}
+	var events eventRecorder
+	useCase := NewProcessWebhookUseCase(&mockWebhookValidator{}, repository, WithEventPublisher(&events))
+
+	req := &entity.WebhookRequest{User: "user1", Asset: "BTC", Amount: "1", Labels: map[string]string{"region": "eu", "campaign": "airdrop"}}
+	if err := useCase.Execute(context.Background(), ProcessWebhookRequest{WebhookRequest: req}); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(applied) != 1 || applied[0].Labels != "campaign=airdrop,region=eu" {
+		t.Errorf("applied = %+v, want the entry with its labels", applied)
+	}
+	if len(events) != 1 || events[0].Labels != "campaign=airdrop,region=eu" {
+		t.Errorf("events = %+v, want the entry's labels announced", events)
+	}
+
+	// Labels breaking the rules reject the webhook
+	applied = nil
+	req = &entity.WebhookRequest{User: "user1", Asset: "BTC", Amount: "1", Labels: map[string]string{"campaign": "spring sale"}}
+	if err := useCase.Execute(context.Background(), ProcessWebhookRequest{WebhookRequest: req}); !errors.Is(err, entity.ErrInvalidLabels) {
+		t.Errorf("Execute() error = %v, want %v", err, entity.ErrInvalidLabels)
+	}
+	if len(applied) != 0 {
+		t.Errorf("applied = %+v, want nothing", applied)
+	}
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr ||
 		(len(s) > len(substr) && containsSubstring(s, substr)))
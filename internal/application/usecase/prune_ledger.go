@@ -0,0 +1,56 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+)
+
+// PruneLedgerUseCase handles moving old ledger entries to the archive,
+// keeping the primary store small while the history stays restorable
+type PruneLedgerUseCase struct {
+	repository port.LedgerRepository
+	archive    port.LedgerArchive
+	maxAge     time.Duration
+	clock      port.Clock
+}
+
+// NewPruneLedgerUseCase creates a new PruneLedgerUseCase moving the entries
+// applied more than maxAge ago to archive
+func NewPruneLedgerUseCase(repository port.LedgerRepository, archive port.LedgerArchive, maxAge time.Duration, clock port.Clock) *PruneLedgerUseCase {
+	return &PruneLedgerUseCase{
+		repository: repository,
+		archive:    archive,
+		maxAge:     maxAge,
+		clock:      clock,
+	}
+}
+
+// Execute archives the old entries as one segment and removes them from the
+// ledger. Balances are unchanged.
+func (uc *PruneLedgerUseCase) Execute(ctx context.Context) (result entity.PruneResult, err error) {
+	ctx, span := tracer.Start(ctx, "PruneLedgerUseCase.Execute")
+	defer func() {
+		span.SetAttributes(
+			attribute.Int("ledger.pruned_entries", result.Entries),
+			attribute.String("archive.segment", result.Segment))
+		endSpan(span, err)
+	}()
+
+	pruner, ok := uc.repository.(port.LedgerPruner)
+	if !ok {
+		return result, entity.ErrPruningUnsupported
+	}
+
+	before := uc.clock.Now().Add(-uc.maxAge)
+	result.Entries, err = pruner.Prune(ctx, before, func(entries []entity.LedgerEntry) error {
+		segment, err := uc.archive.Store(ctx, entries)
+		result.Segment = segment
+		return err
+	})
+	return result, err
+}
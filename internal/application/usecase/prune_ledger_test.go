@@ -0,0 +1,95 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"kii.com/internal/domain/entity"
+)
+
+// mockPruningRepository is a mock LedgerRepository that can be pruned,
+// holding one old entry
+type mockPruningRepository struct {
+	mockBalanceRepository
+	before time.Time
+}
+
+func (m *mockPruningRepository) Prune(ctx context.Context, before time.Time, archive func([]entity.LedgerEntry) error) (int, error) {
+	m.before = before
+	if err := archive([]entity.LedgerEntry{{Sequence: 7, User: "user1", Asset: "BTC", Amount: "1"}}); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// mockLedgerArchive is a mock implementation of LedgerArchive
+type mockLedgerArchive struct {
+	stored [][]entity.LedgerEntry
+	err    error
+}
+
+func (m *mockLedgerArchive) Store(ctx context.Context, entries []entity.LedgerEntry) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+	m.stored = append(m.stored, entries)
+	return "segment-7", nil
+}
+
+func (m *mockLedgerArchive) Segments(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+func (m *mockLedgerArchive) EachEntry(ctx context.Context, segment string, fn func(entity.LedgerEntry) error) error {
+	return entity.ErrSegmentNotFound
+}
+
+func TestPruneLedgerUseCase_Execute(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	errStore := errors.New("bucket unreachable")
+
+	tests := []struct {
+		name       string
+		storeErr   error
+		wantResult entity.PruneResult
+		wantErr    error
+	}{
+		{
+			name:       "old entries archived",
+			wantResult: entity.PruneResult{Entries: 1, Segment: "segment-7"},
+		},
+		{
+			name:     "archive error",
+			storeErr: errStore,
+			wantErr:  errStore,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockPruningRepository{}
+			archive := &mockLedgerArchive{err: tt.storeErr}
+			useCase := NewPruneLedgerUseCase(repo, archive, 365*24*time.Hour, fixedClock(now))
+
+			result, err := useCase.Execute(context.Background())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Execute() error = %v, want %v", err, tt.wantErr)
+			}
+			if result != tt.wantResult {
+				t.Errorf("Execute() = %+v, want %+v", result, tt.wantResult)
+			}
+			if want := now.Add(-365 * 24 * time.Hour); !repo.before.Equal(want) {
+				t.Errorf("before = %v, want %v", repo.before, want)
+			}
+		})
+	}
+}
+
+func TestPruneLedgerUseCase_Execute_Unsupported(t *testing.T) {
+	useCase := NewPruneLedgerUseCase(&mockBalanceRepository{}, &mockLedgerArchive{}, time.Hour, fixedClock(time.Now()))
+	if _, err := useCase.Execute(context.Background()); !errors.Is(err, entity.ErrPruningUnsupported) {
+		t.Errorf("Execute() error = %v, want %v", err, entity.ErrPruningUnsupported)
+	}
+}
@@ -0,0 +1,59 @@
+package usecase
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+)
+
+// QueryHoldingsUseCase reports who holds each asset, for risk and operations
+// review
+type QueryHoldingsUseCase struct {
+	repository port.LedgerRepository
+}
+
+// NewQueryHoldingsUseCase creates a new QueryHoldingsUseCase
+func NewQueryHoldingsUseCase(repository port.LedgerRepository) *QueryHoldingsUseCase {
+	return &QueryHoldingsUseCase{
+		repository: repository,
+	}
+}
+
+// TopHolders returns up to n users with the largest positive balances of
+// asset, largest first
+func (uc *QueryHoldingsUseCase) TopHolders(ctx context.Context, asset string, n int) (_ []entity.Holder, err error) {
+	ctx, span := tracer.Start(ctx, "QueryHoldingsUseCase.TopHolders", trace.WithAttributes(
+		attribute.String("ledger.asset", asset),
+		attribute.Int("ledger.top", n)))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	if asset == "" {
+		return nil, entity.ErrMissingAsset
+	}
+	holdings, ok := uc.repository.(port.LedgerHoldingsRepository)
+	if !ok {
+		return nil, entity.ErrHoldingsUnsupported
+	}
+	return holdings.TopHolders(ctx, asset, n)
+}
+
+// Distributions returns how the balances of asset, or of every asset when
+// it is empty, are spread among their holders
+func (uc *QueryHoldingsUseCase) Distributions(ctx context.Context, asset string) (_ []entity.BalanceDistribution, err error) {
+	ctx, span := tracer.Start(ctx, "QueryHoldingsUseCase.Distributions", trace.WithAttributes(attribute.String("ledger.asset", asset)))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	holdings, ok := uc.repository.(port.LedgerHoldingsRepository)
+	if !ok {
+		return nil, entity.ErrHoldingsUnsupported
+	}
+	return holdings.BalanceDistributions(ctx, asset)
+}
@@ -0,0 +1,58 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"kii.com/internal/domain/entity"
+)
+
+// mockHoldingsRepository is a mock LedgerRepository that ranks holders
+type mockHoldingsRepository struct {
+	mockBalanceRepository
+	asset string
+	n     int
+}
+
+func (m *mockHoldingsRepository) TopHolders(ctx context.Context, asset string, n int) ([]entity.Holder, error) {
+	m.asset, m.n = asset, n
+	return []entity.Holder{{User: "user1", Balance: "2.00000000"}}, nil
+}
+
+func (m *mockHoldingsRepository) BalanceDistributions(ctx context.Context, asset string) ([]entity.BalanceDistribution, error) {
+	m.asset = asset
+	return []entity.BalanceDistribution{{Asset: "BTC", Holders: 1, Total: "2.00000000"}}, nil
+}
+
+func TestQueryHoldingsUseCase(t *testing.T) {
+	repo := &mockHoldingsRepository{}
+	useCase := NewQueryHoldingsUseCase(repo)
+
+	holders, err := useCase.TopHolders(context.Background(), "BTC", 5)
+	if err != nil {
+		t.Fatalf("TopHolders() error = %v", err)
+	}
+	if len(holders) != 1 || repo.asset != "BTC" || repo.n != 5 {
+		t.Errorf("TopHolders() = %v for %s top %d, want one holder for BTC top 5", holders, repo.asset, repo.n)
+	}
+	if _, err := useCase.TopHolders(context.Background(), "", 5); !errors.Is(err, entity.ErrMissingAsset) {
+		t.Errorf("TopHolders() without asset error = %v, want %v", err, entity.ErrMissingAsset)
+	}
+
+	distributions, err := useCase.Distributions(context.Background(), "")
+	if err != nil {
+		t.Fatalf("Distributions() error = %v", err)
+	}
+	if len(distributions) != 1 || repo.asset != "" {
+		t.Errorf("Distributions() = %v for %q, want one for every asset", distributions, repo.asset)
+	}
+
+	unsupported := NewQueryHoldingsUseCase(&mockBalanceRepository{})
+	if _, err := unsupported.TopHolders(context.Background(), "BTC", 5); !errors.Is(err, entity.ErrHoldingsUnsupported) {
+		t.Errorf("TopHolders() error = %v, want %v", err, entity.ErrHoldingsUnsupported)
+	}
+	if _, err := unsupported.Distributions(context.Background(), ""); !errors.Is(err, entity.ErrHoldingsUnsupported) {
+		t.Errorf("Distributions() error = %v, want %v", err, entity.ErrHoldingsUnsupported)
+	}
+}
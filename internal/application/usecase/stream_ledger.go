@@ -0,0 +1,68 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+)
+
+// errPageFull stops a listing once a page is full
+var errPageFull = errors.New("page full")
+
+// StreamLedgerUseCase handles ledger history listing
+type StreamLedgerUseCase struct {
+	repository port.LedgerRepository
+}
+
+// NewStreamLedgerUseCase creates a new StreamLedgerUseCase
+func NewStreamLedgerUseCase(repository port.LedgerRepository) *StreamLedgerUseCase {
+	return &StreamLedgerUseCase{
+		repository: repository,
+	}
+}
+
+// Execute calls emit for each ledger entry of user on page, or for every
+// entry when user is empty, in sequence order and without loading the whole
+// history into memory. Entries not matching the page's labels are skipped.
+// The next page starts after the last entry's Sequence.
+func (uc *StreamLedgerUseCase) Execute(ctx context.Context, user string, page entity.HistoryPage, emit func(entity.LedgerEntry) error) (err error) {
+	ctx, span := tracer.Start(ctx, "StreamLedgerUseCase.Execute", trace.WithAttributes(
+		attribute.String("ledger.user", user),
+		attribute.Int64("ledger.after", int64(page.After)),
+		attribute.Int("ledger.limit", page.Limit)))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	history, ok := uc.repository.(port.LedgerHistoryRepository)
+	if !ok {
+		return entity.ErrHistoryUnsupported
+	}
+
+	var count int
+	defer func() {
+		span.SetAttributes(attribute.Int("ledger.entries", count))
+	}()
+	err = history.EachEntry(ctx, user, page.After, func(entry entity.LedgerEntry) error {
+		if !page.Labels.Matches(entry.Labels) {
+			return nil
+		}
+		count++
+		if err := emit(entry); err != nil {
+			return err
+		}
+		if count == page.Limit {
+			return errPageFull
+		}
+		return nil
+	})
+	if errors.Is(err, errPageFull) {
+		return nil
+	}
+	return err
+}
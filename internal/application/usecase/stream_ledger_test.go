@@ -0,0 +1,89 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"kii.com/internal/domain/entity"
+)
+
+// mockHistoryRepository is a mock LedgerRepository that can list entries
+type mockHistoryRepository struct {
+	mockBalanceRepository
+	entries []entity.LedgerEntry
+}
+
+func (m *mockHistoryRepository) EachEntry(ctx context.Context, user string, after uint64, fn func(entity.LedgerEntry) error) error {
+	for _, entry := range m.entries {
+		if (user != "" && entry.User != user) || entry.Sequence <= after {
+			continue
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestStreamLedgerUseCase_Execute(t *testing.T) {
+	repo := &mockHistoryRepository{entries: []entity.LedgerEntry{
+		{Sequence: 1, User: "user1", Asset: "BTC", Amount: "1", Labels: "campaign=airdrop"},
+		{Sequence: 2, User: "user2", Asset: "ETH", Amount: "2", Labels: "campaign=airdrop,region=eu"},
+		{Sequence: 3, User: "user1", Asset: "BTC", Amount: "3"},
+	}}
+
+	tests := []struct {
+		name      string
+		user      string
+		page      entity.HistoryPage
+		wantCount int
+	}{
+		{name: "single user", user: "user1", wantCount: 2},
+		{name: "all users", user: "", wantCount: 3},
+		{name: "unknown user", user: "nobody", wantCount: 0},
+		{name: "after a sequence", user: "", page: entity.HistoryPage{After: 1}, wantCount: 2},
+		{name: "limited", user: "", page: entity.HistoryPage{Limit: 2}, wantCount: 2},
+		{name: "limit above the rest", user: "user1", page: entity.HistoryPage{After: 1, Limit: 5}, wantCount: 1},
+		{name: "labelled", user: "", page: entity.HistoryPage{Labels: entity.LabelSelector{"campaign": "airdrop"}}, wantCount: 2},
+		{name: "labelled and limited", user: "", page: entity.HistoryPage{Limit: 1, Labels: entity.LabelSelector{"region": ""}}, wantCount: 1},
+		{name: "no label matches", user: "user1", page: entity.HistoryPage{Labels: entity.LabelSelector{"region": ""}}, wantCount: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := NewStreamLedgerUseCase(repo)
+			var got []entity.LedgerEntry
+			err := uc.Execute(context.Background(), tt.user, tt.page, func(entry entity.LedgerEntry) error {
+				got = append(got, entry)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if len(got) != tt.wantCount {
+				t.Errorf("Execute() emitted %d entries, want %d", len(got), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestStreamLedgerUseCase_Execute_Errors(t *testing.T) {
+	uc := NewStreamLedgerUseCase(&mockBalanceRepository{})
+	err := uc.Execute(context.Background(), "user1", entity.HistoryPage{}, func(entity.LedgerEntry) error { return nil })
+	if !errors.Is(err, entity.ErrHistoryUnsupported) {
+		t.Errorf("Execute() error = %v, want %v", err, entity.ErrHistoryUnsupported)
+	}
+
+	// An emit error stops the stream
+	stop := errors.New("client gone")
+	repo := &mockHistoryRepository{entries: []entity.LedgerEntry{{Sequence: 1, User: "user1"}, {Sequence: 2, User: "user1"}}}
+	var emitted int
+	err = NewStreamLedgerUseCase(repo).Execute(context.Background(), "", entity.HistoryPage{}, func(entity.LedgerEntry) error {
+		emitted++
+		return stop
+	})
+	if !errors.Is(err, stop) || emitted != 1 {
+		t.Errorf("Execute() error = %v after %d entries, want %v after 1", err, emitted, stop)
+	}
+}
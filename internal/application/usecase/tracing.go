@@ -0,0 +1,19 @@
+package usecase
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates spans for use case executions
+var tracer = otel.Tracer("kii.com/internal/application/usecase") //nolint:gochecknoglobals
+
+// endSpan records err on span (if any) and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,88 @@
+package usecase
+
+import (
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+)
+
+// VelocityRule limits the total a user may be credited in an asset within a
+// sliding window. An empty Asset applies the limit to every asset
+// separately.
+type VelocityRule struct {
+	Asset     string
+	Window    time.Duration
+	MaxCredit decimal.Decimal
+}
+
+// velocityPolicy checks credits against the velocity rules. Entries over a
+// limit are parked in review when it is set, and rejected otherwise.
+type velocityPolicy struct {
+	rules  []VelocityRule
+	store  port.VelocityStore
+	review port.PendingEntryStore
+	// mu makes checking and recording a credit atomic
+	mu sync.Mutex
+}
+
+// WithVelocityLimits counts the credits of every user in store and holds
+// back entries that would exceed one of rules. With a review store such
+// entries are parked there until approved like high-value entries, so it
+// must be the store passed to WithApproval when both are used; otherwise
+// they are rejected with entity.ErrVelocityExceeded.
+func WithVelocityLimits(rules []VelocityRule, store port.VelocityStore, review port.PendingEntryStore) ProcessWebhookOption {
+	return func(uc *ProcessWebhookUseCase) {
+		uc.velocity = &velocityPolicy{rules: rules, store: store, review: review}
+	}
+}
+
+// reserve records the credits of entries at now if none exceeds a rule,
+// returning a function that reverses them if the entries are not applied
+// after all. Debits and amounts that do not parse are not counted.
+func (p *velocityPolicy) reserve(entries []entity.LedgerEntry, now time.Time) (func(), error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var reserved []entity.LedgerEntry
+	release := func() {
+		for _, entry := range reserved {
+			amount, _ := decimal.NewFromString(entry.Amount)
+			p.store.Add(entry.User, entry.Asset, amount.Neg(), now)
+		}
+	}
+	for _, entry := range entries {
+		amount, err := decimal.NewFromString(entry.Amount)
+		if err != nil || !amount.IsPositive() {
+			continue
+		}
+		for _, rule := range p.rules {
+			if rule.Asset != "" && rule.Asset != entry.Asset {
+				continue
+			}
+			credited := p.store.Sum(entry.User, entry.Asset, now.Add(-rule.Window))
+			if credited.Add(amount).GreaterThan(rule.MaxCredit) {
+				release()
+				return nil, entity.ErrVelocityExceeded.WithDetail("%s would be credited %s %s within %s, limit %s",
+					entry.User, credited.Add(amount), entry.Asset, rule.Window, rule.MaxCredit)
+			}
+		}
+		p.store.Add(entry.User, entry.Asset, amount, now)
+		reserved = append(reserved, entry)
+	}
+	return release, nil
+}
+
+// record counts the credit of entry at now without checking the rules
+func (p *velocityPolicy) record(entry entity.LedgerEntry, now time.Time) {
+	amount, err := decimal.NewFromString(entry.Amount)
+	if err != nil || !amount.IsPositive() {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.store.Add(entry.User, entry.Asset, amount, now)
+}
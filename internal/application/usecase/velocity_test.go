@@ -0,0 +1,160 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"kii.com/internal/domain/entity"
+)
+
+// mockVelocityStore is a slice-backed VelocityStore
+type mockVelocityStore []struct {
+	user, asset string
+	amount      decimal.Decimal
+	at          time.Time
+}
+
+func (m *mockVelocityStore) Add(user, asset string, amount decimal.Decimal, at time.Time) {
+	*m = append(*m, struct {
+		user, asset string
+		amount      decimal.Decimal
+		at          time.Time
+	}{user, asset, amount, at})
+}
+
+func (m *mockVelocityStore) Sum(user, asset string, since time.Time) decimal.Decimal {
+	sum := decimal.Zero
+	for _, c := range *m {
+		if c.user == user && c.asset == asset && !c.at.Before(since) {
+			sum = sum.Add(c.amount)
+		}
+	}
+	return sum
+}
+
+func TestProcessWebhookUseCase_Velocity(t *testing.T) {
+	rules := []VelocityRule{
+		{Asset: "BTC", Window: time.Hour, MaxCredit: decimal.RequireFromString("2")},
+		{Window: 24 * time.Hour, MaxCredit: decimal.RequireFromString("100")},
+	}
+	var applied []entity.LedgerEntry
+	errLedger := errors.New("ledger unavailable")
+	failNext := false
+	repository := &mockBatchRepository{
+		mockWebhookRepository: mockWebhookRepository{
+			addEntryFunc: func(ctx context.Context, entry entity.LedgerEntry) error {
+				if failNext {
+					failNext = false
+					return errLedger
+				}
+				applied = append(applied, entry)
+				return nil
+			},
+		},
+		addEntriesFunc: func(ctx context.Context, entries []entity.LedgerEntry) error {
+			applied = append(applied, entries...)
+			return nil
+		},
+	}
+	useCase := NewProcessWebhookUseCase(&mockWebhookValidator{}, repository,
+		WithVelocityLimits(rules, &mockVelocityStore{}, nil))
+	execute := func(req *entity.WebhookRequest) error {
+		return useCase.Execute(context.Background(), ProcessWebhookRequest{WebhookRequest: req, Source: "default"})
+	}
+	single := func(user, asset, amount string) *entity.WebhookRequest {
+		return &entity.WebhookRequest{User: user, Asset: asset, Amount: amount}
+	}
+
+	steps := []struct {
+		name    string
+		req     *entity.WebhookRequest
+		fail    bool
+		wantErr error
+	}{
+		{name: "within the BTC limit", req: single("user1", "BTC", "1.5")},
+		{name: "failed entry is not counted", req: single("user1", "BTC", "0.5"), fail: true, wantErr: errLedger},
+		{name: "reaching the BTC limit", req: single("user1", "BTC", "0.5")},
+		{name: "over the BTC limit", req: single("user1", "BTC", "0.01"), wantErr: entity.ErrVelocityExceeded},
+		{name: "debits are not limited", req: single("user1", "BTC", "-5")},
+		{name: "other users have their own limit", req: single("user2", "BTC", "2")},
+		{name: "other assets only have the daily limit", req: single("user1", "ETH", "100")},
+		{
+			name: "batch credits add up",
+			req: &entity.WebhookRequest{Entries: []entity.WebhookRequest{
+				{User: "user3", Asset: "BTC", Amount: "1.5"},
+				{User: "user3", Asset: "BTC", Amount: "1"},
+			}},
+			wantErr: entity.ErrVelocityExceeded,
+		},
+		{name: "rejected batch is not counted", req: single("user3", "BTC", "2")},
+	}
+	for _, step := range steps {
+		failNext = step.fail
+		before := len(applied)
+		if err := execute(step.req); !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: Execute() error = %v, want %v", step.name, err, step.wantErr)
+		}
+		if applied := len(applied) - before; (step.wantErr == nil) != (applied > 0) {
+			t.Errorf("%s: applied %d entries", step.name, applied)
+		}
+	}
+}
+
+func TestProcessWebhookUseCase_VelocityReview(t *testing.T) {
+	rules := []VelocityRule{{Window: time.Hour, MaxCredit: decimal.RequireFromString("10")}}
+	var applied []entity.LedgerEntry
+	repository := &mockWebhookRepository{
+		addEntryFunc: func(ctx context.Context, entry entity.LedgerEntry) error {
+			applied = append(applied, entry)
+			return nil
+		},
+	}
+	store := mockPendingStore{}
+	useCase := NewProcessWebhookUseCase(&mockWebhookValidator{}, repository,
+		WithVelocityLimits(rules, &mockVelocityStore{}, store))
+	execute := func(amount, approvalID string) error {
+		return useCase.Execute(context.Background(), ProcessWebhookRequest{
+			WebhookRequest: &entity.WebhookRequest{User: "user1", Asset: "BTC", Amount: amount},
+			Source:         "default",
+			ApprovalID:     approvalID,
+		})
+	}
+
+	if err := execute("8", ""); err != nil {
+		t.Fatalf("Execute(8) error = %v", err)
+	}
+	err := execute("5", "")
+	var approvalRequired *entity.ApprovalRequiredError
+	if !errors.As(err, &approvalRequired) {
+		t.Fatalf("Execute(5) error = %v, want ApprovalRequiredError", err)
+	}
+	if len(applied) != 1 || len(store) != 1 {
+		t.Fatalf("applied %d entries with %d pending, want 1 and 1", len(applied), len(store))
+	}
+	if pending := store[approvalRequired.ID]; pending.Policy != entity.PolicyVelocity {
+		t.Errorf("pending policy = %q, want %q", pending.Policy, entity.PolicyVelocity)
+	}
+
+	// Held entries are released by an operator, never by a webhook
+	if err := execute("5", approvalRequired.ID); !errors.Is(err, entity.ErrPendingNotFound) {
+		t.Fatalf("approving Execute() error = %v, want %v", err, entity.ErrPendingNotFound)
+	}
+	if len(applied) != 1 || len(store) != 1 {
+		t.Fatalf("after approving webhook applied %d entries with %d pending, want 1 and 1", len(applied), len(store))
+	}
+	if _, err := useCase.ApprovePending(context.Background(), approvalRequired.ID); err != nil {
+		t.Fatalf("ApprovePending() error = %v", err)
+	}
+	if len(applied) != 2 || len(store) != 0 {
+		t.Fatalf("after approval applied %d entries with %d pending, want 2 and 0", len(applied), len(store))
+	}
+
+	// The approved credit counts, so even a small credit is now held back
+	if err := execute("0.1", ""); !errors.As(err, &approvalRequired) {
+		t.Errorf("Execute(0.1) error = %v, want ApprovalRequiredError", err)
+	}
+}
@@ -0,0 +1,85 @@
+package entity
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// MaxAmountDigits bounds the digits before and after the decimal point of an
+// amount. Exponent notation lets a short amount such as "1e999999999" expand
+// into a number too large to format, so such amounts are rejected.
+const MaxAmountDigits = 64
+
+// DefaultScale is the number of decimal places balances are kept at, and the
+// largest scale an asset can have
+const DefaultScale = 8
+
+// RoundingMode is how an AmountPolicy rounds amounts with more decimal places
+// than their asset's scale
+type RoundingMode string
+
+const (
+	// RoundHalfUp rounds to the nearest value, halves away from zero
+	RoundHalfUp RoundingMode = "half-up"
+	// RoundHalfEven rounds to the nearest value, halves to the even one
+	RoundHalfEven RoundingMode = "half-even"
+	// RoundTruncate drops the extra decimal places, rounding toward zero
+	RoundTruncate RoundingMode = "truncate"
+)
+
+// ParseRoundingMode parses a RoundingMode; an empty string means RoundHalfUp
+func ParseRoundingMode(s string) (RoundingMode, error) {
+	switch m := RoundingMode(strings.ToLower(s)); m {
+	case "":
+		return RoundHalfUp, nil
+	case RoundHalfUp, RoundHalfEven, RoundTruncate:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown rounding mode %q: want half-up, half-even or truncate", s)
+}
+
+// AssetPrecision is the Scale, in decimal places, the amounts of an asset are
+// kept at, and how amounts with more decimal places are rounded to it
+type AssetPrecision struct {
+	Scale    int32
+	Rounding RoundingMode
+}
+
+// AmountPolicy rounds amounts to the precision of their asset: the one in
+// Assets, keyed by lowercased asset, or Default for other assets
+type AmountPolicy struct {
+	Assets  map[string]AssetPrecision
+	Default AssetPrecision
+}
+
+// Apply returns amount rounded to the precision of asset, or unchanged when it
+// has no more decimal places than the asset's scale. It returns
+// ErrInvalidAmount if amount is not a decimal number.
+func (p AmountPolicy) Apply(asset, amount string) (string, error) {
+	d, err := decimal.NewFromString(amount)
+	if err != nil {
+		return "", ErrInvalidAmount.WithDetail("%q is not a decimal number", amount)
+	}
+	if d.Exponent() < -MaxAmountDigits {
+		return "", ErrInvalidAmount.WithDetail("%q has more than %d decimal places", amount, MaxAmountDigits)
+	}
+
+	precision, ok := p.Assets[strings.ToLower(asset)]
+	if !ok {
+		precision = p.Default
+	}
+	if d.Exponent() >= -precision.Scale {
+		return amount, nil
+	}
+	switch precision.Rounding {
+	case RoundHalfEven:
+		d = d.RoundBank(precision.Scale)
+	case RoundTruncate:
+		d = d.Truncate(precision.Scale)
+	default:
+		d = d.Round(precision.Scale)
+	}
+	return d.StringFixed(precision.Scale), nil
+}
@@ -0,0 +1,57 @@
+package entity
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAmountPolicy_Apply(t *testing.T) {
+	policy := AmountPolicy{
+		Assets: map[string]AssetPrecision{
+			"jpy":  {Scale: 0, Rounding: RoundHalfEven},
+			"usdc": {Scale: 2, Rounding: RoundTruncate},
+		},
+		Default: AssetPrecision{Scale: 8, Rounding: RoundHalfUp},
+	}
+
+	tests := []struct {
+		asset   string
+		amount  string
+		want    string
+		wantErr error
+	}{
+		{asset: "BTC", amount: "1.5", want: "1.5"},
+		{asset: "BTC", amount: "0.000000015", want: "0.00000002"},
+		{asset: "BTC", amount: "-0.000000015", want: "-0.00000002"},
+		{asset: "JPY", amount: "2.5", want: "2"},
+		{asset: "JPY", amount: "3.5", want: "4"},
+		{asset: "JPY", amount: "1e3", want: "1e3"},
+		{asset: "USDC", amount: "1.999", want: "1.99"},
+		{asset: "USDC", amount: "-1.999", want: "-1.99"},
+		{asset: "USDC", amount: "lots", wantErr: ErrInvalidAmount},
+		{asset: "BTC", amount: "1e-999999999", wantErr: ErrInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.asset+" "+tt.amount, func(t *testing.T) {
+			got, err := policy.Apply(tt.asset, tt.amount)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Apply() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Apply() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRoundingMode(t *testing.T) {
+	for s, want := range map[string]RoundingMode{"": RoundHalfUp, "Half-Even": RoundHalfEven, "truncate": RoundTruncate} {
+		if got, err := ParseRoundingMode(s); err != nil || got != want {
+			t.Errorf("ParseRoundingMode(%q) = %q, %v, want %q", s, got, err, want)
+		}
+	}
+	if _, err := ParseRoundingMode("ceiling"); err == nil {
+		t.Error("ParseRoundingMode(ceiling) error = nil, want an error")
+	}
+}
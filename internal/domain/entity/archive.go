@@ -0,0 +1,29 @@
+package entity
+
+import "time"
+
+// ArchivedUser is the state of an idle user removed from the ledger by
+// compaction: the entries dropped from the history, and the balances they
+// still held, if any, which stay in the ledger
+type ArchivedUser struct {
+	User         string            `json:"user"`
+	LastActivity time.Time         `json:"lastActivity"`
+	Balances     map[string]string `json:"balances,omitempty"`
+	Entries      []LedgerEntry     `json:"entries"`
+}
+
+// PruneResult describes a ledger pruning: the number of Entries moved to
+// the archive segment named Segment. Both are zero when nothing was old
+// enough to prune.
+type PruneResult struct {
+	Entries int    `json:"entries"`
+	Segment string `json:"segment,omitempty"`
+}
+
+// CompactionResult counts what a ledger compaction removed
+type CompactionResult struct {
+	ZeroBalances    int `json:"zeroBalances"`
+	ArchivedUsers   int `json:"archivedUsers"`
+	ArchivedEntries int `json:"archivedEntries"`
+	RemovedUsers    int `json:"removedUsers"`
+}
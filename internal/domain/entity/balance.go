@@ -1,14 +1,63 @@
 package entity
 
-// BalanceResponse represents the balance response for a user
+import "time"
+
+// BalanceResponse represents the balance response for a user. Balances are
+// the totals; once the user has holds, Held sums them per asset and Available
+// is what is left of each total, for every asset either has. Sequence
+// identifies the user's last applied entry and grows with every entry; it is
+// zero when the user has no entries or the repository does not track it.
 type BalanceResponse struct {
-	User     string            `json:"user"`
-	Balances map[string]string `json:"balances"`
+	User      string            `json:"user"`
+	Balances  map[string]string `json:"balances"`
+	Held      map[string]string `json:"held,omitempty"`
+	Available map[string]string `json:"available,omitempty"`
+	Sequence  uint64            `json:"-"`
+}
+
+// Hold sets a positive Amount of a user's Asset aside, e.g. for a debit
+// awaiting approval, until it is released or captured, or ExpiresAt passes. A
+// zero ExpiresAt never passes.
+type Hold struct {
+	ID        string    `json:"id"`
+	User      string    `json:"user"`
+	Asset     string    `json:"asset"`
+	Amount    string    `json:"amount"`
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+}
+
+// Expired reports whether h has expired at now
+func (h Hold) Expired(now time.Time) bool {
+	return !h.ExpiresAt.IsZero() && !now.Before(h.ExpiresAt)
 }
 
-// LedgerEntry represents a single ledger entry
+// BalanceAttestation is a user's balances at Timestamp, signed by the
+// service so third parties can check them offline
+type BalanceAttestation struct {
+	User      string            `json:"user"`
+	Balances  map[string]string `json:"balances"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// LedgerEntry represents a single ledger entry. The repository numbers the
+// entries it applies: Sequence grows across the whole ledger and
+// UserSequence counts the user's entries from 1. Both are zero, as is
+// AppliedAt, until the entry is applied.
 type LedgerEntry struct {
-	User   string
-	Asset  string
-	Amount string
+	Sequence     uint64    `json:"sequence,omitempty"`
+	UserSequence uint64    `json:"userSequence,omitempty"`
+	User         string    `json:"user"`
+	Asset        string    `json:"asset"`
+	Amount       string    `json:"amount"`
+	AppliedAt    time.Time `json:"appliedAt,omitzero"`
+	Labels       Labels    `json:"labels,omitempty"`
+}
+
+// HistoryPage selects a page of ledger history: the entries with a Sequence
+// above After, at most Limit of them. A zero Limit selects all of them. Only
+// entries matching Labels are selected, and counted towards Limit.
+type HistoryPage struct {
+	After  uint64
+	Limit  int
+	Labels LabelSelector
 }
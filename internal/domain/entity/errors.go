@@ -1,9 +1,264 @@
 package entity
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Error is a domain error with a stable Code that clients and tests can
+// match on instead of its text and a Message that is safe to return to the
+// client. Adapters map codes to their own statuses, such as HTTP ones. Err, when set, is the
+// underlying cause, which is logged but never returned.
+//
+// Message is the text of the catalog entry, prefixed with the Field of the
+// request the error is located at and followed by its Detail, if any, so
+// that the text can be replaced on its own; see Localize.
+type Error struct {
+	Code    string
+	Message string
+	Field   string
+	Detail  string
+	Err     error
+}
+
+// catalog holds the errors of the catalog by code
+var catalog = make(map[string]*Error) //nolint:gochecknoglobals
+
+// newError adds an error to the catalog
+func newError(code string, message string) *Error {
+	e := &Error{Code: code, Message: message}
+	catalog[code] = e
+	return e
+}
+
+// LookupError returns the catalog error with code
+func LookupError(code string) (*Error, bool) {
+	e, ok := catalog[code]
+	return e, ok
+}
+
+// ErrorCodes returns the codes of the catalog, sorted
+func ErrorCodes() []string {
+	codes := make([]string, 0, len(catalog))
+	for code := range catalog {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the underlying cause
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an Error with the same code, so that an
+// error carrying details still matches the catalog entry it was made from
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithDetail returns a copy of e whose message ends with details, formatted
+// as by fmt.Sprintf. Details are returned to the client, so they must only
+// hold what it sent.
+func (e *Error) WithDetail(format string, args ...any) *Error {
+	detail := fmt.Sprintf(format, args...)
+	c := *e
+	c.Message = e.Message + ": " + detail
+	c.Detail = joinMessage(e.Detail, detail)
+	return &c
+}
 
+// Wrap returns a copy of e caused by err
+func (e *Error) Wrap(err error) *Error {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+// ErrorAt locates err at field of the request, e.g. entries[2], prefixing
+// its message with it
+func ErrorAt(field string, err error) error {
+	var domainErr *Error
+	if !errors.As(err, &domainErr) {
+		return fmt.Errorf("%s: %w", field, err)
+	}
+	c := *domainErr
+	c.Message = field + ": " + domainErr.Message
+	c.Field = joinMessage(field, domainErr.Field)
+	return &c
+}
+
+// Localize returns the message of e with the text of its catalog entry
+// replaced by text, such as a translation, keeping the field it is located
+// at and its details
+func (e *Error) Localize(text string) string {
+	return joinMessage(joinMessage(e.Field, text), e.Detail)
+}
+
+// joinMessage joins the non-empty parts of a message with ": "
+func joinMessage(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	}
+	return a + ": " + b
+}
+
+// The error catalog. Codes are part of the API and must not change.
 var (
-	ErrMissingUser   = errors.New("missing required field: user")
-	ErrMissingAsset  = errors.New("missing required field: asset")
-	ErrMissingAmount = errors.New("missing required field: amount")
+	ErrMissingUser   = newError("missing_user", "missing required field: user")
+	ErrMissingAsset  = newError("missing_asset", "missing required field: asset")
+	ErrMissingAmount = newError("missing_amount", "missing required field: amount")
+
+	// ErrInvalidAmount is returned by ledger backends for an amount that is
+	// not a decimal number
+	ErrInvalidAmount = newError("invalid_amount", "invalid amount")
+
+	// ErrMissingHeader is returned by webhook validators for a request
+	// without one of the headers carrying the signature
+	ErrMissingHeader = newError("missing_header", "missing signature header")
+	// ErrInvalidTimestamp is returned by webhook validators for a timestamp
+	// header that does not parse
+	ErrInvalidTimestamp = newError("invalid_timestamp", "invalid timestamp")
+	// ErrTimestampOutOfTolerance is returned by webhook validators for a
+	// request signed too long ago, or too far in the future
+	ErrTimestampOutOfTolerance = newError("timestamp_out_of_tolerance", "timestamp out of tolerance")
+	// ErrReplayDetected is returned by webhook validators for a reused nonce
+	ErrReplayDetected = newError("replay_detected", "duplicate nonce detected")
+	// ErrValidationFailed describes a validation failure outside the catalog,
+	// e.g. one of a validator embedded by another service
+	ErrValidationFailed = newError("validation_failed", "validation failed")
+	// ErrInvalidSignature is returned by webhook validators for a signature
+	// that does not match the request; see SignatureMismatchError
+	ErrInvalidSignature = newError("invalid_signature", "invalid signature")
+
+	// ErrPayloadTooLarge is returned for a webhook body over
+	// webhook.maxBodyBytes
+	ErrPayloadTooLarge = newError("payload_too_large", "request body too large")
+
+	// ErrDuplicateWebhook is returned for a webhook whose content was seen
+	// within the duplicate window
+	ErrDuplicateWebhook = newError("duplicate_webhook", "duplicate webhook")
+
+	// ErrAssetFrozen is returned for an entry in an asset an operator froze
+	ErrAssetFrozen = newError("asset_frozen", "asset is frozen")
+
+	// ErrPendingNotFound is returned when approving an entry that is not, or
+	// no longer, pending
+	ErrPendingNotFound = newError("pending_not_found", "pending entry not found")
+
+	// ErrApprovalMismatch is returned when an approval's entry differs from
+	// the pending one
+	ErrApprovalMismatch = newError("approval_mismatch", "approval does not match the pending entry")
+
+	// ErrApprovalSameSource is returned when an entry is approved by the
+	// source that submitted it while distinct sources are required
+	ErrApprovalSameSource = newError("approval_same_source", "approval must come from a different source")
+
+	// ErrInvalidUser is returned for a user identifier rejected by the
+	// configured UserPolicy
+	ErrInvalidUser = newError("invalid_user", "invalid user")
+
+	// ErrVelocityExceeded is returned for an entry that would credit a user
+	// more than a velocity limit allows
+	ErrVelocityExceeded = newError("velocity_exceeded", "velocity limit exceeded")
+
+	// ErrInvalidBatch is returned for a malformed batch of webhook entries
+	ErrInvalidBatch = newError("invalid_batch", "invalid batch")
+
+	// ErrInvalidTrade is returned for a malformed multi-leg trade
+	ErrInvalidTrade = newError("invalid_trade", "invalid trade")
+
+	// ErrInvalidLabels is returned for entry labels or a label selector that
+	// break the label rules
+	ErrInvalidLabels = newError("invalid_labels", "invalid labels")
+
+	// ErrBatchUnsupported is returned when the ledger backend cannot apply
+	// several entries atomically, as batches and trades need
+	ErrBatchUnsupported = newError("batch_unsupported", "batched entries are not supported by this storage backend")
+
+	// ErrBatchApproval is returned for a batch or trade with an entry that
+	// requires approval; such entries must be sent on their own
+	ErrBatchApproval = newError("batch_approval", "batch contains an entry that requires approval")
+
+	// ErrInvalidPeriod is returned for a statement period that does not parse
+	// or has not started yet
+	ErrInvalidPeriod = newError("invalid_period", "invalid statement period")
+
+	// ErrHistoryUnsupported is returned when the ledger backend cannot list entries
+	ErrHistoryUnsupported = newError("history_unsupported", "ledger history is not supported by this storage backend")
+	// ErrCompactionUnsupported is returned when the ledger backend cannot
+	// drop zero balances and idle users
+	ErrCompactionUnsupported = newError("compaction_unsupported", "ledger compaction is not supported by this storage backend")
+	// ErrPruningUnsupported is returned when the ledger backend cannot move
+	// old entries to an archive
+	ErrPruningUnsupported = newError("pruning_unsupported", "ledger pruning is not supported by this storage backend")
+	// ErrHoldingsUnsupported is returned when the ledger backend cannot rank
+	// holders or report how balances are distributed
+	ErrHoldingsUnsupported = newError("holdings_unsupported", "holdings queries are not supported by this storage backend")
+	// ErrHoldsUnsupported is returned when the ledger backend cannot set
+	// funds aside
+	ErrHoldsUnsupported = newError("holds_unsupported", "holds are not supported by this storage backend")
+	// ErrSegmentNotFound is returned for an archive segment that does not exist
+	ErrSegmentNotFound = newError("segment_not_found", "archive segment not found")
+
+	// ErrInvalidDeadline is returned for a request deadline or timeout header
+	// that does not parse
+	ErrInvalidDeadline = newError("invalid_deadline", "invalid request deadline")
+	// ErrDeadlineExceeded is returned for a webhook not applied by the
+	// deadline its sender set
+	ErrDeadlineExceeded = newError("deadline_exceeded", "request deadline exceeded")
+
+	// ErrInvalidTestHeader is returned for a failure injection header, which
+	// senders may set in mock mode, that does not parse
+	ErrInvalidTestHeader = newError("invalid_test_header", "invalid test header")
+	// ErrForcedFailure answers a webhook whose sender forced a failure in mock
+	// mode, with the status it asked for
+	ErrForcedFailure = newError("forced_failure", "failure forced for testing")
+
+	// ErrReadOnly answers a webhook or admin change sent to a read-only
+	// replica, which serves balances and history but applies nothing
+	ErrReadOnly = newError("read_only", "this server is a read-only replica")
+
+	// ErrStorageTransient marks a storage error that left nothing applied,
+	// such as a dropped connection or a serialization conflict, so the
+	// operation may be retried. Backends wrap their errors with it.
+	ErrStorageTransient = newError("storage_transient", "transient storage error")
+	// ErrStorageUnavailable is returned without calling the storage backend
+	// while it is considered down after repeated failures
+	ErrStorageUnavailable = newError("storage_unavailable", "storage backend unavailable")
+
+	// ErrInternal describes any error outside the catalog to clients, which
+	// are not shown its message
+	ErrInternal = newError("internal_error", "internal error")
 )
+
+// SignatureMismatchError is returned by webhook validators for a signature
+// that does not match the request. It carries the bytes the service signed,
+// which the sender may be shown to debug its signing; they include nothing
+// the sender did not send. It unwraps to ErrInvalidSignature.
+type SignatureMismatchError struct {
+	Scheme           string
+	CanonicalMessage []byte
+}
+
+func (e *SignatureMismatchError) Error() string {
+	return ErrInvalidSignature.Message
+}
+
+// Unwrap returns ErrInvalidSignature
+func (e *SignatureMismatchError) Unwrap() error {
+	return ErrInvalidSignature
+}
@@ -0,0 +1,90 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestError_Is(t *testing.T) {
+	cause := errors.New("connection reset")
+
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{name: "catalog entry", err: ErrMissingUser, target: ErrMissingUser, want: true},
+		{name: "with detail", err: ErrInvalidUser.WithDetail("%q is too long", "user1"), target: ErrInvalidUser, want: true},
+		{name: "wrapping a cause", err: ErrInvalidAmount.Wrap(cause), target: ErrInvalidAmount, want: true},
+		{name: "cause of a wrapped error", err: ErrInvalidAmount.Wrap(cause), target: cause, want: true},
+		{name: "located in a batch", err: ErrorAt("entries[1]", ErrMissingAsset), target: ErrMissingAsset, want: true},
+		{name: "wrapped by fmt", err: fmt.Errorf("retention: %w", ErrPruningUnsupported), target: ErrPruningUnsupported, want: true},
+		{name: "signature mismatch", err: &SignatureMismatchError{Scheme: "hmac-sha256"}, target: ErrInvalidSignature, want: true},
+		{name: "other code", err: ErrMissingUser, target: ErrMissingAsset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, tt.target); got != tt.want {
+				t.Errorf("errors.Is(%v, %v) = %v, want %v", tt.err, tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestError_Message(t *testing.T) {
+	err := ErrorAt("entries[2]", ErrInvalidAmount.Wrap(errors.New("can't convert lots to decimal")))
+
+	var domainErr *Error
+	if !errors.As(err, &domainErr) {
+		t.Fatalf("errors.As(%v) = false, want an *Error", err)
+	}
+	if domainErr.Code != "invalid_amount" {
+		t.Errorf("Code = %q, want invalid_amount", domainErr.Code)
+	}
+	// The cause may describe internals, so it is left out of the message
+	if domainErr.Message != "entries[2]: invalid amount" {
+		t.Errorf("Message = %q, want entries[2]: invalid amount", domainErr.Message)
+	}
+	if err.Error() != "entries[2]: invalid amount: can't convert lots to decimal" {
+		t.Errorf("Error() = %q, want the message and the cause", err.Error())
+	}
+	if ErrInvalidAmount.Message != "invalid amount" {
+		t.Errorf("catalog message = %q, want it unchanged", ErrInvalidAmount.Message)
+	}
+}
+
+func TestError_Localize(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *Error
+		want string
+	}{
+		{name: "catalog entry", err: ErrInvalidAmount, want: "montant invalide"},
+		{name: "with detail", err: ErrInvalidAmount.WithDetail("%q is not a decimal number", "lots"), want: `montant invalide: "lots" is not a decimal number`},
+		{name: "located in a batch", err: ErrorAt("entries[2]", ErrInvalidAmount.WithDetail("too precise")).(*Error), want: "entries[2]: montant invalide: too precise"},
+		{name: "located twice", err: ErrorAt("entries[1]", ErrorAt("legs[0]", ErrInvalidAmount)).(*Error), want: "entries[1]: legs[0]: montant invalide"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Localize("montant invalide"); got != tt.want {
+				t.Errorf("Localize() = %q, want %q", got, tt.want)
+			}
+			// Localizing with the catalog text gives the message back
+			if got := tt.err.Localize(ErrInvalidAmount.Message); got != tt.err.Message {
+				t.Errorf("Localize(%q) = %q, want the message %q", ErrInvalidAmount.Message, got, tt.err.Message)
+			}
+		})
+	}
+}
+
+func TestLookupError(t *testing.T) {
+	if err, ok := LookupError("invalid_signature"); !ok || err != ErrInvalidSignature {
+		t.Errorf("LookupError(invalid_signature) = %v, %v, want ErrInvalidSignature", err, ok)
+	}
+	if _, ok := LookupError("no_such_code"); ok {
+		t.Error("LookupError(no_such_code) found an error")
+	}
+}
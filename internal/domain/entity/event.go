@@ -0,0 +1,22 @@
+package entity
+
+import "time"
+
+// BalanceEvent announces an entry applied to the ledger, for projections
+// such as notifications, caches and analytics. Source is the webhook source
+// the entry came from; entries applied together, as a batch or trade, share
+// a Batch ID, and it carries the labels the webhook tagged the entry with.
+// Sequence is the entry's sequence in the ledger, so consumers can order
+// events and tell when they missed some; it is zero when the repository does
+// not number entries.
+type BalanceEvent struct {
+	ID        string    `json:"id"`
+	Sequence  uint64    `json:"sequence,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	Batch     string    `json:"batch,omitempty"`
+	User      string    `json:"user"`
+	Asset     string    `json:"asset"`
+	Amount    string    `json:"amount"`
+	Labels    Labels    `json:"labels,omitempty"`
+	AppliedAt time.Time `json:"appliedAt"`
+}
@@ -0,0 +1,11 @@
+package entity
+
+import "time"
+
+// AssetFreeze pauses processing of an asset, e.g. during a chain halt.
+// Reason says why and is shown to operators, never to senders.
+type AssetFreeze struct {
+	Asset    string    `json:"asset"`
+	Reason   string    `json:"reason,omitempty"`
+	FrozenAt time.Time `json:"frozenAt"`
+}
@@ -0,0 +1,25 @@
+package entity
+
+// Holder is a user's balance of one asset
+type Holder struct {
+	User    string `json:"user"`
+	Balance string `json:"balance"`
+}
+
+// BalanceBucket counts the holders of an asset with a balance from Min up to
+// but excluding Max. Buckets span a power of ten each; the bucket of negative
+// balances has no Min.
+type BalanceBucket struct {
+	Min   string `json:"min,omitempty"`
+	Max   string `json:"max"`
+	Count int    `json:"count"`
+}
+
+// BalanceDistribution describes how the non-zero balances of an asset are
+// spread among its holders, with the buckets in ascending order
+type BalanceDistribution struct {
+	Asset   string          `json:"asset"`
+	Holders int             `json:"holders"`
+	Total   string          `json:"total"`
+	Buckets []BalanceBucket `json:"buckets"`
+}
@@ -0,0 +1,167 @@
+package entity
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+)
+
+const (
+	// MaxLabels is the number of labels an entry may carry at most
+	MaxLabels = 16
+	// maxLabelKeyLength and maxLabelValueLength bound label keys and values
+	maxLabelKeyLength   = 63
+	maxLabelValueLength = 255
+)
+
+// Labels are the key=value tags a webhook attached to its ledger entries,
+// e.g. campaign=airdrop, for segmenting reports. They are kept in canonical
+// form, the pairs sorted by key and joined by commas, so that entries carrying
+// them stay comparable; build them with NewLabels. Keys and values are made of
+// letters, digits and _ - . : / characters.
+type Labels string
+
+// NewLabels returns labels in canonical form, or ErrInvalidLabels with the
+// reason if they break the label rules
+func NewLabels(labels map[string]string) (Labels, error) {
+	if len(labels) > MaxLabels {
+		return "", ErrInvalidLabels.WithDetail("%d labels, at most %d are allowed", len(labels), MaxLabels)
+	}
+	pairs := make([]string, 0, len(labels))
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		if err := validateLabel(key, labels[key]); err != nil {
+			return "", err
+		}
+		pairs = append(pairs, key+"="+labels[key])
+	}
+	return Labels(strings.Join(pairs, ",")), nil
+}
+
+// validateLabel checks one label against the label rules
+func validateLabel(key, value string) error {
+	if key == "" || len(key) > maxLabelKeyLength || !isLabelText(key) {
+		return ErrInvalidLabels.WithDetail("key %q must be 1 to %d letters, digits or _-.:/", key, maxLabelKeyLength)
+	}
+	if value == "" || len(value) > maxLabelValueLength || !isLabelText(value) {
+		return ErrInvalidLabels.WithDetail("value %q of %s must be 1 to %d letters, digits or _-.:/", value, key, maxLabelValueLength)
+	}
+	return nil
+}
+
+// isLabelText reports whether s only has characters allowed in labels
+func isLabelText(s string) bool {
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("_-.:/", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Pairs returns the labels as key=value strings sorted by key
+func (l Labels) Pairs() []string {
+	if l == "" {
+		return nil
+	}
+	return strings.Split(string(l), ",")
+}
+
+// Map returns the labels keyed by name, or nil when there are none
+func (l Labels) Map() map[string]string {
+	if l == "" {
+		return nil
+	}
+	labels := make(map[string]string)
+	for _, pair := range l.Pairs() {
+		key, value, _ := strings.Cut(pair, "=")
+		labels[key] = value
+	}
+	return labels
+}
+
+// Get returns the value of the label key and whether it is set
+func (l Labels) Get(key string) (string, bool) {
+	for _, pair := range l.Pairs() {
+		if k, value, _ := strings.Cut(pair, "="); k == key {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// MarshalJSON encodes the labels as a JSON object
+func (l Labels) MarshalJSON() ([]byte, error) {
+	labels := l.Map()
+	if labels == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(labels)
+}
+
+// UnmarshalJSON decodes labels from a JSON object, checking them against the
+// label rules
+func (l *Labels) UnmarshalJSON(data []byte) error {
+	var labels map[string]string
+	if err := json.Unmarshal(data, &labels); err != nil {
+		return err
+	}
+	canonical, err := NewLabels(labels)
+	if err != nil {
+		return err
+	}
+	*l = canonical
+	return nil
+}
+
+// LabelSelector selects entries by their labels: an entry matches when it
+// carries every key of the selector with the given value, or with any value
+// for a key mapped to "".
+type LabelSelector map[string]string
+
+// ParseLabelSelector parses selector terms, each key=value or a bare key,
+// e.g. from repeated label query parameters
+func ParseLabelSelector(terms []string) (LabelSelector, error) {
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	selector := make(LabelSelector, len(terms))
+	for _, term := range terms {
+		key, value, hasValue := strings.Cut(term, "=")
+		if hasValue {
+			if err := validateLabel(key, value); err != nil {
+				return nil, err
+			}
+		} else if err := validateLabel(key, "any"); err != nil {
+			return nil, err
+		}
+		if previous, ok := selector[key]; ok && previous != value {
+			return nil, ErrInvalidLabels.WithDetail("label %s is selected twice", key)
+		}
+		selector[key] = value
+	}
+	return selector, nil
+}
+
+// Matches reports whether labels carry every label of the selector. An empty
+// selector matches all labels.
+func (s LabelSelector) Matches(labels Labels) bool {
+	for key, want := range s {
+		value, ok := labels.Get(key)
+		if !ok || (want != "" && value != want) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchesPair reports whether the single label pair, in key=value form,
+// carries a label of the selector, e.g. to pick label counters for a report
+func (s LabelSelector) MatchesPair(pair string) bool {
+	key, value, _ := strings.Cut(pair, "=")
+	want, ok := s[key]
+	return ok && (want == "" || value == want)
+}
@@ -0,0 +1,118 @@
+package entity
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewLabels(t *testing.T) {
+	tooMany := make(map[string]string)
+	for i := range MaxLabels + 1 {
+		tooMany[fmt.Sprintf("key%d", i)] = "value"
+	}
+
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		want    Labels
+		wantErr bool
+	}{
+		{name: "none", want: ""},
+		{name: "sorted by key", labels: map[string]string{"region": "eu", "campaign": "airdrop"}, want: "campaign=airdrop,region=eu"},
+		{name: "punctuation", labels: map[string]string{"team.id": "ops/payouts:v2_b-1"}, want: "team.id=ops/payouts:v2_b-1"},
+		{name: "empty key", labels: map[string]string{"": "airdrop"}, wantErr: true},
+		{name: "empty value", labels: map[string]string{"campaign": ""}, wantErr: true},
+		{name: "separator in value", labels: map[string]string{"campaign": "a,b=c"}, wantErr: true},
+		{name: "long key", labels: map[string]string{strings.Repeat("k", 64): "v"}, wantErr: true},
+		{name: "too many", labels: tooMany, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewLabels(tt.labels)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidLabels) {
+					t.Errorf("NewLabels() error = %v, want %v", err, ErrInvalidLabels)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewLabels() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("NewLabels() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabels_JSON(t *testing.T) {
+	entry := LedgerEntry{User: "user1", Asset: "BTC", Amount: "1", Labels: "campaign=airdrop,region=eu"}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if !strings.Contains(string(data), `"labels":{"campaign":"airdrop","region":"eu"}`) {
+		t.Errorf("Marshal() = %s, want labels as an object", data)
+	}
+
+	var decoded LedgerEntry
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if decoded != entry {
+		t.Errorf("Unmarshal() = %+v, want %+v", decoded, entry)
+	}
+
+	// Entries without labels leave them out
+	data, _ = json.Marshal(LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"})
+	if strings.Contains(string(data), "labels") {
+		t.Errorf("Marshal() = %s, want no labels", data)
+	}
+}
+
+func TestLabelSelector(t *testing.T) {
+	labels := Labels("campaign=airdrop,region=eu")
+
+	tests := []struct {
+		name    string
+		terms   []string
+		want    bool
+		wantErr bool
+	}{
+		{name: "no terms", want: true},
+		{name: "value", terms: []string{"campaign=airdrop"}, want: true},
+		{name: "other value", terms: []string{"campaign=referral"}, want: false},
+		{name: "key only", terms: []string{"region"}, want: true},
+		{name: "missing key", terms: []string{"desk"}, want: false},
+		{name: "all terms", terms: []string{"campaign=airdrop", "region=us"}, want: false},
+		{name: "conflicting terms", terms: []string{"campaign=airdrop", "campaign=referral"}, wantErr: true},
+		{name: "invalid term", terms: []string{"campaign=spring sale"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := ParseLabelSelector(tt.terms)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidLabels) {
+					t.Errorf("ParseLabelSelector() error = %v, want %v", err, ErrInvalidLabels)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseLabelSelector() error = %v", err)
+			}
+			if got := selector.Matches(labels); got != tt.want {
+				t.Errorf("Matches(%q) = %v, want %v", labels, got, tt.want)
+			}
+		})
+	}
+
+	if got, want := labels.Map(), map[string]string{"campaign": "airdrop", "region": "eu"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Map() = %v, want %v", got, want)
+	}
+}
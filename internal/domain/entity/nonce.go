@@ -0,0 +1,11 @@
+package entity
+
+import "time"
+
+// NonceRecord represents a nonce tracked for replay protection. Tenant is
+// the webhook source that used it, empty for the default endpoint.
+type NonceRecord struct {
+	Tenant    string    `json:"tenant,omitempty"`
+	Nonce     string    `json:"nonce"`
+	Timestamp time.Time `json:"timestamp"`
+}
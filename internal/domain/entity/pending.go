@@ -0,0 +1,52 @@
+package entity
+
+import (
+	"fmt"
+	"time"
+)
+
+// PendingPolicy is the policy that parked a pending entry
+type PendingPolicy string
+
+const (
+	// PolicyApproval parks entries above the approval threshold until a
+	// second signed webhook approves them
+	PolicyApproval PendingPolicy = "approval"
+	// PolicyVelocity parks credits over a velocity limit
+	PolicyVelocity PendingPolicy = "velocity"
+	// PolicyAnomaly parks entries the anomaly detector finds suspicious
+	PolicyAnomaly PendingPolicy = "anomaly"
+)
+
+// ParsePendingPolicy parses a PendingPolicy
+func ParsePendingPolicy(s string) (PendingPolicy, error) {
+	switch p := PendingPolicy(s); p {
+	case PolicyApproval, PolicyVelocity, PolicyAnomaly:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown policy %q: want approval, velocity or anomaly", s)
+}
+
+// PendingEntry is a ledger entry parked until it is approved, such as a
+// high-value entry awaiting a second signed webhook. Policy is the policy
+// that parked it and Reason says why.
+type PendingEntry struct {
+	ID        string        `json:"id"`
+	Entry     LedgerEntry   `json:"entry"`
+	Source    string        `json:"source"`
+	Policy    PendingPolicy `json:"policy,omitempty"`
+	Reason    string        `json:"reason,omitempty"`
+	CreatedAt time.Time     `json:"createdAt"`
+}
+
+// ApprovalRequiredError is returned when an entry was parked as pending
+// instead of being applied
+type ApprovalRequiredError struct {
+	ID     string
+	Policy PendingPolicy
+	Reason string
+}
+
+func (e *ApprovalRequiredError) Error() string {
+	return "entry requires approval, parked as " + e.ID
+}
@@ -0,0 +1,38 @@
+package entity
+
+import "time"
+
+// Statement is a user's ledger activity over a period: the balances at its
+// start, the entries applied within it, in the order they were applied, and
+// the balances at its end. Period is a day, e.g. 2026-10-14, or a month,
+// e.g. 2026-10, in UTC; From is its first instant and To the first instant
+// after it. A statement for the current period covers the entries applied
+// so far.
+type Statement struct {
+	User            string            `json:"user"`
+	Period          string            `json:"period"`
+	From            time.Time         `json:"from"`
+	To              time.Time         `json:"to"`
+	OpeningBalances map[string]string `json:"openingBalances"`
+	Entries         []LedgerEntry     `json:"entries"`
+	ClosingBalances map[string]string `json:"closingBalances"`
+}
+
+// Statement period layouts
+const (
+	statementDay   = "2006-01-02"
+	statementMonth = "2006-01"
+)
+
+// ParseStatementPeriod parses a statement period, a day as 2026-10-14 or a
+// month as 2026-10, returning its first instant and the first instant after
+// it, in UTC
+func ParseStatementPeriod(period string) (from, to time.Time, err error) {
+	if day, err := time.Parse(statementDay, period); err == nil {
+		return day, day.AddDate(0, 0, 1), nil
+	}
+	if month, err := time.Parse(statementMonth, period); err == nil {
+		return month, month.AddDate(0, 1, 0), nil
+	}
+	return time.Time{}, time.Time{}, ErrInvalidPeriod.WithDetail("%q: want a day as YYYY-MM-DD or a month as YYYY-MM", period)
+}
@@ -0,0 +1,75 @@
+package entity
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// UserCase is how a UserPolicy normalizes the case of user identifiers
+type UserCase string
+
+const (
+	// UserCasePreserve keeps identifiers as sent
+	UserCasePreserve UserCase = "preserve"
+	// UserCaseLower lowercases identifiers
+	UserCaseLower UserCase = "lower"
+	// UserCaseUpper uppercases identifiers
+	UserCaseUpper UserCase = "upper"
+)
+
+// ParseUserCase parses a UserCase; an empty string means UserCasePreserve
+func ParseUserCase(s string) (UserCase, error) {
+	switch c := UserCase(strings.ToLower(s)); c {
+	case "":
+		return UserCasePreserve, nil
+	case UserCasePreserve, UserCaseLower, UserCaseUpper:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown user case %q: want preserve, lower or upper", s)
+}
+
+// UserPolicy restricts the user identifiers webhooks may create ledger
+// accounts for. Identifiers are normalized to Case, then must be at most
+// MaxLength characters (zero means no limit) and match Pattern when it is
+// set; see CompileUserPattern.
+type UserPolicy struct {
+	Pattern   *regexp.Regexp
+	MaxLength int
+	Case      UserCase
+}
+
+// CompileUserPattern compiles a UserPolicy pattern that must match whole
+// identifiers, not just part of them
+func CompileUserPattern(expr string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + expr + `)$`)
+}
+
+// Normalize returns user in the case of the policy, as its account is kept,
+// without checking it against the policy's limits. Reads look accounts up
+// with it, so that they find those of webhooks sent in any case.
+func (p UserPolicy) Normalize(user string) string {
+	switch p.Case {
+	case UserCaseLower:
+		return strings.ToLower(user)
+	case UserCaseUpper:
+		return strings.ToUpper(user)
+	}
+	return user
+}
+
+// Apply returns user normalized by the policy, or ErrInvalidUser with the
+// reason if the policy rejects it
+func (p UserPolicy) Apply(user string) (string, error) {
+	user = p.Normalize(user)
+	if p.MaxLength > 0 && utf8.RuneCountInString(user) > p.MaxLength {
+		return "", ErrInvalidUser.WithDetail("%q is longer than %d characters", user, p.MaxLength)
+	}
+	if p.Pattern != nil {
+		if !p.Pattern.MatchString(user) {
+			return "", ErrInvalidUser.WithDetail("%q does not match %s", user, p.Pattern)
+		}
+	}
+	return user, nil
+}
@@ -0,0 +1,55 @@
+package entity
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUserPolicy_Apply(t *testing.T) {
+	pattern, err := CompileUserPattern(`[a-z0-9_-]+|acct:[0-9]+`)
+	if err != nil {
+		t.Fatalf("CompileUserPattern() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		policy  UserPolicy
+		user    string
+		want    string
+		wantErr error
+	}{
+		{name: "no restrictions", policy: UserPolicy{}, user: "Any User!", want: "Any User!"},
+		{name: "lowercased", policy: UserPolicy{Case: UserCaseLower}, user: "User1", want: "user1"},
+		{name: "uppercased", policy: UserPolicy{Case: UserCaseUpper}, user: "user1", want: "USER1"},
+		{name: "within max length", policy: UserPolicy{MaxLength: 5}, user: "usér1", want: "usér1"},
+		{name: "too long", policy: UserPolicy{MaxLength: 4}, user: "user1", wantErr: ErrInvalidUser},
+		{name: "matches pattern", policy: UserPolicy{Pattern: pattern}, user: "user_1", want: "user_1"},
+		{name: "matches second alternative", policy: UserPolicy{Pattern: pattern}, user: "acct:42", want: "acct:42"},
+		{name: "partial match", policy: UserPolicy{Pattern: pattern}, user: "user 1", wantErr: ErrInvalidUser},
+		{name: "pattern checked after case", policy: UserPolicy{Pattern: pattern, Case: UserCaseLower}, user: "User1", want: "user1"},
+		{name: "empty", policy: UserPolicy{Pattern: pattern}, user: "", wantErr: ErrInvalidUser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.Apply(tt.user)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Apply(%q) error = %v, want %v", tt.user, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Apply(%q) = %q, want %q", tt.user, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseUserCase(t *testing.T) {
+	for input, want := range map[string]UserCase{"": UserCasePreserve, "preserve": UserCasePreserve, "Lower": UserCaseLower, "upper": UserCaseUpper} {
+		if got, err := ParseUserCase(input); err != nil || got != want {
+			t.Errorf("ParseUserCase(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseUserCase("title"); err == nil {
+		t.Error("ParseUserCase(title) error = nil, want error")
+	}
+}
@@ -1,14 +1,45 @@
 package entity
 
-// WebhookRequest represents the incoming webhook payload
+import (
+	"fmt"
+	"maps"
+)
+
+// WebhookRequest represents the incoming webhook payload. A batch carries
+// its items in Entries instead of a top-level user, asset and amount, and a
+// trade carries the user's legs in Legs instead of an asset and amount. Both
+// are applied atomically. Labels tag every entry the request applies; the
+// labels of a batch go to each item, whose own labels take precedence.
 type WebhookRequest struct {
-	User   string `json:"user"`
+	User    string            `json:"user"`
+	Asset   string            `json:"asset"`
+	Amount  string            `json:"amount"`
+	Entries []WebhookRequest  `json:"entries,omitempty"`
+	Legs    []Leg             `json:"legs,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// Leg is one asset movement of a trade, e.g. the USDT debit or the BTC
+// credit of a fill
+type Leg struct {
 	Asset  string `json:"asset"`
 	Amount string `json:"amount"`
 }
 
+// minTradeLegs is the number of legs a trade needs at least
+const minTradeLegs = 2
+
 // Validate validates the webhook request
 func (w *WebhookRequest) Validate() error {
+	if _, err := NewLabels(w.Labels); err != nil {
+		return ErrorAt("labels", err)
+	}
+	if len(w.Entries) > 0 {
+		return w.validateBatch()
+	}
+	if len(w.Legs) > 0 {
+		return w.validateTrade()
+	}
 	if w.User == "" {
 		return ErrMissingUser
 	}
@@ -20,3 +51,91 @@ func (w *WebhookRequest) Validate() error {
 	}
 	return nil
 }
+
+// validateBatch validates each item of a batch
+func (w *WebhookRequest) validateBatch() error {
+	if w.User != "" || w.Asset != "" || w.Amount != "" || len(w.Legs) > 0 {
+		return ErrInvalidBatch.WithDetail("entries cannot be combined with user, asset, amount or legs")
+	}
+	for i := range w.Entries {
+		if len(w.Entries[i].Entries) > 0 {
+			return ErrInvalidBatch.WithDetail("entries[%d] is itself a batch", i)
+		}
+		if err := w.Entries[i].Validate(); err != nil {
+			return ErrorAt(fmt.Sprintf("entries[%d]", i), err)
+		}
+		if _, err := NewLabels(mergeLabels(w.Labels, w.Entries[i].Labels)); err != nil {
+			return ErrorAt(fmt.Sprintf("entries[%d].labels", i), err)
+		}
+	}
+	return nil
+}
+
+// validateTrade validates the user and each leg of a trade
+func (w *WebhookRequest) validateTrade() error {
+	if w.Asset != "" || w.Amount != "" {
+		return ErrInvalidTrade.WithDetail("legs cannot be combined with asset or amount")
+	}
+	if w.User == "" {
+		return ErrMissingUser
+	}
+	if len(w.Legs) < minTradeLegs {
+		return ErrInvalidTrade.WithDetail("a trade needs at least %d legs", minTradeLegs)
+	}
+	for i, leg := range w.Legs {
+		if leg.Asset == "" {
+			return ErrorAt(fmt.Sprintf("legs[%d]", i), ErrMissingAsset)
+		}
+		if leg.Amount == "" {
+			return ErrorAt(fmt.Sprintf("legs[%d]", i), ErrMissingAmount)
+		}
+	}
+	return nil
+}
+
+// IsMultiEntry reports whether the request is a batch or a trade, i.e.
+// applies several ledger entries at once
+func (w *WebhookRequest) IsMultiEntry() bool {
+	return len(w.Entries) > 0 || len(w.Legs) > 0
+}
+
+// LedgerEntries returns the ledger entries the request applies: one for a
+// single entry, one per leg for a trade and those of every item for a batch
+func (w *WebhookRequest) LedgerEntries() []LedgerEntry {
+	switch {
+	case len(w.Entries) > 0:
+		var entries []LedgerEntry
+		for i := range w.Entries {
+			item := w.Entries[i]
+			item.Labels = mergeLabels(w.Labels, item.Labels)
+			entries = append(entries, item.LedgerEntries()...)
+		}
+		return entries
+	case len(w.Legs) > 0:
+		labels := w.labels()
+		entries := make([]LedgerEntry, len(w.Legs))
+		for i, leg := range w.Legs {
+			entries[i] = LedgerEntry{User: w.User, Asset: leg.Asset, Amount: leg.Amount, Labels: labels}
+		}
+		return entries
+	}
+	return []LedgerEntry{{User: w.User, Asset: w.Asset, Amount: w.Amount, Labels: w.labels()}}
+}
+
+// labels returns the request's labels in canonical form. Validate rejects
+// requests whose labels break the rules, so none are left for them.
+func (w *WebhookRequest) labels() Labels {
+	labels, _ := NewLabels(w.Labels)
+	return labels
+}
+
+// mergeLabels returns the labels of a batch with those of one of its items,
+// which win where both set a key
+func mergeLabels(batch, item map[string]string) map[string]string {
+	if len(batch) == 0 {
+		return item
+	}
+	merged := maps.Clone(batch)
+	maps.Copy(merged, item)
+	return merged
+}
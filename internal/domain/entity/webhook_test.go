@@ -1,6 +1,8 @@
 package entity
 
 import (
+	"errors"
+	"reflect"
 	"testing"
 )
 
@@ -55,14 +57,174 @@ func TestWebhookRequest_Validate(t *testing.T) {
 			},
 			wantErr: ErrMissingUser,
 		},
+		{
+			name: "valid batch",
+			req: WebhookRequest{Entries: []WebhookRequest{
+				{User: "user1", Asset: "BTC", Amount: "1"},
+				{User: "user2", Asset: "ETH", Amount: "-2"},
+			}},
+			wantErr: nil,
+		},
+		{
+			name: "batch item missing amount",
+			req: WebhookRequest{Entries: []WebhookRequest{
+				{User: "user1", Asset: "BTC", Amount: "1"},
+				{User: "user2", Asset: "ETH"},
+			}},
+			wantErr: ErrMissingAmount,
+		},
+		{
+			name: "batch with top-level entry",
+			req: WebhookRequest{User: "user1", Entries: []WebhookRequest{
+				{User: "user1", Asset: "BTC", Amount: "1"},
+			}},
+			wantErr: ErrInvalidBatch,
+		},
+		{
+			name: "nested batch",
+			req: WebhookRequest{Entries: []WebhookRequest{
+				{Entries: []WebhookRequest{{User: "user1", Asset: "BTC", Amount: "1"}}},
+			}},
+			wantErr: ErrInvalidBatch,
+		},
+		{
+			name: "valid trade",
+			req: WebhookRequest{User: "user1", Legs: []Leg{
+				{Asset: "USDT", Amount: "-100"},
+				{Asset: "BTC", Amount: "0.001"},
+			}},
+			wantErr: nil,
+		},
+		{
+			name:    "trade with a single leg",
+			req:     WebhookRequest{User: "user1", Legs: []Leg{{Asset: "BTC", Amount: "1"}}},
+			wantErr: ErrInvalidTrade,
+		},
+		{
+			name: "trade with top-level asset",
+			req: WebhookRequest{User: "user1", Asset: "BTC", Legs: []Leg{
+				{Asset: "USDT", Amount: "-100"},
+				{Asset: "BTC", Amount: "0.001"},
+			}},
+			wantErr: ErrInvalidTrade,
+		},
+		{
+			name: "trade missing user",
+			req: WebhookRequest{Legs: []Leg{
+				{Asset: "USDT", Amount: "-100"},
+				{Asset: "BTC", Amount: "0.001"},
+			}},
+			wantErr: ErrMissingUser,
+		},
+		{
+			name: "trade leg missing asset",
+			req: WebhookRequest{User: "user1", Legs: []Leg{
+				{Asset: "USDT", Amount: "-100"},
+				{Amount: "0.001"},
+			}},
+			wantErr: ErrMissingAsset,
+		},
+		{
+			name: "batch with legs",
+			req: WebhookRequest{
+				Entries: []WebhookRequest{{User: "user1", Asset: "BTC", Amount: "1"}},
+				Legs:    []Leg{{Asset: "USDT", Amount: "-100"}, {Asset: "BTC", Amount: "0.001"}},
+			},
+			wantErr: ErrInvalidBatch,
+		},
+		{
+			name:    "labels",
+			req:     WebhookRequest{User: "user1", Asset: "BTC", Amount: "1", Labels: map[string]string{"campaign": "airdrop"}},
+			wantErr: nil,
+		},
+		{
+			name:    "invalid label",
+			req:     WebhookRequest{User: "user1", Asset: "BTC", Amount: "1", Labels: map[string]string{"campaign": "spring sale"}},
+			wantErr: ErrInvalidLabels,
+		},
+		{
+			name: "batch item invalid label",
+			req: WebhookRequest{Entries: []WebhookRequest{
+				{User: "user1", Asset: "BTC", Amount: "1", Labels: map[string]string{"": "airdrop"}},
+			}},
+			wantErr: ErrInvalidLabels,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			err := tt.req.Validate()
-			if err != tt.wantErr {
+			if !errors.Is(err, tt.wantErr) {
 				t.Errorf("WebhookRequest.Validate() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestWebhookRequest_LedgerEntries(t *testing.T) {
+	single := WebhookRequest{User: "user1", Asset: "BTC", Amount: "1"}
+	if got, want := single.LedgerEntries(), []LedgerEntry{{User: "user1", Asset: "BTC", Amount: "1"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LedgerEntries() = %v, want %v", got, want)
+	}
+
+	batch := WebhookRequest{Entries: []WebhookRequest{
+		{User: "user1", Asset: "BTC", Amount: "1"},
+		{User: "user2", Asset: "ETH", Amount: "-2"},
+	}}
+	want := []LedgerEntry{{User: "user1", Asset: "BTC", Amount: "1"}, {User: "user2", Asset: "ETH", Amount: "-2"}}
+	if got := batch.LedgerEntries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("LedgerEntries() = %v, want %v", got, want)
+	}
+
+	trade := WebhookRequest{User: "user1", Legs: []Leg{
+		{Asset: "USDT", Amount: "-100"},
+		{Asset: "BTC", Amount: "0.001"},
+	}}
+	want = []LedgerEntry{{User: "user1", Asset: "USDT", Amount: "-100"}, {User: "user1", Asset: "BTC", Amount: "0.001"}}
+	if got := trade.LedgerEntries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("LedgerEntries() = %v, want %v", got, want)
+	}
+
+	// Trades in a batch contribute all their legs
+	batch.Entries = append(batch.Entries, trade)
+	want = []LedgerEntry{
+		{User: "user1", Asset: "BTC", Amount: "1"},
+		{User: "user2", Asset: "ETH", Amount: "-2"},
+		{User: "user1", Asset: "USDT", Amount: "-100"},
+		{User: "user1", Asset: "BTC", Amount: "0.001"},
+	}
+	if got := batch.LedgerEntries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("LedgerEntries() = %v, want %v", got, want)
+	}
+}
+
+func TestWebhookRequest_LedgerEntries_Labels(t *testing.T) {
+	batch := WebhookRequest{
+		Labels: map[string]string{"campaign": "airdrop", "region": "eu"},
+		Entries: []WebhookRequest{
+			{User: "user1", Asset: "BTC", Amount: "1"},
+			{User: "user2", Asset: "ETH", Amount: "2", Labels: map[string]string{"region": "us"}},
+		},
+	}
+	want := []LedgerEntry{
+		{User: "user1", Asset: "BTC", Amount: "1", Labels: "campaign=airdrop,region=eu"},
+		{User: "user2", Asset: "ETH", Amount: "2", Labels: "campaign=airdrop,region=us"},
+	}
+	if got := batch.LedgerEntries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("LedgerEntries() = %v, want %v", got, want)
+	}
+	// Merging must not leak into the request
+	if len(batch.Entries[1].Labels) != 1 {
+		t.Errorf("item labels = %v, want them unchanged", batch.Entries[1].Labels)
+	}
+
+	trade := WebhookRequest{User: "user1", Labels: map[string]string{"desk": "otc"}, Legs: []Leg{
+		{Asset: "USDT", Amount: "-100"},
+		{Asset: "BTC", Amount: "0.001"},
+	}}
+	for _, entry := range trade.LedgerEntries() {
+		if entry.Labels != "desk=otc" {
+			t.Errorf("leg %s labels = %q, want desk=otc", entry.Asset, entry.Labels)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package port
+
+import (
+	"context"
+
+	"kii.com/internal/domain/entity"
+)
+
+// AnomalyDetector is the port for spotting suspicious ledger entries, such
+// as an amount far above a user's usual ones or a sudden burst of entries.
+// It is asked about every new entry before it is applied; entries approved
+// after being held are not inspected again. Only entries that were applied
+// are recorded, so rejected, held and failed ones never become part of what
+// is usual.
+type AnomalyDetector interface {
+	// Inspect returns why entry looks suspicious, or an empty reason if it
+	// may be applied
+	Inspect(ctx context.Context, entry entity.LedgerEntry) (reason string, err error)
+	// Record adds entry, which was applied, to the history later entries
+	// are inspected against
+	Record(ctx context.Context, entry entity.LedgerEntry)
+}
@@ -0,0 +1,47 @@
+package port
+
+import (
+	"context"
+	"sync"
+
+	"kii.com/internal/domain/entity"
+)
+
+// appliedEntriesKey is the context key of the AppliedEntries of a write
+type appliedEntriesKey struct{}
+
+// AppliedEntries collects the entries applied by a write as the repository
+// numbered them, with their Sequence, UserSequence and AppliedAt, so the
+// writer learns them through any repositories wrapping the one that applied
+// them. Repositories that number entries record each one they apply with
+// RecordApplied, under the context of the write.
+type AppliedEntries struct {
+	mu      sync.Mutex
+	entries []entity.LedgerEntry
+}
+
+// WithAppliedEntries returns a context under which the entries applied by
+// repositories are recorded in the returned AppliedEntries
+func WithAppliedEntries(ctx context.Context) (context.Context, *AppliedEntries) {
+	applied := &AppliedEntries{}
+	return context.WithValue(ctx, appliedEntriesKey{}, applied), applied
+}
+
+// RecordApplied records entries, applied under ctx, if ctx collects them
+func RecordApplied(ctx context.Context, entries ...entity.LedgerEntry) {
+	applied, ok := ctx.Value(appliedEntriesKey{}).(*AppliedEntries)
+	if !ok {
+		return
+	}
+	applied.mu.Lock()
+	defer applied.mu.Unlock()
+	applied.entries = append(applied.entries, entries...)
+}
+
+// Entries returns the entries recorded so far, in the order they were
+// applied
+func (a *AppliedEntries) Entries() []entity.LedgerEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]entity.LedgerEntry(nil), a.entries...)
+}
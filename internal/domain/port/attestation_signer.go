@@ -0,0 +1,8 @@
+package port
+
+// AttestationSigner is the port for signing balance attestations, so third
+// parties holding the service's public key can verify them offline
+type AttestationSigner interface {
+	// Sign returns payload signed as a JWS in compact serialization
+	Sign(payload []byte) (string, error)
+}
@@ -0,0 +1,10 @@
+package port
+
+import "time"
+
+// Clock is the port for reading the current time, so that time-dependent
+// checks such as timestamp tolerance and nonce expiry can be tested without
+// sleeping
+type Clock interface {
+	Now() time.Time
+}
@@ -0,0 +1,15 @@
+package port
+
+import "time"
+
+// DuplicateStore is the port for the webhooks seen recently, by a digest of
+// their content, to catch senders re-posting an event under a fresh nonce
+type DuplicateStore interface {
+	// Record records key as seen at the given time. If it was already seen
+	// within the store's window, it returns when and true, keeping the
+	// earlier record.
+	Record(key string, at time.Time) (first time.Time, seen bool)
+	// Forget removes key, for a webhook that was not applied after all or
+	// one an operator lets through again, reporting whether it was recorded
+	Forget(key string) bool
+}
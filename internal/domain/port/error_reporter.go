@@ -0,0 +1,10 @@
+package port
+
+import "context"
+
+// ErrorReporter is the port for shipping errors to an external error tracker
+type ErrorReporter interface {
+	// ReportError reports err with the request context carried by ctx and
+	// optional key/value attributes
+	ReportError(ctx context.Context, err error, attrs ...any)
+}
@@ -0,0 +1,15 @@
+package port
+
+import (
+	"context"
+
+	"kii.com/internal/domain/entity"
+)
+
+// EventPublisher is the port for announcing applied ledger entries. It is
+// called once the entry is applied, so Publish must not block on a slow
+// consumer and reports no error: publishers that can fail handle it
+// themselves.
+type EventPublisher interface {
+	Publish(ctx context.Context, event entity.BalanceEvent)
+}
@@ -0,0 +1,16 @@
+package port
+
+import "kii.com/internal/domain/entity"
+
+// AssetFreezeStore is the port for the assets whose webhooks are paused.
+// Assets are matched regardless of case.
+type AssetFreezeStore interface {
+	// Frozen returns the freeze of asset, if it is frozen
+	Frozen(asset string) (entity.AssetFreeze, bool)
+	// Freeze freezes freeze.Asset, replacing an earlier freeze of it
+	Freeze(freeze entity.AssetFreeze) error
+	// Unfreeze lets asset be processed again, reporting whether it was frozen
+	Unfreeze(asset string) (bool, error)
+	// List returns the frozen assets, by name
+	List() []entity.AssetFreeze
+}
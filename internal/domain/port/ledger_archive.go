@@ -0,0 +1,21 @@
+package port
+
+import (
+	"context"
+
+	"kii.com/internal/domain/entity"
+)
+
+// LedgerArchive is the port for the long-term storage of entries pruned from
+// the ledger, kept so they can be restored for audits
+type LedgerArchive interface {
+	// Store saves entries, in sequence order, as a new segment and returns
+	// its name. The entries are removed from the ledger once it returns.
+	Store(ctx context.Context, entries []entity.LedgerEntry) (string, error)
+	// Segments returns the names of the stored segments in sequence order
+	Segments(ctx context.Context) ([]string, error)
+	// EachEntry calls fn for each entry of the named segment, in sequence
+	// order, stopping at the first error returned by fn. It returns
+	// entity.ErrSegmentNotFound for an unknown segment.
+	EachEntry(ctx context.Context, segment string, fn func(entity.LedgerEntry) error) error
+}
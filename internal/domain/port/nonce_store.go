@@ -0,0 +1,25 @@
+package port
+
+import (
+	"time"
+
+	"kii.com/internal/domain/entity"
+)
+
+// NonceStore is the port for replay-protection nonce tracking. Nonces are
+// unique per tenant, i.e. per webhook source, so independent senders may use
+// the same nonce.
+type NonceStore interface {
+	// IsValid checks if a nonce is valid (not seen before from tenant) and
+	// records it
+	IsValid(tenant, nonce string, timestamp time.Time) bool
+	// List returns up to limit tracked nonces of every tenant starting with
+	// prefix, newest first
+	List(prefix string, limit int) []entity.NonceRecord
+	// Delete forgets a nonce of tenant, reporting whether it was tracked
+	Delete(tenant, nonce string) bool
+	// Purge forgets all nonces and returns how many were removed
+	Purge() int
+	// Len returns the number of tracked nonces
+	Len() int
+}
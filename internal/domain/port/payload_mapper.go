@@ -0,0 +1,9 @@
+package port
+
+import "kii.com/internal/domain/entity"
+
+// PayloadMapper is the port for converting a sender's payload into a webhook
+// request, so senders with their own payload shape can be onboarded
+type PayloadMapper interface {
+	Map(body []byte) (entity.WebhookRequest, error)
+}
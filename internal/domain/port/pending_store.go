@@ -0,0 +1,16 @@
+package port
+
+import "kii.com/internal/domain/entity"
+
+// PendingEntryStore is the port for ledger entries awaiting approval
+type PendingEntryStore interface {
+	// Add parks an entry until it is approved, rejected or expires
+	Add(entry entity.PendingEntry) error
+	// Get returns the pending entry with id
+	Get(id string) (entity.PendingEntry, bool)
+	// Delete removes a pending entry, reporting whether it was pending. Of
+	// two concurrent deletes of the same entry only one succeeds.
+	Delete(id string) bool
+	// List returns the pending entries, oldest first
+	List() []entity.PendingEntry
+}
@@ -2,6 +2,7 @@ package port
 
 import (
 	"context"
+	"time"
 
 	"kii.com/internal/domain/entity"
 )
@@ -11,3 +12,79 @@ type LedgerRepository interface {
 	AddEntry(ctx context.Context, entry entity.LedgerEntry) error
 	GetBalance(ctx context.Context, user string) (*entity.BalanceResponse, error)
 }
+
+// BatchLedgerRepository is implemented by ledger repositories that can apply
+// several entries in one transaction
+type BatchLedgerRepository interface {
+	LedgerRepository
+	// AddEntries applies all entries or none of them
+	AddEntries(ctx context.Context, entries []entity.LedgerEntry) error
+}
+
+// UnitOfWork runs use case steps that touch several accounts as one
+// transaction, whatever the storage backend
+type UnitOfWork interface {
+	// Do calls fn with a repository whose entries are applied together once
+	// fn returns nil, and not at all if it returns an error or the commit
+	// fails. Balances read through tx include the entries added before.
+	Do(ctx context.Context, fn func(tx LedgerRepository) error) error
+}
+
+// LedgerHistoryRepository is implemented by ledger repositories that can
+// list the entries they hold
+type LedgerHistoryRepository interface {
+	// EachEntry calls fn for each entry of user with a sequence above after,
+	// in sequence order, or for every such entry when user is empty. Entries
+	// carry their sequences, so a listing cut short can resume after the
+	// last one seen. It stops at the first error returned by fn.
+	EachEntry(ctx context.Context, user string, after uint64, fn func(entity.LedgerEntry) error) error
+}
+
+// LedgerCompactor is implemented by ledger repositories that can drop state
+// no longer needed, keeping their footprint bounded
+type LedgerCompactor interface {
+	// Compact removes zero balances, and archives the users without entries
+	// since idleSince: archive is called with each user's entries, which are
+	// then dropped from the history. Users left without balances are removed
+	// altogether. A zero idleSince archives no users.
+	Compact(ctx context.Context, idleSince time.Time, archive func(entity.ArchivedUser) error) (entity.CompactionResult, error)
+}
+
+// LedgerPruner is implemented by ledger repositories that can move old
+// entries out of the primary store
+type LedgerPruner interface {
+	// Prune calls archive once with every entry applied before before, in
+	// sequence order, and removes them from the history once it returns
+	// nil. Balances and the numbering of later entries are unchanged. It
+	// returns the number of entries removed, without calling archive when
+	// there are none.
+	Prune(ctx context.Context, before time.Time, archive func([]entity.LedgerEntry) error) (int, error)
+}
+
+// LedgerHoldingsRepository is implemented by ledger repositories that keep
+// balances indexed by asset, so that holders can be ranked without reading
+// every user's balance
+type LedgerHoldingsRepository interface {
+	// TopHolders returns up to n users with a positive balance of asset,
+	// largest first, ties in user order
+	TopHolders(ctx context.Context, asset string, n int) ([]entity.Holder, error)
+	// BalanceDistributions returns the distribution of asset's balances, or
+	// of every asset's in asset order when asset is empty. Assets nobody
+	// holds are left out.
+	BalanceDistributions(ctx context.Context, asset string) ([]entity.BalanceDistribution, error)
+}
+
+// LedgerHoldRepository is implemented by ledger repositories that can set
+// funds aside, reporting the held and available amounts in GetBalance
+type LedgerHoldRepository interface {
+	// PlaceHold sets hold aside, replacing a hold with the same ID
+	PlaceHold(ctx context.Context, hold entity.Hold) error
+	// ReleaseHold drops the hold id, reporting whether it was held and had
+	// not expired
+	ReleaseHold(ctx context.Context, id string) (bool, error)
+	// CaptureHold applies entry and drops the hold id in one step, so the
+	// amount is never counted both as held and as applied. entry is applied
+	// even if the hold has expired or was released; while it is held, it
+	// must be for the hold's user.
+	CaptureHold(ctx context.Context, id string, entry entity.LedgerEntry) error
+}
@@ -0,0 +1,9 @@
+package port
+
+// SharedStore is implemented by stores that keep their state outside the
+// process, so every replica running in cluster mode sees the same data.
+// Stores that do not implement it are treated as in-memory.
+type SharedStore interface {
+	// Shared reports whether the store's state lives outside the process
+	Shared() bool
+}
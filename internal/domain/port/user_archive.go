@@ -0,0 +1,15 @@
+package port
+
+import (
+	"context"
+
+	"kii.com/internal/domain/entity"
+)
+
+// UserArchive is the port for keeping the history of idle users removed
+// from the ledger by compaction
+type UserArchive interface {
+	// Archive stores user durably; its entries are dropped from the ledger
+	// once it returns
+	Archive(ctx context.Context, user entity.ArchivedUser) error
+}
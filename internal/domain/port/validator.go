@@ -2,6 +2,7 @@ package port
 
 import (
 	"context"
+	"io"
 	"net/http"
 )
 
@@ -9,3 +10,27 @@ import (
 type WebhookValidator interface {
 	ValidateRequest(ctx context.Context, r *http.Request, body []byte) error
 }
+
+// StreamingWebhookValidator is a WebhookValidator that signs the body while it
+// is read, instead of going over it again once it is buffered
+type StreamingWebhookValidator interface {
+	WebhookValidator
+	// BeginRequest checks the headers of r before its body is read, so that a
+	// request that cannot be valid is rejected without reading it
+	BeginRequest(ctx context.Context, r *http.Request) (BodyVerifier, error)
+}
+
+// NonceReleaser is implemented by validators that record the nonce of each
+// request they accept. ReleaseNonce forgets the nonce of r, a request they
+// accepted, so that a webhook that was not applied can be retried as sent.
+type NonceReleaser interface {
+	ReleaseNonce(r *http.Request)
+}
+
+// BodyVerifier is written a request's body as it is read. Once the whole body
+// is written, Verify validates the request as ValidateRequest would; body is
+// what was written.
+type BodyVerifier interface {
+	io.Writer
+	Verify(ctx context.Context, body []byte) error
+}
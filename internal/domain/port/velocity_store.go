@@ -0,0 +1,17 @@
+package port
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// VelocityStore is the port for the credits counted against per-user
+// velocity limits
+type VelocityStore interface {
+	// Add records amount credited to user in asset at the given time. A
+	// negative amount reverses an earlier credit.
+	Add(user, asset string, amount decimal.Decimal, at time.Time)
+	// Sum returns the total credited to user in asset since the given time
+	Sum(user, asset string, since time.Time) decimal.Decimal
+}
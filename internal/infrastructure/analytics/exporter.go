@@ -0,0 +1,179 @@
+// Package analytics exports the entries applied to the ledger to a data
+// warehouse, as gzip-compressed CSV files in object storage that analysts
+// load or query in place instead of reading the production store.
+package analytics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"time"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/infrastructure/archive"
+	"kii.com/internal/infrastructure/config"
+	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/metrics"
+	"kii.com/internal/infrastructure/queue"
+)
+
+// Export results, tagged on the analytics.rows counter
+const (
+	ResultExported = "exported"
+	ResultDropped  = "dropped"
+)
+
+// fileTimeFormat is the format of the time in file names, which sorts in
+// time order
+const fileTimeFormat = "20060102T150405Z"
+
+// header is the first row of every file
+var header = []string{"id", "source", "batch", "user", "asset", "amount", "applied_at"}
+
+// Exporter collects balance events and writes those collected every interval
+// as one file to an object store. Files that fail to upload are retried with
+// the next one. Up to MaxRows events are collected for the next file and up
+// to MaxRows more wait to be collected; events published beyond that are
+// dropped, so an unavailable store never holds up the ledger.
+type Exporter struct {
+	store    archive.ObjectStore
+	interval time.Duration
+	maxRows  int
+	queue    *queue.Queue[entity.BalanceEvent]
+	metrics  metrics.Emitter
+	logger   logger.Logger
+
+	// rows are the events collected for the next file. They are only used
+	// by the queue's worker.
+	rows []entity.BalanceEvent
+}
+
+// NewExporter starts exporting to store every cfg.Interval
+func NewExporter(store archive.ObjectStore, cfg config.Analytics, emitter metrics.Emitter, logger logger.Logger) (*Exporter, error) {
+	if cfg.Interval <= 0 {
+		return nil, fmt.Errorf("analytics.interval must be positive")
+	}
+	if cfg.MaxRows < 1 {
+		return nil, fmt.Errorf("analytics.maxRows must be positive")
+	}
+	e := &Exporter{
+		store:    store,
+		interval: cfg.Interval,
+		maxRows:  cfg.MaxRows,
+		metrics:  emitter,
+		logger:   logger,
+	}
+	e.queue = queue.New(cfg.MaxRows, 1, e.run)
+	return e, nil
+}
+
+// Publish queues event for the next file. It never blocks on the store.
+func (e *Exporter) Publish(_ context.Context, event entity.BalanceEvent) {
+	if errors.Is(e.queue.Push(event), queue.ErrFull) {
+		e.metrics.Count("analytics.rows", 1, "result:"+ResultDropped)
+	}
+}
+
+// QueueLength returns the number of events waiting to be collected
+func (e *Exporter) QueueLength() int {
+	return e.queue.Len()
+}
+
+// QueueCapacity returns the number of events that can wait to be collected
+// before more are dropped
+func (e *Exporter) QueueCapacity() int {
+	return e.queue.Cap()
+}
+
+// run collects events and exports them every interval until the exporter
+// is closed, then exports the events left
+func (e *Exporter) run(ctx context.Context, events <-chan entity.BalanceEvent) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				e.export(context.WithoutCancel(ctx))
+				if len(e.rows) > 0 {
+					e.metrics.Count("analytics.rows", int64(len(e.rows)), "result:"+ResultDropped)
+					e.rows = nil
+				}
+				return
+			}
+			if len(e.rows) >= e.maxRows {
+				e.metrics.Count("analytics.rows", 1, "result:"+ResultDropped)
+				continue
+			}
+			e.rows = append(e.rows, event)
+		case <-ticker.C:
+			e.export(context.WithoutCancel(ctx))
+		}
+	}
+}
+
+// export writes the collected events as one file. When that fails they are
+// kept, ahead of those collected meanwhile, for the next file.
+func (e *Exporter) export(ctx context.Context) {
+	rows := e.rows
+	if len(rows) == 0 {
+		return
+	}
+
+	name := fmt.Sprintf("balances-%s-%s.csv.gz", rows[0].AppliedAt.UTC().Format(fileTimeFormat), rows[0].ID)
+	body, err := encode(rows)
+	if err == nil {
+		err = e.store.Put(ctx, name, body)
+	}
+	if err != nil {
+		e.logger.LogWarning(ctx, "Failed to export balance events",
+			"file", name,
+			"rows", len(rows),
+			"error", err.Error())
+		return
+	}
+	e.rows = nil
+	e.metrics.Count("analytics.rows", int64(len(rows)), "result:"+ResultExported)
+	e.logger.LogDebug(ctx, "Exported balance events", "file", name, "rows", len(rows))
+}
+
+// encode writes rows as gzip-compressed CSV with a header
+func encode(rows []entity.BalanceEvent) ([]byte, error) {
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	w := csv.NewWriter(zw)
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		record := []string{
+			row.ID,
+			row.Source,
+			row.Batch,
+			row.User,
+			row.Asset,
+			row.Amount,
+			row.AppliedAt.UTC().Format(time.RFC3339Nano),
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// Close stops the exporter after writing the events left, which are lost
+// when that fails
+func (e *Exporter) Close() {
+	e.queue.Close()
+}
@@ -0,0 +1,216 @@
+package analytics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/infrastructure/config"
+	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/metrics"
+)
+
+// memoryStore is an object store in memory that fails uploads while down
+type memoryStore struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	down     bool
+	failures int
+}
+
+func (s *memoryStore) Put(_ context.Context, name string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		s.failures++
+		return errors.New("store unavailable")
+	}
+	if s.objects == nil {
+		s.objects = make(map[string][]byte)
+	}
+	s.objects[name] = body
+	return nil
+}
+
+func (s *memoryStore) Get(context.Context, string) (io.ReadCloser, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *memoryStore) List(context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for name := range s.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *memoryStore) failed() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failures
+}
+
+func (s *memoryStore) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+// rows decodes the object name
+func (s *memoryStore) rows(t *testing.T, name string) [][]string {
+	t.Helper()
+	s.mu.Lock()
+	body := s.objects[name]
+	s.mu.Unlock()
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("gzip.NewReader(%s) error = %v", name, err)
+	}
+	rows, err := csv.NewReader(zr).ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll(%s) error = %v", name, err)
+	}
+	return rows
+}
+
+// countingEmitter records each counter increment with its tags
+type countingEmitter struct {
+	metrics.NopEmitter
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (e *countingEmitter) Count(name string, value int64, tags ...string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.counts == nil {
+		e.counts = make(map[string]int64)
+	}
+	e.counts[name+" "+strings.Join(tags, ",")] += value
+}
+
+func (e *countingEmitter) count(key string) int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.counts[key]
+}
+
+func event(id, user, amount string) entity.BalanceEvent {
+	return entity.BalanceEvent{
+		ID:        id,
+		Source:    "default",
+		User:      user,
+		Asset:     "BTC",
+		Amount:    amount,
+		AppliedAt: time.Date(2026, 10, 15, 12, 0, 0, 500_000_000, time.UTC),
+	}
+}
+
+func TestExporter_Export(t *testing.T) {
+	store := &memoryStore{}
+	emitter := &countingEmitter{}
+	exporter, err := NewExporter(store, config.Analytics{Interval: 10 * time.Millisecond, MaxRows: 100}, emitter, logger.NewLogger())
+	if err != nil {
+		t.Fatalf("NewExporter() error = %v", err)
+	}
+	defer exporter.Close()
+
+	first := event("event-1", "user1", "1.5")
+	second := event("event-2", "user2", "-0.25")
+	second.Source = ""
+	second.Batch = "batch-1"
+	exporter.Publish(context.Background(), first)
+	exporter.Publish(context.Background(), second)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for emitter.count("analytics.rows result:exported") < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	names, _ := store.List(context.Background())
+	if len(names) != 1 || names[0] != "balances-20261015T120000Z-event-1.csv.gz" {
+		t.Fatalf("stored %v, want one file named after the first event", names)
+	}
+	want := [][]string{
+		{"id", "source", "batch", "user", "asset", "amount", "applied_at"},
+		{"event-1", "default", "", "user1", "BTC", "1.5", "2026-10-15T12:00:00.5Z"},
+		{"event-2", "", "batch-1", "user2", "BTC", "-0.25", "2026-10-15T12:00:00.5Z"},
+	}
+	got := store.rows(t, names[0])
+	if len(got) != len(want) {
+		t.Fatalf("file holds %v, want %v", got, want)
+	}
+	for i := range want {
+		if strings.Join(got[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("row %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestExporter_RetriesAndDrops(t *testing.T) {
+	store := &memoryStore{down: true}
+	emitter := &countingEmitter{}
+	exporter, err := NewExporter(store, config.Analytics{Interval: 5 * time.Millisecond, MaxRows: 2}, emitter, logger.NewLogger())
+	if err != nil {
+		t.Fatalf("NewExporter() error = %v", err)
+	}
+	for i, user := range []string{"user1", "user2", "user3"} {
+		exporter.Publish(context.Background(), event(fmt.Sprintf("event-%d", i+1), user, "1"))
+	}
+
+	// A failed upload keeps the events for the next file, and events beyond
+	// MaxRows are dropped
+	deadline := time.Now().Add(5 * time.Second)
+	for (store.failed() == 0 || emitter.count("analytics.rows result:dropped") == 0) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := emitter.count("analytics.rows result:dropped"); got != 1 {
+		t.Errorf("dropped %d events while full, want 1", got)
+	}
+	store.setDown(false)
+	exporter.Close()
+
+	names, _ := store.List(context.Background())
+	if len(names) != 1 {
+		t.Fatalf("stored %v, want one file", names)
+	}
+	if rows := store.rows(t, names[0]); len(rows) != 3 || rows[1][0] != "event-1" || rows[2][0] != "event-2" {
+		t.Errorf("file holds %v, want the first two events", rows)
+	}
+	if got := emitter.count("analytics.rows result:exported"); got != 2 {
+		t.Errorf("exported %d events, want 2", got)
+	}
+
+	// Events published after Close are ignored
+	exporter.Publish(context.Background(), event("event-4", "user1", "1"))
+	exporter.Close()
+}
+
+func TestNewExporter_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Analytics
+	}{
+		{name: "no interval", cfg: config.Analytics{MaxRows: 10}},
+		{name: "no rows", cfg: config.Analytics{Interval: time.Minute}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewExporter(&memoryStore{}, tt.cfg, metrics.NopEmitter{}, logger.NewLogger()); err == nil {
+				t.Error("NewExporter() error = nil, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Package anomaly provides the built-in AnomalyDetector, which holds back
+// credits far above a user's usual amounts and bursts of entries.
+package anomaly
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+)
+
+// Rules configures what the Detector finds suspicious. A credit more than
+// AmountFactor times the user's average credit in the asset is suspicious
+// once MinHistory credits have been seen; a zero AmountFactor disables the
+// check. More than BurstCount entries of a user within BurstWindow are
+// suspicious; a zero BurstCount disables the check.
+type Rules struct {
+	AmountFactor decimal.Decimal
+	MinHistory   int
+	BurstCount   int
+	BurstWindow  time.Duration
+}
+
+// history is the credits seen for a user in an asset
+type history struct {
+	count int64
+	total decimal.Decimal
+}
+
+// Detector implements the AnomalyDetector port from the entries recorded as
+// applied, keeping its history in memory
+type Detector struct {
+	mu      sync.Mutex
+	rules   Rules
+	clock   port.Clock
+	credits map[string]*history
+	recent  map[string][]time.Time
+}
+
+// NewDetector creates a detector applying rules
+func NewDetector(rules Rules, clock port.Clock) *Detector {
+	return &Detector{
+		rules:   rules,
+		clock:   clock,
+		credits: make(map[string]*history),
+		recent:  make(map[string][]time.Time),
+	}
+}
+
+// Inspect returns why entry looks suspicious, or an empty reason. Nothing
+// is added to the history until the entry is recorded as applied.
+func (d *Detector) Inspect(_ context.Context, entry entity.LedgerEntry) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.rules.BurstCount > 0 {
+		if count := d.countRecent(entry.User) + 1; count > d.rules.BurstCount {
+			return fmt.Sprintf("burst of %d entries for %s within %s", count, entry.User, d.rules.BurstWindow), nil
+		}
+	}
+
+	amount, err := decimal.NewFromString(entry.Amount)
+	if err != nil || !amount.IsPositive() {
+		return "", nil
+	}
+	h := d.credits[entry.User+"\x00"+entry.Asset]
+	if d.rules.AmountFactor.IsPositive() && h != nil && h.count >= int64(d.rules.MinHistory) {
+		average := h.total.Div(decimal.NewFromInt(h.count))
+		if amount.GreaterThan(average.Mul(d.rules.AmountFactor)) {
+			return fmt.Sprintf("credit of %s %s is more than %s times the average of %s",
+				amount, entry.Asset, d.rules.AmountFactor, average.StringFixed(8)), nil
+		}
+	}
+	return "", nil
+}
+
+// Record adds an applied entry to its user's recent entries and, for a
+// credit, to the user's average in its asset
+func (d *Detector) Record(_ context.Context, entry entity.LedgerEntry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.rules.BurstCount > 0 {
+		d.countRecent(entry.User)
+		d.recent[entry.User] = append(d.recent[entry.User], d.clock.Now())
+	}
+
+	amount, err := decimal.NewFromString(entry.Amount)
+	if err != nil || !amount.IsPositive() {
+		return
+	}
+	key := entry.User + "\x00" + entry.Asset
+	h := d.credits[key]
+	if h == nil {
+		h = &history{}
+		d.credits[key] = h
+	}
+	h.count++
+	h.total = h.total.Add(amount)
+}
+
+// countRecent drops the entries of user that fell out of the burst window
+// and returns how many are left. d.mu must be held.
+func (d *Detector) countRecent(user string) int {
+	cutoff := d.clock.Now().Add(-d.rules.BurstWindow)
+	recent := d.recent[user]
+	expired := 0
+	for expired < len(recent) && !recent[expired].After(cutoff) {
+		expired++
+	}
+	if expired == len(recent) {
+		delete(d.recent, user)
+		return 0
+	}
+	d.recent[user] = recent[expired:]
+	return len(recent) - expired
+}
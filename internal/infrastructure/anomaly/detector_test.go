@@ -0,0 +1,120 @@
+package anomaly
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/infrastructure/clock"
+)
+
+func TestDetector_Amount(t *testing.T) {
+	detector := NewDetector(Rules{AmountFactor: decimal.NewFromInt(10), MinHistory: 3}, clock.NewFake(time.Now()))
+	// inspect applies the entry, as the use case does, unless it is
+	// suspicious
+	inspect := func(user, asset, amount string) string {
+		t.Helper()
+		entry := entity.LedgerEntry{User: user, Asset: asset, Amount: amount}
+		reason, err := detector.Inspect(context.Background(), entry)
+		if err != nil {
+			t.Fatalf("Inspect() error = %v", err)
+		}
+		if reason == "" {
+			detector.Record(context.Background(), entry)
+		}
+		return reason
+	}
+
+	// Nothing is suspicious until the user has enough history
+	for _, amount := range []string{"1", "2", "3"} {
+		if reason := inspect("user1", "BTC", amount); reason != "" {
+			t.Fatalf("Inspect(%s) = %q, want no reason during warm-up", amount, reason)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		user       string
+		asset      string
+		amount     string
+		suspicious bool
+	}{
+		{"at the factor", "user1", "BTC", "20", false},
+		{"above the factor", "user1", "BTC", "100", true},
+		{"debits are not checked", "user1", "BTC", "-1000", false},
+		{"other assets have their own history", "user1", "ETH", "1000", false},
+		{"other users have their own history", "user2", "BTC", "1000", false},
+	}
+	for _, tt := range tests {
+		if reason := inspect(tt.user, tt.asset, tt.amount); (reason != "") != tt.suspicious {
+			t.Errorf("%s: Inspect() = %q, want suspicious %v", tt.name, reason, tt.suspicious)
+		}
+	}
+
+	// The held credit did not raise the average: (1+2+3+20)/4 = 6.5
+	if reason := inspect("user1", "BTC", "66"); reason == "" {
+		t.Error("Inspect(66) found nothing, want the held credit left out of the average")
+	}
+}
+
+func TestDetector_Burst(t *testing.T) {
+	now := clock.NewFake(time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC))
+	detector := NewDetector(Rules{BurstCount: 3, BurstWindow: time.Minute}, now)
+	inspect := func(user string) string {
+		entry := entity.LedgerEntry{User: user, Asset: "BTC", Amount: "1"}
+		reason, _ := detector.Inspect(context.Background(), entry)
+		if reason == "" {
+			detector.Record(context.Background(), entry)
+		}
+		return reason
+	}
+
+	for i := range 3 {
+		if reason := inspect("user1"); reason != "" {
+			t.Fatalf("entry %d: Inspect() = %q, want no reason", i+1, reason)
+		}
+		now.Advance(10 * time.Second)
+	}
+	if reason := inspect("user1"); reason == "" {
+		t.Error("fourth entry within a minute: Inspect() found nothing, want a burst")
+	}
+	if reason := inspect("user2"); reason != "" {
+		t.Errorf("other user: Inspect() = %q, want no reason", reason)
+	}
+
+	now.Advance(time.Minute)
+	if reason := inspect("user1"); reason != "" {
+		t.Errorf("after the window: Inspect() = %q, want no reason", reason)
+	}
+}
+
+func TestDetector_OnlyRecordedEntriesCount(t *testing.T) {
+	now := clock.NewFake(time.Now())
+	detector := NewDetector(Rules{
+		AmountFactor: decimal.NewFromInt(10),
+		MinHistory:   1,
+		BurstCount:   1,
+		BurstWindow:  time.Minute,
+	}, now)
+	ctx := context.Background()
+
+	// Entries inspected but never applied leave no history
+	for range 3 {
+		reason, err := detector.Inspect(ctx, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"})
+		if err != nil || reason != "" {
+			t.Fatalf("Inspect() = %q, %v, want no reason", reason, err)
+		}
+	}
+
+	detector.Record(ctx, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"})
+	if reason, _ := detector.Inspect(ctx, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"}); reason == "" {
+		t.Error("second entry within a minute after one applied: Inspect() found nothing, want a burst")
+	}
+	now.Advance(time.Minute)
+	if reason, _ := detector.Inspect(ctx, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "11"}); reason == "" {
+		t.Error("Inspect(11) found nothing, want it held against the applied credit of 1")
+	}
+}
@@ -0,0 +1,156 @@
+// Package archive keeps entries pruned from the ledger in object storage, as
+// gzip-compressed NDJSON segments in the same format as the ledger export
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/infrastructure/config"
+)
+
+// ErrObjectNotFound is returned by an ObjectStore for a missing object
+var ErrObjectNotFound = errors.New("object not found")
+
+// segmentName matches segment names, which hold the zero-padded sequences
+// of their first and last entries so that they sort in sequence order
+var segmentName = regexp.MustCompile(`^ledger-[0-9]{20}-[0-9]{20}\.ndjson\.gz$`)
+
+// ObjectStore stores named objects
+type ObjectStore interface {
+	// Put stores body as the object name, replacing any existing one
+	Put(ctx context.Context, name string, body []byte) error
+	// Get opens the object name, or returns ErrObjectNotFound
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// List returns the names of all objects
+	List(ctx context.Context) ([]string, error)
+}
+
+// LedgerArchive implements the LedgerArchive port on an ObjectStore
+type LedgerArchive struct {
+	store ObjectStore
+}
+
+// NewLedgerArchive creates a ledger archive keeping segments in store
+func NewLedgerArchive(store ObjectStore) *LedgerArchive {
+	return &LedgerArchive{store: store}
+}
+
+// Open creates a ledger archive for the configured object store backend
+func Open(cfg config.ObjectStore) (*LedgerArchive, error) {
+	store, err := OpenStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewLedgerArchive(store), nil
+}
+
+// OpenStore creates the configured object store backend
+func OpenStore(cfg config.ObjectStore) (ObjectStore, error) {
+	switch cfg.Backend {
+	case "dir":
+		store, err := NewDirStore(cfg.Dir)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case "s3":
+		store, err := NewS3Store(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unsupported object store backend %q (want s3 or dir)", cfg.Backend)
+	}
+}
+
+// Store writes entries as a new segment
+func (a *LedgerArchive) Store(ctx context.Context, entries []entity.LedgerEntry) (string, error) {
+	if len(entries) == 0 {
+		return "", fmt.Errorf("no entries to archive")
+	}
+	name := fmt.Sprintf("ledger-%020d-%020d.ndjson.gz", entries[0].Sequence, entries[len(entries)-1].Sequence)
+
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	encoder := json.NewEncoder(zw)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return "", err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+
+	if err := a.store.Put(ctx, name, body.Bytes()); err != nil {
+		return "", fmt.Errorf("failed to store archive segment %s: %w", name, err)
+	}
+	return name, nil
+}
+
+// Segments lists the stored segments in sequence order, ignoring other
+// objects in the store
+func (a *LedgerArchive) Segments(ctx context.Context) ([]string, error) {
+	names, err := a.store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archive segments: %w", err)
+	}
+	segments := make([]string, 0, len(names))
+	for _, name := range names {
+		if segmentName.MatchString(name) {
+			segments = append(segments, name)
+		}
+	}
+	sort.Strings(segments)
+	return segments, nil
+}
+
+// EachEntry reads the entries of a segment
+func (a *LedgerArchive) EachEntry(ctx context.Context, segment string, fn func(entity.LedgerEntry) error) error {
+	if !segmentName.MatchString(segment) {
+		return entity.ErrSegmentNotFound
+	}
+	body, err := a.store.Get(ctx, segment)
+	if errors.Is(err, ErrObjectNotFound) {
+		return entity.ErrSegmentNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read archive segment %s: %w", segment, err)
+	}
+	defer func() { _ = body.Close() }()
+
+	zr, err := gzip.NewReader(body)
+	if err != nil {
+		return fmt.Errorf("failed to read archive segment %s: %w", segment, err)
+	}
+	return decode(zr, fn)
+}
+
+// decode calls fn for each entry of an uncompressed segment
+func decode(r io.Reader, fn func(entity.LedgerEntry) error) error {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var entry entity.LedgerEntry
+		err := decoder.Decode(&entry)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid archive segment: %w", err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
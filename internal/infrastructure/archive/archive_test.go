@@ -0,0 +1,76 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kii.com/internal/domain/entity"
+)
+
+func TestLedgerArchive(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDirStore(dir)
+	if err != nil {
+		t.Fatalf("NewDirStore() error = %v", err)
+	}
+	archive := NewLedgerArchive(store)
+	ctx := context.Background()
+	appliedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	second := []entity.LedgerEntry{{Sequence: 12, UserSequence: 1, User: "user2", Asset: "ETH", Amount: "2", AppliedAt: appliedAt}}
+	first := []entity.LedgerEntry{
+		{Sequence: 3, UserSequence: 1, User: "user1", Asset: "BTC", Amount: "1.5", AppliedAt: appliedAt},
+		{Sequence: 9, UserSequence: 2, User: "user1", Asset: "BTC", Amount: "-0.5", AppliedAt: appliedAt},
+	}
+	for _, entries := range [][]entity.LedgerEntry{second, first} {
+		if _, err := archive.Store(ctx, entries); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+	}
+	// Other objects sharing the store are not segments
+	_ = os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0o600)
+
+	segments, err := archive.Segments(ctx)
+	if err != nil {
+		t.Fatalf("Segments() error = %v", err)
+	}
+	want := []string{
+		"ledger-00000000000000000003-00000000000000000009.ndjson.gz",
+		"ledger-00000000000000000012-00000000000000000012.ndjson.gz",
+	}
+	if len(segments) != 2 || segments[0] != want[0] || segments[1] != want[1] {
+		t.Fatalf("Segments() = %v, want %v", segments, want)
+	}
+
+	var got []entity.LedgerEntry
+	if err := archive.EachEntry(ctx, segments[0], func(entry entity.LedgerEntry) error {
+		got = append(got, entry)
+		return nil
+	}); err != nil {
+		t.Fatalf("EachEntry() error = %v", err)
+	}
+	if len(got) != 2 || got[0] != first[0] || got[1] != first[1] {
+		t.Errorf("EachEntry() = %+v, want %+v", got, first)
+	}
+
+	tests := []struct {
+		name    string
+		segment string
+	}{
+		{name: "missing segment", segment: "ledger-00000000000000000001-00000000000000000002.ndjson.gz"},
+		{name: "not a segment", segment: "notes.txt"},
+		{name: "path traversal", segment: "../" + want[0]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := archive.EachEntry(ctx, tt.segment, func(entity.LedgerEntry) error { return nil })
+			if !errors.Is(err, entity.ErrSegmentNotFound) {
+				t.Errorf("EachEntry(%q) error = %v, want %v", tt.segment, err, entity.ErrSegmentNotFound)
+			}
+		})
+	}
+}
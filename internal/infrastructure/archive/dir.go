@@ -0,0 +1,76 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DirStore is an ObjectStore keeping each object as a file in a directory
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore creates an object store in dir, creating it if needed
+func NewDirStore(dir string) (*DirStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("objectStore.dir is required for the dir backend")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create object store directory: %w", err)
+	}
+	return &DirStore{dir: dir}, nil
+}
+
+// Put writes the object to a temporary file and renames it into place once
+// synced, so a crash never leaves a partial object
+func (s *DirStore) Put(_ context.Context, name string, body []byte) error {
+	tmp, err := os.CreateTemp(s.dir, "."+name+".*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(body); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+}
+
+// Get opens the object's file
+func (s *DirStore) Get(_ context.Context, name string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(s.dir, filepath.Base(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	return f, err
+}
+
+// List returns the names of the files in the directory, skipping the
+// temporary files of objects being written
+func (s *DirStore) List(_ context.Context) ([]string, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		if file.Type().IsRegular() && !strings.HasPrefix(file.Name(), ".") {
+			names = append(names, file.Name())
+		}
+	}
+	return names, nil
+}
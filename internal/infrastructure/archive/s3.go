@@ -0,0 +1,332 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"kii.com/internal/infrastructure/config"
+)
+
+const (
+	// s3RequestTimeout bounds each request to the object store
+	s3RequestTimeout = time.Minute
+	// sigV4Algorithm is the AWS Signature Version 4 algorithm name
+	sigV4Algorithm = "AWS4-HMAC-SHA256"
+	// sigV4TimeFormat is the format of the x-amz-date header
+	sigV4TimeFormat = "20060102T150405Z"
+)
+
+// Server-side encryption modes of config.ObjectStore.ServerSideEncryption,
+// as S3 names them
+const (
+	sseS3  = "AES256"
+	sseKMS = "aws:kms"
+)
+
+// S3Store is an ObjectStore on the Amazon S3 REST API, signed with AWS
+// Signature Version 4. Objects are addressed path-style, which S3-compatible
+// stores such as Google Cloud Storage's XML API and MinIO also accept.
+type S3Store struct {
+	endpoint        *url.URL
+	region          string
+	bucket          string
+	prefix          string
+	accessKeyID     string
+	secretAccessKey string
+	// putHeaders ask for server-side encryption of uploads; getHeaders
+	// present the customer key on downloads
+	putHeaders http.Header
+	getHeaders http.Header
+	client     *http.Client
+	now        func() time.Time
+}
+
+// NewS3Store creates an object store in the configured bucket. Objects are
+// named by cfg.Prefix followed by the object name.
+func NewS3Store(cfg config.ObjectStore) (*S3Store, error) {
+	if cfg.Bucket == "" || cfg.Region == "" {
+		return nil, fmt.Errorf("objectStore.bucket and region are required for the s3 backend")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, fmt.Errorf("objectStore.accessKeyId and secretAccessKey are required for the s3 backend")
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid objectStore.endpoint %q", cfg.Endpoint)
+	}
+	putHeaders, getHeaders, err := encryptionHeaders(cfg, u)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Store{
+		endpoint:        u,
+		region:          cfg.Region,
+		bucket:          cfg.Bucket,
+		prefix:          cfg.Prefix,
+		accessKeyID:     cfg.AccessKeyID,
+		secretAccessKey: cfg.SecretAccessKey,
+		putHeaders:      putHeaders,
+		getHeaders:      getHeaders,
+		client:          &http.Client{Timeout: s3RequestTimeout},
+		now:             time.Now,
+	}, nil
+}
+
+// encryptionHeaders returns the headers asking the store at endpoint to
+// encrypt uploads as cfg configures, and those reads of them need
+func encryptionHeaders(cfg config.ObjectStore, endpoint *url.URL) (put, get http.Header, err error) {
+	put, get = http.Header{}, http.Header{}
+	switch cfg.ServerSideEncryption {
+	case "":
+	case sseS3, sseKMS:
+		put.Set("X-Amz-Server-Side-Encryption", cfg.ServerSideEncryption)
+	default:
+		return nil, nil, fmt.Errorf("invalid objectStore.serverSideEncryption %q: want %s or %s", cfg.ServerSideEncryption, sseS3, sseKMS)
+	}
+	if cfg.KMSKeyID != "" {
+		if cfg.ServerSideEncryption != sseKMS {
+			return nil, nil, fmt.Errorf("objectStore.kmsKeyId needs serverSideEncryption %s", sseKMS)
+		}
+		put.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", cfg.KMSKeyID)
+	}
+
+	if cfg.CustomerKey == "" {
+		return put, get, nil
+	}
+	if cfg.ServerSideEncryption != "" {
+		return nil, nil, fmt.Errorf("objectStore.customerKey cannot be combined with serverSideEncryption")
+	}
+	// Stores refuse customer keys sent in the clear
+	if endpoint.Scheme != "https" {
+		return nil, nil, fmt.Errorf("objectStore.customerKey needs an https endpoint")
+	}
+	key, err := base64.StdEncoding.DecodeString(cfg.CustomerKey)
+	if err != nil || len(key) != 32 {
+		return nil, nil, fmt.Errorf("objectStore.customerKey must be a base64 256-bit key")
+	}
+	// S3 checks that the key arrived intact against its MD5
+	keyMD5 := md5.Sum(key) //nolint:gosec
+	for _, header := range []http.Header{put, get} {
+		header.Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", sseS3)
+		header.Set("X-Amz-Server-Side-Encryption-Customer-Key", cfg.CustomerKey)
+		header.Set("X-Amz-Server-Side-Encryption-Customer-Key-Md5", base64.StdEncoding.EncodeToString(keyMD5[:]))
+	}
+	return put, get, nil
+}
+
+// Put uploads the object
+func (s *S3Store) Put(ctx context.Context, name string, body []byte) error {
+	resp, err := s.do(ctx, http.MethodPut, s.prefix+name, nil, s.putHeaders, body)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+// Get downloads the object
+func (s *S3Store) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.prefix+name, nil, s.getHeaders, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		_ = resp.Body.Close()
+		return nil, ErrObjectNotFound
+	default:
+		defer func() { _ = resp.Body.Close() }()
+		return nil, s3Error(resp)
+	}
+}
+
+// listBucketResult is the ListObjectsV2 response
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List lists the objects under the prefix, following continuation tokens
+func (s *S3Store) List(ctx context.Context) ([]string, error) {
+	var names []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		if resp.StatusCode != http.StatusOK {
+			err = s3Error(resp)
+		} else {
+			err = xml.NewDecoder(resp.Body).Decode(&result)
+		}
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			names = append(names, strings.TrimPrefix(object.Key, s.prefix))
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return names, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// do sends a signed request with header for key in the bucket, or for the
+// bucket itself when key is empty
+func (s *S3Store) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	s.sign(req, body)
+	return s.client.Do(req)
+}
+
+// sign adds the Signature Version 4 headers to req, signing every header
+// already set on it as well as host, x-amz-date and x-amz-content-sha256
+func (s *S3Store) sign(req *http.Request, body []byte) {
+	now := s.now().UTC()
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	date := now.Format("20060102")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := sigV4Algorithm + "\n" + now.Format(sigV4TimeFormat) + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretAccessKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", sigV4Algorithm+
+		" Credential="+s.accessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+
+		", Signature="+signature)
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query sorted by key, as Signature Version 4 expects
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes every byte of s except unreserved characters,
+// and slashes unless encodeSlash is set
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := range len(s) {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3Error describes an unsuccessful response, including the error code
+// from its XML body when there is one
+func s3Error(resp *http.Response) error {
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body); err == nil && body.Code != "" {
+		return fmt.Errorf("object store returned %d %s: %s", resp.StatusCode, body.Code, body.Message)
+	}
+	return fmt.Errorf("object store returned %d", resp.StatusCode)
+}
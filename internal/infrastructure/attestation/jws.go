@@ -0,0 +1,176 @@
+// Package attestation provides the AttestationSigner port implementation,
+// signing balance attestations as Ed25519 JWS that third parties verify with
+// the service's published public key.
+package attestation
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// algorithm is the JWS algorithm of Ed25519 signatures (RFC 8037)
+const algorithm = "EdDSA"
+
+// ErrInvalidAttestation is returned for attestations that are malformed,
+// signed by an unknown key or whose signature does not match
+var ErrInvalidAttestation = errors.New("invalid attestation")
+
+// JWK is an Ed25519 public key as a JSON Web Key (RFC 8037)
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+// header is the protected JWS header
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Signer implements the AttestationSigner port with an Ed25519 private key
+type Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+// NewSigner creates a Signer for key. Signatures name keyID in their
+// header; an empty keyID defaults to the key's RFC 7638 thumbprint.
+func NewSigner(key ed25519.PrivateKey, keyID string) *Signer {
+	if keyID == "" {
+		keyID = thumbprint(key.Public().(ed25519.PublicKey))
+	}
+	return &Signer{key: key, keyID: keyID}
+}
+
+// LoadSigner creates a Signer for the PEM-encoded PKCS #8 Ed25519 private
+// key in the file at path
+func LoadSigner(path, keyID string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attestation key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("attestation key %s: no PEM block found", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("attestation key %s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("attestation key %s: %T is not an Ed25519 key", path, parsed)
+	}
+	return NewSigner(key, keyID), nil
+}
+
+// GenerateKey returns a new Ed25519 private key, PEM-encoded as PKCS #8
+// for LoadSigner
+func GenerateKey() ([]byte, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// Sign returns payload signed as a JWS in compact serialization
+func (s *Signer) Sign(payload []byte) (string, error) {
+	protected, err := json.Marshal(header{Alg: algorithm, Kid: s.keyID})
+	if err != nil {
+		return "", err
+	}
+	signingInput := encode(protected) + "." + encode(payload)
+	return signingInput + "." + encode(ed25519.Sign(s.key, []byte(signingInput))), nil
+}
+
+// PublicKey returns the public key verifying the Signer's signatures
+func (s *Signer) PublicKey() JWK {
+	return publicJWK(s.key.Public().(ed25519.PublicKey), s.keyID)
+}
+
+// Verify checks the compact JWS token against the key named in its header
+// and returns its payload
+func Verify(token string, keys []JWK) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: want 3 dot-separated parts, got %d", ErrInvalidAttestation, len(parts))
+	}
+	protected, err := decode(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: header: %w", ErrInvalidAttestation, err)
+	}
+	var h header
+	if err := json.Unmarshal(protected, &h); err != nil {
+		return nil, fmt.Errorf("%w: header: %w", ErrInvalidAttestation, err)
+	}
+	if h.Alg != algorithm {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidAttestation, h.Alg)
+	}
+	signature, err := decode(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %w", ErrInvalidAttestation, err)
+	}
+
+	// Several keys may share an ID, e.g. while one is being rotated out
+	known := false
+	for _, key := range keys {
+		if key.Kid != h.Kid || key.Kty != "OKP" || key.Crv != "Ed25519" {
+			continue
+		}
+		known = true
+		publicKey, err := decode(key.X)
+		if err != nil || len(publicKey) != ed25519.PublicKeySize {
+			continue
+		}
+		if !ed25519.Verify(publicKey, []byte(parts[0]+"."+parts[1]), signature) {
+			continue
+		}
+		payload, err := decode(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: payload: %w", ErrInvalidAttestation, err)
+		}
+		return payload, nil
+	}
+	if !known {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidAttestation, h.Kid)
+	}
+	return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidAttestation)
+}
+
+// publicJWK returns key as a JWK named keyID
+func publicJWK(key ed25519.PublicKey, keyID string) JWK {
+	return JWK{Kty: "OKP", Crv: "Ed25519", X: encode(key), Kid: keyID, Alg: algorithm, Use: "sig"}
+}
+
+// thumbprint returns the RFC 7638 thumbprint of key
+func thumbprint(key ed25519.PublicKey) string {
+	// The required members in lexicographic order, without whitespace
+	sum := sha256.Sum256([]byte(`{"crv":"Ed25519","kty":"OKP","x":"` + encode(key) + `"}`))
+	return encode(sum[:])
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,79 @@
+package attestation
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSigner_SignAndVerify(t *testing.T) {
+	keyPEM, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "attestation.pem")
+	if err := os.WriteFile(path, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := LoadSigner(path, "")
+	if err != nil {
+		t.Fatalf("LoadSigner() error = %v", err)
+	}
+	otherPEM, _ := GenerateKey()
+	otherPath := filepath.Join(t.TempDir(), "other.pem")
+	_ = os.WriteFile(otherPath, otherPEM, 0o600)
+	other, _ := LoadSigner(otherPath, signer.PublicKey().Kid)
+
+	payload := []byte(`{"user":"user1","balances":{"BTC":"1.5"}}`)
+	token, err := signer.Sign(payload)
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	parts := strings.Split(token, ".")
+	tampered := parts[0] + "." + encode([]byte(`{"user":"user1","balances":{"BTC":"1500"}}`)) + "." + parts[2]
+
+	tests := []struct {
+		name    string
+		token   string
+		keys    []JWK
+		wantErr bool
+	}{
+		{name: "valid signature", token: token, keys: []JWK{other.PublicKey(), signer.PublicKey()}},
+		{name: "tampered payload", token: tampered, keys: []JWK{signer.PublicKey()}, wantErr: true},
+		{name: "signed by another key", token: token, keys: []JWK{other.PublicKey()}, wantErr: true},
+		{name: "unknown key", token: token, keys: nil, wantErr: true},
+		{name: "malformed", token: "not-a-jws", keys: []JWK{signer.PublicKey()}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Verify(tt.token, tt.keys)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidAttestation) {
+					t.Errorf("Verify() error = %v, want %v", err, ErrInvalidAttestation)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if string(got) != string(payload) {
+				t.Errorf("Verify() = %s, want %s", got, payload)
+			}
+		})
+	}
+}
+
+func TestLoadSigner_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "key.txt")
+	_ = os.WriteFile(notPEM, []byte("secret"), 0o600)
+
+	for _, path := range []string{filepath.Join(dir, "missing.pem"), notPEM} {
+		if _, err := LoadSigner(path, ""); err == nil {
+			t.Errorf("LoadSigner(%s) error = nil, want error", path)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Package audit writes security-relevant events to a dedicated sink,
+// separate from and independent of the application log level.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+	"sync"
+	"time"
+
+	"kii.com/internal/infrastructure/config"
+	"kii.com/internal/infrastructure/logger"
+)
+
+// SchemaVersion is bumped whenever a field of Event changes meaning or is
+// removed. Adding fields or event types does not change it.
+const SchemaVersion = 1
+
+// EventType identifies the kind of audit event
+type EventType string
+
+const (
+	// EventValidationFailed is a webhook rejected by signature validation
+	EventValidationFailed EventType = "webhook.validation_failed"
+	// EventReplayDetected is a webhook rejected for reusing a nonce
+	EventReplayDetected EventType = "webhook.replay_detected"
+	// EventAdminAction is a state-changing call to the admin API
+	EventAdminAction EventType = "admin.action"
+	// EventSecretRotated is a new HMAC secret being written to config or
+	// picked up from a secret file
+	EventSecretRotated EventType = "secret.rotated"
+	// EventEntryParked is a high-value entry parked until it is approved
+	EventEntryParked EventType = "ledger.entry_parked"
+	// EventEntryApproved is a parked entry approved and applied
+	EventEntryApproved EventType = "ledger.entry_approved"
+)
+
+// Event is a single audit record, written as one JSON object per line
+type Event struct {
+	SchemaVersion int               `json:"schema_version"`
+	Time          time.Time         `json:"time"`
+	Type          EventType         `json:"event"`
+	RequestID     string            `json:"request_id,omitempty"`
+	RemoteAddr    string            `json:"remote_addr,omitempty"`
+	Details       map[string]string `json:"details,omitempty"`
+}
+
+// Logger writes audit events to a sink. A nil *Logger discards events, so
+// callers do not need to check whether auditing is enabled.
+type Logger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	logger logger.Logger
+}
+
+// NewLogger creates an audit logger writing to w
+func NewLogger(w io.Writer) *Logger {
+	return &Logger{w: w}
+}
+
+// Open creates an audit logger for the configured sink, reporting events it
+// fails to write to appLogger. It returns a nil *Logger when auditing is
+// disabled.
+func Open(cfg config.Audit, appLogger logger.Logger) (*Logger, error) {
+	switch cfg.Sink {
+	case "":
+		return nil, nil
+	case "file":
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("audit.path is required for the file sink")
+		}
+		f, err := os.OpenFile(cfg.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		return &Logger{w: f, closer: f, logger: appLogger}, nil
+	case "syslog":
+		w, err := syslog.Dial(cfg.SyslogNetwork, cfg.SyslogAddress, syslog.LOG_AUTH|syslog.LOG_NOTICE, "kii")
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		return &Logger{w: w, closer: w, logger: appLogger}, nil
+	default:
+		return nil, fmt.Errorf("unsupported audit sink %q (want file or syslog)", cfg.Sink)
+	}
+}
+
+// Record writes an event, filling in the schema version, time and the request
+// ID from ctx. Write failures are logged rather than returned so that
+// auditing never fails a request.
+func (l *Logger) Record(ctx context.Context, event Event) {
+	if l == nil {
+		return
+	}
+
+	event.SchemaVersion = SchemaVersion
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.RequestID == "" {
+		event.RequestID, _ = ctx.Value("request_id").(string)
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		l.logError(ctx, "Failed to encode audit event", err, event.Type)
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(line); err != nil {
+		l.logError(ctx, "Failed to write audit event", err, event.Type)
+	}
+}
+
+// logError logs a failure to record an event, when l has a logger
+func (l *Logger) logError(ctx context.Context, msg string, err error, eventType EventType) {
+	if l.logger != nil {
+		l.logger.LogError(ctx, msg, err, "event", string(eventType))
+	}
+}
+
+// Close closes the underlying sink
+func (l *Logger) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// Fingerprint returns a short, non-reversible identifier for a secret so
+// rotations can be audited without logging the secret itself
+func Fingerprint(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,71 @@
+// Package clock provides the Clock port implementations: the system clock,
+// an offset clock correcting a host with known skew, and a manually advanced
+// clock for tests.
+package clock
+
+import (
+	"sync"
+	"time"
+
+	"kii.com/internal/domain/port"
+)
+
+// System is the host's wall clock
+type System struct{}
+
+// Now returns the current time
+func (System) Now() time.Time {
+	return time.Now()
+}
+
+// offsetClock is a clock shifted by a fixed offset
+type offsetClock struct {
+	clock  port.Clock
+	offset time.Duration
+}
+
+// WithOffset returns a clock running offset ahead of c, or behind it when
+// offset is negative
+func WithOffset(c port.Clock, offset time.Duration) port.Clock {
+	if offset == 0 {
+		return c
+	}
+	return offsetClock{clock: c, offset: offset}
+}
+
+// Now returns the offset time
+func (c offsetClock) Now() time.Time {
+	return c.clock.Now().Add(c.offset)
+}
+
+// Fake is a clock that only moves when told to. It is safe for concurrent use.
+type Fake struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFake creates a fake clock stopped at now
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the fake clock's time
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Advance moves the fake clock forward by d, or back when d is negative
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+// Set moves the fake clock to now
+func (f *Fake) Set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = now
+}
@@ -0,0 +1,39 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWithOffset(t *testing.T) {
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+
+	tests := []struct {
+		name   string
+		offset time.Duration
+		want   time.Time
+	}{
+		{"ahead", 90 * time.Second, start.Add(90 * time.Second)},
+		{"behind", -time.Minute, start.Add(-time.Minute)},
+		{"no offset", 0, start},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := WithOffset(fake, tt.offset).Now(); !got.Equal(tt.want) {
+				t.Errorf("Now() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The offset clock follows the clock it wraps
+	ahead := WithOffset(fake, time.Second)
+	fake.Advance(time.Hour)
+	if got, want := ahead.Now(), start.Add(time.Hour+time.Second); !got.Equal(want) {
+		t.Errorf("Now() after Advance = %v, want %v", got, want)
+	}
+	fake.Set(start)
+	if got, want := ahead.Now(), start.Add(time.Second); !got.Equal(want) {
+		t.Errorf("Now() after Set = %v, want %v", got, want)
+	}
+}
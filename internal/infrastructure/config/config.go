@@ -1,97 +1,773 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
+	"maps"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/spf13/viper"
 )
 
+// DefaultHMACSecret is the placeholder secret used when none is configured
+const DefaultHMACSecret = "default-secret-key-change-in-production"
+
 // Config holds the application configuration
 type Config struct {
-	Server  Server  `mapstructure:"server"`
-	Webhook Webhook `mapstructure:"webhook"`
+	Server         Server         `mapstructure:"server"`
+	Webhook        Webhook        `mapstructure:"webhook"`
+	Storage        Storage        `mapstructure:"storage"`
+	Admin          Admin          `mapstructure:"admin"`
+	Tracing        Tracing        `mapstructure:"tracing"`
+	Debug          Debug          `mapstructure:"debug"`
+	Audit          Audit          `mapstructure:"audit"`
+	Log            Log            `mapstructure:"log"`
+	ErrorReporting ErrorReporting `mapstructure:"errorReporting"`
+	AccessLog      AccessLog      `mapstructure:"accessLog"`
+	Metrics        Metrics        `mapstructure:"metrics"`
+	Workers        Workers        `mapstructure:"workers"`
+	Cluster        Cluster        `mapstructure:"cluster"`
+	Remote         Remote         `mapstructure:"remote"`
+	Usage          Usage          `mapstructure:"usage"`
+	Approval       Approval       `mapstructure:"approval"`
+	Users          Users          `mapstructure:"users"`
+	Velocity       Velocity       `mapstructure:"velocity"`
+	Duplicates     Duplicates     `mapstructure:"duplicates"`
+	Freezes        Freezes        `mapstructure:"freezes"`
+	Anomaly        Anomaly        `mapstructure:"anomaly"`
+	Attestation    Attestation    `mapstructure:"attestation"`
+	Retention      Retention      `mapstructure:"retention"`
+	Mirror         Mirror         `mapstructure:"mirror"`
+	Events         Events         `mapstructure:"events"`
+	Analytics      Analytics      `mapstructure:"analytics"`
+	Errors         Errors         `mapstructure:"errors"`
+	// Sources are keyed by name; viper lowercases the names
+	Sources map[string]Source `mapstructure:"sources"`
+	// Assets are keyed by asset; viper lowercases them
+	Assets map[string]Asset `mapstructure:"assets"`
 }
 
-// Server configuration
+// Server configuration. MaxConnections caps concurrently open connections
+// on each listener; zero means no limit. ShutdownTimeout bounds how long
+// shutdown waits for queued webhooks and in-flight requests, and
+// HandoverTimeout how long a handover waits for the new process to serve.
+// When UnixSocket is set the server also listens on that path, with
+// UnixSocketMode permissions (octal) and owned by UnixSocketGroup if set;
+// DisableTCP then leaves it as the only listener. With ProxyProtocol, connections from
+// ProxyProtocolSources (IPs or CIDR ranges; any peer when empty) must start
+// with a PROXY protocol header giving the client's address. TCP listeners
+// serve TLS with the certificate and key in TLSCertFile and TLSKeyFile when
+// set. HTTP/2 is negotiated over TLS unless DisableHTTP2; H2C accepts it
+// without TLS too, from clients that know the server speaks it.
+// HTTP2MaxConcurrentStreams caps the requests in flight on one HTTP/2
+// connection.
 type Server struct {
-	Port string `mapstructure:"port"`
+	Port                 string        `mapstructure:"port"`
+	ReadTimeout          time.Duration `mapstructure:"readTimeout"`
+	ReadHeaderTimeout    time.Duration `mapstructure:"readHeaderTimeout"`
+	WriteTimeout         time.Duration `mapstructure:"writeTimeout"`
+	IdleTimeout          time.Duration `mapstructure:"idleTimeout"`
+	MaxHeaderBytes       int           `mapstructure:"maxHeaderBytes"`
+	DisableKeepAlives    bool          `mapstructure:"disableKeepAlives"`
+	MaxConnections       int           `mapstructure:"maxConnections"`
+	ShutdownTimeout      time.Duration `mapstructure:"shutdownTimeout"`
+	HandoverTimeout      time.Duration `mapstructure:"handoverTimeout"`
+	UnixSocket           string        `mapstructure:"unixSocket"`
+	UnixSocketMode       string        `mapstructure:"unixSocketMode"`
+	UnixSocketGroup      string        `mapstructure:"unixSocketGroup"`
+	DisableTCP           bool          `mapstructure:"disableTcp"`
+	ProxyProtocol        bool          `mapstructure:"proxyProtocol"`
+	ProxyProtocolSources []string      `mapstructure:"proxyProtocolSources"`
+	TLSCertFile          string        `mapstructure:"tlsCertFile"`
+	TLSKeyFile           string        `mapstructure:"tlsKeyFile"`
+	DisableHTTP2         bool          `mapstructure:"disableHttp2"`
+	H2C                  bool          `mapstructure:"h2c"`
+	// HTTP2MaxConcurrentStreams is named apart from MaxConnections, which
+	// counts connections rather than the streams multiplexed on each
+	HTTP2MaxConcurrentStreams int `mapstructure:"http2MaxConcurrentStreams"`
 }
 
-// Webhook configuration
+// Webhook configuration. When HMACSecretFile is set, the secret is read
+// from that file instead of HMACSecret, and re-read when the file changes.
+// ClockOffset is added to the system clock when checking timestamps, for a
+// host whose clock is known to be off and cannot be fixed. When
+// NonceStorePath is set, used nonces are saved there on shutdown and
+// restored on startup, so a restart does not reopen the replay window. Used
+// nonces are remembered for the longest timestamp tolerance of the webhook
+// endpoints plus NonceRetentionMargin, after their timestamp.
+// LenientAmounts lets POST /webhook payloads send amounts as JSON numbers as
+// well as strings. MaxBodyBytes caps the body of every webhook endpoint; 0,
+// the default, leaves bodies unbounded.
 type Webhook struct {
-	HMACSecret         string        `mapstructure:"hmacSecret"`
-	TimestampTolerance time.Duration `mapstructure:"timestampTolerance"`
+	HMACSecret           string        `mapstructure:"hmacSecret"`
+	HMACSecretFile       string        `mapstructure:"hmacSecretFile"`
+	TimestampTolerance   time.Duration `mapstructure:"timestampTolerance"`
+	ClockOffset          time.Duration `mapstructure:"clockOffset"`
+	NonceStorePath       string        `mapstructure:"nonceStorePath"`
+	NonceRetentionMargin time.Duration `mapstructure:"nonceRetentionMargin"`
+	LenientAmounts       bool          `mapstructure:"lenientAmounts"`
+	MaxBodyBytes         int64         `mapstructure:"maxBodyBytes"`
+	Canary               Canary        `mapstructure:"canary"`
 }
 
-// LoadConfig loads configuration from YAML file
-// Uses CONFIG_ENV environment variable to determine which config file to load
-func LoadConfig(configDir string) (*Config, error) {
+// Canary configures a candidate validator checked alongside an endpoint's own
+// on every webhook, to try a new Secret (or SecretFile), Scheme,
+// TimestampFormat or Headers before switching to them. Only the endpoint's own
+// verdict counts; the candidate's is counted as webhook.canary and logged where
+// it differs. It is disabled unless a secret is set, and settings left unset
+// are those of the endpoint.
+type Canary struct {
+	Secret          string        `mapstructure:"secret"`
+	SecretFile      string        `mapstructure:"secretFile"`
+	Scheme          string        `mapstructure:"scheme"`
+	TimestampFormat string        `mapstructure:"timestampFormat"`
+	Headers         SourceHeaders `mapstructure:"headers"`
+}
+
+// DefaultSource is the name the unnamed POST /webhook endpoint is reported
+// and configured under, so no source may take it
+const DefaultSource = "default"
+
+// Source configures a webhook sender served at /webhook/<name> with its own
+// secret (or SecretFile), signature Scheme, TimestampFormat (auto, seconds,
+// milliseconds or rfc3339) and TimestampTolerance (defaulting
+// to webhook.timestampTolerance), the Headers and payload Mapping it uses, and
+// the Response its applied webhooks get. Senders that cannot be changed may
+// use Method PUT instead of POST, and be served at a Path of their own as
+// well. Sources are set in config files, remote config or keyed environment
+// variables such as KII_SOURCES_<NAME>_SECRET; use SecretFile to keep
+// secrets out of them. Like webhook.hmacSecretFile, SecretFile is re-read
+// while the server runs.
+type Source struct {
+	Secret             string         `mapstructure:"secret"`
+	SecretFile         string         `mapstructure:"secretFile"`
+	Scheme             string         `mapstructure:"scheme"`
+	TimestampFormat    string         `mapstructure:"timestampFormat"`
+	TimestampTolerance time.Duration  `mapstructure:"timestampTolerance"`
+	Headers            SourceHeaders  `mapstructure:"headers"`
+	Mapping            SourceMapping  `mapstructure:"mapping"`
+	Response           SourceResponse `mapstructure:"response"`
+	Method             string         `mapstructure:"method"`
+	Path               string         `mapstructure:"path"`
+	Canary             Canary         `mapstructure:"canary"`
+}
+
+// SourceHeaders names the request headers carrying the signature inputs
+type SourceHeaders struct {
+	Timestamp string `mapstructure:"timestamp"`
+	Nonce     string `mapstructure:"nonce"`
+	Signature string `mapstructure:"signature"`
+}
+
+// SourceMapping gives the JSON payload fields holding the ledger entry, as
+// dot-separated paths such as "data.account.id" or "data.transfers[0].amount"
+type SourceMapping struct {
+	User   string `mapstructure:"user"`
+	Asset  string `mapstructure:"asset"`
+	Amount string `mapstructure:"amount"`
+}
+
+// SourceResponse replaces the {"status":"ok"} answer to a source's applied
+// webhooks when Status or Body is set. Body is a Go text/template executed
+// with the webhook's Payload, Header, Nonce and Source; ContentType defaults
+// to application/json when Body is set.
+type SourceResponse struct {
+	Status      int    `mapstructure:"status"`
+	ContentType string `mapstructure:"contentType"`
+	Body        string `mapstructure:"body"`
+}
+
+// Env returns the configuration environment from CONFIG_ENV (defaults to "local")
+func Env() string {
 	configEnv := os.Getenv("CONFIG_ENV")
 	if configEnv == "" {
 		configEnv = "local"
 	}
+	return configEnv
+}
 
-	// Load base app-config.yaml as template/defaults (if it exists)
-	baseConfigPath := fmt.Sprintf("%s/app-config.yaml", configDir)
-	baseConfigExists := false
-	if _, err := os.Stat(baseConfigPath); err == nil {
-		viper.SetConfigFile(baseConfigPath)
-		if err := viper.ReadInConfig(); err != nil {
-			return nil, fmt.Errorf("failed to read base config file: %w", err)
-		}
-		baseConfigExists = true
+// Storage configuration. When BatchSize is above 1, ledger writes are
+// grouped into transactions of up to BatchSize entries, each waiting at most
+// BatchWindow for the batch to fill. Each attempt to read a balance is
+// cancelled after ReadTimeout and each write after WriteTimeout.
+type Storage struct {
+	Backend        string         `mapstructure:"backend"`
+	BatchSize      int            `mapstructure:"batchSize"`
+	BatchWindow    time.Duration  `mapstructure:"batchWindow"`
+	ReadTimeout    time.Duration  `mapstructure:"readTimeout"`
+	WriteTimeout   time.Duration  `mapstructure:"writeTimeout"`
+	Shadow         Shadow         `mapstructure:"shadow"`
+	Retry          StorageRetry   `mapstructure:"retry"`
+	CircuitBreaker CircuitBreaker `mapstructure:"circuitBreaker"`
+}
+
+// StorageRetry configuration. Storage operations failing with a transient
+// error are tried up to MaxAttempts times, waiting Backoff before the first
+// retry and twice as long before each further one.
+type StorageRetry struct {
+	MaxAttempts int           `mapstructure:"maxAttempts"`
+	Backoff     time.Duration `mapstructure:"backoff"`
+}
+
+// CircuitBreaker configuration. After FailureThreshold storage operations in
+// a row have failed, operations fail fast for OpenTimeout, then one is let
+// through to see whether the backend is back. Disabled when FailureThreshold
+// is 0.
+type CircuitBreaker struct {
+	FailureThreshold int           `mapstructure:"failureThreshold"`
+	OpenTimeout      time.Duration `mapstructure:"openTimeout"`
+}
+
+// Shadow storage configuration. When Backend is set, ledger writes are
+// mirrored to a second repository of that backend and the balances of the
+// users written are compared every CompareInterval, to verify a new backend
+// before switching to it. Up to QueueSize writes wait to be mirrored.
+type Shadow struct {
+	Backend         string        `mapstructure:"backend"`
+	CompareInterval time.Duration `mapstructure:"compareInterval"`
+	QueueSize       int           `mapstructure:"queueSize"`
+}
+
+// Admin API configuration. The admin API is disabled when Token is empty.
+type Admin struct {
+	Token string `mapstructure:"token"`
+}
+
+// Tracing configuration for OpenTelemetry OTLP/HTTP export
+type Tracing struct {
+	Enabled     bool    `mapstructure:"enabled"`
+	Endpoint    string  `mapstructure:"endpoint"`
+	Insecure    bool    `mapstructure:"insecure"`
+	ServiceName string  `mapstructure:"serviceName"`
+	SampleRatio float64 `mapstructure:"sampleRatio"`
+}
+
+// Debug configuration. When Enabled, pprof and /debug/stats are served behind
+// the admin token. Failed webhooks from CaptureSources (IPs or CIDR ranges)
+// are logged in full with secrets redacted, independently of Enabled. With
+// SignatureHints, signature mismatches from CaptureSources are answered with
+// the bytes the service signed.
+type Debug struct {
+	Enabled        bool     `mapstructure:"enabled"`
+	CaptureSources []string `mapstructure:"captureSources"`
+	SignatureHints bool     `mapstructure:"signatureHints"`
+}
+
+// Mirror configuration. When URL is set, validated webhooks are copied to
+// the same path under URL, e.g. a staging deployment, signed with Secret (or
+// SecretFile) instead of the sender's secret. Up to QueueSize webhooks wait to
+// be sent, each within Timeout; further ones are dropped.
+type Mirror struct {
+	URL        string        `mapstructure:"url"`
+	Secret     string        `mapstructure:"secret"`
+	SecretFile string        `mapstructure:"secretFile"`
+	QueueSize  int           `mapstructure:"queueSize"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+}
+
+// Events configuration. Every entry applied to the ledger is published as a
+// balance event in process and, when Publisher is "kafka" or "nats", to that
+// broker as well. Up to QueueSize events wait to be sent, in batches each
+// within Timeout; further ones are dropped.
+type Events struct {
+	Publisher string        `mapstructure:"publisher"`
+	QueueSize int           `mapstructure:"queueSize"`
+	Timeout   time.Duration `mapstructure:"timeout"`
+	Kafka     KafkaEvents   `mapstructure:"kafka"`
+	NATS      NATSEvents    `mapstructure:"nats"`
+}
+
+// KafkaEvents configures the Kafka publisher, which produces events to Topic
+// through the Kafka REST Proxy at RESTProxyURL, keyed by user
+type KafkaEvents struct {
+	RESTProxyURL string `mapstructure:"restProxyUrl"`
+	Topic        string `mapstructure:"topic"`
+}
+
+// NATSEvents configures the NATS publisher, which publishes events on Subject
+// to the server at URL
+type NATSEvents struct {
+	URL     string `mapstructure:"url"`
+	Subject string `mapstructure:"subject"`
+}
+
+// Analytics configuration for the export of applied entries to a data
+// warehouse. When ObjectStore.Backend is set, balance events are written
+// every Interval as a gzip-compressed CSV file to ObjectStore; up to MaxRows
+// wait for the next file, further ones are dropped.
+type Analytics struct {
+	Interval    time.Duration `mapstructure:"interval"`
+	MaxRows     int           `mapstructure:"maxRows"`
+	ObjectStore ObjectStore   `mapstructure:"objectStore"`
+}
+
+// Audit log configuration. Sink is "file", "syslog" or empty to disable.
+// An empty SyslogAddress uses the local syslog daemon.
+type Audit struct {
+	Sink          string `mapstructure:"sink"`
+	Path          string `mapstructure:"path"`
+	SyslogNetwork string `mapstructure:"syslogNetwork"`
+	SyslogAddress string `mapstructure:"syslogAddress"`
+}
+
+// Log configuration. Level is the startup level (debug, info, warn or error)
+// and can be changed at runtime through the admin API or SIGUSR2. Backend is
+// slog, zap or zerolog and Format is json or text. SampleRate keeps info logs
+// for one in every N webhooks; 0 or 1 logs every webhook.
+type Log struct {
+	Level      string `mapstructure:"level"`
+	Backend    string `mapstructure:"backend"`
+	Format     string `mapstructure:"format"`
+	SampleRate int    `mapstructure:"sampleRate"`
+}
+
+// ErrorReporting configuration. Errors are sent to Sentry when SentryDSN is
+// set. Environment defaults to CONFIG_ENV.
+type ErrorReporting struct {
+	SentryDSN   string  `mapstructure:"sentryDsn"`
+	Environment string  `mapstructure:"environment"`
+	SampleRate  float64 `mapstructure:"sampleRate"`
+}
+
+// AccessLog configuration. Access logs are written to Path in common or
+// combined format; they are disabled when Path is empty.
+type AccessLog struct {
+	Path   string `mapstructure:"path"`
+	Format string `mapstructure:"format"`
+}
+
+// Metrics configuration for pushing metrics to StatsD or DogStatsD. Backend
+// is statsd, dogstatsd or empty to disable; Tags ("key:value") are only sent
+// by dogstatsd.
+type Metrics struct {
+	Backend string   `mapstructure:"backend"`
+	Address string   `mapstructure:"address"`
+	Prefix  string   `mapstructure:"prefix"`
+	Tags    []string `mapstructure:"tags"`
+}
+
+// Workers configuration for the pool that applies webhooks to the ledger.
+// Webhooks arriving while QueueDepth are already waiting are rejected with 503.
+type Workers struct {
+	PoolSize   int `mapstructure:"poolSize"`
+	QueueDepth int `mapstructure:"queueDepth"`
+}
+
+// Usage metering configuration. Monthly usage per tenant is kept in memory
+// and, when Path is set, saved there periodically and at shutdown so it
+// survives restarts.
+type Usage struct {
+	Path string `mapstructure:"path"`
+}
+
+// Approval configuration for high-value entries. Entries whose absolute
+// amount exceeds Threshold (a decimal; empty disables approvals) are parked
+// until a second signed webhook approves them, and dropped if no approval
+// arrives within PendingTTL. With DistinctSources the approval must come from
+// a different webhook source than the entry, i.e. be signed with another key.
+type Approval struct {
+	Threshold       string        `mapstructure:"threshold"`
+	PendingTTL      time.Duration `mapstructure:"pendingTTL"`
+	DistinctSources bool          `mapstructure:"distinctSources"`
+}
+
+// Users configuration for the user identifiers webhooks may use. Identifiers
+// are normalized to Case (preserve, lower or upper), then rejected if longer
+// than MaxLength characters (zero means no limit) or not entirely matching
+// the regular expression Pattern (empty allows any).
+type Users struct {
+	Pattern   string `mapstructure:"pattern"`
+	MaxLength int    `mapstructure:"maxLength"`
+	Case      string `mapstructure:"case"`
+}
+
+// Asset configures the arithmetic of one asset's amounts. Scale is the number
+// of decimal places they are kept at, from 0 to 8 (default 8), and Rounding
+// (half-up, half-even or truncate) how amounts with more decimal places are
+// rounded to it. Assets not configured keep 8 decimal places with half-up
+// rounding. Assets are set in config files, remote config or keyed
+// environment variables such as KII_ASSETS_<NAME>_SCALE.
+type Asset struct {
+	Scale    int    `mapstructure:"scale"`
+	Rounding string `mapstructure:"rounding"`
+}
+
+// Velocity configuration for per-user credit limits. Each rule limits the
+// total credited to a user in Asset (every asset separately when empty)
+// within a sliding Window to MaxCredit, a decimal. Entries over a limit are
+// rejected, or with Action "review" parked for approval like high-value
+// entries. Rules are set in config files or remote config only.
+type Velocity struct {
+	Action string         `mapstructure:"action"`
+	Rules  []VelocityRule `mapstructure:"rules"`
+}
+
+// Duplicates configuration. When Window is set, webhooks with the same
+// source, user, asset, amount and body as one within Window are logged, and
+// with Action "reject" rejected, catching senders that re-post an event under
+// a fresh nonce. Action is "log" or "reject".
+type Duplicates struct {
+	Window time.Duration `mapstructure:"window"`
+	Action string        `mapstructure:"action"`
+}
+
+// Errors configuration for the messages of error responses, which replace
+// the built-in ones by error code, e.g. asset_frozen. Locales holds messages
+// by code for each language tag, such as de or pt-BR, chosen by a client's
+// Accept-Language header; codes without one there use Messages. Viper
+// lowercases the codes and tags, so both are set in config files or remote
+// config only.
+type Errors struct {
+	Messages map[string]string            `mapstructure:"messages"`
+	Locales  map[string]map[string]string `mapstructure:"locales"`
+}
+
+// Freezes configuration. Assets frozen through the admin API are kept in
+// memory and, when Path is set, saved there on every change and restored on
+// startup, so a freeze survives restarts.
+type Freezes struct {
+	Path string `mapstructure:"path"`
+}
+
+// VelocityRule is one velocity limit
+type VelocityRule struct {
+	Asset     string        `mapstructure:"asset"`
+	Window    time.Duration `mapstructure:"window"`
+	MaxCredit string        `mapstructure:"maxCredit"`
+}
+
+// Anomaly configuration for the built-in anomaly detector, which holds
+// suspicious entries for review. A credit more than AmountFactor times the
+// user's average credit in the asset is suspicious once MinHistory credits
+// have been seen, and so are more than BurstCount entries of a user within
+// BurstWindow. Zero AmountFactor or BurstCount disables that check.
+type Anomaly struct {
+	AmountFactor float64       `mapstructure:"amountFactor"`
+	MinHistory   int           `mapstructure:"minHistory"`
+	BurstCount   int           `mapstructure:"burstCount"`
+	BurstWindow  time.Duration `mapstructure:"burstWindow"`
+}
+
+// Attestation configuration for signed balance attestations. KeyFile holds
+// the PEM-encoded PKCS #8 Ed25519 private key signing them; attestations are
+// disabled when it is unset. KeyID names the key in signatures and in the
+// published key set, defaulting to the key's RFC 7638 thumbprint.
+type Attestation struct {
+	KeyFile string `mapstructure:"keyFile"`
+	KeyID   string `mapstructure:"keyId"`
+}
+
+// Retention configuration for the ledger compaction job, which runs every
+// Interval (disabled when zero) and removes zero balances. Users without
+// entries for IdleAfter have their entries moved to ArchivePath, a file of
+// JSON lines, and are removed once they hold no balance; a zero IdleAfter
+// archives no users. Entries applied more than MaxAge ago are moved to
+// compressed segments in ObjectStore; a zero MaxAge prunes none.
+type Retention struct {
+	Interval    time.Duration `mapstructure:"interval"`
+	IdleAfter   time.Duration `mapstructure:"idleAfter"`
+	ArchivePath string        `mapstructure:"archivePath"`
+	MaxAge      time.Duration `mapstructure:"maxAge"`
+	ObjectStore ObjectStore   `mapstructure:"objectStore"`
+}
+
+// ObjectStore configuration for the object storage holding pruned ledger
+// entries. Backend is "s3" for Amazon S3 or an S3-compatible API such as
+// Google Cloud Storage's, addressed as Endpoint/Bucket/Prefix<name> with
+// HMAC keys, or "dir" for files in Dir. An empty Endpoint means Amazon S3 in
+// Region. Objects written to s3 are encrypted by the store as
+// ServerSideEncryption asks, "AES256" or "aws:kms" with KMSKeyID (the
+// bucket's default key when empty), or with CustomerKey, a base64 256-bit key
+// the store does not keep and every read must present again.
+type ObjectStore struct {
+	Backend              string `mapstructure:"backend"`
+	Dir                  string `mapstructure:"dir"`
+	Endpoint             string `mapstructure:"endpoint"`
+	Region               string `mapstructure:"region"`
+	Bucket               string `mapstructure:"bucket"`
+	Prefix               string `mapstructure:"prefix"`
+	AccessKeyID          string `mapstructure:"accessKeyId"`
+	SecretAccessKey      string `mapstructure:"secretAccessKey"`
+	ServerSideEncryption string `mapstructure:"serverSideEncryption"`
+	KMSKeyID             string `mapstructure:"kmsKeyId"`
+	CustomerKey          string `mapstructure:"customerKey"`
+}
+
+// Cluster configuration. In cluster mode several replicas run behind a load
+// balancer, so the server refuses to start with stores that keep their state
+// in process.
+type Cluster struct {
+	Enabled bool `mapstructure:"enabled"`
+}
+
+// LoadOption configures how a configuration is loaded
+type LoadOption func(*loadOptions)
+
+type loadOptions struct {
+	defaults       []byte
+	defaultsFormat string
+	filesOnly      bool
+}
+
+// WithDefaults sets a base config document in format (yaml, toml or json),
+// such as one embedded in the binary, that the config files are merged over
+func WithDefaults(defaults []byte, format string) LoadOption {
+	return func(o *loadOptions) {
+		o.defaults = defaults
+		o.defaultsFormat = format
 	}
+}
 
-	// Load environment-specific config (e.g., local.yaml when CONFIG_ENV=local)
-	envConfigPath := fmt.Sprintf("%s/%s.yaml", configDir, configEnv)
-	if _, err := os.Stat(envConfigPath); err == nil {
-		if baseConfigExists {
-			// Merge environment config on top of base config
-			viper.SetConfigFile(envConfigPath)
-			if err := viper.MergeInConfig(); err != nil {
-				return nil, fmt.Errorf("failed to merge env config file: %w", err)
-			}
-		} else {
-			// If no base config, load environment config directly
-			viper.SetConfigFile(envConfigPath)
-			if err := viper.ReadInConfig(); err != nil {
-				return nil, fmt.Errorf("failed to read env config file: %w", err)
-			}
+// FilesOnly loads the config files and defaults alone, ignoring environment
+// variables and remote config, to tell what the files set apart from what
+// overrides them
+func FilesOnly() LoadOption {
+	return func(o *loadOptions) {
+		o.filesOnly = true
+	}
+}
+
+// LoadConfig loads configuration from YAML file
+// Uses CONFIG_ENV environment variable to determine which config file to load
+func LoadConfig(configDir string, opts ...LoadOption) (*Config, error) {
+	return LoadConfigEnv(configDir, Env(), opts...)
+}
+
+// LoadAll loads one independent configuration per name (e.g. server,
+// consumer, admin) from the given config directories
+func LoadAll(configDirs map[string]string, opts ...LoadOption) (map[string]*Config, error) {
+	configs := make(map[string]*Config, len(configDirs))
+	for name, configDir := range configDirs {
+		cfg, err := LoadConfig(configDir, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("%s config: %w", name, err)
 		}
-	} else if !baseConfigExists {
-		// If neither base nor env config exists, we'll use defaults and env vars
-		// This allows the service to run with just environment variables
+		configs[name] = cfg
 	}
+	return configs, nil
+}
 
-	// Also read from environment variables (with prefix)
-	viper.SetEnvPrefix("KII")
-	viper.AutomaticEnv()
+// LoadConfigEnv loads configuration from configDir for configEnv. Each call
+// reads into its own viper instance, so loads are isolated and may run
+// concurrently.
+func LoadConfigEnv(configDir, configEnv string, opts ...LoadOption) (*Config, error) {
+	var o loadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
 
-	// Bind environment variables
-	viper.BindEnv("server.port", "KII_SERVER_PORT", "PORT")
-	viper.BindEnv("webhook.hmacSecret", "KII_WEBHOOK_HMAC_SECRET", "HMAC_SECRET")
-	viper.BindEnv("webhook.timestampTolerance", "KII_WEBHOOK_TIMESTAMP_TOLERANCE", "TIMESTAMP_TOLERANCE_MINUTES")
+	v, err := readConfigFiles(configDir, configEnv, o)
+	if err != nil {
+		return nil, err
+	}
+	if !o.filesOnly {
+		bindEnv(v)
+		if err := readEnvFiles(v); err != nil {
+			return nil, err
+		}
+		if err := readKeyedEnv(v); err != nil {
+			return nil, err
+		}
+	}
 
 	var cfg Config
-	if err := viper.Unmarshal(&cfg); err != nil {
+	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	// Settings from a remote store sit between the config files and env vars
+	if cfg.Remote.Provider != "" && !o.filesOnly {
+		if err := setRemoteDefaults(&cfg.Remote); err != nil {
+			return nil, err
+		}
+		if err := mergeRemote(v, cfg.Remote); err != nil {
+			return nil, err
+		}
+		cfg = Config{}
+		if err := v.Unmarshal(&cfg); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+		}
+	}
+
+	if cfg.Webhook.HMACSecretFile != "" {
+		secret, err := ReadSecretFile(cfg.Webhook.HMACSecretFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Webhook.HMACSecret = secret
+	}
+	if cfg.Mirror.SecretFile != "" {
+		secret, err := ReadSecretFile(cfg.Mirror.SecretFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Mirror.Secret = secret
+	}
+	if err := setCanaryDefaults(&cfg.Webhook.Canary, "hmac-sha256", "auto",
+		SourceHeaders{Timestamp: "X-Timestamp", Nonce: "X-Nonce", Signature: "X-Signature"}); err != nil {
+		return nil, fmt.Errorf("webhook.canary: %w", err)
+	}
+
 	// Set defaults if not provided
 	if cfg.Server.Port == "" {
 		cfg.Server.Port = "8080"
 	}
+	if cfg.Server.ReadTimeout == 0 {
+		cfg.Server.ReadTimeout = 15 * time.Second
+	}
+	if cfg.Server.ReadHeaderTimeout == 0 {
+		cfg.Server.ReadHeaderTimeout = 5 * time.Second
+	}
+	if cfg.Server.WriteTimeout == 0 {
+		cfg.Server.WriteTimeout = 15 * time.Second
+	}
+	if cfg.Server.IdleTimeout == 0 {
+		cfg.Server.IdleTimeout = 60 * time.Second
+	}
+	if cfg.Server.MaxHeaderBytes == 0 {
+		cfg.Server.MaxHeaderBytes = 1 << 20
+	}
+	if cfg.Server.UnixSocketMode == "" {
+		cfg.Server.UnixSocketMode = "0660"
+	}
+	if cfg.Server.ShutdownTimeout == 0 {
+		cfg.Server.ShutdownTimeout = 30 * time.Second
+	}
+	if cfg.Server.HandoverTimeout == 0 {
+		cfg.Server.HandoverTimeout = 30 * time.Second
+	}
+	if cfg.Server.HTTP2MaxConcurrentStreams == 0 {
+		cfg.Server.HTTP2MaxConcurrentStreams = 250
+	}
 	if cfg.Webhook.HMACSecret == "" {
-		cfg.Webhook.HMACSecret = "default-secret-key-change-in-production"
+		cfg.Webhook.HMACSecret = DefaultHMACSecret
 	}
 	if cfg.Webhook.TimestampTolerance == 0 {
 		cfg.Webhook.TimestampTolerance = 5 * time.Minute
 	}
+	if cfg.Storage.Backend == "" {
+		cfg.Storage.Backend = "memory"
+	}
+	if cfg.Storage.BatchWindow == 0 {
+		cfg.Storage.BatchWindow = 5 * time.Millisecond
+	}
+	if cfg.Storage.ReadTimeout == 0 {
+		cfg.Storage.ReadTimeout = 5 * time.Second
+	}
+	if cfg.Storage.WriteTimeout == 0 {
+		cfg.Storage.WriteTimeout = 5 * time.Second
+	}
+	if cfg.Storage.Retry.Backoff == 0 {
+		cfg.Storage.Retry.Backoff = 50 * time.Millisecond
+	}
+	if cfg.Storage.CircuitBreaker.OpenTimeout == 0 {
+		cfg.Storage.CircuitBreaker.OpenTimeout = 30 * time.Second
+	}
+	if cfg.Storage.Shadow.CompareInterval == 0 {
+		cfg.Storage.Shadow.CompareInterval = time.Minute
+	} else if cfg.Storage.Shadow.CompareInterval < 0 {
+		return nil, fmt.Errorf("storage.shadow.compareInterval must not be negative, got %s", cfg.Storage.Shadow.CompareInterval)
+	}
+	if cfg.Storage.Shadow.QueueSize == 0 {
+		cfg.Storage.Shadow.QueueSize = 1000
+	}
+	if cfg.Duplicates.Action == "" {
+		cfg.Duplicates.Action = "log"
+	}
+	if cfg.Mirror.QueueSize == 0 {
+		cfg.Mirror.QueueSize = 1000
+	}
+	if cfg.Mirror.Timeout == 0 {
+		cfg.Mirror.Timeout = 5 * time.Second
+	}
+	if cfg.Events.QueueSize == 0 {
+		cfg.Events.QueueSize = 1000
+	}
+	if cfg.Events.Timeout == 0 {
+		cfg.Events.Timeout = 5 * time.Second
+	}
+	if cfg.Events.Kafka.Topic == "" {
+		cfg.Events.Kafka.Topic = "kii.balances"
+	}
+	if cfg.Events.NATS.Subject == "" {
+		cfg.Events.NATS.Subject = "kii.balances"
+	}
+	if cfg.Analytics.Interval == 0 {
+		cfg.Analytics.Interval = 5 * time.Minute
+	} else if cfg.Analytics.Interval < 0 {
+		return nil, fmt.Errorf("analytics.interval must not be negative, got %s", cfg.Analytics.Interval)
+	}
+	if cfg.Analytics.MaxRows == 0 {
+		cfg.Analytics.MaxRows = 100000
+	}
+	if cfg.Log.Level == "" {
+		cfg.Log.Level = "info"
+	}
+	if cfg.Log.Backend == "" {
+		cfg.Log.Backend = "slog"
+	}
+	if cfg.Log.Format == "" {
+		cfg.Log.Format = "json"
+	}
+	if cfg.Metrics.Address == "" {
+		cfg.Metrics.Address = "127.0.0.1:8125"
+	}
+	if cfg.Metrics.Prefix == "" {
+		cfg.Metrics.Prefix = "kii."
+	}
+	if cfg.Workers.PoolSize == 0 {
+		cfg.Workers.PoolSize = 16
+	}
+	if cfg.Workers.QueueDepth == 0 {
+		cfg.Workers.QueueDepth = 1024
+	}
+	if cfg.Approval.PendingTTL == 0 {
+		cfg.Approval.PendingTTL = 24 * time.Hour
+	}
+	// An approval signed with the entry's own key proves nothing a leaked
+	// key could not forge, so only an explicit false turns this off
+	if !v.IsSet("approval.distinctSources") {
+		cfg.Approval.DistinctSources = true
+	}
+	if cfg.Anomaly.MinHistory == 0 {
+		cfg.Anomaly.MinHistory = 5
+	}
+	if cfg.Anomaly.BurstWindow == 0 {
+		cfg.Anomaly.BurstWindow = time.Minute
+	}
+	if cfg.Velocity.Action == "" {
+		cfg.Velocity.Action = "reject"
+	}
+	if cfg.Users.Case == "" {
+		cfg.Users.Case = "preserve"
+	}
+	if cfg.AccessLog.Format == "" {
+		cfg.AccessLog.Format = "combined"
+	}
+	if cfg.ErrorReporting.Environment == "" {
+		cfg.ErrorReporting.Environment = configEnv
+	}
+	if cfg.ErrorReporting.SampleRate == 0 {
+		cfg.ErrorReporting.SampleRate = 1
+	}
+	if cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = "kii"
+	}
+	if cfg.Tracing.SampleRatio == 0 {
+		cfg.Tracing.SampleRatio = 1
+	}
+	if err := setRemoteDefaults(&cfg.Remote); err != nil {
+		return nil, err
+	}
 
 	// Handle timestamp tolerance from string (e.g., "5m", "10m")
-	if toleranceStr := viper.GetString("webhook.timestampTolerance"); toleranceStr != "" {
+	if toleranceStr := v.GetString("webhook.timestampTolerance"); toleranceStr != "" {
 		if parsed, err := time.ParseDuration(toleranceStr); err == nil {
 			cfg.Webhook.TimestampTolerance = parsed
 		} else {
@@ -103,5 +779,362 @@ func LoadConfig(configDir string) (*Config, error) {
 		}
 	}
 
+	for name, source := range cfg.Sources {
+		if strings.EqualFold(name, DefaultSource) {
+			return nil, fmt.Errorf("sources.%s: the name %q is reserved for POST /webhook", name, DefaultSource)
+		}
+		if err := setSourceDefaults(&source, cfg.Webhook.TimestampTolerance); err != nil {
+			return nil, fmt.Errorf("sources.%s: %w", name, err)
+		}
+		cfg.Sources[name] = source
+	}
+
+	// A scale of 0 is valid, so only an unset one defaults
+	for name, asset := range cfg.Assets {
+		if !v.IsSet("assets." + name + ".scale") {
+			asset.Scale = 8
+		}
+		if asset.Rounding == "" {
+			asset.Rounding = "half-up"
+		}
+		cfg.Assets[name] = asset
+	}
+
+	// Retention is off at 0, but its ticker cannot run at a negative interval
+	if cfg.Retention.Interval < 0 {
+		return nil, fmt.Errorf("retention.interval must not be negative, got %s", cfg.Retention.Interval)
+	}
+	if err := ValidateSecrets(&cfg); err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 }
+
+// ValidateSecrets rejects a source sharing its secret with another source or
+// with POST /webhook. Nonces are only unique within an endpoint, so a webhook
+// signed for one could be replayed to the other.
+func ValidateSecrets(cfg *Config) error {
+	owners := map[string]string{cfg.Webhook.HMACSecret: "webhook.hmacSecret"}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Sources)) {
+		key := "sources." + name + ".secret"
+		secret := cfg.Sources[name].Secret
+		if owner, ok := owners[secret]; ok {
+			return fmt.Errorf("%s is the same as %s: each endpoint needs its own secret, or webhooks signed for one could be replayed to the other", key, owner)
+		}
+		owners[secret] = key
+	}
+	return nil
+}
+
+// setSourceDefaults reads the secret file of a source and fills in the
+// settings it does not override
+func setSourceDefaults(source *Source, tolerance time.Duration) error {
+	if source.SecretFile != "" {
+		secret, err := ReadSecretFile(source.SecretFile)
+		if err != nil {
+			return err
+		}
+		source.Secret = secret
+	}
+	if source.Secret == "" {
+		return fmt.Errorf("secret or secretFile is required")
+	}
+	if source.Scheme == "" {
+		source.Scheme = "hmac-sha256"
+	}
+	if source.TimestampFormat == "" {
+		source.TimestampFormat = "auto"
+	}
+	if source.TimestampTolerance == 0 {
+		source.TimestampTolerance = tolerance
+	}
+	if source.Headers.Timestamp == "" {
+		source.Headers.Timestamp = "X-Timestamp"
+	}
+	if source.Headers.Nonce == "" {
+		source.Headers.Nonce = "X-Nonce"
+	}
+	if source.Headers.Signature == "" {
+		source.Headers.Signature = "X-Signature"
+	}
+	source.Method = strings.ToUpper(source.Method)
+	if source.Method == "" {
+		source.Method = "POST"
+	}
+	if source.Mapping.User == "" {
+		source.Mapping.User = "user"
+	}
+	if source.Mapping.Asset == "" {
+		source.Mapping.Asset = "asset"
+	}
+	if source.Mapping.Amount == "" {
+		source.Mapping.Amount = "amount"
+	}
+	if err := setCanaryDefaults(&source.Canary, source.Scheme, source.TimestampFormat, source.Headers); err != nil {
+		return fmt.Errorf("canary: %w", err)
+	}
+	return nil
+}
+
+// setCanaryDefaults reads the secret file of a canary and fills in the
+// settings it does not override with those of its endpoint
+func setCanaryDefaults(canary *Canary, scheme, timestampFormat string, headers SourceHeaders) error {
+	if canary.SecretFile != "" {
+		secret, err := ReadSecretFile(canary.SecretFile)
+		if err != nil {
+			return err
+		}
+		canary.Secret = secret
+	}
+	if canary.Scheme == "" {
+		canary.Scheme = scheme
+	}
+	if canary.TimestampFormat == "" {
+		canary.TimestampFormat = timestampFormat
+	}
+	if canary.Headers.Timestamp == "" {
+		canary.Headers.Timestamp = headers.Timestamp
+	}
+	if canary.Headers.Nonce == "" {
+		canary.Headers.Nonce = headers.Nonce
+	}
+	if canary.Headers.Signature == "" {
+		canary.Headers.Signature = headers.Signature
+	}
+	return nil
+}
+
+// configExtensions are the supported config file formats, detected by
+// extension
+var configExtensions = []string{".yaml", ".yml", ".toml", ".json"} //nolint:gochecknoglobals
+
+// FindConfigFile returns the config file called name (without extension) in
+// configDir, or "" if there is none. Having the same file in several formats
+// is an error, as it is unclear which one applies.
+func FindConfigFile(configDir, name string) (string, error) {
+	var found []string
+	for _, ext := range configExtensions {
+		path := filepath.Join(configDir, name+ext)
+		if _, err := os.Stat(path); err == nil {
+			found = append(found, path)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", nil
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("ambiguous config %q: found %s", name, strings.Join(found, ", "))
+	}
+}
+
+// readConfigFiles reads app-config from configDir, merged with the
+// <configEnv> override, into a new viper instance. Either file may be YAML,
+// TOML or JSON. Both are merged over the defaults from o, if any.
+func readConfigFiles(configDir, configEnv string, o loadOptions) (*viper.Viper, error) {
+	v := viper.New()
+
+	if o.defaults != nil {
+		// Read separately: a config type set on v would also apply to the
+		// files below instead of their extension
+		defaults := viper.New()
+		defaults.SetConfigType(o.defaultsFormat)
+		if err := defaults.ReadConfig(bytes.NewReader(o.defaults)); err != nil {
+			return nil, fmt.Errorf("failed to read default config: %w", err)
+		}
+		if err := v.MergeConfigMap(defaults.AllSettings()); err != nil {
+			return nil, fmt.Errorf("failed to read default config: %w", err)
+		}
+	}
+
+	// Load base app-config as template/defaults (if it exists)
+	baseConfigPath, err := FindConfigFile(configDir, "app-config")
+	if err != nil {
+		return nil, err
+	}
+	if baseConfigPath != "" {
+		v.SetConfigFile(baseConfigPath)
+		if err := v.MergeInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read base config file: %w", err)
+		}
+	}
+
+	// Load environment-specific config (e.g., local.yaml when CONFIG_ENV=local)
+	// and merge it on top of the base config. If neither file exists, we'll
+	// use defaults and env vars, so the service can run with just environment
+	// variables.
+	envConfigPath, err := FindConfigFile(configDir, configEnv)
+	if err != nil {
+		return nil, err
+	}
+	if envConfigPath != "" {
+		v.SetConfigFile(envConfigPath)
+		if err := v.MergeInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to merge env config file: %w", err)
+		}
+	}
+
+	return v, nil
+}
+
+// legacyEnv lists the unprefixed environment variables still accepted for
+// some keys, after the KII_ variable
+var legacyEnv = map[string][]string{ //nolint:gochecknoglobals
+	"server.port":                {"PORT"},
+	"webhook.hmacSecret":         {"HMAC_SECRET"},
+	"webhook.timestampTolerance": {"TIMESTAMP_TOLERANCE_MINUTES"},
+}
+
+// bindEnv maps environment variables onto config keys. Every field of Config
+// with a fixed key is bound, so any setting outside the named sections and
+// lists of envKeys skips can be provided without a config file.
+func bindEnv(v *viper.Viper) {
+	for _, key := range envKeys(reflect.TypeFor[Config](), "") {
+		v.BindEnv(append([]string{key, envName(key)}, legacyEnv[key]...)...)
+	}
+}
+
+// readEnvFiles sets each key whose variable is unset but has a _FILE variant
+// (e.g. KII_ADMIN_TOKEN_FILE) to the content of that file, as used for Docker
+// and Kubernetes secrets
+func readEnvFiles(v *viper.Viper) error {
+	for _, key := range envKeys(reflect.TypeFor[Config](), "") {
+		name := envName(key)
+		path := os.Getenv(name + "_FILE")
+		if path == "" || os.Getenv(name) != "" {
+			continue
+		}
+		value, err := ReadSecretFile(path)
+		if err != nil {
+			return fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		v.Set(key, value)
+	}
+	return nil
+}
+
+// keyedSections are the sections keyed by names of the operator's choosing
+// whose settings environment variables can set, by the type of their
+// entries
+var keyedSections = map[string]reflect.Type{ //nolint:gochecknoglobals
+	"sources": reflect.TypeFor[Source](),
+	"assets":  reflect.TypeFor[Asset](),
+}
+
+// readKeyedEnv sets the settings of keyed sections given by environment
+// variables naming the entry between the section and the key, e.g.
+// KII_SOURCES_PARTNER_SECRET for sources.partner.secret or
+// KII_ASSETS_USDC_SCALE for assets.usdc.scale. Entry names may contain
+// underscores, as the longest key the variable ends with is taken. Like
+// other variables, each can be given as a file by appending _FILE, and the
+// plain variable wins when both are set.
+func readKeyedEnv(v *viper.Viper) error {
+	values := make(map[string]string)
+	// files are the _FILE variables by the key they set
+	files := make(map[string]string)
+	for _, variable := range os.Environ() {
+		name, value, _ := strings.Cut(variable, "=")
+		for section, t := range keyedSections {
+			rest, ok := strings.CutPrefix(name, envName(section)+"_")
+			if !ok {
+				continue
+			}
+			if key := keyedEnvKey(section, rest, t); key != "" {
+				values[key] = value
+			} else if rest, ok := strings.CutSuffix(rest, "_FILE"); ok {
+				if key := keyedEnvKey(section, rest, t); key != "" {
+					files[key] = name
+				}
+			}
+		}
+	}
+	for key, name := range files {
+		if _, set := values[key]; set {
+			continue
+		}
+		value, err := ReadSecretFile(os.Getenv(name))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		values[key] = value
+	}
+	for key, value := range values {
+		v.Set(key, value)
+	}
+	return nil
+}
+
+// keyedEnvKey returns the config key of section that rest, a variable name
+// without the section's prefix, sets: the entry it names, lowercased like
+// viper does, and the longest key of t it ends with. It returns "" when rest
+// ends with no key of t or names no entry.
+func keyedEnvKey(section, rest string, t reflect.Type) string {
+	var longest, suffix string
+	for _, key := range envKeys(t, "") {
+		s := strings.TrimPrefix(envName(key), "KII")
+		if len(s) > len(suffix) && len(rest) > len(s) && strings.HasSuffix(rest, s) {
+			longest, suffix = key, s
+		}
+	}
+	if longest == "" {
+		return ""
+	}
+	return section + "." + strings.ToLower(strings.TrimSuffix(rest, suffix)) + "." + longest
+}
+
+// ReadSecretFile reads a secret from path, ignoring surrounding whitespace
+// such as the trailing newline most editors and secret stores add
+func ReadSecretFile(path string) (string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	secret := strings.TrimSpace(string(raw))
+	if secret == "" {
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+	return secret, nil
+}
+
+// envKeys returns the keys of all fields of t, descending into nested structs
+func envKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := range t.NumField() {
+		field := t.Field(i)
+		key := prefix + field.Tag.Get("mapstructure")
+		// Map keys are names chosen in the config files, so they have no
+		// fixed variable (see readKeyedEnv), and lists of structs cannot be
+		// comma-separated
+		if field.Type.Kind() == reflect.Map ||
+			(field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct) {
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeFor[time.Duration]() {
+			keys = append(keys, envKeys(field.Type, key+".")...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// envName returns the environment variable for a config key, e.g.
+// KII_ERROR_REPORTING_SENTRY_DSN for errorReporting.sentryDsn
+func envName(key string) string {
+	var b strings.Builder
+	b.WriteString("KII")
+	for part := range strings.SplitSeq(key, ".") {
+		b.WriteByte('_')
+		runes := []rune(part)
+		for i, r := range runes {
+			if i > 0 && unicode.IsUpper(r) &&
+				(!unicode.IsUpper(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,568 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeConfigDir(t *testing.T, base string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app-config.yaml"), []byte(base), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return dir
+}
+
+func TestLoadConfigEnv_Isolated(t *testing.T) {
+	serverDir := writeConfigDir(t, "server:\n  port: \"9001\"\nadmin:\n  token: \"server-token\"\n")
+	consumerDir := writeConfigDir(t, "server:\n  port: \"9002\"\n")
+
+	// Keys set by one load must not leak into another, even concurrently
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			cfg, err := LoadConfigEnv(serverDir, "test")
+			if err != nil {
+				t.Errorf("LoadConfigEnv() error = %v", err)
+				return
+			}
+			if cfg.Server.Port != "9001" || cfg.Admin.Token != "server-token" {
+				t.Errorf("server config = %+v %+v", cfg.Server, cfg.Admin)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			cfg, err := LoadConfigEnv(consumerDir, "test")
+			if err != nil {
+				t.Errorf("LoadConfigEnv() error = %v", err)
+				return
+			}
+			if cfg.Server.Port != "9002" || cfg.Admin.Token != "" {
+				t.Errorf("consumer config = %+v %+v", cfg.Server, cfg.Admin)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLoadConfigEnv_EnvOverride(t *testing.T) {
+	dir := writeConfigDir(t, "server:\n  port: \"9001\"\n")
+	if err := os.WriteFile(filepath.Join(dir, "test.yaml"), []byte("storage:\n  backend: \"sqlite\"\n"), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	t.Setenv("KII_SERVER_PORT", "9100")
+
+	cfg, err := LoadConfigEnv(dir, "test")
+	if err != nil {
+		t.Fatalf("LoadConfigEnv() error = %v", err)
+	}
+	if cfg.Server.Port != "9100" {
+		t.Errorf("Server.Port = %q, want env override 9100", cfg.Server.Port)
+	}
+	if cfg.Storage.Backend != "sqlite" {
+		t.Errorf("Storage.Backend = %q, want sqlite from test.yaml", cfg.Storage.Backend)
+	}
+	if cfg.ErrorReporting.Environment != "test" {
+		t.Errorf("ErrorReporting.Environment = %q, want test", cfg.ErrorReporting.Environment)
+	}
+}
+
+func TestLoadAll(t *testing.T) {
+	configs, err := LoadAll(map[string]string{
+		"server":   writeConfigDir(t, "server:\n  port: \"9001\"\n"),
+		"consumer": writeConfigDir(t, "server:\n  port: \"9002\"\n"),
+	})
+	if err != nil {
+		t.Fatalf("LoadAll() error = %v", err)
+	}
+	if configs["server"].Server.Port != "9001" || configs["consumer"].Server.Port != "9002" {
+		t.Errorf("LoadAll() ports = %q, %q, want 9001, 9002", configs["server"].Server.Port, configs["consumer"].Server.Port)
+	}
+
+	bad := writeConfigDir(t, "server: [\n")
+	if _, err := LoadAll(map[string]string{"admin": bad}); err == nil {
+		t.Error("LoadAll() with invalid config should fail")
+	}
+}
+
+func TestLoadConfigEnv_ServerTuning(t *testing.T) {
+	dir := writeConfigDir(t, "server:\n  readHeaderTimeout: \"2s\"\n  disableKeepAlives: true\n  maxConnections: 500\n")
+
+	cfg, err := LoadConfigEnv(dir, "test")
+	if err != nil {
+		t.Fatalf("LoadConfigEnv() error = %v", err)
+	}
+	if cfg.Server.ReadHeaderTimeout != 2*time.Second || !cfg.Server.DisableKeepAlives || cfg.Server.MaxConnections != 500 {
+		t.Errorf("Server = %+v, want configured tuning", cfg.Server)
+	}
+	if cfg.Server.IdleTimeout != 60*time.Second || cfg.Server.MaxHeaderBytes != 1<<20 {
+		t.Errorf("Server = %+v, want default idle timeout and header limit", cfg.Server)
+	}
+}
+
+func TestLoadConfigEnv_EnvOnly(t *testing.T) {
+	// No config directory at all: every setting comes from the environment
+	dir := filepath.Join(t.TempDir(), "missing")
+	t.Setenv("KII_SERVER_PORT", "9200")
+	t.Setenv("KII_SERVER_IDLE_TIMEOUT", "90s")
+	t.Setenv("KII_WEBHOOK_HMAC_SECRET", "env-secret")
+	t.Setenv("KII_WEBHOOK_LENIENT_AMOUNTS", "true")
+	t.Setenv("KII_ERROR_REPORTING_SENTRY_DSN", "https://key@sentry.example/1")
+	t.Setenv("KII_DEBUG_CAPTURE_SOURCES", "10.0.0.1,192.168.0.0/16")
+	t.Setenv("KII_WORKERS_QUEUE_DEPTH", "64")
+	t.Setenv("KII_CLUSTER_ENABLED", "true")
+
+	cfg, err := LoadConfigEnv(dir, "test")
+	if err != nil {
+		t.Fatalf("LoadConfigEnv() error = %v", err)
+	}
+	if cfg.Server.Port != "9200" || cfg.Server.IdleTimeout != 90*time.Second {
+		t.Errorf("Server = %+v, want port and idle timeout from env", cfg.Server)
+	}
+	if cfg.Webhook.HMACSecret != "env-secret" || !cfg.Webhook.LenientAmounts {
+		t.Errorf("Webhook = %+v, want secret and lenient amounts from env", cfg.Webhook)
+	}
+	if cfg.ErrorReporting.SentryDSN != "https://key@sentry.example/1" {
+		t.Errorf("ErrorReporting.SentryDSN = %q, want DSN from env", cfg.ErrorReporting.SentryDSN)
+	}
+	if len(cfg.Debug.CaptureSources) != 2 || cfg.Debug.CaptureSources[1] != "192.168.0.0/16" {
+		t.Errorf("Debug.CaptureSources = %v, want two sources", cfg.Debug.CaptureSources)
+	}
+	if cfg.Workers.QueueDepth != 64 || !cfg.Cluster.Enabled {
+		t.Errorf("Workers = %+v, Cluster = %+v, want values from env", cfg.Workers, cfg.Cluster)
+	}
+	if cfg.Storage.Backend != "memory" {
+		t.Errorf("Storage.Backend = %q, want default memory", cfg.Storage.Backend)
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"server.port", "KII_SERVER_PORT"},
+		{"server.maxHeaderBytes", "KII_SERVER_MAX_HEADER_BYTES"},
+		{"webhook.hmacSecret", "KII_WEBHOOK_HMAC_SECRET"},
+		{"errorReporting.sentryDsn", "KII_ERROR_REPORTING_SENTRY_DSN"},
+		{"assets.btc.precision", "KII_ASSETS_BTC_PRECISION"},
+		{"tracing.otlpURL", "KII_TRACING_OTLP_URL"},
+		{"keys.HMACRing", "KII_KEYS_HMAC_RING"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := envName(tt.key); got != tt.want {
+				t.Errorf("envName(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvNamesDocumented(t *testing.T) {
+	readme, err := os.ReadFile("../../../README.md")
+	if err != nil {
+		t.Fatalf("failed to read README: %v", err)
+	}
+	for _, key := range envKeys(reflect.TypeFor[Config](), "") {
+		if name := envName(key); !strings.Contains(string(readme), "`"+name+"`") {
+			t.Errorf("%s (%s) is not documented in README.md", name, key)
+		}
+	}
+}
+
+func TestLoadConfigEnv_Formats(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		check func(t *testing.T, cfg *Config)
+	}{
+		{
+			name:  "toml only",
+			files: map[string]string{"test.toml": "[server]\nport = \"9301\"\n\n[debug]\ncaptureSources = [\"10.0.0.1\"]\n"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Server.Port != "9301" || len(cfg.Debug.CaptureSources) != 1 {
+					t.Errorf("Server.Port = %q, CaptureSources = %v, want values from test.toml", cfg.Server.Port, cfg.Debug.CaptureSources)
+				}
+			},
+		},
+		{
+			name: "json over yaml",
+			files: map[string]string{
+				"app-config.yaml": "server:\n  port: \"9302\"\nstorage:\n  backend: \"memory\"\n",
+				"test.json":       `{"storage": {"backend": "sqlite", "batchWindow": "2ms"}}`,
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Server.Port != "9302" {
+					t.Errorf("Server.Port = %q, want 9302 from app-config.yaml", cfg.Server.Port)
+				}
+				if cfg.Storage.Backend != "sqlite" || cfg.Storage.BatchWindow != 2*time.Millisecond {
+					t.Errorf("Storage = %+v, want overrides from test.json", cfg.Storage)
+				}
+			},
+		},
+		{
+			name: "toml over yml",
+			files: map[string]string{
+				"app-config.yml": "webhook:\n  timestampTolerance: \"10m\"\n",
+				"test.toml":      "[webhook]\nhmacSecret = \"toml-secret\"\n",
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Webhook.TimestampTolerance != 10*time.Minute || cfg.Webhook.HMACSecret != "toml-secret" {
+					t.Errorf("Webhook = %+v, want tolerance from yml and secret from toml", cfg.Webhook)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+					t.Fatalf("failed to write config: %v", err)
+				}
+			}
+			cfg, err := LoadConfigEnv(dir, "test")
+			if err != nil {
+				t.Fatalf("LoadConfigEnv() error = %v", err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestLoadConfigEnv_AmbiguousFormat(t *testing.T) {
+	dir := writeConfigDir(t, "server:\n  port: \"9001\"\n")
+	if err := os.WriteFile(filepath.Join(dir, "app-config.json"), []byte(`{"server": {"port": "9002"}}`), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if _, err := LoadConfigEnv(dir, "test"); err == nil {
+		t.Error("LoadConfigEnv() with app-config in two formats should fail")
+	}
+}
+
+func TestLoadConfigEnv_SecretFiles(t *testing.T) {
+	secrets := t.TempDir()
+	writeSecret := func(name, content string) string {
+		path := filepath.Join(secrets, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write secret: %v", err)
+		}
+		return path
+	}
+	hmacFile := writeSecret("hmac", "file-secret\n")
+	t.Setenv("KII_ADMIN_TOKEN_FILE", writeSecret("admin", "file-token\n"))
+	t.Setenv("KII_ERROR_REPORTING_SENTRY_DSN_FILE", writeSecret("dsn", "https://file@sentry.example/1"))
+	t.Setenv("KII_ERROR_REPORTING_SENTRY_DSN", "https://env@sentry.example/1")
+
+	dir := writeConfigDir(t, "webhook:\n  hmacSecret: \"yaml-secret\"\n  hmacSecretFile: \""+hmacFile+"\"\n")
+	cfg, err := LoadConfigEnv(dir, "test")
+	if err != nil {
+		t.Fatalf("LoadConfigEnv() error = %v", err)
+	}
+	if cfg.Webhook.HMACSecret != "file-secret" {
+		t.Errorf("Webhook.HMACSecret = %q, want file-secret from hmacSecretFile", cfg.Webhook.HMACSecret)
+	}
+	if cfg.Admin.Token != "file-token" {
+		t.Errorf("Admin.Token = %q, want file-token from KII_ADMIN_TOKEN_FILE", cfg.Admin.Token)
+	}
+	if cfg.ErrorReporting.SentryDSN != "https://env@sentry.example/1" {
+		t.Errorf("ErrorReporting.SentryDSN = %q, want the plain variable over _FILE", cfg.ErrorReporting.SentryDSN)
+	}
+
+	t.Setenv("KII_ADMIN_TOKEN_FILE", writeSecret("empty", "\n"))
+	if _, err := LoadConfigEnv(dir, "test"); err == nil {
+		t.Error("LoadConfigEnv() with an empty secret file should fail")
+	}
+}
+
+func TestLoadConfigEnv_WithDefaults(t *testing.T) {
+	defaults := []byte("server:\n  port: \"9500\"\nlog:\n  level: \"warn\"\n  format: \"text\"\nmetrics:\n  prefix: \"embedded.\"\n")
+
+	t.Run("without config directory", func(t *testing.T) {
+		cfg, err := LoadConfigEnv(filepath.Join(t.TempDir(), "missing"), "test", WithDefaults(defaults, "yaml"))
+		if err != nil {
+			t.Fatalf("LoadConfigEnv() error = %v", err)
+		}
+		if cfg.Server.Port != "9500" || cfg.Log.Level != "warn" {
+			t.Errorf("Server.Port = %q, Log.Level = %q, want embedded defaults", cfg.Server.Port, cfg.Log.Level)
+		}
+	})
+
+	t.Run("files and env layered on top", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "app-config.toml"), []byte("[log]\nlevel = \"error\"\n"), 0o600); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "test.yaml"), []byte("log:\n  format: \"json\"\n"), 0o600); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+		t.Setenv("KII_SERVER_PORT", "9501")
+
+		cfg, err := LoadConfigEnv(dir, "test", WithDefaults(defaults, "yaml"))
+		if err != nil {
+			t.Fatalf("LoadConfigEnv() error = %v", err)
+		}
+		if cfg.Server.Port != "9501" {
+			t.Errorf("Server.Port = %q, want 9501 from env", cfg.Server.Port)
+		}
+		if cfg.Log.Level != "error" || cfg.Log.Format != "json" {
+			t.Errorf("Log = %+v, want level from app-config.toml and format from test.yaml", cfg.Log)
+		}
+		if cfg.Metrics.Prefix != "embedded." {
+			t.Errorf("Metrics.Prefix = %q, want embedded. from defaults", cfg.Metrics.Prefix)
+		}
+	})
+}
+
+func TestLoadConfigEnv_Sources(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "partner")
+	if err := os.WriteFile(secretFile, []byte("file-secret\n"), 0o600); err != nil {
+		t.Fatalf("failed to write secret: %v", err)
+	}
+	dir := writeConfigDir(t, "webhook:\n  timestampTolerance: \"2m\"\nsources:\n"+
+		"  Stripe:\n    secret: \"stripe-secret\"\n    scheme: \"hmac-sha256-base64\"\n    timestampFormat: \"milliseconds\"\n    timestampTolerance: \"30s\"\n"+
+		"    headers:\n      signature: \"Stripe-Signature\"\n    mapping:\n      user: \"data.customer\"\n"+
+		"    canary:\n      secret: \"stripe-next\"\n      scheme: \"hmac-sha256\"\n"+
+		"  partner:\n    secretFile: \""+secretFile+"\"\n")
+
+	cfg, err := LoadConfigEnv(dir, "test")
+	if err != nil {
+		t.Fatalf("LoadConfigEnv() error = %v", err)
+	}
+	stripe, ok := cfg.Sources["stripe"]
+	if !ok {
+		t.Fatalf("Sources = %v, want lowercased stripe source", cfg.Sources)
+	}
+	if stripe.Scheme != "hmac-sha256-base64" || stripe.TimestampFormat != "milliseconds" || stripe.TimestampTolerance != 30*time.Second {
+		t.Errorf("stripe = %+v, want configured scheme, timestamp format and tolerance", stripe)
+	}
+	if stripe.Headers.Signature != "Stripe-Signature" || stripe.Headers.Nonce != "X-Nonce" {
+		t.Errorf("stripe.Headers = %+v, want configured signature header and default nonce header", stripe.Headers)
+	}
+	if stripe.Mapping.User != "data.customer" || stripe.Mapping.Amount != "amount" {
+		t.Errorf("stripe.Mapping = %+v, want configured user path and default amount", stripe.Mapping)
+	}
+	if stripe.Canary.Secret != "stripe-next" || stripe.Canary.Scheme != "hmac-sha256" ||
+		stripe.Canary.TimestampFormat != "milliseconds" || stripe.Canary.Headers.Signature != "Stripe-Signature" {
+		t.Errorf("stripe.Canary = %+v, want configured secret and scheme, the rest from the source", stripe.Canary)
+	}
+	partner := cfg.Sources["partner"]
+	if partner.Secret != "file-secret" || partner.Scheme != "hmac-sha256" || partner.TimestampFormat != "auto" || partner.TimestampTolerance != 2*time.Minute {
+		t.Errorf("partner = %+v, want secret from file and defaults", partner)
+	}
+
+	missing := writeConfigDir(t, "sources:\n  partner:\n    scheme: \"hmac-sha256\"\n")
+	if _, err := LoadConfigEnv(missing, "test"); err == nil {
+		t.Error("LoadConfigEnv() with a source without secret should fail")
+	}
+}
+
+func TestLoadConfigEnv_Assets(t *testing.T) {
+	dir := writeConfigDir(t, "assets:\n"+
+		"  JPY:\n    scale: 0\n    rounding: \"truncate\"\n"+
+		"  usdc:\n    scale: 6\n"+
+		"  eth:\n    rounding: \"half-even\"\n")
+
+	cfg, err := LoadConfigEnv(dir, "test")
+	if err != nil {
+		t.Fatalf("LoadConfigEnv() error = %v", err)
+	}
+	want := map[string]Asset{
+		"jpy":  {Scale: 0, Rounding: "truncate"},
+		"usdc": {Scale: 6, Rounding: "half-up"},
+		"eth":  {Scale: 8, Rounding: "half-even"},
+	}
+	if !reflect.DeepEqual(cfg.Assets, want) {
+		t.Errorf("Assets = %+v, want %+v", cfg.Assets, want)
+	}
+}
+
+func TestLoadConfigEnv_KeyedEnv(t *testing.T) {
+	secrets := t.TempDir()
+	writeSecret := func(name, content string) string {
+		path := filepath.Join(secrets, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write secret: %v", err)
+		}
+		return path
+	}
+	senderSecretFile := writeSecret("sender", "file-secret\n")
+	t.Setenv("KII_SOURCES_PARTNER_SECRET", "env-secret")
+	t.Setenv("KII_SOURCES_PARTNER_CANARY_SECRET", "env-canary")
+	t.Setenv("KII_SOURCES_MY_SENDER_SECRET_FILE", senderSecretFile)
+	t.Setenv("KII_SOURCES_MY_SENDER_HEADERS_SIGNATURE", "X-Sender-Signature")
+	t.Setenv("KII_SOURCES_MY_SENDER_TIMESTAMP_TOLERANCE", "30s")
+	t.Setenv("KII_ASSETS_USDC_SCALE", "6")
+	t.Setenv("KII_ASSETS_JPY_SCALE", "0")
+	t.Setenv("KII_ASSETS_JPY_ROUNDING_FILE", writeSecret("rounding", "truncate\n"))
+	t.Setenv("KII_ASSETS_ETH_ROUNDING", "half-even")
+	t.Setenv("KII_ASSETS_ETH_ROUNDING_FILE", writeSecret("ignored", "truncate"))
+
+	dir := writeConfigDir(t, "sources:\n  partner:\n    secret: \"yaml-secret\"\n    scheme: \"hmac-sha256-base64\"\n"+
+		"assets:\n  usdc:\n    rounding: \"half-even\"\n")
+	cfg, err := LoadConfigEnv(dir, "test")
+	if err != nil {
+		t.Fatalf("LoadConfigEnv() error = %v", err)
+	}
+	partner := cfg.Sources["partner"]
+	if partner.Secret != "env-secret" || partner.Scheme != "hmac-sha256-base64" || partner.Canary.Secret != "env-canary" {
+		t.Errorf("partner = %+v, want secrets from env over the file's and its scheme", partner)
+	}
+	sender, ok := cfg.Sources["my_sender"]
+	if !ok {
+		t.Fatalf("Sources = %v, want my_sender from env", cfg.Sources)
+	}
+	if sender.SecretFile != senderSecretFile || sender.Secret != "file-secret" ||
+		sender.Headers.Signature != "X-Sender-Signature" || sender.TimestampTolerance != 30*time.Second {
+		t.Errorf("my_sender = %+v, want secret file, signature header and tolerance from env", sender)
+	}
+	want := map[string]Asset{
+		"usdc": {Scale: 6, Rounding: "half-even"},
+		"jpy":  {Scale: 0, Rounding: "truncate"},
+		"eth":  {Scale: 8, Rounding: "half-even"},
+	}
+	if !reflect.DeepEqual(cfg.Assets, want) {
+		t.Errorf("Assets = %+v, want %+v", cfg.Assets, want)
+	}
+
+	t.Setenv("KII_ASSETS_JPY_ROUNDING_FILE", filepath.Join(secrets, "missing"))
+	if _, err := LoadConfigEnv(dir, "test"); err == nil || !strings.Contains(err.Error(), "KII_ASSETS_JPY_ROUNDING_FILE") {
+		t.Errorf("LoadConfigEnv() with a missing _FILE error = %v, want the variable named", err)
+	}
+}
+
+func TestKeyedEnvKey(t *testing.T) {
+	tests := []struct {
+		section string
+		rest    string
+		want    string
+	}{
+		{"sources", "PARTNER_SECRET", "sources.partner.secret"},
+		{"sources", "PARTNER_SECRET_FILE", "sources.partner.secretFile"},
+		{"sources", "PARTNER_CANARY_SECRET", "sources.partner.canary.secret"},
+		{"sources", "MY_PARTNER_HEADERS_NONCE", "sources.my_partner.headers.nonce"},
+		{"sources", "SECRET", ""},
+		{"sources", "PARTNER_UNKNOWN", ""},
+		{"assets", "BTC_SCALE", "assets.btc.scale"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rest, func(t *testing.T) {
+			if got := keyedEnvKey(tt.section, tt.rest, keyedSections[tt.section]); got != tt.want {
+				t.Errorf("keyedEnvKey(%q, %q) = %q, want %q", tt.section, tt.rest, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigEnv_Velocity(t *testing.T) {
+	dir := writeConfigDir(t, "velocity:\n  action: \"review\"\n  rules:\n"+
+		"    - asset: \"BTC\"\n      window: \"1h\"\n      maxCredit: \"2.5\"\n"+
+		"    - window: \"24h\"\n      maxCredit: \"10000\"\n")
+
+	cfg, err := LoadConfigEnv(dir, "test")
+	if err != nil {
+		t.Fatalf("LoadConfigEnv() error = %v", err)
+	}
+	want := []VelocityRule{
+		{Asset: "BTC", Window: time.Hour, MaxCredit: "2.5"},
+		{Window: 24 * time.Hour, MaxCredit: "10000"},
+	}
+	if cfg.Velocity.Action != "review" || !reflect.DeepEqual(cfg.Velocity.Rules, want) {
+		t.Errorf("Velocity = %+v, want review with %+v", cfg.Velocity, want)
+	}
+}
+
+func TestLoadConfigEnv_NegativeInterval(t *testing.T) {
+	tests := []struct {
+		key  string
+		yaml string
+	}{
+		{key: "retention.interval", yaml: "retention:\n  interval: \"-1m\"\n"},
+		{key: "storage.shadow.compareInterval", yaml: "storage:\n  shadow:\n    compareInterval: \"-1m\"\n"},
+		{key: "analytics.interval", yaml: "analytics:\n  interval: \"-1m\"\n"},
+		{key: "remote.watchInterval", yaml: "remote:\n  watchInterval: \"-1m\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if _, err := LoadConfigEnv(writeConfigDir(t, tt.yaml), "test"); err == nil || !strings.Contains(err.Error(), tt.key) {
+				t.Errorf("LoadConfigEnv() error = %v, want %s error", err, tt.key)
+			}
+		})
+	}
+}
+
+func TestLoadConfigEnv_DistinctSources(t *testing.T) {
+	cfg, err := LoadConfigEnv(writeConfigDir(t, "approval:\n  threshold: \"1000\"\n"), "test")
+	if err != nil {
+		t.Fatalf("LoadConfigEnv() error = %v", err)
+	}
+	if !cfg.Approval.DistinctSources {
+		t.Error("DistinctSources = false by default, want true")
+	}
+
+	cfg, err = LoadConfigEnv(writeConfigDir(t, "approval:\n  distinctSources: false\n"), "test")
+	if err != nil {
+		t.Fatalf("LoadConfigEnv() error = %v", err)
+	}
+	if cfg.Approval.DistinctSources {
+		t.Error("DistinctSources = true, want false as configured")
+	}
+}
+
+func TestLoadConfigEnv_ReservedSourceName(t *testing.T) {
+	for _, name := range []string{"default", "Default"} {
+		_, err := LoadConfigEnv(writeConfigDir(t, "sources:\n  "+name+":\n    secret: one\n"), "test")
+		if err == nil || !strings.Contains(err.Error(), "reserved for POST /webhook") {
+			t.Errorf("LoadConfigEnv() with source %s error = %v, want the name refused", name, err)
+		}
+	}
+}
+
+func TestLoadConfigEnv_SharedSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name:    "two sources",
+			yaml:    "sources:\n  a:\n    secret: shared\n  b:\n    secret: shared\n",
+			wantErr: "sources.b.secret is the same as sources.a.secret",
+		},
+		{
+			name:    "a source and POST /webhook",
+			yaml:    "webhook:\n  hmacSecret: shared\nsources:\n  a:\n    secret: shared\n",
+			wantErr: "sources.a.secret is the same as webhook.hmacSecret",
+		},
+		{
+			name: "distinct secrets",
+			yaml: "webhook:\n  hmacSecret: main\nsources:\n  a:\n    secret: one\n  b:\n    secret: two\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfigEnv(writeConfigDir(t, tt.yaml), "test")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadConfigEnv() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadConfigEnv() error = %v, want %q", err, tt.wantErr)
+			}
+			if strings.Contains(err.Error(), "shared") {
+				t.Errorf("LoadConfigEnv() error = %v reveals the secret", err)
+			}
+		})
+	}
+}
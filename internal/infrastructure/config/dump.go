@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Redacted replaces the values of secrets in a dump
+const Redacted = "[REDACTED]"
+
+// secretKeyParts mark the keys, lowercased, whose values are secrets.
+// Keys ending in file or path name where a secret is read from instead.
+var secretKeyParts = []string{"secret", "token", "password", "dsn", "customerkey"} //nolint:gochecknoglobals
+
+// Dump writes cfg to w as YAML, with the keys of the config files in the
+// order they are declared. The values of secrets and the passwords of URLs
+// are replaced with Redacted; secrets that are not set are left empty, so a
+// dump still shows whether they were.
+func Dump(w io.Writer, cfg *Config) error {
+	node, err := dumpValue(reflect.ValueOf(*cfg), "")
+	if err != nil {
+		return err
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// dumpValue returns the YAML node of v, the value of key
+func dumpValue(v reflect.Value, key string) (*yaml.Node, error) {
+	if v.Type() == reflect.TypeFor[time.Duration]() {
+		return scalar(time.Duration(v.Int()).String(), "!!str"), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return scalar("null", "!!null"), nil
+		}
+		return dumpValue(v.Elem(), key)
+
+	case reflect.Struct:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for i := range v.NumField() {
+			name := v.Type().Field(i).Tag.Get("mapstructure")
+			if name == "" {
+				continue
+			}
+			value, err := dumpValue(v.Field(i), name)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, scalar(name, "!!str"), value)
+		}
+		return node, nil
+
+	case reflect.Map:
+		// Map keys are names, such as those of sources, so they are sorted
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for _, k := range keys {
+			value, err := dumpValue(v.MapIndex(reflect.ValueOf(k)), k)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, scalar(k, "!!str"), value)
+		}
+		return node, nil
+
+	case reflect.Slice:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for i := range v.Len() {
+			value, err := dumpValue(v.Index(i), key)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, value)
+		}
+		return node, nil
+
+	case reflect.String:
+		return scalar(redact(key, v.String()), "!!str"), nil
+
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		node := &yaml.Node{}
+		if err := node.Encode(v.Interface()); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+	return nil, fmt.Errorf("cannot dump %s of type %s", key, v.Type())
+}
+
+// scalar returns a scalar node of value with tag
+func scalar(value, tag string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
+
+// redact returns value, the value of key, with secrets replaced
+func redact(key, value string) string {
+	if value == "" {
+		return value
+	}
+	lower := strings.ToLower(key)
+	if !strings.HasSuffix(lower, "file") && !strings.HasSuffix(lower, "path") {
+		for _, part := range secretKeyParts {
+			if strings.Contains(lower, part) {
+				return Redacted
+			}
+		}
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			// Redacted encodes the URL with its password as xxxxx
+			return strings.Replace(u.Redacted(), ":xxxxx@", ":"+Redacted+"@", 1)
+		}
+	}
+	return value
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	// Registers the Consul and etcd providers with viper
+	_ "github.com/spf13/viper/remote"
+)
+
+// remoteProviders are the supported key/value stores
+var remoteProviders = []string{"consul", "etcd", "etcd3"} //nolint:gochecknoglobals
+
+// Remote configuration. When Provider is set, the document stored at Path in
+// Consul or etcd is merged over the config files; environment variables still
+// take precedence. Endpoint is the store address (several etcd endpoints are
+// separated by ";") and Format is how the document is encoded. The document is
+// fetched again every WatchInterval and changes are applied like a SIGHUP
+// reload. The remote settings themselves can only come from files or env.
+type Remote struct {
+	Provider      string        `mapstructure:"provider"`
+	Endpoint      string        `mapstructure:"endpoint"`
+	Path          string        `mapstructure:"path"`
+	Format        string        `mapstructure:"format"`
+	Timeout       time.Duration `mapstructure:"timeout"`
+	WatchInterval time.Duration `mapstructure:"watchInterval"`
+}
+
+// remoteDocument names a remote config document
+type remoteDocument struct {
+	provider, endpoint, path string
+}
+
+// fetching are the remote documents whose fetch is still running
+var (
+	fetchingMu sync.Mutex
+	fetching   = make(map[remoteDocument]bool) //nolint:gochecknoglobals
+)
+
+// FetchRemote reads the remote config document. The stores are not queried
+// with a context, so a fetch that outlives Timeout is abandoned but keeps
+// running. Until it returns, fetches of the same document fail rather than
+// pile up, e.g. one per remote.watchInterval while the store hangs.
+func FetchRemote(r Remote) (map[string]any, error) {
+	if !slices.Contains(remoteProviders, r.Provider) {
+		return nil, fmt.Errorf("unsupported remote config provider %q (want one of %v)", r.Provider, remoteProviders)
+	}
+	if r.Endpoint == "" || r.Path == "" {
+		return nil, fmt.Errorf("remote config needs remote.endpoint and remote.path")
+	}
+
+	v := viper.New()
+	if err := v.AddRemoteProvider(r.Provider, r.Endpoint, r.Path); err != nil {
+		return nil, err
+	}
+	v.SetConfigType(r.Format)
+
+	doc := remoteDocument{r.Provider, r.Endpoint, r.Path}
+	fetchingMu.Lock()
+	if fetching[doc] {
+		fetchingMu.Unlock()
+		return nil, fmt.Errorf("an earlier fetch of remote config %q from %s at %s is still running", r.Path, r.Provider, r.Endpoint)
+	}
+	fetching[doc] = true
+	fetchingMu.Unlock()
+
+	// Buffered so that an abandoned fetch can still finish
+	result := make(chan error, 1)
+	go func() {
+		err := v.ReadRemoteConfig()
+		fetchingMu.Lock()
+		delete(fetching, doc)
+		fetchingMu.Unlock()
+		result <- err
+	}()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			return nil, fmt.Errorf("failed to read remote config %q from %s at %s: %w", r.Path, r.Provider, r.Endpoint, err)
+		}
+		return v.AllSettings(), nil
+	case <-time.After(r.Timeout):
+		return nil, fmt.Errorf("timed out reading remote config %q from %s at %s after %s", r.Path, r.Provider, r.Endpoint, r.Timeout)
+	}
+}
+
+// setRemoteDefaults fills in the remote settings that were not provided. The
+// watch's ticker cannot run at a negative WatchInterval, so it is rejected.
+func setRemoteDefaults(r *Remote) error {
+	if r.Format == "" {
+		r.Format = "yaml"
+	}
+	if r.Timeout == 0 {
+		r.Timeout = 5 * time.Second
+	}
+	if r.WatchInterval == 0 {
+		r.WatchInterval = 30 * time.Second
+	} else if r.WatchInterval < 0 {
+		return fmt.Errorf("remote.watchInterval must not be negative, got %s", r.WatchInterval)
+	}
+	return nil
+}
+
+// mergeRemote merges the remote config document over the config files read
+// into v
+func mergeRemote(v *viper.Viper, r Remote) error {
+	settings, err := FetchRemote(r)
+	if err != nil {
+		return err
+	}
+	// The remote document cannot redirect where it is read from
+	delete(settings, "remote")
+	return v.MergeConfigMap(settings)
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// fakeRemoteStore serves documents keyed by path in place of Consul or etcd.
+// Fetches hold fetching, so that the store is only replaced once fetches
+// abandoned by a timeout have finished with it.
+type fakeRemoteStore struct {
+	docs     map[string]string
+	delay    time.Duration
+	fetching *sync.RWMutex
+}
+
+func (f fakeRemoteStore) Get(rp viper.RemoteProvider) (io.Reader, error) {
+	f.fetching.RLock()
+	defer f.fetching.RUnlock()
+	time.Sleep(f.delay)
+	doc, ok := f.docs[rp.Path()]
+	if !ok {
+		return nil, errors.New("key not found")
+	}
+	return strings.NewReader(doc), nil
+}
+
+func (f fakeRemoteStore) Watch(rp viper.RemoteProvider) (io.Reader, error) {
+	return f.Get(rp)
+}
+
+func (f fakeRemoteStore) WatchChannel(viper.RemoteProvider) (<-chan *viper.RemoteResponse, chan bool) {
+	return nil, nil
+}
+
+// useRemoteStore replaces viper's remote store for the duration of the test
+func useRemoteStore(t *testing.T, store fakeRemoteStore) {
+	t.Helper()
+	previous := viper.RemoteConfig
+	store.fetching = &sync.RWMutex{}
+	viper.RemoteConfig = store
+	t.Cleanup(func() {
+		store.fetching.Lock()
+		defer store.fetching.Unlock()
+		viper.RemoteConfig = previous
+	})
+}
+
+func TestLoadConfigEnv_Remote(t *testing.T) {
+	useRemoteStore(t, fakeRemoteStore{docs: map[string]string{
+		"config/kii": "server:\n  port: \"9400\"\nlog:\n  level: \"debug\"\nremote:\n  path: \"elsewhere\"\n",
+	}})
+	dir := writeConfigDir(t, "server:\n  port: \"9001\"\nstorage:\n  backend: \"memory\"\nlog:\n  level: \"info\"\n"+
+		"remote:\n  provider: \"consul\"\n  endpoint: \"consul:8500\"\n  path: \"config/kii\"\n")
+	t.Setenv("KII_LOG_LEVEL", "warn")
+
+	cfg, err := LoadConfigEnv(dir, "test")
+	if err != nil {
+		t.Fatalf("LoadConfigEnv() error = %v", err)
+	}
+	if cfg.Server.Port != "9400" {
+		t.Errorf("Server.Port = %q, want 9400 from the remote document", cfg.Server.Port)
+	}
+	if cfg.Storage.Backend != "memory" {
+		t.Errorf("Storage.Backend = %q, want memory from the config file", cfg.Storage.Backend)
+	}
+	if cfg.Log.Level != "warn" {
+		t.Errorf("Log.Level = %q, want warn from env over the remote document", cfg.Log.Level)
+	}
+	if cfg.Remote.Path != "config/kii" || cfg.Remote.WatchInterval != 30*time.Second {
+		t.Errorf("Remote = %+v, want local settings with defaults", cfg.Remote)
+	}
+}
+
+func TestFetchRemote_Errors(t *testing.T) {
+	useRemoteStore(t, fakeRemoteStore{docs: map[string]string{"slow": "server: {}\n"}, delay: 50 * time.Millisecond})
+
+	tests := []struct {
+		name   string
+		remote Remote
+		want   string
+	}{
+		{"unsupported provider", Remote{Provider: "zookeeper", Endpoint: "zk:2181", Path: "kii"}, "unsupported"},
+		{"missing path", Remote{Provider: "etcd3", Endpoint: "etcd:2379"}, "remote.path"},
+		{"missing key", Remote{Provider: "consul", Endpoint: "consul:8500", Path: "missing", Format: "yaml", Timeout: time.Second}, "failed to read remote config"},
+		{"timeout", Remote{Provider: "consul", Endpoint: "consul:8500", Path: "slow", Format: "yaml", Timeout: time.Millisecond}, "timed out"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := FetchRemote(tt.remote)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("FetchRemote() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchRemote_AbandonedFetch(t *testing.T) {
+	useRemoteStore(t, fakeRemoteStore{docs: map[string]string{"hung": "server: {}\n"}, delay: 100 * time.Millisecond})
+	remote := Remote{Provider: "consul", Endpoint: "consul:8500", Path: "hung", Format: "yaml", Timeout: time.Millisecond}
+
+	if _, err := FetchRemote(remote); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("FetchRemote() error = %v, want timed out", err)
+	}
+	// The abandoned fetch still runs, so no other one is started
+	if _, err := FetchRemote(remote); err == nil || !strings.Contains(err.Error(), "still running") {
+		t.Errorf("FetchRemote() during the abandoned fetch error = %v, want still running", err)
+	}
+
+	remote.Timeout = time.Second
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, err := FetchRemote(remote)
+		if err == nil {
+			break
+		}
+		if !strings.Contains(err.Error(), "still running") || time.Now().After(deadline) {
+			t.Fatalf("FetchRemote() after the abandoned fetch error = %v, want none", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
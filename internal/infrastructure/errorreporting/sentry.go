@@ -0,0 +1,67 @@
+// Package errorreporting ships errors to external error trackers.
+package errorreporting
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"go.opentelemetry.io/otel/trace"
+
+	"kii.com/internal/infrastructure/config"
+)
+
+// SentryReporter implements the ErrorReporter port using Sentry
+type SentryReporter struct {
+	hub *sentry.Hub
+}
+
+// NewSentryReporter creates a Sentry reporter for the configured DSN
+func NewSentryReporter(cfg config.ErrorReporting, release string) (*SentryReporter, error) {
+	return newSentryReporter(sentry.ClientOptions{
+		Dsn:              cfg.SentryDSN,
+		Environment:      cfg.Environment,
+		Release:          release,
+		SampleRate:       cfg.SampleRate,
+		AttachStacktrace: true,
+	})
+}
+
+func newSentryReporter(opts sentry.ClientOptions) (*SentryReporter, error) {
+	client, err := sentry.NewClient(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Sentry client: %w", err)
+	}
+	return &SentryReporter{
+		hub: sentry.NewHub(client, sentry.NewScope()),
+	}, nil
+}
+
+// ReportError sends err to Sentry, tagged with the request and trace IDs from
+// ctx. attrs are attached as key/value context.
+func (r *SentryReporter) ReportError(ctx context.Context, err error, attrs ...any) {
+	hub := r.hub.Clone()
+	scope := hub.Scope()
+
+	if requestID, ok := ctx.Value("request_id").(string); ok {
+		scope.SetTag("request_id", requestID)
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		scope.SetTag("trace_id", spanContext.TraceID().String())
+	}
+	if len(attrs) > 0 {
+		values := make(sentry.Context, len(attrs)/2)
+		for i := 0; i+1 < len(attrs); i += 2 {
+			values[fmt.Sprint(attrs[i])] = attrs[i+1]
+		}
+		scope.SetContext("attributes", values)
+	}
+
+	hub.CaptureException(err)
+}
+
+// Flush waits up to timeout for queued events to be sent
+func (r *SentryReporter) Flush(timeout time.Duration) bool {
+	return r.hub.Flush(timeout)
+}
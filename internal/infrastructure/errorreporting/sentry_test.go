@@ -0,0 +1,62 @@
+package errorreporting
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// recordingTransport captures events instead of sending them
+type recordingTransport struct {
+	mu     sync.Mutex
+	events []*sentry.Event
+}
+
+func (t *recordingTransport) Configure(sentry.ClientOptions)        {}
+func (t *recordingTransport) Flush(time.Duration) bool              { return true }
+func (t *recordingTransport) FlushWithContext(context.Context) bool { return true }
+func (t *recordingTransport) Close()                                {}
+func (t *recordingTransport) SendEvent(event *sentry.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, event)
+}
+
+func TestSentryReporter_ReportError(t *testing.T) {
+	transport := &recordingTransport{}
+	reporter, err := newSentryReporter(sentry.ClientOptions{
+		Dsn:       "https://public@sentry.example.com/1",
+		Transport: transport,
+	})
+	if err != nil {
+		t.Fatalf("newSentryReporter() error = %v", err)
+	}
+
+	ctx := context.WithValue(context.Background(), "request_id", "req-1")
+	reporter.ReportError(ctx, errors.New("ledger unavailable"), "message", "Failed to process webhook", "user", "alice")
+	reporter.ReportError(context.Background(), errors.New("second"))
+
+	if len(transport.events) != 2 {
+		t.Fatalf("sent %d events, want 2", len(transport.events))
+	}
+
+	event := transport.events[0]
+	if len(event.Exception) == 0 || event.Exception[len(event.Exception)-1].Value != "ledger unavailable" {
+		t.Errorf("exception = %+v, want ledger unavailable", event.Exception)
+	}
+	if event.Tags["request_id"] != "req-1" {
+		t.Errorf("request_id tag = %q, want req-1", event.Tags["request_id"])
+	}
+	if attrs := event.Contexts["attributes"]; attrs["user"] != "alice" || attrs["message"] != "Failed to process webhook" {
+		t.Errorf("attributes context = %v, want user and message", attrs)
+	}
+
+	// Scope data must not leak between reports
+	if _, ok := transport.events[1].Tags["request_id"]; ok {
+		t.Errorf("second event has request_id tag from the first report")
+	}
+}
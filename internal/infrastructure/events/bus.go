@@ -0,0 +1,49 @@
+// Package events publishes balance events for every entry applied to the
+// ledger, in process and to message brokers.
+package events
+
+import (
+	"context"
+	"sync"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+)
+
+// Bus publishes balance events in process, handing each one to every
+// subscriber in the order they subscribed. Subscribers are called on the
+// webhook's goroutine, so they must be quick; a broker publisher queues the
+// event and returns.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers []port.EventPublisher
+}
+
+// NewBus creates a bus without subscribers
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe hands the events published from now on to subscriber as well
+func (b *Bus) Subscribe(subscriber port.EventPublisher) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, subscriber)
+}
+
+// Publish hands event to every subscriber
+func (b *Bus) Publish(ctx context.Context, event entity.BalanceEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, subscriber := range b.subscribers {
+		subscriber.Publish(ctx, event)
+	}
+}
+
+// Func adapts a function to port.EventPublisher
+type Func func(ctx context.Context, event entity.BalanceEvent)
+
+// Publish calls f
+func (f Func) Publish(ctx context.Context, event entity.BalanceEvent) {
+	f(ctx, event)
+}
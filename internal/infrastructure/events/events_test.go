@@ -0,0 +1,51 @@
+package events
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/infrastructure/metrics"
+)
+
+// countingEmitter records each counter increment with its tags
+type countingEmitter struct {
+	metrics.NopEmitter
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (e *countingEmitter) Count(name string, value int64, tags ...string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.counts == nil {
+		e.counts = make(map[string]int64)
+	}
+	e.counts[name+" "+strings.Join(tags, ",")] += value
+}
+
+func (e *countingEmitter) count(key string) int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.counts[key]
+}
+
+func TestBus_Publish(t *testing.T) {
+	bus := NewBus()
+	var got []string
+	for _, name := range []string{"cache", "notifications"} {
+		bus.Subscribe(Func(func(ctx context.Context, event entity.BalanceEvent) {
+			got = append(got, name+":"+event.ID)
+		}))
+	}
+
+	bus.Publish(context.Background(), entity.BalanceEvent{ID: "event-1"})
+	bus.Publish(context.Background(), entity.BalanceEvent{ID: "event-2"})
+
+	want := "cache:event-1 notifications:event-1 cache:event-2 notifications:event-2"
+	if strings.Join(got, " ") != want {
+		t.Errorf("delivered %v, want %s", got, want)
+	}
+}
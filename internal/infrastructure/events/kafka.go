@@ -0,0 +1,116 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/infrastructure/config"
+	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/metrics"
+)
+
+// Content types of the Kafka REST Proxy v2 API
+const (
+	kafkaContentType = "application/vnd.kafka.json.v2+json"
+	kafkaAccept      = "application/vnd.kafka.v2+json"
+)
+
+// kafkaSender produces events to a topic through the Kafka REST Proxy, keyed
+// by user so that a user's events land on one partition, in order
+type kafkaSender struct {
+	url    *url.URL
+	client *http.Client
+}
+
+// kafkaRequest is a produce request of several records
+type kafkaRequest struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+// kafkaRecord is one record produced to the topic
+type kafkaRecord struct {
+	Key   string              `json:"key"`
+	Value entity.BalanceEvent `json:"value"`
+}
+
+// kafkaResponse is the REST Proxy's answer to a produce request, with the
+// outcome of each record
+type kafkaResponse struct {
+	Offsets []struct {
+		Error *string `json:"error"`
+	} `json:"offsets"`
+}
+
+// NewKafka creates a publisher producing events to cfg.Kafka.Topic through the
+// REST Proxy at cfg.Kafka.RESTProxyURL
+func NewKafka(cfg config.Events, emitter metrics.Emitter, logger logger.Logger) (*Publisher, error) {
+	u, err := url.Parse(cfg.Kafka.RESTProxyURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid events.kafka.restProxyUrl %q", cfg.Kafka.RESTProxyURL)
+	}
+	if cfg.Kafka.Topic == "" {
+		return nil, fmt.Errorf("events.kafka.topic is required")
+	}
+	s := &kafkaSender{
+		url:    u.JoinPath("topics", cfg.Kafka.Topic),
+		client: &http.Client{},
+	}
+	return newPublisher("kafka", s, cfg, emitter, logger)
+}
+
+// send produces events in one request
+func (s *kafkaSender) send(ctx context.Context, events []entity.BalanceEvent) error {
+	records := make([]kafkaRecord, len(events))
+	for i, event := range events {
+		records[i] = kafkaRecord{Key: event.User, Value: event}
+	}
+	body, err := json.Marshal(kafkaRequest{Records: records})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", kafkaContentType)
+	req.Header.Set("Accept", kafkaAccept)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("kafka rest proxy responded %s", resp.Status)
+	}
+
+	var result kafkaResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return fmt.Errorf("invalid kafka rest proxy response: %w", err)
+	}
+	failed := 0
+	var first string
+	for _, offset := range result.Offsets {
+		if offset.Error != nil {
+			if failed == 0 {
+				first = *offset.Error
+			}
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("kafka rest proxy failed %d of %d records: %s", failed, len(events), first)
+	}
+	return nil
+}
+
+// close releases idle connections to the REST Proxy
+func (s *kafkaSender) close() {
+	s.client.CloseIdleConnections()
+}
@@ -0,0 +1,149 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/infrastructure/config"
+	"kii.com/internal/infrastructure/logger"
+)
+
+// restProxy is a fake Kafka REST Proxy recording the records produced
+type restProxy struct {
+	mu      sync.Mutex
+	records []kafkaRecord
+	// fail is the error returned for the records of these users
+	fail map[string]string
+}
+
+func (p *restProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/topics/kii.balances" || r.Header.Get("Content-Type") != kafkaContentType {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	var req kafkaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offsets := make([]map[string]any, len(req.Records))
+	p.mu.Lock()
+	for i, record := range req.Records {
+		offsets[i] = map[string]any{"partition": 0, "offset": len(p.records), "error": nil}
+		if msg, ok := p.fail[record.Key]; ok {
+			offsets[i]["error"] = msg
+			continue
+		}
+		p.records = append(p.records, record)
+	}
+	p.mu.Unlock()
+	w.Header().Set("Content-Type", kafkaAccept)
+	_ = json.NewEncoder(w).Encode(map[string]any{"offsets": offsets})
+}
+
+func (p *restProxy) produced() []kafkaRecord {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]kafkaRecord(nil), p.records...)
+}
+
+func kafkaConfig(url string, queueSize int) config.Events {
+	return config.Events{
+		Publisher: "kafka",
+		QueueSize: queueSize,
+		Timeout:   5 * time.Second,
+		Kafka:     config.KafkaEvents{RESTProxyURL: url, Topic: "kii.balances"},
+	}
+}
+
+func TestKafka_Publish(t *testing.T) {
+	proxy := &restProxy{fail: map[string]string{"user3": "Topic authorization failed"}}
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+
+	emitter := &countingEmitter{}
+	publisher, err := NewKafka(kafkaConfig(server.URL, 100), emitter, logger.NewLogger())
+	if err != nil {
+		t.Fatalf("NewKafka() error = %v", err)
+	}
+	for i, user := range []string{"user1", "user2", "user1", "user3"} {
+		publisher.Publish(context.Background(), entity.BalanceEvent{ID: fmt.Sprintf("event-%d", i), User: user, Asset: "BTC", Amount: "1"})
+	}
+	// Queued events are sent before Close returns
+	publisher.Close()
+
+	records := proxy.produced()
+	if len(records) != 3 {
+		t.Fatalf("produced %+v, want the events of user1 and user2", records)
+	}
+	for i, want := range []string{"user1", "user2", "user1"} {
+		if records[i].Key != want || records[i].Value.ID != fmt.Sprintf("event-%d", i) {
+			t.Errorf("record %d = %+v, want event-%d keyed by %s", i, records[i], i, want)
+		}
+	}
+	sent := emitter.count("events.published publisher:kafka,result:" + ResultSent)
+	failed := emitter.count("events.published publisher:kafka,result:" + ResultFailed)
+	if sent+failed != 4 || failed == 0 {
+		t.Errorf("counted %d sent and %d failed, want 4 in all with the failed batch", sent, failed)
+	}
+
+	// Nothing is published once closed
+	publisher.Publish(context.Background(), entity.BalanceEvent{ID: "late", User: "user1"})
+	if len(proxy.produced()) != 3 {
+		t.Error("event published after Close was sent")
+	}
+}
+
+func TestKafka_DropsWhenQueueFull(t *testing.T) {
+	received := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+		_ = json.NewEncoder(w).Encode(map[string]any{"offsets": []any{}})
+	}))
+	defer server.Close()
+
+	emitter := &countingEmitter{}
+	publisher, err := NewKafka(kafkaConfig(server.URL, 1), emitter, logger.NewLogger())
+	if err != nil {
+		t.Fatalf("NewKafka() error = %v", err)
+	}
+	defer publisher.Close()
+	defer close(release)
+
+	publisher.Publish(context.Background(), entity.BalanceEvent{ID: "event-1", User: "user1"})
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("event was not sent")
+	}
+	// One event waits while the first is being sent; the next is dropped
+	publisher.Publish(context.Background(), entity.BalanceEvent{ID: "event-2", User: "user1"})
+	publisher.Publish(context.Background(), entity.BalanceEvent{ID: "event-3", User: "user1"})
+
+	if dropped := emitter.count("events.published publisher:kafka,result:" + ResultDropped); dropped != 1 {
+		t.Errorf("dropped %d events, want 1", dropped)
+	}
+}
+
+func TestNewKafka_InvalidConfig(t *testing.T) {
+	for _, cfg := range []config.Events{
+		kafkaConfig("", 10),
+		kafkaConfig("ftp://proxy.example", 10),
+		kafkaConfig("http://proxy.example", 0),
+		{QueueSize: 10, Kafka: config.KafkaEvents{RESTProxyURL: "http://proxy.example"}},
+	} {
+		if publisher, err := NewKafka(cfg, &countingEmitter{}, logger.NewLogger()); err == nil {
+			publisher.Close()
+			t.Errorf("NewKafka(%+v) error = nil, want error", cfg.Kafka)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/infrastructure/config"
+	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/metrics"
+)
+
+// errNotConnected is returned for events sent while the connection to the
+// NATS server is down, rather than buffering them until it is back
+var errNotConnected = errors.New("not connected to the NATS server")
+
+// natsSender publishes events on a subject of a NATS server. Each message
+// carries the event ID as Nats-Msg-Id, by which JetStream streams on the
+// subject drop duplicates.
+type natsSender struct {
+	conn    *nats.Conn
+	subject string
+}
+
+// NewNATS creates a publisher publishing events on cfg.NATS.Subject to the
+// NATS server at cfg.NATS.URL. The server need not be up yet: the connection
+// is retried in the background, and events sent meanwhile count as failed.
+func NewNATS(cfg config.Events, emitter metrics.Emitter, logger logger.Logger) (*Publisher, error) {
+	if cfg.NATS.URL == "" {
+		return nil, fmt.Errorf("events.nats.url is required")
+	}
+	if cfg.NATS.Subject == "" {
+		return nil, fmt.Errorf("events.nats.subject is required")
+	}
+	conn, err := nats.Connect(cfg.NATS.URL,
+		nats.Name("kii"),
+		nats.Timeout(cfg.Timeout),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid events.nats.url: %w", err)
+	}
+	return newPublisher("nats", &natsSender{conn: conn, subject: cfg.NATS.Subject}, cfg, emitter, logger)
+}
+
+// send publishes events and waits for the server to have received them
+func (s *natsSender) send(ctx context.Context, events []entity.BalanceEvent) error {
+	if !s.conn.IsConnected() {
+		return errNotConnected
+	}
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		msg := nats.NewMsg(s.subject)
+		msg.Header.Set(nats.MsgIdHdr, event.ID)
+		msg.Data = data
+		if err := s.conn.PublishMsg(msg); err != nil {
+			return err
+		}
+	}
+	return s.conn.FlushWithContext(ctx)
+}
+
+// close closes the connection
+func (s *natsSender) close() {
+	s.conn.Close()
+}
@@ -0,0 +1,166 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/infrastructure/config"
+	"kii.com/internal/infrastructure/logger"
+)
+
+// natsMessage is a message received by fakeNATS
+type natsMessage struct {
+	subject string
+	headers string
+	data    []byte
+}
+
+// fakeNATS speaks enough of the NATS client protocol to accept a connection
+// and record the messages published with headers
+type fakeNATS struct {
+	listener net.Listener
+	mu       sync.Mutex
+	messages []natsMessage
+}
+
+func newFakeNATS(t *testing.T) *fakeNATS {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	s := &fakeNATS{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { _ = listener.Close() })
+	return s
+}
+
+func (s *fakeNATS) url() string {
+	return "nats://" + s.listener.Addr().String()
+}
+
+func (s *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"fake\",\"version\":\"2.10.0\",\"proto\":1,\"headers\":true,\"max_payload\":1048576}\r\n")
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "PING":
+			fmt.Fprintf(conn, "PONG\r\n")
+		case "HPUB":
+			// HPUB <subject> <header bytes> <total bytes>
+			headerLen, _ := strconv.Atoi(fields[2])
+			totalLen, _ := strconv.Atoi(fields[3])
+			payload := make([]byte, totalLen+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, natsMessage{
+				subject: fields[1],
+				headers: string(payload[:headerLen]),
+				data:    payload[headerLen:totalLen],
+			})
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *fakeNATS) received() []natsMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]natsMessage(nil), s.messages...)
+}
+
+func TestNATS_Publish(t *testing.T) {
+	server := newFakeNATS(t)
+	emitter := &countingEmitter{}
+	publisher, err := NewNATS(config.Events{
+		Publisher: "nats",
+		QueueSize: 10,
+		Timeout:   5 * time.Second,
+		NATS:      config.NATSEvents{URL: server.url(), Subject: "kii.balances"},
+	}, emitter, logger.NewLogger())
+	if err != nil {
+		t.Fatalf("NewNATS() error = %v", err)
+	}
+
+	// The connection is made in the background
+	sender := publisher.sender.(*natsSender)
+	for deadline := time.Now().Add(5 * time.Second); !sender.conn.IsConnected() && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i := range 3 {
+		publisher.Publish(context.Background(), entity.BalanceEvent{ID: fmt.Sprintf("event-%d", i), User: "user1", Asset: "BTC", Amount: "1"})
+	}
+	publisher.Close()
+
+	messages := server.received()
+	if len(messages) != 3 {
+		t.Fatalf("received %d messages, want 3", len(messages))
+	}
+	for i, msg := range messages {
+		var event entity.BalanceEvent
+		if err := json.Unmarshal(msg.data, &event); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		id := fmt.Sprintf("event-%d", i)
+		if msg.subject != "kii.balances" || event.ID != id || !strings.Contains(msg.headers, "Nats-Msg-Id: "+id) {
+			t.Errorf("message %d = %s %q %+v, want %s on kii.balances", i, msg.subject, msg.headers, event, id)
+		}
+	}
+	if sent := emitter.count("events.published publisher:nats,result:" + ResultSent); sent != 3 {
+		t.Errorf("counted %d events sent, want 3", sent)
+	}
+}
+
+func TestNATS_NotConnected(t *testing.T) {
+	// Nothing listens on the port once the listener is closed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	url := "nats://" + listener.Addr().String()
+	_ = listener.Close()
+
+	emitter := &countingEmitter{}
+	publisher, err := NewNATS(config.Events{
+		QueueSize: 10,
+		Timeout:   time.Second,
+		NATS:      config.NATSEvents{URL: url, Subject: "kii.balances"},
+	}, emitter, logger.NewLogger())
+	if err != nil {
+		t.Fatalf("NewNATS() error = %v, want the connection retried", err)
+	}
+	publisher.Publish(context.Background(), entity.BalanceEvent{ID: "event-1", User: "user1"})
+	publisher.Close()
+
+	if failed := emitter.count("events.published publisher:nats,result:" + ResultFailed); failed != 1 {
+		t.Errorf("counted %d events failed, want 1", failed)
+	}
+}
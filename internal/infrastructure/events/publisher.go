@@ -0,0 +1,133 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/infrastructure/config"
+	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/metrics"
+	"kii.com/internal/infrastructure/queue"
+)
+
+// maxBatch is the most events sent to a broker at once
+const maxBatch = 100
+
+// Publishing results, tagged on the events.published counter
+const (
+	ResultSent    = "sent"
+	ResultFailed  = "failed"
+	ResultDropped = "dropped"
+)
+
+// sender delivers batches of events to a message broker
+type sender interface {
+	send(ctx context.Context, events []entity.BalanceEvent) error
+	close()
+}
+
+// Publisher sends balance events to a message broker in the background, in
+// the order they were published. Events published while its queue is full
+// are dropped, so a slow or unavailable broker never holds up the ledger.
+type Publisher struct {
+	name    string
+	sender  sender
+	timeout time.Duration
+	queue   *queue.Queue[entity.BalanceEvent]
+	metrics metrics.Emitter
+	logger  logger.Logger
+	closing sync.Once
+}
+
+// newPublisher starts publishing to s, which is named name in logs and
+// metrics
+func newPublisher(name string, s sender, cfg config.Events, emitter metrics.Emitter, logger logger.Logger) (*Publisher, error) {
+	if cfg.QueueSize < 1 {
+		s.close()
+		return nil, fmt.Errorf("events.queueSize must be positive")
+	}
+
+	p := &Publisher{
+		name:    name,
+		sender:  s,
+		timeout: cfg.Timeout,
+		metrics: emitter,
+		logger:  logger,
+	}
+	// One worker keeps the events in order
+	p.queue = queue.New(cfg.QueueSize, 1, p.run)
+	return p, nil
+}
+
+// Publish queues event. It never blocks.
+func (p *Publisher) Publish(_ context.Context, event entity.BalanceEvent) {
+	if errors.Is(p.queue.Push(event), queue.ErrFull) {
+		p.metrics.Count("events.published", 1, "publisher:"+p.name, "result:"+ResultDropped)
+	}
+}
+
+// run sends queued events, as many at once as are waiting up to maxBatch,
+// until the publisher is closed. Once ctx is cancelled the events left are
+// dropped.
+func (p *Publisher) run(ctx context.Context, events <-chan entity.BalanceEvent) {
+	for event := range events {
+		batch := fill(events, []entity.BalanceEvent{event})
+		if ctx.Err() != nil {
+			continue
+		}
+		result := ResultSent
+		sendCtx, cancel := context.WithTimeout(ctx, p.timeout)
+		err := p.sender.send(sendCtx, batch)
+		cancel()
+		if err != nil {
+			result = ResultFailed
+			if ctx.Err() == nil {
+				p.logger.LogWarning(ctx, "Failed to publish balance events",
+					"publisher", p.name,
+					"events", len(batch),
+					"error", err.Error())
+			}
+		}
+		p.metrics.Count("events.published", int64(len(batch)), "publisher:"+p.name, "result:"+result)
+	}
+}
+
+// fill adds the events waiting in events to batch, up to maxBatch
+func fill(events <-chan entity.BalanceEvent, batch []entity.BalanceEvent) []entity.BalanceEvent {
+	for len(batch) < maxBatch {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, event)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// QueueLength returns the number of events waiting to be sent
+func (p *Publisher) QueueLength() int {
+	return p.queue.Len()
+}
+
+// QueueCapacity returns the number of events that can wait to be sent
+// before more are dropped
+func (p *Publisher) QueueCapacity() int {
+	return p.queue.Cap()
+}
+
+// Close stops the publisher. Queued events are still sent for up to the
+// timeout of one batch; those left then are dropped.
+func (p *Publisher) Close() {
+	p.closing.Do(func() {
+		p.queue.CloseWithin(p.timeout)
+		p.sender.close()
+	})
+}
@@ -0,0 +1,224 @@
+// Package handover replaces the running binary without closing its listening
+// sockets: the old process starts the new one with the sockets as inherited
+// file descriptors and waits until it reports that it serves on them, so
+// connections are never refused during an upgrade
+package handover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const (
+	// fdsEnv holds the number of handed over listeners
+	fdsEnv = "KII_HANDOVER_FDS"
+	// pidEnv holds the pid of the process that handed them over
+	pidEnv = "KII_HANDOVER_PID"
+	// firstFD is the first inherited descriptor, as with socket activation;
+	// the readiness pipe follows the listeners
+	firstFD = 3
+)
+
+var (
+	// readyMu guards ready
+	readyMu sync.Mutex
+	// ready is the write end of the readiness pipe, set when the listeners
+	// were handed over
+	ready *os.File
+)
+
+// Listeners returns the listeners handed over by the parent process, or none
+// when the process was not started by a handover. The handover variables are
+// unset so that child processes do not take the listeners for theirs.
+func Listeners() ([]net.Listener, error) {
+	defer func() {
+		_ = os.Unsetenv(fdsEnv)
+		_ = os.Unsetenv(pidEnv)
+	}()
+	result, readyFile, err := listeners(os.Getenv, firstFD, os.Getppid())
+	if readyFile != nil {
+		readyMu.Lock()
+		ready = readyFile
+		readyMu.Unlock()
+	}
+	return result, err
+}
+
+// listeners returns the listeners passed from fd on and the readiness pipe
+// after them, as described by the handover variables read with getenv
+func listeners(getenv func(string) string, fd, ppid int) ([]net.Listener, *os.File, error) {
+	if pid, err := strconv.Atoi(getenv(pidEnv)); err != nil || pid != ppid {
+		return nil, nil, nil
+	}
+	count, err := strconv.Atoi(getenv(fdsEnv))
+	if err != nil || count < 0 {
+		return nil, nil, fmt.Errorf("invalid %s %q", fdsEnv, getenv(fdsEnv))
+	}
+
+	result := make([]net.Listener, 0, count)
+	for i := range count {
+		syscall.CloseOnExec(fd + i)
+		file := os.NewFile(uintptr(fd+i), "handover-"+strconv.Itoa(i))
+		listener, err := net.FileListener(file)
+		// FileListener works on a duplicate of the descriptor
+		_ = file.Close()
+		if err != nil {
+			for _, l := range result {
+				_ = l.Close()
+			}
+			return nil, nil, fmt.Errorf("handed over descriptor %d: %w", fd+i, err)
+		}
+		result = append(result, listener)
+	}
+	syscall.CloseOnExec(fd + count)
+	return result, os.NewFile(uintptr(fd+count), "handover-ready"), nil
+}
+
+// Ready tells the process that handed over the listeners that this one now
+// serves on them, after which it drains and exits. It does nothing when the
+// listeners were not handed over, and only the first call reports.
+func Ready() error {
+	readyMu.Lock()
+	defer readyMu.Unlock()
+	if ready == nil {
+		return nil
+	}
+	defer func() {
+		_ = ready.Close()
+		ready = nil
+	}()
+	if _, err := ready.Write([]byte{1}); err != nil {
+		return fmt.Errorf("failed to report handover readiness: %w", err)
+	}
+	return nil
+}
+
+// Start starts the running executable again, with the same arguments, and
+// hands it listeners. It returns the new process's pid once the process
+// reports Ready. When it exits first or ctx is done, the process is killed
+// and the listeners are left to the caller, who keeps serving on them.
+func Start(ctx context.Context, listeners []net.Listener) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("failed to locate the executable: %w", err)
+	}
+	return start(ctx, listeners, exe, os.Args[1:])
+}
+
+// start starts path with args and hands it listeners
+func start(ctx context.Context, listeners []net.Listener, path string, args []string) (int, error) {
+	if len(listeners) == 0 {
+		return 0, errors.New("no listeners to hand over")
+	}
+	fds := make([]int, 0, len(listeners))
+	defer func() {
+		for _, fd := range fds {
+			_ = syscall.Close(fd)
+		}
+	}()
+	for _, listener := range listeners {
+		fd, err := dupSocket(listener)
+		if err != nil {
+			return 0, fmt.Errorf("listener on %s cannot be handed over: %w", listener.Addr(), err)
+		}
+		fds = append(fds, fd)
+	}
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = readyReader.Close() }()
+
+	files := []uintptr{os.Stdin.Fd(), os.Stdout.Fd(), os.Stderr.Fd()}
+	for _, fd := range fds {
+		files = append(files, uintptr(fd))
+	}
+	files = append(files, readyWriter.Fd())
+	env := append(childEnv(os.Environ()),
+		fdsEnv+"="+strconv.Itoa(len(listeners)),
+		pidEnv+"="+strconv.Itoa(os.Getpid()))
+	pid, err := syscall.ForkExec(path, append([]string{path}, args...), &syscall.ProcAttr{Env: env, Files: files})
+	// Only the new process holds the write end now, so the read below ends
+	// when it reports or exits
+	_ = readyWriter.Close()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start the new process: %w", err)
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return 0, err
+	}
+
+	reported := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(readyReader, make([]byte, 1))
+		reported <- err
+	}()
+	select {
+	case err = <-reported:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		_ = process.Kill()
+		_, _ = process.Wait()
+		if errors.Is(err, io.EOF) {
+			return 0, errors.New("the new process exited before serving")
+		}
+		return 0, fmt.Errorf("the new process did not serve: %w", err)
+	}
+	go func() { _, _ = process.Wait() }()
+	return pid, nil
+}
+
+// dupSocket duplicates the listener's socket descriptor. Unlike handing over
+// its os.File, this leaves the socket nonblocking: the mode is shared with
+// the listener, which this process keeps accepting on until it drains.
+func dupSocket(listener net.Listener) (int, error) {
+	conn, ok := listener.(syscall.Conn)
+	if !ok {
+		return 0, errors.New("no socket descriptor")
+	}
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var fd int
+	var dupErr error
+	err = raw.Control(func(s uintptr) {
+		var r uintptr
+		var errno syscall.Errno
+		r, _, errno = syscall.Syscall(syscall.SYS_FCNTL, s, syscall.F_DUPFD_CLOEXEC, 0)
+		fd = int(r)
+		if errno != 0 {
+			dupErr = errno
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	return fd, dupErr
+}
+
+// childEnv returns env without the handover variables of an earlier handover
+// and without WATCHDOG_PID, which names this process: the new one takes over
+// the watchdog once systemd knows it as the main process
+func childEnv(env []string) []string {
+	result := make([]string, 0, len(env))
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if name == fdsEnv || name == pidEnv || name == "WATCHDOG_PID" {
+			continue
+		}
+		result = append(result, kv)
+	}
+	return result
+}
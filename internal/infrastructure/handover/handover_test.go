@@ -0,0 +1,152 @@
+package handover
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// helperEnv makes the test binary act as the new process in TestHelperProcess
+const helperEnv = "KII_HANDOVER_TEST_HELPER"
+
+// TestHelperProcess is the new process started by TestStart. It takes over
+// the listener and answers one connection, or exits without serving.
+func TestHelperProcess(t *testing.T) {
+	mode := os.Getenv(helperEnv)
+	if mode == "" {
+		t.Skip("started by TestStart only")
+	}
+	if mode == "fail" {
+		os.Exit(1)
+	}
+
+	got, err := Listeners()
+	if err != nil || len(got) != 1 {
+		os.Exit(2)
+	}
+	if err := Ready(); err != nil {
+		os.Exit(3)
+	}
+	conn, err := got[0].Accept()
+	if err != nil {
+		os.Exit(4)
+	}
+	_, _ = conn.Write([]byte("new"))
+	_ = conn.Close()
+	os.Exit(0)
+}
+
+func TestStart(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer listener.Close()
+	args := []string{"-test.run=^TestHelperProcess$"}
+
+	t.Run("new process exits", func(t *testing.T) {
+		t.Setenv(helperEnv, "fail")
+		if _, err := start(context.Background(), []net.Listener{listener}, os.Args[0], args); err == nil {
+			t.Fatal("start() error = nil, want the exit reported")
+		}
+	})
+
+	t.Run("new process serves", func(t *testing.T) {
+		t.Setenv(helperEnv, "serve")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		pid, err := start(ctx, []net.Listener{listener}, os.Args[0], args)
+		if err != nil {
+			t.Fatalf("start() error = %v", err)
+		}
+		if pid == os.Getpid() || pid <= 0 {
+			t.Errorf("start() pid = %d, want the new process", pid)
+		}
+
+		// The old listener still honours deadlines, which a socket left in
+		// blocking mode would not
+		_ = listener.(*net.TCPListener).SetDeadline(time.Now().Add(50 * time.Millisecond))
+		if _, err := listener.Accept(); !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("Accept() on the old listener error = %v, want %v", err, os.ErrDeadlineExceeded)
+		}
+
+		// The old listener is not accepted from, so the new process answers
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("Dial() error = %v", err)
+		}
+		defer conn.Close()
+		_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		body, err := io.ReadAll(conn)
+		if err != nil || string(body) != "new" {
+			t.Errorf("read %q, %v, want %q", body, err, "new")
+		}
+	})
+}
+
+func TestListeners(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer tcp.Close()
+	file, err := tcp.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	defer file.Close()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Pipe() error = %v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	// listeners takes ownership of consecutive descriptors, as of those the
+	// parent passes
+	const fd = 100
+	if err := syscall.Dup2(int(file.Fd()), fd); err != nil {
+		t.Fatalf("Dup2() error = %v", err)
+	}
+	if err := syscall.Dup2(int(w.Fd()), fd+1); err != nil {
+		t.Fatalf("Dup2() error = %v", err)
+	}
+
+	env := map[string]string{fdsEnv: "1", pidEnv: "42"}
+	got, readyFile, err := listeners(func(key string) string { return env[key] }, fd, 42)
+	if err != nil {
+		t.Fatalf("listeners() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Addr().String() != tcp.Addr().String() {
+		t.Fatalf("listeners() = %v, want the listener on %s", got, tcp.Addr())
+	}
+	_ = got[0].Close()
+	if _, err := readyFile.Write([]byte{1}); err != nil {
+		t.Errorf("writing the readiness pipe: %v", err)
+	}
+	_ = readyFile.Close()
+	buf := make([]byte, 1)
+	if n, err := r.Read(buf); n != 1 || err != nil {
+		t.Errorf("readiness pipe read %d, %v, want 1 byte", n, err)
+	}
+
+	// A handover meant for another process is ignored
+	if got, readyFile, err := listeners(func(key string) string { return env[key] }, fd, 43); len(got) != 0 || readyFile != nil || err != nil {
+		t.Errorf("listeners() for another process = %v, %v, %v, want none", got, readyFile, err)
+	}
+}
+
+func TestChildEnv(t *testing.T) {
+	env := []string{"PATH=/bin", fdsEnv + "=1", pidEnv + "=" + strconv.Itoa(os.Getpid()), "WATCHDOG_PID=1", "WATCHDOG_USEC=1000"}
+	got := childEnv(env)
+	want := []string{"PATH=/bin", "WATCHDOG_USEC=1000"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("childEnv() = %v, want %v", got, want)
+	}
+}
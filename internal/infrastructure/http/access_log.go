@@ -0,0 +1,123 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Access log formats
+const (
+	AccessLogCommon   = "common"
+	AccessLogCombined = "combined"
+)
+
+// clfTimeFormat is the timestamp layout used by Common Log Format
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLog writes one line per request in Common or Combined Log Format
+type AccessLog struct {
+	mu       sync.Mutex
+	w        io.Writer
+	combined bool
+}
+
+// NewAccessLog creates an access log writing to w in the given format
+// (common or combined)
+func NewAccessLog(w io.Writer, format string) (*AccessLog, error) {
+	switch format {
+	case AccessLogCommon:
+		return &AccessLog{w: w}, nil
+	case AccessLogCombined:
+		return &AccessLog{w: w, combined: true}, nil
+	default:
+		return nil, fmt.Errorf("unsupported access log format %q (want common or combined)", format)
+	}
+}
+
+// accessLogResponseWriter captures the status and size of a response
+type accessLogResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	bytes      int
+}
+
+func (rw *accessLogResponseWriter) WriteHeader(code int) {
+	if rw.statusCode == 0 {
+		rw.statusCode = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *accessLogResponseWriter) Write(b []byte) (int, error) {
+	if rw.statusCode == 0 {
+		rw.statusCode = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer to flush
+func (rw *accessLogResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// AccessLogMiddleware writes an access log line for every request. It is a
+// no-op when accessLog is nil.
+func AccessLogMiddleware(next http.HandlerFunc, accessLog *AccessLog) http.HandlerFunc {
+	if accessLog == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		wrapped := &accessLogResponseWriter{ResponseWriter: w}
+
+		next(wrapped, r)
+
+		if wrapped.statusCode == 0 {
+			wrapped.statusCode = http.StatusOK
+		}
+		accessLog.write(r, start, wrapped.statusCode, wrapped.bytes)
+	}
+}
+
+// write formats and writes a single access log line
+func (a *AccessLog) write(r *http.Request, start time.Time, status, size int) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	user := "-"
+	if username, _, ok := r.BasicAuth(); ok && username != "" {
+		user = username
+	}
+	sizeField := "-"
+	if size > 0 {
+		sizeField = strconv.Itoa(size)
+	}
+
+	line := fmt.Sprintf("%s - %s [%s] %s %d %s",
+		host, user, start.Format(clfTimeFormat),
+		strconv.Quote(r.Method+" "+r.URL.RequestURI()+" "+r.Proto),
+		status, sizeField)
+	if a.combined {
+		line += " " + quoteOrDash(r.Referer()) + " " + quoteOrDash(r.UserAgent())
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, _ = io.WriteString(a.w, line+"\n")
+}
+
+// quoteOrDash quotes s, or returns "-" (quoted) when it is empty
+func quoteOrDash(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	return strconv.Quote(s)
+}
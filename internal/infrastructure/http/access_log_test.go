@@ -0,0 +1,59 @@
+package http
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestAccessLogMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		handler http.HandlerFunc
+		want    string
+	}{
+		{
+			name:   "common",
+			format: AccessLogCommon,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("hello"))
+			},
+			want: `^192\.0\.2\.1 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /balance/user1\?x=1 HTTP/1\.1" 200 5$`,
+		},
+		{
+			name:   "combined with empty body",
+			format: AccessLogCombined,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+			want: `^192\.0\.2\.1 - - \[.+\] "GET /balance/user1\?x=1 HTTP/1\.1" 204 - "https://example\.com/" "kii-test/1\.0"$`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			accessLog, err := NewAccessLog(&buf, tt.format)
+			if err != nil {
+				t.Fatalf("NewAccessLog() error = %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/balance/user1?x=1", nil)
+			req.Header.Set("Referer", "https://example.com/")
+			req.Header.Set("User-Agent", "kii-test/1.0")
+			AccessLogMiddleware(tt.handler, accessLog)(httptest.NewRecorder(), req)
+
+			line := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+			if !regexp.MustCompile(tt.want).Match(line) {
+				t.Errorf("access log line = %q, want match for %s", line, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewAccessLog(&bytes.Buffer{}, "json"); err == nil {
+		t.Error("NewAccessLog() with unknown format should fail")
+	}
+}
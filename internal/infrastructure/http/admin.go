@@ -0,0 +1,963 @@
+package http
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"maps"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"kii.com/internal/application/usecase"
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+	"kii.com/internal/infrastructure/audit"
+	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/metrics"
+)
+
+// AdminHandler holds the operator-facing admin API handlers
+type AdminHandler struct {
+	nonceStore port.NonceStore
+	stats      *metrics.Collector
+	audit      *audit.Logger
+	logLevel   *slog.LevelVar
+	capture    *DebugCapture
+	export     *usecase.StreamLedgerUseCase
+	usage      *metrics.UsageMeter
+	pending    port.PendingEntryStore
+	approver   PendingApprover
+	releaser   HoldReleaser
+	archive    port.LedgerArchive
+	holdings   *usecase.QueryHoldingsUseCase
+	queue      WorkQueue
+	tolerances map[string]ToleranceValidator
+	skew       *metrics.SkewTracker
+	duplicates port.DuplicateStore
+	freezes    port.AssetFreezeStore
+	readOnly   bool
+	logger     logger.Logger
+}
+
+// AdminOption configures optional AdminHandler dependencies
+type AdminOption func(*AdminHandler)
+
+// WithAdminDebugCapture exposes /admin/debug-capture to manage which sources
+// have failed webhooks captured
+func WithAdminDebugCapture(capture *DebugCapture) AdminOption {
+	return func(h *AdminHandler) {
+		h.capture = capture
+	}
+}
+
+// WithAdminExport serves GET /export, streaming every ledger entry
+func WithAdminExport(streamLedgerUseCase *usecase.StreamLedgerUseCase) AdminOption {
+	return func(h *AdminHandler) {
+		h.export = streamLedgerUseCase
+	}
+}
+
+// WithAdminUsage serves GET /admin/usage, the monthly usage report per tenant
+func WithAdminUsage(meter *metrics.UsageMeter) AdminOption {
+	return func(h *AdminHandler) {
+		h.usage = meter
+	}
+}
+
+// WithAdminPending serves /admin/pending to list and reject entries parked
+// for approval
+func WithAdminPending(store port.PendingEntryStore) AdminOption {
+	return func(h *AdminHandler) {
+		h.pending = store
+	}
+}
+
+// PendingApprover applies entries parked for approval
+type PendingApprover interface {
+	ApprovePending(ctx context.Context, id string) (entity.PendingEntry, error)
+}
+
+// WithAdminApprover serves POST /admin/pending/{id}/approve, letting an
+// operator apply a parked entry after reviewing it. It needs WithAdminPending.
+func WithAdminApprover(approver PendingApprover) AdminOption {
+	return func(h *AdminHandler) {
+		h.approver = approver
+	}
+}
+
+// HoldReleaser releases the hold of a rejected pending entry
+type HoldReleaser interface {
+	ReleaseHold(ctx context.Context, id string) error
+}
+
+// WithAdminHoldReleaser releases the hold of every entry rejected with
+// DELETE /admin/pending/{id}, so its amount is available again at once
+func WithAdminHoldReleaser(releaser HoldReleaser) AdminOption {
+	return func(h *AdminHandler) {
+		h.releaser = releaser
+	}
+}
+
+// WithAdminArchive serves /admin/archives to list and read the segments of
+// entries pruned from the ledger
+func WithAdminArchive(archive port.LedgerArchive) AdminOption {
+	return func(h *AdminHandler) {
+		h.archive = archive
+	}
+}
+
+// WithAdminHoldings serves GET /admin/holders and GET /admin/distribution,
+// ranking the holders of each asset and bucketing their balances
+func WithAdminHoldings(queryHoldingsUseCase *usecase.QueryHoldingsUseCase) AdminOption {
+	return func(h *AdminHandler) {
+		h.holdings = queryHoldingsUseCase
+	}
+}
+
+// WorkQueue is the queue webhooks wait in for a worker
+type WorkQueue interface {
+	QueueLength() int
+	QueueCapacity() int
+}
+
+// WithAdminQueue adds the length and capacity of the webhook queue to
+// /admin/stats
+func WithAdminQueue(queue WorkQueue) AdminOption {
+	return func(h *AdminHandler) {
+		h.queue = queue
+	}
+}
+
+// ToleranceValidator is a webhook validator whose timestamp tolerance can be
+// read and changed while it runs
+type ToleranceValidator interface {
+	TimestampTolerance() time.Duration
+	SetTimestampTolerance(tolerance time.Duration)
+}
+
+// WithAdminTolerances serves /admin/tolerances to read and change the
+// timestamp tolerance of each webhook source's validator
+func WithAdminTolerances(validators map[string]ToleranceValidator) AdminOption {
+	return func(h *AdminHandler) {
+		h.tolerances = validators
+	}
+}
+
+// WithAdminClockSkew serves GET /admin/clock-skew, the distribution of the
+// clock skew of recent webhooks per source
+func WithAdminClockSkew(tracker *metrics.SkewTracker) AdminOption {
+	return func(h *AdminHandler) {
+		h.skew = tracker
+	}
+}
+
+// WithAdminDuplicates serves DELETE /admin/duplicates/{key} to forget the
+// digest of a webhook flagged as a duplicate
+func WithAdminDuplicates(store port.DuplicateStore) AdminOption {
+	return func(h *AdminHandler) {
+		h.duplicates = store
+	}
+}
+
+// WithAdminFreezes serves /admin/freezes, pausing webhooks of an asset
+func WithAdminFreezes(store port.AssetFreezeStore) AdminOption {
+	return func(h *AdminHandler) {
+		h.freezes = store
+	}
+}
+
+// WithAdminReadOnly refuses the routes that change pending entries, nonces,
+// duplicates and freezes with ErrReadOnly, for replicas that leave the ledger
+// and the stores shared with it to the server that writes them. Reads are
+// still served.
+func WithAdminReadOnly(enabled bool) AdminOption {
+	return func(h *AdminHandler) {
+		h.readOnly = enabled
+	}
+}
+
+// NewAdminHandler creates a new admin API handler
+func NewAdminHandler(
+	nonceStore port.NonceStore,
+	stats *metrics.Collector,
+	auditLog *audit.Logger,
+	logLevel *slog.LevelVar,
+	logger logger.Logger,
+	opts ...AdminOption,
+) *AdminHandler {
+	h := &AdminHandler{
+		nonceStore: nonceStore,
+		stats:      stats,
+		audit:      auditLog,
+		logLevel:   logLevel,
+		logger:     logger,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// AdminAuthMiddleware rejects requests without a matching bearer token.
+// Reads may instead give the token as the Basic auth password, which is what
+// a browser sends once the admin UI has prompted for it. Writes need the
+// bearer token, so credentials the browser caches cannot be used by other
+// sites to change anything.
+func AdminAuthMiddleware(next http.HandlerFunc, token string) http.HandlerFunc {
+	return adminAuth(next, token, `Bearer realm="kii-admin"`)
+}
+
+// adminAuth is AdminAuthMiddleware answering with challenge when the token is
+// missing
+func adminAuth(next http.HandlerFunc, token, challenge string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			_, provided, ok = r.BasicAuth()
+		}
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", challenge)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// HandleNonces handles GET and DELETE /admin/nonces requests
+func (h *AdminHandler) HandleNonces(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	requestLogger := ctx.Value("logger").(logger.Logger)
+
+	switch r.Method {
+	case http.MethodGet:
+		limit := 100
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			parsed, err := strconv.Atoi(limitStr)
+			if err != nil || parsed < 0 {
+				http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+				return
+			}
+			limit = parsed
+		}
+
+		records := h.nonceStore.List(r.URL.Query().Get("prefix"), limit)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"total":  h.nonceStore.Len(),
+			"nonces": records,
+		})
+
+	case http.MethodDelete:
+		purged := h.nonceStore.Purge()
+		requestLogger.LogWarning(ctx, "Nonce store purged", "purged", purged)
+		h.auditAction(r, "nonce.purge", map[string]string{"purged": strconv.Itoa(purged)})
+		writeJSON(w, http.StatusOK, map[string]int{"purged": purged})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleNonce handles DELETE /admin/nonces/{nonce} requests, forgetting the
+// nonce used by the webhook source named by ?tenant=, or by the default
+// endpoint without it
+func (h *AdminHandler) HandleNonce(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	requestLogger := ctx.Value("logger").(logger.Logger)
+
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	nonce := strings.TrimPrefix(r.URL.Path, "/admin/nonces/")
+	if nonce == "" {
+		http.Error(w, "Missing nonce parameter", http.StatusBadRequest)
+		return
+	}
+
+	tenant := strings.ToLower(r.URL.Query().Get("tenant"))
+	if !h.nonceStore.Delete(tenant, nonce) {
+		http.Error(w, "Nonce not found", http.StatusNotFound)
+		return
+	}
+
+	requestLogger.LogWarning(ctx, "Nonce deleted", "tenant", tenant, "nonce", nonce)
+	details := map[string]string{"nonce": nonce}
+	if tenant != "" {
+		details["tenant"] = tenant
+	}
+	h.auditAction(r, "nonce.delete", details)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleDuplicate handles DELETE /admin/duplicates/{key} requests,
+// forgetting the digest logged as key with a duplicate webhook so that a
+// legitimate resend of it is accepted within the window
+func (h *AdminHandler) HandleDuplicate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	requestLogger := ctx.Value("logger").(logger.Logger)
+
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/admin/duplicates/")
+	if key == "" {
+		http.Error(w, "Missing key parameter", http.StatusBadRequest)
+		return
+	}
+	if !h.duplicates.Forget(key) {
+		http.Error(w, "Duplicate key not found", http.StatusNotFound)
+		return
+	}
+
+	requestLogger.LogWarning(ctx, "Duplicate key deleted", "key", key)
+	h.auditAction(r, "duplicate.delete", map[string]string{"key": key})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleFreezes handles GET /admin/freezes requests, listing the frozen
+// assets
+func (h *AdminHandler) HandleFreezes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]entity.AssetFreeze{"freezes": h.freezes.List()})
+}
+
+// HandleFreeze handles GET /admin/freezes/{asset} requests, PUT ones
+// freezing the asset with an optional {"reason":"..."} and DELETE ones
+// unfreezing it
+func (h *AdminHandler) HandleFreeze(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	requestLogger := ctx.Value("logger").(logger.Logger)
+
+	asset := strings.TrimPrefix(r.URL.Path, "/admin/freezes/")
+	if asset == "" {
+		http.Error(w, "Missing asset", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		freeze, ok := h.freezes.Frozen(asset)
+		if !ok {
+			http.Error(w, "Asset not frozen", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, freeze)
+
+	case http.MethodPut:
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+		}
+		freeze := entity.AssetFreeze{Asset: asset, Reason: req.Reason, FrozenAt: time.Now().UTC()}
+		if err := h.freezes.Freeze(freeze); err != nil {
+			requestLogger.LogError(ctx, "Failed to freeze asset", err, "asset", asset)
+			http.Error(w, "Failed to freeze asset", http.StatusInternalServerError)
+			return
+		}
+		requestLogger.LogWarning(ctx, "Asset frozen", "asset", asset, "reason", req.Reason)
+		h.auditAction(r, "asset.freeze", map[string]string{"asset": asset, "reason": req.Reason})
+		writeJSON(w, http.StatusOK, freeze)
+
+	case http.MethodDelete:
+		ok, err := h.freezes.Unfreeze(asset)
+		if err != nil {
+			requestLogger.LogError(ctx, "Failed to unfreeze asset", err, "asset", asset)
+			http.Error(w, "Failed to unfreeze asset", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Asset not frozen", http.StatusNotFound)
+			return
+		}
+		requestLogger.LogWarning(ctx, "Asset unfrozen", "asset", asset)
+		h.auditAction(r, "asset.unfreeze", map[string]string{"asset": asset})
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleUsage handles GET /admin/usage requests. The month query parameter
+// (YYYY-MM) defaults to the current month.
+func (h *AdminHandler) HandleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	month := r.URL.Query().Get("month")
+	if month == "" {
+		month = h.usage.CurrentMonth()
+	}
+	if _, err := time.Parse(metrics.UsageMonthFormat, month); err != nil {
+		http.Error(w, "Invalid month parameter, want YYYY-MM", http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		metrics.UsageReport
+		Months []string `json:"months"`
+	}{
+		UsageReport: h.usage.Report(month),
+		Months:      h.usage.Months(),
+	})
+}
+
+// HandlePending handles GET /admin/pending requests, optionally limited to
+// the entries parked by ?policy=
+func (h *AdminHandler) HandlePending(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	entries := h.pending.List()
+	if policyStr := r.URL.Query().Get("policy"); policyStr != "" {
+		policy, err := entity.ParsePendingPolicy(policyStr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filtered := entries[:0]
+		for _, entry := range entries {
+			if entry.Policy == policy {
+				filtered = append(filtered, entry)
+			}
+		}
+		entries = filtered
+	}
+	writeJSON(w, http.StatusOK, map[string][]entity.PendingEntry{"pending": entries})
+}
+
+// HandlePendingEntry handles DELETE /admin/pending/{id} requests, rejecting
+// the entry so it is never applied, and POST /admin/pending/{id}/approve
+// requests, applying it
+func (h *AdminHandler) HandlePendingEntry(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	requestLogger := ctx.Value("logger").(logger.Logger)
+
+	id := strings.TrimPrefix(r.URL.Path, "/admin/pending/")
+	if approveID, ok := strings.CutSuffix(id, "/approve"); ok && h.approver != nil {
+		h.approvePending(w, r, approveID)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if id == "" {
+		http.Error(w, "Missing pending entry ID", http.StatusBadRequest)
+		return
+	}
+
+	pending, ok := h.pending.Get(id)
+	if !ok || !h.pending.Delete(id) {
+		http.Error(w, "Pending entry not found", http.StatusNotFound)
+		return
+	}
+
+	if h.releaser != nil {
+		// The hold expires with the entry anyway, so this is only logged
+		if err := h.releaser.ReleaseHold(ctx, id); err != nil {
+			requestLogger.LogError(ctx, "Failed to release hold", err, "pending_id", id)
+		}
+	}
+	requestLogger.LogWarning(ctx, "Pending entry rejected", "pending_id", id, "policy", string(pending.Policy))
+	h.auditAction(r, "pending.reject", map[string]string{
+		"pending_id": id,
+		"policy":     string(pending.Policy),
+		"user":       pending.Entry.User,
+		"asset":      pending.Entry.Asset,
+		"amount":     pending.Entry.Amount,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// approvePending applies the pending entry id on an operator's decision
+func (h *AdminHandler) approvePending(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+	requestLogger := ctx.Value("logger").(logger.Logger)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pending, err := h.approver.ApprovePending(ctx, id)
+	if errors.Is(err, entity.ErrPendingNotFound) {
+		http.Error(w, "Pending entry not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, entity.ErrAssetFrozen) {
+		http.Error(w, "Asset "+pending.Entry.Asset+" is frozen", http.StatusLocked)
+		return
+	}
+	if err != nil {
+		requestLogger.LogError(ctx, "Failed to apply approved entry", err, "pending_id", id)
+		http.Error(w, "Failed to apply entry", http.StatusInternalServerError)
+		return
+	}
+
+	requestLogger.LogWarning(ctx, "Pending entry approved", "pending_id", id, "policy", string(pending.Policy))
+	h.auditAction(r, "pending.approve", map[string]string{
+		"pending_id": id,
+		"policy":     string(pending.Policy),
+		"user":       pending.Entry.User,
+		"asset":      pending.Entry.Asset,
+		"amount":     pending.Entry.Amount,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleStats handles GET /admin/stats requests
+func (h *AdminHandler) HandleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	top := 10
+	if topStr := r.URL.Query().Get("top"); topStr != "" {
+		parsed, err := strconv.Atoi(topStr)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid top parameter", http.StatusBadRequest)
+			return
+		}
+		top = parsed
+	}
+	labels, err := entity.ParseLabelSelector(r.URL.Query()["label"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := struct {
+		metrics.Snapshot
+		NonceStoreSize int         `json:"nonceStoreSize"`
+		Queue          *queueStats `json:"queue,omitempty"`
+	}{
+		Snapshot:       h.stats.Snapshot(top),
+		NonceStoreSize: h.nonceStore.Len(),
+	}
+	// Only the counts of the selected labels are reported
+	if len(labels) > 0 {
+		maps.DeleteFunc(resp.EntriesByLabel, func(pair string, _ uint64) bool {
+			return !labels.MatchesPair(pair)
+		})
+	}
+	if h.queue != nil {
+		resp.Queue = &queueStats{Length: h.queue.QueueLength(), Capacity: h.queue.QueueCapacity()}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// queueStats is how full the webhook queue is
+type queueStats struct {
+	Length   int `json:"length"`
+	Capacity int `json:"capacity"`
+}
+
+// HandleLogLevel handles GET and PUT /admin/log-level requests
+func (h *AdminHandler) HandleLogLevel(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	requestLogger := ctx.Value("logger").(logger.Logger)
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]string{"level": levelName(h.logLevel.Level())})
+
+	case http.MethodPut:
+		var req struct {
+			Level string `json:"level"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		level, err := logger.ParseLevel(req.Level)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		previous := h.logLevel.Level()
+		h.logLevel.Set(level)
+		requestLogger.LogWarning(ctx, "Log level changed", "from", levelName(previous), "to", levelName(level))
+		h.auditAction(r, "log_level.set", map[string]string{"from": levelName(previous), "to": levelName(level)})
+		writeJSON(w, http.StatusOK, map[string]string{"level": levelName(level)})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleDebugCapture handles GET, PUT and DELETE /admin/debug-capture requests
+func (h *AdminHandler) HandleDebugCapture(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	requestLogger := ctx.Value("logger").(logger.Logger)
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string][]string{"sources": h.capture.Sources()})
+
+	case http.MethodPut, http.MethodDelete:
+		var req struct {
+			Sources []string `json:"sources"`
+		}
+		if r.Method == http.MethodPut {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+		}
+		if err := h.capture.SetSources(req.Sources); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sources := h.capture.Sources()
+		requestLogger.LogWarning(ctx, "Debug capture sources changed", "sources", sources)
+		h.auditAction(r, "debug_capture.set", map[string]string{"sources": strings.Join(sources, ",")})
+		writeJSON(w, http.StatusOK, map[string][]string{"sources": sources})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// toleranceResponse is the timestamp tolerance of a webhook source
+type toleranceResponse struct {
+	Source    string  `json:"source"`
+	Tolerance string  `json:"tolerance"`
+	Seconds   float64 `json:"seconds"`
+}
+
+// newToleranceResponse describes the tolerance of source
+func newToleranceResponse(source string, tolerance time.Duration) toleranceResponse {
+	return toleranceResponse{Source: source, Tolerance: tolerance.String(), Seconds: tolerance.Seconds()}
+}
+
+// tolerancesResponse lists the timestamp tolerances of the webhook sources,
+// and how long used nonces are remembered when the nonce store tells
+type tolerancesResponse struct {
+	Tolerances            []toleranceResponse `json:"tolerances"`
+	NonceRetention        string              `json:"nonceRetention,omitempty"`
+	NonceRetentionSeconds float64             `json:"nonceRetentionSeconds,omitempty"`
+}
+
+// HandleTolerances handles GET /admin/tolerances requests, listing the
+// timestamp tolerance of every webhook source by name
+func (h *AdminHandler) HandleTolerances(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	names := make([]string, 0, len(h.tolerances))
+	for name := range h.tolerances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tolerances := make([]toleranceResponse, len(names))
+	for i, name := range names {
+		tolerances[i] = newToleranceResponse(name, h.tolerances[name].TimestampTolerance())
+	}
+	resp := tolerancesResponse{Tolerances: tolerances}
+	if store, ok := h.nonceStore.(interface{ Retention() time.Duration }); ok {
+		resp.NonceRetention = store.Retention().String()
+		resp.NonceRetentionSeconds = store.Retention().Seconds()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// HandleTolerance handles GET and PUT /admin/tolerances/{source} requests
+func (h *AdminHandler) HandleTolerance(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	requestLogger := ctx.Value("logger").(logger.Logger)
+
+	source := strings.TrimPrefix(r.URL.Path, "/admin/tolerances/")
+	validator, ok := h.tolerances[source]
+	if !ok {
+		http.Error(w, "Webhook source not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, newToleranceResponse(source, validator.TimestampTolerance()))
+
+	case http.MethodPut:
+		var req struct {
+			Tolerance string `json:"tolerance"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		tolerance, err := time.ParseDuration(req.Tolerance)
+		if err != nil || tolerance <= 0 {
+			http.Error(w, "tolerance must be a positive duration such as 30s or 10m", http.StatusBadRequest)
+			return
+		}
+
+		previous := validator.TimestampTolerance()
+		validator.SetTimestampTolerance(tolerance)
+		requestLogger.LogWarning(ctx, "Timestamp tolerance changed",
+			"source", source,
+			"from", previous.String(),
+			"to", tolerance.String())
+		h.auditAction(r, "tolerance.set", map[string]string{
+			"source": source,
+			"from":   previous.String(),
+			"to":     tolerance.String(),
+		})
+		writeJSON(w, http.StatusOK, newToleranceResponse(source, tolerance))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleClockSkew handles GET /admin/clock-skew requests
+func (h *AdminHandler) HandleClockSkew(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]metrics.SourceSkew{"sources": h.skew.Snapshot()})
+}
+
+// levelName returns the lower-case name of a log level
+func levelName(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
+
+// auditAction records a state-changing admin call in the audit log
+func (h *AdminHandler) auditAction(r *http.Request, action string, details map[string]string) {
+	details["action"] = action
+	h.audit.Record(r.Context(), audit.Event{
+		Type:       audit.EventAdminAction,
+		RemoteAddr: r.RemoteAddr,
+		Details:    details,
+	})
+}
+
+// HandleExport handles GET /export requests, streaming the full ledger as
+// NDJSON, or the page of it selected by ?after=, ?limit= and ?label=
+func (h *AdminHandler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	page, err := historyPage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	details := map[string]string{}
+	if page.After > 0 {
+		details["after"] = strconv.FormatUint(page.After, 10)
+	}
+	if labels := r.URL.Query()["label"]; len(labels) > 0 {
+		details["labels"] = strings.Join(labels, ",")
+	}
+	h.auditAction(r, "ledger.export", details)
+	streamNDJSON(w, r, builtInErrorCatalog, func(ctx context.Context, emit func(entity.LedgerEntry) error) error {
+		return h.export.Execute(ctx, "", page, emit)
+	})
+}
+
+// HandleArchives handles GET /admin/archives requests, listing the archive
+// segments in sequence order
+func (h *AdminHandler) HandleArchives(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	requestLogger := ctx.Value("logger").(logger.Logger)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	segments, err := h.archive.Segments(ctx)
+	if err != nil {
+		requestLogger.LogError(ctx, "Failed to list archive segments", err)
+		http.Error(w, "Failed to list archive segments", http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"segments": segments})
+}
+
+// HandleArchiveSegment handles GET /admin/archives/{segment} requests,
+// streaming the segment's entries as NDJSON
+func (h *AdminHandler) HandleArchiveSegment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	segment := strings.TrimPrefix(r.URL.Path, "/admin/archives/")
+
+	h.auditAction(r, "ledger.archive_read", map[string]string{"segment": segment})
+	streamNDJSON(w, r, builtInErrorCatalog, func(ctx context.Context, emit func(entity.LedgerEntry) error) error {
+		return h.archive.EachEntry(ctx, segment, emit)
+	})
+}
+
+// HandleHolders handles GET /admin/holders requests, listing the ?top= (10
+// by default) users with the largest balances of ?asset=
+func (h *AdminHandler) HandleHolders(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	requestLogger := ctx.Value("logger").(logger.Logger)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	top := 10
+	if topStr := r.URL.Query().Get("top"); topStr != "" {
+		parsed, err := strconv.Atoi(topStr)
+		if err != nil || parsed < 1 {
+			http.Error(w, "Invalid top parameter", http.StatusBadRequest)
+			return
+		}
+		top = parsed
+	}
+	asset := r.URL.Query().Get("asset")
+
+	holders, err := h.holdings.TopHolders(ctx, asset, top)
+	if err != nil {
+		if !errors.Is(err, entity.ErrMissingAsset) {
+			requestLogger.LogError(ctx, "Failed to rank holders", err, "asset", asset)
+		}
+		writeError(w, err)
+		return
+	}
+	h.auditAction(r, "holders.read", map[string]string{"asset": asset, "top": strconv.Itoa(top)})
+	writeJSON(w, http.StatusOK, struct {
+		Asset   string          `json:"asset"`
+		Holders []entity.Holder `json:"holders"`
+	}{Asset: asset, Holders: holders})
+}
+
+// HandleDistribution handles GET /admin/distribution requests, bucketing the
+// balances of ?asset=, or of every asset without it, by power of ten
+func (h *AdminHandler) HandleDistribution(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	requestLogger := ctx.Value("logger").(logger.Logger)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	asset := r.URL.Query().Get("asset")
+
+	distributions, err := h.holdings.Distributions(ctx, asset)
+	if err != nil {
+		requestLogger.LogError(ctx, "Failed to compute balance distribution", err, "asset", asset)
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]entity.BalanceDistribution{"assets": distributions})
+}
+
+// RegisterRoutes registers the admin routes on mux behind token auth
+func (h *AdminHandler) RegisterRoutes(mux *http.ServeMux, token string) {
+	wrap := func(next http.HandlerFunc, route string) http.HandlerFunc {
+		return RequestIDMiddleware(
+			TracingMiddleware(LoggingMiddleware(AdminAuthMiddleware(RecoveryMiddleware(next), token), h.logger), route),
+			h.logger,
+		)
+	}
+
+	// The UI prompts for the token with Basic auth, which browsers then send
+	// along with its reads of the API
+	wrapUI := func(next http.HandlerFunc, route string) http.HandlerFunc {
+		return RequestIDMiddleware(
+			TracingMiddleware(LoggingMiddleware(adminAuth(RecoveryMiddleware(next), token,
+				`Basic realm="kii-admin", charset="UTF-8"`), h.logger), route),
+			h.logger,
+		)
+	}
+
+	// Replicas only serve reads of the routes that change shared state
+	readOnly := func(next http.HandlerFunc) http.HandlerFunc {
+		if !h.readOnly {
+			return next
+		}
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				w.Header().Set("Allow", "GET, HEAD")
+				writeError(w, entity.ErrReadOnly)
+				return
+			}
+			next(w, r)
+		}
+	}
+
+	mux.HandleFunc("/admin", wrapUI(h.HandleUI, "/admin"))
+	mux.HandleFunc("/admin/ui/", wrapUI(h.HandleUI, "/admin/ui/{file}"))
+	mux.HandleFunc("/admin/nonces", wrap(readOnly(h.HandleNonces), "/admin/nonces"))
+	mux.HandleFunc("/admin/nonces/", wrap(readOnly(h.HandleNonce), "/admin/nonces/{nonce}"))
+	mux.HandleFunc("/admin/stats", wrap(h.HandleStats, "/admin/stats"))
+	if h.logLevel != nil {
+		mux.HandleFunc("/admin/log-level", wrap(h.HandleLogLevel, "/admin/log-level"))
+	}
+	if h.capture != nil {
+		mux.HandleFunc("/admin/debug-capture", wrap(h.HandleDebugCapture, "/admin/debug-capture"))
+	}
+	if h.export != nil {
+		mux.HandleFunc("/export", wrap(h.HandleExport, "/export"))
+	}
+	if h.usage != nil {
+		mux.HandleFunc("/admin/usage", wrap(h.HandleUsage, "/admin/usage"))
+	}
+	if h.pending != nil {
+		mux.HandleFunc("/admin/pending", wrap(h.HandlePending, "/admin/pending"))
+		mux.HandleFunc("/admin/pending/", wrap(readOnly(h.HandlePendingEntry), "/admin/pending/{id}"))
+	}
+	if h.archive != nil {
+		mux.HandleFunc("/admin/archives", wrap(h.HandleArchives, "/admin/archives"))
+		mux.HandleFunc("/admin/archives/", wrap(h.HandleArchiveSegment, "/admin/archives/{segment}"))
+	}
+	if h.tolerances != nil {
+		mux.HandleFunc("/admin/tolerances", wrap(h.HandleTolerances, "/admin/tolerances"))
+		mux.HandleFunc("/admin/tolerances/", wrap(h.HandleTolerance, "/admin/tolerances/{source}"))
+	}
+	if h.skew != nil {
+		mux.HandleFunc("/admin/clock-skew", wrap(h.HandleClockSkew, "/admin/clock-skew"))
+	}
+	if h.duplicates != nil {
+		mux.HandleFunc("/admin/duplicates/", wrap(readOnly(h.HandleDuplicate), "/admin/duplicates/{key}"))
+	}
+	if h.freezes != nil {
+		mux.HandleFunc("/admin/freezes", wrap(readOnly(h.HandleFreezes), "/admin/freezes"))
+		mux.HandleFunc("/admin/freezes/", wrap(readOnly(h.HandleFreeze), "/admin/freezes/{asset}"))
+	}
+	if h.holdings != nil {
+		mux.HandleFunc("/admin/holders", wrap(h.HandleHolders, "/admin/holders"))
+		mux.HandleFunc("/admin/distribution", wrap(h.HandleDistribution, "/admin/distribution"))
+	}
+}
+
+// writeJSON writes v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,897 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"kii.com/internal/application/usecase"
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+	"kii.com/internal/infrastructure/archive"
+	"kii.com/internal/infrastructure/audit"
+	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/metrics"
+	"kii.com/internal/infrastructure/repository"
+	"kii.com/internal/infrastructure/validator"
+)
+
+func TestAdminHandler_Auth(t *testing.T) {
+	logger := logger.NewLogger()
+	mux := http.NewServeMux()
+	NewAdminHandler(validator.NewNonceStore(), metrics.NewCollector(), nil, nil, logger).RegisterRoutes(mux, "admin-token")
+
+	tests := []struct {
+		name       string
+		method     string
+		header     string
+		wantStatus int
+	}{
+		{name: "missing token", header: "", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", header: "Bearer nope", wantStatus: http.StatusUnauthorized},
+		{name: "wrong scheme", header: "Basic admin-token", wantStatus: http.StatusUnauthorized},
+		{name: "valid token", header: "Bearer admin-token", wantStatus: http.StatusOK},
+		{name: "read with basic password", header: "Basic YWRtaW46YWRtaW4tdG9rZW4=", wantStatus: http.StatusOK},
+		{name: "read with wrong basic password", header: "Basic YWRtaW46bm9wZQ==", wantStatus: http.StatusUnauthorized},
+		{name: "write with basic password", method: http.MethodDelete, header: "Basic YWRtaW46YWRtaW4tdG9rZW4=", wantStatus: http.StatusUnauthorized},
+		{name: "write with token", method: http.MethodDelete, header: "Bearer admin-token", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, "/admin/nonces", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAdminHandler_Nonces(t *testing.T) {
+	logger := logger.NewLogger()
+	store := validator.NewNonceStore()
+	var auditBuf bytes.Buffer
+	mux := http.NewServeMux()
+	NewAdminHandler(store, metrics.NewCollector(), audit.NewLogger(&auditBuf), nil, logger).RegisterRoutes(mux, "admin-token")
+
+	now := time.Now()
+	store.IsValid("", "partner-a-1", now.Add(-2*time.Second))
+	store.IsValid("", "partner-a-2", now.Add(-time.Second))
+	store.IsValid("", "partner-b-1", now)
+	store.IsValid("stripe", "partner-b-1", now)
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	// List with prefix
+	w := do(http.MethodGet, "/admin/nonces?prefix=partner-a")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list status = %v, want %v", w.Code, http.StatusOK)
+	}
+	var listResp struct {
+		Total  int `json:"total"`
+		Nonces []struct {
+			Nonce string `json:"nonce"`
+		} `json:"nonces"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listResp); err != nil {
+		t.Fatalf("failed to unmarshal list response: %v", err)
+	}
+	if listResp.Total != 4 || len(listResp.Nonces) != 2 || listResp.Nonces[0].Nonce != "partner-a-2" {
+		t.Errorf("list response = %+v, want total 4 and [partner-a-2 partner-a-1]", listResp)
+	}
+
+	// Invalid limit
+	if w := do(http.MethodGet, "/admin/nonces?limit=abc"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid limit status = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+
+	// Delete single nonce
+	if w := do(http.MethodDelete, "/admin/nonces/partner-a-1"); w.Code != http.StatusNoContent {
+		t.Errorf("delete status = %v, want %v", w.Code, http.StatusNoContent)
+	}
+	if w := do(http.MethodDelete, "/admin/nonces/partner-a-1"); w.Code != http.StatusNotFound {
+		t.Errorf("second delete status = %v, want %v", w.Code, http.StatusNotFound)
+	}
+	if !store.IsValid("", "partner-a-1", now) {
+		t.Error("deleted nonce should be accepted again")
+	}
+
+	// Delete a nonce of one tenant only
+	if w := do(http.MethodDelete, "/admin/nonces/partner-b-1?tenant=Stripe"); w.Code != http.StatusNoContent {
+		t.Errorf("tenant delete status = %v, want %v", w.Code, http.StatusNoContent)
+	}
+	if store.IsValid("", "partner-b-1", now) {
+		t.Error("nonce of the default endpoint should still be tracked")
+	}
+
+	// Purge all
+	w = do(http.MethodDelete, "/admin/nonces")
+	if w.Code != http.StatusOK {
+		t.Fatalf("purge status = %v, want %v", w.Code, http.StatusOK)
+	}
+	if store.Len() != 0 {
+		t.Errorf("store length after purge = %v, want 0", store.Len())
+	}
+
+	// Only the successful deletes and the purge are audited
+	var actions []string
+	for _, line := range strings.Split(strings.TrimSpace(auditBuf.String()), "\n") {
+		var event audit.Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("failed to unmarshal audit event %q: %v", line, err)
+		}
+		if event.Type != audit.EventAdminAction {
+			t.Errorf("audit event type = %v, want %v", event.Type, audit.EventAdminAction)
+		}
+		actions = append(actions, event.Details["action"])
+	}
+	if strings.Join(actions, ",") != "nonce.delete,nonce.delete,nonce.purge" {
+		t.Errorf("audited actions = %v, want [nonce.delete nonce.delete nonce.purge]", actions)
+	}
+}
+
+func TestAdminHandler_Duplicates(t *testing.T) {
+	logger := logger.NewLogger()
+	store := repository.NewInMemoryDuplicateStore(time.Hour)
+	var auditBuf bytes.Buffer
+	mux := http.NewServeMux()
+	NewAdminHandler(validator.NewNonceStore(), metrics.NewCollector(), audit.NewLogger(&auditBuf), nil, logger,
+		WithAdminDuplicates(store)).RegisterRoutes(mux, "admin-token")
+
+	now := time.Now()
+	store.Record("digest-1", now)
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodGet, "/admin/duplicates/digest-1"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("get status = %v, want %v", w.Code, http.StatusMethodNotAllowed)
+	}
+	if w := do(http.MethodDelete, "/admin/duplicates/"); w.Code != http.StatusBadRequest {
+		t.Errorf("missing key status = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+	if w := do(http.MethodDelete, "/admin/duplicates/digest-1"); w.Code != http.StatusNoContent {
+		t.Errorf("delete status = %v, want %v", w.Code, http.StatusNoContent)
+	}
+	if w := do(http.MethodDelete, "/admin/duplicates/digest-1"); w.Code != http.StatusNotFound {
+		t.Errorf("second delete status = %v, want %v", w.Code, http.StatusNotFound)
+	}
+	if _, seen := store.Record("digest-1", now); seen {
+		t.Error("forgotten key should be recorded anew")
+	}
+
+	var event audit.Event
+	if err := json.Unmarshal(bytes.TrimSpace(auditBuf.Bytes()), &event); err != nil {
+		t.Fatalf("failed to unmarshal audit event: %v", err)
+	}
+	if event.Details["action"] != "duplicate.delete" || event.Details["key"] != "digest-1" {
+		t.Errorf("audit details = %v, want duplicate.delete of digest-1", event.Details)
+	}
+}
+
+func TestAdminHandler_Freezes(t *testing.T) {
+	logger := logger.NewLogger()
+	store, err := repository.NewInMemoryFreezeStore("")
+	if err != nil {
+		t.Fatalf("NewInMemoryFreezeStore() error = %v", err)
+	}
+	var auditBuf bytes.Buffer
+	mux := http.NewServeMux()
+	NewAdminHandler(validator.NewNonceStore(), metrics.NewCollector(), audit.NewLogger(&auditBuf), nil, logger,
+		WithAdminFreezes(store)).RegisterRoutes(mux, "admin-token")
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer admin-token")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPut, "/admin/freezes/ETH", `{"reason":"chain halt"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("freeze status = %v, want %v", w.Code, http.StatusOK)
+	}
+	if freeze, ok := store.Frozen("ETH"); !ok || freeze.Reason != "chain halt" {
+		t.Errorf("Frozen(ETH) = %+v, %v, want frozen for the chain halt", freeze, ok)
+	}
+	if w := do(http.MethodPut, "/admin/freezes/BTC", ""); w.Code != http.StatusOK {
+		t.Errorf("freeze without a reason status = %v, want %v", w.Code, http.StatusOK)
+	}
+	if w := do(http.MethodPut, "/admin/freezes/BTC", "{"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid body status = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+
+	w = do(http.MethodGet, "/admin/freezes", "")
+	var listResp struct {
+		Freezes []entity.AssetFreeze `json:"freezes"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listResp); err != nil {
+		t.Fatalf("failed to unmarshal list response: %v", err)
+	}
+	if len(listResp.Freezes) != 2 || listResp.Freezes[0].Asset != "BTC" || listResp.Freezes[1].Asset != "ETH" {
+		t.Errorf("freezes = %+v, want BTC and ETH", listResp.Freezes)
+	}
+
+	if w := do(http.MethodDelete, "/admin/freezes/ETH", ""); w.Code != http.StatusNoContent {
+		t.Errorf("unfreeze status = %v, want %v", w.Code, http.StatusNoContent)
+	}
+	if w := do(http.MethodDelete, "/admin/freezes/ETH", ""); w.Code != http.StatusNotFound {
+		t.Errorf("second unfreeze status = %v, want %v", w.Code, http.StatusNotFound)
+	}
+	if w := do(http.MethodGet, "/admin/freezes/ETH", ""); w.Code != http.StatusNotFound {
+		t.Errorf("get status after unfreezing = %v, want %v", w.Code, http.StatusNotFound)
+	}
+
+	// Only the changes are audited
+	var actions []string
+	for _, line := range strings.Split(strings.TrimSpace(auditBuf.String()), "\n") {
+		var event audit.Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("failed to unmarshal audit event %q: %v", line, err)
+		}
+		actions = append(actions, event.Details["action"]+" "+event.Details["asset"])
+	}
+	if strings.Join(actions, ",") != "asset.freeze ETH,asset.freeze BTC,asset.unfreeze ETH" {
+		t.Errorf("audited actions = %v, want freezes of ETH and BTC and the unfreeze of ETH", actions)
+	}
+}
+
+func TestAdminHandler_Stats(t *testing.T) {
+	logger := logger.NewLogger()
+	store := validator.NewNonceStore()
+	stats := metrics.NewCollector()
+	mux := http.NewServeMux()
+	NewAdminHandler(store, stats, nil, nil, logger, WithAdminQueue(fakeQueue{length: 3, capacity: 64})).RegisterRoutes(mux, "admin-token")
+
+	store.IsValid("", "nonce-1", time.Now())
+	stats.RecordRequest(http.StatusUnauthorized)
+	stats.RecordValidationFailure(validationFailureReason(entity.ErrTimestampOutOfTolerance.WithDetail("difference is 10m")))
+	stats.RecordWebhook(metrics.WebhookEvent{Source: "default", Status: metrics.WebhookFailed, Reason: "timestamp out of tolerance"})
+	stats.RecordEntry("user1")
+	stats.RecordWebhook(metrics.WebhookEvent{Source: "default", Status: metrics.WebhookProcessed, User: "user1", Asset: "BTC", Amount: "1"})
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/stats?top=5", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("stats status = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	var resp struct {
+		metrics.Snapshot
+		NonceStoreSize int        `json:"nonceStoreSize"`
+		Queue          queueStats `json:"queue"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal stats response: %v", err)
+	}
+	if resp.NonceStoreSize != 1 {
+		t.Errorf("NonceStoreSize = %v, want 1", resp.NonceStoreSize)
+	}
+	if resp.ValidationFailures["timestamp out of tolerance"] != 1 {
+		t.Errorf("ValidationFailures = %v, want timestamp out of tolerance: 1", resp.ValidationFailures)
+	}
+	if len(resp.TopUsers) != 1 || resp.TopUsers[0].User != "user1" {
+		t.Errorf("TopUsers = %v, want [user1]", resp.TopUsers)
+	}
+	if len(resp.RecentWebhooks) != 1 || resp.RecentWebhooks[0].Asset != "BTC" {
+		t.Errorf("RecentWebhooks = %v, want the BTC webhook", resp.RecentWebhooks)
+	}
+	if len(resp.RecentFailures) != 1 || resp.RecentFailures[0].Reason != "timestamp out of tolerance" {
+		t.Errorf("RecentFailures = %v, want the timestamp failure", resp.RecentFailures)
+	}
+	if resp.Queue != (queueStats{Length: 3, Capacity: 64}) {
+		t.Errorf("Queue = %+v, want 3 of 64", resp.Queue)
+	}
+}
+
+func TestAdminHandler_StatsByLabel(t *testing.T) {
+	logger := logger.NewLogger()
+	stats := metrics.NewCollector()
+	mux := http.NewServeMux()
+	NewAdminHandler(validator.NewNonceStore(), stats, nil, nil, logger).RegisterRoutes(mux, "admin-token")
+
+	stats.RecordEntry("user1", "campaign=airdrop", "region=eu")
+	stats.RecordEntry("user2", "campaign=airdrop")
+	stats.RecordEntry("user2", "campaign=referral")
+	stats.RecordEntry("user3")
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       map[string]uint64
+	}{
+		{name: "all labels", wantStatus: http.StatusOK, want: map[string]uint64{"campaign=airdrop": 2, "campaign=referral": 1, "region=eu": 1}},
+		{name: "by key", query: "?label=campaign", wantStatus: http.StatusOK, want: map[string]uint64{"campaign=airdrop": 2, "campaign=referral": 1}},
+		{name: "by value", query: "?label=campaign=airdrop", wantStatus: http.StatusOK, want: map[string]uint64{"campaign=airdrop": 2}},
+		{name: "invalid selector", query: "?label=campaign=a,b", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/stats"+tt.query, nil)
+			req.Header.Set("Authorization", "Bearer admin-token")
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("stats status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var resp metrics.Snapshot
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to unmarshal stats response: %v", err)
+			}
+			if !reflect.DeepEqual(resp.EntriesByLabel, tt.want) {
+				t.Errorf("EntriesByLabel = %v, want %v", resp.EntriesByLabel, tt.want)
+			}
+		})
+	}
+}
+
+type fakeQueue struct {
+	length, capacity int
+}
+
+func (q fakeQueue) QueueLength() int   { return q.length }
+func (q fakeQueue) QueueCapacity() int { return q.capacity }
+
+func TestAdminHandler_UI(t *testing.T) {
+	logger := logger.NewLogger()
+	mux := http.NewServeMux()
+	NewAdminHandler(validator.NewNonceStore(), metrics.NewCollector(), nil, nil, logger).RegisterRoutes(mux, "admin-token")
+
+	tests := []struct {
+		name            string
+		path            string
+		auth            bool
+		wantStatus      int
+		wantContentType string
+	}{
+		{name: "prompts for the token", path: "/admin", wantStatus: http.StatusUnauthorized},
+		{name: "page", path: "/admin", auth: true, wantStatus: http.StatusOK, wantContentType: "text/html; charset=utf-8"},
+		{name: "script", path: "/admin/ui/app.js", auth: true, wantStatus: http.StatusOK, wantContentType: "text/javascript; charset=utf-8"},
+		{name: "styles", path: "/admin/ui/style.css", auth: true, wantStatus: http.StatusOK, wantContentType: "text/css; charset=utf-8"},
+		{name: "unknown file", path: "/admin/ui/secret.txt", auth: true, wantStatus: http.StatusNotFound},
+		{name: "no directory listing", path: "/admin/ui/", auth: true, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.auth {
+				req.SetBasicAuth("admin", "admin-token")
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Basic ") {
+				t.Errorf("WWW-Authenticate = %q, want a Basic challenge", w.Header().Get("WWW-Authenticate"))
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			if w.Header().Get("Content-Security-Policy") == "" {
+				t.Error("Content-Security-Policy is not set")
+			}
+		})
+	}
+}
+
+func TestAdminHandler_Usage(t *testing.T) {
+	logger := logger.NewLogger()
+	usage := metrics.NewUsageMeter()
+	mux := http.NewServeMux()
+	NewAdminHandler(validator.NewNonceStore(), nil, nil, nil, logger, WithAdminUsage(usage)).RegisterRoutes(mux, "admin-token")
+
+	usage.RecordWebhook("partner", 100)
+	usage.RecordValidationFailure("partner", 50)
+	usage.RecordWebhook("default", 10)
+
+	tests := []struct {
+		name        string
+		query       string
+		wantStatus  int
+		wantTenants int
+	}{
+		{"current month", "", http.StatusOK, 2},
+		{"month without usage", "?month=2001-01", http.StatusOK, 0},
+		{"invalid month", "?month=January", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/usage"+tt.query, nil)
+			req.Header.Set("Authorization", "Bearer admin-token")
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("usage status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var report metrics.UsageReport
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatalf("failed to unmarshal usage response: %v", err)
+			}
+			if len(report.Tenants) != tt.wantTenants {
+				t.Errorf("Tenants = %v, want %d tenants", report.Tenants, tt.wantTenants)
+			}
+		})
+	}
+}
+
+func TestAdminHandler_LogLevel(t *testing.T) {
+	logger := logger.NewLogger()
+	level := new(slog.LevelVar)
+	mux := http.NewServeMux()
+	NewAdminHandler(validator.NewNonceStore(), metrics.NewCollector(), nil, level, logger).RegisterRoutes(mux, "admin-token")
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		wantLevel  slog.Level
+	}{
+		{name: "get", method: http.MethodGet, wantStatus: http.StatusOK, wantLevel: slog.LevelInfo},
+		{name: "set debug", method: http.MethodPut, body: `{"level":"debug"}`, wantStatus: http.StatusOK, wantLevel: slog.LevelDebug},
+		{name: "invalid level", method: http.MethodPut, body: `{"level":"verbose"}`, wantStatus: http.StatusBadRequest, wantLevel: slog.LevelDebug},
+		{name: "invalid body", method: http.MethodPut, body: `level=warn`, wantStatus: http.StatusBadRequest, wantLevel: slog.LevelDebug},
+		{name: "set warn", method: http.MethodPut, body: `{"level":"WARN"}`, wantStatus: http.StatusOK, wantLevel: slog.LevelWarn},
+		{name: "method not allowed", method: http.MethodPost, wantStatus: http.StatusMethodNotAllowed, wantLevel: slog.LevelWarn},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/admin/log-level", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer admin-token")
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if level.Level() != tt.wantLevel {
+				t.Errorf("level = %v, want %v", level.Level(), tt.wantLevel)
+			}
+			if w.Code == http.StatusOK {
+				var resp map[string]string
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("failed to unmarshal response: %v", err)
+				}
+				if resp["level"] != strings.ToLower(tt.wantLevel.String()) {
+					t.Errorf("response level = %q, want %q", resp["level"], strings.ToLower(tt.wantLevel.String()))
+				}
+			}
+		})
+	}
+}
+
+func TestAdminHandler_Tolerances(t *testing.T) {
+	logger := logger.NewLogger()
+	partner := validator.NewHMACValidator("partner-secret", 2*time.Minute, logger).(*validator.HMACValidator)
+	nonceStore := validator.NewNonceStore()
+	nonceStore.SetRetention(3 * time.Minute)
+	mux := http.NewServeMux()
+	NewAdminHandler(nonceStore, metrics.NewCollector(), nil, nil, logger,
+		WithAdminTolerances(map[string]ToleranceValidator{"partner": partner})).RegisterRoutes(mux, "admin-token")
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		body          string
+		wantStatus    int
+		wantTolerance time.Duration
+	}{
+		{name: "list", method: http.MethodGet, path: "/admin/tolerances", wantStatus: http.StatusOK, wantTolerance: 2 * time.Minute},
+		{name: "get", method: http.MethodGet, path: "/admin/tolerances/partner", wantStatus: http.StatusOK, wantTolerance: 2 * time.Minute},
+		{name: "set", method: http.MethodPut, path: "/admin/tolerances/partner", body: `{"tolerance":"10m"}`, wantStatus: http.StatusOK, wantTolerance: 10 * time.Minute},
+		{name: "unknown source", method: http.MethodPut, path: "/admin/tolerances/other", body: `{"tolerance":"1m"}`, wantStatus: http.StatusNotFound, wantTolerance: 10 * time.Minute},
+		{name: "not a duration", method: http.MethodPut, path: "/admin/tolerances/partner", body: `{"tolerance":"600"}`, wantStatus: http.StatusBadRequest, wantTolerance: 10 * time.Minute},
+		{name: "not positive", method: http.MethodPut, path: "/admin/tolerances/partner", body: `{"tolerance":"-1m"}`, wantStatus: http.StatusBadRequest, wantTolerance: 10 * time.Minute},
+		{name: "method not allowed", method: http.MethodDelete, path: "/admin/tolerances/partner", wantStatus: http.StatusMethodNotAllowed, wantTolerance: 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer admin-token")
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if got := partner.TimestampTolerance(); got != tt.wantTolerance {
+				t.Errorf("tolerance = %v, want %v", got, tt.wantTolerance)
+			}
+			if w.Code == http.StatusOK && !strings.Contains(w.Body.String(), `"tolerance":"`+tt.wantTolerance.String()+`"`) {
+				t.Errorf("body = %s, want tolerance %v", w.Body.String(), tt.wantTolerance)
+			}
+			if tt.name == "list" && !strings.Contains(w.Body.String(), `"nonceRetention":"3m0s"`) {
+				t.Errorf("body = %s, want the nonce retention", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminHandler_ClockSkew(t *testing.T) {
+	logger := logger.NewLogger()
+	tracker := metrics.NewSkewTracker(metrics.NopEmitter{})
+	tracker.RecordSkew("partner", 1500*time.Millisecond, true)
+	mux := http.NewServeMux()
+	NewAdminHandler(validator.NewNonceStore(), metrics.NewCollector(), nil, nil, logger,
+		WithAdminClockSkew(tracker)).RegisterRoutes(mux, "admin-token")
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/clock-skew", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var resp struct {
+		Sources []metrics.SourceSkew `json:"sources"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(resp.Sources) != 1 || resp.Sources[0].Source != "partner" || resp.Sources[0].P50 != 1.5 {
+		t.Errorf("sources = %+v, want partner 1.5s behind", resp.Sources)
+	}
+}
+
+func TestAdminHandler_Export(t *testing.T) {
+	logger := logger.NewLogger()
+	ledger := repository.NewInMemoryLedger(logger)
+	for _, user := range []string{"user1", "user2", "user3"} {
+		_ = ledger.AddEntry(context.Background(), entity.LedgerEntry{User: user, Asset: "BTC", Amount: "1"})
+	}
+	var auditBuf bytes.Buffer
+	mux := http.NewServeMux()
+	NewAdminHandler(validator.NewNonceStore(), metrics.NewCollector(), audit.NewLogger(&auditBuf), nil, logger,
+		WithAdminExport(usecase.NewStreamLedgerUseCase(ledger))).RegisterRoutes(mux, "admin-token")
+
+	req := httptest.NewRequest(http.MethodGet, "/export", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %v, want %v", w.Code, http.StatusOK)
+	}
+	if lines := strings.Count(w.Body.String(), "\n"); lines != 3 {
+		t.Errorf("export has %d lines, want 3: %s", lines, w.Body.String())
+	}
+	if !strings.Contains(auditBuf.String(), `"action":"ledger.export"`) {
+		t.Errorf("export not audited: %s", auditBuf.String())
+	}
+
+	// The export resumes after the last entry seen
+	req = httptest.NewRequest(http.MethodGet, "/export?after=1&limit=1", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	var entry entity.LedgerEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &entry); err != nil {
+		t.Fatalf("export page %q: %v", w.Body.String(), err)
+	}
+	if entry.Sequence != 2 || entry.User != "user2" {
+		t.Errorf("export page = %+v, want user2's entry with sequence 2", entry)
+	}
+	// Only entries carrying the selected labels are exported
+	_ = ledger.AddEntry(context.Background(), entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "2", Labels: "campaign=airdrop"})
+	req = httptest.NewRequest(http.MethodGet, "/export?label=campaign=airdrop", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	entry = entity.LedgerEntry{}
+	if err := json.Unmarshal(w.Body.Bytes(), &entry); err != nil {
+		t.Fatalf("labelled export %q: %v", w.Body.String(), err)
+	}
+	if entry.Sequence != 4 || entry.Labels != "campaign=airdrop" {
+		t.Errorf("labelled export = %+v, want the airdrop entry", entry)
+	}
+	if !strings.Contains(auditBuf.String(), `"labels":"campaign=airdrop"`) {
+		t.Errorf("export labels not audited: %s", auditBuf.String())
+	}
+}
+
+func TestAdminHandler_Archives(t *testing.T) {
+	logger := logger.NewLogger()
+	store, err := archive.NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDirStore() error = %v", err)
+	}
+	ledgerArchive := archive.NewLedgerArchive(store)
+	segment, _ := ledgerArchive.Store(context.Background(), []entity.LedgerEntry{
+		{Sequence: 1, UserSequence: 1, User: "user1", Asset: "BTC", Amount: "1"},
+		{Sequence: 2, UserSequence: 1, User: "user2", Asset: "BTC", Amount: "2"},
+	})
+	var auditBuf bytes.Buffer
+	mux := http.NewServeMux()
+	NewAdminHandler(validator.NewNonceStore(), metrics.NewCollector(), audit.NewLogger(&auditBuf), nil, logger,
+		WithAdminArchive(ledgerArchive)).RegisterRoutes(mux, "admin-token")
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "list segments", path: "/admin/archives", wantStatus: http.StatusOK, wantBody: `{"segments":["` + segment + `"]}`},
+		{name: "read segment", path: "/admin/archives/" + segment, wantStatus: http.StatusOK, wantBody: `"user":"user2"`},
+		{name: "unknown segment", path: "/admin/archives/ledger-1.ndjson.gz", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer admin-token")
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+	if !strings.Contains(auditBuf.String(), `"action":"ledger.archive_read"`) {
+		t.Errorf("segment read not audited: %s", auditBuf.String())
+	}
+}
+
+func TestAdminHandler_Holdings(t *testing.T) {
+	logger := logger.NewLogger()
+	ledger := repository.NewInMemoryLedger(logger)
+	for i, user := range []string{"user1", "user2", "user3"} {
+		_ = ledger.AddEntry(context.Background(), entity.LedgerEntry{User: user, Asset: "BTC", Amount: strconv.Itoa(10 * (i + 1))})
+	}
+	_ = ledger.AddEntry(context.Background(), entity.LedgerEntry{User: "user1", Asset: "ETH", Amount: "0.5"})
+	var auditBuf bytes.Buffer
+	mux := http.NewServeMux()
+	NewAdminHandler(validator.NewNonceStore(), metrics.NewCollector(), audit.NewLogger(&auditBuf), nil, logger,
+		WithAdminHoldings(usecase.NewQueryHoldingsUseCase(ledger))).RegisterRoutes(mux, "admin-token")
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "top holders",
+			path:       "/admin/holders?asset=BTC&top=2",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"asset":"BTC","holders":[{"user":"user3","balance":"30.00000000"},{"user":"user2","balance":"20.00000000"}]}`,
+		},
+		{name: "no holders", path: "/admin/holders?asset=DOGE", wantStatus: http.StatusOK, wantBody: `{"asset":"DOGE","holders":[]}`},
+		{name: "missing asset", path: "/admin/holders", wantStatus: http.StatusBadRequest, wantBody: `"code":"missing_asset"`},
+		{name: "invalid top", path: "/admin/holders?asset=BTC&top=0", wantStatus: http.StatusBadRequest},
+		{
+			name:       "distribution of one asset",
+			path:       "/admin/distribution?asset=ETH",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"assets":[{"asset":"ETH","holders":1,"total":"0.50000000","buckets":[{"min":"0.1","max":"1","count":1}]}]}`,
+		},
+		{name: "distribution of every asset", path: "/admin/distribution", wantStatus: http.StatusOK, wantBody: `{"min":"10","max":"100","count":3}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer admin-token")
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+	if !strings.Contains(auditBuf.String(), `"action":"holders.read"`) {
+		t.Errorf("holders read not audited: %s", auditBuf.String())
+	}
+}
+
+func TestAdminHandler_Pending(t *testing.T) {
+	logger := logger.NewLogger()
+	store := repository.NewInMemoryPendingStore(time.Hour)
+	var auditBuf bytes.Buffer
+	mux := http.NewServeMux()
+	NewAdminHandler(validator.NewNonceStore(), nil, audit.NewLogger(&auditBuf), nil, logger, WithAdminPending(store)).RegisterRoutes(mux, "admin-token")
+
+	store.Add(entity.PendingEntry{
+		ID:        "pending-1",
+		Entry:     entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "5000"},
+		Source:    "default",
+		Policy:    entity.PolicyApproval,
+		CreatedAt: time.Now(),
+	})
+	store.Add(entity.PendingEntry{
+		ID:        "pending-2",
+		Entry:     entity.LedgerEntry{User: "user2", Asset: "ETH", Amount: "20"},
+		Source:    "default",
+		Policy:    entity.PolicyVelocity,
+		CreatedAt: time.Now(),
+	})
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "/admin/pending")
+	var resp struct {
+		Pending []entity.PendingEntry `json:"pending"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal pending response: %v", err)
+	}
+	if len(resp.Pending) != 2 || resp.Pending[0].ID != "pending-1" || resp.Pending[0].Entry.Amount != "5000" {
+		t.Errorf("pending = %+v, want pending-1 and pending-2", resp.Pending)
+	}
+
+	w = do(http.MethodGet, "/admin/pending?policy=velocity")
+	resp.Pending = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal pending response: %v", err)
+	}
+	if len(resp.Pending) != 1 || resp.Pending[0].ID != "pending-2" || resp.Pending[0].Policy != entity.PolicyVelocity {
+		t.Errorf("pending with policy=velocity = %+v, want pending-2", resp.Pending)
+	}
+	if w := do(http.MethodGet, "/admin/pending?policy=bogus"); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown policy status = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+
+	if w := do(http.MethodDelete, "/admin/pending/pending-1"); w.Code != http.StatusNoContent {
+		t.Errorf("reject status = %v, want %v", w.Code, http.StatusNoContent)
+	}
+	if w := do(http.MethodDelete, "/admin/pending/pending-1"); w.Code != http.StatusNotFound {
+		t.Errorf("second reject status = %v, want %v", w.Code, http.StatusNotFound)
+	}
+	if pending := store.List(); len(pending) != 1 || pending[0].ID != "pending-2" {
+		t.Errorf("store holds %v, want only pending-2", pending)
+	}
+	if !strings.Contains(auditBuf.String(), `"action":"pending.reject"`) {
+		t.Errorf("audit log = %q, want a pending.reject action", auditBuf.String())
+	}
+}
+
+func TestAdminHandler_PendingRejectReleasesHold(t *testing.T) {
+	logger := logger.NewLogger()
+	store := repository.NewInMemoryPendingStore(time.Hour)
+	ledgerRepo := repository.NewInMemoryLedger(logger)
+	holds := ledgerRepo.(port.LedgerHoldRepository)
+	processUseCase := usecase.NewProcessWebhookUseCase(&mockValidator{}, ledgerRepo,
+		usecase.WithApproval(decimal.RequireFromString("1000"), store, false),
+		usecase.WithHolds(holds, time.Hour))
+	mux := http.NewServeMux()
+	NewAdminHandler(validator.NewNonceStore(), nil, audit.NewLogger(io.Discard), nil, logger,
+		WithAdminPending(store), WithAdminHoldReleaser(processUseCase)).RegisterRoutes(mux, "admin-token")
+
+	ctx := context.Background()
+	err := processUseCase.Execute(ctx, usecase.ProcessWebhookRequest{
+		WebhookRequest: &entity.WebhookRequest{User: "user1", Asset: "BTC", Amount: "-5000"},
+	})
+	var approvalRequired *entity.ApprovalRequiredError
+	if !errors.As(err, &approvalRequired) {
+		t.Fatalf("Execute() error = %v, want ApprovalRequiredError", err)
+	}
+	if balance, _ := ledgerRepo.GetBalance(ctx, "user1"); balance.Held["BTC"] != "5000.00000000" {
+		t.Fatalf("held = %v, want 5000.00000000", balance.Held)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/admin/pending/"+approvalRequired.ID, nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("reject status = %v, want %v", w.Code, http.StatusNoContent)
+	}
+	if balance, _ := ledgerRepo.GetBalance(ctx, "user1"); len(balance.Held) != 0 {
+		t.Errorf("held after reject = %v, want none", balance.Held)
+	}
+}
+
+func TestAdminHandler_PendingApprove(t *testing.T) {
+	logger := logger.NewLogger()
+	store := repository.NewInMemoryPendingStore(time.Hour)
+	ledgerRepo := repository.NewInMemoryLedger(logger)
+	processUseCase := usecase.NewProcessWebhookUseCase(&mockValidator{}, ledgerRepo,
+		usecase.WithApproval(decimal.RequireFromString("1000"), store, true))
+	var auditBuf bytes.Buffer
+	mux := http.NewServeMux()
+	NewAdminHandler(validator.NewNonceStore(), nil, audit.NewLogger(&auditBuf), nil, logger,
+		WithAdminPending(store), WithAdminApprover(processUseCase)).RegisterRoutes(mux, "admin-token")
+
+	store.Add(entity.PendingEntry{
+		ID:        "pending-1",
+		Entry:     entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "5000"},
+		Source:    "default",
+		Reason:    "burst of 4 entries for user1 within 1m0s",
+		CreatedAt: time.Now(),
+	})
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodGet, "/admin/pending/pending-1/approve"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET approve status = %v, want %v", w.Code, http.StatusMethodNotAllowed)
+	}
+	if w := do(http.MethodPost, "/admin/pending/pending-1/approve"); w.Code != http.StatusNoContent {
+		t.Fatalf("approve status = %v, want %v (%s)", w.Code, http.StatusNoContent, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/admin/pending/pending-1/approve"); w.Code != http.StatusNotFound {
+		t.Errorf("second approve status = %v, want %v", w.Code, http.StatusNotFound)
+	}
+
+	balance, _ := ledgerRepo.GetBalance(context.Background(), "user1")
+	if balance.Balances["BTC"] != "5000.00000000" {
+		t.Errorf("balance = %v, want 5000.00000000 applied once", balance.Balances["BTC"])
+	}
+	if !strings.Contains(auditBuf.String(), `"action":"pending.approve"`) {
+		t.Errorf("audit log = %q, want a pending.approve action", auditBuf.String())
+	}
+}
@@ -0,0 +1,41 @@
+package http
+
+import (
+	"embed"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// uiFiles is the admin dashboard, a static page reading the admin API
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// HandleUI handles GET /admin, the admin dashboard, and GET /admin/ui/{file},
+// its scripts and styles
+func (h *AdminHandler) HandleUI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := "index.html"
+	if r.URL.Path != "/admin" {
+		name = strings.TrimPrefix(r.URL.Path, "/admin/ui/")
+	}
+	data, err := uiFiles.ReadFile("ui/" + name)
+	if err != nil || strings.Contains(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	// The page renders webhook fields sent by third parties, so nothing but
+	// its own files may run in it, and it may not be framed
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(name)))
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,43 @@
+package http
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledBodyBuffer caps the buffers kept for reuse, so one large request
+// does not pin its memory in the pool
+const maxPooledBodyBuffer = 1 << 20
+
+// bodyBuffers recycles request body buffers across webhooks
+var bodyBuffers = sync.Pool{ //nolint:gochecknoglobals
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// readBody reads r into a pooled buffer, grown up front to sizeHint, the
+// body's declared length, so that a body of that length is read into a
+// single allocation instead of being copied each time the buffer doubles.
+// The caller bounds sizeHint. The buffer must be handed back with
+// releaseBody once nothing references its bytes.
+func readBody(r io.Reader, sizeHint int64) (*bytes.Buffer, error) {
+	buf := bodyBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	if sizeHint > 0 {
+		// ReadFrom wants bytes.MinRead of room to find the end of the body
+		buf.Grow(int(sizeHint) + bytes.MinRead)
+	}
+	if _, err := buf.ReadFrom(r); err != nil {
+		releaseBody(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// releaseBody returns buf to the pool
+func releaseBody(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBodyBuffer {
+		return
+	}
+	bodyBuffers.Put(buf)
+}
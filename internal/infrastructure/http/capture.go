@@ -0,0 +1,198 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+
+	"kii.com/internal/domain/entity"
+)
+
+const (
+	// redacted replaces sensitive header and body values in captures
+	redacted = "[REDACTED]"
+	// maxCapturedBody bounds how much of a request body is logged
+	maxCapturedBody = 64 << 10
+)
+
+// sensitiveKeyParts marks header names and JSON keys whose values are redacted
+var sensitiveKeyParts = []string{"signature", "secret", "token", "password", "authorization", "cookie", "api-key", "apikey"} //nolint:gochecknoglobals
+
+// DebugCapture selects the source addresses whose failed webhooks are logged
+// in full, with signatures and secrets redacted. A nil *DebugCapture captures
+// nothing.
+type DebugCapture struct {
+	mu       sync.RWMutex
+	prefixes []netip.Prefix
+}
+
+// NewDebugCapture creates a capture filter for the given IPs or CIDR ranges
+func NewDebugCapture(sources []string) (*DebugCapture, error) {
+	c := &DebugCapture{}
+	if err := c.SetSources(sources); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetSources replaces the captured sources with the given IPs or CIDR ranges
+func (c *DebugCapture) SetSources(sources []string) error {
+	prefixes := make([]netip.Prefix, 0, len(sources))
+	for _, source := range sources {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(source); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(source)
+		if err != nil {
+			return fmt.Errorf("invalid capture source %q: want an IP or CIDR range", source)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prefixes = prefixes
+	return nil
+}
+
+// Sources returns the captured sources in CIDR notation
+func (c *DebugCapture) Sources() []string {
+	if c == nil {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	sources := make([]string, len(c.prefixes))
+	for i, prefix := range c.prefixes {
+		sources[i] = prefix.String()
+	}
+	return sources
+}
+
+// Enabled reports whether requests from remoteAddr (host:port) are captured
+func (c *DebugCapture) Enabled(remoteAddr string) bool {
+	if c == nil {
+		return false
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, prefix := range c.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSensitiveKey reports whether a header name or JSON key holds a secret
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactHeaders flattens headers for logging, redacting sensitive values
+func redactHeaders(header http.Header) map[string]string {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	flat := make(map[string]string, len(header))
+	for _, key := range keys {
+		if isSensitiveKey(key) {
+			flat[key] = redacted
+			continue
+		}
+		flat[key] = strings.Join(header[key], ", ")
+	}
+	return flat
+}
+
+// redactBody returns body for logging. JSON bodies have the values of
+// sensitive keys redacted; other bodies are returned as-is. Bodies are
+// truncated to maxCapturedBody bytes.
+func redactBody(body []byte) string {
+	var doc any
+	if err := json.Unmarshal(body, &doc); err == nil {
+		if redactedBody, err := json.Marshal(redactJSON(doc)); err == nil {
+			body = redactedBody
+		}
+	}
+
+	if len(body) > maxCapturedBody {
+		return string(body[:maxCapturedBody]) + "...(truncated)"
+	}
+	return string(body)
+}
+
+// redactJSON replaces the values of sensitive keys anywhere in a decoded JSON document
+func redactJSON(v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		for key, inner := range value {
+			if isSensitiveKey(key) {
+				value[key] = redacted
+				continue
+			}
+			value[key] = redactJSON(inner)
+		}
+	case []any:
+		for i, inner := range value {
+			value[i] = redactJSON(inner)
+		}
+	}
+	return v
+}
+
+// signatureHint is the body of a signature mismatch answered with a hint
+type signatureHint struct {
+	Error                  string `json:"error"`
+	Code                   string `json:"code"`
+	Scheme                 string `json:"scheme"`
+	CanonicalMessage       string `json:"canonicalMessage"`
+	CanonicalMessageSHA256 string `json:"canonicalMessageSha256"`
+}
+
+// newSignatureHintResponse describes mismatch for the sender. The message is
+// the timestamp, nonce and body it sent, so it reveals nothing it does not
+// know; the secret is never part of it.
+func newSignatureHintResponse(mismatch *entity.SignatureMismatchError) signatureHint {
+	digest := sha256.Sum256(mismatch.CanonicalMessage)
+	return signatureHint{
+		Error:                  entity.ErrInvalidSignature.Message,
+		Code:                   entity.ErrInvalidSignature.Code,
+		Scheme:                 mismatch.Scheme,
+		CanonicalMessage:       base64.StdEncoding.EncodeToString(mismatch.CanonicalMessage),
+		CanonicalMessageSHA256: hex.EncodeToString(digest[:]),
+	}
+}
@@ -0,0 +1,117 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/metrics"
+	"kii.com/internal/infrastructure/validator"
+)
+
+func TestDebugCapture_Enabled(t *testing.T) {
+	capture, err := NewDebugCapture([]string{"203.0.113.7", "10.1.0.0/16", "2001:db8::/32"})
+	if err != nil {
+		t.Fatalf("NewDebugCapture() error = %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		want       bool
+	}{
+		{remoteAddr: "203.0.113.7:51234", want: true},
+		{remoteAddr: "203.0.113.8:51234", want: false},
+		{remoteAddr: "10.1.200.3:443", want: true},
+		{remoteAddr: "10.2.0.1:443", want: false},
+		{remoteAddr: "[2001:db8::1]:8080", want: true},
+		{remoteAddr: "[::ffff:203.0.113.7]:8080", want: true},
+		{remoteAddr: "not-an-address", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remoteAddr, func(t *testing.T) {
+			if got := capture.Enabled(tt.remoteAddr); got != tt.want {
+				t.Errorf("Enabled(%q) = %v, want %v", tt.remoteAddr, got, tt.want)
+			}
+		})
+	}
+
+	var disabled *DebugCapture
+	if disabled.Enabled("203.0.113.7:1") {
+		t.Error("nil capture should capture nothing")
+	}
+	if _, err := NewDebugCapture([]string{"partner-a"}); err == nil {
+		t.Error("NewDebugCapture() with a hostname should fail")
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Signature", "abc123")
+	header.Set("Authorization", "Bearer token")
+	header.Set("X-Nonce", "nonce-1")
+
+	headers := redactHeaders(header)
+	if headers["X-Signature"] != redacted || headers["Authorization"] != redacted {
+		t.Errorf("sensitive headers not redacted: %v", headers)
+	}
+	if headers["X-Nonce"] != "nonce-1" {
+		t.Errorf("X-Nonce = %q, want nonce-1", headers["X-Nonce"])
+	}
+
+	body := redactBody([]byte(`{"user":"alice","meta":{"apiToken":"t0k","items":[{"client_secret":"s"}]}}`))
+	if strings.Contains(body, "t0k") || strings.Contains(body, `"s"`) || !strings.Contains(body, "alice") {
+		t.Errorf("redactBody() = %s, want secrets redacted and user kept", body)
+	}
+
+	if got := redactBody([]byte("not json")); got != "not json" {
+		t.Errorf("redactBody() = %q, want non-JSON body unchanged", got)
+	}
+	if got := redactBody([]byte(strings.Repeat("a", maxCapturedBody+10))); !strings.HasSuffix(got, "...(truncated)") {
+		t.Error("redactBody() should truncate large bodies")
+	}
+}
+
+func TestAdminHandler_DebugCapture(t *testing.T) {
+	capture, _ := NewDebugCapture(nil)
+	mux := http.NewServeMux()
+	NewAdminHandler(validator.NewNonceStore(), metrics.NewCollector(), nil, nil, logger.NewLogger(),
+		WithAdminDebugCapture(capture)).RegisterRoutes(mux, "admin-token")
+
+	do := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/debug-capture", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer admin-token")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodPut, `{"sources":["198.51.100.4"]}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT status = %v, want %v", w.Code, http.StatusOK)
+	}
+	if !capture.Enabled("198.51.100.4:1234") {
+		t.Error("source should be captured after PUT")
+	}
+	if w := do(http.MethodPut, `{"sources":["bogus"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid PUT status = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+
+	w := do(http.MethodGet, "")
+	var resp map[string][]string
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(resp["sources"]) != 1 || resp["sources"][0] != "198.51.100.4/32" {
+		t.Errorf("sources = %v, want [198.51.100.4/32]", resp["sources"])
+	}
+
+	if w := do(http.MethodDelete, ""); w.Code != http.StatusOK {
+		t.Errorf("DELETE status = %v, want %v", w.Code, http.StatusOK)
+	}
+	if capture.Enabled("198.51.100.4:1234") {
+		t.Error("source should not be captured after DELETE")
+	}
+}
@@ -0,0 +1,65 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"kii.com/internal/domain/entity"
+)
+
+const (
+	// DeadlineHeader carries the time by which a sender stops waiting for a
+	// webhook, as an RFC 3339 timestamp or UNIX time in seconds or
+	// milliseconds
+	DeadlineHeader = "X-Request-Deadline"
+	// TimeoutHeader carries how long, in seconds, a sender waits for a
+	// webhook
+	TimeoutHeader = "Request-Timeout"
+)
+
+const (
+	// minDeadlineMillis is the smallest UNIX time in milliseconds a numeric
+	// deadline is read as, the same cut-off as for signature timestamps
+	minDeadlineMillis = 100_000_000_000
+	// maxTimeoutSeconds bounds TimeoutHeader so that it fits a time.Duration
+	maxTimeoutSeconds = 86400
+)
+
+// requestDeadline returns the earliest deadline set by the DeadlineHeader
+// and TimeoutHeader of header, the latter counted from now. It reports false
+// when neither is set.
+func requestDeadline(header http.Header, now time.Time) (time.Time, bool, error) {
+	var deadline time.Time
+	if value := header.Get(DeadlineHeader); value != "" {
+		t, err := parseDeadline(value)
+		if err != nil {
+			return time.Time{}, false, entity.ErrInvalidDeadline.WithDetail("%s: %q", DeadlineHeader, value)
+		}
+		deadline = t
+	}
+	if value := header.Get(TimeoutHeader); value != "" {
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || seconds <= 0 || seconds > maxTimeoutSeconds {
+			return time.Time{}, false, entity.ErrInvalidDeadline.WithDetail("%s: %q", TimeoutHeader, value)
+		}
+		t := now.Add(time.Duration(seconds * float64(time.Second)))
+		if deadline.IsZero() || t.Before(deadline) {
+			deadline = t
+		}
+	}
+	return deadline, !deadline.IsZero(), nil
+}
+
+// parseDeadline parses a DeadlineHeader value
+func parseDeadline(value string) (time.Time, error) {
+	epoch, err := strconv.ParseInt(value, 10, 64)
+	switch {
+	case err != nil:
+		return time.Parse(time.RFC3339, value)
+	case epoch >= minDeadlineMillis:
+		return time.UnixMilli(epoch), nil
+	default:
+		return time.Unix(epoch, 0), nil
+	}
+}
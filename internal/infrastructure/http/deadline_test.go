@@ -0,0 +1,57 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"kii.com/internal/domain/entity"
+)
+
+func TestRequestDeadline(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "RFC 3339", headers: map[string]string{DeadlineHeader: "2026-10-15T12:00:02.5Z"}, want: now.Add(2500 * time.Millisecond)},
+		{name: "UNIX seconds", headers: map[string]string{DeadlineHeader: "1792065603"}, want: now.Add(3 * time.Second)},
+		{name: "UNIX milliseconds", headers: map[string]string{DeadlineHeader: "1792065600750"}, want: now.Add(750 * time.Millisecond)},
+		{name: "timeout", headers: map[string]string{TimeoutHeader: "1.5"}, want: now.Add(1500 * time.Millisecond)},
+		{
+			name:    "earliest of both",
+			headers: map[string]string{DeadlineHeader: "2026-10-15T12:00:10Z", TimeoutHeader: "4"},
+			want:    now.Add(4 * time.Second),
+		},
+		{name: "invalid deadline", headers: map[string]string{DeadlineHeader: "soon"}, wantErr: true},
+		{name: "zero timeout", headers: map[string]string{TimeoutHeader: "0"}, wantErr: true},
+		{name: "overlong timeout", headers: map[string]string{TimeoutHeader: "1e300"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for key, value := range tt.headers {
+				header.Set(key, value)
+			}
+			got, ok, err := requestDeadline(header, now)
+			if tt.wantErr {
+				if !errors.Is(err, entity.ErrInvalidDeadline) {
+					t.Errorf("requestDeadline() error = %v, want %v", err, entity.ErrInvalidDeadline)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("requestDeadline() error = %v", err)
+			}
+			if ok != !tt.want.IsZero() || !got.Equal(tt.want) {
+				t.Errorf("requestDeadline() = %v, %v, want %v", got, ok, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package http
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strconv"
+	"time"
+
+	"kii.com/internal/domain/port"
+	"kii.com/internal/infrastructure/logger"
+)
+
+// entryCounter is implemented by ledger repositories that can report the
+// number of entries they hold
+type entryCounter interface {
+	EntryCount() int
+}
+
+// DebugHandler serves runtime diagnostics and pprof profiles
+type DebugHandler struct {
+	nonceStore port.NonceStore
+	ledger     port.LedgerRepository
+	logger     logger.Logger
+}
+
+// NewDebugHandler creates a new debug handler
+func NewDebugHandler(
+	nonceStore port.NonceStore,
+	ledger port.LedgerRepository,
+	logger logger.Logger,
+) *DebugHandler {
+	return &DebugHandler{
+		nonceStore: nonceStore,
+		ledger:     ledger,
+		logger:     logger,
+	}
+}
+
+// DebugStats is the GET /debug/stats response
+type DebugStats struct {
+	Goroutines     int           `json:"goroutines"`
+	HeapAllocBytes uint64        `json:"heapAllocBytes"`
+	HeapInuseBytes uint64        `json:"heapInuseBytes"`
+	HeapObjects    uint64        `json:"heapObjects"`
+	SysBytes       uint64        `json:"sysBytes"`
+	NumGC          uint32        `json:"numGC"`
+	LastGC         *time.Time    `json:"lastGC,omitempty"`
+	GCPauseTotal   time.Duration `json:"gcPauseTotalNs"`
+	NonceCount     int           `json:"nonceCount"`
+	// EntryCount is -1 when the ledger backend cannot report it
+	EntryCount int `json:"entryCount"`
+}
+
+// HandleStats handles GET /debug/stats requests
+func (h *DebugHandler) HandleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	stats := DebugStats{
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAllocBytes: mem.HeapAlloc,
+		HeapInuseBytes: mem.HeapInuse,
+		HeapObjects:    mem.HeapObjects,
+		SysBytes:       mem.Sys,
+		NumGC:          mem.NumGC,
+		GCPauseTotal:   time.Duration(mem.PauseTotalNs),
+		NonceCount:     h.nonceStore.Len(),
+		EntryCount:     -1,
+	}
+	if mem.LastGC != 0 {
+		lastGC := time.Unix(0, int64(mem.LastGC)).UTC()
+		stats.LastGC = &lastGC
+	}
+	if counter, ok := h.ledger.(entryCounter); ok {
+		stats.EntryCount = counter.EntryCount()
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// RegisterRoutes registers /debug/stats and the /debug/pprof/ endpoints on mux
+// behind token auth
+func (h *DebugHandler) RegisterRoutes(mux *http.ServeMux, token string) {
+	wrap := func(next http.HandlerFunc) http.HandlerFunc {
+		return RequestIDMiddleware(LoggingMiddleware(AdminAuthMiddleware(RecoveryMiddleware(next), token), h.logger), h.logger)
+	}
+
+	mux.HandleFunc("/debug/stats", wrap(h.HandleStats))
+	// pprof.Index also serves the named profiles (heap, goroutine, allocs, ...)
+	mux.HandleFunc("/debug/pprof/", wrap(pprof.Index))
+	mux.HandleFunc("/debug/pprof/cmdline", wrap(pprof.Cmdline))
+	mux.HandleFunc("/debug/pprof/profile", wrap(fitWriteTimeout(pprof.Profile, 30)))
+	mux.HandleFunc("/debug/pprof/symbol", wrap(pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", wrap(fitWriteTimeout(pprof.Trace, 1)))
+}
+
+// fitWriteTimeout keeps CPU profiles and traces within the server's
+// WriteTimeout, past which their responses are cut off: a longer ?seconds= is
+// rejected, and a default longer than that (pprof profiles the CPU for 30
+// seconds, twice the default server.writeTimeout) is shortened to fit.
+func fitWriteTimeout(next http.HandlerFunc, defaultSeconds int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		srv, ok := r.Context().Value(http.ServerContextKey).(*http.Server)
+		if !ok || srv.WriteTimeout <= 0 {
+			next(w, r)
+			return
+		}
+		// The longest whole number of seconds that leaves time to respond
+		limit := int(math.Ceil(srv.WriteTimeout.Seconds())) - 1
+		if limit < 1 {
+			http.Error(w, "server.writeTimeout is too short to profile", http.StatusBadRequest)
+			return
+		}
+
+		seconds, err := strconv.ParseFloat(r.URL.Query().Get("seconds"), 64)
+		switch {
+		case err == nil && seconds > float64(limit):
+			http.Error(w, fmt.Sprintf("seconds must be at most %d to fit within server.writeTimeout", limit), http.StatusBadRequest)
+		case (err != nil || seconds <= 0) && defaultSeconds > limit:
+			r = r.Clone(r.Context())
+			query := r.URL.Query()
+			query.Set("seconds", strconv.Itoa(limit))
+			r.URL.RawQuery = query.Encode()
+			next(w, r)
+		default:
+			next(w, r)
+		}
+	}
+}
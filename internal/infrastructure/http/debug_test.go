@@ -0,0 +1,108 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/repository"
+	"kii.com/internal/infrastructure/validator"
+)
+
+func TestDebugHandler(t *testing.T) {
+	logger := logger.NewLogger()
+	store := validator.NewNonceStore()
+	ledger := repository.NewInMemoryLedger(logger)
+	mux := http.NewServeMux()
+	NewDebugHandler(store, ledger, logger).RegisterRoutes(mux, "admin-token")
+
+	store.IsValid("", "nonce-1", time.Now())
+	store.IsValid("", "nonce-2", time.Now())
+	if err := ledger.AddEntry(context.Background(), entity.LedgerEntry{User: "alice", Asset: "BTC", Amount: "1"}); err != nil {
+		t.Fatalf("AddEntry() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		header     string
+		wantStatus int
+	}{
+		{name: "stats without token", path: "/debug/stats", wantStatus: http.StatusUnauthorized},
+		{name: "pprof without token", path: "/debug/pprof/", wantStatus: http.StatusUnauthorized},
+		{name: "stats", path: "/debug/stats", header: "Bearer admin-token", wantStatus: http.StatusOK},
+		{name: "pprof index", path: "/debug/pprof/", header: "Bearer admin-token", wantStatus: http.StatusOK},
+		{name: "goroutine profile", path: "/debug/pprof/goroutine?debug=1", header: "Bearer admin-token", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.path != "/debug/stats" || w.Code != http.StatusOK {
+				return
+			}
+
+			var stats DebugStats
+			if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+				t.Fatalf("failed to unmarshal stats: %v", err)
+			}
+			if stats.NonceCount != 2 {
+				t.Errorf("nonceCount = %v, want 2", stats.NonceCount)
+			}
+			if stats.EntryCount != 1 {
+				t.Errorf("entryCount = %v, want 1", stats.EntryCount)
+			}
+			if stats.Goroutines == 0 || stats.HeapAllocBytes == 0 {
+				t.Errorf("runtime stats not populated: %+v", stats)
+			}
+		})
+	}
+}
+
+func TestDebugHandler_ProfileFitsWriteTimeout(t *testing.T) {
+	logger := logger.NewLogger()
+	mux := http.NewServeMux()
+	NewDebugHandler(validator.NewNonceStore(), repository.NewInMemoryLedger(logger), logger).RegisterRoutes(mux, "admin-token")
+	srv := httptest.NewUnstartedServer(mux)
+	srv.Config.WriteTimeout = 2 * time.Second
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	profile := func(query string) (int, time.Duration) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/debug/pprof/profile"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer admin-token")
+		start := time.Now()
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET /debug/pprof/profile%s error = %v", query, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode, time.Since(start)
+	}
+
+	// Without ?seconds= the profile is shortened to fit
+	if status, took := profile(""); status != http.StatusOK || took >= srv.Config.WriteTimeout {
+		t.Errorf("default profile = %d after %s, want %d within %s", status, took, http.StatusOK, srv.Config.WriteTimeout)
+	}
+	if status, _ := profile("?seconds=5"); status != http.StatusBadRequest {
+		t.Errorf("profile beyond the write timeout = %d, want %d", status, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,104 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"golang.org/x/text/language"
+
+	"kii.com/internal/domain/entity"
+)
+
+// ErrorCatalog replaces the messages of error responses by code, e.g. to
+// word them for partners or translate them, in the language each client
+// prefers by its Accept-Language header. Codes and statuses never change,
+// so clients matching on them are unaffected.
+type ErrorCatalog struct {
+	messages map[string]string
+	// locales holds the messages of each language; locales[0], matched when
+	// the client prefers none of the others, is empty
+	locales []map[string]string
+	matcher language.Matcher
+}
+
+// builtInErrorCatalog answers with the built-in messages
+var builtInErrorCatalog = &ErrorCatalog{} //nolint:gochecknoglobals
+
+// NewErrorCatalog creates a catalog of messages by code, and of messages by
+// code for each language tag, such as de or pt-BR, in locales. Codes must be
+// those of the error catalog.
+func NewErrorCatalog(messages map[string]string, locales map[string]map[string]string) (*ErrorCatalog, error) {
+	if err := checkMessages(messages); err != nil {
+		return nil, err
+	}
+	c := &ErrorCatalog{
+		messages: messages,
+		locales:  []map[string]string{nil},
+	}
+
+	// Tags are sorted so that matching does not depend on map order
+	names := make([]string, 0, len(locales))
+	for name := range locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tags := []language.Tag{language.Und}
+	for _, name := range names {
+		tag, err := language.Parse(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid language tag %q: %w", name, err)
+		}
+		if err := checkMessages(locales[name]); err != nil {
+			return nil, fmt.Errorf("locale %s: %w", name, err)
+		}
+		tags = append(tags, tag)
+		c.locales = append(c.locales, locales[name])
+	}
+	c.matcher = language.NewMatcher(tags)
+	return c, nil
+}
+
+// checkMessages fails on a message for an unknown code or an empty one
+func checkMessages(messages map[string]string) error {
+	for code, message := range messages {
+		if _, ok := entity.LookupError(code); !ok {
+			return fmt.Errorf("unknown error code %q", code)
+		}
+		if message == "" {
+			return fmt.Errorf("empty message for error code %q", code)
+		}
+	}
+	return nil
+}
+
+// writeError answers r with the status, code and message of the catalog
+// error err is or wraps, or as entity.ErrInternal
+func (c *ErrorCatalog) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var domainErr *entity.Error
+	if !errors.As(err, &domainErr) {
+		domainErr = entity.ErrInternal
+	}
+	writeJSON(w, errorStatus(err, domainErr), errorResponse{Error: c.message(w, r, domainErr), Code: domainErr.Code})
+}
+
+// message returns the message of err for the client of r. When the message
+// depends on the client's language, it adds Accept-Language to the Vary
+// header of w, so that caches keep a response per language.
+func (c *ErrorCatalog) message(w http.ResponseWriter, r *http.Request, err *entity.Error) string {
+	if len(c.locales) > 1 {
+		w.Header().Add("Vary", "Accept-Language")
+		if accepted, _, parseErr := language.ParseAcceptLanguage(r.Header.Get("Accept-Language")); parseErr == nil && len(accepted) > 0 {
+			if _, index, confidence := c.matcher.Match(accepted...); confidence != language.No {
+				if text, ok := c.locales[index][err.Code]; ok {
+					return err.Localize(text)
+				}
+			}
+		}
+	}
+	if text, ok := c.messages[err.Code]; ok {
+		return err.Localize(text)
+	}
+	return err.Message
+}
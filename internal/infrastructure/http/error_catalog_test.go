@@ -0,0 +1,157 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kii.com/internal/domain/entity"
+)
+
+func TestErrorCatalog_WriteError(t *testing.T) {
+	catalog, err := NewErrorCatalog(
+		map[string]string{"asset_frozen": "Trading in this asset is paused"},
+		map[string]map[string]string{
+			"de":    {"asset_frozen": "Der Handel mit diesem Asset ist pausiert", "missing_user": "Benutzer fehlt"},
+			"pt-br": {"missing_user": "Usuário ausente"},
+		},
+	)
+	if err != nil {
+		t.Fatalf("NewErrorCatalog() error = %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		catalog        *ErrorCatalog
+		acceptLanguage string
+		err            error
+		wantMessage    string
+		wantVary       bool
+	}{
+		{
+			name:        "overridden message",
+			catalog:     catalog,
+			err:         entity.ErrAssetFrozen,
+			wantMessage: "Trading in this asset is paused",
+			wantVary:    true,
+		},
+		{
+			name:           "closest locale",
+			catalog:        catalog,
+			acceptLanguage: "fr;q=0.9, de-CH",
+			err:            entity.ErrAssetFrozen,
+			wantMessage:    "Der Handel mit diesem Asset ist pausiert",
+			wantVary:       true,
+		},
+		{
+			name:           "locale keeps field and detail",
+			catalog:        catalog,
+			acceptLanguage: "pt-BR",
+			err:            entity.ErrorAt("entries[1]", entity.ErrMissingUser.WithDetail("got %q", "")),
+			wantMessage:    `entries[1]: Usuário ausente: got ""`,
+			wantVary:       true,
+		},
+		{
+			name:           "code missing from the locale",
+			catalog:        catalog,
+			acceptLanguage: "pt-BR",
+			err:            entity.ErrAssetFrozen,
+			wantMessage:    "Trading in this asset is paused",
+			wantVary:       true,
+		},
+		{
+			name:           "unmatched language",
+			catalog:        catalog,
+			acceptLanguage: "ja",
+			err:            entity.ErrMissingUser,
+			wantMessage:    entity.ErrMissingUser.Message,
+			wantVary:       true,
+		},
+		{
+			name:           "built-in messages",
+			catalog:        builtInErrorCatalog,
+			acceptLanguage: "de",
+			err:            entity.ErrAssetFrozen,
+			wantMessage:    entity.ErrAssetFrozen.Message,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+			if tt.acceptLanguage != "" {
+				r.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			w := httptest.NewRecorder()
+			tt.catalog.writeError(w, r, tt.err)
+
+			var got errorResponse
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			var domainErr *entity.Error
+			if !errors.As(tt.err, &domainErr) {
+				t.Fatalf("%v is not a catalog error", tt.err)
+			}
+			if w.Code != errorStatuses[domainErr.Code] || got.Code != domainErr.Code {
+				t.Errorf("status %d, code %q, want %d, %q", w.Code, got.Code, errorStatuses[domainErr.Code], domainErr.Code)
+			}
+			if got.Error != tt.wantMessage {
+				t.Errorf("message = %q, want %q", got.Error, tt.wantMessage)
+			}
+			if vary := w.Header().Get("Vary") == "Accept-Language"; vary != tt.wantVary {
+				t.Errorf("Vary = %q, want Accept-Language: %t", w.Header().Get("Vary"), tt.wantVary)
+			}
+		})
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeError(w, entity.ErrAssetFrozen)
+
+	var got errorResponse
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.Code != entity.ErrAssetFrozen.Code || got.Error != entity.ErrAssetFrozen.Message {
+		t.Errorf("response = %+v, want the built-in %q error", got, entity.ErrAssetFrozen.Code)
+	}
+	if vary := w.Header().Get("Vary"); vary != "" {
+		t.Errorf("Vary = %q, want none", vary)
+	}
+}
+
+func TestNewErrorCatalog_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages map[string]string
+		locales  map[string]map[string]string
+	}{
+		{name: "unknown code", messages: map[string]string{"no_such_code": "Nope"}},
+		{name: "empty message", messages: map[string]string{"asset_frozen": ""}},
+		{name: "invalid language tag", locales: map[string]map[string]string{"not a tag": {"asset_frozen": "Nope"}}},
+		{name: "unknown code in a locale", locales: map[string]map[string]string{"de": {"no_such_code": "Nein"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewErrorCatalog(tt.messages, tt.locales); err == nil {
+				t.Error("NewErrorCatalog() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestErrorStatuses(t *testing.T) {
+	// Every error of the catalog has its own status
+	for _, code := range entity.ErrorCodes() {
+		if _, ok := errorStatuses[code]; !ok {
+			t.Errorf("no status for error code %q", code)
+		}
+	}
+	if got := errorStatus(&forcedFailure{status: http.StatusTeapot}, entity.ErrForcedFailure); got != http.StatusTeapot {
+		t.Errorf("forced failure status = %d, want %d", got, http.StatusTeapot)
+	}
+}
@@ -0,0 +1,79 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"kii.com/internal/domain/entity"
+)
+
+// errorStatuses are the statuses the errors of the catalog are answered
+// with, by code
+var errorStatuses = map[string]int{ //nolint:gochecknoglobals
+	entity.ErrMissingUser.Code:             http.StatusBadRequest,
+	entity.ErrMissingAsset.Code:            http.StatusBadRequest,
+	entity.ErrMissingAmount.Code:           http.StatusBadRequest,
+	entity.ErrInvalidAmount.Code:           http.StatusBadRequest,
+	entity.ErrMissingHeader.Code:           http.StatusUnauthorized,
+	entity.ErrInvalidTimestamp.Code:        http.StatusUnauthorized,
+	entity.ErrTimestampOutOfTolerance.Code: http.StatusUnauthorized,
+	entity.ErrReplayDetected.Code:          http.StatusUnauthorized,
+	entity.ErrValidationFailed.Code:        http.StatusUnauthorized,
+	entity.ErrInvalidSignature.Code:        http.StatusUnauthorized,
+	entity.ErrPayloadTooLarge.Code:         http.StatusRequestEntityTooLarge,
+	entity.ErrDuplicateWebhook.Code:        http.StatusConflict,
+	entity.ErrAssetFrozen.Code:             http.StatusLocked,
+	entity.ErrPendingNotFound.Code:         http.StatusNotFound,
+	entity.ErrApprovalMismatch.Code:        http.StatusConflict,
+	entity.ErrApprovalSameSource.Code:      http.StatusConflict,
+	entity.ErrInvalidUser.Code:             http.StatusBadRequest,
+	entity.ErrVelocityExceeded.Code:        http.StatusUnprocessableEntity,
+	entity.ErrInvalidBatch.Code:            http.StatusBadRequest,
+	entity.ErrInvalidTrade.Code:            http.StatusBadRequest,
+	entity.ErrInvalidLabels.Code:           http.StatusBadRequest,
+	entity.ErrBatchUnsupported.Code:        http.StatusNotImplemented,
+	entity.ErrBatchApproval.Code:           http.StatusUnprocessableEntity,
+	entity.ErrInvalidPeriod.Code:           http.StatusBadRequest,
+	entity.ErrHistoryUnsupported.Code:      http.StatusNotImplemented,
+	entity.ErrCompactionUnsupported.Code:   http.StatusNotImplemented,
+	entity.ErrPruningUnsupported.Code:      http.StatusNotImplemented,
+	entity.ErrHoldingsUnsupported.Code:     http.StatusNotImplemented,
+	entity.ErrHoldsUnsupported.Code:        http.StatusNotImplemented,
+	entity.ErrSegmentNotFound.Code:         http.StatusNotFound,
+	entity.ErrInvalidDeadline.Code:         http.StatusBadRequest,
+	entity.ErrDeadlineExceeded.Code:        http.StatusGatewayTimeout,
+	entity.ErrInvalidTestHeader.Code:       http.StatusBadRequest,
+	entity.ErrForcedFailure.Code:           http.StatusInternalServerError,
+	entity.ErrReadOnly.Code:                http.StatusMethodNotAllowed,
+	entity.ErrStorageTransient.Code:        http.StatusServiceUnavailable,
+	entity.ErrStorageUnavailable.Code:      http.StatusServiceUnavailable,
+	entity.ErrInternal.Code:                http.StatusInternalServerError,
+}
+
+// forcedFailure is entity.ErrForcedFailure answered with the status the
+// sender asked for in mock mode
+type forcedFailure struct {
+	status int
+}
+
+func (f *forcedFailure) Error() string {
+	return entity.ErrForcedFailure.Error()
+}
+
+// Unwrap returns entity.ErrForcedFailure
+func (f *forcedFailure) Unwrap() error {
+	return entity.ErrForcedFailure
+}
+
+// errorStatus returns the status err, which is or wraps domainErr, is
+// answered with
+func errorStatus(err error, domainErr *entity.Error) int {
+	var forced *forcedFailure
+	if errors.As(err, &forced) {
+		return forced.status
+	}
+	if status, ok := errorStatuses[domainErr.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,92 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/infrastructure/logger"
+)
+
+const (
+	// ForceStatusHeader makes a mock server answer a webhook with that status,
+	// from 400 to 599, without applying it
+	ForceStatusHeader = "X-Test-Force-Status"
+	// DelayHeader makes a mock server wait that long, e.g. 2s, before
+	// applying a webhook or failing it as ForceStatusHeader asks
+	DelayHeader = "X-Test-Delay"
+)
+
+// maxInjectedDelay bounds DelayHeader so that a sender cannot hold a
+// request open indefinitely
+const maxInjectedDelay = time.Minute
+
+// injectedFailure is the failure a sender asked for with the failure
+// injection headers; zero fields inject nothing
+type injectedFailure struct {
+	status int
+	delay  time.Duration
+}
+
+// parseInjectedFailure reads the failure injection headers of header
+func parseInjectedFailure(header http.Header) (injectedFailure, error) {
+	var failure injectedFailure
+	if value := header.Get(ForceStatusHeader); value != "" {
+		status, err := strconv.Atoi(value)
+		if err != nil || status < 400 || status > 599 {
+			return injectedFailure{}, entity.ErrInvalidTestHeader.WithDetail("%s: %q is not a status from 400 to 599", ForceStatusHeader, value)
+		}
+		failure.status = status
+	}
+	if value := header.Get(DelayHeader); value != "" {
+		delay, err := time.ParseDuration(value)
+		if err != nil || delay < 0 || delay > maxInjectedDelay {
+			return injectedFailure{}, entity.ErrInvalidTestHeader.WithDetail("%s: %q is not a duration up to %s", DelayHeader, value, maxInjectedDelay)
+		}
+		failure.delay = delay
+	}
+	return failure, nil
+}
+
+// injectFailure delays or fails a webhook in mock mode as its sender asked
+// with the failure injection headers. It reports whether the webhook is
+// still to be applied; if not, r has been answered.
+func (h *Handler) injectFailure(w http.ResponseWriter, r *http.Request, sourceName string) bool {
+	failure, err := parseInjectedFailure(r.Header)
+	if err != nil {
+		h.writeError(w, r, err)
+		return false
+	}
+	if failure == (injectedFailure{}) {
+		return true
+	}
+
+	ctx := r.Context()
+	requestLogger := ctx.Value("logger").(logger.Logger)
+	requestLogger.LogInfo(ctx, "Injecting webhook failure",
+		"source", sourceTag(sourceName),
+		"delay", failure.delay.String(),
+		"status", failure.status)
+
+	if failure.delay > 0 {
+		timer := time.NewTimer(failure.delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			// The sender's own deadline passed; otherwise it is gone
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				h.writeError(w, r, entity.ErrDeadlineExceeded)
+			}
+			return false
+		}
+	}
+	if failure.status != 0 {
+		h.writeError(w, r, &forcedFailure{status: failure.status})
+		return false
+	}
+	return true
+}
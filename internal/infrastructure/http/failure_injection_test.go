@@ -0,0 +1,126 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kii.com/internal/application/usecase"
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/infrastructure/logger"
+)
+
+func TestParseInjectedFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    injectedFailure
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "status", headers: map[string]string{ForceStatusHeader: "503"}, want: injectedFailure{status: 503}},
+		{name: "delay", headers: map[string]string{DelayHeader: "1.5s"}, want: injectedFailure{delay: 1500 * time.Millisecond}},
+		{
+			name:    "both",
+			headers: map[string]string{ForceStatusHeader: "429", DelayHeader: "2s"},
+			want:    injectedFailure{status: 429, delay: 2 * time.Second},
+		},
+		{name: "success status", headers: map[string]string{ForceStatusHeader: "200"}, wantErr: true},
+		{name: "invalid status", headers: map[string]string{ForceStatusHeader: "boom"}, wantErr: true},
+		{name: "invalid delay", headers: map[string]string{DelayHeader: "2"}, wantErr: true},
+		{name: "overlong delay", headers: map[string]string{DelayHeader: "1h"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for key, value := range tt.headers {
+				header.Set(key, value)
+			}
+			got, err := parseInjectedFailure(header)
+			if tt.wantErr {
+				if !errors.Is(err, entity.ErrInvalidTestHeader) {
+					t.Errorf("parseInjectedFailure() error = %v, want %v", err, entity.ErrInvalidTestHeader)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseInjectedFailure() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("parseInjectedFailure() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler_HandleWebhook_InjectedFailure(t *testing.T) {
+	logger := logger.NewLogger()
+
+	tests := []struct {
+		name        string
+		mock        bool
+		headers     map[string]string
+		wantStatus  int
+		wantCode    string
+		wantApplied bool
+	}{
+		{name: "forced status", mock: true, headers: map[string]string{ForceStatusHeader: "503"}, wantStatus: http.StatusServiceUnavailable, wantCode: "forced_failure"},
+		{name: "delay", mock: true, headers: map[string]string{DelayHeader: "10ms"}, wantStatus: http.StatusOK, wantApplied: true},
+		{
+			name:       "delay past the sender's deadline",
+			mock:       true,
+			headers:    map[string]string{DelayHeader: "1s", TimeoutHeader: "0.05"},
+			wantStatus: http.StatusGatewayTimeout,
+			wantCode:   "deadline_exceeded",
+		},
+		{name: "invalid header", mock: true, headers: map[string]string{ForceStatusHeader: "teapot"}, wantStatus: http.StatusBadRequest, wantCode: "invalid_test_header"},
+		{name: "ignored outside mock mode", headers: map[string]string{ForceStatusHeader: "503"}, wantStatus: http.StatusOK, wantApplied: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := &mockValidator{}
+			var applied bool
+			mockRepo := &mockRepository{
+				addEntryFunc: func(ctx context.Context, entry entity.LedgerEntry) error {
+					applied = true
+					return nil
+				},
+			}
+			handler := NewHandler(
+				usecase.NewProcessWebhookUseCase(validator, mockRepo),
+				usecase.NewGetBalanceUseCase(mockRepo),
+				validator,
+				logger,
+				WithMock(tt.mock),
+			)
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(`{"user":"user1","asset":"BTC","amount":"1"}`))
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			req = req.WithContext(context.WithValue(req.Context(), "logger", logger))
+			w := httptest.NewRecorder()
+			handler.HandleWebhook(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantCode != "" {
+				var got errorResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got.Code != tt.wantCode {
+					t.Errorf("body = %s, want code %s", w.Body.String(), tt.wantCode)
+				}
+			}
+			if applied != tt.wantApplied {
+				t.Errorf("applied = %v, want %v", applied, tt.wantApplied)
+			}
+		})
+	}
+}
@@ -1,24 +1,259 @@
 package http
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"kii.com/internal/application/usecase"
 	"kii.com/internal/domain/entity"
 	"kii.com/internal/domain/port"
+	"kii.com/internal/infrastructure/attestation"
+	"kii.com/internal/infrastructure/audit"
+	"kii.com/internal/infrastructure/clock"
 	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/mapper"
+	"kii.com/internal/infrastructure/metrics"
+	"kii.com/internal/infrastructure/mirror"
+	"kii.com/internal/infrastructure/workerpool"
 )
 
+// ApprovalIDHeader carries the ID of the pending entry a webhook approves
+const ApprovalIDHeader = "X-Approval-Id"
+
+// ValidationReportHeader tells, in mock mode, whether a webhook would have
+// been accepted: "valid", or "invalid" with the code and message it would
+// have been rejected with
+const ValidationReportHeader = "X-Validation-Report"
+
+// queueFullRetryAfter is the Retry-After hint, in seconds, sent when the
+// worker pool rejects a webhook
+const queueFullRetryAfter = "1"
+
+// storageUnavailableRetryAfter is the Retry-After hint, in seconds, sent
+// while the storage backend is considered down
+const storageUnavailableRetryAfter = "5"
+
 // Handler holds HTTP handlers and their dependencies
 type Handler struct {
 	processWebhookUseCase *usecase.ProcessWebhookUseCase
 	getBalanceUseCase     *usecase.GetBalanceUseCase
 	validator             port.WebhookValidator
 	logger                logger.Logger
+	stats                 *metrics.Collector
+	metrics               metrics.Emitter
+	audit                 *audit.Logger
+	logSampler            *logger.Sampler
+	capture               *DebugCapture
+	signatureHints        bool
+	maxBodyBytes          int64
+	errorCatalog          *ErrorCatalog
+	mock                  bool
+	readOnly              bool
+	mirror                *mirror.Mirror
+	duplicates            port.DuplicateStore
+	rejectDuplicates      bool
+	clock                 port.Clock
+	pool                  *workerpool.Pool
+	streamLedgerUseCase   *usecase.StreamLedgerUseCase
+	sources               map[string]WebhookSource
+	// sourcePaths are the names of the sources served at paths of their own,
+	// by path
+	sourcePaths map[string]string
+	// assetTags are the lowercased assets webhook metrics are tagged with
+	assetTags            map[string]struct{}
+	mapper               port.PayloadMapper
+	usage                *metrics.UsageMeter
+	attestBalanceUseCase *usecase.AttestBalanceUseCase
+	statementUseCase     *usecase.GenerateStatementUseCase
+	attestationKeys      []attestation.JWK
+	userPolicy           entity.UserPolicy
+	// etagPrefix sets this process's balance ETags apart from those of an
+	// earlier run, whose in-memory sequences started over
+	etagPrefix string
+}
+
+// HandlerOption configures optional Handler dependencies
+type HandlerOption func(*Handler)
+
+// WithStats records request and webhook statistics in the given collector
+func WithStats(stats *metrics.Collector) HandlerOption {
+	return func(h *Handler) {
+		h.stats = stats
+	}
+}
+
+// WithMetrics emits request, validation failure and entry metrics to emitter
+func WithMetrics(emitter metrics.Emitter) HandlerOption {
+	return func(h *Handler) {
+		h.metrics = emitter
+	}
+}
+
+// WithAudit records validation failures and replays in the given audit log
+func WithAudit(auditLog *audit.Logger) HandlerOption {
+	return func(h *Handler) {
+		h.audit = auditLog
+	}
+}
+
+// WithLogSampler logs info records for only the webhooks kept by sampler.
+// Warnings, errors and failed requests are always logged.
+func WithLogSampler(sampler *logger.Sampler) HandlerOption {
+	return func(h *Handler) {
+		h.logSampler = sampler
+	}
+}
+
+// WithDebugCapture logs the full, redacted request for failed validations
+// from the sources selected by capture
+func WithDebugCapture(capture *DebugCapture) HandlerOption {
+	return func(h *Handler) {
+		h.capture = capture
+	}
+}
+
+// WithMock applies webhooks that fail validation instead of rejecting them,
+// reporting whether each would have been accepted in ValidationReportHeader,
+// for a sandbox handed to integrating partners
+func WithMock(enabled bool) HandlerOption {
+	return func(h *Handler) {
+		h.mock = enabled
+	}
+}
+
+// WithReadOnly rejects every webhook with ErrReadOnly, for replicas that
+// serve balances and history from a store another server writes
+func WithReadOnly(enabled bool) HandlerOption {
+	return func(h *Handler) {
+		h.readOnly = enabled
+	}
+}
+
+// WithUserPolicy looks up the user of the balance, ledger, statement and
+// attestation routes in the case policy normalizes webhook users to, so
+// that reads find the accounts webhooks were applied to
+func WithUserPolicy(policy entity.UserPolicy) HandlerOption {
+	return func(h *Handler) {
+		h.userPolicy = policy
+	}
+}
+
+// WithSignatureHints answers signature mismatches from the sources selected
+// by WithDebugCapture with the bytes the service signed, base64 encoded, so
+// a sender can compare them with its own
+func WithSignatureHints(enabled bool) HandlerOption {
+	return func(h *Handler) {
+		h.signatureHints = enabled
+	}
+}
+
+// WithMaxBodyBytes rejects webhooks whose body is longer than limit bytes
+// with 413, reading no more of it than that
+func WithMaxBodyBytes(limit int64) HandlerOption {
+	return func(h *Handler) {
+		h.maxBodyBytes = limit
+	}
+}
+
+// WithErrorCatalog answers with the messages of catalog in place of the
+// built-in ones. A nil catalog keeps the built-in messages.
+func WithErrorCatalog(catalog *ErrorCatalog) HandlerOption {
+	return func(h *Handler) {
+		if catalog != nil {
+			h.errorCatalog = catalog
+		}
+	}
+}
+
+// WithMirror copies every webhook that passes validation to m
+func WithMirror(m *mirror.Mirror) HandlerOption {
+	return func(h *Handler) {
+		h.mirror = m
+	}
+}
+
+// WithDuplicateCheck records a digest of every webhook's source, user,
+// asset, amount and body in store and logs those seen within its window,
+// which a sender re-posting an event under a fresh nonce would send. With
+// reject they are answered with 409 instead of being applied. Approvals are
+// not checked.
+func WithDuplicateCheck(store port.DuplicateStore, reject bool) HandlerOption {
+	return func(h *Handler) {
+		h.duplicates = store
+		h.rejectDuplicates = reject
+	}
+}
+
+// WithClock sets the clock webhooks are checked for duplicates against,
+// instead of the system clock
+func WithClock(c port.Clock) HandlerOption {
+	return func(h *Handler) {
+		h.clock = c
+	}
+}
+
+// WithWorkerPool applies webhooks to the ledger on pool's workers, rejecting
+// them with 503 when its queue is full. Without a pool webhooks are applied
+// on the request goroutine.
+func WithWorkerPool(pool *workerpool.Pool) HandlerOption {
+	return func(h *Handler) {
+		h.pool = pool
+	}
+}
+
+// WithAssetTags tags webhook metrics with the asset of an entry when it is one
+// of assets, the assets configured under assets, and with "other" otherwise.
+// Senders choose the assets, so tagging every one would grow the metrics
+// backend without bound.
+func WithAssetTags(assets []string) HandlerOption {
+	return func(h *Handler) {
+		h.assetTags = make(map[string]struct{}, len(assets))
+		for _, asset := range assets {
+			h.assetTags[strings.ToLower(asset)] = struct{}{}
+		}
+	}
+}
+
+// WithLedgerHistory serves GET /ledger/{user}, streaming the user's entries
+func WithLedgerHistory(streamLedgerUseCase *usecase.StreamLedgerUseCase) HandlerOption {
+	return func(h *Handler) {
+		h.streamLedgerUseCase = streamLedgerUseCase
+	}
+}
+
+// WithUsage meters accepted webhooks, their size and validation failures per
+// tenant, i.e. per webhook source
+func WithUsage(meter *metrics.UsageMeter) HandlerOption {
+	return func(h *Handler) {
+		h.usage = meter
+	}
+}
+
+// WithAttestation serves GET /attestation/{user}, a signed attestation of the
+// user's balances, and publishes keys, the public keys verifying it, at
+// GET /.well-known/jwks.json. A nil use case leaves both routes unserved.
+func WithAttestation(attestBalanceUseCase *usecase.AttestBalanceUseCase, keys []attestation.JWK) HandlerOption {
+	return func(h *Handler) {
+		h.attestBalanceUseCase = attestBalanceUseCase
+		h.attestationKeys = keys
+	}
+}
+
+// WithStatements serves GET /statements/{user}/{period}, the user's statement
+// for a day or month
+func WithStatements(statementUseCase *usecase.GenerateStatementUseCase) HandlerOption {
+	return func(h *Handler) {
+		h.statementUseCase = statementUseCase
+	}
 }
 
 // NewHandler creates a new HTTP handler
@@ -27,48 +262,178 @@ func NewHandler(
 	getBalanceUseCase *usecase.GetBalanceUseCase,
 	validator port.WebhookValidator,
 	logger logger.Logger,
+	opts ...HandlerOption,
 ) *Handler {
-	return &Handler{
+	h := &Handler{
 		processWebhookUseCase: processWebhookUseCase,
 		getBalanceUseCase:     getBalanceUseCase,
 		validator:             validator,
 		logger:                logger,
+		metrics:               metrics.NopEmitter{},
+		clock:                 clock.System{},
+		errorCatalog:          builtInErrorCatalog,
+		etagPrefix:            strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
 }
 
-// HandleWebhook handles POST /webhook requests
+// HandleWebhook handles POST /webhook and /webhook/{source} requests, and
+// requests to the paths of sources that have their own
 func (h *Handler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	requestLogger := ctx.Value("logger").(logger.Logger)
 
-	if r.Method != http.MethodPost {
+	// Requests to /webhook/{source}, or to the source's own path, use that
+	// source's validator, mapping and method
+	source := WebhookSource{
+		Validator:       h.validator,
+		Mapper:          h.mapper,
+		TimestampHeader: "X-Timestamp",
+		NonceHeader:     "X-Nonce",
+	}
+	var sourceName string
+	if name, named := strings.CutPrefix(r.URL.Path, "/webhook/"); named {
+		var ok bool
+		if source, ok = h.sources[strings.ToLower(name)]; !ok {
+			http.Error(w, "Unknown webhook source", http.StatusNotFound)
+			return
+		}
+		sourceName = name
+	} else if name, ok := h.sourcePaths[r.URL.Path]; ok {
+		source = h.sources[name]
+		sourceName = name
+	}
+
+	// Replicas accept no webhooks
+	if h.readOnly {
+		h.writeError(w, r, entity.ErrReadOnly)
+		return
+	}
+
+	method := source.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	if r.Method != method {
+		w.Header().Set("Allow", method)
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Read request body
-	body, err := io.ReadAll(r.Body)
+	// Senders may bound how long they wait, so that a webhook is not applied
+	// after they have given up on it and retried. The deadline bounds the
+	// wait for a worker, not the use case once started: applyCtx is the
+	// request's own context.
+	applyCtx := ctx
+	deadline, bounded, err := requestDeadline(r.Header, time.Now())
 	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	if bounded {
+		if !deadline.After(time.Now()) {
+			h.metrics.Count("webhook.deadline_exceeded", 1, "source:"+sourceTag(sourceName))
+			h.writeError(w, r, entity.ErrDeadlineExceeded)
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
+	// Validators that can sign the body as it is read check its headers first,
+	// so that unsigned requests are rejected without reading the body
+	var verifier port.BodyVerifier
+	var validationErr error
+	if streaming, ok := source.Validator.(port.StreamingWebhookValidator); ok {
+		begun, err := streaming.BeginRequest(ctx, r)
+		switch {
+		case err == nil:
+			verifier = begun
+		case h.mock:
+			validationErr = err
+		default:
+			h.rejectInvalid(w, r, source, sourceName, nil, err)
+			return
+		}
+	}
+
+	// Read request body into a pooled buffer, no longer than the limit and
+	// sized up front to the declared length within it. A job abandoned by a
+	// canceled request may still hold the body, so its buffer is not
+	// recycled.
+	var bodyReader io.Reader = r.Body
+	sizeHint := min(r.ContentLength, maxPooledBodyBuffer)
+	if h.maxBodyBytes > 0 {
+		if r.ContentLength > h.maxBodyBytes {
+			h.rejectTooLarge(w, r, source, sourceName, 0)
+			return
+		}
+		bodyReader = http.MaxBytesReader(w, r.Body, h.maxBodyBytes)
+		sizeHint = r.ContentLength
+	}
+	if verifier != nil {
+		bodyReader = io.TeeReader(bodyReader, verifier)
+	}
+	bodyBuf, err := readBody(bodyReader, sizeHint)
+	if err != nil {
+		if errors.As(err, new(*http.MaxBytesError)) {
+			h.rejectTooLarge(w, r, source, sourceName, int(h.maxBodyBytes))
+			return
+		}
 		requestLogger.LogError(ctx, "Failed to read request body", err)
 		http.Error(w, "Failed to read request body", http.StatusBadRequest)
 		return
 	}
+	defer func() {
+		if ctx.Err() == nil {
+			releaseBody(bodyBuf)
+		}
+	}()
+	body := bodyBuf.Bytes()
 
-	// Validate webhook signature
-	if err := h.validator.ValidateRequest(ctx, r, body); err != nil {
-		requestLogger.LogWarning(ctx, "Webhook validation failed", err)
-		http.Error(w, fmt.Sprintf("Validation failed: %v", err), http.StatusUnauthorized)
+	// Validate webhook signature; in mock mode failures are only reported
+	if validationErr == nil {
+		if verifier != nil {
+			validationErr = verifier.Verify(ctx, body)
+		} else {
+			validationErr = source.Validator.ValidateRequest(ctx, r, body)
+		}
+	}
+	if h.mock {
+		h.reportValidation(w, r, sourceName, validationErr)
+		// Senders may also ask a mock server to delay or fail a webhook
+		if !h.injectFailure(w, r, sourceName) {
+			return
+		}
+	} else if validationErr != nil {
+		h.rejectInvalid(w, r, source, sourceName, body, validationErr)
 		return
 	}
+	h.mirror.Send(r.URL.Path, r.Header.Get(source.NonceHeader), body)
 
 	// Parse JSON body
-	var webhookReq entity.WebhookRequest
-	if err := json.Unmarshal(body, &webhookReq); err != nil {
+	if source.Mapper == nil {
+		source.Mapper = mapper.NewNative()
+	}
+	webhookReq, err := source.Mapper.Map(body)
+	if err != nil {
 		requestLogger.LogError(ctx, "Failed to parse JSON body", err)
 		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
 		return
 	}
 
+	// Catch events re-posted under a fresh nonce
+	duplicateKey, duplicate := h.checkDuplicate(ctx, r, sourceName, webhookReq, body)
+	if duplicate && h.rejectDuplicates {
+		h.writeError(w, r, entity.ErrDuplicateWebhook)
+		return
+	}
+
 	// Execute use case
 	req := usecase.ProcessWebhookRequest{
 		WebhookRequest: &webhookReq,
@@ -76,25 +441,172 @@ func (h *Handler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
 			header: r.Header,
 			body:   body,
 		},
+		Source:     sourceTag(sourceName),
+		ApprovalID: r.Header.Get(ApprovalIDHeader),
 	}
 
-	if err := h.processWebhookUseCase.Execute(ctx, req); err != nil {
-		requestLogger.LogError(ctx, "Failed to process webhook", err)
-		http.Error(w, fmt.Sprintf("Failed to process webhook: %v", err), http.StatusInternalServerError)
+	if err := h.processWebhook(applyCtx, ctx, req); err != nil {
+		// A webhook that provably changed nothing may be sent again
+		if duplicateKey != "" && notApplied(err) {
+			h.duplicates.Forget(duplicateKey)
+		}
+		// A webhook the sender is asked to retry may be retried as sent
+		if validationErr == nil && retryable(err) {
+			if releaser, ok := source.Validator.(port.NonceReleaser); ok {
+				releaser.ReleaseNonce(r)
+			}
+		}
+		var approvalRequired *entity.ApprovalRequiredError
+		switch {
+		case errors.Is(err, workerpool.ErrQueueFull) || errors.Is(err, workerpool.ErrClosed):
+			requestLogger.LogWarning(ctx, "Webhook rejected", "error", err.Error())
+			h.metrics.Count("webhook.rejected", 1)
+			w.Header().Set("Retry-After", queueFullRetryAfter)
+			http.Error(w, "Server busy, retry later", http.StatusServiceUnavailable)
+			return
+		case errors.As(err, &approvalRequired):
+			h.usage.RecordWebhook(sourceTag(sourceName), len(body))
+			h.stats.RecordWebhook(webhookEvent(sourceName, metrics.WebhookPending, webhookReq))
+			h.metrics.Count("webhook.pending", 1, "asset:"+h.assetTag(webhookReq.Asset), "source:"+sourceTag(sourceName),
+				"policy:"+string(approvalRequired.Policy))
+			h.auditApproval(r, audit.EventEntryParked, approvalRequired.ID, sourceName, webhookReq,
+				"policy", string(approvalRequired.Policy), "reason", approvalRequired.Reason)
+			requestLogger.LogWarning(ctx, "Webhook parked for approval",
+				"source", sourceTag(sourceName),
+				"pending_id", approvalRequired.ID,
+				"policy", string(approvalRequired.Policy),
+				"reason", approvalRequired.Reason,
+				"user", webhookReq.User,
+				"asset", webhookReq.Asset,
+				"amount", webhookReq.Amount)
+			writeJSON(w, http.StatusAccepted, map[string]string{"status": "pending", "id": approvalRequired.ID})
+			return
+		case errors.Is(err, workerpool.ErrNotStarted) && errors.Is(err, context.DeadlineExceeded):
+			requestLogger.LogWarning(ctx, "Webhook rejected", "error", err.Error(),
+				"deadline", deadline.UTC().Format(time.RFC3339Nano))
+			h.metrics.Count("webhook.deadline_exceeded", 1, "source:"+sourceTag(sourceName))
+			h.writeError(w, r, entity.ErrDeadlineExceeded)
+			return
+		case errors.Is(err, entity.ErrStorageUnavailable):
+			requestLogger.LogWarning(ctx, "Webhook rejected", "error", err.Error())
+			h.metrics.Count("webhook.rejected", 1)
+			w.Header().Set("Retry-After", storageUnavailableRetryAfter)
+			h.writeError(w, r, err)
+			return
+		case errors.Is(err, entity.ErrVelocityExceeded):
+			h.metrics.Count("webhook.velocity_exceeded", 1, "source:"+sourceTag(sourceName))
+		case errors.Is(err, entity.ErrAssetFrozen):
+			h.metrics.Count("webhook.frozen", 1, "source:"+sourceTag(sourceName))
+		}
+		var domainErr *entity.Error
+		if errors.As(err, &domainErr) && errorStatus(err, domainErr) < http.StatusInternalServerError {
+			args := []any{"source", sourceTag(sourceName), "code", domainErr.Code, "error", err.Error()}
+			if req.ApprovalID != "" {
+				args = append(args, "pending_id", req.ApprovalID)
+			}
+			requestLogger.LogWarning(ctx, "Webhook rejected", args...)
+		} else {
+			requestLogger.LogError(ctx, "Failed to process webhook", err)
+		}
+		h.writeError(w, r, err)
 		return
 	}
 
-	// Success response
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	if req.ApprovalID != "" {
+		h.auditApproval(r, audit.EventEntryApproved, req.ApprovalID, sourceName, webhookReq)
+	}
+	for _, entry := range webhookReq.LedgerEntries() {
+		h.stats.RecordEntry(entry.User, entry.Labels.Pairs()...)
+		h.metrics.Count("webhook.processed", 1, "asset:"+h.assetTag(entry.Asset), "source:"+sourceTag(sourceName))
+	}
+	h.usage.RecordWebhook(sourceTag(sourceName), len(body))
+	h.stats.RecordWebhook(webhookEvent(sourceName, metrics.WebhookProcessed, webhookReq))
 
+	// Success response, in the source's own shape when it has one
+	if source.Response != nil {
+		err = source.Response.write(w, r, sourceTag(sourceName), r.Header.Get(source.NonceHeader), body)
+		if err != nil {
+			requestLogger.LogWarning(ctx, "Failed to render success response",
+				"source", sourceTag(sourceName),
+				"error", err.Error())
+		}
+	}
+	if source.Response == nil || err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	}
+
+	if len(webhookReq.Legs) > 0 {
+		requestLogger.LogInfo(ctx, "Webhook trade processed successfully",
+			"source", sourceTag(sourceName),
+			"user", webhookReq.User,
+			"legs", len(webhookReq.Legs))
+		return
+	}
+	if len(webhookReq.Entries) > 0 {
+		requestLogger.LogInfo(ctx, "Webhook batch processed successfully",
+			"source", sourceTag(sourceName),
+			"entries", len(webhookReq.Entries))
+		return
+	}
 	requestLogger.LogInfo(ctx, "Webhook processed successfully",
+		"source", sourceTag(sourceName),
 		"user", webhookReq.User,
 		"asset", webhookReq.Asset,
 		"amount", webhookReq.Amount)
 }
 
+// processWebhook applies req on the worker pool if one is configured. The
+// webhooks of a user are applied in the order they arrive, so a deposit is
+// applied before a withdrawal sent after it.
+func (h *Handler) processWebhook(ctx, waitCtx context.Context, req usecase.ProcessWebhookRequest) error {
+	if h.pool == nil {
+		return h.processWebhookUseCase.Execute(ctx, req)
+	}
+	// waitCtx only bounds the wait for a worker; a started job runs under ctx
+	// and is waited for, so that its outcome is always known
+	return h.pool.SubmitKeyed(waitCtx, orderingKey(req.WebhookRequest), func(context.Context) error {
+		return h.processWebhookUseCase.Execute(ctx, req)
+	})
+}
+
+// notApplied reports whether err, returned by processWebhook, proves that
+// the webhook changed nothing: it never reached a worker, was rejected
+// before it was applied, or found the storage circuit open. Any other
+// failure may have left entries behind.
+func notApplied(err error) bool {
+	if errors.Is(err, workerpool.ErrNotStarted) || errors.Is(err, workerpool.ErrQueueFull) ||
+		errors.Is(err, workerpool.ErrClosed) || errors.Is(err, entity.ErrStorageUnavailable) {
+		return true
+	}
+	if errors.As(err, new(*entity.ApprovalRequiredError)) {
+		return false
+	}
+	var domainErr *entity.Error
+	return errors.As(err, &domainErr) && errorStatus(err, domainErr) < http.StatusInternalServerError
+}
+
+// retryable reports whether err is the outcome of a webhook that was not
+// applied and that its sender is asked to retry: rejected while the server
+// is busy or its storage is unavailable, or never started before its
+// deadline
+func retryable(err error) bool {
+	return errors.Is(err, workerpool.ErrQueueFull) || errors.Is(err, workerpool.ErrClosed) ||
+		errors.Is(err, entity.ErrStorageUnavailable) ||
+		(errors.Is(err, workerpool.ErrNotStarted) && errors.Is(err, context.DeadlineExceeded))
+}
+
+// orderingKey returns the user whose webhooks req is ordered with. A batch
+// is ordered with the user of its first item. Users are compared without
+// case, as the user policy may normalize it only when the webhook is applied.
+func orderingKey(req *entity.WebhookRequest) string {
+	if len(req.Entries) > 0 {
+		return strings.ToLower(req.Entries[0].User)
+	}
+	return strings.ToLower(req.User)
+}
+
 // HandleBalance handles GET /balance/{user} requests
 func (h *Handler) HandleBalance(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -112,16 +624,35 @@ func (h *Handler) HandleBalance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := path
+	user := h.userPolicy.Normalize(path)
 
 	// Execute use case
 	balance, err := h.getBalanceUseCase.Execute(ctx, user)
+	if errors.Is(err, entity.ErrStorageUnavailable) {
+		requestLogger.LogWarning(ctx, "Failed to get balance", "error", err.Error())
+		w.Header().Set("Retry-After", storageUnavailableRetryAfter)
+		h.writeError(w, r, err)
+		return
+	}
 	if err != nil {
 		requestLogger.LogError(ctx, "Failed to get balance", err)
-		http.Error(w, "Failed to get balance", http.StatusInternalServerError)
+		h.writeError(w, r, err)
 		return
 	}
 
+	// Polling clients revalidate with If-None-Match and get 304 until the
+	// user's next entry is applied. Holds change without an entry, so
+	// balances with holds are not cached.
+	if balance.Sequence > 0 && len(balance.Held) == 0 {
+		etag := `"` + h.etagPrefix + "-" + strconv.FormatUint(balance.Sequence, 10) + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(balance); err != nil {
@@ -133,6 +664,420 @@ func (h *Handler) HandleBalance(w http.ResponseWriter, r *http.Request) {
 		"user", user)
 }
 
+// HandleAttestation handles GET /attestation/{user} requests, returning the
+// user's balances as a JWS in compact serialization
+func (h *Handler) HandleAttestation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	requestLogger := ctx.Value("logger").(logger.Logger)
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := strings.TrimPrefix(r.URL.Path, "/attestation/")
+	if user == "" || user == r.URL.Path {
+		http.Error(w, "Missing user parameter", http.StatusBadRequest)
+		return
+	}
+	user = h.userPolicy.Normalize(user)
+
+	token, err := h.attestBalanceUseCase.Execute(ctx, user)
+	if err != nil {
+		requestLogger.LogError(ctx, "Failed to attest balance", err)
+		http.Error(w, "Failed to attest balance", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/jose")
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(w, token)
+
+	requestLogger.LogInfo(ctx, "Balance attested",
+		"user", user)
+}
+
+// HandleStatement handles GET /statements/{user}/{period} requests,
+// returning the user's statement for the period as JSON, or as CSV with
+// ?format=csv, as a download
+func (h *Handler) HandleStatement(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	requestLogger := ctx.Value("logger").(logger.Logger)
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/statements/")
+	i := strings.LastIndex(path, "/")
+	if path == r.URL.Path || i <= 0 || i == len(path)-1 {
+		http.Error(w, "Missing user or period parameter", http.StatusBadRequest)
+		return
+	}
+	user, period := h.userPolicy.Normalize(path[:i]), path[i+1:]
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		format = statementJSON
+	case statementJSON, statementCSV:
+	default:
+		http.Error(w, "Invalid format: want json or csv", http.StatusBadRequest)
+		return
+	}
+
+	statement, err := h.statementUseCase.Execute(ctx, user, period)
+	if err != nil {
+		var domainErr *entity.Error
+		if errors.As(err, &domainErr) && errorStatus(err, domainErr) < http.StatusInternalServerError {
+			requestLogger.LogWarning(ctx, "Statement rejected", "user", user, "period", period, "error", err.Error())
+		} else {
+			requestLogger.LogError(ctx, "Failed to generate statement", err, "user", user, "period", period)
+		}
+		if errors.Is(err, entity.ErrStorageUnavailable) {
+			w.Header().Set("Retry-After", storageUnavailableRetryAfter)
+		}
+		h.writeError(w, r, err)
+		return
+	}
+
+	filename := "statement-" + user + "-" + period + "." + format
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	if format == statementCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		if err := writeStatementCSV(w, statement); err != nil {
+			requestLogger.LogError(ctx, "Failed to write statement", err)
+			return
+		}
+	} else {
+		writeJSON(w, http.StatusOK, statement)
+	}
+
+	requestLogger.LogInfo(ctx, "Statement generated",
+		"user", user,
+		"period", period,
+		"format", format,
+		"entries", len(statement.Entries))
+}
+
+// HandleJWKS handles GET /.well-known/jwks.json requests, publishing the
+// public keys that verify balance attestations
+func (h *Handler) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	writeJSON(w, http.StatusOK, map[string][]attestation.JWK{"keys": h.attestationKeys})
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, comparing
+// weakly as RFC 9110 requires for GET
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// validationFailureReason reduces a validation error to a low-cardinality
+// reason. Reasons predate the error catalog and are kept as they were, its
+// English text without details, so stats, metrics and audit records keep
+// their keys; the code is reported next to them.
+func validationFailureReason(err error) string {
+	domainErr := validationError(err)
+	switch {
+	case domainErr.Is(entity.ErrMissingHeader):
+		return "missing " + domainErr.Detail + " header"
+	case domainErr.Is(entity.ErrInvalidTimestamp):
+		header, _, _ := strings.Cut(domainErr.Detail, ":")
+		return "invalid " + header + " format"
+	case domainErr.Is(entity.ErrValidationFailed) && domainErr.Err != nil:
+		reason, _, _ := strings.Cut(domainErr.Err.Error(), ":")
+		return reason
+	}
+	if catalogErr, ok := entity.LookupError(domainErr.Code); ok {
+		return catalogErr.Message
+	}
+	return domainErr.Code
+}
+
+// validationError returns the catalog error a validation failed with.
+// Validators outside this service may fail with any error, which is reported
+// as entity.ErrValidationFailed.
+func validationError(err error) *entity.Error {
+	var domainErr *entity.Error
+	if errors.As(err, &domainErr) {
+		return domainErr
+	}
+	return entity.ErrValidationFailed.Wrap(err)
+}
+
+// errorResponse is the body of a request failed with a domain error
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// writeError answers with the status, code and message of the catalog error
+// err is or wraps. Other errors are answered as entity.ErrInternal, so their
+// messages, which may describe internals, are only logged.
+func writeError(w http.ResponseWriter, err error) {
+	builtInErrorCatalog.writeError(w, nil, err)
+}
+
+// writeError answers r as the package-level writeError does, with the
+// message of h's error catalog for the client
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	h.errorCatalog.writeError(w, r, err)
+}
+
+// checkDuplicate records the digest of a webhook and reports whether it was
+// seen within the duplicate window, logging and counting it if so. It returns
+// the digest if this webhook recorded it, so that it can be forgotten if the
+// webhook is not applied.
+func (h *Handler) checkDuplicate(ctx context.Context, r *http.Request, sourceName string, webhookReq entity.WebhookRequest, body []byte) (string, bool) {
+	if h.duplicates == nil || r.Header.Get(ApprovalIDHeader) != "" {
+		return "", false
+	}
+	digest := sha256.New()
+	for _, field := range []string{sourceTag(sourceName), webhookReq.User, webhookReq.Asset, webhookReq.Amount} {
+		digest.Write([]byte(field))
+		digest.Write([]byte{0})
+	}
+	digest.Write(body)
+	key := hex.EncodeToString(digest.Sum(nil))
+
+	first, seen := h.duplicates.Record(key, h.clock.Now())
+	h.metrics.Count("duplicate_store.lookups", 1, "source:"+sourceTag(sourceName))
+	if !seen {
+		return key, false
+	}
+	action := "logged"
+	if h.rejectDuplicates {
+		action = "rejected"
+	}
+	ctx.Value("logger").(logger.Logger).LogWarning(ctx, "Duplicate webhook",
+		"source", sourceTag(sourceName),
+		"user", webhookReq.User,
+		"asset", webhookReq.Asset,
+		"amount", webhookReq.Amount,
+		"first_seen", first.Format(time.RFC3339Nano),
+		"action", action,
+		"key", key)
+	h.metrics.Count("webhook.duplicate", 1, "source:"+sourceTag(sourceName), "action:"+action)
+	return "", true
+}
+
+// webhookEvent describes a webhook for the admin dashboard
+func webhookEvent(sourceName, status string, webhookReq entity.WebhookRequest) metrics.WebhookEvent {
+	event := metrics.WebhookEvent{Source: sourceTag(sourceName), Status: status}
+	if len(webhookReq.Legs) > 0 || len(webhookReq.Entries) > 0 {
+		event.User = webhookReq.User
+		event.Entries = len(webhookReq.LedgerEntries())
+		return event
+	}
+	event.User, event.Asset, event.Amount = webhookReq.User, webhookReq.Asset, webhookReq.Amount
+	return event
+}
+
+// sourceTag names the webhook source in metric tags; the unnamed /webhook
+// endpoint is "default"
+func sourceTag(sourceName string) string {
+	if sourceName == "" {
+		return "default"
+	}
+	return strings.ToLower(sourceName)
+}
+
+// assetTag names asset in metric tags: lowercased when it is one of the
+// configured assets, "other" otherwise
+func (h *Handler) assetTag(asset string) string {
+	asset = strings.ToLower(asset)
+	if _, ok := h.assetTags[asset]; !ok {
+		return "other"
+	}
+	return asset
+}
+
+// rejectInvalid answers a webhook that failed validation with err, after
+// recording and, for the sources selected by debug capture, logging it. body
+// is nil when the request was rejected before its body was read.
+func (h *Handler) rejectInvalid(w http.ResponseWriter, r *http.Request, source WebhookSource, sourceName string, body []byte, err error) {
+	ctx := r.Context()
+	requestLogger := ctx.Value("logger").(logger.Logger)
+	requestLogger.LogWarning(ctx, "Webhook validation failed", err)
+	h.stats.RecordValidationFailure(validationFailureReason(err))
+	h.stats.RecordWebhook(metrics.WebhookEvent{
+		Source:     sourceTag(sourceName),
+		Status:     metrics.WebhookFailed,
+		Reason:     validationFailureReason(err),
+		RemoteAddr: r.RemoteAddr,
+	})
+	h.usage.RecordValidationFailure(sourceTag(sourceName), len(body))
+	h.metrics.Count("webhook.validation_failed", 1,
+		"reason:"+strings.ReplaceAll(validationFailureReason(err), " ", "_"),
+		"code:"+validationError(err).Code)
+	if errors.Is(err, entity.ErrReplayDetected) {
+		h.metrics.Count("webhook.replay_rejected", 1, "source:"+sourceTag(sourceName))
+	}
+	h.auditValidationFailure(r, source, sourceName, err)
+	captured := h.capture.Enabled(r.RemoteAddr)
+	var mismatch *entity.SignatureMismatchError
+	errors.As(err, &mismatch)
+	if captured {
+		args := []any{
+			"error", err.Error(),
+			"remote_addr", r.RemoteAddr,
+			"headers", redactHeaders(r.Header),
+		}
+		if body != nil {
+			args = append(args, "body", redactBody(body))
+		}
+		// Only the digest is logged: the message holds the body unredacted
+		if mismatch != nil {
+			digest := sha256.Sum256(mismatch.CanonicalMessage)
+			args = append(args, "canonical_message_sha256", hex.EncodeToString(digest[:]))
+		}
+		requestLogger.LogWarning(ctx, "Captured failed webhook", args...)
+	}
+	if captured && h.signatureHints && mismatch != nil {
+		hint := newSignatureHintResponse(mismatch)
+		hint.Error = h.errorCatalog.message(w, r, entity.ErrInvalidSignature)
+		writeJSON(w, http.StatusUnauthorized, hint)
+		return
+	}
+	h.writeError(w, r, validationError(err))
+}
+
+// reportValidation sets ValidationReportHeader on the response to a webhook
+// that is applied in mock mode, validated or not
+func (h *Handler) reportValidation(w http.ResponseWriter, r *http.Request, sourceName string, err error) {
+	if err == nil {
+		w.Header().Set(ValidationReportHeader, "valid")
+		return
+	}
+	domainErr := validationError(err)
+	requestLogger := r.Context().Value("logger").(logger.Logger)
+	requestLogger.LogWarning(r.Context(), "Applying webhook that failed validation in mock mode",
+		"source", sourceTag(sourceName),
+		"code", domainErr.Code,
+		"error", err.Error())
+	w.Header().Set(ValidationReportHeader, "invalid; code="+domainErr.Code+
+		"; message="+strconv.QuoteToASCII(h.errorCatalog.message(w, r, domainErr)))
+}
+
+// rejectTooLarge answers a webhook whose body is over the limit with 413,
+// recording it like any other rejected webhook, with the read bytes of its
+// body, which stop at the limit
+func (h *Handler) rejectTooLarge(w http.ResponseWriter, r *http.Request, source WebhookSource, sourceName string, read int) {
+	requestLogger := r.Context().Value("logger").(logger.Logger)
+	requestLogger.LogWarning(r.Context(), "Webhook rejected",
+		"source", sourceTag(sourceName),
+		"content_length", r.ContentLength,
+		"error", entity.ErrPayloadTooLarge.Error())
+	reason := validationFailureReason(entity.ErrPayloadTooLarge)
+	h.stats.RecordValidationFailure(reason)
+	h.stats.RecordWebhook(metrics.WebhookEvent{
+		Source:     sourceTag(sourceName),
+		Status:     metrics.WebhookFailed,
+		Reason:     reason,
+		RemoteAddr: r.RemoteAddr,
+	})
+	h.usage.RecordValidationFailure(sourceTag(sourceName), read)
+	h.metrics.Count("webhook.too_large", 1, "source:"+sourceTag(sourceName))
+	details := map[string]string{
+		"reason": reason,
+		"code":   entity.ErrPayloadTooLarge.Code,
+		"nonce":  r.Header.Get(source.NonceHeader),
+	}
+	if r.ContentLength >= 0 {
+		details["content_length"] = strconv.FormatInt(r.ContentLength, 10)
+	}
+	if sourceName != "" {
+		details["source"] = strings.ToLower(sourceName)
+	}
+	h.audit.Record(r.Context(), audit.Event{
+		Type:       audit.EventValidationFailed,
+		RemoteAddr: r.RemoteAddr,
+		Details:    details,
+	})
+	h.writeError(w, r, entity.ErrPayloadTooLarge.WithDetail("limit is %d bytes", h.maxBodyBytes))
+}
+
+// auditValidationFailure records a rejected webhook in the audit log
+func (h *Handler) auditValidationFailure(r *http.Request, source WebhookSource, sourceName string, err error) {
+	eventType := audit.EventValidationFailed
+	if errors.Is(err, entity.ErrReplayDetected) {
+		eventType = audit.EventReplayDetected
+	}
+
+	details := map[string]string{
+		"reason":    validationFailureReason(err),
+		"code":      validationError(err).Code,
+		"nonce":     r.Header.Get(source.NonceHeader),
+		"timestamp": r.Header.Get(source.TimestampHeader),
+	}
+	if sourceName != "" {
+		details["source"] = strings.ToLower(sourceName)
+	}
+	h.audit.Record(r.Context(), audit.Event{
+		Type:       eventType,
+		RemoteAddr: r.RemoteAddr,
+		Details:    details,
+	})
+}
+
+// auditApproval records an entry parked for approval, or an approval of one,
+// in the audit log. extra holds further detail key-value pairs.
+func (h *Handler) auditApproval(r *http.Request, eventType audit.EventType, pendingID, sourceName string, req entity.WebhookRequest, extra ...string) {
+	details := map[string]string{
+		"pending_id": pendingID,
+		"source":     sourceTag(sourceName),
+		"user":       req.User,
+		"asset":      req.Asset,
+		"amount":     req.Amount,
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		details[extra[i]] = extra[i+1]
+	}
+	h.audit.Record(r.Context(), audit.Event{
+		Type:       eventType,
+		RemoteAddr: r.RemoteAddr,
+		Details:    details,
+	})
+}
+
+// HandleLedger handles GET /ledger/{user} requests, streaming the user's
+// entries as NDJSON, or the page of them selected by ?after= and ?limit=
+func (h *Handler) HandleLedger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := strings.TrimPrefix(r.URL.Path, "/ledger/")
+	if user == "" || user == r.URL.Path {
+		http.Error(w, "Missing user parameter", http.StatusBadRequest)
+		return
+	}
+	user = h.userPolicy.Normalize(user)
+	page, err := historyPage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	streamNDJSON(w, r, h.errorCatalog, func(ctx context.Context, emit func(entity.LedgerEntry) error) error {
+		return h.streamLedgerUseCase.Execute(ctx, user, page, emit)
+	})
+}
+
 // httpRequestAdapter adapts http.Request to the interface expected by use case
 type httpRequestAdapter struct {
 	header http.Header
@@ -152,17 +1097,31 @@ func (h *Handler) SetupRoutes() *http.ServeMux {
 	mux := http.NewServeMux()
 
 	// Apply middleware chain
-	webhookHandler := RequestIDMiddleware(
-		LoggingMiddleware(h.HandleWebhook, h.logger),
-		h.logger,
-	)
-	balanceHandler := RequestIDMiddleware(
-		LoggingMiddleware(h.HandleBalance, h.logger),
-		h.logger,
-	)
+	chain := func(next http.HandlerFunc, route string) http.HandlerFunc {
+		next = StatsMiddleware(MetricsMiddleware(RecoveryMiddleware(next), h.metrics, route), h.stats)
+		return TracingMiddleware(LoggingMiddleware(next, h.logger), route)
+	}
+	webhookHandler := RequestIDMiddleware(SamplingMiddleware(chain(h.HandleWebhook, "/webhook"), h.logSampler), h.logger)
+	balanceHandler := RequestIDMiddleware(chain(h.HandleBalance, "/balance/{user}"), h.logger)
 
 	mux.HandleFunc("/webhook", webhookHandler)
+	if len(h.sources) > 0 {
+		mux.HandleFunc("/webhook/", RequestIDMiddleware(SamplingMiddleware(chain(h.HandleWebhook, "/webhook/{source}"), h.logSampler), h.logger))
+	}
+	for path := range h.sourcePaths {
+		mux.HandleFunc(path, RequestIDMiddleware(SamplingMiddleware(chain(h.HandleWebhook, path), h.logSampler), h.logger))
+	}
 	mux.HandleFunc("/balance/", balanceHandler)
+	if h.streamLedgerUseCase != nil {
+		mux.HandleFunc("/ledger/", RequestIDMiddleware(chain(h.HandleLedger, "/ledger/{user}"), h.logger))
+	}
+	if h.statementUseCase != nil {
+		mux.HandleFunc("/statements/", RequestIDMiddleware(chain(h.HandleStatement, "/statements/{user}/{period}"), h.logger))
+	}
+	if h.attestBalanceUseCase != nil {
+		mux.HandleFunc("/attestation/", RequestIDMiddleware(chain(h.HandleAttestation, "/attestation/{user}"), h.logger))
+		mux.HandleFunc("/.well-known/jwks.json", RequestIDMiddleware(chain(h.HandleJWKS, "/.well-known/jwks.json"), h.logger))
+	}
 
 	return mux
 }
@@ -5,20 +5,39 @@ import (
 	"context"
 	"crypto/hmac"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/shopspring/decimal"
+
 	"kii.com/internal/application/usecase"
 	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+	"kii.com/internal/infrastructure/attestation"
+	"kii.com/internal/infrastructure/audit"
+	"kii.com/internal/infrastructure/clock"
+	"kii.com/internal/infrastructure/config"
 	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/mapper"
+	"kii.com/internal/infrastructure/metrics"
+	"kii.com/internal/infrastructure/mirror"
 	"kii.com/internal/infrastructure/repository"
 	"kii.com/internal/infrastructure/validator"
+	"kii.com/internal/infrastructure/workerpool"
 )
 
 // mockValidator implements port.WebhookValidator
@@ -115,7 +134,7 @@ func TestHandler_HandleWebhook(t *testing.T) {
 				"X-Nonce":     "test-nonce-4",
 				"X-Signature": "valid-signature",
 			},
-			wantStatus: http.StatusInternalServerError, // Use case validation returns error, handler returns 500
+			wantStatus: http.StatusBadRequest,
 		},
 		{
 			name:   "use case error",
@@ -129,6 +148,18 @@ func TestHandler_HandleWebhook(t *testing.T) {
 			useCaseError: errors.New("repository error"),
 			wantStatus:   http.StatusInternalServerError,
 		},
+		{
+			name:   "storage unavailable",
+			method: http.MethodPost,
+			body:   `{"user":"user1","asset":"BTC","amount":"100.5"}`,
+			headers: map[string]string{
+				"X-Timestamp": strconv.FormatInt(time.Now().Unix(), 10),
+				"X-Nonce":     "test-nonce-6",
+				"X-Signature": "valid-signature",
+			},
+			useCaseError: entity.ErrStorageUnavailable,
+			wantStatus:   http.StatusServiceUnavailable,
+		},
 	}
 
 	for _, tt := range tests {
@@ -187,162 +218,1620 @@ func TestHandler_HandleWebhook(t *testing.T) {
 	}
 }
 
-func TestHandler_HandleBalance(t *testing.T) {
+func TestHandler_HandleWebhook_Audit(t *testing.T) {
 	logger := logger.NewLogger()
 
 	tests := []struct {
-		name       string
-		method     string
-		path       string
-		useCaseRes *entity.BalanceResponse
-		useCaseErr error
-		wantStatus int
-		wantUser   string
+		name          string
+		validatorErr  error
+		wantEventType audit.EventType
 	}{
-		{
-			name:   "valid balance request",
-			method: http.MethodGet,
-			path:   "/balance/user1",
-			useCaseRes: &entity.BalanceResponse{
-				User: "user1",
-				Balances: map[string]string{
-					"BTC": "100.5",
-					"ETH": "50.25",
-				},
-			},
-			wantStatus: http.StatusOK,
-			wantUser:   "user1",
-		},
-		{
-			name:       "wrong HTTP method",
-			method:     http.MethodPost,
-			path:       "/balance/user1",
-			wantStatus: http.StatusMethodNotAllowed,
-		},
-		{
-			name:       "missing user parameter",
-			method:     http.MethodGet,
-			path:       "/balance/",
-			wantStatus: http.StatusBadRequest, // Handler returns 400 for missing path parameter
-		},
-		{
-			name:       "use case error",
-			method:     http.MethodGet,
-			path:       "/balance/user1",
-			useCaseErr: errors.New("repository error"),
-			wantStatus: http.StatusInternalServerError,
-		},
+		{name: "invalid signature", validatorErr: errors.New("invalid signature"), wantEventType: audit.EventValidationFailed},
+		{name: "replay", validatorErr: fmt.Errorf("%w: possible replay attack", entity.ErrReplayDetected), wantEventType: audit.EventReplayDetected},
+		{name: "accepted", validatorErr: nil},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Create mock repository
-			mockRepo := &mockRepository{
-				getBalanceFunc: func(ctx context.Context, user string) (*entity.BalanceResponse, error) {
-					return tt.useCaseRes, tt.useCaseErr
+			validator := &mockValidator{
+				validateFunc: func(ctx context.Context, r *http.Request, body []byte) error {
+					return tt.validatorErr
 				},
 			}
-
-			// Create real use cases with mocked dependencies
-			processUseCase := usecase.NewProcessWebhookUseCase(&mockValidator{}, mockRepo)
-			getBalanceUseCase := usecase.NewGetBalanceUseCase(mockRepo)
-
+			mockRepo := &mockRepository{}
+			var auditBuf bytes.Buffer
 			handler := NewHandler(
-				processUseCase,
-				getBalanceUseCase,
-				&mockValidator{},
+				usecase.NewProcessWebhookUseCase(validator, mockRepo),
+				usecase.NewGetBalanceUseCase(mockRepo),
+				validator,
 				logger,
+				WithAudit(audit.NewLogger(&auditBuf)),
 			)
 
-			req := httptest.NewRequest(tt.method, tt.path, nil)
-			ctx := context.WithValue(req.Context(), "logger", logger)
-			req = req.WithContext(ctx)
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(`{"user":"user1","asset":"BTC","amount":"1"}`))
+			req.Header.Set("X-Nonce", "audit-nonce")
+			req = req.WithContext(context.WithValue(req.Context(), "logger", logger))
 
-			w := httptest.NewRecorder()
-			handler.HandleBalance(w, req)
+			handler.HandleWebhook(httptest.NewRecorder(), req)
 
-			if w.Code != tt.wantStatus {
-				t.Errorf("Handler.HandleBalance() status = %v, want %v", w.Code, tt.wantStatus)
+			if tt.wantEventType == "" {
+				if auditBuf.Len() != 0 {
+					t.Errorf("unexpected audit event: %s", auditBuf.String())
+				}
+				return
+			}
+			var event audit.Event
+			if err := json.Unmarshal(auditBuf.Bytes(), &event); err != nil {
+				t.Fatalf("failed to unmarshal audit event: %v", err)
+			}
+			if event.Type != tt.wantEventType {
+				t.Errorf("audit event type = %v, want %v", event.Type, tt.wantEventType)
+			}
+			if event.SchemaVersion != audit.SchemaVersion || event.Details["nonce"] != "audit-nonce" {
+				t.Errorf("audit event = %+v, want schema version %d and nonce audit-nonce", event, audit.SchemaVersion)
 			}
+		})
+	}
+}
 
-			if tt.wantStatus == http.StatusOK && tt.useCaseRes != nil {
-				var gotBody entity.BalanceResponse
-				if err := json.Unmarshal(w.Body.Bytes(), &gotBody); err != nil {
-					t.Errorf("Handler.HandleBalance() failed to unmarshal response: %v", err)
-				} else {
-					if gotBody.User != tt.wantUser {
-						t.Errorf("Handler.HandleBalance() user = %v, want %v", gotBody.User, tt.wantUser)
+func TestHandler_HandleWebhook_Mirror(t *testing.T) {
+	logger := logger.NewLogger()
+	mirrored := make(chan string, 2)
+	staging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrored <- r.URL.Path + " " + r.Header.Get("X-Nonce")
+	}))
+	defer staging.Close()
+	m, err := mirror.New(config.Mirror{URL: staging.URL, Secret: "staging-secret", QueueSize: 10, Timeout: time.Second},
+		metrics.NopEmitter{}, logger)
+	if err != nil {
+		t.Fatalf("mirror.New() error = %v", err)
+	}
+	defer m.Close()
+
+	validator := &mockValidator{
+		validateFunc: func(ctx context.Context, r *http.Request, body []byte) error {
+			if r.Header.Get("X-Nonce") == "rejected" {
+				return errors.New("invalid signature")
+			}
+			return nil
+		},
+	}
+	mockRepo := &mockRepository{}
+	handler := NewHandler(
+		usecase.NewProcessWebhookUseCase(validator, mockRepo),
+		usecase.NewGetBalanceUseCase(mockRepo),
+		validator,
+		logger,
+		WithMirror(m),
+	)
+
+	for _, nonce := range []string{"rejected", "accepted"} {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(`{"user":"user1","asset":"BTC","amount":"1"}`))
+		req.Header.Set("X-Nonce", nonce)
+		req = req.WithContext(context.WithValue(req.Context(), "logger", logger))
+		handler.HandleWebhook(httptest.NewRecorder(), req)
+	}
+
+	select {
+	case got := <-mirrored:
+		if got != "/webhook accepted" {
+			t.Errorf("mirrored %q, want only the accepted webhook", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("accepted webhook was not mirrored")
+	}
+}
+
+func TestHandler_HandleWebhook_Duplicates(t *testing.T) {
+	logger := logger.NewLogger()
+	body := `{"user":"user1","asset":"BTC","amount":"1"}`
+
+	tests := []struct {
+		name       string
+		reject     bool
+		failFirst  error
+		apart      time.Duration
+		wantStatus int
+		wantAdded  int
+	}{
+		{name: "logged", wantStatus: http.StatusOK, wantAdded: 2},
+		{name: "rejected", reject: true, wantStatus: http.StatusConflict, wantAdded: 1},
+		{name: "first copy not applied", reject: true, failFirst: entity.ErrStorageUnavailable, wantStatus: http.StatusOK, wantAdded: 1},
+		{name: "first copy failed", reject: true, failFirst: errors.New("repository error"), wantStatus: http.StatusConflict, wantAdded: 0},
+		{name: "after the window", reject: true, apart: time.Minute, wantStatus: http.StatusOK, wantAdded: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls, added := 0, 0
+			mockRepo := &mockRepository{
+				addEntryFunc: func(ctx context.Context, entry entity.LedgerEntry) error {
+					calls++
+					if tt.failFirst != nil && calls == 1 {
+						return tt.failFirst
 					}
+					added++
+					return nil
+				},
+			}
+			validator := &mockValidator{}
+			now := clock.NewFake(time.Now())
+			handler := NewHandler(
+				usecase.NewProcessWebhookUseCase(validator, mockRepo),
+				usecase.NewGetBalanceUseCase(mockRepo),
+				validator,
+				logger,
+				WithDuplicateCheck(repository.NewInMemoryDuplicateStore(time.Minute), tt.reject),
+				WithClock(now),
+			)
+
+			var w *httptest.ResponseRecorder
+			for i := range 2 {
+				if i > 0 {
+					now.Advance(tt.apart)
 				}
+				req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(body))
+				req.Header.Set("X-Nonce", fmt.Sprintf("nonce-%d", i))
+				req = req.WithContext(context.WithValue(req.Context(), "logger", logger))
+				w = httptest.NewRecorder()
+				handler.HandleWebhook(w, req)
+			}
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("second copy status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if added != tt.wantAdded {
+				t.Errorf("entries added = %d, want %d", added, tt.wantAdded)
 			}
 		})
 	}
 }
 
-func TestHandler_Integration_ValidWebhook(t *testing.T) {
-	// Integration test with real validator
-	secret := "test-secret-key"
+// countingEmitter counts each counter by name and tags
+type countingEmitter struct {
+	metrics.NopEmitter
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (e *countingEmitter) Count(name string, value int64, tags ...string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.counts == nil {
+		e.counts = make(map[string]int64)
+	}
+	e.counts[name+" "+strings.Join(tags, ",")] += value
+}
+
+func TestHandler_HandleWebhook_ReplayMetrics(t *testing.T) {
 	logger := logger.NewLogger()
+	body := `{"user":"user1","asset":"BTC","amount":"1"}`
+	validator := &mockValidator{
+		validateFunc: func(ctx context.Context, r *http.Request, body []byte) error {
+			if r.Header.Get("X-Nonce") == "reused" {
+				return fmt.Errorf("%w: possible replay attack", entity.ErrReplayDetected)
+			}
+			return nil
+		},
+	}
+	mockRepo := &mockRepository{}
+	emitter := &countingEmitter{}
+	handler := NewHandler(
+		usecase.NewProcessWebhookUseCase(validator, mockRepo),
+		usecase.NewGetBalanceUseCase(mockRepo),
+		validator,
+		logger,
+		WithMetrics(emitter),
+		WithDuplicateCheck(repository.NewInMemoryDuplicateStore(time.Minute), false),
+	)
 
-	// Create real validator
-	webhookValidator := validator.NewHMACValidator(secret, 5*time.Minute, logger)
+	for _, nonce := range []string{"nonce-1", "nonce-2", "reused"} {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(body))
+		req.Header.Set("X-Nonce", nonce)
+		req = req.WithContext(context.WithValue(req.Context(), "logger", logger))
+		handler.HandleWebhook(httptest.NewRecorder(), req)
+	}
 
-	// Create real repository
-	ledgerRepo := repository.NewInMemoryLedger(logger)
+	want := map[string]int64{
+		"webhook.replay_rejected source:default":         1,
+		"duplicate_store.lookups source:default":         2,
+		"webhook.duplicate source:default,action:logged": 1,
+	}
+	for key, count := range want {
+		if emitter.counts[key] != count {
+			t.Errorf("%s = %d, want %d (counted %v)", key, emitter.counts[key], count, emitter.counts)
+		}
+	}
+}
 
-	// Create use cases
-	processUseCase := usecase.NewProcessWebhookUseCase(webhookValidator, ledgerRepo)
-	getBalanceUseCase := usecase.NewGetBalanceUseCase(ledgerRepo)
+func TestHandler_HandleWebhook_AssetTags(t *testing.T) {
+	logger := logger.NewLogger()
+	validator := &mockValidator{}
+	mockRepo := &mockRepository{}
+	emitter := &countingEmitter{}
+	handler := NewHandler(
+		usecase.NewProcessWebhookUseCase(validator, mockRepo),
+		usecase.NewGetBalanceUseCase(mockRepo),
+		validator,
+		logger,
+		WithMetrics(emitter),
+		WithAssetTags([]string{"usdc"}),
+	)
 
-	// Create handler
-	handler := NewHandler(processUseCase, getBalanceUseCase, webhookValidator, logger)
+	// Only configured assets are tagged apart, whatever their case
+	for _, asset := range []string{"USDC", "usdc", "FOO", "BAR"} {
+		body := `{"user":"user1","asset":"` + asset + `","amount":"1"}`
+		req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), "logger", logger))
+		handler.HandleWebhook(httptest.NewRecorder(), req)
+	}
 
-	// Prepare webhook request
-	body := `{"user":"user1","asset":"BTC","amount":"100.5"}`
-	timestamp := time.Now().Unix()
-	nonce := "integration-test-nonce"
+	want := map[string]int64{
+		"webhook.processed asset:usdc,source:default":  2,
+		"webhook.processed asset:other,source:default": 2,
+	}
+	for key, count := range want {
+		if emitter.counts[key] != count {
+			t.Errorf("%s = %d, want %d (counted %v)", key, emitter.counts[key], count, emitter.counts)
+		}
+	}
+}
 
-	// Compute signature
-	message := strconv.FormatInt(timestamp, 10) + "\n" + nonce + "\n" + body
-	mac := hmac.New(sha256.New, []byte(secret))
-	mac.Write([]byte(message))
-	signature := hex.EncodeToString(mac.Sum(nil))
+func TestHandler_HandleWebhook_LenientAmounts(t *testing.T) {
+	logger := logger.NewLogger()
+	body := `{"user":"user1","asset":"BTC","amount":0.10000000000000001}`
 
-	// Create HTTP request
-	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(body))
-	req.Header.Set("X-Timestamp", strconv.FormatInt(timestamp, 10))
-	req.Header.Set("X-Nonce", nonce)
-	req.Header.Set("X-Signature", signature)
+	tests := []struct {
+		name       string
+		opts       []HandlerOption
+		wantStatus int
+		wantAmount string
+	}{
+		{name: "strict", wantStatus: http.StatusBadRequest},
+		{name: "lenient", opts: []HandlerOption{WithPayloadMapper(mapper.NewLenient())}, wantStatus: http.StatusOK, wantAmount: "0.10000000000000001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var added []entity.LedgerEntry
+			mockRepo := &mockRepository{
+				addEntryFunc: func(ctx context.Context, entry entity.LedgerEntry) error {
+					added = append(added, entry)
+					return nil
+				},
+			}
+			validator := &mockValidator{}
+			handler := NewHandler(
+				usecase.NewProcessWebhookUseCase(validator, mockRepo),
+				usecase.NewGetBalanceUseCase(mockRepo),
+				validator,
+				logger,
+				tt.opts...,
+			)
 
-	ctx := context.WithValue(req.Context(), "logger", logger)
-	req = req.WithContext(ctx)
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(body))
+			req = req.WithContext(context.WithValue(req.Context(), "logger", logger))
+			w := httptest.NewRecorder()
+			handler.HandleWebhook(w, req)
 
-	// Execute webhook
-	w := httptest.NewRecorder()
-	handler.HandleWebhook(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantAmount != "" && (len(added) != 1 || added[0].Amount != tt.wantAmount) {
+				t.Errorf("entries added = %+v, want one of %s", added, tt.wantAmount)
+			}
+		})
+	}
+}
 
-	if w.Code != http.StatusOK {
-		t.Errorf("Integration test: HandleWebhook() status = %v, want %v", w.Code, http.StatusOK)
+func TestHandler_HandleWebhook_Deadline(t *testing.T) {
+	logger := logger.NewLogger()
+	body := `{"user":"user1","asset":"BTC","amount":"1"}`
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		slow       bool
+		wantStatus int
+		wantCode   string
+		wantAdded  int
+	}{
+		{name: "no deadline", slow: true, wantStatus: http.StatusOK, wantAdded: 1},
+		{name: "met", headers: map[string]string{TimeoutHeader: "5"}, wantStatus: http.StatusOK, wantAdded: 1},
+		{name: "exceeded while applying", headers: map[string]string{TimeoutHeader: "0.05"}, slow: true, wantStatus: http.StatusOK, wantAdded: 1},
+		{name: "passed on arrival", headers: map[string]string{DeadlineHeader: "2020-01-01T00:00:00Z"}, wantStatus: http.StatusGatewayTimeout, wantCode: "deadline_exceeded"},
+		{name: "invalid", headers: map[string]string{TimeoutHeader: "soon"}, wantStatus: http.StatusBadRequest, wantCode: "invalid_deadline"},
 	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added := 0
+			mockRepo := &mockRepository{
+				addEntryFunc: func(ctx context.Context, entry entity.LedgerEntry) error {
+					if tt.slow {
+						select {
+						case <-ctx.Done():
+							return ctx.Err()
+						case <-time.After(200 * time.Millisecond):
+						}
+					}
+					added++
+					return nil
+				},
+			}
+			validator := &mockValidator{}
+			handler := NewHandler(
+				usecase.NewProcessWebhookUseCase(validator, mockRepo),
+				usecase.NewGetBalanceUseCase(mockRepo),
+				validator,
+				logger,
+			)
 
-	// Verify balance was updated
-	balanceReq := httptest.NewRequest(http.MethodGet, "/balance/user1", nil)
-	balanceCtx := context.WithValue(balanceReq.Context(), "logger", logger)
-	balanceReq = balanceReq.WithContext(balanceCtx)
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(body))
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			req = req.WithContext(context.WithValue(req.Context(), "logger", logger))
+			w := httptest.NewRecorder()
+			handler.HandleWebhook(w, req)
 
-	balanceW := httptest.NewRecorder()
-	handler.HandleBalance(balanceW, balanceReq)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantCode != "" {
+				var resp errorResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code != tt.wantCode {
+					t.Errorf("body = %s, want code %s", w.Body.String(), tt.wantCode)
+				}
+			}
+			if added != tt.wantAdded {
+				t.Errorf("entries added = %d, want %d", added, tt.wantAdded)
+			}
+		})
+	}
+}
 
-	if balanceW.Code != http.StatusOK {
-		t.Errorf("Integration test: HandleBalance() status = %v, want %v", balanceW.Code, http.StatusOK)
+func TestHandler_HandleWebhook_DeadlineWhileQueued(t *testing.T) {
+	logger := logger.NewLogger()
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	added := 0
+	mockRepo := &mockRepository{
+		addEntryFunc: func(ctx context.Context, entry entity.LedgerEntry) error {
+			started <- struct{}{}
+			<-release
+			added++
+			return nil
+		},
 	}
+	pool, err := workerpool.New(1, 1)
+	if err != nil {
+		t.Fatalf("workerpool.New() error = %v", err)
+	}
+	defer pool.Shutdown(context.Background())
 
-	var balance entity.BalanceResponse
-	if err := json.Unmarshal(balanceW.Body.Bytes(), &balance); err != nil {
-		t.Fatalf("Integration test: failed to unmarshal balance: %v", err)
+	duplicates := repository.NewInMemoryDuplicateStore(time.Minute)
+	handler := NewHandler(
+		usecase.NewProcessWebhookUseCase(&mockValidator{}, mockRepo),
+		usecase.NewGetBalanceUseCase(mockRepo),
+		&mockValidator{},
+		logger,
+		WithWorkerPool(pool),
+		WithDuplicateCheck(duplicates, true),
+	)
+	serve := func(amount, timeout string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"user":"user1","asset":"BTC","amount":%q}`, amount)
+		req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(body))
+		req.Header.Set("X-Nonce", "nonce-"+amount+"-"+timeout)
+		if timeout != "" {
+			req.Header.Set(TimeoutHeader, timeout)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), "logger", logger))
+		rec := httptest.NewRecorder()
+		handler.HandleWebhook(rec, req)
+		return rec
 	}
 
-	if balance.Balances["BTC"] != "100.50000000" {
-		t.Errorf("Integration test: balance = %v, want 100.50000000", balance.Balances["BTC"])
+	// The first webhook occupies the worker past its own deadline, and is
+	// waited for as it has started
+	first := make(chan *httptest.ResponseRecorder, 1)
+	go func() { first <- serve("1", "0.05") }()
+	<-started
+
+	// The second never reaches the worker before its deadline
+	rec := serve("2", "0.05")
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("queued webhook status = %d, want %d", rec.Code, http.StatusGatewayTimeout)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	if rec := <-first; rec.Code != http.StatusOK {
+		t.Errorf("started webhook status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	// Only the webhook that was not applied may be sent again
+	if rec := serve("2", ""); rec.Code != http.StatusOK {
+		t.Errorf("retried webhook status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := serve("1", ""); rec.Code != http.StatusConflict {
+		t.Errorf("resent applied webhook status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if added != 2 {
+		t.Errorf("entries added = %d, want 2", added)
+	}
+}
+
+func TestHandler_HandleWebhook_SignatureHints(t *testing.T) {
+	logger := logger.NewLogger()
+	mismatch := &entity.SignatureMismatchError{Scheme: "hmac-sha256", CanonicalMessage: []byte("1700000000\nnonce-1\n{}")}
+
+	tests := []struct {
+		name         string
+		hints        bool
+		sources      []string
+		validatorErr error
+		wantHint     bool
+		wantCode     string
+	}{
+		{name: "captured source", hints: true, sources: []string{"192.0.2.0/24"}, validatorErr: mismatch, wantHint: true},
+		{name: "source not captured", hints: true, sources: []string{"203.0.113.7"}, validatorErr: mismatch, wantCode: "invalid_signature"},
+		{name: "hints disabled", sources: []string{"192.0.2.0/24"}, validatorErr: mismatch, wantCode: "invalid_signature"},
+		{name: "other failure", hints: true, sources: []string{"192.0.2.0/24"}, validatorErr: entity.ErrMissingHeader.WithDetail("X-Nonce"), wantCode: "missing_header"},
+		{name: "failure outside the catalog", hints: true, sources: []string{"192.0.2.0/24"}, validatorErr: errors.New("key server down"), wantCode: "validation_failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := &mockValidator{
+				validateFunc: func(ctx context.Context, r *http.Request, body []byte) error {
+					return tt.validatorErr
+				},
+			}
+			capture, _ := NewDebugCapture(tt.sources)
+			mockRepo := &mockRepository{}
+			handler := NewHandler(
+				usecase.NewProcessWebhookUseCase(validator, mockRepo),
+				usecase.NewGetBalanceUseCase(mockRepo),
+				validator,
+				logger,
+				WithDebugCapture(capture),
+				WithSignatureHints(tt.hints),
+			)
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(`{}`))
+			req = req.WithContext(context.WithValue(req.Context(), "logger", logger))
+			w := httptest.NewRecorder()
+			handler.HandleWebhook(w, req)
+
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %v, want %v", w.Code, http.StatusUnauthorized)
+			}
+			var hint signatureHint
+			if err := json.Unmarshal(w.Body.Bytes(), &hint); err != nil {
+				t.Fatalf("body = %q: %v", w.Body.String(), err)
+			}
+			if gotHint := hint.CanonicalMessage != ""; gotHint != tt.wantHint {
+				t.Fatalf("body = %q, want a hint: %v", w.Body.String(), tt.wantHint)
+			}
+			if !tt.wantHint {
+				if hint.Code != tt.wantCode {
+					t.Errorf("code = %q, want %q", hint.Code, tt.wantCode)
+				}
+				return
+			}
+			if hint.CanonicalMessage != base64.StdEncoding.EncodeToString(mismatch.CanonicalMessage) || hint.Scheme != "hmac-sha256" {
+				t.Errorf("hint = %+v, want the canonical message and scheme", hint)
+			}
+			if hint.Error != "invalid signature" || hint.Code != "invalid_signature" {
+				t.Errorf("hint error = %q (%s), want the usual message and code", hint.Error, hint.Code)
+			}
+		})
+	}
+}
+
+func TestHandler_HandleWebhook_Mock(t *testing.T) {
+	secret := "test-secret-key"
+	logger := logger.NewLogger()
+	webhookValidator := validator.NewHMACValidator(secret, 5*time.Minute, logger)
+	ledgerRepo := repository.NewInMemoryLedger(logger)
+	handler := NewHandler(
+		usecase.NewProcessWebhookUseCase(webhookValidator, ledgerRepo),
+		usecase.NewGetBalanceUseCase(ledgerRepo),
+		webhookValidator,
+		logger,
+		WithMock(true),
+	)
+
+	body := `{"user":"user1","asset":"BTC","amount":"1"}`
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\nnonce-1\n" + body))
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantReport string
+	}{
+		{
+			name:       "valid",
+			headers:    map[string]string{"X-Timestamp": timestamp, "X-Nonce": "nonce-1", "X-Signature": hex.EncodeToString(mac.Sum(nil))},
+			wantReport: "valid",
+		},
+		{
+			name:       "wrong signature",
+			headers:    map[string]string{"X-Timestamp": timestamp, "X-Nonce": "nonce-2", "X-Signature": "deadbeef"},
+			wantReport: `invalid; code=invalid_signature; message="invalid signature"`,
+		},
+		{
+			name:       "unsigned",
+			wantReport: `invalid; code=missing_header; message="missing signature header: X-Timestamp"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(body))
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			req = req.WithContext(context.WithValue(req.Context(), "logger", logger))
+			w := httptest.NewRecorder()
+			handler.HandleWebhook(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %v, want %v: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			if got := w.Header().Get(ValidationReportHeader); got != tt.wantReport {
+				t.Errorf("%s = %q, want %q", ValidationReportHeader, got, tt.wantReport)
+			}
+		})
+	}
+
+	// Every webhook was applied
+	balance, err := ledgerRepo.GetBalance(context.Background(), "user1")
+	if err != nil {
+		t.Fatalf("GetBalance() error = %v", err)
+	}
+	if got := balance.Balances["BTC"]; got != "3.00000000" {
+		t.Errorf("BTC balance = %s, want 3.00000000", got)
+	}
+}
+
+func TestHandler_HandleWebhook_WorkerPool(t *testing.T) {
+	logger := logger.NewLogger()
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	mockRepo := &mockRepository{
+		addEntryFunc: func(ctx context.Context, entry entity.LedgerEntry) error {
+			started <- struct{}{}
+			<-release
+			return nil
+		},
+	}
+	pool, err := workerpool.New(1, 1)
+	if err != nil {
+		t.Fatalf("workerpool.New() error = %v", err)
+	}
+	defer pool.Shutdown(context.Background())
+
+	handler := NewHandler(
+		usecase.NewProcessWebhookUseCase(&mockValidator{}, mockRepo),
+		usecase.NewGetBalanceUseCase(mockRepo),
+		&mockValidator{},
+		logger,
+		WithWorkerPool(pool),
+	)
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(`{"user":"user1","asset":"BTC","amount":"1"}`))
+		req = req.WithContext(context.WithValue(req.Context(), "logger", logger))
+		rec := httptest.NewRecorder()
+		handler.HandleWebhook(rec, req)
+		return rec
+	}
+
+	// One webhook occupies the worker and one fills the queue
+	results := make(chan int, 2)
+	go func() { results <- serve().Code }()
+	<-started
+	go func() { results <- serve().Code }()
+	for pool.QueueLength() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	rec := serve()
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After header on rejected webhook")
+	}
+
+	close(release)
+	for range 2 {
+		if code := <-results; code != http.StatusOK {
+			t.Errorf("queued webhook status = %d, want %d", code, http.StatusOK)
+		}
+	}
+}
+
+func TestHandler_HandleWebhook_RetryAfterQueueFull(t *testing.T) {
+	secret := "test-secret-key"
+	logger := logger.NewLogger()
+	webhookValidator := validator.NewHMACValidator(secret, 5*time.Minute, logger)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 3)
+	mockRepo := &mockRepository{
+		addEntryFunc: func(ctx context.Context, entry entity.LedgerEntry) error {
+			started <- struct{}{}
+			<-release
+			return nil
+		},
+	}
+	pool, err := workerpool.New(1, 1)
+	if err != nil {
+		t.Fatalf("workerpool.New() error = %v", err)
+	}
+	defer pool.Shutdown(context.Background())
+
+	handler := NewHandler(
+		usecase.NewProcessWebhookUseCase(webhookValidator, mockRepo),
+		usecase.NewGetBalanceUseCase(mockRepo),
+		webhookValidator,
+		logger,
+		WithWorkerPool(pool),
+	)
+	body := `{"user":"user1","asset":"BTC","amount":"1"}`
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	serve := func(nonce string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(body))
+		signature, _ := validator.ComputeSignature(secret, timestamp, nonce, []byte(body))
+		req.Header.Set("X-Timestamp", timestamp)
+		req.Header.Set("X-Nonce", nonce)
+		req.Header.Set("X-Signature", signature)
+		req = req.WithContext(context.WithValue(req.Context(), "logger", logger))
+		rec := httptest.NewRecorder()
+		handler.HandleWebhook(rec, req)
+		return rec
+	}
+
+	// One webhook occupies the worker and one fills the queue
+	results := make(chan int, 3)
+	go func() { results <- serve("busy-1").Code }()
+	<-started
+	go func() { results <- serve("busy-2").Code }()
+	for pool.QueueLength() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if rec := serve("retried"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	close(release)
+	for range 2 {
+		if code := <-results; code != http.StatusOK {
+			t.Errorf("queued webhook status = %d, want %d", code, http.StatusOK)
+		}
+	}
+
+	// The rejected webhook was not applied, so it can be retried as sent,
+	// and only once
+	if rec := serve("retried"); rec.Code != http.StatusOK {
+		t.Errorf("retry status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if rec := serve("retried"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("replay status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestHandler_HandleLedger(t *testing.T) {
+	logger := logger.NewLogger()
+	ctx := context.Background()
+	ledger := repository.NewInMemoryLedger(logger)
+	for i := range 1200 {
+		user := "user1"
+		if i%2 == 1 {
+			user = "user2"
+		}
+		var labels entity.Labels
+		if i%3 == 0 {
+			labels = "campaign=airdrop"
+		}
+		_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: user, Asset: "BTC", Amount: strconv.Itoa(i), Labels: labels})
+	}
+
+	tests := []struct {
+		name        string
+		repo        port.LedgerRepository
+		path        string
+		wantStatus  int
+		wantEntries int
+	}{
+		{name: "user history", repo: ledger, path: "/ledger/user1", wantStatus: http.StatusOK, wantEntries: 600},
+		{name: "empty history", repo: ledger, path: "/ledger/nobody", wantStatus: http.StatusOK, wantEntries: 0},
+		{name: "first page", repo: ledger, path: "/ledger/user1?limit=10", wantStatus: http.StatusOK, wantEntries: 10},
+		{name: "after a cursor", repo: ledger, path: "/ledger/user1?after=1190", wantStatus: http.StatusOK, wantEntries: 5},
+		{name: "invalid cursor", repo: ledger, path: "/ledger/user1?after=abc", wantStatus: http.StatusBadRequest},
+		{name: "invalid limit", repo: ledger, path: "/ledger/user1?limit=0", wantStatus: http.StatusBadRequest},
+		{name: "labelled", repo: ledger, path: "/ledger/user1?label=campaign=airdrop", wantStatus: http.StatusOK, wantEntries: 200},
+		{name: "labelled page", repo: ledger, path: "/ledger/user1?label=campaign&limit=5", wantStatus: http.StatusOK, wantEntries: 5},
+		{name: "no label matches", repo: ledger, path: "/ledger/user1?label=campaign=referral", wantStatus: http.StatusOK, wantEntries: 0},
+		{name: "invalid label", repo: ledger, path: "/ledger/user1?label=campaign=spring+sale", wantStatus: http.StatusBadRequest},
+		{name: "missing user", repo: ledger, path: "/ledger/", wantStatus: http.StatusBadRequest},
+		{name: "unsupported backend", repo: &mockRepository{}, path: "/ledger/user1", wantStatus: http.StatusNotImplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler(
+				usecase.NewProcessWebhookUseCase(&mockValidator{}, tt.repo),
+				usecase.NewGetBalanceUseCase(tt.repo),
+				&mockValidator{},
+				logger,
+				WithLedgerHistory(usecase.NewStreamLedgerUseCase(tt.repo)),
+			)
+
+			w := httptest.NewRecorder()
+			handler.SetupRoutes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+				t.Errorf("Content-Type = %q, want application/x-ndjson", ct)
+			}
+			if tt.wantEntries > ndjsonFlushEvery && !w.Flushed {
+				t.Error("large stream was not flushed while writing")
+			}
+
+			decoder := json.NewDecoder(w.Body)
+			var entries int
+			for decoder.More() {
+				var entry entity.LedgerEntry
+				if err := decoder.Decode(&entry); err != nil {
+					t.Fatalf("invalid NDJSON line: %v", err)
+				}
+				if entry.User != "user1" {
+					t.Errorf("entry for %q in user1's history", entry.User)
+				}
+				entries++
+			}
+			if entries != tt.wantEntries {
+				t.Errorf("streamed %d entries, want %d", entries, tt.wantEntries)
+			}
+		})
+	}
+}
+
+func TestHandler_HandleBalance(t *testing.T) {
+	logger := logger.NewLogger()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		useCaseRes *entity.BalanceResponse
+		useCaseErr error
+		wantStatus int
+		wantUser   string
+	}{
+		{
+			name:   "valid balance request",
+			method: http.MethodGet,
+			path:   "/balance/user1",
+			useCaseRes: &entity.BalanceResponse{
+				User: "user1",
+				Balances: map[string]string{
+					"BTC": "100.5",
+					"ETH": "50.25",
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantUser:   "user1",
+		},
+		{
+			name:       "wrong HTTP method",
+			method:     http.MethodPost,
+			path:       "/balance/user1",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "missing user parameter",
+			method:     http.MethodGet,
+			path:       "/balance/",
+			wantStatus: http.StatusBadRequest, // Handler returns 400 for missing path parameter
+		},
+		{
+			name:       "use case error",
+			method:     http.MethodGet,
+			path:       "/balance/user1",
+			useCaseErr: errors.New("repository error"),
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "storage unavailable",
+			method:     http.MethodGet,
+			path:       "/balance/user1",
+			useCaseErr: entity.ErrStorageUnavailable,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Create mock repository
+			mockRepo := &mockRepository{
+				getBalanceFunc: func(ctx context.Context, user string) (*entity.BalanceResponse, error) {
+					return tt.useCaseRes, tt.useCaseErr
+				},
+			}
+
+			// Create real use cases with mocked dependencies
+			processUseCase := usecase.NewProcessWebhookUseCase(&mockValidator{}, mockRepo)
+			getBalanceUseCase := usecase.NewGetBalanceUseCase(mockRepo)
+
+			handler := NewHandler(
+				processUseCase,
+				getBalanceUseCase,
+				&mockValidator{},
+				logger,
+			)
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			ctx := context.WithValue(req.Context(), "logger", logger)
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			handler.HandleBalance(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Handler.HandleBalance() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+
+			if tt.wantStatus == http.StatusOK && tt.useCaseRes != nil {
+				var gotBody entity.BalanceResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &gotBody); err != nil {
+					t.Errorf("Handler.HandleBalance() failed to unmarshal response: %v", err)
+				} else {
+					if gotBody.User != tt.wantUser {
+						t.Errorf("Handler.HandleBalance() user = %v, want %v", gotBody.User, tt.wantUser)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_UserPolicyOnReads(t *testing.T) {
+	logger := logger.NewLogger()
+	ledger := repository.NewInMemoryLedger(logger)
+	if err := ledger.AddEntry(context.Background(), entity.LedgerEntry{User: "alice", Asset: "BTC", Amount: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	handler := NewHandler(
+		usecase.NewProcessWebhookUseCase(&mockValidator{}, ledger),
+		usecase.NewGetBalanceUseCase(ledger),
+		&mockValidator{},
+		logger,
+		WithLedgerHistory(usecase.NewStreamLedgerUseCase(ledger)),
+		WithStatements(usecase.NewGenerateStatementUseCase(ledger, clock.System{})),
+		WithUserPolicy(entity.UserPolicy{Case: entity.UserCaseLower}),
+	)
+	mux := handler.SetupRoutes()
+
+	// Webhooks for ALICE were applied to alice, so reads for ALICE find them
+	for _, path := range []string{"/balance/ALICE", "/ledger/ALICE", "/statements/ALICE/" + time.Now().UTC().Format("2006-01")} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s status = %v, want %v", path, w.Code, http.StatusOK)
+		}
+		if !strings.Contains(w.Body.String(), `"alice"`) {
+			t.Errorf("GET %s = %s, want alice's account", path, w.Body.String())
+		}
+	}
+}
+
+func TestHandler_HandleBalance_ETag(t *testing.T) {
+	logger := logger.NewLogger()
+	ledgerRepo := repository.NewInMemoryLedger(logger)
+	handler := NewHandler(
+		usecase.NewProcessWebhookUseCase(&mockValidator{}, ledgerRepo),
+		usecase.NewGetBalanceUseCase(ledgerRepo),
+		&mockValidator{},
+		logger,
+	)
+	mux := handler.SetupRoutes()
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/balance/user1", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	// No entries yet: nothing to revalidate against
+	if w := get(""); w.Header().Get("ETag") != "" {
+		t.Errorf("ETag without entries = %q, want none", w.Header().Get("ETag"))
+	}
+
+	_ = ledgerRepo.AddEntry(context.Background(), entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"})
+	etag := get("").Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("ETag after an entry is empty")
+	}
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{name: "current ETag", ifNoneMatch: etag, wantStatus: http.StatusNotModified},
+		{name: "weak current ETag in a list", ifNoneMatch: `"other", W/` + etag, wantStatus: http.StatusNotModified},
+		{name: "any", ifNoneMatch: "*", wantStatus: http.StatusNotModified},
+		{name: "stale ETag", ifNoneMatch: `"stale"`, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(tt.ifNoneMatch)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if w.Code == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("304 body = %q, want empty", w.Body.String())
+			}
+		})
+	}
+
+	// The next entry changes the ETag
+	_ = ledgerRepo.AddEntry(context.Background(), entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"})
+	if w := get(etag); w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("after a new entry status = %v, ETag %q, want 200 with a new ETag", w.Code, w.Header().Get("ETag"))
+	}
+
+	// Holds change the balance without an entry, so it is not cached
+	etag = get("").Header().Get("ETag")
+	hold := entity.Hold{ID: "hold-1", User: "user1", Asset: "BTC", Amount: "1"}
+	if err := ledgerRepo.(port.LedgerHoldRepository).PlaceHold(context.Background(), hold); err != nil {
+		t.Fatalf("PlaceHold() error = %v", err)
+	}
+	if w := get(etag); w.Code != http.StatusOK || w.Header().Get("ETag") != "" || !strings.Contains(w.Body.String(), `"held":{"BTC":"1.00000000"}`) {
+		t.Errorf("with a hold status = %v, ETag %q, body %s, want 200 with the hold and no ETag", w.Code, w.Header().Get("ETag"), w.Body.String())
+	}
+}
+
+func TestHandler_HandleStatement(t *testing.T) {
+	logger := logger.NewLogger()
+	ctx := context.Background()
+	ledger := repository.NewInMemoryLedger(logger)
+	for _, entry := range []entity.LedgerEntry{
+		{User: "user1", Asset: "BTC", Amount: "1.5"},
+		{User: "user1", Asset: "=ETH", Amount: "-2"},
+	} {
+		_ = ledger.AddEntry(ctx, entry)
+	}
+	today := time.Now().UTC().Format("2006-01-02")
+
+	tests := []struct {
+		name       string
+		repo       port.LedgerRepository
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "json", repo: ledger, path: "/statements/user1/" + today, wantStatus: http.StatusOK, wantBody: `"closingBalances":{"=ETH":"-2.00000000","BTC":"1.50000000"}`},
+		{name: "csv", repo: ledger, path: "/statements/user1/" + today + "?format=csv", wantStatus: http.StatusOK, wantBody: "closing,,,'=ETH,-2.00000000\n"},
+		{name: "future period", repo: ledger, path: "/statements/user1/2999-01", wantStatus: http.StatusBadRequest, wantBody: `"code":"invalid_period"`},
+		{name: "invalid period", repo: ledger, path: "/statements/user1/yesterday", wantStatus: http.StatusBadRequest, wantBody: `"code":"invalid_period"`},
+		{name: "invalid format", repo: ledger, path: "/statements/user1/" + today + "?format=pdf", wantStatus: http.StatusBadRequest},
+		{name: "missing period", repo: ledger, path: "/statements/user1", wantStatus: http.StatusBadRequest},
+		{name: "unsupported backend", repo: &mockRepository{}, path: "/statements/user1/" + today, wantStatus: http.StatusNotImplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler(
+				usecase.NewProcessWebhookUseCase(&mockValidator{}, tt.repo),
+				usecase.NewGetBalanceUseCase(tt.repo),
+				&mockValidator{},
+				logger,
+				WithStatements(usecase.NewGenerateStatementUseCase(tt.repo, clock.System{})),
+			)
+
+			w := httptest.NewRecorder()
+			handler.SetupRoutes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", w.Body.String(), tt.wantBody)
+			}
+			if tt.wantStatus == http.StatusOK && !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment") {
+				t.Errorf("Content-Disposition = %q, want a download", w.Header().Get("Content-Disposition"))
+			}
+		})
+	}
+}
+
+func TestHandler_HandleAttestation(t *testing.T) {
+	logger := logger.NewLogger()
+	keyPEM, err := attestation.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "attestation.pem")
+	if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := attestation.LoadSigner(keyPath, "kii-1")
+	if err != nil {
+		t.Fatalf("LoadSigner() error = %v", err)
+	}
+
+	mockRepo := &mockRepository{
+		getBalanceFunc: func(ctx context.Context, user string) (*entity.BalanceResponse, error) {
+			return &entity.BalanceResponse{User: user, Balances: map[string]string{"BTC": "100.5"}}, nil
+		},
+	}
+	handler := NewHandler(
+		usecase.NewProcessWebhookUseCase(&mockValidator{}, mockRepo),
+		usecase.NewGetBalanceUseCase(mockRepo),
+		&mockValidator{},
+		logger,
+		WithAttestation(usecase.NewAttestBalanceUseCase(mockRepo, signer, clock.System{}), []attestation.JWK{signer.PublicKey()}),
+	)
+	mux := handler.SetupRoutes()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("/.well-known/jwks.json")
+	var jwks struct {
+		Keys []attestation.JWK `json:"keys"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &jwks); err != nil || len(jwks.Keys) != 1 {
+		t.Fatalf("GET /.well-known/jwks.json = %s, want one key (%v)", w.Body.String(), err)
+	}
+
+	w = get("/attestation/user1")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/jose" {
+		t.Fatalf("GET /attestation/user1 status = %v, Content-Type %q, want 200 application/jose", w.Code, w.Header().Get("Content-Type"))
+	}
+	payload, err := attestation.Verify(w.Body.String(), jwks.Keys)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	var attested entity.BalanceAttestation
+	if err := json.Unmarshal(payload, &attested); err != nil {
+		t.Fatalf("attestation payload %s: %v", payload, err)
+	}
+	if attested.User != "user1" || attested.Balances["BTC"] != "100.5" || attested.Timestamp.IsZero() {
+		t.Errorf("attestation = %+v, want user1 with BTC 100.5 and a timestamp", attested)
+	}
+
+	if w := get("/attestation/"); w.Code != http.StatusBadRequest {
+		t.Errorf("GET /attestation/ status = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandler_Integration_ValidWebhook(t *testing.T) {
+	// Integration test with real validator
+	secret := "test-secret-key"
+	logger := logger.NewLogger()
+
+	// Create real validator
+	webhookValidator := validator.NewHMACValidator(secret, 5*time.Minute, logger)
+
+	// Create real repository
+	ledgerRepo := repository.NewInMemoryLedger(logger)
+
+	// Create use cases
+	processUseCase := usecase.NewProcessWebhookUseCase(webhookValidator, ledgerRepo)
+	getBalanceUseCase := usecase.NewGetBalanceUseCase(ledgerRepo)
+
+	// Create handler
+	handler := NewHandler(processUseCase, getBalanceUseCase, webhookValidator, logger)
+
+	// Prepare webhook request
+	body := `{"user":"user1","asset":"BTC","amount":"100.5"}`
+	timestamp := time.Now().Unix()
+	nonce := "integration-test-nonce"
+
+	// Compute signature
+	message := strconv.FormatInt(timestamp, 10) + "\n" + nonce + "\n" + body
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	// Create HTTP request
+	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(body))
+	req.Header.Set("X-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Nonce", nonce)
+	req.Header.Set("X-Signature", signature)
+
+	ctx := context.WithValue(req.Context(), "logger", logger)
+	req = req.WithContext(ctx)
+
+	// Execute webhook
+	w := httptest.NewRecorder()
+	handler.HandleWebhook(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Integration test: HandleWebhook() status = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	// Verify balance was updated
+	balanceReq := httptest.NewRequest(http.MethodGet, "/balance/user1", nil)
+	balanceCtx := context.WithValue(balanceReq.Context(), "logger", logger)
+	balanceReq = balanceReq.WithContext(balanceCtx)
+
+	balanceW := httptest.NewRecorder()
+	handler.HandleBalance(balanceW, balanceReq)
+
+	if balanceW.Code != http.StatusOK {
+		t.Errorf("Integration test: HandleBalance() status = %v, want %v", balanceW.Code, http.StatusOK)
+	}
+
+	var balance entity.BalanceResponse
+	if err := json.Unmarshal(balanceW.Body.Bytes(), &balance); err != nil {
+		t.Fatalf("Integration test: failed to unmarshal balance: %v", err)
+	}
+
+	if balance.Balances["BTC"] != "100.50000000" {
+		t.Errorf("Integration test: balance = %v, want 100.50000000", balance.Balances["BTC"])
+	}
+}
+
+// readRecorder is a request body that records whether it was read
+type readRecorder struct {
+	io.Reader
+	read bool
+}
+
+func (r *readRecorder) Read(p []byte) (int, error) {
+	r.read = true
+	return r.Reader.Read(p)
+}
+
+func TestHandler_HandleWebhook_BodyLimit(t *testing.T) {
+	secret := "test-secret-key"
+	logger := logger.NewLogger()
+	webhookValidator := validator.NewHMACValidator(secret, 5*time.Minute, logger)
+	ledgerRepo := repository.NewInMemoryLedger(logger)
+	emitter := &countingEmitter{}
+	usage := metrics.NewUsageMeter()
+	var auditBuf bytes.Buffer
+	handler := NewHandler(
+		usecase.NewProcessWebhookUseCase(webhookValidator, ledgerRepo),
+		usecase.NewGetBalanceUseCase(ledgerRepo),
+		webhookValidator,
+		logger,
+		WithMetrics(emitter),
+		WithUsage(usage),
+		WithAudit(audit.NewLogger(&auditBuf)),
+		WithMaxBodyBytes(64),
+	)
+
+	small := `{"user":"user1","asset":"BTC","amount":"1"}`
+	large := `{"user":"user1","asset":"BTC","amount":"1","memo":"` + strings.Repeat("x", 64) + `"}`
+	tests := []struct {
+		name          string
+		body          string
+		unsigned      bool
+		unknownLength bool
+		wantStatus    int
+		wantCode      string
+	}{
+		{name: "within the limit", body: small, wantStatus: http.StatusOK},
+		{name: "within the limit without a length", body: small, unknownLength: true, wantStatus: http.StatusOK},
+		{name: "over the limit", body: large, wantStatus: http.StatusRequestEntityTooLarge, wantCode: "payload_too_large"},
+		{name: "over the limit without a length", body: large, unknownLength: true, wantStatus: http.StatusRequestEntityTooLarge, wantCode: "payload_too_large"},
+		{name: "unsigned", body: small, unsigned: true, wantStatus: http.StatusUnauthorized, wantCode: "missing_header"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := &readRecorder{Reader: strings.NewReader(tt.body)}
+			req := httptest.NewRequest(http.MethodPost, "/webhook", body)
+			if tt.unknownLength {
+				req.ContentLength = -1
+			} else {
+				req.ContentLength = int64(len(tt.body))
+			}
+			if !tt.unsigned {
+				timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+				nonce := fmt.Sprintf("limit-nonce-%d", i)
+				signature, _ := validator.ComputeSignature(secret, timestamp, nonce, []byte(tt.body))
+				req.Header.Set("X-Timestamp", timestamp)
+				req.Header.Set("X-Nonce", nonce)
+				req.Header.Set("X-Signature", signature)
+			}
+			req = req.WithContext(context.WithValue(req.Context(), "logger", logger))
+
+			w := httptest.NewRecorder()
+			handler.HandleWebhook(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("HandleWebhook() status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantCode != "" && !strings.Contains(w.Body.String(), `"code":"`+tt.wantCode+`"`) {
+				t.Errorf("HandleWebhook() body = %s, want code %s", w.Body.String(), tt.wantCode)
+			}
+			if tt.unsigned && body.read {
+				t.Error("HandleWebhook() read the body of an unsigned webhook")
+			}
+		})
+	}
+	if got := emitter.counts["webhook.too_large source:default"]; got != 2 {
+		t.Errorf("webhook.too_large = %d, want 2", got)
+	}
+
+	// Bodies over the limit are recorded like other rejected webhooks: the
+	// one without a length was read up to the limit
+	report := usage.Report(usage.CurrentMonth())
+	if len(report.Tenants) != 1 || report.Tenants[0].ValidationFailures != 3 || report.Tenants[0].Webhooks != 2 ||
+		report.Tenants[0].Bytes != uint64(2*len(small)+64) {
+		t.Errorf("usage = %+v, want two webhooks and three failures, one of them read up to the limit", report.Tenants)
+	}
+	if got := strings.Count(auditBuf.String(), `"code":"payload_too_large"`); got != 2 {
+		t.Errorf("audited %d payload_too_large rejections, want 2 (%s)", got, auditBuf.String())
+	}
+}
+
+func TestHandler_HandleWebhook_Sources(t *testing.T) {
+	logger := logger.NewLogger()
+	ledgerRepo := repository.NewInMemoryLedger(logger)
+	defaultValidator := validator.NewHMACValidator("default-secret", 5*time.Minute, logger)
+	usage := metrics.NewUsageMeter()
+	scheme, err := validator.WithScheme(validator.SchemeHMACSHA256Base64)
+	if err != nil {
+		t.Fatalf("WithScheme() error = %v", err)
+	}
+	partnerMapper, err := mapper.NewJSONPath("account.id", "currency", "value")
+	if err != nil {
+		t.Fatalf("NewJSONPath() error = %v", err)
+	}
+	response, err := NewSuccessResponse(0, "", `{"received":{{json .Payload.account.id}}}`)
+	if err != nil {
+		t.Fatalf("NewSuccessResponse() error = %v", err)
+	}
+	partner := WebhookSource{
+		Validator: validator.NewHMACValidatorWithNonceStore("partner-secret", 5*time.Minute, validator.NewNonceStore(), logger,
+			validator.WithHeaders("X-Partner-Time", "X-Partner-Id", "X-Partner-Sig"), scheme),
+		Mapper:          partnerMapper,
+		Response:        response,
+		TimestampHeader: "X-Partner-Time",
+		NonceHeader:     "X-Partner-Id",
+	}
+	handler := NewHandler(
+		usecase.NewProcessWebhookUseCase(defaultValidator, ledgerRepo),
+		usecase.NewGetBalanceUseCase(ledgerRepo),
+		defaultValidator,
+		logger,
+		WithSources(map[string]WebhookSource{"partner": partner}),
+		WithUsage(usage),
+	)
+	mux := handler.SetupRoutes()
+
+	body := `{"account":{"id":"user1"},"currency":"BTC","value":2.5}`
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte("partner-secret"))
+	mac.Write([]byte(timestamp + "\n" + "partner-nonce" + "\n" + body))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name       string
+		path       string
+		headers    map[string]string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "named source with its own headers, scheme, mapping and response",
+			path:       "/webhook/Partner",
+			headers:    map[string]string{"X-Partner-Time": timestamp, "X-Partner-Id": "partner-nonce", "X-Partner-Sig": signature},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"received":"user1"}`,
+		},
+		{
+			name:       "source signature on the default endpoint",
+			path:       "/webhook",
+			headers:    map[string]string{"X-Timestamp": timestamp, "X-Nonce": "default-nonce", "X-Signature": signature},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unknown source",
+			path:       "/webhook/unknown",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewBufferString(body))
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	balance, _ := ledgerRepo.GetBalance(context.Background(), "user1")
+	if balance.Balances["BTC"] != "2.50000000" {
+		t.Errorf("balance = %v, want 2.50000000 from the mapped payload", balance.Balances["BTC"])
+	}
+
+	// Usage is metered per source, with /webhook as the default tenant
+	want := []metrics.TenantUsage{
+		{Tenant: "default", Bytes: uint64(len(body)), ValidationFailures: 1},
+		{Tenant: "partner", Webhooks: 1, Bytes: uint64(len(body))},
+	}
+	report := usage.Report(usage.CurrentMonth())
+	if len(report.Tenants) != len(want) || report.Tenants[0] != want[0] || report.Tenants[1] != want[1] {
+		t.Errorf("usage = %+v, want %+v", report.Tenants, want)
+	}
+}
+
+func TestHandler_HandleWebhook_SourceMethodAndPath(t *testing.T) {
+	logger := logger.NewLogger()
+	ledgerRepo := repository.NewInMemoryLedger(logger)
+	defaultValidator := validator.NewHMACValidator("default-secret", 5*time.Minute, logger)
+	legacy := WebhookSource{
+		Validator:       validator.NewHMACValidatorWithNonceStore("legacy-secret", 5*time.Minute, validator.NewNonceStore(), logger),
+		Method:          http.MethodPut,
+		Path:            "/callbacks/legacy",
+		TimestampHeader: "X-Timestamp",
+		NonceHeader:     "X-Nonce",
+	}
+	handler := NewHandler(
+		usecase.NewProcessWebhookUseCase(defaultValidator, ledgerRepo),
+		usecase.NewGetBalanceUseCase(ledgerRepo),
+		defaultValidator,
+		logger,
+		WithSources(map[string]WebhookSource{"legacy": legacy}),
+	)
+	mux := handler.SetupRoutes()
+
+	body := `{"user":"user1","asset":"BTC","amount":"1"}`
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{name: "own method and path", method: http.MethodPut, path: "/callbacks/legacy", wantStatus: http.StatusOK},
+		{name: "own method under /webhook", method: http.MethodPut, path: "/webhook/legacy", wantStatus: http.StatusOK},
+		{name: "POST to a PUT source", method: http.MethodPost, path: "/callbacks/legacy", wantStatus: http.StatusMethodNotAllowed},
+		{name: "PUT to the default endpoint", method: http.MethodPut, path: "/webhook", wantStatus: http.StatusMethodNotAllowed},
+		{name: "below the source's path", method: http.MethodPut, path: "/callbacks/legacy/more", wantStatus: http.StatusNotFound},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nonce := fmt.Sprintf("legacy-nonce-%d", i)
+			signature, _ := validator.ComputeSignature("legacy-secret", timestamp, nonce, []byte(body))
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(body))
+			req.Header.Set("X-Timestamp", timestamp)
+			req.Header.Set("X-Nonce", nonce)
+			req.Header.Set("X-Signature", signature)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("%s %s status = %d, want %d (%s)", tt.method, tt.path, w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus == http.StatusMethodNotAllowed && w.Header().Get("Allow") == "" {
+				t.Error("405 without an Allow header")
+			}
+		})
+	}
+
+	balance, _ := ledgerRepo.GetBalance(context.Background(), "user1")
+	if balance.Balances["BTC"] != "2.00000000" {
+		t.Errorf("balance = %v, want 2.00000000 from both paths", balance.Balances["BTC"])
+	}
+}
+
+func TestCheckSourcePath(t *testing.T) {
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{path: "/callbacks/legacy"},
+		{path: "/hooks"},
+		{path: "callbacks", wantErr: true},
+		{path: "/", wantErr: true},
+		{path: "/callbacks/", wantErr: true},
+		{path: "/callbacks/../admin", wantErr: true},
+		{path: "/callbacks/{id}", wantErr: true},
+		{path: "/webhook", wantErr: true},
+		{path: "/webhook/legacy", wantErr: true},
+		{path: "/admin/hooks", wantErr: true},
+		{path: "/healthz", wantErr: true},
+		{path: "/webhooks"},
+	}
+	for _, tt := range tests {
+		if err := CheckSourcePath(tt.path); (err != nil) != tt.wantErr {
+			t.Errorf("CheckSourcePath(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+		}
+	}
+}
+
+func TestHandler_HandleWebhook_Approval(t *testing.T) {
+	logger := logger.NewLogger()
+	ledgerRepo := repository.NewInMemoryLedger(logger)
+	validator := &mockValidator{}
+	var auditBuf bytes.Buffer
+	handler := NewHandler(
+		usecase.NewProcessWebhookUseCase(validator, ledgerRepo,
+			usecase.WithApproval(decimal.RequireFromString("1000"), repository.NewInMemoryPendingStore(time.Hour), false)),
+		usecase.NewGetBalanceUseCase(ledgerRepo),
+		validator,
+		logger,
+		WithAudit(audit.NewLogger(&auditBuf)),
+	)
+	mux := handler.SetupRoutes()
+
+	post := func(amount, approvalID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhook",
+			bytes.NewBufferString(`{"user":"user1","asset":"BTC","amount":"`+amount+`"}`))
+		if approvalID != "" {
+			req.Header.Set(ApprovalIDHeader, approvalID)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("5000", "")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("high-value webhook status = %d, want %d (%s)", w.Code, http.StatusAccepted, w.Body.String())
+	}
+	var pending map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &pending); err != nil {
+		t.Fatalf("failed to unmarshal pending response: %v", err)
+	}
+	if pending["status"] != "pending" || pending["id"] == "" {
+		t.Fatalf("pending response = %v, want status pending and an id", pending)
+	}
+
+	tests := []struct {
+		name       string
+		amount     string
+		approvalID string
+		wantStatus int
+	}{
+		{"unknown pending ID", "5000", "unknown", http.StatusNotFound},
+		{"different amount", "5001", pending["id"], http.StatusConflict},
+		{"matching approval", "5000", pending["id"], http.StatusOK},
+		{"repeated approval", "5000", pending["id"], http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := post(tt.amount, tt.approvalID); w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, w.Code, tt.wantStatus, w.Body.String())
+		}
+	}
+
+	balance, _ := ledgerRepo.GetBalance(context.Background(), "user1")
+	if balance.Balances["BTC"] != "5000.00000000" {
+		t.Errorf("balance = %v, want 5000.00000000 applied once", balance.Balances["BTC"])
+	}
+
+	var events []audit.EventType
+	for line := range strings.SplitSeq(strings.TrimSpace(auditBuf.String()), "\n") {
+		var event audit.Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("failed to unmarshal audit event: %v", err)
+		}
+		if event.Details["pending_id"] != pending["id"] {
+			t.Errorf("audit event %s pending_id = %q, want %q", event.Type, event.Details["pending_id"], pending["id"])
+		}
+		events = append(events, event.Type)
+	}
+	if len(events) != 2 || events[0] != audit.EventEntryParked || events[1] != audit.EventEntryApproved {
+		t.Errorf("audit events = %v, want parked then approved", events)
+	}
+}
+
+func TestHandler_HandleWebhook_Batch(t *testing.T) {
+	logger := logger.NewLogger()
+	ledgerRepo := repository.NewInMemoryLedger(logger)
+	validator := &mockValidator{}
+	newMux := func(repo port.LedgerRepository) *http.ServeMux {
+		return NewHandler(
+			usecase.NewProcessWebhookUseCase(validator, repo),
+			usecase.NewGetBalanceUseCase(repo),
+			validator,
+			logger,
+		).SetupRoutes()
+	}
+
+	tests := []struct {
+		name       string
+		mux        *http.ServeMux
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "batch applied",
+			mux:        newMux(ledgerRepo),
+			body:       `{"entries":[{"user":"user1","asset":"BTC","amount":"1.5"},{"user":"user2","asset":"ETH","amount":"2"}]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid entry rejects the batch",
+			mux:        newMux(ledgerRepo),
+			body:       `{"entries":[{"user":"user1","asset":"BTC","amount":"1"},{"user":"user2","asset":"ETH","amount":"lots"}]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "trade applied",
+			mux:        newMux(ledgerRepo),
+			body:       `{"user":"user1","legs":[{"asset":"BTC","amount":"-0.5"},{"asset":"ETH","amount":"10"}]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid leg rejects the trade",
+			mux:        newMux(ledgerRepo),
+			body:       `{"user":"user1","legs":[{"asset":"BTC","amount":"-0.5"},{"asset":"ETH","amount":"ten"}]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "repository without batch support",
+			mux:        newMux(&mockRepository{}),
+			body:       `{"entries":[{"user":"user1","asset":"BTC","amount":"1"}]}`,
+			wantStatus: http.StatusNotImplemented,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+
+	// Only the valid batch and trade were applied, in full
+	for user, want := range map[string]map[string]string{
+		"user1": {"BTC": "1.00000000", "ETH": "10.00000000"},
+		"user2": {"ETH": "2.00000000"},
+	} {
+		balance, _ := ledgerRepo.GetBalance(context.Background(), user)
+		if !reflect.DeepEqual(balance.Balances, want) {
+			t.Errorf("%s balances = %v, want %v", user, balance.Balances, want)
+		}
+	}
+}
+
+func TestValidationFailureReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{entity.ErrMissingHeader.WithDetail("%s", "X-Nonce"), "missing X-Nonce header"},
+		{entity.ErrInvalidTimestamp.WithDetail("%s: %v", "X-Timestamp", errors.New("not a number")), "invalid X-Timestamp format"},
+		{entity.ErrTimestampOutOfTolerance.WithDetail("difference is 10m"), "timestamp out of tolerance"},
+		{entity.ErrReplayDetected.WithDetail("possible replay attack"), "duplicate nonce detected"},
+		{errors.New("token expired: at 12:00"), "token expired"},
+	}
+	for _, tt := range tests {
+		if got := validationFailureReason(tt.err); got != tt.want {
+			t.Errorf("validationFailureReason(%v) = %q, want %q", tt.err, got, tt.want)
+		}
 	}
 }
@@ -0,0 +1,164 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"kii.com/internal/infrastructure/logger"
+)
+
+// defaultHealthCheckTimeout bounds how long a single dependency check may take
+const defaultHealthCheckTimeout = 2 * time.Second
+
+// Health check statuses
+const (
+	HealthOK   = "ok"
+	HealthFail = "fail"
+)
+
+// HealthCheckFunc checks a single dependency, returning an error if it is unhealthy
+type HealthCheckFunc func(ctx context.Context) error
+
+// HealthCheckResult is the outcome of one dependency check
+type HealthCheckResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// HealthReport is the /healthz/details response
+type HealthReport struct {
+	Status string              `json:"status"`
+	Checks []HealthCheckResult `json:"checks"`
+}
+
+type namedHealthCheck struct {
+	name  string
+	check HealthCheckFunc
+}
+
+// HealthHandler serves liveness and per-dependency health endpoints
+type HealthHandler struct {
+	mu      sync.RWMutex
+	checks  []namedHealthCheck
+	timeout time.Duration
+	logger  logger.Logger
+}
+
+// NewHealthHandler creates a new health handler with no checks
+func NewHealthHandler(logger logger.Logger) *HealthHandler {
+	return &HealthHandler{
+		timeout: defaultHealthCheckTimeout,
+		logger:  logger,
+	}
+}
+
+// AddCheck registers a dependency check reported by /healthz/details
+func (h *HealthHandler) AddCheck(name string, check HealthCheckFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks = append(h.checks, namedHealthCheck{name: name, check: check})
+}
+
+// Check runs all registered checks concurrently and reports their status
+func (h *HealthHandler) Check(ctx context.Context) HealthReport {
+	h.mu.RLock()
+	checks := append([]namedHealthCheck(nil), h.checks...)
+	h.mu.RUnlock()
+
+	report := HealthReport{
+		Status: HealthOK,
+		Checks: make([]HealthCheckResult, len(checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = runHealthCheck(ctx, c, h.timeout)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != HealthOK {
+			report.Status = HealthFail
+		}
+	}
+	return report
+}
+
+// runHealthCheck runs one check with a timeout, treating a timeout as failure
+func runHealthCheck(ctx context.Context, c namedHealthCheck, timeout time.Duration) HealthCheckResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- c.check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := HealthCheckResult{
+		Name:      c.name,
+		Status:    HealthOK,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = HealthFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// HandleHealth handles GET /healthz liveness requests
+func (h *HealthHandler) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": HealthOK})
+}
+
+// HandleDetails handles GET /healthz/details requests. It responds 503 when
+// any dependency is unhealthy.
+func (h *HealthHandler) HandleDetails(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	report := h.Check(r.Context())
+	status := http.StatusOK
+	if report.Status != HealthOK {
+		status = http.StatusServiceUnavailable
+		for _, result := range report.Checks {
+			if result.Status != HealthOK {
+				h.logger.LogWarning(r.Context(), "Health check failed",
+					"check", result.Name,
+					"error", result.Error)
+			}
+		}
+	}
+
+	writeJSON(w, status, report)
+}
+
+// RegisterRoutes registers /healthz and /healthz/details on mux
+func (h *HealthHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", RecoveryMiddleware(h.HandleHealth))
+	mux.HandleFunc("/healthz/details", RecoveryMiddleware(h.HandleDetails))
+}
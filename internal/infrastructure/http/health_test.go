@@ -0,0 +1,109 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kii.com/internal/infrastructure/logger"
+)
+
+func TestHealthHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		checks     map[string]HealthCheckFunc
+		wantStatus int
+		wantReport string
+		wantFailed []string
+	}{
+		{
+			name:       "no checks",
+			wantStatus: http.StatusOK,
+			wantReport: HealthOK,
+		},
+		{
+			name: "all healthy",
+			checks: map[string]HealthCheckFunc{
+				"repository":  func(context.Context) error { return nil },
+				"nonce store": func(context.Context) error { return nil },
+			},
+			wantStatus: http.StatusOK,
+			wantReport: HealthOK,
+		},
+		{
+			name: "one failing",
+			checks: map[string]HealthCheckFunc{
+				"repository":  func(context.Context) error { return errors.New("connection refused") },
+				"nonce store": func(context.Context) error { return nil },
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantReport: HealthFail,
+			wantFailed: []string{"repository"},
+		},
+		{
+			name: "timeout",
+			checks: map[string]HealthCheckFunc{
+				"queue": func(ctx context.Context) error {
+					<-ctx.Done()
+					return ctx.Err()
+				},
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantReport: HealthFail,
+			wantFailed: []string{"queue"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHealthHandler(logger.NewLogger())
+			handler.timeout = 50 * time.Millisecond
+			for name, check := range tt.checks {
+				handler.AddCheck(name, check)
+			}
+			mux := http.NewServeMux()
+			handler.RegisterRoutes(mux)
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz/details", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			var report HealthReport
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatalf("failed to unmarshal report: %v", err)
+			}
+			if report.Status != tt.wantReport {
+				t.Errorf("report status = %v, want %v", report.Status, tt.wantReport)
+			}
+			if len(report.Checks) != len(tt.checks) {
+				t.Errorf("report has %d checks, want %d", len(report.Checks), len(tt.checks))
+			}
+
+			var failed []string
+			for _, result := range report.Checks {
+				if result.Status == HealthFail {
+					failed = append(failed, result.Name)
+					if result.Error == "" {
+						t.Errorf("failed check %s has no error", result.Name)
+					}
+				}
+			}
+			if len(failed) != len(tt.wantFailed) || (len(failed) > 0 && failed[0] != tt.wantFailed[0]) {
+				t.Errorf("failed checks = %v, want %v", failed, tt.wantFailed)
+			}
+
+			// Liveness does not depend on the checks
+			w = httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("liveness status = %v, want %v", w.Code, http.StatusOK)
+			}
+		})
+	}
+}
@@ -2,11 +2,21 @@ package http
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"runtime/debug"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
 	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/metrics"
 )
 
 // responseWriter wraps http.ResponseWriter to capture status code
@@ -20,6 +30,11 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer to flush
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // RequestIDMiddleware adds a request ID to each request
 func RequestIDMiddleware(next http.HandlerFunc, logger logger.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -42,12 +57,44 @@ func RequestIDMiddleware(next http.HandlerFunc, logger logger.Logger) http.Handl
 	}
 }
 
-// LoggingMiddleware logs request details
-func LoggingMiddleware(next http.HandlerFunc, logger logger.Logger) http.HandlerFunc {
+// RecoveryMiddleware turns a panic in next into a 500 response, logging it
+// as an error with the stack trace so it also reaches any error reporter
+func RecoveryMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				// Let net/http abort the response as intended
+				panic(recovered)
+			}
+
+			err, ok := recovered.(error)
+			if !ok {
+				err = fmt.Errorf("%v", recovered)
+			}
+			if requestLogger, ok := r.Context().Value("logger").(logger.Logger); ok {
+				requestLogger.LogError(r.Context(), "Panic recovered", fmt.Errorf("panic: %w", err),
+					"method", r.Method,
+					"path", r.URL.Path,
+					"stack", string(debug.Stack()))
+			}
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}()
+
+		next(w, r)
+	}
+}
+
+// LoggingMiddleware logs request details. Failed requests are always logged
+// on completion, even when sampled out.
+func LoggingMiddleware(next http.HandlerFunc, appLogger logger.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		requestID := r.Context().Value("request_id").(string)
-		requestLogger := logger.WithRequestID(requestID)
+		requestLogger := appLogger.WithRequestID(requestID)
 
 		requestLogger.LogInfo(r.Context(), "Incoming request",
 			"method", r.Method,
@@ -60,10 +107,97 @@ func LoggingMiddleware(next http.HandlerFunc, logger logger.Logger) http.Handler
 		next(wrapped, r)
 
 		duration := time.Since(start)
-		requestLogger.LogInfo(r.Context(), "Request completed",
+		completedCtx := r.Context()
+		if wrapped.statusCode >= http.StatusBadRequest {
+			completedCtx = logger.WithSampling(completedCtx, true)
+		}
+		requestLogger.LogInfo(completedCtx, "Request completed",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"status", wrapped.statusCode,
 			"duration_ms", duration.Milliseconds())
 	}
 }
+
+// SamplingMiddleware marks requests not kept by sampler as sampled out, so
+// their info and debug logs are dropped by a logger.SamplingLogger
+func SamplingMiddleware(next http.HandlerFunc, sampler *logger.Sampler) http.HandlerFunc {
+	if sampler == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !sampler.Keep() {
+			r = r.WithContext(logger.WithSampling(r.Context(), false))
+		}
+
+		next(w, r)
+	}
+}
+
+// StatsMiddleware records the response status of each request
+func StatsMiddleware(next http.HandlerFunc, stats *metrics.Collector) http.HandlerFunc {
+	if stats == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+		next(wrapped, r)
+
+		stats.RecordRequest(wrapped.statusCode)
+	}
+}
+
+// MetricsMiddleware emits a request counter and latency timing for route
+func MetricsMiddleware(next http.HandlerFunc, emitter metrics.Emitter, route string) http.HandlerFunc {
+	if _, ok := emitter.(metrics.NopEmitter); ok || emitter == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+		next(wrapped, r)
+
+		tags := []string{"route:" + route, "method:" + r.Method, "status:" + strconv.Itoa(wrapped.statusCode)}
+		emitter.Count("http.requests", 1, tags...)
+		emitter.Timing("http.request.duration", time.Since(start), tags...)
+	}
+}
+
+// TracingMiddleware starts a server span for each request, continuing any
+// trace propagated by the sender, and tags the request logger with the trace ID
+func TracingMiddleware(next http.HandlerFunc, route string) http.HandlerFunc {
+	tracer := otel.Tracer("kii.com/internal/infrastructure/http")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		if requestID, ok := ctx.Value("request_id").(string); ok {
+			span.SetAttributes(attribute.String("request_id", requestID))
+		}
+		if spanContext := span.SpanContext(); spanContext.HasTraceID() {
+			if requestLogger, ok := ctx.Value("logger").(logger.Logger); ok {
+				ctx = context.WithValue(ctx, "logger", requestLogger.With("trace_id", spanContext.TraceID().String()))
+			}
+		}
+
+		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+		next(wrapped, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", wrapped.statusCode))
+		if wrapped.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(wrapped.statusCode))
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/infrastructure/logger"
+)
+
+const (
+	// ndjsonFlushEvery is how many entries are written between flushes
+	ndjsonFlushEvery = 500
+	// ndjsonWriteTimeout is the write deadline granted after each flush, so
+	// long exports are not cut off by the server's WriteTimeout
+	ndjsonWriteTimeout = 15 * time.Second
+)
+
+// historyPage reads the page of ledger history selected by the after and
+// limit query parameters and the repeatable label parameter, key=value or a
+// bare key
+func historyPage(r *http.Request) (entity.HistoryPage, error) {
+	var page entity.HistoryPage
+	query := r.URL.Query()
+	if after := query.Get("after"); after != "" {
+		sequence, err := strconv.ParseUint(after, 10, 64)
+		if err != nil {
+			return page, fmt.Errorf("invalid after: want an entry sequence")
+		}
+		page.After = sequence
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return page, fmt.Errorf("invalid limit: want a positive number of entries")
+		}
+		page.Limit = n
+	}
+	labels, err := entity.ParseLabelSelector(query["label"])
+	if err != nil {
+		return page, err
+	}
+	page.Labels = labels
+	return page, nil
+}
+
+// streamLedgerFunc lists ledger entries, calling emit for each
+type streamLedgerFunc func(ctx context.Context, emit func(entity.LedgerEntry) error) error
+
+// streamNDJSON writes the entries listed by stream as newline-delimited JSON
+// with chunked encoding, flushing as it goes instead of buffering the whole
+// response. Errors before the first entry get a regular error response;
+// after that the response can only be cut short. Their messages are those
+// of catalog.
+func streamNDJSON(w http.ResponseWriter, r *http.Request, catalog *ErrorCatalog, stream streamLedgerFunc) {
+	ctx := r.Context()
+	requestLogger := ctx.Value("logger").(logger.Logger)
+	controller := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+
+	var written int
+	flush := func() {
+		_ = controller.Flush()
+		_ = controller.SetWriteDeadline(time.Now().Add(ndjsonWriteTimeout))
+	}
+	err := stream(ctx, func(entry entity.LedgerEntry) error {
+		if written == 0 {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+		}
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+		written++
+		if written%ndjsonFlushEvery == 0 {
+			flush()
+		}
+		return nil
+	})
+
+	switch {
+	case err == nil:
+		if written == 0 {
+			// Nothing to stream: an empty NDJSON body
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+		}
+		requestLogger.LogInfo(ctx, "Ledger streamed", "entries", written)
+	case written > 0:
+		requestLogger.LogError(ctx, "Ledger stream aborted", err, "entries_written", written)
+	case errors.Is(err, entity.ErrHistoryUnsupported) || errors.Is(err, entity.ErrSegmentNotFound):
+		catalog.writeError(w, r, err)
+	default:
+		requestLogger.LogError(ctx, "Failed to stream ledger", err)
+		http.Error(w, "Failed to stream ledger", http.StatusInternalServerError)
+	}
+}
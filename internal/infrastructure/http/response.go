@@ -0,0 +1,86 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+)
+
+// SuccessResponse is a source's answer to its webhooks that were applied, in
+// place of {"status":"ok"}, for senders that expect an empty body or one of
+// their own shape, such as an echo of their event ID
+type SuccessResponse struct {
+	status      int
+	contentType string
+	body        *template.Template
+}
+
+// successResponseData is what a success response body is executed with
+type successResponseData struct {
+	// Source is the name of the source the webhook was sent to
+	Source string
+	// Nonce is the webhook's nonce
+	Nonce string
+	// Header holds the webhook's request headers, e.g. {{.Header.Get "X-Event-Id"}}
+	Header http.Header
+	// Payload is the webhook's JSON body, with numbers kept as their text
+	Payload any
+}
+
+// NewSuccessResponse creates a response with status, 200 when zero, and a
+// body executed as a text/template. Templates can call json to encode a value
+// as JSON, e.g. {"received":{{json .Payload.id}}}. contentType defaults to
+// application/json when the body is not empty.
+func NewSuccessResponse(status int, contentType, body string) (*SuccessResponse, error) {
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status < 200 || status > 299 {
+		return nil, fmt.Errorf("status must be a 2xx code, got %d", status)
+	}
+	if status == http.StatusNoContent && body != "" {
+		return nil, fmt.Errorf("status 204 cannot have a body")
+	}
+	tmpl, err := template.New("body").
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"json": encodeJSON}).
+		Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body template: %w", err)
+	}
+	if contentType == "" && body != "" {
+		contentType = "application/json"
+	}
+	return &SuccessResponse{status: status, contentType: contentType, body: tmpl}, nil
+}
+
+// write answers the webhook r, sent to source with nonce and body. Nothing is
+// written when the template fails, e.g. on a payload field it refers to that
+// is missing, so the caller can answer otherwise.
+func (s *SuccessResponse) write(w http.ResponseWriter, r *http.Request, source, nonce string, body []byte) error {
+	data := successResponseData{Source: source, Nonce: nonce, Header: r.Header}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data.Payload); err != nil {
+		return fmt.Errorf("invalid JSON body: %w", err)
+	}
+
+	var out bytes.Buffer
+	if err := s.body.Execute(&out, data); err != nil {
+		return err
+	}
+	if s.contentType != "" {
+		w.Header().Set("Content-Type", s.contentType)
+	}
+	w.WriteHeader(s.status)
+	_, _ = w.Write(out.Bytes())
+	return nil
+}
+
+// encodeJSON encodes v as JSON, for templates
+func encodeJSON(v any) (string, error) {
+	encoded, err := json.Marshal(v)
+	return string(encoded), err
+}
@@ -0,0 +1,107 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSuccessResponse_Write(t *testing.T) {
+	body := `{"id":"evt_123","amount":2.50,"data":{"user":"user1"}}`
+	tests := []struct {
+		name            string
+		status          int
+		contentType     string
+		template        string
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+		wantErr         bool
+	}{
+		{
+			name:       "empty 200",
+			status:     http.StatusOK,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "no content",
+			status:     http.StatusNoContent,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:            "event ID echo",
+			template:        `{"received":{{json .Payload.id}},"amount":{{json .Payload.amount}}}`,
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/json",
+			wantBody:        `{"received":"evt_123","amount":2.50}`,
+		},
+		{
+			name:            "request fields",
+			status:          http.StatusAccepted,
+			contentType:     "text/plain",
+			template:        `{{.Source}} {{.Nonce}} {{.Header.Get "X-Event-Id"}} {{.Payload.data.user}}`,
+			wantStatus:      http.StatusAccepted,
+			wantContentType: "text/plain",
+			wantBody:        `partner nonce-1 evt_123 user1`,
+		},
+		{
+			name:     "missing payload field",
+			template: `{{json .Payload.event_id}}`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := NewSuccessResponse(tt.status, tt.contentType, tt.template)
+			if err != nil {
+				t.Fatalf("NewSuccessResponse() error = %v", err)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/webhook/partner", strings.NewReader(body))
+			r.Header.Set("X-Event-Id", "evt_123")
+			w := httptest.NewRecorder()
+			err = response.write(w, r, "partner", "nonce-1", []byte(body))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("write() error = nil, want an error")
+				}
+				if w.Code != http.StatusOK || w.Body.Len() > 0 || w.Header().Get("Content-Type") != "" {
+					t.Error("write() wrote a response although it failed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("write() error = %v", err)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestNewSuccessResponse_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		template string
+	}{
+		{name: "not a success status", status: http.StatusBadRequest},
+		{name: "body with no content", status: http.StatusNoContent, template: "{}"},
+		{name: "malformed template", template: `{"id":{{json .Payload.id}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSuccessResponse(tt.status, "", tt.template); err == nil {
+				t.Error("NewSuccessResponse() error = nil, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package http
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"kii.com/internal/domain/port"
+)
+
+// reservedPaths are the roots of the built-in routes, which the paths of
+// sources must stay out of
+var reservedPaths = []string{ //nolint:gochecknoglobals
+	"/webhook", "/balance", "/ledger", "/statements", "/attestation", "/.well-known",
+	"/healthz", "/admin", "/debug", "/export",
+}
+
+// WebhookSource is a named webhook sender served at /webhook/{name}, with its
+// own validator and payload mapper. A nil Mapper expects the native payload,
+// and a nil Response answers applied webhooks with {"status":"ok"}.
+type WebhookSource struct {
+	Validator port.WebhookValidator
+	Mapper    port.PayloadMapper
+	Response  *SuccessResponse
+	// Method is the HTTP method the source sends webhooks with, POST when
+	// empty. Path, when set, serves the source there as well as at
+	// /webhook/{name}; see CheckSourcePath.
+	Method string
+	Path   string
+	// TimestampHeader and NonceHeader are recorded in the audit log for
+	// rejected webhooks
+	TimestampHeader string
+	NonceHeader     string
+}
+
+// WithSources serves /webhook/{name}, and the source's own path if any, for
+// each of sources, next to POST /webhook for the default sender. Paths must
+// have been checked with CheckSourcePath and be distinct.
+func WithSources(sources map[string]WebhookSource) HandlerOption {
+	return func(h *Handler) {
+		h.sources = sources
+		h.sourcePaths = make(map[string]string)
+		for name, source := range sources {
+			if source.Path != "" {
+				h.sourcePaths[source.Path] = name
+			}
+		}
+	}
+}
+
+// CheckSourcePath validates the path of a source: an absolute, clean path
+// without a trailing slash or wildcards, outside the built-in routes
+func CheckSourcePath(p string) error {
+	if !strings.HasPrefix(p, "/") || path.Clean(p) != p || p == "/" {
+		return fmt.Errorf("path %q must be an absolute, clean path without a trailing slash", p)
+	}
+	if strings.ContainsAny(p, "{}?#") {
+		return fmt.Errorf("path %q must not contain wildcards, a query or a fragment", p)
+	}
+	for _, reserved := range reservedPaths {
+		if p == reserved || strings.HasPrefix(p, reserved+"/") {
+			return fmt.Errorf("path %q is under the built-in route %s", p, reserved)
+		}
+	}
+	return nil
+}
+
+// WithPayloadMapper maps the payloads posted to POST /webhook with m instead
+// of expecting the native payload
+func WithPayloadMapper(m port.PayloadMapper) HandlerOption {
+	return func(h *Handler) {
+		h.mapper = m
+	}
+}
@@ -0,0 +1,52 @@
+package http
+
+import (
+	"encoding/csv"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"kii.com/internal/domain/entity"
+)
+
+// Statement formats served by GET /statements/{user}/{period}
+const (
+	statementJSON = "json"
+	statementCSV  = "csv"
+)
+
+// writeStatementCSV writes statement as CSV: a row per opening balance, then
+// a row per entry, then a row per closing balance
+func writeStatementCSV(w io.Writer, statement *entity.Statement) error {
+	out := csv.NewWriter(w)
+	_ = out.Write([]string{"type", "sequence", "appliedAt", "asset", "amount"})
+	for _, asset := range slices.Sorted(maps.Keys(statement.OpeningBalances)) {
+		_ = out.Write([]string{"opening", "", "", csvCell(asset), statement.OpeningBalances[asset]})
+	}
+	for _, entry := range statement.Entries {
+		_ = out.Write([]string{
+			"entry",
+			strconv.FormatUint(entry.Sequence, 10),
+			entry.AppliedAt.UTC().Format(time.RFC3339Nano),
+			csvCell(entry.Asset),
+			entry.Amount,
+		})
+	}
+	for _, asset := range slices.Sorted(maps.Keys(statement.ClosingBalances)) {
+		_ = out.Write([]string{"closing", "", "", csvCell(asset), statement.ClosingBalances[asset]})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// csvCell keeps a sender-chosen value from being read as a formula by
+// spreadsheets
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -0,0 +1,143 @@
+// The admin dashboard. It reads the admin API with the credentials the
+// browser prompted for, and renders every value as text: webhook fields are
+// sent by third parties and must never be parsed as HTML.
+"use strict";
+
+const refreshInterval = 5000;
+const nonceLimit = 20;
+
+function $(id) {
+  return document.getElementById(id);
+}
+
+async function getJSON(path) {
+  const resp = await fetch(path, { headers: { Accept: "application/json" } });
+  if (!resp.ok) {
+    throw new Error(path + ": " + resp.status + " " + resp.statusText);
+  }
+  return resp.json();
+}
+
+// fillTable replaces the rows of tbody with one row per item, its cells
+// holding the text that cells returns for the item
+function fillTable(tbody, items, cells, columns) {
+  const rows = (items || []).map((item) => {
+    const tr = document.createElement("tr");
+    for (const cell of cells(item)) {
+      const td = document.createElement("td");
+      if (cell instanceof Node) {
+        td.appendChild(cell);
+      } else {
+        td.textContent = cell === undefined || cell === null ? "" : String(cell);
+      }
+      tr.appendChild(td);
+    }
+    return tr;
+  });
+  if (rows.length === 0) {
+    const tr = document.createElement("tr");
+    const td = document.createElement("td");
+    td.colSpan = columns;
+    td.className = "empty";
+    td.textContent = "None";
+    tr.appendChild(td);
+    rows.push(tr);
+  }
+  tbody.replaceChildren(...rows);
+}
+
+function formatTime(value) {
+  const date = new Date(value);
+  return isNaN(date) ? "" : date.toLocaleString();
+}
+
+function formatUptime(seconds) {
+  const s = Math.floor(seconds);
+  const days = Math.floor(s / 86400);
+  const hours = Math.floor((s % 86400) / 3600);
+  const minutes = Math.floor((s % 3600) / 60);
+  if (days > 0) return days + "d " + hours + "h";
+  if (hours > 0) return hours + "h " + minutes + "m";
+  return minutes + "m " + (s % 60) + "s";
+}
+
+function statusLabel(status) {
+  const span = document.createElement("span");
+  span.className = "status-" + status;
+  span.textContent = status;
+  return span;
+}
+
+function sum(counts) {
+  return Object.values(counts || {}).reduce((a, b) => a + b, 0);
+}
+
+function renderStats(stats) {
+  $("uptime").textContent = formatUptime(stats.uptimeSeconds);
+  $("requests").textContent = stats.requests;
+  $("entries").textContent = stats.entries;
+  $("failures").textContent = sum(stats.validationFailures);
+  $("nonce-store-size").textContent = stats.nonceStoreSize;
+  $("queue").textContent = stats.queue ? stats.queue.length + " / " + stats.queue.capacity : "–";
+  $("requests-by-status").textContent =
+    Object.entries(stats.requestsByStatus || {}).map(([status, count]) => status + ": " + count).join(", ") || "none";
+
+  fillTable($("recent-webhooks"), stats.recentWebhooks, (w) => [
+    formatTime(w.time),
+    w.source,
+    statusLabel(w.status),
+    w.user,
+    w.asset,
+    w.entries ? w.entries + " entries" : w.amount,
+  ], 6);
+  const reasons = Object.entries(stats.validationFailures || {}).sort((a, b) => b[1] - a[1]);
+  fillTable($("failures-by-reason"), reasons, ([reason, count]) => [reason, count], 2);
+  fillTable($("recent-failures"), stats.recentFailures, (f) => [
+    formatTime(f.time),
+    f.source,
+    f.reason,
+    f.remoteAddr,
+  ], 4);
+  fillTable($("top-users"), stats.topUsers, (u) => [u.user, u.entries], 2);
+}
+
+function renderNonces(resp) {
+  fillTable($("nonces"), resp.nonces, (n) => [n.tenant || "default", n.nonce, formatTime(n.timestamp)], 3);
+}
+
+async function refresh() {
+  try {
+    const [stats, nonces] = await Promise.all([
+      getJSON("/admin/stats"),
+      getJSON("/admin/nonces?limit=" + nonceLimit),
+    ]);
+    renderStats(stats);
+    renderNonces(nonces);
+    $("error").hidden = true;
+    $("updated").textContent = "Updated " + new Date().toLocaleTimeString();
+  } catch (err) {
+    $("error").textContent = "Failed to refresh: " + err.message;
+    $("error").hidden = false;
+  }
+}
+
+async function searchBalance(event) {
+  event.preventDefault();
+  const user = $("balance-user").value.trim();
+  if (user === "") return;
+  try {
+    const resp = await getJSON("/balance/" + encodeURIComponent(user));
+    const balances = Object.entries(resp.balances || {}).sort((a, b) => a[0].localeCompare(b[0]));
+    fillTable($("balances"), balances, ([asset, amount]) => [asset, amount], 2);
+  } catch (err) {
+    fillTable($("balances"), [], () => [], 2);
+    $("error").textContent = "Failed to get balances: " + err.message;
+    $("error").hidden = false;
+  }
+}
+
+document.addEventListener("DOMContentLoaded", () => {
+  $("balance-form").addEventListener("submit", searchBalance);
+  refresh();
+  setInterval(refresh, refreshInterval);
+});
@@ -2,16 +2,21 @@ package logger
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"strings"
 )
 
 // Logger defines the logging interface
 type Logger interface {
+	LogDebug(ctx context.Context, msg string, attrs ...any)
 	LogInfo(ctx context.Context, msg string, attrs ...any)
 	LogError(ctx context.Context, msg string, err error, attrs ...any)
 	LogWarning(ctx context.Context, msg string, attrs ...any)
 	WithRequestID(requestID string) Logger
+	With(attrs ...any) Logger
 }
 
 // StructuredLogger implements the Logger interface
@@ -19,12 +24,59 @@ type StructuredLogger struct {
 	*slog.Logger
 }
 
-// NewLogger creates a new structured logger
+// NewLogger creates a new structured logger at info level
 func NewLogger() Logger {
+	return NewLoggerWithLevel(new(slog.LevelVar))
+}
+
+// NewLoggerWithLevel creates a new structured logger whose minimum level is
+// read from level on every record, so it can be changed at runtime
+func NewLoggerWithLevel(level *slog.LevelVar) Logger {
+	return newSlogLogger(os.Stdout, FormatJSON, level)
+}
+
+// Supported backends and output formats for New
+const (
+	BackendSlog    = "slog"
+	BackendZap     = "zap"
+	BackendZerolog = "zerolog"
+
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// New creates a logger writing to stdout using the given backend (slog, zap
+// or zerolog) and format (json or text). All backends read their minimum
+// level from level on every record.
+func New(backend, format string, level *slog.LevelVar) (Logger, error) {
+	return newLogger(os.Stdout, backend, format, level)
+}
+
+func newLogger(w io.Writer, backend, format string, level *slog.LevelVar) (Logger, error) {
+	if format != FormatJSON && format != FormatText {
+		return nil, fmt.Errorf("unsupported log format %q (want json or text)", format)
+	}
+
+	switch backend {
+	case BackendSlog:
+		return newSlogLogger(w, format, level), nil
+	case BackendZap:
+		return newZapLogger(w, format, level), nil
+	case BackendZerolog:
+		return newZerologLogger(w, format, level), nil
+	default:
+		return nil, fmt.Errorf("unsupported log backend %q (want slog, zap or zerolog)", backend)
+	}
+}
+
+func newSlogLogger(w io.Writer, format string, level *slog.LevelVar) Logger {
 	opts := &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+		Level: level,
+	}
+	var handler slog.Handler = slog.NewJSONHandler(w, opts)
+	if format == FormatText {
+		handler = slog.NewTextHandler(w, opts)
 	}
-	handler := slog.NewJSONHandler(os.Stdout, opts)
 	return &StructuredLogger{
 		Logger: slog.New(handler),
 	}
@@ -37,6 +89,27 @@ func (l *StructuredLogger) WithRequestID(requestID string) Logger {
 	}
 }
 
+// With returns a logger that adds attrs to every record
+func (l *StructuredLogger) With(attrs ...any) Logger {
+	return &StructuredLogger{
+		Logger: l.Logger.With(attrs...),
+	}
+}
+
+// ParseLevel parses a level name (debug, info, warn or error)
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q (want debug, info, warn or error)", name)
+	}
+	return level, nil
+}
+
+// LogDebug logs a debug message with context
+func (l *StructuredLogger) LogDebug(ctx context.Context, msg string, attrs ...any) {
+	l.Logger.DebugContext(ctx, msg, attrs...)
+}
+
 // LogError logs an error with context
 func (l *StructuredLogger) LogError(ctx context.Context, msg string, err error, attrs ...any) {
 	allAttrs := append([]any{"error", err.Error()}, attrs...)
@@ -0,0 +1,107 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNew_Backends(t *testing.T) {
+	for _, backend := range []string{BackendSlog, BackendZap, BackendZerolog} {
+		t.Run(backend, func(t *testing.T) {
+			var buf bytes.Buffer
+			level := new(slog.LevelVar)
+			log, err := newLogger(&buf, backend, FormatJSON, level)
+			if err != nil {
+				t.Fatalf("newLogger() error = %v", err)
+			}
+
+			ctx := context.Background()
+			log.LogDebug(ctx, "hidden at info")
+			log.WithRequestID("req-1").LogError(ctx, "failed", errors.New("boom"), "user", "alice")
+
+			level.Set(slog.LevelDebug)
+			log.With("component", "test").LogDebug(ctx, "visible at debug")
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if len(lines) != 2 {
+				t.Fatalf("got %d lines, want 2:\n%s", len(lines), buf.String())
+			}
+
+			var record map[string]any
+			if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+				t.Fatalf("failed to unmarshal %q: %v", lines[0], err)
+			}
+			for key, want := range map[string]string{"msg": "failed", "request_id": "req-1", "error": "boom", "user": "alice"} {
+				if got, _ := record[key].(string); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+			if got, _ := record["level"].(string); !strings.EqualFold(got, "error") {
+				t.Errorf("level = %q, want error", got)
+			}
+
+			if !strings.Contains(lines[1], `"component":"test"`) || !strings.Contains(lines[1], "visible at debug") {
+				t.Errorf("debug line = %q, want message and component attribute", lines[1])
+			}
+		})
+	}
+}
+
+func TestNew_TextFormat(t *testing.T) {
+	for _, backend := range []string{BackendSlog, BackendZap, BackendZerolog} {
+		t.Run(backend, func(t *testing.T) {
+			var buf bytes.Buffer
+			log, err := newLogger(&buf, backend, FormatText, new(slog.LevelVar))
+			if err != nil {
+				t.Fatalf("newLogger() error = %v", err)
+			}
+
+			log.LogInfo(context.Background(), "hello", "user", "alice")
+
+			out := buf.String()
+			if strings.HasPrefix(out, "{") || !strings.Contains(out, "hello") || !strings.Contains(out, "alice") {
+				t.Errorf("text output = %q, want non-JSON line with message and attributes", out)
+			}
+		})
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	if _, err := New("logrus", FormatJSON, new(slog.LevelVar)); err == nil {
+		t.Error("New() with unknown backend should fail")
+	}
+	if _, err := New(BackendSlog, "xml", new(slog.LevelVar)); err == nil {
+		t.Error("New() with unknown format should fail")
+	}
+}
+
+// recordingReporter implements port.ErrorReporter
+type recordingReporter struct {
+	errs []error
+}
+
+func (r *recordingReporter) ReportError(_ context.Context, err error, _ ...any) {
+	r.errs = append(r.errs, err)
+}
+
+func TestReportingLogger(t *testing.T) {
+	var buf bytes.Buffer
+	reporter := &recordingReporter{}
+	log := NewReportingLogger(newSlogLogger(&buf, FormatJSON, new(slog.LevelVar)), reporter).WithRequestID("req-1")
+
+	log.LogInfo(context.Background(), "not reported")
+	log.LogWarning(context.Background(), "not reported either")
+	log.LogError(context.Background(), "reported", errors.New("boom"))
+
+	if len(reporter.errs) != 1 || reporter.errs[0].Error() != "boom" {
+		t.Errorf("reported errors = %v, want [boom]", reporter.errs)
+	}
+	if !strings.Contains(buf.String(), `"msg":"reported"`) {
+		t.Errorf("error was not logged:\n%s", buf.String())
+	}
+}
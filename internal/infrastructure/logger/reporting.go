@@ -0,0 +1,35 @@
+package logger
+
+import (
+	"context"
+
+	"kii.com/internal/domain/port"
+)
+
+// ReportingLogger forwards every LogError call to an error reporter in
+// addition to logging it
+type ReportingLogger struct {
+	Logger
+	reporter port.ErrorReporter
+}
+
+// NewReportingLogger wraps l so that errors are also sent to reporter
+func NewReportingLogger(l Logger, reporter port.ErrorReporter) Logger {
+	return &ReportingLogger{Logger: l, reporter: reporter}
+}
+
+// WithRequestID adds a request ID to the logger context
+func (l *ReportingLogger) WithRequestID(requestID string) Logger {
+	return &ReportingLogger{Logger: l.Logger.WithRequestID(requestID), reporter: l.reporter}
+}
+
+// With returns a logger that adds attrs to every record
+func (l *ReportingLogger) With(attrs ...any) Logger {
+	return &ReportingLogger{Logger: l.Logger.With(attrs...), reporter: l.reporter}
+}
+
+// LogError logs an error and reports it
+func (l *ReportingLogger) LogError(ctx context.Context, msg string, err error, attrs ...any) {
+	l.Logger.LogError(ctx, msg, err, attrs...)
+	l.reporter.ReportError(ctx, err, append([]any{"message", msg}, attrs...)...)
+}
@@ -0,0 +1,79 @@
+package logger
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type sampledKey struct{}
+
+// WithSampling marks ctx as sampled in or out. A SamplingLogger drops info and
+// debug records logged with a context that is sampled out.
+func WithSampling(ctx context.Context, sampled bool) context.Context {
+	return context.WithValue(ctx, sampledKey{}, sampled)
+}
+
+// Sampled reports whether ctx is sampled in. Contexts that were never marked
+// are sampled in.
+func Sampled(ctx context.Context) bool {
+	sampled, ok := ctx.Value(sampledKey{}).(bool)
+	return !ok || sampled
+}
+
+// Sampler keeps one in every N requests. A nil *Sampler keeps every request.
+type Sampler struct {
+	every uint64
+	count atomic.Uint64
+}
+
+// NewSampler creates a sampler keeping one in every requests. It returns nil,
+// keeping everything, when every is 1 or less.
+func NewSampler(every int) *Sampler {
+	if every <= 1 {
+		return nil
+	}
+	return &Sampler{every: uint64(every)}
+}
+
+// Keep reports whether the next request should be logged
+func (s *Sampler) Keep() bool {
+	if s == nil {
+		return true
+	}
+	return (s.count.Add(1)-1)%s.every == 0
+}
+
+// SamplingLogger drops info and debug records for sampled-out contexts.
+// Warnings and errors are always logged.
+type SamplingLogger struct {
+	Logger
+}
+
+// NewSamplingLogger wraps l so that it honours WithSampling
+func NewSamplingLogger(l Logger) Logger {
+	return &SamplingLogger{Logger: l}
+}
+
+// WithRequestID adds a request ID to the logger context
+func (l *SamplingLogger) WithRequestID(requestID string) Logger {
+	return &SamplingLogger{Logger: l.Logger.WithRequestID(requestID)}
+}
+
+// With returns a logger that adds attrs to every record
+func (l *SamplingLogger) With(attrs ...any) Logger {
+	return &SamplingLogger{Logger: l.Logger.With(attrs...)}
+}
+
+// LogDebug logs a debug message unless ctx is sampled out
+func (l *SamplingLogger) LogDebug(ctx context.Context, msg string, attrs ...any) {
+	if Sampled(ctx) {
+		l.Logger.LogDebug(ctx, msg, attrs...)
+	}
+}
+
+// LogInfo logs an info message unless ctx is sampled out
+func (l *SamplingLogger) LogInfo(ctx context.Context, msg string, attrs ...any) {
+	if Sampled(ctx) {
+		l.Logger.LogInfo(ctx, msg, attrs...)
+	}
+}
@@ -0,0 +1,60 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSampler_Keep(t *testing.T) {
+	tests := []struct {
+		name  string
+		every int
+		want  int
+	}{
+		{name: "disabled", every: 0, want: 10},
+		{name: "every request", every: 1, want: 10},
+		{name: "one in three", every: 3, want: 4},
+		{name: "one in twenty", every: 20, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sampler := NewSampler(tt.every)
+			kept := 0
+			for range 10 {
+				if sampler.Keep() {
+					kept++
+				}
+			}
+			if kept != tt.want {
+				t.Errorf("kept %d of 10, want %d", kept, tt.want)
+			}
+		})
+	}
+}
+
+func TestSamplingLogger(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewSamplingLogger(newSlogLogger(&buf, FormatJSON, new(slog.LevelVar))).WithRequestID("req-1")
+
+	sampledOut := WithSampling(context.Background(), false)
+	log.LogInfo(sampledOut, "dropped info")
+	log.LogWarning(sampledOut, "kept warning")
+	log.LogError(sampledOut, "kept error", errors.New("boom"))
+	log.LogInfo(context.Background(), "kept info")
+	log.LogInfo(WithSampling(sampledOut, true), "resampled info")
+
+	out := buf.String()
+	if strings.Contains(out, "dropped info") {
+		t.Errorf("info record logged for sampled-out context:\n%s", out)
+	}
+	for _, msg := range []string{"kept warning", "kept error", "kept info", "resampled info"} {
+		if !strings.Contains(out, msg) {
+			t.Errorf("missing %q in output:\n%s", msg, out)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ZapLogger implements the Logger interface on top of zap
+type ZapLogger struct {
+	*zap.SugaredLogger
+}
+
+func newZapLogger(w io.Writer, format string, level *slog.LevelVar) Logger {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = "time"
+	encoderConfig.MessageKey = "msg"
+	encoderConfig.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+
+	encoder := zapcore.NewJSONEncoder(encoderConfig)
+	if format == FormatText {
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	}
+
+	// zap levels are one step apart where slog levels are four
+	enabled := zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+		return slog.Level(l)*4 >= level.Level()
+	})
+
+	core := zapcore.NewCore(encoder, zapcore.AddSync(w), enabled)
+	return &ZapLogger{
+		SugaredLogger: zap.New(core).Sugar(),
+	}
+}
+
+// WithRequestID adds a request ID to the logger context
+func (l *ZapLogger) WithRequestID(requestID string) Logger {
+	return l.With("request_id", requestID)
+}
+
+// With returns a logger that adds attrs to every record
+func (l *ZapLogger) With(attrs ...any) Logger {
+	return &ZapLogger{
+		SugaredLogger: l.SugaredLogger.With(attrs...),
+	}
+}
+
+// LogDebug logs a debug message with context
+func (l *ZapLogger) LogDebug(_ context.Context, msg string, attrs ...any) {
+	l.Debugw(msg, attrs...)
+}
+
+// LogError logs an error with context
+func (l *ZapLogger) LogError(_ context.Context, msg string, err error, attrs ...any) {
+	allAttrs := append([]any{"error", err.Error()}, attrs...)
+	l.Errorw(msg, allAttrs...)
+}
+
+// LogInfo logs an info message with context
+func (l *ZapLogger) LogInfo(_ context.Context, msg string, attrs ...any) {
+	l.Infow(msg, attrs...)
+}
+
+// LogWarning logs a warning message with context
+func (l *ZapLogger) LogWarning(_ context.Context, msg string, attrs ...any) {
+	l.Warnw(msg, attrs...)
+}
@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// ZerologLogger implements the Logger interface on top of zerolog
+type ZerologLogger struct {
+	logger zerolog.Logger
+	level  *slog.LevelVar
+}
+
+func newZerologLogger(w io.Writer, format string, level *slog.LevelVar) Logger {
+	// Match the slog and zap field names so log pipelines see one schema.
+	// zerolog only offers this as package-level configuration.
+	zerolog.MessageFieldName = "msg"
+	zerolog.TimeFieldFormat = time.RFC3339Nano
+
+	if format == FormatText {
+		w = zerolog.ConsoleWriter{Out: w, NoColor: true, TimeFormat: time.RFC3339}
+	}
+	return &ZerologLogger{
+		logger: zerolog.New(w).With().Timestamp().Logger(),
+		level:  level,
+	}
+}
+
+// WithRequestID adds a request ID to the logger context
+func (l *ZerologLogger) WithRequestID(requestID string) Logger {
+	return l.With("request_id", requestID)
+}
+
+// With returns a logger that adds attrs to every record
+func (l *ZerologLogger) With(attrs ...any) Logger {
+	return &ZerologLogger{
+		logger: l.logger.With().Fields(attrs).Logger(),
+		level:  l.level,
+	}
+}
+
+// LogDebug logs a debug message with context
+func (l *ZerologLogger) LogDebug(_ context.Context, msg string, attrs ...any) {
+	l.log(slog.LevelDebug, l.logger.Debug(), msg, attrs)
+}
+
+// LogError logs an error with context
+func (l *ZerologLogger) LogError(_ context.Context, msg string, err error, attrs ...any) {
+	allAttrs := append([]any{"error", err.Error()}, attrs...)
+	l.log(slog.LevelError, l.logger.Error(), msg, allAttrs)
+}
+
+// LogInfo logs an info message with context
+func (l *ZerologLogger) LogInfo(_ context.Context, msg string, attrs ...any) {
+	l.log(slog.LevelInfo, l.logger.Info(), msg, attrs)
+}
+
+// LogWarning logs a warning message with context
+func (l *ZerologLogger) LogWarning(_ context.Context, msg string, attrs ...any) {
+	l.log(slog.LevelWarn, l.logger.Warn(), msg, attrs)
+}
+
+// log sends event unless level is below the current minimum. The level is
+// checked here rather than on the zerolog.Logger so runtime changes apply to
+// loggers derived with With.
+func (l *ZerologLogger) log(level slog.Level, event *zerolog.Event, msg string, attrs []any) {
+	if level < l.level.Level() {
+		event.Discard()
+		return
+	}
+	event.Fields(attrs).Msg(msg)
+}
@@ -0,0 +1,142 @@
+package mapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+)
+
+// JSONPath maps payloads by reading user, asset and amount from JSON paths.
+// A path is a dot-separated list of object keys, each optionally followed by
+// array indices, e.g. "data.transfers[0].amount".
+type JSONPath struct {
+	user   jsonPath
+	asset  jsonPath
+	amount jsonPath
+}
+
+// jsonPath is a parsed path, one step per object key or array index
+type jsonPath struct {
+	raw   string
+	steps []pathStep
+}
+
+// pathStep selects an object key, or an array element when key is empty
+type pathStep struct {
+	key   string
+	index int
+}
+
+// NewJSONPath creates a mapper reading the entry from the given paths. It
+// fails on malformed paths, so mistakes surface at startup.
+func NewJSONPath(user, asset, amount string) (port.PayloadMapper, error) {
+	var m JSONPath
+	for _, field := range []struct {
+		name string
+		raw  string
+		dst  *jsonPath
+	}{
+		{"user", user, &m.user},
+		{"asset", asset, &m.asset},
+		{"amount", amount, &m.amount},
+	} {
+		path, err := parsePath(field.raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s path: %w", field.name, err)
+		}
+		*field.dst = path
+	}
+	return &m, nil
+}
+
+// parsePath parses a path such as "data.transfers[0].amount"
+func parsePath(raw string) (jsonPath, error) {
+	path := jsonPath{raw: raw}
+	if raw == "" {
+		return path, fmt.Errorf("empty path")
+	}
+	for part := range strings.SplitSeq(raw, ".") {
+		key, indices, _ := strings.Cut(part, "[")
+		if key == "" {
+			return path, fmt.Errorf("%q: empty key", raw)
+		}
+		path.steps = append(path.steps, pathStep{key: key})
+		if indices == "" {
+			continue
+		}
+		for index := range strings.SplitSeq(strings.TrimSuffix(indices, "]"), "][") {
+			n, err := strconv.Atoi(index)
+			if err != nil || n < 0 {
+				return path, fmt.Errorf("%q: invalid array index %q", raw, index)
+			}
+			path.steps = append(path.steps, pathStep{index: n})
+		}
+	}
+	return path, nil
+}
+
+// Map extracts the webhook request from a JSON payload. Mapped values may be
+// strings or numbers; numbers keep their exact decimal text. Absent values are
+// left empty so that entity validation reports the missing field.
+func (m *JSONPath) Map(body []byte) (entity.WebhookRequest, error) {
+	var req entity.WebhookRequest
+	var payload any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&payload); err != nil {
+		return req, err
+	}
+
+	for _, field := range []struct {
+		path jsonPath
+		dst  *string
+	}{
+		{m.user, &req.User},
+		{m.asset, &req.Asset},
+		{m.amount, &req.Amount},
+	} {
+		value, err := field.path.lookup(payload)
+		if err != nil {
+			return req, err
+		}
+		*field.dst = value
+	}
+	return req, nil
+}
+
+// lookup returns the string or number at p in payload, or "" when absent
+func (p jsonPath) lookup(payload any) (string, error) {
+	value := payload
+	for _, step := range p.steps {
+		switch node := value.(type) {
+		case map[string]any:
+			if step.key == "" {
+				return "", nil
+			}
+			value = node[step.key]
+		case []any:
+			if step.key != "" || step.index >= len(node) {
+				return "", nil
+			}
+			value = node[step.index]
+		default:
+			return "", nil
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("field %s is not a string or number", p.raw)
+	}
+}
@@ -0,0 +1,130 @@
+package mapper
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"kii.com/internal/domain/entity"
+)
+
+func TestJSONPath_Map(t *testing.T) {
+	tests := []struct {
+		name                string
+		user, asset, amount string
+		body                string
+		want                entity.WebhookRequest
+		wantErr             bool
+	}{
+		{
+			name: "top-level fields",
+			user: "user", asset: "asset", amount: "amount",
+			body: `{"user":"user1","asset":"BTC","amount":"1.5"}`,
+			want: entity.WebhookRequest{User: "user1", Asset: "BTC", Amount: "1.5"},
+		},
+		{
+			name: "nested paths and numeric amount",
+			user: "data.account.id", asset: "data.currency", amount: "data.amount",
+			body: `{"data":{"account":{"id":"user1"},"currency":"ETH","amount":0.10000000000000001}}`,
+			want: entity.WebhookRequest{User: "user1", Asset: "ETH", Amount: "0.10000000000000001"},
+		},
+		{
+			name: "array indices",
+			user: "data.owner", asset: "data.transfers[1].asset", amount: "data.transfers[1].legs[0][1]",
+			body: `{"data":{"owner":"user1","transfers":[{"asset":"BTC"},{"asset":"ETH","legs":[["fee","2.5"]]}]}}`,
+			want: entity.WebhookRequest{User: "user1", Asset: "ETH", Amount: "2.5"},
+		},
+		{
+			name: "missing path leaves the field empty",
+			user: "account.id", asset: "currency", amount: "transfers[3]",
+			body: `{"account":"user1","currency":"BTC","transfers":["1"]}`,
+			want: entity.WebhookRequest{Asset: "BTC"},
+		},
+		{
+			name: "object where a value is expected",
+			user: "account", asset: "currency", amount: "value",
+			body:    `{"account":{"id":"user1"},"currency":"BTC","value":"1"}`,
+			wantErr: true,
+		},
+		{
+			name: "invalid JSON",
+			user: "user", asset: "asset", amount: "amount",
+			body:    `{`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewJSONPath(tt.user, tt.asset, tt.amount)
+			if err != nil {
+				t.Fatalf("NewJSONPath() error = %v", err)
+			}
+			got, err := m.Map([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Map() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Map() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewJSONPath_InvalidPaths(t *testing.T) {
+	for _, path := range []string{"", "data..amount", "[0]", "items[]", "items[-1]", "items[x]", "items[0]x"} {
+		t.Run(path, func(t *testing.T) {
+			if _, err := NewJSONPath("user", "asset", path); err == nil {
+				t.Errorf("NewJSONPath(amount: %q) error = nil, want error", path)
+			}
+		})
+	}
+}
+
+func FuzzJSONPath_Map(f *testing.F) {
+	f.Add([]byte(`{"data":{"account":{"id":"user1"},"transfers":[{"asset":"BTC","amount":"1.5"}]}}`))
+	f.Add([]byte(`{"data":{"account":{"id":1e400},"transfers":[{"asset":"BTC","amount":-0.10000000000000001}]}}`))
+	f.Add([]byte(`{"data":{"account":[],"transfers":{"0":{"asset":"BTC"}}}}`))
+	f.Add([]byte(`{"data":{"account":{"id":{"x":1}}}}`))
+	f.Add([]byte(`{"data":null} trailing`))
+	f.Add([]byte(`[[[[[[[[[[[[[[[[[[[[]]]]]]]]]]]]]]]]]]]]`))
+	f.Add([]byte(`{`))
+
+	m, err := NewJSONPath("data.account.id", "data.transfers[0].asset", "data.transfers[0].amount")
+	if err != nil {
+		f.Fatalf("NewJSONPath() error = %v", err)
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		got, err := m.Map(body)
+		if err != nil {
+			return
+		}
+
+		// Mapped values are found again at the same paths
+		var doc struct {
+			Data struct {
+				Account struct {
+					ID string `json:"id"`
+				} `json:"account"`
+				Transfers [1]struct {
+					Asset  string `json:"asset"`
+					Amount string `json:"amount"`
+				} `json:"transfers"`
+			} `json:"data"`
+		}
+		doc.Data.Account.ID = got.User
+		doc.Data.Transfers[0].Asset = got.Asset
+		doc.Data.Transfers[0].Amount = got.Amount
+		encoded, err := json.Marshal(doc)
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+		again, err := m.Map(encoded)
+		if err != nil {
+			t.Fatalf("Map(%s) error = %v", encoded, err)
+		}
+		if !reflect.DeepEqual(again, got) {
+			t.Errorf("Map(%s) = %+v, want %+v", encoded, again, got)
+		}
+	})
+}
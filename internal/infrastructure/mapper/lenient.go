@@ -0,0 +1,93 @@
+package mapper
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+)
+
+// Lenient maps payloads in the service's own shape like Native, but also
+// accepts amounts sent as JSON numbers, for senders that cannot emit them as
+// strings. Numbers keep their exact decimal text.
+type Lenient struct{}
+
+// NewLenient creates a mapper for the service's own payload shape that
+// accepts numeric amounts
+func NewLenient() port.PayloadMapper {
+	return Lenient{}
+}
+
+// lenientRequest is an entity.WebhookRequest whose amounts may be numbers
+type lenientRequest struct {
+	User    string            `json:"user"`
+	Asset   string            `json:"asset"`
+	Amount  lenientAmount     `json:"amount"`
+	Entries []lenientRequest  `json:"entries"`
+	Legs    []lenientLeg      `json:"legs"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// lenientLeg is an entity.Leg whose amount may be a number
+type lenientLeg struct {
+	Asset  string        `json:"asset"`
+	Amount lenientAmount `json:"amount"`
+}
+
+// lenientAmount is an amount sent as a JSON string or number
+type lenientAmount string
+
+// UnmarshalJSON decodes a string as is and a number as its literal text
+func (a *lenientAmount) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*a = lenientAmount(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*a = lenientAmount(n.String())
+	return nil
+}
+
+// Map decodes body as an entity.WebhookRequest
+func (Lenient) Map(body []byte) (entity.WebhookRequest, error) {
+	var req lenientRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return entity.WebhookRequest{}, err
+	}
+	return req.webhookRequest(), nil
+}
+
+// webhookRequest converts r, leaving Entries and Legs nil when absent as
+// Native does
+func (r lenientRequest) webhookRequest() entity.WebhookRequest {
+	req := entity.WebhookRequest{
+		User:   r.User,
+		Asset:  r.Asset,
+		Amount: string(r.Amount),
+		Labels: r.Labels,
+	}
+	if r.Entries != nil {
+		req.Entries = make([]entity.WebhookRequest, len(r.Entries))
+		for i, entry := range r.Entries {
+			req.Entries[i] = entry.webhookRequest()
+		}
+	}
+	if r.Legs != nil {
+		req.Legs = make([]entity.Leg, len(r.Legs))
+		for i, leg := range r.Legs {
+			req.Legs[i] = entity.Leg{Asset: leg.Asset, Amount: string(leg.Amount)}
+		}
+	}
+	return req
+}
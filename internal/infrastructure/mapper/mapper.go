@@ -0,0 +1,24 @@
+package mapper
+
+import (
+	"encoding/json"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+)
+
+// Native maps payloads already in the service's own shape, with top-level
+// user, asset and amount fields
+type Native struct{}
+
+// NewNative creates a mapper for the service's own payload shape
+func NewNative() port.PayloadMapper {
+	return Native{}
+}
+
+// Map decodes body as an entity.WebhookRequest
+func (Native) Map(body []byte) (entity.WebhookRequest, error) {
+	var req entity.WebhookRequest
+	err := json.Unmarshal(body, &req)
+	return req, err
+}
@@ -0,0 +1,132 @@
+package mapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"kii.com/internal/domain/entity"
+)
+
+func FuzzNative_Map(f *testing.F) {
+	f.Add([]byte(`{"user":"user1","asset":"BTC","amount":"1.5"}`))
+	f.Add([]byte(`{"user":"user1","asset":"BTC","amount":1.5}`))
+	f.Add([]byte(`{"USER":"user1","user":"user2","extra":{"nested":[1,2,3]}}`))
+	f.Add([]byte(`{"user":"\u0000\ud800","asset":null}`))
+	f.Add([]byte(`{"entries":[{"user":"user1","asset":"BTC","amount":"1"},{"entries":[]}]}`))
+	f.Add([]byte(`{"user":"user1","legs":[{"asset":"USDT","amount":"-100"},{"asset":"BTC"}]}`))
+	f.Add([]byte(`[]`))
+	f.Add([]byte(`{`))
+	f.Add([]byte(nil))
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		got, err := NewNative().Map(body)
+		if err != nil {
+			return
+		}
+
+		// A mapped request survives a round trip through its own encoding
+		encoded, err := json.Marshal(got)
+		if err != nil {
+			t.Fatalf("Marshal(%+v) error = %v", got, err)
+		}
+		again, err := NewNative().Map(encoded)
+		if err != nil {
+			t.Fatalf("Map(%s) error = %v", encoded, err)
+		}
+		if reencoded, _ := json.Marshal(again); !bytes.Equal(reencoded, encoded) {
+			t.Errorf("Map(%s) = %+v, want %+v", encoded, again, got)
+		}
+	})
+}
+
+func TestLenient_Map(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    entity.WebhookRequest
+		wantErr bool
+	}{
+		{
+			name: "string amount",
+			body: `{"user":"user1","asset":"BTC","amount":"1.5"}`,
+			want: entity.WebhookRequest{User: "user1", Asset: "BTC", Amount: "1.5"},
+		},
+		{
+			name: "numeric amount keeps its exact text",
+			body: `{"user":"user1","asset":"ETH","amount":0.10000000000000001}`,
+			want: entity.WebhookRequest{User: "user1", Asset: "ETH", Amount: "0.10000000000000001"},
+		},
+		{
+			name: "exponent",
+			body: `{"user":"user1","asset":"BTC","amount":-25e-1}`,
+			want: entity.WebhookRequest{User: "user1", Asset: "BTC", Amount: "-25e-1"},
+		},
+		{
+			name: "numeric amounts in entries and legs",
+			body: `{"entries":[{"user":"user1","asset":"BTC","amount":1},{"user":"user2","legs":[{"asset":"USDT","amount":-100},{"asset":"BTC","amount":"0.002"}]}]}`,
+			want: entity.WebhookRequest{Entries: []entity.WebhookRequest{
+				{User: "user1", Asset: "BTC", Amount: "1"},
+				{User: "user2", Legs: []entity.Leg{{Asset: "USDT", Amount: "-100"}, {Asset: "BTC", Amount: "0.002"}}},
+			}},
+		},
+		{
+			name: "labels",
+			body: `{"user":"user1","asset":"BTC","amount":1,"labels":{"campaign":"airdrop"}}`,
+			want: entity.WebhookRequest{User: "user1", Asset: "BTC", Amount: "1", Labels: map[string]string{"campaign": "airdrop"}},
+		},
+		{
+			name: "null amount",
+			body: `{"user":"user1","asset":"BTC","amount":null}`,
+			want: entity.WebhookRequest{User: "user1", Asset: "BTC"},
+		},
+		{
+			name:    "boolean amount",
+			body:    `{"user":"user1","asset":"BTC","amount":true}`,
+			wantErr: true,
+		},
+		{
+			name:    "numeric user",
+			body:    `{"user":1,"asset":"BTC","amount":1}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewLenient().Map([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Map() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Map() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// Native rejects what only the lenient mapper accepts
+	if _, err := NewNative().Map([]byte(`{"user":"user1","asset":"BTC","amount":1.5}`)); err == nil {
+		t.Error("Native Map() of a numeric amount error = nil, want error")
+	}
+}
+
+func FuzzLenient_Map(f *testing.F) {
+	f.Add([]byte(`{"user":"user1","asset":"BTC","amount":"1.5"}`))
+	f.Add([]byte(`{"user":"user1","asset":"BTC","amount":1.5e3}`))
+	f.Add([]byte(`{"entries":[{"user":"user1","asset":"BTC","amount":1},{"entries":[]}]}`))
+	f.Add([]byte(`{"user":"user1","legs":[{"asset":"USDT","amount":-100},{"asset":"BTC"}]}`))
+	f.Add([]byte(`{`))
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		got, err := NewLenient().Map(body)
+		if err != nil {
+			return
+		}
+
+		// Whatever Native accepts, the lenient mapper maps the same way
+		if native, err := NewNative().Map(body); err == nil && !reflect.DeepEqual(got, native) {
+			t.Errorf("Map(%s) = %+v, want %+v as mapped by Native", body, got, native)
+		}
+	})
+}
@@ -0,0 +1,225 @@
+package metrics
+
+import (
+	"maps"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Collector aggregates in-process request and webhook statistics.
+// All methods are safe to call on a nil *Collector, which records nothing.
+type Collector struct {
+	mu                 sync.Mutex
+	startedAt          time.Time
+	requests           uint64
+	requestsByStatus   map[int]uint64
+	validationFailures map[string]uint64
+	entriesByUser      map[string]uint64
+	otherUserEntries   uint64
+	entriesByLabel     map[string]uint64
+	entries            uint64
+	recentWebhooks     []WebhookEvent
+	recentFailures     []WebhookEvent
+}
+
+// recentLimit is the number of webhooks and of validation failures kept for
+// the admin dashboard
+const recentLimit = 50
+
+// labelLimit is the number of label pairs counted apart. Labels are chosen by
+// senders, so pairs first seen beyond it are counted together under
+// otherLabels, keeping the collector's memory bounded.
+const labelLimit = 1000
+
+// userLimit is the number of users whose entries are counted apart. Users
+// are chosen by senders, so the entries of users first seen beyond it are
+// only counted together, keeping the collector's memory bounded.
+const userLimit = 10000
+
+// otherLabels counts the entries of label pairs beyond labelLimit. Pairs are
+// key=value, so no label is counted under it by mistake.
+const otherLabels = "other"
+
+// Webhook outcomes recorded with RecordWebhook
+const (
+	WebhookProcessed = "processed"
+	WebhookPending   = "pending"
+	WebhookFailed    = "failed"
+)
+
+// WebhookEvent is a webhook recently received. User, Asset and Amount are
+// those of a single entry; batches and trades report their entry count.
+type WebhookEvent struct {
+	Time       time.Time `json:"time"`
+	Source     string    `json:"source"`
+	Status     string    `json:"status"`
+	User       string    `json:"user,omitempty"`
+	Asset      string    `json:"asset,omitempty"`
+	Amount     string    `json:"amount,omitempty"`
+	Entries    int       `json:"entries,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+}
+
+// UserVolume is the number of entries applied for a user
+type UserVolume struct {
+	User    string `json:"user"`
+	Entries uint64 `json:"entries"`
+}
+
+// Snapshot is a point-in-time copy of the collected statistics.
+// OtherUserEntries counts the entries of the users beyond userLimit, which are
+// left out of TopUsers.
+type Snapshot struct {
+	UptimeSeconds      float64           `json:"uptimeSeconds"`
+	Requests           uint64            `json:"requests"`
+	RequestsByStatus   map[int]uint64    `json:"requestsByStatus"`
+	ValidationFailures map[string]uint64 `json:"validationFailures"`
+	Entries            uint64            `json:"entries"`
+	TopUsers           []UserVolume      `json:"topUsers"`
+	OtherUserEntries   uint64            `json:"otherUserEntries,omitempty"`
+	EntriesByLabel     map[string]uint64 `json:"entriesByLabel,omitempty"`
+	RecentWebhooks     []WebhookEvent    `json:"recentWebhooks"`
+	RecentFailures     []WebhookEvent    `json:"recentFailures"`
+}
+
+// NewCollector creates a new statistics collector
+func NewCollector() *Collector {
+	return &Collector{
+		startedAt:          time.Now(),
+		requestsByStatus:   make(map[int]uint64),
+		validationFailures: make(map[string]uint64),
+		entriesByUser:      make(map[string]uint64),
+		entriesByLabel:     make(map[string]uint64),
+	}
+}
+
+// RecordRequest records a completed HTTP request
+func (c *Collector) RecordRequest(status int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requests++
+	c.requestsByStatus[status]++
+}
+
+// RecordValidationFailure records a rejected webhook by reason
+func (c *Collector) RecordValidationFailure(reason string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.validationFailures[reason]++
+}
+
+// RecordEntry records a ledger entry applied for user, or for the other users
+// beyond userLimit, counting it under each of its labels, given as key=value
+// pairs, or under otherLabels for pairs beyond labelLimit
+func (c *Collector) RecordEntry(user string, labels ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries++
+	if _, counted := c.entriesByUser[user]; counted || len(c.entriesByUser) < userLimit {
+		c.entriesByUser[user]++
+	} else {
+		c.otherUserEntries++
+	}
+	for _, label := range labels {
+		if _, counted := c.entriesByLabel[label]; !counted && len(c.entriesByLabel) >= labelLimit {
+			label = otherLabels
+		}
+		c.entriesByLabel[label]++
+	}
+}
+
+// RecordWebhook remembers a received webhook, keeping the latest recentLimit
+// webhooks and, apart from them, the latest recentLimit validation failures
+func (c *Collector) RecordWebhook(event WebhookEvent) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.Status == WebhookFailed {
+		c.recentFailures = appendRecent(c.recentFailures, event)
+		return
+	}
+	c.recentWebhooks = appendRecent(c.recentWebhooks, event)
+}
+
+// appendRecent appends event to events, dropping the oldest beyond recentLimit
+func appendRecent(events []WebhookEvent, event WebhookEvent) []WebhookEvent {
+	if len(events) == recentLimit {
+		copy(events, events[1:])
+		events = events[:recentLimit-1]
+	}
+	return append(events, event)
+}
+
+// newestFirst returns a copy of events in reverse order
+func newestFirst(events []WebhookEvent) []WebhookEvent {
+	result := make([]WebhookEvent, len(events))
+	for i, event := range events {
+		result[len(events)-1-i] = event
+	}
+	return result
+}
+
+// Snapshot returns a copy of the statistics with the topN users by entry volume
+func (c *Collector) Snapshot(topN int) Snapshot {
+	if c == nil {
+		return Snapshot{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snapshot := Snapshot{
+		UptimeSeconds:      time.Since(c.startedAt).Seconds(),
+		Requests:           c.requests,
+		RequestsByStatus:   make(map[int]uint64, len(c.requestsByStatus)),
+		ValidationFailures: make(map[string]uint64, len(c.validationFailures)),
+		Entries:            c.entries,
+		TopUsers:           make([]UserVolume, 0, len(c.entriesByUser)),
+		OtherUserEntries:   c.otherUserEntries,
+		RecentWebhooks:     newestFirst(c.recentWebhooks),
+		RecentFailures:     newestFirst(c.recentFailures),
+	}
+	for status, count := range c.requestsByStatus {
+		snapshot.RequestsByStatus[status] = count
+	}
+	for reason, count := range c.validationFailures {
+		snapshot.ValidationFailures[reason] = count
+	}
+	if len(c.entriesByLabel) > 0 {
+		snapshot.EntriesByLabel = maps.Clone(c.entriesByLabel)
+	}
+	for user, count := range c.entriesByUser {
+		snapshot.TopUsers = append(snapshot.TopUsers, UserVolume{User: user, Entries: count})
+	}
+
+	sort.Slice(snapshot.TopUsers, func(i, j int) bool {
+		if snapshot.TopUsers[i].Entries != snapshot.TopUsers[j].Entries {
+			return snapshot.TopUsers[i].Entries > snapshot.TopUsers[j].Entries
+		}
+		return snapshot.TopUsers[i].User < snapshot.TopUsers[j].User
+	})
+	if topN >= 0 && len(snapshot.TopUsers) > topN {
+		snapshot.TopUsers = snapshot.TopUsers[:topN]
+	}
+
+	return snapshot
+}
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestCollector_Snapshot(t *testing.T) {
+	c := NewCollector()
+
+	c.RecordRequest(http.StatusOK)
+	c.RecordRequest(http.StatusOK)
+	c.RecordRequest(http.StatusUnauthorized)
+	c.RecordValidationFailure("invalid signature")
+	c.RecordEntry("user1")
+	c.RecordEntry("user2")
+	c.RecordEntry("user2")
+	c.RecordEntry("user3")
+
+	snapshot := c.Snapshot(2)
+
+	if snapshot.Requests != 3 {
+		t.Errorf("Requests = %d, want 3", snapshot.Requests)
+	}
+	if snapshot.RequestsByStatus[http.StatusOK] != 2 {
+		t.Errorf("RequestsByStatus[200] = %d, want 2", snapshot.RequestsByStatus[http.StatusOK])
+	}
+	if snapshot.ValidationFailures["invalid signature"] != 1 {
+		t.Errorf("ValidationFailures = %v, want invalid signature: 1", snapshot.ValidationFailures)
+	}
+	if snapshot.Entries != 4 {
+		t.Errorf("Entries = %d, want 4", snapshot.Entries)
+	}
+	if len(snapshot.TopUsers) != 2 || snapshot.TopUsers[0].User != "user2" || snapshot.TopUsers[1].User != "user1" {
+		t.Errorf("TopUsers = %v, want [user2 user1]", snapshot.TopUsers)
+	}
+}
+
+func TestCollector_EntriesByLabel(t *testing.T) {
+	c := NewCollector()
+	if snapshot := c.Snapshot(10); snapshot.EntriesByLabel != nil {
+		t.Errorf("EntriesByLabel = %v, want none before labelled entries", snapshot.EntriesByLabel)
+	}
+
+	c.RecordEntry("user1", "campaign=airdrop", "region=eu")
+	c.RecordEntry("user2", "campaign=airdrop")
+	c.RecordEntry("user3")
+
+	snapshot := c.Snapshot(10)
+	if snapshot.Entries != 3 {
+		t.Errorf("Entries = %d, want 3", snapshot.Entries)
+	}
+	if snapshot.EntriesByLabel["campaign=airdrop"] != 2 || snapshot.EntriesByLabel["region=eu"] != 1 || len(snapshot.EntriesByLabel) != 2 {
+		t.Errorf("EntriesByLabel = %v, want campaign=airdrop: 2, region=eu: 1", snapshot.EntriesByLabel)
+	}
+
+	// Pairs beyond the limit are counted together
+	for i := range labelLimit {
+		c.RecordEntry("user1", "order="+strconv.Itoa(i))
+	}
+	c.RecordEntry("user1", "campaign=airdrop")
+	snapshot = c.Snapshot(10)
+	if len(snapshot.EntriesByLabel) != labelLimit+1 {
+		t.Errorf("len(EntriesByLabel) = %d, want %d", len(snapshot.EntriesByLabel), labelLimit+1)
+	}
+	if snapshot.EntriesByLabel[otherLabels] != 2 || snapshot.EntriesByLabel["campaign=airdrop"] != 3 {
+		t.Errorf("EntriesByLabel[%s] = %d, campaign=airdrop = %d, want 2 and 3",
+			otherLabels, snapshot.EntriesByLabel[otherLabels], snapshot.EntriesByLabel["campaign=airdrop"])
+	}
+}
+
+func TestCollector_UserLimit(t *testing.T) {
+	c := NewCollector()
+	for i := range userLimit {
+		c.RecordEntry("user" + strconv.Itoa(i))
+	}
+
+	// Users beyond the limit are counted together, known ones still apart
+	c.RecordEntry("late1")
+	c.RecordEntry("late2")
+	c.RecordEntry("user0")
+
+	snapshot := c.Snapshot(-1)
+	if len(snapshot.TopUsers) != userLimit || snapshot.TopUsers[0] != (UserVolume{User: "user0", Entries: 2}) {
+		t.Errorf("TopUsers = %d users led by %v, want %d led by user0 with 2", len(snapshot.TopUsers), snapshot.TopUsers[0], userLimit)
+	}
+	if snapshot.OtherUserEntries != 2 || snapshot.Entries != userLimit+3 {
+		t.Errorf("OtherUserEntries = %d, Entries = %d, want 2 and %d", snapshot.OtherUserEntries, snapshot.Entries, userLimit+3)
+	}
+}
+
+func TestCollector_NilSafe(t *testing.T) {
+	var c *Collector
+
+	c.RecordRequest(http.StatusOK)
+	c.RecordValidationFailure("invalid signature")
+	c.RecordEntry("user1")
+	c.RecordWebhook(WebhookEvent{Status: WebhookProcessed})
+
+	if snapshot := c.Snapshot(10); snapshot.Requests != 0 {
+		t.Errorf("nil collector snapshot = %+v, want zero value", snapshot)
+	}
+}
+
+func TestCollector_RecentWebhooks(t *testing.T) {
+	c := NewCollector()
+
+	for i := range recentLimit + 5 {
+		c.RecordWebhook(WebhookEvent{Source: "default", Status: WebhookProcessed, Entries: i})
+	}
+	c.RecordWebhook(WebhookEvent{Source: "default", Status: WebhookFailed, Reason: "invalid signature"})
+
+	snapshot := c.Snapshot(10)
+
+	if len(snapshot.RecentWebhooks) != recentLimit {
+		t.Fatalf("len(RecentWebhooks) = %d, want %d", len(snapshot.RecentWebhooks), recentLimit)
+	}
+	if first, last := snapshot.RecentWebhooks[0], snapshot.RecentWebhooks[recentLimit-1]; first.Entries != recentLimit+4 || last.Entries != 5 {
+		t.Errorf("RecentWebhooks run from %d to %d, want newest first from %d to 5", first.Entries, last.Entries, recentLimit+4)
+	}
+	if snapshot.RecentWebhooks[0].Time.IsZero() {
+		t.Error("RecentWebhooks[0].Time is zero, want the time recorded")
+	}
+	if len(snapshot.RecentFailures) != 1 || snapshot.RecentFailures[0].Reason != "invalid signature" {
+		t.Errorf("RecentFailures = %v, want the invalid signature", snapshot.RecentFailures)
+	}
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"fmt"
+	"time"
+
+	"kii.com/internal/infrastructure/config"
+)
+
+// Emitter sends counters, timings and gauges to an external metrics backend.
+// Tags are "key:value" strings.
+type Emitter interface {
+	Count(name string, value int64, tags ...string)
+	Timing(name string, d time.Duration, tags ...string)
+	Gauge(name string, value float64, tags ...string)
+	Close() error
+}
+
+// NopEmitter discards all metrics
+type NopEmitter struct{}
+
+// Count implements Emitter
+func (NopEmitter) Count(string, int64, ...string) {}
+
+// Timing implements Emitter
+func (NopEmitter) Timing(string, time.Duration, ...string) {}
+
+// Gauge implements Emitter
+func (NopEmitter) Gauge(string, float64, ...string) {}
+
+// Close implements Emitter
+func (NopEmitter) Close() error { return nil }
+
+// NewEmitter creates the emitter for the configured backend: statsd,
+// dogstatsd, or a no-op emitter when no backend is set
+func NewEmitter(cfg config.Metrics) (Emitter, error) {
+	switch cfg.Backend {
+	case "":
+		return NopEmitter{}, nil
+	case "statsd":
+		return NewStatsDEmitter(cfg.Address, cfg.Prefix, false, cfg.Tags)
+	case "dogstatsd":
+		return NewStatsDEmitter(cfg.Address, cfg.Prefix, true, cfg.Tags)
+	default:
+		return nil, fmt.Errorf("unsupported metrics backend %q (want statsd or dogstatsd)", cfg.Backend)
+	}
+}
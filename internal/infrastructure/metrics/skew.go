@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// skewSamples is the number of recent skews kept per source
+const skewSamples = 1000
+
+// SkewTracker keeps the clock skew of recent signed webhooks per source, the
+// server's time less their timestamp, and reports each as the
+// webhook.clock_skew timing. A positive skew is a sender clock behind the
+// server's, or time spent in transit; a negative one a clock ahead.
+type SkewTracker struct {
+	mu      sync.Mutex
+	sources map[string]*skewWindow
+	emitter Emitter
+}
+
+// skewWindow holds the latest skewSamples skews of a source in a ring
+type skewWindow struct {
+	skews          []time.Duration
+	outOfTolerance []bool
+	next           int
+	total          uint64
+}
+
+// SourceSkew summarizes the recent clock skew of a source, in seconds
+type SourceSkew struct {
+	Source string `json:"source"`
+	// Samples is the number of recent webhooks summarized, OutOfTolerance
+	// those among them rejected for their timestamp, and Total every webhook
+	// measured since the start
+	Samples        int     `json:"samples"`
+	OutOfTolerance int     `json:"outOfTolerance"`
+	Total          uint64  `json:"total"`
+	Min            float64 `json:"minSeconds"`
+	Mean           float64 `json:"meanSeconds"`
+	P50            float64 `json:"p50Seconds"`
+	P90            float64 `json:"p90Seconds"`
+	P99            float64 `json:"p99Seconds"`
+	Max            float64 `json:"maxSeconds"`
+}
+
+// NewSkewTracker creates a tracker reporting to emitter
+func NewSkewTracker(emitter Emitter) *SkewTracker {
+	return &SkewTracker{
+		sources: make(map[string]*skewWindow),
+		emitter: emitter,
+	}
+}
+
+// RecordSkew records the skew of a webhook from source, the endpoint's
+// tenant, which is empty for POST /webhook
+func (t *SkewTracker) RecordSkew(source string, skew time.Duration, withinTolerance bool) {
+	if source == "" {
+		source = "default"
+	}
+	direction := "behind"
+	magnitude := skew
+	if skew < 0 {
+		direction = "ahead"
+		magnitude = -skew
+	}
+	t.emitter.Timing("webhook.clock_skew", magnitude, "source:"+source, "direction:"+direction)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	window, ok := t.sources[source]
+	if !ok {
+		window = &skewWindow{}
+		t.sources[source] = window
+	}
+	if len(window.skews) < skewSamples {
+		window.skews = append(window.skews, skew)
+		window.outOfTolerance = append(window.outOfTolerance, !withinTolerance)
+	} else {
+		window.skews[window.next] = skew
+		window.outOfTolerance[window.next] = !withinTolerance
+	}
+	window.next = (window.next + 1) % skewSamples
+	window.total++
+}
+
+// Snapshot summarizes the recent skew of every source, by name
+func (t *SkewTracker) Snapshot() []SourceSkew {
+	t.mu.Lock()
+	summaries := make([]SourceSkew, 0, len(t.sources))
+	samples := make([][]time.Duration, 0, len(t.sources))
+	for source, window := range t.sources {
+		summary := SourceSkew{Source: source, Samples: len(window.skews), Total: window.total}
+		for _, out := range window.outOfTolerance {
+			if out {
+				summary.OutOfTolerance++
+			}
+		}
+		summaries = append(summaries, summary)
+		samples = append(samples, append([]time.Duration(nil), window.skews...))
+	}
+	t.mu.Unlock()
+
+	for i := range summaries {
+		summarizeSkews(&summaries[i], samples[i])
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Source < summaries[j].Source })
+	return summaries
+}
+
+// summarizeSkews sets the statistics of summary from skews
+func summarizeSkews(summary *SourceSkew, skews []time.Duration) {
+	if len(skews) == 0 {
+		return
+	}
+	sort.Slice(skews, func(i, j int) bool { return skews[i] < skews[j] })
+	var sum float64
+	for _, skew := range skews {
+		sum += skew.Seconds()
+	}
+	// Nearest-rank percentiles
+	percentile := func(p float64) float64 {
+		rank := int(math.Ceil(p/100*float64(len(skews)))) - 1
+		return skews[max(rank, 0)].Seconds()
+	}
+	summary.Min = skews[0].Seconds()
+	summary.Mean = sum / float64(len(skews))
+	summary.P50 = percentile(50)
+	summary.P90 = percentile(90)
+	summary.P99 = percentile(99)
+	summary.Max = skews[len(skews)-1].Seconds()
+}
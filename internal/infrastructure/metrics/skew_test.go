@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// timingEmitter records each timing with its tags
+type timingEmitter struct {
+	NopEmitter
+	timings []string
+}
+
+func (e *timingEmitter) Timing(name string, d time.Duration, tags ...string) {
+	e.timings = append(e.timings, name+" "+d.String()+" "+strings.Join(tags, ","))
+}
+
+func TestSkewTracker(t *testing.T) {
+	emitter := &timingEmitter{}
+	tracker := NewSkewTracker(emitter)
+
+	// The default endpoint's senders run 1 to 10 seconds behind
+	for i := 1; i <= 10; i++ {
+		tracker.RecordSkew("", time.Duration(i)*time.Second, true)
+	}
+	tracker.RecordSkew("partner", -2*time.Second, true)
+	tracker.RecordSkew("partner", -10*time.Minute, false)
+
+	snapshot := tracker.Snapshot()
+	if len(snapshot) != 2 {
+		t.Fatalf("Snapshot() = %+v, want two sources", snapshot)
+	}
+	want := SourceSkew{Source: "default", Samples: 10, Total: 10, Min: 1, Mean: 5.5, P50: 5, P90: 9, P99: 10, Max: 10}
+	if snapshot[0] != want {
+		t.Errorf("Snapshot()[0] = %+v, want %+v", snapshot[0], want)
+	}
+	want = SourceSkew{Source: "partner", Samples: 2, OutOfTolerance: 1, Total: 2, Min: -600, Mean: -301, P50: -600, P90: -2, P99: -2, Max: -2}
+	if snapshot[1] != want {
+		t.Errorf("Snapshot()[1] = %+v, want %+v", snapshot[1], want)
+	}
+	if got := emitter.timings[len(emitter.timings)-1]; got != "webhook.clock_skew 10m0s source:partner,direction:ahead" {
+		t.Errorf("last timing = %q, want the partner's skew ahead", got)
+	}
+
+	// Only the latest skews are kept
+	for range skewSamples {
+		tracker.RecordSkew("partner", time.Second, true)
+	}
+	if got := tracker.Snapshot()[1]; got.Samples != skewSamples || got.OutOfTolerance != 0 || got.Total != skewSamples+2 || got.Min != 1 {
+		t.Errorf("Snapshot()[1] = %+v, want only the latest %d skews", got, skewSamples)
+	}
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsDEmitter sends metrics over UDP in StatsD format. With DogStatsD
+// enabled, tags are appended in the Datadog "|#key:value" extension;
+// plain StatsD has no tag support, so tags are dropped.
+type StatsDEmitter struct {
+	conn       net.Conn
+	prefix     string
+	dogstatsd  bool
+	globalTags []string
+}
+
+// NewStatsDEmitter creates an emitter sending to address (host:port). prefix
+// is prepended to every metric name and globalTags are added to every metric.
+func NewStatsDEmitter(address, prefix string, dogstatsd bool, globalTags []string) (*StatsDEmitter, error) {
+	if address == "" {
+		address = "127.0.0.1:8125"
+	}
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial statsd at %s: %w", address, err)
+	}
+
+	return &StatsDEmitter{
+		conn:       conn,
+		prefix:     prefix,
+		dogstatsd:  dogstatsd,
+		globalTags: globalTags,
+	}, nil
+}
+
+// Count increments a counter
+func (e *StatsDEmitter) Count(name string, value int64, tags ...string) {
+	e.send(name, strconv.FormatInt(value, 10), "c", tags)
+}
+
+// Timing records a duration in milliseconds
+func (e *StatsDEmitter) Timing(name string, d time.Duration, tags ...string) {
+	e.send(name, strconv.FormatFloat(float64(d.Microseconds())/1000, 'f', -1, 64), "ms", tags)
+}
+
+// Gauge sets a gauge
+func (e *StatsDEmitter) Gauge(name string, value float64, tags ...string) {
+	e.send(name, strconv.FormatFloat(value, 'f', -1, 64), "g", tags)
+}
+
+// Close closes the UDP socket
+func (e *StatsDEmitter) Close() error {
+	return e.conn.Close()
+}
+
+// send writes one metric packet. Errors are ignored: metrics are best effort
+// and must never slow down or fail request handling.
+func (e *StatsDEmitter) send(name, value, metricType string, tags []string) {
+	var packet strings.Builder
+	packet.WriteString(e.prefix)
+	packet.WriteString(name)
+	packet.WriteByte(':')
+	packet.WriteString(value)
+	packet.WriteByte('|')
+	packet.WriteString(metricType)
+
+	if e.dogstatsd && len(e.globalTags)+len(tags) > 0 {
+		packet.WriteString("|#")
+		packet.WriteString(strings.Join(append(append([]string{}, e.globalTags...), tags...), ","))
+	}
+
+	_, _ = e.conn.Write([]byte(packet.String()))
+}
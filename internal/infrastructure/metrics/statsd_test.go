@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStatsDEmitter(t *testing.T) {
+	tests := []struct {
+		name      string
+		dogstatsd bool
+		emit      func(e Emitter)
+		want      string
+	}{
+		{
+			name: "statsd counter drops tags",
+			emit: func(e Emitter) { e.Count("webhooks", 1, "status:200") },
+			want: "kii.webhooks:1|c",
+		},
+		{
+			name:      "dogstatsd counter with tags",
+			dogstatsd: true,
+			emit:      func(e Emitter) { e.Count("webhooks", 2, "status:200") },
+			want:      "kii.webhooks:2|c|#env:test,status:200",
+		},
+		{
+			name:      "timing in milliseconds",
+			dogstatsd: true,
+			emit:      func(e Emitter) { e.Timing("request.duration", 1500*time.Microsecond) },
+			want:      "kii.request.duration:1.5|ms|#env:test",
+		},
+		{
+			name: "gauge",
+			emit: func(e Emitter) { e.Gauge("nonce_store.size", 42) },
+			want: "kii.nonce_store.size:42|g",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			defer listener.Close()
+
+			emitter, err := NewStatsDEmitter(listener.LocalAddr().String(), "kii.", tt.dogstatsd, []string{"env:test"})
+			if err != nil {
+				t.Fatalf("NewStatsDEmitter() error = %v", err)
+			}
+			defer emitter.Close()
+
+			tt.emit(emitter)
+
+			buf := make([]byte, 512)
+			_ = listener.SetReadDeadline(time.Now().Add(time.Second))
+			n, _, err := listener.ReadFrom(buf)
+			if err != nil {
+				t.Fatalf("failed to read packet: %v", err)
+			}
+			if got := string(buf[:n]); got != tt.want {
+				t.Errorf("packet = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
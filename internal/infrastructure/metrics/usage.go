@@ -0,0 +1,231 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// UsageMonthFormat is the layout of the months usage is reported for
+const UsageMonthFormat = "2006-01"
+
+// usageRetention is the number of months a UsageMeter keeps
+const usageRetention = 13
+
+// TenantUsage is a tenant's usage in one month. Webhooks counts accepted
+// webhooks, Bytes the bodies of all received webhooks, accepted or not.
+type TenantUsage struct {
+	Tenant             string `json:"tenant"`
+	Webhooks           uint64 `json:"webhooks"`
+	Bytes              uint64 `json:"bytes"`
+	ValidationFailures uint64 `json:"validationFailures"`
+}
+
+// UsageReport is the usage of every tenant in a month, sorted by tenant
+type UsageReport struct {
+	Month   string        `json:"month"`
+	Tenants []TenantUsage `json:"tenants"`
+}
+
+// UsageMeter counts webhooks, data volume and validation failures per tenant
+// and calendar month (UTC), keeping the last usageRetention months. All
+// methods are safe to call on a nil *UsageMeter, which records nothing.
+type UsageMeter struct {
+	mu     sync.Mutex
+	months map[string]map[string]*TenantUsage
+	now    func() time.Time
+}
+
+// NewUsageMeter creates an empty usage meter
+func NewUsageMeter() *UsageMeter {
+	return &UsageMeter{
+		months: make(map[string]map[string]*TenantUsage),
+		now:    time.Now,
+	}
+}
+
+// RecordWebhook records an accepted webhook of size bytes for tenant
+func (m *UsageMeter) RecordWebhook(tenant string, bytes int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage := m.usage(tenant)
+	usage.Webhooks++
+	usage.Bytes += uint64(bytes)
+}
+
+// RecordValidationFailure records a rejected webhook of size bytes for tenant
+func (m *UsageMeter) RecordValidationFailure(tenant string, bytes int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage := m.usage(tenant)
+	usage.ValidationFailures++
+	usage.Bytes += uint64(bytes)
+}
+
+// usage returns the current month's usage of tenant, starting a new month
+// and dropping the oldest one past retention as needed. m.mu must be held.
+func (m *UsageMeter) usage(tenant string) *TenantUsage {
+	month := m.now().UTC().Format(UsageMonthFormat)
+	tenants, ok := m.months[month]
+	if !ok {
+		tenants = make(map[string]*TenantUsage)
+		m.months[month] = tenants
+		m.prune()
+	}
+	usage, ok := tenants[tenant]
+	if !ok {
+		usage = &TenantUsage{Tenant: tenant}
+		tenants[tenant] = usage
+	}
+	return usage
+}
+
+// prune drops the oldest months beyond usageRetention. m.mu must be held.
+func (m *UsageMeter) prune() {
+	months := m.sortedMonths()
+	for len(months) > usageRetention {
+		delete(m.months, months[0])
+		months = months[1:]
+	}
+}
+
+// sortedMonths returns the recorded months, oldest first. m.mu must be held.
+func (m *UsageMeter) sortedMonths() []string {
+	months := make([]string, 0, len(m.months))
+	for month := range m.months {
+		months = append(months, month)
+	}
+	sort.Strings(months)
+	return months
+}
+
+// Months returns the months with recorded usage, oldest first
+func (m *UsageMeter) Months() []string {
+	if m == nil {
+		return []string{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.sortedMonths()
+}
+
+// CurrentMonth returns the month usage is currently recorded for
+func (m *UsageMeter) CurrentMonth() string {
+	if m == nil {
+		return time.Now().UTC().Format(UsageMonthFormat)
+	}
+	return m.now().UTC().Format(UsageMonthFormat)
+}
+
+// Report returns the usage of every tenant in month (see UsageMonthFormat)
+func (m *UsageMeter) Report(month string) UsageReport {
+	report := UsageReport{Month: month, Tenants: []TenantUsage{}}
+	if m == nil {
+		return report
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, usage := range m.months[month] {
+		report.Tenants = append(report.Tenants, *usage)
+	}
+	sort.Slice(report.Tenants, func(i, j int) bool {
+		return report.Tenants[i].Tenant < report.Tenants[j].Tenant
+	})
+	return report
+}
+
+// Save writes every retained month to path as JSON. The file is replaced
+// atomically, so a crash never leaves a partial report behind.
+func (m *UsageMeter) Save(path string) error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	reports := make([]UsageReport, 0, len(m.months))
+	for _, month := range m.sortedMonths() {
+		report := UsageReport{Month: month}
+		for _, usage := range m.months[month] {
+			report.Tenants = append(report.Tenants, *usage)
+		}
+		reports = append(reports, report)
+	}
+	m.mu.Unlock()
+
+	data, err := json.Marshal(reports)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save usage: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save usage: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save usage: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save usage: %w", err)
+	}
+	return nil
+}
+
+// Load adds the usage saved at path by Save to the meter. A missing file is
+// not an error, so a new deployment starts from zero.
+func (m *UsageMeter) Load(path string) error {
+	if m == nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load usage: %w", err)
+	}
+
+	var reports []UsageReport
+	if err := json.Unmarshal(data, &reports); err != nil {
+		return fmt.Errorf("failed to load usage from %s: %w", path, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, report := range reports {
+		tenants, ok := m.months[report.Month]
+		if !ok {
+			tenants = make(map[string]*TenantUsage)
+			m.months[report.Month] = tenants
+		}
+		for _, saved := range report.Tenants {
+			usage, ok := tenants[saved.Tenant]
+			if !ok {
+				usage = &TenantUsage{Tenant: saved.Tenant}
+				tenants[saved.Tenant] = usage
+			}
+			usage.Webhooks += saved.Webhooks
+			usage.Bytes += saved.Bytes
+			usage.ValidationFailures += saved.ValidationFailures
+		}
+	}
+	m.prune()
+	return nil
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUsageMeter_Report(t *testing.T) {
+	meter := NewUsageMeter()
+	now := time.Date(2026, 1, 31, 23, 0, 0, 0, time.UTC)
+	meter.now = func() time.Time { return now }
+
+	meter.RecordWebhook("partner", 100)
+	meter.RecordWebhook("partner", 50)
+	meter.RecordValidationFailure("partner", 30)
+	meter.RecordWebhook("default", 10)
+	now = now.Add(2 * time.Hour)
+	meter.RecordWebhook("partner", 20)
+
+	january := meter.Report("2026-01")
+	want := []TenantUsage{
+		{Tenant: "default", Webhooks: 1, Bytes: 10},
+		{Tenant: "partner", Webhooks: 2, Bytes: 180, ValidationFailures: 1},
+	}
+	if len(january.Tenants) != len(want) {
+		t.Fatalf("Report(2026-01) = %+v, want %+v", january.Tenants, want)
+	}
+	for i := range want {
+		if january.Tenants[i] != want[i] {
+			t.Errorf("Report(2026-01) tenant %d = %+v, want %+v", i, january.Tenants[i], want[i])
+		}
+	}
+	if february := meter.Report("2026-02"); len(february.Tenants) != 1 || february.Tenants[0].Webhooks != 1 {
+		t.Errorf("Report(2026-02) = %+v, want one partner webhook", february.Tenants)
+	}
+	if months := meter.Months(); len(months) != 2 || meter.CurrentMonth() != "2026-02" {
+		t.Errorf("Months() = %v, CurrentMonth() = %q", months, meter.CurrentMonth())
+	}
+}
+
+func TestUsageMeter_Retention(t *testing.T) {
+	meter := NewUsageMeter()
+	now := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	meter.now = func() time.Time { return now }
+
+	for range usageRetention + 2 {
+		meter.RecordWebhook("partner", 1)
+		now = now.AddDate(0, 1, 0)
+	}
+
+	months := meter.Months()
+	if len(months) != usageRetention || months[0] != "2025-03" {
+		t.Errorf("Months() = %v, want the last %d months from 2025-03", months, usageRetention)
+	}
+}
+
+func TestUsageMeter_SaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	meter := NewUsageMeter()
+	meter.RecordWebhook("partner", 100)
+	meter.RecordValidationFailure("default", 5)
+	if err := meter.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	restored := NewUsageMeter()
+	if err := restored.Load(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("Load() of a missing file error = %v", err)
+	}
+	if err := restored.Load(path); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	restored.RecordWebhook("partner", 1)
+
+	report := restored.Report(restored.CurrentMonth())
+	if len(report.Tenants) != 2 || report.Tenants[1].Webhooks != 2 || report.Tenants[1].Bytes != 101 {
+		t.Errorf("Report() after Load = %+v, want saved usage carried over", report.Tenants)
+	}
+}
+
+func TestUsageMeter_NilSafe(t *testing.T) {
+	var meter *UsageMeter
+	meter.RecordWebhook("partner", 1)
+	meter.RecordValidationFailure("partner", 1)
+	if report := meter.Report("2026-01"); len(report.Tenants) != 0 {
+		t.Errorf("Report() on nil meter = %+v", report)
+	}
+	if err := meter.Save("unused"); err != nil {
+		t.Errorf("Save() on nil meter error = %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+// Package mirror copies validated webhooks to another environment.
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"kii.com/internal/infrastructure/config"
+	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/metrics"
+	"kii.com/internal/infrastructure/queue"
+	"kii.com/internal/infrastructure/validator"
+)
+
+// workers is the number of webhooks sent to the mirror at once
+const workers = 4
+
+// Mirror results, tagged on the mirror.requests counter
+const (
+	ResultSent    = "sent"
+	ResultFailed  = "failed"
+	ResultDropped = "dropped"
+)
+
+// request is a webhook waiting to be mirrored
+type request struct {
+	path  string
+	nonce string
+	body  []byte
+}
+
+// Mirror sends copies of webhooks to a staging deployment, signed with the
+// staging secret, in the background. Webhooks arriving while the queue is full
+// are dropped, so a slow or unavailable mirror never holds up the ledger.
+type Mirror struct {
+	url     *url.URL
+	secret  string
+	client  *http.Client
+	queue   *queue.Queue[request]
+	metrics metrics.Emitter
+	logger  logger.Logger
+	now     func() time.Time
+}
+
+// New creates a mirror to cfg.URL and starts sending to it
+func New(cfg config.Mirror, emitter metrics.Emitter, logger logger.Logger) (*Mirror, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid mirror.url %q", cfg.URL)
+	}
+	if cfg.Secret == "" {
+		return nil, fmt.Errorf("mirror.secret is required with mirror.url")
+	}
+	if cfg.QueueSize < 1 {
+		return nil, fmt.Errorf("mirror.queueSize must be positive")
+	}
+
+	m := &Mirror{
+		url:     u,
+		secret:  cfg.Secret,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		metrics: emitter,
+		logger:  logger,
+		now:     time.Now,
+	}
+	m.queue = queue.New(cfg.QueueSize, workers, m.run)
+	return m, nil
+}
+
+// URL returns the mirror's URL with any password redacted, for logging
+func (m *Mirror) URL() string {
+	return m.url.Redacted()
+}
+
+// Send queues a copy of a validated webhook to path, e.g. /webhook/stripe,
+// under its original nonce. It never blocks. A nil Mirror sends nothing.
+func (m *Mirror) Send(path, nonce string, body []byte) {
+	if m == nil {
+		return
+	}
+	err := m.queue.Push(request{path: path, nonce: nonce, body: bytes.Clone(body)})
+	if errors.Is(err, queue.ErrFull) {
+		m.metrics.Count("mirror.requests", 1, "result:"+ResultDropped)
+	}
+}
+
+// QueueLength returns the number of webhooks waiting to be sent
+func (m *Mirror) QueueLength() int {
+	return m.queue.Len()
+}
+
+// QueueCapacity returns the number of webhooks that can wait to be sent
+// before more are dropped
+func (m *Mirror) QueueCapacity() int {
+	return m.queue.Cap()
+}
+
+// run sends queued webhooks until the mirror is closed. Once ctx is
+// cancelled the webhooks left are dropped.
+func (m *Mirror) run(ctx context.Context, requests <-chan request) {
+	for req := range requests {
+		if ctx.Err() != nil {
+			continue
+		}
+		result := ResultSent
+		if err := m.send(ctx, req); err != nil {
+			result = ResultFailed
+			if ctx.Err() == nil {
+				m.logger.LogWarning(ctx, "Failed to mirror webhook",
+					"path", req.path,
+					"error", err.Error())
+			}
+		}
+		m.metrics.Count("mirror.requests", 1, "result:"+result)
+	}
+}
+
+// send signs req with the mirror's secret and a current timestamp, keeping
+// the nonce, and posts it
+func (m *Mirror) send(ctx context.Context, req request) error {
+	nonce := req.nonce
+	if nonce == "" {
+		nonce = newNonce()
+	}
+	timestamp := strconv.FormatInt(m.now().Unix(), 10)
+	signature, err := validator.ComputeSignature(m.secret, timestamp, nonce, req.body)
+	if err != nil {
+		return err
+	}
+
+	target := m.url.JoinPath(strings.TrimPrefix(req.path, "/"))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, target.String(), bytes.NewReader(req.body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(validator.DefaultTimestampHeader, timestamp)
+	httpReq.Header.Set(validator.DefaultNonceHeader, nonce)
+	httpReq.Header.Set(validator.DefaultSignatureHeader, signature)
+
+	resp, err := m.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("mirror responded %s", resp.Status)
+	}
+	return nil
+}
+
+// newNonce returns a random nonce for webhooks that came without one
+func newNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Close stops the mirror, cancelling the webhooks being sent and dropping the
+// queued ones
+func (m *Mirror) Close() {
+	m.queue.CloseWithin(0)
+}
@@ -0,0 +1,141 @@
+package mirror
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"kii.com/internal/infrastructure/config"
+	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/metrics"
+	"kii.com/internal/infrastructure/validator"
+)
+
+// countingEmitter records the tags of each counter increment
+type countingEmitter struct {
+	metrics.NopEmitter
+	mu     sync.Mutex
+	counts []string
+}
+
+func (e *countingEmitter) Count(name string, _ int64, tags ...string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.counts = append(e.counts, name+" "+strings.Join(tags, ","))
+}
+
+func TestMirror_ResignsWebhooks(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	staging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer staging.Close()
+
+	emitter := &countingEmitter{}
+	m, err := New(config.Mirror{URL: staging.URL + "/kii", Secret: "staging-secret", QueueSize: 10, Timeout: time.Second},
+		emitter, logger.NewLogger())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	body := []byte(`{"user":"user1","asset":"BTC","amount":"1"}`)
+	m.Send("/webhook/stripe", "nonce-1", body)
+
+	var r *http.Request
+	select {
+	case r = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not mirrored")
+	}
+	got := <-bodies
+	// Wait for the response before closing, which cancels a send in progress
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		emitter.mu.Lock()
+		n := len(emitter.counts)
+		emitter.mu.Unlock()
+		if n > 0 {
+			break
+		}
+	}
+	m.Close()
+
+	if r.URL.Path != "/kii/webhook/stripe" {
+		t.Errorf("path = %q, want /kii/webhook/stripe", r.URL.Path)
+	}
+	if string(got) != string(body) {
+		t.Errorf("body = %s, want %s", got, body)
+	}
+	if r.Header.Get("X-Nonce") != "nonce-1" {
+		t.Errorf("X-Nonce = %q, want the original nonce-1", r.Header.Get("X-Nonce"))
+	}
+	want, _ := validator.ComputeSignature("staging-secret", r.Header.Get("X-Timestamp"), "nonce-1", body)
+	if r.Header.Get("X-Signature") != want {
+		t.Errorf("X-Signature = %q, want one made with the staging secret", r.Header.Get("X-Signature"))
+	}
+	if counts := strings.Join(emitter.counts, ";"); counts != "mirror.requests result:sent" {
+		t.Errorf("counts = %q, want one sent", counts)
+	}
+}
+
+func TestMirror_DropsWhenQueueIsFull(t *testing.T) {
+	release := make(chan struct{})
+	staging := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		<-release
+	}))
+	defer staging.Close()
+	defer close(release)
+
+	emitter := &countingEmitter{}
+	m, err := New(config.Mirror{URL: staging.URL, Secret: "staging-secret", QueueSize: 1, Timeout: time.Minute},
+		emitter, logger.NewLogger())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer m.Close()
+
+	// The workers take one webhook each and the queue holds one more
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range workers + 10 {
+			m.Send("/webhook", "", []byte(`{}`))
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send() blocked on a full queue")
+	}
+
+	emitter.mu.Lock()
+	defer emitter.mu.Unlock()
+	if len(emitter.counts) == 0 || emitter.counts[0] != "mirror.requests result:dropped" {
+		t.Errorf("counts = %v, want webhooks dropped", emitter.counts)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Mirror
+	}{
+		{name: "relative URL", cfg: config.Mirror{URL: "staging", Secret: "s", QueueSize: 1}},
+		{name: "no secret", cfg: config.Mirror{URL: "https://staging.example.com", QueueSize: 1}},
+		{name: "no queue", cfg: config.Mirror{URL: "https://staging.example.com", Secret: "s"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cfg, metrics.NopEmitter{}, logger.NewLogger()); err == nil {
+				t.Error("New() error = nil, want an error")
+			}
+		})
+	}
+}
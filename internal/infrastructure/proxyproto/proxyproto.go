@@ -0,0 +1,263 @@
+// Package proxyproto accepts the HAProxy PROXY protocol, versions 1 and 2,
+// on a listener, so that connections relayed by a TCP load balancer report
+// the client's address instead of the load balancer's
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// v1MaxLength is the longest version 1 header, including CRLF
+	v1MaxLength = 107
+	// v2HeaderLength is the fixed part of a version 2 header
+	v2HeaderLength = 16
+)
+
+// v2Signature starts every version 2 header
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ErrInvalidHeader is returned when reading from a connection that did not
+// start with a valid PROXY header
+var ErrInvalidHeader = errors.New("invalid PROXY protocol header")
+
+// Listener reads a PROXY header from each connection accepted from a
+// trusted peer. Connections from other peers are served with their own
+// address and any header they send is left in the stream.
+type Listener struct {
+	net.Listener
+	trusted []netip.Prefix
+	timeout time.Duration
+}
+
+// NewListener wraps listener. sources are the IPs or CIDR ranges of the load
+// balancers, which must send a header on every connection; when empty, every
+// TCP peer must. Connections over a Unix socket are trusted, as its
+// permissions decide who can connect. The header must arrive within
+// timeout.
+func NewListener(listener net.Listener, sources []string, timeout time.Duration) (*Listener, error) {
+	trusted := make([]netip.Prefix, 0, len(sources))
+	for _, source := range sources {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(source); err == nil {
+			trusted = append(trusted, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PROXY protocol source %q: want an IP or CIDR range", source)
+		}
+		trusted = append(trusted, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return &Listener{Listener: listener, trusted: trusted, timeout: timeout}, nil
+}
+
+// Accept returns the next connection. Its header is read on first use, in
+// the connection's own goroutine, so a slow peer does not hold up Accept.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.trusts(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	return &Conn{Conn: conn, reader: bufio.NewReaderSize(conn, v1MaxLength+1), timeout: l.timeout}, nil
+}
+
+// trusts reports whether addr may send a PROXY header
+func (l *Listener) trusts(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok || len(l.trusted) == 0 {
+		return true
+	}
+	ip, ok := netip.AddrFromSlice(tcp.IP)
+	if !ok {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, prefix := range l.trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn is a connection that starts with a PROXY header
+type Conn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+
+	once       sync.Once
+	remoteAddr net.Addr
+	localAddr  net.Addr
+	err        error
+}
+
+// Read reads from the connection after the header, failing with
+// ErrInvalidHeader when the header is missing or malformed
+func (c *Conn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the client address from the header, or the peer's
+// address when the header carries none
+func (c *Conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the client connected to, from the header,
+// or the listener's address when the header carries none
+func (c *Conn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// readHeader reads the header within the timeout
+func (c *Conn) readHeader() {
+	if c.timeout > 0 {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		defer func() { _ = c.Conn.SetReadDeadline(time.Time{}) }()
+	}
+	c.remoteAddr, c.localAddr, c.err = readHeader(c.reader)
+	if c.err != nil && !errors.Is(c.err, ErrInvalidHeader) {
+		c.err = fmt.Errorf("failed to read PROXY protocol header: %w", c.err)
+	}
+}
+
+// readHeader reads a version 1 or 2 header from r and returns the source and
+// destination addresses it carries, which are nil for LOCAL and UNKNOWN
+// connections and unsupported address families
+func readHeader(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch first[0] {
+	case 'P':
+		return readV1(r)
+	case '\r':
+		return readV2(r)
+	default:
+		return nil, nil, ErrInvalidHeader
+	}
+}
+
+// readV1 reads a version 1 header, e.g.
+// "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"
+func readV1(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, nil, ErrInvalidHeader
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(line) > v1MaxLength || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, ErrInvalidHeader
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, nil, ErrInvalidHeader
+	}
+	if fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, ErrInvalidHeader
+	}
+	src, err := v1Addr(fields[2], fields[4], fields[1] == "TCP6")
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := v1Addr(fields[3], fields[5], fields[1] == "TCP6")
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+// v1Addr parses an address and port of a version 1 header
+func v1Addr(ip, port string, is6 bool) (net.Addr, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Is6() != is6 {
+		return nil, ErrInvalidHeader
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, ErrInvalidHeader
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, uint16(p))), nil
+}
+
+// readV2 reads a binary version 2 header
+func readV2(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, v2HeaderLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(header[:12], v2Signature) || header[12]>>4 != 2 {
+		return nil, nil, ErrInvalidHeader
+	}
+	body := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, nil, err
+	}
+
+	switch command := header[12] & 0x0f; command {
+	case 0x0: // LOCAL: sent by the load balancer itself, e.g. health checks
+		return nil, nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, nil, ErrInvalidHeader
+	}
+
+	// Only TCP over IPv4 and IPv6 carries a client address to report; the
+	// address block is followed by TLVs, which are skipped
+	var size int
+	switch header[13] {
+	case 0x11:
+		size = net.IPv4len
+	case 0x21:
+		size = net.IPv6len
+	default:
+		return nil, nil, nil
+	}
+	if len(body) < 2*size+4 {
+		return nil, nil, ErrInvalidHeader
+	}
+	srcIP, _ := netip.AddrFromSlice(body[:size])
+	dstIP, _ := netip.AddrFromSlice(body[size : 2*size])
+	srcPort := binary.BigEndian.Uint16(body[2*size:])
+	dstPort := binary.BigEndian.Uint16(body[2*size+2:])
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(srcIP, srcPort)),
+		net.TCPAddrFromAddrPort(netip.AddrPortFrom(dstIP, dstPort)), nil
+}
@@ -0,0 +1,155 @@
+package proxyproto
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// v2Header builds a version 2 header with the given command, family and
+// address block, followed by a TLV that must be skipped
+func v2Header(command, family byte, addresses []byte) []byte {
+	tlv := []byte{0x04, 0x00, 0x01, 0x00} // PP2_TYPE_NOOP
+	header := append([]byte{}, v2Signature...)
+	header = append(header, 0x20|command, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(addresses)+len(tlv)))
+	header = append(header, addresses...)
+	return append(header, tlv...)
+}
+
+func TestReadHeader(t *testing.T) {
+	ipv4 := []byte{192, 0, 2, 1, 198, 51, 100, 1, 0xdc, 0x04, 0x01, 0xbb}
+	ipv6 := make([]byte, 36)
+	ipv6[0], ipv6[1], ipv6[15] = 0x20, 0x01, 0x01
+	ipv6[16], ipv6[17], ipv6[31] = 0x20, 0x01, 0x02
+	binary.BigEndian.PutUint16(ipv6[32:], 56324)
+	binary.BigEndian.PutUint16(ipv6[34:], 443)
+
+	tests := []struct {
+		name    string
+		header  string
+		wantSrc string
+		wantDst string
+		wantErr bool
+	}{
+		{name: "v1 TCP4", header: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n", wantSrc: "192.0.2.1:56324", wantDst: "198.51.100.1:443"},
+		{name: "v1 TCP6", header: "PROXY TCP6 2001::1 2001::2 56324 443\r\n", wantSrc: "[2001::1]:56324", wantDst: "[2001::2]:443"},
+		{name: "v1 UNKNOWN", header: "PROXY UNKNOWN\r\n"},
+		{name: "v1 family mismatch", header: "PROXY TCP4 2001::1 2001::2 56324 443\r\n", wantErr: true},
+		{name: "v1 bad port", header: "PROXY TCP4 192.0.2.1 198.51.100.1 70000 443\r\n", wantErr: true},
+		{name: "v1 without CRLF", header: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\n", wantErr: true},
+		{name: "v1 too long", header: "PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n", wantErr: true},
+		{name: "v2 TCP4", header: string(v2Header(0x1, 0x11, ipv4)), wantSrc: "192.0.2.1:56324", wantDst: "198.51.100.1:443"},
+		{name: "v2 TCP6", header: string(v2Header(0x1, 0x21, ipv6)), wantSrc: "[2001::1]:56324", wantDst: "[2001::2]:443"},
+		{name: "v2 LOCAL", header: string(v2Header(0x0, 0x00, nil))},
+		{name: "v2 UNIX", header: string(v2Header(0x1, 0x31, make([]byte, 216)))},
+		{name: "v2 short addresses", header: string(v2Header(0x1, 0x11, ipv4[:6])), wantErr: true},
+		{name: "v2 unknown command", header: string(v2Header(0x2, 0x11, ipv4)), wantErr: true},
+		{name: "plain HTTP", header: "POST /webhook HTTP/1.1\r\n", wantErr: true},
+		{name: "garbage", header: "GET / HTTP/1.1\r\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReaderSize(strings.NewReader(tt.header+"rest"), v1MaxLength+1)
+			src, dst, err := readHeader(r)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("readHeader() = %v, %v, want an error", src, dst)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readHeader() error = %v", err)
+			}
+			if got := addrString(src); got != tt.wantSrc {
+				t.Errorf("source = %q, want %q", got, tt.wantSrc)
+			}
+			if got := addrString(dst); got != tt.wantDst {
+				t.Errorf("destination = %q, want %q", got, tt.wantDst)
+			}
+			if rest, _ := io.ReadAll(r); string(rest) != "rest" {
+				t.Errorf("after the header = %q, want %q", rest, "rest")
+			}
+		})
+	}
+}
+
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+func TestListener(t *testing.T) {
+	tests := []struct {
+		name       string
+		sources    []string
+		send       string
+		wantRemote string
+		wantBody   string
+		wantErr    error
+	}{
+		{name: "header from trusted peer", sources: []string{"127.0.0.0/8"}, send: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nhello", wantRemote: "192.0.2.1:56324", wantBody: "hello"},
+		{name: "any peer trusted", send: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nhello", wantRemote: "192.0.2.1:56324", wantBody: "hello"},
+		{name: "missing header", sources: []string{"127.0.0.1"}, send: "hello\r\n", wantErr: ErrInvalidHeader},
+		{name: "untrusted peer", sources: []string{"10.0.0.0/8"}, send: "hello", wantRemote: "127.0.0.1", wantBody: "hello"},
+		{name: "header not sent in time", send: "PROXY", wantErr: os.ErrDeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Listen() error = %v", err)
+			}
+			listener, err := NewListener(inner, tt.sources, 100*time.Millisecond)
+			if err != nil {
+				t.Fatalf("NewListener() error = %v", err)
+			}
+			defer listener.Close()
+
+			client, err := net.Dial("tcp", inner.Addr().String())
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+			defer client.Close()
+			if _, err := client.Write([]byte(tt.send)); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			conn, err := listener.Accept()
+			if err != nil {
+				t.Fatalf("Accept() error = %v", err)
+			}
+			defer conn.Close()
+			if tt.wantErr != nil {
+				if _, err := conn.Read(make([]byte, 64)); !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Read() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			body := make([]byte, len(tt.wantBody))
+			_, err = io.ReadFull(conn, body)
+			if err != nil || string(body) != tt.wantBody {
+				t.Fatalf("Read() = %q, %v, want %q", body, err, tt.wantBody)
+			}
+			if got := conn.RemoteAddr().String(); !strings.HasPrefix(got, tt.wantRemote) {
+				t.Errorf("RemoteAddr() = %s, want %s", got, tt.wantRemote)
+			}
+		})
+	}
+}
+
+func TestNewListener_InvalidSource(t *testing.T) {
+	if _, err := NewListener(nil, []string{"lb.example.com"}, time.Second); err == nil {
+		t.Error("NewListener() error = nil, want an error for a host name")
+	}
+}
@@ -0,0 +1,127 @@
+// Package queue hands work to background workers through a bounded queue
+// that never blocks the caller: items pushed while it is full are refused,
+// so a slow or unavailable destination drops work instead of holding up the
+// ledger.
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrFull is returned by Push when the queue is at capacity
+	ErrFull = errors.New("queue is full")
+	// ErrClosed is returned by Push after the queue has been closed
+	ErrClosed = errors.New("queue is closed")
+)
+
+// Work drains a queue: it receives the queued items until the queue is
+// closed and empty. ctx is cancelled when the queue is closed without
+// waiting for its workers, e.g. once CloseWithin's timeout passes.
+type Work[T any] func(ctx context.Context, items <-chan T)
+
+// Queue is a bounded queue of items of type T drained by background workers
+type Queue[T any] struct {
+	items chan T
+
+	mu     sync.RWMutex
+	closed bool
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// New starts workers goroutines running work on a queue of up to size
+// items. size and workers must be positive.
+func New[T any](size, workers int, work Work[T]) *Queue[T] {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue[T]{
+		items:   make(chan T, size),
+		ctx:     ctx,
+		cancel:  cancel,
+		stopped: make(chan struct{}),
+	}
+	var running sync.WaitGroup
+	running.Add(workers)
+	for range workers {
+		go func() {
+			defer running.Done()
+			work(ctx, q.items)
+		}()
+	}
+	go func() {
+		running.Wait()
+		close(q.stopped)
+	}()
+	return q
+}
+
+// Push queues item. It never blocks: it returns ErrFull if the queue is at
+// capacity and ErrClosed once it has been closed.
+func (q *Queue[T]) Push(item T) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrClosed
+	}
+	select {
+	case q.items <- item:
+		return nil
+	default:
+		return ErrFull
+	}
+}
+
+// Len returns the number of items waiting for a worker
+func (q *Queue[T]) Len() int {
+	return len(q.items)
+}
+
+// Cap returns the number of items the queue holds when full
+func (q *Queue[T]) Cap() int {
+	return cap(q.items)
+}
+
+// Close stops accepting items and returns once the workers have drained the
+// queue
+func (q *Queue[T]) Close() {
+	if q.stop() {
+		<-q.stopped
+		q.cancel()
+	}
+}
+
+// CloseWithin stops accepting items and waits up to timeout for the workers
+// to drain the queue, then cancels their context and waits for them to
+// return. A zero timeout cancels them at once.
+func (q *Queue[T]) CloseWithin(timeout time.Duration) {
+	if !q.stop() {
+		return
+	}
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-q.stopped:
+		case <-timer.C:
+		}
+	}
+	q.cancel()
+	<-q.stopped
+}
+
+// stop closes the queue to new items, reporting whether it was still open
+func (q *Queue[T]) stop() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+	q.closed = true
+	close(q.items)
+	return true
+}
@@ -0,0 +1,70 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestQueue_Push(t *testing.T) {
+	release := make(chan struct{})
+	var drained atomic.Int32
+	q := New(2, 1, func(ctx context.Context, items <-chan int) {
+		<-release
+		for range items {
+			drained.Add(1)
+		}
+	})
+
+	for i := range 2 {
+		if err := q.Push(i); err != nil {
+			t.Fatalf("Push(%d) error = %v", i, err)
+		}
+	}
+	if err := q.Push(2); !errors.Is(err, ErrFull) {
+		t.Errorf("Push() on a full queue error = %v, want %v", err, ErrFull)
+	}
+	if q.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", q.Len())
+	}
+
+	close(release)
+	q.Close()
+	if drained.Load() != 2 {
+		t.Errorf("drained %d items, want 2", drained.Load())
+	}
+	if err := q.Push(3); !errors.Is(err, ErrClosed) {
+		t.Errorf("Push() after Close error = %v, want %v", err, ErrClosed)
+	}
+	q.Close()
+}
+
+func TestQueue_CloseWithin(t *testing.T) {
+	var skipped atomic.Int32
+	q := New(10, 2, func(ctx context.Context, items <-chan int) {
+		for range items {
+			if ctx.Err() != nil {
+				skipped.Add(1)
+				continue
+			}
+			<-ctx.Done()
+		}
+	})
+	for i := range 5 {
+		if err := q.Push(i); err != nil {
+			t.Fatalf("Push(%d) error = %v", i, err)
+		}
+	}
+
+	start := time.Now()
+	q.CloseWithin(20 * time.Millisecond)
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("CloseWithin() returned after %v, before its timeout", elapsed)
+	}
+	if skipped.Load() != 3 {
+		t.Errorf("skipped %d items after cancellation, want 3", skipped.Load())
+	}
+	q.CloseWithin(0)
+}
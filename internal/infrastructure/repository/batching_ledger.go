@@ -0,0 +1,274 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+	"kii.com/internal/infrastructure/logger"
+)
+
+// ErrLedgerClosed is returned by BatchingLedger.AddEntry after Close
+var ErrLedgerClosed = errors.New("ledger is closed")
+
+// pendingEntry is an AddEntry call waiting for its batch to be written
+type pendingEntry struct {
+	ctx   context.Context
+	entry entity.LedgerEntry
+	done  chan error
+}
+
+// BatchingLedger buffers AddEntry calls and writes them to the underlying
+// repository in one transaction once maxSize entries are pending or window
+// has passed since the first of them. Each AddEntry still waits for its
+// batch to be written, so callers trade up to window of latency for fewer,
+// larger writes.
+type BatchingLedger struct {
+	repo    port.BatchLedgerRepository
+	maxSize int
+	window  time.Duration
+	logger  logger.Logger
+
+	mu      sync.RWMutex
+	closed  bool
+	pending chan pendingEntry
+	stopped chan struct{}
+}
+
+// NewBatchingLedger starts batching writes to repo
+func NewBatchingLedger(repo port.BatchLedgerRepository, maxSize int, window time.Duration, logger logger.Logger) *BatchingLedger {
+	if maxSize < 1 {
+		maxSize = 1
+	}
+	l := &BatchingLedger{
+		repo:    repo,
+		maxSize: maxSize,
+		window:  window,
+		logger:  logger,
+		pending: make(chan pendingEntry, maxSize),
+		stopped: make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// AddEntry queues entry for the next batch and waits until it is written.
+// ctx bounds the wait for a place in the queue only: once queued, the entry
+// is written even if ctx is done, so AddEntry waits for the result rather
+// than report an entry that may still be applied as failed.
+func (l *BatchingLedger) AddEntry(ctx context.Context, entry entity.LedgerEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p := pendingEntry{ctx: ctx, entry: entry, done: make(chan error, 1)}
+
+	l.mu.RLock()
+	if l.closed {
+		l.mu.RUnlock()
+		return ErrLedgerClosed
+	}
+	select {
+	case l.pending <- p:
+		l.mu.RUnlock()
+	case <-ctx.Done():
+		l.mu.RUnlock()
+		return ctx.Err()
+	}
+
+	return <-p.done
+}
+
+// AddEntries writes entries in a transaction of their own, apart from the
+// batch being collected, so they are still applied all or none
+func (l *BatchingLedger) AddEntries(ctx context.Context, entries []entity.LedgerEntry) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return ErrLedgerClosed
+	}
+	return l.repo.AddEntries(ctx, entries)
+}
+
+// GetBalance returns the balance for a specific user
+func (l *BatchingLedger) GetBalance(ctx context.Context, user string) (*entity.BalanceResponse, error) {
+	return l.repo.GetBalance(ctx, user)
+}
+
+// EachEntry lists entries from the underlying repository. Entries still
+// waiting for their batch are not included.
+func (l *BatchingLedger) EachEntry(ctx context.Context, user string, after uint64, fn func(entity.LedgerEntry) error) error {
+	history, ok := l.repo.(port.LedgerHistoryRepository)
+	if !ok {
+		return entity.ErrHistoryUnsupported
+	}
+	return history.EachEntry(ctx, user, after, fn)
+}
+
+// Compact compacts the underlying repository. Entries still waiting for
+// their batch are not considered.
+func (l *BatchingLedger) Compact(ctx context.Context, idleSince time.Time, archive func(entity.ArchivedUser) error) (entity.CompactionResult, error) {
+	compactor, ok := l.repo.(port.LedgerCompactor)
+	if !ok {
+		return entity.CompactionResult{}, entity.ErrCompactionUnsupported
+	}
+	return compactor.Compact(ctx, idleSince, archive)
+}
+
+// Prune prunes the underlying repository. Entries still waiting for their
+// batch have not been applied, so they are never old enough.
+func (l *BatchingLedger) Prune(ctx context.Context, before time.Time, archive func([]entity.LedgerEntry) error) (int, error) {
+	pruner, ok := l.repo.(port.LedgerPruner)
+	if !ok {
+		return 0, entity.ErrPruningUnsupported
+	}
+	return pruner.Prune(ctx, before, archive)
+}
+
+// TopHolders ranks the holders of asset in the underlying repository.
+// Entries still waiting for their batch are not included.
+func (l *BatchingLedger) TopHolders(ctx context.Context, asset string, n int) ([]entity.Holder, error) {
+	holdings, ok := l.repo.(port.LedgerHoldingsRepository)
+	if !ok {
+		return nil, entity.ErrHoldingsUnsupported
+	}
+	return holdings.TopHolders(ctx, asset, n)
+}
+
+// BalanceDistributions returns how balances are spread in the underlying
+// repository. Entries still waiting for their batch are not included.
+func (l *BatchingLedger) BalanceDistributions(ctx context.Context, asset string) ([]entity.BalanceDistribution, error) {
+	holdings, ok := l.repo.(port.LedgerHoldingsRepository)
+	if !ok {
+		return nil, entity.ErrHoldingsUnsupported
+	}
+	return holdings.BalanceDistributions(ctx, asset)
+}
+
+// PlaceHold sets hold aside in the underlying repository. Entries still
+// waiting for their batch are not considered.
+func (l *BatchingLedger) PlaceHold(ctx context.Context, hold entity.Hold) error {
+	holds, ok := l.repo.(port.LedgerHoldRepository)
+	if !ok {
+		return entity.ErrHoldsUnsupported
+	}
+	return holds.PlaceHold(ctx, hold)
+}
+
+// ReleaseHold drops the hold id from the underlying repository
+func (l *BatchingLedger) ReleaseHold(ctx context.Context, id string) (bool, error) {
+	holds, ok := l.repo.(port.LedgerHoldRepository)
+	if !ok {
+		return false, entity.ErrHoldsUnsupported
+	}
+	return holds.ReleaseHold(ctx, id)
+}
+
+// CaptureHold applies entry and drops the hold id in the underlying
+// repository, apart from the batches of AddEntry calls
+func (l *BatchingLedger) CaptureHold(ctx context.Context, id string, entry entity.LedgerEntry) error {
+	holds, ok := l.repo.(port.LedgerHoldRepository)
+	if !ok {
+		return entity.ErrHoldsUnsupported
+	}
+	return holds.CaptureHold(ctx, id, entry)
+}
+
+// Shared reports whether the underlying repository is shared between
+// replicas. Pending entries are only buffered until their batch is written.
+func (l *BatchingLedger) Shared() bool {
+	shared, ok := l.repo.(port.SharedStore)
+	return ok && shared.Shared()
+}
+
+// EntryCount returns the number of entries in the underlying repository, or
+// -1 if it cannot report it
+func (l *BatchingLedger) EntryCount() int {
+	if counter, ok := l.repo.(interface{ EntryCount() int }); ok {
+		return counter.EntryCount()
+	}
+	return -1
+}
+
+// Close writes any pending entries and stops batching
+func (l *BatchingLedger) Close() error {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.pending)
+	}
+	l.mu.Unlock()
+
+	<-l.stopped
+	return nil
+}
+
+func (l *BatchingLedger) run() {
+	defer close(l.stopped)
+
+	batch := make([]pendingEntry, 0, l.maxSize)
+	timer := time.NewTimer(l.window)
+	timer.Stop()
+
+	for {
+		select {
+		case p, ok := <-l.pending:
+			if !ok {
+				l.flush(batch)
+				return
+			}
+			if len(batch) == 0 {
+				timer.Reset(l.window)
+			}
+			batch = append(batch, p)
+			if len(batch) < l.maxSize {
+				continue
+			}
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		l.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+// flush writes batch in one transaction. If the transaction fails, entries
+// are retried one by one so a single bad entry does not fail the others.
+func (l *BatchingLedger) flush(batch []pendingEntry) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, span := startSpan(context.Background(), "BatchingLedger.flush", attribute.Int("ledger.batch_size", len(batch)))
+	entries := make([]entity.LedgerEntry, len(batch))
+	for i, p := range batch {
+		entries[i] = p.entry
+	}
+
+	ctx, applied := port.WithAppliedEntries(ctx)
+	err := l.repo.AddEntries(ctx, entries)
+	endSpan(span, err)
+	if err == nil {
+		// Each caller learns how its own entry was numbered
+		numbered := applied.Entries()
+		for i, p := range batch {
+			if len(numbered) == len(batch) {
+				port.RecordApplied(p.ctx, numbered[i])
+			}
+			p.done <- nil
+		}
+		return
+	}
+
+	l.logger.LogWarning(ctx, "Batch write failed, retrying entries individually",
+		"entries", len(batch),
+		"error", err.Error())
+	for _, p := range batch {
+		p.done <- l.repo.AddEntry(context.WithoutCancel(p.ctx), p.entry)
+	}
+}
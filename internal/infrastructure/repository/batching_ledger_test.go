@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+	"kii.com/internal/infrastructure/logger"
+)
+
+// recordingLedger records the size of each batch written to an InMemoryLedger
+type recordingLedger struct {
+	*InMemoryLedger
+	mu      sync.Mutex
+	batches []int
+}
+
+func (r *recordingLedger) AddEntries(ctx context.Context, entries []entity.LedgerEntry) error {
+	r.mu.Lock()
+	r.batches = append(r.batches, len(entries))
+	r.mu.Unlock()
+	return r.InMemoryLedger.AddEntries(ctx, entries)
+}
+
+func TestBatchingLedger_BatchesBySize(t *testing.T) {
+	repo := &recordingLedger{InMemoryLedger: NewInMemoryLedger(logger.NewLogger()).(*InMemoryLedger)}
+	// A long window means only the size threshold can trigger a write
+	ledger := NewBatchingLedger(repo, 10, time.Hour, logger.NewLogger())
+	defer ledger.Close()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := range 30 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := ledger.AddEntry(ctx, entity.LedgerEntry{User: fmt.Sprintf("user%d", i%3), Asset: "BTC", Amount: "1"}); err != nil {
+				t.Errorf("AddEntry() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if len(repo.batches) != 3 {
+		t.Errorf("batches = %v, want 3 batches of 10", repo.batches)
+	}
+	for u := range 3 {
+		balance, _ := ledger.GetBalance(ctx, fmt.Sprintf("user%d", u))
+		if balance.Balances["BTC"] != "10.00000000" {
+			t.Errorf("user%d balance = %v, want 10.00000000", u, balance.Balances["BTC"])
+		}
+	}
+	if ledger.EntryCount() != 30 {
+		t.Errorf("EntryCount() = %d, want 30", ledger.EntryCount())
+	}
+}
+
+func TestBatchingLedger_FlushesAfterWindow(t *testing.T) {
+	repo := &recordingLedger{InMemoryLedger: NewInMemoryLedger(logger.NewLogger()).(*InMemoryLedger)}
+	ledger := NewBatchingLedger(repo, 100, 20*time.Millisecond, logger.NewLogger())
+	defer ledger.Close()
+
+	start := time.Now()
+	if err := ledger.AddEntry(context.Background(), entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"}); err != nil {
+		t.Fatalf("AddEntry() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("AddEntry() returned after %v, before the batch window", elapsed)
+	}
+}
+
+func TestBatchingLedger_RecordsApplied(t *testing.T) {
+	repo := &recordingLedger{InMemoryLedger: NewInMemoryLedger(logger.NewLogger()).(*InMemoryLedger)}
+	ledger := NewBatchingLedger(repo, 3, time.Hour, logger.NewLogger())
+	defer ledger.Close()
+
+	// Each caller of a batch learns how its own entry was numbered
+	sequences := make(chan uint64, 3)
+	var wg sync.WaitGroup
+	for i := range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, applied := port.WithAppliedEntries(context.Background())
+			user := fmt.Sprintf("user%d", i)
+			if err := ledger.AddEntry(ctx, entity.LedgerEntry{User: user, Asset: "BTC", Amount: "1"}); err != nil {
+				t.Errorf("AddEntry() error = %v", err)
+				return
+			}
+			entries := applied.Entries()
+			if len(entries) != 1 || entries[0].User != user || entries[0].Sequence == 0 {
+				t.Errorf("applied = %+v, want %s's entry numbered", entries, user)
+				return
+			}
+			sequences <- entries[0].Sequence
+		}()
+	}
+	wg.Wait()
+	close(sequences)
+
+	seen := make(map[uint64]bool)
+	for sequence := range sequences {
+		seen[sequence] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("sequences = %v, want three distinct ones", seen)
+	}
+}
+
+func TestBatchingLedger_WaitsForQueuedEntry(t *testing.T) {
+	repo := &recordingLedger{InMemoryLedger: NewInMemoryLedger(logger.NewLogger()).(*InMemoryLedger)}
+	ledger := NewBatchingLedger(repo, 100, 50*time.Millisecond, logger.NewLogger())
+	defer ledger.Close()
+
+	// The entry is queued before ctx is done, so it is written and reported
+	// as such rather than as failed
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := ledger.AddEntry(ctx, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"}); err != nil {
+		t.Fatalf("AddEntry() error = %v, want nil once queued", err)
+	}
+	if ledger.EntryCount() != 1 {
+		t.Errorf("EntryCount() = %d, want 1", ledger.EntryCount())
+	}
+}
+
+func TestBatchingLedger_InvalidEntryFailsAlone(t *testing.T) {
+	repo := &recordingLedger{InMemoryLedger: NewInMemoryLedger(logger.NewLogger()).(*InMemoryLedger)}
+	ledger := NewBatchingLedger(repo, 2, time.Hour, logger.NewLogger())
+	defer ledger.Close()
+	ctx := context.Background()
+
+	errs := make(chan error, 2)
+	go func() { errs <- ledger.AddEntry(ctx, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"}) }()
+	go func() {
+		errs <- ledger.AddEntry(ctx, entity.LedgerEntry{User: "user2", Asset: "BTC", Amount: "not-a-number"})
+	}()
+
+	var failed int
+	for range 2 {
+		if err := <-errs; err != nil {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Errorf("%d entries failed, want only the invalid one", failed)
+	}
+	if balance, _ := ledger.GetBalance(ctx, "user1"); balance.Balances["BTC"] != "1.00000000" {
+		t.Errorf("user1 balance = %v, want 1.00000000", balance.Balances["BTC"])
+	}
+}
+
+func TestBatchingLedger_Close(t *testing.T) {
+	repo := &recordingLedger{InMemoryLedger: NewInMemoryLedger(logger.NewLogger()).(*InMemoryLedger)}
+	ledger := NewBatchingLedger(repo, 100, time.Hour, logger.NewLogger())
+	ctx := context.Background()
+
+	done := make(chan error, 1)
+	go func() { done <- ledger.AddEntry(ctx, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"}) }()
+	// Let the entry reach the pending batch
+	time.Sleep(10 * time.Millisecond)
+
+	// Close writes the pending entry instead of waiting for the window
+	if err := ledger.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("pending AddEntry() error = %v", err)
+	}
+	if err := ledger.AddEntry(ctx, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"}); !errors.Is(err, ErrLedgerClosed) {
+		t.Errorf("AddEntry() after Close error = %v, want %v", err, ErrLedgerClosed)
+	}
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"kii.com/internal/domain/port"
+	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/repository/repotest"
+)
+
+func TestInMemoryLedger_Conformance(t *testing.T) {
+	repotest.RunLedgerRepositoryTests(t, func(t *testing.T) port.LedgerRepository {
+		return NewInMemoryLedger(logger.NewLogger())
+	})
+}
+
+func TestBatchingLedger_Conformance(t *testing.T) {
+	repotest.RunLedgerRepositoryTests(t, func(t *testing.T) port.LedgerRepository {
+		appLogger := logger.NewLogger()
+		ledger := NewBatchingLedger(newInMemoryLedger(appLogger, defaultLedgerShards), 8, time.Millisecond, appLogger)
+		t.Cleanup(func() { _ = ledger.Close() })
+		return ledger
+	})
+}
+
+func TestResilientLedger_Conformance(t *testing.T) {
+	repotest.RunLedgerRepositoryTests(t, func(t *testing.T) port.LedgerRepository {
+		return NewResilientLedger(NewInMemoryLedger(logger.NewLogger()), ResilientLedgerConfig{
+			MaxAttempts:      3,
+			Backoff:          time.Millisecond,
+			FailureThreshold: 5,
+			OpenTimeout:      time.Second,
+			ReadTimeout:      time.Second,
+			WriteTimeout:     time.Second,
+		}, logger.NewLogger())
+	})
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"sync"
+	"time"
+)
+
+// seenKey is a key recorded by InMemoryDuplicateStore
+type seenKey struct {
+	key string
+	at  time.Time
+}
+
+// InMemoryDuplicateStore implements the DuplicateStore port. Keys are
+// remembered for window, after which the same content counts as new.
+type InMemoryDuplicateStore struct {
+	mu     sync.Mutex
+	seen   map[string]time.Time
+	order  []seenKey
+	window time.Duration
+}
+
+// NewInMemoryDuplicateStore creates a duplicate store remembering keys for
+// window
+func NewInMemoryDuplicateStore(window time.Duration) *InMemoryDuplicateStore {
+	return &InMemoryDuplicateStore{
+		seen:   make(map[string]time.Time),
+		window: window,
+	}
+}
+
+// Record records key as seen at the given time, reporting when it was first
+// seen if that is within the window
+func (s *InMemoryDuplicateStore) Record(key string, at time.Time) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire(at)
+	if first, ok := s.seen[key]; ok {
+		return first, true
+	}
+	s.seen[key] = at
+	s.order = append(s.order, seenKey{key: key, at: at})
+	return time.Time{}, false
+}
+
+// Forget removes key, reporting whether it was recorded
+func (s *InMemoryDuplicateStore) Forget(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.seen[key]
+	delete(s.seen, key)
+	return ok
+}
+
+// Len returns the number of keys remembered
+func (s *InMemoryDuplicateStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.seen)
+}
+
+// expire drops the keys seen a window or longer before now. Keys are
+// recorded in time order, so only the oldest need to be looked at. s.mu must
+// be held.
+func (s *InMemoryDuplicateStore) expire(now time.Time) {
+	i := 0
+	for ; i < len(s.order) && now.Sub(s.order[i].at) >= s.window; i++ {
+		// A key forgotten and recorded again is kept for its new record
+		if s.seen[s.order[i].key] == s.order[i].at {
+			delete(s.seen, s.order[i].key)
+		}
+	}
+	s.order = s.order[i:]
+}
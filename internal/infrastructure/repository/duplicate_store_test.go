@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInMemoryDuplicateStore(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	store := NewInMemoryDuplicateStore(5 * time.Minute)
+
+	if _, seen := store.Record("a", now); seen {
+		t.Fatal("Record() seen = true for a new key")
+	}
+	first, seen := store.Record("a", now.Add(time.Minute))
+	if !seen || !first.Equal(now) {
+		t.Errorf("Record() = %v, %v, want the first record at %v", first, seen, now)
+	}
+	if _, seen := store.Record("b", now.Add(time.Minute)); seen {
+		t.Error("Record() seen = true for another key")
+	}
+
+	// Forgotten keys count as new
+	if !store.Forget("b") {
+		t.Error("Forget() = false for a recorded key")
+	}
+	if store.Forget("c") {
+		t.Error("Forget() = true for a key never recorded")
+	}
+	if _, seen := store.Record("b", now.Add(2*time.Minute)); seen {
+		t.Error("Record() seen = true for a forgotten key")
+	}
+
+	// Keys expire a window after they were first recorded
+	if _, seen := store.Record("a", now.Add(5*time.Minute)); seen {
+		t.Error("Record() seen = true after the window")
+	}
+	if _, seen := store.Record("b", now.Add(6*time.Minute)); !seen {
+		t.Error("Record() seen = false within the window of its second record")
+	}
+	if store.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", store.Len())
+	}
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"kii.com/internal/domain/entity"
+)
+
+// InMemoryFreezeStore implements the AssetFreezeStore port. When it has a
+// path, every change is saved there before it takes effect, so freezes
+// survive restarts and a freeze that could not be saved is not applied.
+type InMemoryFreezeStore struct {
+	mu      sync.RWMutex
+	freezes map[string]entity.AssetFreeze
+	path    string
+}
+
+// NewInMemoryFreezeStore creates a freeze store saved to path, restoring
+// the freezes saved there. A missing file is not an error, so a new
+// deployment starts with none; an empty path keeps freezes in memory only.
+func NewInMemoryFreezeStore(path string) (*InMemoryFreezeStore, error) {
+	s := &InMemoryFreezeStore{
+		freezes: make(map[string]entity.AssetFreeze),
+		path:    path,
+	}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load asset freezes: %w", err)
+	}
+	var freezes []entity.AssetFreeze
+	if err := json.Unmarshal(data, &freezes); err != nil {
+		return nil, fmt.Errorf("failed to load asset freezes from %s: %w", path, err)
+	}
+	for _, freeze := range freezes {
+		s.freezes[strings.ToLower(freeze.Asset)] = freeze
+	}
+	return s, nil
+}
+
+// Frozen returns the freeze of asset, if it is frozen
+func (s *InMemoryFreezeStore) Frozen(asset string) (entity.AssetFreeze, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	freeze, ok := s.freezes[strings.ToLower(asset)]
+	return freeze, ok
+}
+
+// Freeze freezes freeze.Asset, replacing an earlier freeze of it
+func (s *InMemoryFreezeStore) Freeze(freeze entity.AssetFreeze) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strings.ToLower(freeze.Asset)
+	previous, existed := s.freezes[key]
+	s.freezes[key] = freeze
+	if err := s.save(); err != nil {
+		if existed {
+			s.freezes[key] = previous
+		} else {
+			delete(s.freezes, key)
+		}
+		return err
+	}
+	return nil
+}
+
+// Unfreeze lets asset be processed again, reporting whether it was frozen
+func (s *InMemoryFreezeStore) Unfreeze(asset string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strings.ToLower(asset)
+	freeze, ok := s.freezes[key]
+	if !ok {
+		return false, nil
+	}
+	delete(s.freezes, key)
+	if err := s.save(); err != nil {
+		s.freezes[key] = freeze
+		return false, err
+	}
+	return true, nil
+}
+
+// List returns the frozen assets, by name
+func (s *InMemoryFreezeStore) List() []entity.AssetFreeze {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.list()
+}
+
+// list returns the frozen assets, by name. s.mu must be held.
+func (s *InMemoryFreezeStore) list() []entity.AssetFreeze {
+	freezes := make([]entity.AssetFreeze, 0, len(s.freezes))
+	for _, freeze := range s.freezes {
+		freezes = append(freezes, freeze)
+	}
+	sort.Slice(freezes, func(i, j int) bool { return freezes[i].Asset < freezes[j].Asset })
+	return freezes
+}
+
+// save writes the freezes to s.path as JSON, if set. The file is replaced
+// atomically, so a crash never leaves a partial store behind. s.mu must be
+// held.
+func (s *InMemoryFreezeStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s.list())
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save asset freezes: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save asset freezes: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save asset freezes: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to save asset freezes: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kii.com/internal/domain/entity"
+)
+
+func TestInMemoryFreezeStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "freezes.json")
+	store, err := NewInMemoryFreezeStore(path)
+	if err != nil {
+		t.Fatalf("NewInMemoryFreezeStore() error = %v", err)
+	}
+
+	frozenAt := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	for _, asset := range []string{"ETH", "BTC"} {
+		if err := store.Freeze(entity.AssetFreeze{Asset: asset, Reason: "chain halt", FrozenAt: frozenAt}); err != nil {
+			t.Fatalf("Freeze(%s) error = %v", asset, err)
+		}
+	}
+	if freeze, ok := store.Frozen("btc"); !ok || freeze.Reason != "chain halt" {
+		t.Errorf("Frozen(btc) = %+v, %v, want the BTC freeze regardless of case", freeze, ok)
+	}
+	if _, ok := store.Frozen("USDC"); ok {
+		t.Error("Frozen(USDC) = true for an asset never frozen")
+	}
+
+	if ok, err := store.Unfreeze("eth"); err != nil || !ok {
+		t.Errorf("Unfreeze(eth) = %v, %v, want true", ok, err)
+	}
+	if ok, err := store.Unfreeze("ETH"); err != nil || ok {
+		t.Errorf("second Unfreeze(ETH) = %v, %v, want false", ok, err)
+	}
+
+	// Freezes are restored from the file
+	restored, err := NewInMemoryFreezeStore(path)
+	if err != nil {
+		t.Fatalf("NewInMemoryFreezeStore() error = %v", err)
+	}
+	freezes := restored.List()
+	if len(freezes) != 1 || freezes[0].Asset != "BTC" || !freezes[0].FrozenAt.Equal(frozenAt) {
+		t.Errorf("restored freezes = %+v, want BTC only", freezes)
+	}
+}
+
+func TestInMemoryFreezeStore_SaveFails(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewInMemoryFreezeStore(filepath.Join(dir, "freezes.json"))
+	if err != nil {
+		t.Fatalf("NewInMemoryFreezeStore() error = %v", err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// A freeze that cannot be saved does not take effect
+	if err := store.Freeze(entity.AssetFreeze{Asset: "BTC"}); err == nil {
+		t.Fatal("Freeze() error = nil, want an error")
+	}
+	if _, ok := store.Frozen("BTC"); ok {
+		t.Error("Frozen(BTC) = true after a failed save")
+	}
+}
+
+func TestNewInMemoryFreezeStore_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "freezes.json")
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewInMemoryFreezeStore(path); err == nil {
+		t.Error("NewInMemoryFreezeStore() error = nil, want an error")
+	}
+}
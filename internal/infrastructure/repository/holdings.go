@@ -0,0 +1,262 @@
+package repository
+
+import (
+	"container/heap"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/shopspring/decimal"
+
+	"kii.com/internal/domain/entity"
+)
+
+// holding is a user's non-zero balance of an asset
+type holding struct {
+	user    string
+	balance decimal.Decimal
+}
+
+// ranksBefore reports whether h ranks before other: larger balances first,
+// then in user order
+func (h holding) ranksBefore(other holding) bool {
+	if c := h.balance.Cmp(other.balance); c != 0 {
+		return c > 0
+	}
+	return h.user < other.user
+}
+
+// assetHoldings indexes the non-zero balances of one asset. Balances are
+// kept as the ledger formats them, so that a write parses nothing; they are
+// only parsed when ranked or totalled.
+type assetHoldings struct {
+	mu       sync.Mutex
+	balances map[string]string
+	// decades counts the positive balances by power of ten: n counts those
+	// from 10^n up to 10^(n+1)
+	decades  map[int32]int
+	negative int
+}
+
+// holdingsIndex keeps the non-zero balances of every asset bucketed as they
+// change, so that queries do not scan the ledger. Each asset is locked on its
+// own, and holders are only ranked when asked for, so a write costs the same
+// however many holders its asset has.
+type holdingsIndex struct {
+	// mu guards assets only. Assets are never removed, so their holdings
+	// stay valid once looked up.
+	mu     sync.RWMutex
+	assets map[string]*assetHoldings
+}
+
+// newHoldingsIndex creates an empty holdings index
+func newHoldingsIndex() *holdingsIndex {
+	return &holdingsIndex{assets: make(map[string]*assetHoldings)}
+}
+
+// asset returns the holdings of asset, creating them if create is set, or
+// nil
+func (x *holdingsIndex) asset(asset string, create bool) *assetHoldings {
+	x.mu.RLock()
+	holdings := x.assets[asset]
+	x.mu.RUnlock()
+	if holdings != nil || !create {
+		return holdings
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if holdings = x.assets[asset]; holdings == nil {
+		holdings = &assetHoldings{
+			balances: make(map[string]string),
+			decades:  make(map[int32]int),
+		}
+		x.assets[asset] = holdings
+	}
+	return holdings
+}
+
+// update records user's new balance of asset, a balance formatted by the
+// ledger
+func (x *holdingsIndex) update(user, asset, balance string) {
+	zero := isZeroBalance(balance)
+	holdings := x.asset(asset, !zero)
+	if holdings == nil {
+		return
+	}
+
+	holdings.mu.Lock()
+	defer holdings.mu.Unlock()
+	oldBalance, held := holdings.balances[user]
+	if held && oldBalance == balance {
+		return
+	}
+	if held {
+		holdings.uncount(oldBalance)
+	}
+	if zero {
+		delete(holdings.balances, user)
+		return
+	}
+	holdings.balances[user] = balance
+	holdings.count(balance)
+}
+
+// count adds balance to the buckets. a.mu must be held.
+func (a *assetHoldings) count(balance string) {
+	if isNegativeBalance(balance) {
+		a.negative++
+	} else {
+		a.decades[decade(balance)]++
+	}
+}
+
+// uncount takes balance out of the buckets. a.mu must be held.
+func (a *assetHoldings) uncount(balance string) {
+	if isNegativeBalance(balance) {
+		a.negative--
+		return
+	}
+	d := decade(balance)
+	if a.decades[d]--; a.decades[d] == 0 {
+		delete(a.decades, d)
+	}
+}
+
+// isZeroBalance reports whether the formatted balance is zero
+func isZeroBalance(balance string) bool {
+	return strings.Trim(balance, "-0.") == ""
+}
+
+// isNegativeBalance reports whether the formatted, non-zero balance is
+// negative
+func isNegativeBalance(balance string) bool {
+	return strings.HasPrefix(balance, "-")
+}
+
+// decade returns the power of ten the formatted, positive balance is in,
+// e.g. -1 for 0.5 and 2 for 250
+func decade(balance string) int32 {
+	whole, fraction, _ := strings.Cut(balance, ".")
+	if whole != "0" {
+		return int32(len(whole)) - 1
+	}
+	return -int32(strings.IndexFunc(fraction, func(r rune) bool { return r != '0' })) - 1
+}
+
+// top returns up to n users with a positive balance of asset, in rank order.
+// They are ranked now, keeping only the best n while the balances are
+// scanned.
+func (x *holdingsIndex) top(asset string, n int) []entity.Holder {
+	holders := []entity.Holder{}
+	holdings := x.asset(asset, false)
+	if holdings == nil || n <= 0 {
+		return holders
+	}
+
+	// best is a heap of the best balances so far, the worst of them on top
+	best := &rankHeap{}
+	holdings.mu.Lock()
+	for user, balance := range holdings.balances {
+		if isNegativeBalance(balance) {
+			continue
+		}
+		amount, _ := parseAmount(balance)
+		h := holding{user: user, balance: amount}
+		switch {
+		case best.Len() < n:
+			heap.Push(best, h)
+		case h.ranksBefore((*best)[0]):
+			(*best)[0] = h
+			heap.Fix(best, 0)
+		}
+	}
+	holdings.mu.Unlock()
+
+	ranked := make([]holding, best.Len())
+	for i := len(ranked) - 1; i >= 0; i-- {
+		ranked[i] = heap.Pop(best).(holding)
+	}
+	for _, h := range ranked {
+		holders = append(holders, entity.Holder{User: h.user, Balance: h.balance.StringFixed(8)})
+	}
+	return holders
+}
+
+// rankHeap is a heap of holdings with the lowest ranked on top
+type rankHeap []holding
+
+func (h rankHeap) Len() int           { return len(h) }
+func (h rankHeap) Less(i, j int) bool { return h[j].ranksBefore(h[i]) }
+func (h rankHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *rankHeap) Push(x any)        { *h = append(*h, x.(holding)) }
+func (h *rankHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// distributions returns the distribution of asset's balances, or of every
+// asset's when asset is empty, in asset order. Assets without holders are
+// left out.
+func (x *holdingsIndex) distributions(asset string) []entity.BalanceDistribution {
+	x.mu.RLock()
+	assets := slices.Sorted(maps.Keys(x.assets))
+	if asset != "" {
+		assets = nil
+		if x.assets[asset] != nil {
+			assets = []string{asset}
+		}
+	}
+	x.mu.RUnlock()
+
+	distributions := make([]entity.BalanceDistribution, 0, len(assets))
+	for _, name := range assets {
+		if distribution, ok := x.asset(name, false).distribution(name); ok {
+			distributions = append(distributions, distribution)
+		}
+	}
+	return distributions
+}
+
+// distribution describes the balances in a as those of asset, reporting
+// false if there are none
+func (a *assetHoldings) distribution(asset string) (entity.BalanceDistribution, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.balances) == 0 {
+		return entity.BalanceDistribution{}, false
+	}
+	total := decimal.Zero
+	for _, balance := range a.balances {
+		amount, _ := parseAmount(balance)
+		total = total.Add(amount)
+	}
+	buckets := make([]entity.BalanceBucket, 0, len(a.decades)+1)
+	if a.negative > 0 {
+		buckets = append(buckets, entity.BalanceBucket{Max: "0", Count: a.negative})
+	}
+	for _, d := range slices.Sorted(maps.Keys(a.decades)) {
+		buckets = append(buckets, entity.BalanceBucket{
+			Min:   powerOfTen(d),
+			Max:   powerOfTen(d + 1),
+			Count: a.decades[d],
+		})
+	}
+	return entity.BalanceDistribution{
+		Asset:   asset,
+		Holders: len(a.balances),
+		Total:   total.StringFixed(8),
+		Buckets: buckets,
+	}, true
+}
+
+// powerOfTen formats 10^exp without exponent notation
+func powerOfTen(exp int32) string {
+	if exp >= 0 {
+		return "1" + strings.Repeat("0", int(exp))
+	}
+	return "0." + strings.Repeat("0", int(-exp)-1) + "1"
+}
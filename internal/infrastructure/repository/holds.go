@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/attribute"
+
+	"kii.com/internal/domain/entity"
+)
+
+// PlaceHold sets hold aside for its user, replacing a hold with the same ID.
+// The user's expired holds are dropped on the way.
+func (l *InMemoryLedger) PlaceHold(ctx context.Context, hold entity.Hold) (err error) {
+	ctx, span := startSpan(ctx, "InMemoryLedger.PlaceHold",
+		attribute.String("ledger.user", hold.User),
+		attribute.String("ledger.asset", hold.Asset))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	amount, err := parseAmount(hold.Amount)
+	if err != nil {
+		return entity.ErrInvalidAmount.Wrap(err)
+	}
+	if !amount.IsPositive() {
+		return entity.ErrInvalidAmount.WithDetail("hold amount %s is not positive", hold.Amount)
+	}
+	// A hold moving to another user leaves the old one's shard first
+	if user, ok := l.holdUsers.Load(hold.ID); ok && user != hold.User {
+		if _, err := l.ReleaseHold(ctx, hold.ID); err != nil {
+			return err
+		}
+	}
+
+	shard := l.shard(hold.User)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.dropExpiredUserHolds(shard, hold.User, l.now())
+	if shard.holds[hold.User] == nil {
+		shard.holds[hold.User] = make(map[string]entity.Hold)
+	}
+	shard.holds[hold.User][hold.ID] = hold
+	l.holdUsers.Store(hold.ID, hold.User)
+
+	l.logger.LogInfo(ctx, "Hold placed",
+		"hold_id", hold.ID,
+		"user", hold.User,
+		"asset", hold.Asset,
+		"amount", hold.Amount)
+	return nil
+}
+
+// ReleaseHold drops the hold id, reporting whether it was held and had not
+// expired
+func (l *InMemoryLedger) ReleaseHold(ctx context.Context, id string) (released bool, err error) {
+	ctx, span := startSpan(ctx, "InMemoryLedger.ReleaseHold", attribute.String("ledger.hold_id", id))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	user, ok := l.holdUsers.Load(id)
+	if !ok {
+		return false, ctx.Err()
+	}
+	shard := l.shard(user.(string))
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	hold, ok := l.dropHold(shard, user.(string), id)
+	if !ok || hold.Expired(l.now()) {
+		return false, nil
+	}
+	l.logger.LogInfo(ctx, "Hold released", "hold_id", id, "user", hold.User)
+	return true, nil
+}
+
+// CaptureHold applies entry and drops the hold id with the shard of the
+// entry's user locked, so no balance read sees both or neither
+func (l *InMemoryLedger) CaptureHold(ctx context.Context, id string, entry entity.LedgerEntry) (err error) {
+	ctx, span := startSpan(ctx, "InMemoryLedger.CaptureHold",
+		attribute.String("ledger.hold_id", id),
+		attribute.String("ledger.user", entry.User),
+		attribute.String("ledger.asset", entry.Asset))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	shard := l.shard(entry.User)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if user, ok := l.holdUsers.Load(id); ok && user != entry.User {
+		return fmt.Errorf("hold %s is not for user %s", id, entry.User)
+	}
+	if err := l.applyEntry(ctx, shard, entry); err != nil {
+		return err
+	}
+	l.dropHold(shard, entry.User, id)
+	return nil
+}
+
+// dropHold removes the hold id of user from shard, which must be locked,
+// and returns it
+func (l *InMemoryLedger) dropHold(shard *ledgerShard, user, id string) (entity.Hold, bool) {
+	hold, ok := shard.holds[user][id]
+	if !ok {
+		return entity.Hold{}, false
+	}
+	delete(shard.holds[user], id)
+	if len(shard.holds[user]) == 0 {
+		delete(shard.holds, user)
+	}
+	l.holdUsers.Delete(id)
+	return hold, true
+}
+
+// dropExpiredUserHolds removes the holds of user that expired at now from
+// shard, which must be locked
+func (l *InMemoryLedger) dropExpiredUserHolds(shard *ledgerShard, user string, now time.Time) {
+	for id, hold := range shard.holds[user] {
+		if hold.Expired(now) {
+			l.dropHold(shard, user, id)
+		}
+	}
+}
+
+// dropExpiredHolds removes every expired hold from shard
+func (l *InMemoryLedger) dropExpiredHolds(shard *ledgerShard) {
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	now := l.now()
+	for user := range shard.holds {
+		l.dropExpiredUserHolds(shard, user, now)
+	}
+}
+
+// addHolds sets the held and available amounts of balance from the holds of
+// its user that have not expired at now. Balances without holds are left as
+// they are.
+func addHolds(balance *entity.BalanceResponse, holds map[string]entity.Hold, now time.Time) {
+	held := make(map[string]decimal.Decimal)
+	for _, hold := range holds {
+		if hold.Expired(now) {
+			continue
+		}
+		// Amounts were checked when the hold was placed
+		amount, _ := parseAmount(hold.Amount)
+		held[hold.Asset] = held[hold.Asset].Add(amount)
+	}
+	if len(held) == 0 {
+		return
+	}
+
+	balance.Held = make(map[string]string, len(held))
+	for asset, amount := range held {
+		balance.Held[asset] = amount.StringFixed(8)
+	}
+	balance.Available = availableBalances(balance.Balances, balance.Held)
+}
+
+// availableBalances returns what is left of each total once held is set
+// aside, for every asset either has an amount of
+func availableBalances(totals, held map[string]string) map[string]string {
+	available := make(map[string]string, len(totals))
+	for asset, total := range totals {
+		amount, _ := parseAmount(total)
+		heldAmount, _ := parseAmount(held[asset])
+		available[asset] = amount.Sub(heldAmount).StringFixed(8)
+	}
+	for asset, amount := range held {
+		if _, ok := available[asset]; !ok {
+			heldAmount, _ := parseAmount(amount)
+			available[asset] = heldAmount.Neg().StringFixed(8)
+		}
+	}
+	return available
+}
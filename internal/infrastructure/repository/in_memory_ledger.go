@@ -3,44 +3,151 @@ package repository
 import (
 	"context"
 	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/attribute"
 
 	"kii.com/internal/domain/entity"
 	"kii.com/internal/domain/port"
 	"kii.com/internal/infrastructure/logger"
 )
 
-// InMemoryLedger implements the LedgerRepository port
+// defaultLedgerShards is the number of lock shards used by NewInMemoryLedger
+const defaultLedgerShards = 64
+
+// eachEntryCheckEvery is how many entries EachEntry lists between checks for
+// a cancelled context
+const eachEntryCheckEvery = 256
+
+// ledgerShard holds the balances and audit trail for the users hashed to it.
+// Entries are appended in sequence and time order and never changed
+// afterwards.
+type ledgerShard struct {
+	mu        sync.RWMutex
+	balances  map[string]map[string]string
+	entries   []entity.LedgerEntry
+	positions map[string]userPosition
+	// holds are the users' holds by ID; expired ones are dropped as the
+	// user's holds change and on compaction
+	holds map[string]map[string]entity.Hold
+}
+
+// userPosition is the sequence and time of a user's last entry and their
+// entry count
+type userPosition struct {
+	sequence     uint64
+	count        uint64
+	lastActivity time.Time
+}
+
+// appendEntry adds entry to the audit trail as number sequence of the
+// ledger, applied at now, and returns it as added
+func (s *ledgerShard) appendEntry(entry entity.LedgerEntry, sequence uint64, now time.Time) entity.LedgerEntry {
+	position := s.positions[entry.User]
+	position.sequence = sequence
+	position.count++
+	position.lastActivity = now
+	s.positions[entry.User] = position
+
+	entry.Sequence = sequence
+	entry.UserSequence = position.count
+	entry.AppliedAt = now
+	s.entries = append(s.entries, entry)
+	return entry
+}
+
+// InMemoryLedger implements the LedgerRepository port. Users are spread over
+// independently locked shards so webhooks for different users do not
+// serialize on a single lock.
 type InMemoryLedger struct {
-	mu       sync.RWMutex
-	balances map[string]map[string]string 
-	entries  []entity.LedgerEntry         
-	logger   logger.Logger
+	shards []*ledgerShard
+	logger logger.Logger
+	// holdings indexes the balances by asset. It is updated with the shard
+	// holding the user locked, so its lock is only ever taken after theirs.
+	holdings *holdingsIndex
+	// sequence numbers the applied entries across all shards
+	sequence atomic.Uint64
+	// holdUsers maps the ID of each hold to its user. It is updated with the
+	// shard holding the user locked.
+	holdUsers sync.Map
+	// now returns the time entries are applied at
+	now func() time.Time
 }
 
 // NewInMemoryLedger creates a new in-memory ledger
 func NewInMemoryLedger(logger logger.Logger) port.LedgerRepository {
+	return newInMemoryLedger(logger, defaultLedgerShards)
+}
+
+// newInMemoryLedger creates an in-memory ledger with the given number of shards
+func newInMemoryLedger(logger logger.Logger, shardCount int) *InMemoryLedger {
+	shards := make([]*ledgerShard, shardCount)
+	for i := range shards {
+		shards[i] = &ledgerShard{
+			balances:  make(map[string]map[string]string),
+			entries:   make([]entity.LedgerEntry, 0),
+			positions: make(map[string]userPosition),
+			holds:     make(map[string]map[string]entity.Hold),
+		}
+	}
 	return &InMemoryLedger{
-		balances: make(map[string]map[string]string),
-		entries:  make([]entity.LedgerEntry, 0),
+		shards:   shards,
 		logger:   logger,
+		holdings: newHoldingsIndex(),
+		now:      time.Now,
 	}
 }
 
+// shard returns the shard that owns user
+func (l *InMemoryLedger) shard(user string) *ledgerShard {
+	return l.shards[l.shardIndex(user)]
+}
+
+// shardIndex returns the index of the shard that owns user
+func (l *InMemoryLedger) shardIndex(user string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(user))
+	return int(h.Sum32() % uint32(len(l.shards)))
+}
+
 // AddEntry adds a ledger entry and updates the balance
-func (l *InMemoryLedger) AddEntry(ctx context.Context, entry entity.LedgerEntry) error {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+func (l *InMemoryLedger) AddEntry(ctx context.Context, entry entity.LedgerEntry) (err error) {
+	ctx, span := startSpan(ctx, "InMemoryLedger.AddEntry",
+		attribute.String("ledger.user", entry.User),
+		attribute.String("ledger.asset", entry.Asset))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	shard := l.shard(entry.User)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
+	// Nothing is applied once the caller has given up, e.g. while waiting
+	// for the lock
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return l.applyEntry(ctx, shard, entry)
+}
+
+// applyEntry adds entry to shard, which must be locked and own its user
+func (l *InMemoryLedger) applyEntry(ctx context.Context, shard *ledgerShard, entry entity.LedgerEntry) error {
 	// Initialize user balance map if it doesn't exist
-	if l.balances[entry.User] == nil {
-		l.balances[entry.User] = make(map[string]string)
+	if shard.balances[entry.User] == nil {
+		shard.balances[entry.User] = make(map[string]string)
 	}
 
 	// Get current balance (default to "0")
-	currentBalance := l.balances[entry.User][entry.Asset]
+	currentBalance := shard.balances[entry.User][entry.Asset]
 	if currentBalance == "" {
 		currentBalance = "0"
 	}
@@ -53,14 +160,15 @@ func (l *InMemoryLedger) AddEntry(ctx context.Context, entry entity.LedgerEntry)
 			"asset", entry.Asset,
 			"current", currentBalance,
 			"amount", entry.Amount)
-		return fmt.Errorf("invalid amount format: %w", err)
+		return entity.ErrInvalidAmount.Wrap(err)
 	}
 
 	// Update balance
-	l.balances[entry.User][entry.Asset] = newBalance
+	shard.balances[entry.User][entry.Asset] = newBalance
+	l.holdings.update(entry.User, entry.Asset, newBalance)
 
 	// Add to audit trail
-	l.entries = append(l.entries, entry)
+	port.RecordApplied(ctx, shard.appendEntry(entry, l.sequence.Add(1), l.now()))
 
 	l.logger.LogInfo(ctx, "Balance updated",
 		"user", entry.User,
@@ -71,12 +179,86 @@ func (l *InMemoryLedger) AddEntry(ctx context.Context, entry entity.LedgerEntry)
 	return nil
 }
 
+// AddEntries applies entries atomically: if any amount is invalid, no
+// balance is changed
+func (l *InMemoryLedger) AddEntries(ctx context.Context, entries []entity.LedgerEntry) (err error) {
+	ctx, span := startSpan(ctx, "InMemoryLedger.AddEntries", attribute.Int("ledger.batch_size", len(entries)))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	// Lock every shard involved in shard order, so concurrent batches
+	// cannot deadlock
+	locked := make([]bool, len(l.shards))
+	for _, entry := range entries {
+		locked[l.shardIndex(entry.User)] = true
+	}
+	for i, shard := range l.shards {
+		if locked[i] {
+			shard.mu.Lock()
+			defer shard.mu.Unlock()
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Compute every new balance before applying any of them
+	type update struct {
+		entry   entity.LedgerEntry
+		balance string
+	}
+	pending := make(map[[2]string]string, len(entries))
+	updates := make([]update, 0, len(entries))
+	for _, entry := range entries {
+		key := [2]string{entry.User, entry.Asset}
+		currentBalance, ok := pending[key]
+		if !ok {
+			currentBalance = l.shard(entry.User).balances[entry.User][entry.Asset]
+		}
+		newBalance, err := addDecimalStrings(currentBalance, entry.Amount)
+		if err != nil {
+			l.logger.LogError(ctx, "Failed to add balance", err,
+				"user", entry.User,
+				"asset", entry.Asset,
+				"amount", entry.Amount)
+			return entity.ErrInvalidAmount.Wrap(err)
+		}
+		pending[key] = newBalance
+		updates = append(updates, update{entry: entry, balance: newBalance})
+	}
+
+	now := l.now()
+	applied := make([]entity.LedgerEntry, 0, len(updates))
+	for _, u := range updates {
+		shard := l.shard(u.entry.User)
+		if shard.balances[u.entry.User] == nil {
+			shard.balances[u.entry.User] = make(map[string]string)
+		}
+		shard.balances[u.entry.User][u.entry.Asset] = u.balance
+		l.holdings.update(u.entry.User, u.entry.Asset, u.balance)
+		applied = append(applied, shard.appendEntry(u.entry, l.sequence.Add(1), now))
+	}
+	port.RecordApplied(ctx, applied...)
+
+	l.logger.LogInfo(ctx, "Balances updated in batch", "entries", len(entries))
+
+	return nil
+}
+
 // GetBalance returns the balance for a specific user
 func (l *InMemoryLedger) GetBalance(ctx context.Context, user string) (*entity.BalanceResponse, error) {
-	l.mu.RLock()
-	defer l.mu.RUnlock()
+	ctx, span := startSpan(ctx, "InMemoryLedger.GetBalance", attribute.String("ledger.user", user))
+	defer span.End()
+
+	shard := l.shard(user)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	userBalances := l.balances[user]
+	userBalances := shard.balances[user]
 	if userBalances == nil {
 		userBalances = make(map[string]string)
 	}
@@ -87,33 +269,308 @@ func (l *InMemoryLedger) GetBalance(ctx context.Context, user string) (*entity.B
 		balancesCopy[asset] = balance
 	}
 
-	return &entity.BalanceResponse{
+	l.logger.LogDebug(ctx, "Balance read",
+		"user", user,
+		"assets", len(balancesCopy))
+
+	balance := &entity.BalanceResponse{
 		User:     user,
 		Balances: balancesCopy,
-	}, nil
+		Sequence: shard.positions[user].sequence,
+	}
+	addHolds(balance, shard.holds[user], l.now())
+	return balance, nil
 }
 
-// addDecimalStrings adds two decimal strings while maintaining precision
-// using the shopspring/decimal library to avoid floating point rounding issues.
-func addDecimalStrings(a, b string) (string, error) {
-	if a == "" {
-		a = "0"
+// EachEntry calls fn for each entry of user with a sequence above after, or
+// for every such entry when user is empty, in sequence order. The entries are
+// listed from a snapshot taken with every shard involved read-locked at once,
+// so an entry is never listed before one numbered lower that is still being
+// applied; fn runs without holding any lock.
+func (l *InMemoryLedger) EachEntry(ctx context.Context, user string, after uint64, fn func(entity.LedgerEntry) error) (err error) {
+	ctx, span := startSpan(ctx, "InMemoryLedger.EachEntry", attribute.String("ledger.user", user))
+	defer func() {
+		endSpan(span, err)
+	}()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	shards := l.shards
+	if user != "" {
+		shards = []*ledgerShard{l.shard(user)}
+	}
+
+	// Entries are never changed once appended, so the snapshot shares the
+	// shards' arrays, capped so later appends cannot show through
+	for _, shard := range shards {
+		shard.mu.RLock()
+	}
+	snapshot := make([][]entity.LedgerEntry, 0, len(shards))
+	for _, shard := range shards {
+		entries := shard.entries
+		start := sort.Search(len(entries), func(i int) bool { return entries[i].Sequence > after })
+		if start < len(entries) {
+			snapshot = append(snapshot, entries[start:len(entries):len(entries)])
+		}
+	}
+	for _, shard := range shards {
+		shard.mu.RUnlock()
+	}
+
+	// Merge the shards' entries, each already in sequence order
+	for listed := 1; ; listed++ {
+		next := -1
+		for i, entries := range snapshot {
+			if len(entries) > 0 && (next < 0 || entries[0].Sequence < snapshot[next][0].Sequence) {
+				next = i
+			}
+		}
+		if next < 0 {
+			return nil
+		}
+		entry := snapshot[next][0]
+		snapshot[next] = snapshot[next][1:]
+
+		if user != "" && entry.User != user {
+			continue
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+		if listed%eachEntryCheckEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
 	}
-	if b == "" {
-		b = "0"
+}
+
+// Compact removes zero balances, and archives the users without entries
+// since idleSince, dropping their entries from the audit trail. Users left
+// without balances are removed altogether, so a returning user's
+// UserSequence starts over, and expired holds are dropped. Shards are
+// compacted one at a time.
+func (l *InMemoryLedger) Compact(ctx context.Context, idleSince time.Time, archive func(entity.ArchivedUser) error) (result entity.CompactionResult, err error) {
+	ctx, span := startSpan(ctx, "InMemoryLedger.Compact")
+	defer func() {
+		span.SetAttributes(
+			attribute.Int("ledger.zero_balances", result.ZeroBalances),
+			attribute.Int("ledger.archived_users", result.ArchivedUsers))
+		endSpan(span, err)
+	}()
+
+	for _, shard := range l.shards {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		l.dropExpiredHolds(shard)
+		if err := shard.compact(idleSince, archive, &result); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// compact compacts the shard, adding what it removed to result
+func (s *ledgerShard) compact(idleSince time.Time, archive func(entity.ArchivedUser) error, result *entity.CompactionResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for user, balances := range s.balances {
+		for asset, balance := range balances {
+			if amount, err := parseAmount(balance); err == nil && amount.IsZero() {
+				delete(balances, asset)
+				result.ZeroBalances++
+			}
+		}
+		if len(balances) == 0 {
+			delete(s.balances, user)
+		}
+	}
+
+	if idleSince.IsZero() {
+		return nil
+	}
+	idle := make(map[string]*entity.ArchivedUser)
+	for user, position := range s.positions {
+		if position.lastActivity.Before(idleSince) {
+			idle[user] = &entity.ArchivedUser{User: user, LastActivity: position.lastActivity}
+		}
+	}
+	if len(idle) == 0 {
+		return nil
+	}
+	for _, entry := range s.entries {
+		if archived := idle[entry.User]; archived != nil {
+			archived.Entries = append(archived.Entries, entry)
+		}
+	}
+
+	// Only users whose archive succeeded are dropped, in a stable order so
+	// a failing archive is retried from the same user
+	users := make([]string, 0, len(idle))
+	for user := range idle {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	dropped := make(map[string]bool, len(users))
+	var archiveErr error
+	for _, user := range users {
+		archived := idle[user]
+		if len(archived.Entries) > 0 {
+			if balances := s.balances[user]; len(balances) > 0 {
+				archived.Balances = maps.Clone(balances)
+			}
+			if archiveErr = archive(*archived); archiveErr != nil {
+				break
+			}
+			result.ArchivedUsers++
+			result.ArchivedEntries += len(archived.Entries)
+		}
+		dropped[user] = true
+		if len(s.balances[user]) == 0 {
+			delete(s.positions, user)
+			result.RemovedUsers++
+		}
 	}
 
-	aDec, err := decimal.NewFromString(a)
+	// EachEntry snapshots may still share the old array, so the remaining
+	// entries are copied to a new one
+	entries := make([]entity.LedgerEntry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		if !dropped[entry.User] {
+			entries = append(entries, entry)
+		}
+	}
+	s.entries = entries
+	return archiveErr
+}
+
+// Prune moves the entries applied before before to archive. They are
+// snapshotted like EachEntry and archived without holding any lock; only
+// then is each shard locked in turn to drop them, so webhooks keep being
+// applied while the archive is written.
+func (l *InMemoryLedger) Prune(ctx context.Context, before time.Time, archive func([]entity.LedgerEntry) error) (pruned int, err error) {
+	ctx, span := startSpan(ctx, "InMemoryLedger.Prune")
+	defer func() {
+		span.SetAttributes(attribute.Int("ledger.pruned_entries", pruned))
+		endSpan(span, err)
+	}()
+
+	// Entries are appended in time order, so the old ones are a prefix of
+	// each shard's; cutoffs keeps the sequence of the last one per shard
+	for _, shard := range l.shards {
+		shard.mu.RLock()
+	}
+	cutoffs := make([]uint64, len(l.shards))
+	var old []entity.LedgerEntry
+	for i, shard := range l.shards {
+		entries := shard.entries
+		n := sort.Search(len(entries), func(j int) bool { return !entries[j].AppliedAt.Before(before) })
+		if n > 0 {
+			old = append(old, entries[:n]...)
+			cutoffs[i] = entries[n-1].Sequence
+		}
+	}
+	for _, shard := range l.shards {
+		shard.mu.RUnlock()
+	}
+	if len(old) == 0 {
+		return 0, nil
+	}
+	sort.Slice(old, func(i, j int) bool { return old[i].Sequence < old[j].Sequence })
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if err := archive(old); err != nil {
+		return 0, err
+	}
+
+	// Entries only ever leave a shard, so the ones up to its cutoff are
+	// still the archived ones; they are copied out of the old array so its
+	// memory is freed once no EachEntry snapshot shares it
+	for i, shard := range l.shards {
+		if cutoffs[i] == 0 {
+			continue
+		}
+		shard.mu.Lock()
+		entries := shard.entries
+		n := sort.Search(len(entries), func(j int) bool { return entries[j].Sequence > cutoffs[i] })
+		shard.entries = slices.Clone(entries[n:])
+		shard.mu.Unlock()
+	}
+	return len(old), nil
+}
+
+// TopHolders returns up to n users with a positive balance of asset,
+// largest first. Balances are indexed by asset as they change, so this does
+// not read the shards; only the balances of asset are ranked.
+func (l *InMemoryLedger) TopHolders(ctx context.Context, asset string, n int) ([]entity.Holder, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.holdings.top(asset, n), nil
+}
+
+// BalanceDistributions returns how the balances of asset, or of every asset
+// when it is empty, are spread over powers of ten
+func (l *InMemoryLedger) BalanceDistributions(ctx context.Context, asset string) ([]entity.BalanceDistribution, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.holdings.distributions(asset), nil
+}
+
+// EntryCount returns the number of entries in the audit trail
+func (l *InMemoryLedger) EntryCount() int {
+	count := 0
+	for _, shard := range l.shards {
+		shard.mu.RLock()
+		count += len(shard.entries)
+		shard.mu.RUnlock()
+	}
+	return count
+}
+
+// maxAmountDigits bounds the digits before and after the decimal point of an
+// amount
+const maxAmountDigits = entity.MaxAmountDigits
+
+// addDecimalStrings adds two decimal strings while maintaining precision
+// using the shopspring/decimal library to avoid floating point rounding issues.
+func addDecimalStrings(a, b string) (string, error) {
+	aDec, err := parseAmount(a)
 	if err != nil {
-		return "", fmt.Errorf("invalid decimal string: %s", a)
+		return "", err
 	}
 
-	bDec, err := decimal.NewFromString(b)
+	bDec, err := parseAmount(b)
 	if err != nil {
-		return "", fmt.Errorf("invalid decimal string: %s", b)
+		return "", err
 	}
 
 	result := aDec.Add(bDec)
 
 	return result.StringFixed(8), nil
 }
+
+// parseAmount parses a decimal string, treating "" as zero
+func parseAmount(s string) (decimal.Decimal, error) {
+	if s == "" {
+		return decimal.Zero, nil
+	}
+
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("invalid decimal string: %s", s)
+	}
+	if d.IsZero() {
+		return decimal.Zero, nil
+	}
+	if exp := d.Exponent(); exp < -maxAmountDigits || int64(d.NumDigits())+int64(exp) > maxAmountDigits {
+		return decimal.Zero, fmt.Errorf("decimal string out of range: %s", s)
+	}
+	return d, nil
+}
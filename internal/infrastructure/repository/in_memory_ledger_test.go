@@ -2,7 +2,17 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
 
 	"kii.com/internal/domain/entity"
 	"kii.com/internal/infrastructure/logger"
@@ -109,6 +119,15 @@ func TestInMemoryLedger_AddEntry(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "amount exponent out of range",
+			entry: entity.LedgerEntry{
+				User:   "user1",
+				Asset:  "BTC",
+				Amount: "1e999999999",
+			},
+			wantErr: true,
+		},
 		{
 			name: "negative amount",
 			entry: entity.LedgerEntry{
@@ -190,6 +209,44 @@ func TestInMemoryLedger_GetBalance(t *testing.T) {
 	}
 }
 
+func TestInMemoryLedger_Sequence(t *testing.T) {
+	ledger := NewInMemoryLedger(logger.NewLogger()).(*InMemoryLedger)
+	ctx := context.Background()
+	sequence := func(user string) uint64 {
+		balance, err := ledger.GetBalance(ctx, user)
+		if err != nil {
+			t.Fatalf("GetBalance(%s) error = %v", user, err)
+		}
+		return balance.Sequence
+	}
+
+	if got := sequence("user1"); got != 0 {
+		t.Errorf("sequence without entries = %d, want 0", got)
+	}
+	_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"})
+	first := sequence("user1")
+	if first == 0 {
+		t.Fatal("sequence after an entry = 0, want it set")
+	}
+
+	// Entries of other users leave the sequence unchanged
+	_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: "user2", Asset: "BTC", Amount: "1"})
+	if got := sequence("user1"); got != first {
+		t.Errorf("sequence after another user's entry = %d, want %d", got, first)
+	}
+
+	// Rejected entries leave it unchanged too
+	_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "bogus"})
+	if got := sequence("user1"); got != first {
+		t.Errorf("sequence after a rejected entry = %d, want %d", got, first)
+	}
+
+	_ = ledger.AddEntries(ctx, []entity.LedgerEntry{{User: "user1", Asset: "ETH", Amount: "2"}})
+	if got := sequence("user1"); got <= first {
+		t.Errorf("sequence after a batch = %d, want above %d", got, first)
+	}
+}
+
 func TestInMemoryLedger_DecimalPrecision(t *testing.T) {
 	logger := logger.NewLogger()
 	ledger := NewInMemoryLedger(logger).(*InMemoryLedger)
@@ -285,3 +342,492 @@ func TestInMemoryLedger_ConcurrentAccess(t *testing.T) {
 		t.Errorf("Balance = %v, want %v", balance.Balances["BTC"], expected)
 	}
 }
+
+func TestInMemoryLedger_ConcurrentUsers(t *testing.T) {
+	ledger := NewInMemoryLedger(logger.NewLogger()).(*InMemoryLedger)
+	ctx := context.Background()
+
+	const users, perUser = 50, 20
+	var wg sync.WaitGroup
+	for u := 0; u < users; u++ {
+		for i := 0; i < perUser; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: fmt.Sprintf("user%d", u), Asset: "BTC", Amount: "0.5"})
+			}()
+		}
+	}
+	wg.Wait()
+
+	for u := 0; u < users; u++ {
+		balance, err := ledger.GetBalance(ctx, fmt.Sprintf("user%d", u))
+		if err != nil {
+			t.Fatalf("GetBalance() error = %v", err)
+		}
+		if balance.Balances["BTC"] != "10.00000000" {
+			t.Errorf("user%d balance = %v, want 10.00000000", u, balance.Balances["BTC"])
+		}
+	}
+	if got := ledger.EntryCount(); got != users*perUser {
+		t.Errorf("EntryCount() = %v, want %v", got, users*perUser)
+	}
+}
+
+// BenchmarkInMemoryLedger_AddEntry compares a single global lock (one shard)
+// with the default sharding for parallel webhooks spread over many users:
+//
+//	go test ./internal/infrastructure/repository -bench AddEntry -cpu 1,4,8
+func BenchmarkInMemoryLedger_AddEntry(b *testing.B) {
+	quietLevel := new(slog.LevelVar)
+	quietLevel.Set(slog.LevelError)
+	quietLogger := logger.NewLoggerWithLevel(quietLevel)
+
+	users := make([]string, 1000)
+	for i := range users {
+		users[i] = fmt.Sprintf("user%d", i)
+	}
+
+	for _, bm := range []struct {
+		name   string
+		shards int
+	}{
+		{name: "global lock", shards: 1},
+		{name: "sharded", shards: defaultLedgerShards},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			ledger := newInMemoryLedger(quietLogger, bm.shards)
+			ctx := context.Background()
+			var next atomic.Uint64
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					user := users[next.Add(1)%uint64(len(users))]
+					_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: user, Asset: "BTC", Amount: "0.00000001"})
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkInMemoryLedger_Workload measures AddEntry on the default ledger
+// for one hot user that every webhook credits, and for many distinct users
+func BenchmarkInMemoryLedger_Workload(b *testing.B) {
+	quietLevel := new(slog.LevelVar)
+	quietLevel.Set(slog.LevelError)
+	quietLogger := logger.NewLoggerWithLevel(quietLevel)
+
+	for _, bm := range []struct {
+		name  string
+		users int
+	}{
+		{name: "hot key", users: 1},
+		{name: "many users", users: 100_000},
+	} {
+		users := make([]string, bm.users)
+		for i := range users {
+			users[i] = fmt.Sprintf("user%d", i)
+		}
+
+		b.Run(bm.name, func(b *testing.B) {
+			ledger := newInMemoryLedger(quietLogger, defaultLedgerShards)
+			ctx := context.Background()
+			var next atomic.Uint64
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					user := users[next.Add(1)%uint64(len(users))]
+					_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: user, Asset: "BTC", Amount: "0.00000001"})
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkInMemoryLedger_GetBalance(b *testing.B) {
+	quietLevel := new(slog.LevelVar)
+	quietLevel.Set(slog.LevelError)
+	ledger := newInMemoryLedger(logger.NewLoggerWithLevel(quietLevel), defaultLedgerShards)
+	ctx := context.Background()
+	for _, asset := range []string{"BTC", "ETH", "USDT"} {
+		_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: "user1", Asset: asset, Amount: "1.5"})
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		_, _ = ledger.GetBalance(ctx, "user1")
+	}
+}
+
+func TestInMemoryLedger_AddEntries(t *testing.T) {
+	ledger := NewInMemoryLedger(logger.NewLogger()).(*InMemoryLedger)
+	ctx := context.Background()
+
+	err := ledger.AddEntries(ctx, []entity.LedgerEntry{
+		{User: "user1", Asset: "BTC", Amount: "1.5"},
+		{User: "user1", Asset: "BTC", Amount: "2.5"},
+		{User: "user2", Asset: "ETH", Amount: "3"},
+	})
+	if err != nil {
+		t.Fatalf("AddEntries() error = %v", err)
+	}
+	if balance, _ := ledger.GetBalance(ctx, "user1"); balance.Balances["BTC"] != "4.00000000" {
+		t.Errorf("user1 BTC = %v, want 4.00000000", balance.Balances["BTC"])
+	}
+
+	// One invalid amount rolls back the whole batch
+	err = ledger.AddEntries(ctx, []entity.LedgerEntry{
+		{User: "user1", Asset: "BTC", Amount: "1"},
+		{User: "user2", Asset: "ETH", Amount: "invalid"},
+	})
+	if err == nil {
+		t.Fatal("AddEntries() with an invalid amount should fail")
+	}
+	if balance, _ := ledger.GetBalance(ctx, "user1"); balance.Balances["BTC"] != "4.00000000" {
+		t.Errorf("user1 BTC after failed batch = %v, want 4.00000000", balance.Balances["BTC"])
+	}
+	if got := ledger.EntryCount(); got != 3 {
+		t.Errorf("EntryCount() = %d, want 3", got)
+	}
+}
+
+func TestInMemoryLedger_EachEntry(t *testing.T) {
+	ledger := NewInMemoryLedger(logger.NewLogger()).(*InMemoryLedger)
+	ctx := context.Background()
+	for i := range 5 {
+		_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: fmt.Sprint(i)})
+		_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: fmt.Sprintf("other%d", i), Asset: "ETH", Amount: "1"})
+	}
+
+	var amounts []string
+	if err := ledger.EachEntry(ctx, "user1", 0, func(entry entity.LedgerEntry) error {
+		amounts = append(amounts, entry.Amount)
+		return nil
+	}); err != nil {
+		t.Fatalf("EachEntry() error = %v", err)
+	}
+	if fmt.Sprint(amounts) != "[0 1 2 3 4]" {
+		t.Errorf("user1 entries = %v, want [0 1 2 3 4] in order", amounts)
+	}
+
+	var all int
+	_ = ledger.EachEntry(ctx, "", 0, func(entity.LedgerEntry) error {
+		all++
+		return nil
+	})
+	if all != 10 {
+		t.Errorf("EachEntry() for all users visited %d entries, want 10", all)
+	}
+}
+
+func TestInMemoryLedger_EachEntryCursorWhileWriting(t *testing.T) {
+	ledger := NewInMemoryLedger(logger.NewLogger()).(*InMemoryLedger)
+	ctx := context.Background()
+
+	const writers, perWriter = 8, 200
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perWriter {
+				_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: fmt.Sprintf("user%d-%d", w, i%7), Asset: "BTC", Amount: "1"})
+			}
+		}()
+	}
+
+	// Following the cursor while entries are applied must never skip one:
+	// every sequence from 1 on is seen exactly once
+	var last uint64
+	for last < writers*perWriter {
+		if err := ledger.EachEntry(ctx, "", last, func(entry entity.LedgerEntry) error {
+			if entry.Sequence != last+1 {
+				return fmt.Errorf("sequence %d after %d", entry.Sequence, last)
+			}
+			last = entry.Sequence
+			return nil
+		}); err != nil {
+			t.Fatalf("EachEntry() error = %v", err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestInMemoryLedger_Compact(t *testing.T) {
+	ledger := NewInMemoryLedger(logger.NewLogger()).(*InMemoryLedger)
+	ctx := context.Background()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	ledger.now = func() time.Time { return now }
+
+	// closed settles to zero and holder keeps a balance, both long ago
+	_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: "closed", Asset: "BTC", Amount: "1"})
+	_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: "closed", Asset: "BTC", Amount: "-1"})
+	_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: "holder", Asset: "BTC", Amount: "2"})
+	_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: "holder", Asset: "ETH", Amount: "3"})
+	_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: "holder", Asset: "ETH", Amount: "-3"})
+	now = start.Add(100 * 24 * time.Hour)
+	_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: "active", Asset: "BTC", Amount: "1"})
+
+	// Without idleSince only zero balances go
+	result, err := ledger.Compact(ctx, time.Time{}, func(entity.ArchivedUser) error {
+		t.Fatal("archive called without idleSince")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	if result != (entity.CompactionResult{ZeroBalances: 2}) {
+		t.Errorf("Compact() = %+v, want 2 zero balances", result)
+	}
+	if ledger.EntryCount() != 6 {
+		t.Errorf("EntryCount() = %d, want all 6 entries kept", ledger.EntryCount())
+	}
+
+	archived := map[string]entity.ArchivedUser{}
+	result, err = ledger.Compact(ctx, now.Add(-90*24*time.Hour), func(user entity.ArchivedUser) error {
+		archived[user.User] = user
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	if result != (entity.CompactionResult{ArchivedUsers: 2, ArchivedEntries: 5, RemovedUsers: 1}) {
+		t.Errorf("Compact() = %+v, want 2 users with 5 entries archived and 1 removed", result)
+	}
+	if len(archived["closed"].Entries) != 2 || len(archived["holder"].Entries) != 3 || archived["holder"].Balances["BTC"] != "2.00000000" {
+		t.Errorf("archived = %+v, want closed's 2 and holder's 3 entries with holder's balance", archived)
+	}
+	if ledger.EntryCount() != 1 {
+		t.Errorf("EntryCount() = %d, want only active's entry kept", ledger.EntryCount())
+	}
+
+	// holder keeps their balance and numbering; closed starts over
+	holder, _ := ledger.GetBalance(ctx, "holder")
+	if holder.Balances["BTC"] != "2.00000000" {
+		t.Errorf("holder balance = %v, want BTC 2 kept", holder.Balances)
+	}
+	_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: "holder", Asset: "BTC", Amount: "1"})
+	_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: "closed", Asset: "BTC", Amount: "1"})
+	var userSequences []uint64
+	_ = ledger.EachEntry(ctx, "", 0, func(entry entity.LedgerEntry) error {
+		userSequences = append(userSequences, entry.UserSequence)
+		return nil
+	})
+	if fmt.Sprint(userSequences) != "[1 4 1]" {
+		t.Errorf("user sequences = %v, want [1 4 1]", userSequences)
+	}
+
+	// A failed archive keeps the user's entries
+	now = now.Add(200 * 24 * time.Hour)
+	errArchive := errors.New("disk full")
+	if _, err := ledger.Compact(ctx, now, func(entity.ArchivedUser) error { return errArchive }); !errors.Is(err, errArchive) {
+		t.Errorf("Compact() error = %v, want %v", err, errArchive)
+	}
+	if ledger.EntryCount() != 3 {
+		t.Errorf("EntryCount() after a failed archive = %d, want 3", ledger.EntryCount())
+	}
+}
+
+func TestInMemoryLedger_Prune(t *testing.T) {
+	ledger := newInMemoryLedger(logger.NewLogger(), 4)
+	ctx := context.Background()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	ledger.now = func() time.Time { return now }
+
+	for i := range 6 {
+		now = start.Add(time.Duration(i) * time.Hour)
+		_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: fmt.Sprintf("user%d", i%3), Asset: "BTC", Amount: "1"})
+	}
+
+	// A failed archive keeps every entry
+	errArchive := errors.New("bucket unreachable")
+	if _, err := ledger.Prune(ctx, start.Add(3*time.Hour), func([]entity.LedgerEntry) error { return errArchive }); !errors.Is(err, errArchive) {
+		t.Errorf("Prune() error = %v, want %v", err, errArchive)
+	}
+	if ledger.EntryCount() != 6 {
+		t.Errorf("EntryCount() after a failed archive = %d, want 6", ledger.EntryCount())
+	}
+
+	var archived []entity.LedgerEntry
+	pruned, err := ledger.Prune(ctx, start.Add(3*time.Hour), func(entries []entity.LedgerEntry) error {
+		archived = entries
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if pruned != 3 || len(archived) != 3 {
+		t.Fatalf("Prune() = %d with %d archived, want the 3 entries before the cutoff", pruned, len(archived))
+	}
+	for i, entry := range archived {
+		if entry.Sequence != uint64(i+1) || !entry.AppliedAt.Equal(start.Add(time.Duration(i)*time.Hour)) {
+			t.Errorf("archived[%d] = %+v, want sequence %d applied at hour %d", i, entry, i+1, i)
+		}
+	}
+
+	// Balances and numbering are unchanged; the history starts after the cutoff
+	balance, _ := ledger.GetBalance(ctx, "user0")
+	if balance.Balances["BTC"] != "2.00000000" || balance.Sequence != 4 {
+		t.Errorf("GetBalance(user0) = %+v, want BTC 2 at sequence 4", balance)
+	}
+	_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: "user0", Asset: "BTC", Amount: "1"})
+	var sequences []string
+	_ = ledger.EachEntry(ctx, "", 0, func(entry entity.LedgerEntry) error {
+		sequences = append(sequences, fmt.Sprintf("%d/%d", entry.Sequence, entry.UserSequence))
+		return nil
+	})
+	if fmt.Sprint(sequences) != "[4/2 5/2 6/2 7/3]" {
+		t.Errorf("sequences = %v, want [4/2 5/2 6/2 7/3]", sequences)
+	}
+
+	// Nothing left to prune does not call archive
+	pruned, err = ledger.Prune(ctx, start.Add(3*time.Hour), func([]entity.LedgerEntry) error {
+		t.Error("archive called without old entries")
+		return nil
+	})
+	if pruned != 0 || err != nil {
+		t.Errorf("Prune() = %d, %v, want nothing pruned", pruned, err)
+	}
+}
+
+func TestInMemoryLedger_Holdings(t *testing.T) {
+	ledger := NewInMemoryLedger(logger.NewLogger()).(*InMemoryLedger)
+	ctx := context.Background()
+
+	for _, entry := range []entity.LedgerEntry{
+		{User: "user1", Asset: "BTC", Amount: "0.5"},
+		{User: "user2", Asset: "BTC", Amount: "250"},
+		{User: "user3", Asset: "BTC", Amount: "0.7"},
+		{User: "user4", Asset: "BTC", Amount: "-1"},
+		{User: "user5", Asset: "BTC", Amount: "3"},
+		{User: "user5", Asset: "BTC", Amount: "-3"},
+		{User: "user1", Asset: "ETH", Amount: "2"},
+	} {
+		if err := ledger.AddEntry(ctx, entry); err != nil {
+			t.Fatalf("AddEntry(%v) error = %v", entry, err)
+		}
+	}
+	// Batches move holders between ranks and buckets too
+	err := ledger.AddEntries(ctx, []entity.LedgerEntry{
+		{User: "user1", Asset: "BTC", Amount: "0.2"},
+		{User: "user3", Asset: "BTC", Amount: "-0.2"},
+	})
+	if err != nil {
+		t.Fatalf("AddEntries() error = %v", err)
+	}
+
+	holders, err := ledger.TopHolders(ctx, "BTC", 2)
+	if err != nil {
+		t.Fatalf("TopHolders() error = %v", err)
+	}
+	wantHolders := []entity.Holder{{User: "user2", Balance: "250.00000000"}, {User: "user1", Balance: "0.70000000"}}
+	if !slices.Equal(holders, wantHolders) {
+		t.Errorf("TopHolders() = %v, want %v", holders, wantHolders)
+	}
+	// Negative balances are not holdings
+	if holders, _ := ledger.TopHolders(ctx, "BTC", 10); len(holders) != 3 {
+		t.Errorf("TopHolders(10) = %v, want the 3 positive balances", holders)
+	}
+	if holders, _ := ledger.TopHolders(ctx, "DOGE", 10); holders == nil || len(holders) != 0 {
+		t.Errorf("TopHolders(DOGE) = %#v, want an empty list", holders)
+	}
+
+	distributions, err := ledger.BalanceDistributions(ctx, "")
+	if err != nil {
+		t.Fatalf("BalanceDistributions() error = %v", err)
+	}
+	if len(distributions) != 2 || distributions[0].Asset != "BTC" || distributions[1].Asset != "ETH" {
+		t.Fatalf("BalanceDistributions() = %v, want BTC and ETH", distributions)
+	}
+	btc := distributions[0]
+	if btc.Holders != 4 || btc.Total != "250.20000000" {
+		t.Errorf("BTC holders = %d, total = %s, want 4 and 250.20000000", btc.Holders, btc.Total)
+	}
+	wantBuckets := []entity.BalanceBucket{
+		{Max: "0", Count: 1},
+		{Min: "0.1", Max: "1", Count: 2},
+		{Min: "100", Max: "1000", Count: 1},
+	}
+	if !slices.Equal(btc.Buckets, wantBuckets) {
+		t.Errorf("BTC buckets = %v, want %v", btc.Buckets, wantBuckets)
+	}
+
+	// An asset nobody holds any more is left out
+	_ = ledger.AddEntry(ctx, entity.LedgerEntry{User: "user1", Asset: "ETH", Amount: "-2"})
+	if distributions, _ := ledger.BalanceDistributions(ctx, "ETH"); len(distributions) != 0 {
+		t.Errorf("BalanceDistributions(ETH) = %v, want none", distributions)
+	}
+}
+
+func TestInMemoryLedger_TopHoldersRanking(t *testing.T) {
+	ledger := NewInMemoryLedger(logger.NewLogger()).(*InMemoryLedger)
+	ctx := context.Background()
+
+	// Many holders with tied balances are ranked by balance, then by user
+	var all []entity.Holder
+	for i := range 50 {
+		user, amount := fmt.Sprintf("user%02d", i), fmt.Sprintf("%d", i%7+1)
+		if err := ledger.AddEntry(ctx, entity.LedgerEntry{User: user, Asset: "BTC", Amount: amount}); err != nil {
+			t.Fatalf("AddEntry() error = %v", err)
+		}
+		all = append(all, entity.Holder{User: user, Balance: amount + ".00000000"})
+	}
+	slices.SortFunc(all, func(a, b entity.Holder) int {
+		if c := strings.Compare(b.Balance, a.Balance); c != 0 {
+			return c
+		}
+		return strings.Compare(a.User, b.User)
+	})
+
+	for _, n := range []int{1, 10, 50, 100} {
+		holders, err := ledger.TopHolders(ctx, "BTC", n)
+		if err != nil {
+			t.Fatalf("TopHolders(%d) error = %v", n, err)
+		}
+		if want := all[:min(n, len(all))]; !slices.Equal(holders, want) {
+			t.Errorf("TopHolders(%d) = %v, want %v", n, holders, want)
+		}
+	}
+}
+
+func FuzzAddDecimalStrings(f *testing.F) {
+	f.Add("100.5", "-0.25")
+	f.Add("0.1", "0.2")
+	f.Add("", "1")
+	f.Add("1e3", "-1E-3")
+	f.Add("0.000000001", "0.000000001")
+	f.Add("99999999999999999999999999999999", "1")
+	f.Add("+1", "-0")
+	f.Add("1e999999999", "0")
+	f.Add("1e-999999999", "0")
+	f.Add("1.2.3", "NaN")
+	f.Add(" 1", "0x10")
+
+	f.Fuzz(func(t *testing.T, a, b string) {
+		sum, err := addDecimalStrings(a, b)
+		if err != nil {
+			return
+		}
+		if reversed, err := addDecimalStrings(b, a); err != nil || reversed != sum {
+			t.Errorf("addDecimalStrings(%q, %q) = %q, %v, want %q", b, a, reversed, err, sum)
+		}
+
+		// The result is a valid amount with exactly 8 decimal places
+		parsed, err := decimal.NewFromString(sum)
+		if err != nil {
+			t.Fatalf("addDecimalStrings(%q, %q) = %q, not a decimal: %v", a, b, sum, err)
+		}
+		if parsed.StringFixed(8) != sum {
+			t.Errorf("addDecimalStrings(%q, %q) = %q, want 8 decimal places", a, b, sum)
+		}
+		if again, err := addDecimalStrings(sum, "0"); err != nil || again != sum {
+			t.Errorf("addDecimalStrings(%q, 0) = %q, %v, want %q", sum, again, err, sum)
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"kii.com/internal/domain/entity"
+)
+
+// InMemoryPendingStore implements the PendingEntryStore port. Entries that
+// are not approved within the TTL are dropped, so an approval that never
+// arrives does not keep an entry around forever.
+type InMemoryPendingStore struct {
+	mu      sync.Mutex
+	entries map[string]entity.PendingEntry
+	ttl     time.Duration
+	now     func() time.Time
+}
+
+// NewInMemoryPendingStore creates a pending entry store dropping entries
+// older than ttl
+func NewInMemoryPendingStore(ttl time.Duration) *InMemoryPendingStore {
+	return &InMemoryPendingStore{
+		entries: make(map[string]entity.PendingEntry),
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+// Add parks an entry until it is approved, rejected or expires
+func (s *InMemoryPendingStore) Add(entry entity.PendingEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+	s.entries[entry.ID] = entry
+	return nil
+}
+
+// Get returns the pending entry with id
+func (s *InMemoryPendingStore) Get(id string) (entity.PendingEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+	entry, ok := s.entries[id]
+	return entry, ok
+}
+
+// Delete removes a pending entry, reporting whether it was pending
+func (s *InMemoryPendingStore) Delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+	if _, ok := s.entries[id]; !ok {
+		return false
+	}
+	delete(s.entries, id)
+	return true
+}
+
+// List returns the pending entries, oldest first
+func (s *InMemoryPendingStore) List() []entity.PendingEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+	entries := make([]entity.PendingEntry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+	return entries
+}
+
+// expire drops entries older than the TTL. Few entries are pending at a
+// time, so a full scan is cheap. s.mu must be held.
+func (s *InMemoryPendingStore) expire() {
+	cutoff := s.now().Add(-s.ttl)
+	for id, entry := range s.entries {
+		if entry.CreatedAt.Before(cutoff) {
+			delete(s.entries, id)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"kii.com/internal/domain/entity"
+)
+
+func TestInMemoryPendingStore(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	store := NewInMemoryPendingStore(time.Hour)
+	store.now = func() time.Time { return now }
+
+	entry := entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "5000"}
+	store.Add(entity.PendingEntry{ID: "b", Entry: entry, Source: "default", CreatedAt: now.Add(-10 * time.Minute)})
+	store.Add(entity.PendingEntry{ID: "a", Entry: entry, Source: "partner", CreatedAt: now.Add(-30 * time.Minute)})
+
+	if got, ok := store.Get("a"); !ok || got.Source != "partner" {
+		t.Errorf("Get(a) = %+v, %v, want the partner entry", got, ok)
+	}
+	list := store.List()
+	if len(list) != 2 || list[0].ID != "a" || list[1].ID != "b" {
+		t.Errorf("List() = %+v, want a then b", list)
+	}
+
+	if !store.Delete("b") {
+		t.Error("Delete(b) = false, want true")
+	}
+	if store.Delete("b") {
+		t.Error("second Delete(b) = true, want false")
+	}
+
+	// a is 30 minutes old; it expires past the one hour TTL
+	now = now.Add(31 * time.Minute)
+	if _, ok := store.Get("a"); ok {
+		t.Error("Get(a) found an entry past its TTL")
+	}
+	if list := store.List(); len(list) != 0 {
+		t.Errorf("List() = %+v, want no entries", list)
+	}
+}
@@ -0,0 +1,494 @@
+// Package repotest is a conformance test suite for port.LedgerRepository
+// implementations, so that every storage backend is held to the same
+// semantics. Backends run it from their own tests:
+//
+//	func TestPostgresLedger_Conformance(t *testing.T) {
+//		repotest.RunLedgerRepositoryTests(t, func(t *testing.T) port.LedgerRepository {
+//			return newTestPostgresLedger(t)
+//		})
+//	}
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+)
+
+// Factory returns a new, empty repository for a single test. Resources it
+// holds should be released with t.Cleanup.
+type Factory func(t *testing.T) port.LedgerRepository
+
+// RunLedgerRepositoryTests runs the conformance suite against repositories
+// created by newRepo. History, batch and hold tests run only for repositories
+// implementing port.LedgerHistoryRepository, port.BatchLedgerRepository and
+// port.LedgerHoldRepository.
+func RunLedgerRepositoryTests(t *testing.T, newRepo Factory) {
+	t.Run("Precision", func(t *testing.T) { testPrecision(t, newRepo(t)) })
+	t.Run("InvalidAmount", func(t *testing.T) { testInvalidAmount(t, newRepo(t)) })
+	t.Run("Isolation", func(t *testing.T) { testIsolation(t, newRepo(t)) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, newRepo(t)) })
+	t.Run("Idempotency", func(t *testing.T) { testIdempotency(t, newRepo(t)) })
+	t.Run("History", func(t *testing.T) { testHistory(t, newRepo(t)) })
+	t.Run("Batch", func(t *testing.T) { testBatch(t, newRepo(t)) })
+	t.Run("Canceled", func(t *testing.T) { testCanceled(t, newRepo(t)) })
+	t.Run("Holds", func(t *testing.T) { testHolds(t, newRepo(t)) })
+	t.Run("ConcurrentCaptures", func(t *testing.T) { testConcurrentCaptures(t, newRepo(t)) })
+}
+
+// testPrecision checks that amounts are added as exact decimals
+func testPrecision(t *testing.T, repo port.LedgerRepository) {
+	tests := []struct {
+		name    string
+		amounts []string
+		want    string
+	}{
+		{"no floating point rounding", []string{"0.1", "0.2"}, "0.3"},
+		{"smallest unit", []string{"0.00000001", "0.00000002"}, "0.00000003"},
+		{"large balance keeps its fractional part", []string{"12345678901234567890.12345678", "0.00000001"}, "12345678901234567890.12345679"},
+		{"debits down to zero", []string{"5", "-2.5", "-2.5"}, "0"},
+		{"negative balance", []string{"1", "-1.5"}, "-0.5"},
+	}
+
+	ctx := context.Background()
+	for i, tt := range tests {
+		user := fmt.Sprintf("precision-user-%d", i)
+		for _, amount := range tt.amounts {
+			mustAdd(t, repo, entity.LedgerEntry{User: user, Asset: "BTC", Amount: amount})
+		}
+		balance, err := repo.GetBalance(ctx, user)
+		if err != nil {
+			t.Fatalf("%s: GetBalance() error = %v", tt.name, err)
+		}
+		assertDecimal(t, tt.name, balance.Balances["BTC"], tt.want)
+	}
+}
+
+// testInvalidAmount checks that a malformed amount is rejected without
+// changing the balance
+func testInvalidAmount(t *testing.T, repo port.LedgerRepository) {
+	ctx := context.Background()
+	mustAdd(t, repo, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"})
+
+	for _, amount := range []string{"abc", "1.2.3", "1e"} {
+		if err := repo.AddEntry(ctx, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: amount}); err == nil {
+			t.Errorf("AddEntry(amount %q) error = nil, want error", amount)
+		}
+	}
+
+	balance, err := repo.GetBalance(ctx, "user1")
+	if err != nil {
+		t.Fatalf("GetBalance() error = %v", err)
+	}
+	assertDecimal(t, "balance after rejected entries", balance.Balances["BTC"], "1")
+}
+
+// testIsolation checks that balances are kept per user and asset
+func testIsolation(t *testing.T, repo port.LedgerRepository) {
+	ctx := context.Background()
+	mustAdd(t, repo, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"})
+	mustAdd(t, repo, entity.LedgerEntry{User: "user1", Asset: "ETH", Amount: "2"})
+	mustAdd(t, repo, entity.LedgerEntry{User: "user2", Asset: "BTC", Amount: "3"})
+
+	balance, err := repo.GetBalance(ctx, "user1")
+	if err != nil {
+		t.Fatalf("GetBalance(user1) error = %v", err)
+	}
+	if balance.User != "user1" || len(balance.Balances) != 2 {
+		t.Fatalf("GetBalance(user1) = %+v, want user1 with BTC and ETH", balance)
+	}
+	assertDecimal(t, "user1 BTC", balance.Balances["BTC"], "1")
+	assertDecimal(t, "user1 ETH", balance.Balances["ETH"], "2")
+
+	balance, err = repo.GetBalance(ctx, "user2")
+	if err != nil {
+		t.Fatalf("GetBalance(user2) error = %v", err)
+	}
+	if len(balance.Balances) != 1 {
+		t.Fatalf("GetBalance(user2) = %+v, want only BTC", balance)
+	}
+	assertDecimal(t, "user2 BTC", balance.Balances["BTC"], "3")
+
+	// A returned balance is a snapshot the caller may modify
+	balance.Balances["BTC"] = "1000"
+	balance, err = repo.GetBalance(ctx, "user2")
+	if err != nil {
+		t.Fatalf("GetBalance(user2) error = %v", err)
+	}
+	assertDecimal(t, "user2 BTC after modifying a snapshot", balance.Balances["BTC"], "3")
+}
+
+// testConcurrency checks that no concurrent entry is lost
+func testConcurrency(t *testing.T, repo port.LedgerRepository) {
+	const (
+		writers          = 20
+		entriesPerWriter = 25
+	)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*writers*entriesPerWriter)
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range entriesPerWriter {
+				// Every writer hits the shared user, and one of its own
+				for _, user := range []string{"shared", fmt.Sprintf("writer-%d", w)} {
+					if err := repo.AddEntry(ctx, entity.LedgerEntry{User: user, Asset: "BTC", Amount: "0.00000001"}); err != nil {
+						errs <- err
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("concurrent AddEntry() error = %v", err)
+	}
+
+	balance, err := repo.GetBalance(ctx, "shared")
+	if err != nil {
+		t.Fatalf("GetBalance() error = %v", err)
+	}
+	assertDecimal(t, "shared balance", balance.Balances["BTC"], "0.00000500")
+	for w := range writers {
+		user := fmt.Sprintf("writer-%d", w)
+		balance, err := repo.GetBalance(ctx, user)
+		if err != nil {
+			t.Fatalf("GetBalance(%s) error = %v", user, err)
+		}
+		assertDecimal(t, user+" balance", balance.Balances["BTC"], "0.00000025")
+	}
+}
+
+// testIdempotency checks that reads never change state and that identical
+// entries are each applied: replay protection belongs to the nonce store, so
+// the repository must not deduplicate entries itself
+func testIdempotency(t *testing.T, repo port.LedgerRepository) {
+	ctx := context.Background()
+
+	balance, err := repo.GetBalance(ctx, "unknown")
+	if err != nil {
+		t.Fatalf("GetBalance(unknown) error = %v", err)
+	}
+	if balance == nil || balance.Balances == nil || len(balance.Balances) != 0 {
+		t.Fatalf("GetBalance(unknown) = %+v, want an empty, non-nil balance", balance)
+	}
+
+	entry := entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1.5"}
+	mustAdd(t, repo, entry)
+	mustAdd(t, repo, entry)
+
+	for range 3 {
+		balance, err := repo.GetBalance(ctx, "user1")
+		if err != nil {
+			t.Fatalf("GetBalance() error = %v", err)
+		}
+		assertDecimal(t, "balance after two identical entries", balance.Balances["BTC"], "3")
+	}
+}
+
+// testHistory checks entry listing order, sequence numbers, cursors,
+// filtering and early stopping
+func testHistory(t *testing.T, repo port.LedgerRepository) {
+	history, ok := repo.(port.LedgerHistoryRepository)
+	if !ok {
+		t.Skip("repository does not implement port.LedgerHistoryRepository")
+	}
+	ctx := context.Background()
+
+	var want []entity.LedgerEntry
+	for i := range 5 {
+		entry := entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: fmt.Sprintf("%d", i+1)}
+		mustAdd(t, repo, entry)
+		want = append(want, entry)
+		mustAdd(t, repo, entity.LedgerEntry{User: "user2", Asset: "ETH", Amount: "1"})
+	}
+	// Rejected entries are not part of the history
+	_ = repo.AddEntry(ctx, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "invalid"})
+
+	list := func(user string, after uint64) []entity.LedgerEntry {
+		t.Helper()
+		var got []entity.LedgerEntry
+		if err := history.EachEntry(ctx, user, after, func(entry entity.LedgerEntry) error {
+			got = append(got, entry)
+			return nil
+		}); err != nil {
+			if errors.Is(err, entity.ErrHistoryUnsupported) {
+				t.Skip("repository reports history as unsupported")
+			}
+			t.Fatalf("EachEntry(%q, %d) error = %v", user, after, err)
+		}
+		return got
+	}
+
+	got := list("user1", 0)
+	if len(got) != len(want) {
+		t.Fatalf("EachEntry(user1) = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].User != want[i].User || got[i].Asset != want[i].Asset || got[i].Amount != want[i].Amount {
+			t.Errorf("EachEntry(user1)[%d] = %+v, want %+v in the order applied", i, got[i], want[i])
+		}
+		if got[i].UserSequence != uint64(i+1) {
+			t.Errorf("EachEntry(user1)[%d].UserSequence = %d, want %d", i, got[i].UserSequence, i+1)
+		}
+	}
+
+	all := list("", 0)
+	if len(all) != 10 {
+		t.Fatalf("EachEntry(all) listed %d entries, want 10", len(all))
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].Sequence <= all[i-1].Sequence {
+			t.Fatalf("EachEntry(all) sequences %d then %d, want them increasing", all[i-1].Sequence, all[i].Sequence)
+		}
+	}
+
+	// A listing resumes after the last entry seen
+	if rest := list("", all[3].Sequence); len(rest) != 6 || rest[0] != all[4] {
+		t.Errorf("EachEntry(all, after %d) = %v, want the last 6 entries", all[3].Sequence, rest)
+	}
+	if rest := list("user1", got[1].Sequence); len(rest) != 3 || rest[0] != got[2] {
+		t.Errorf("EachEntry(user1, after %d) = %v, want the last 3 entries", got[1].Sequence, rest)
+	}
+	if rest := list("", all[9].Sequence); len(rest) != 0 {
+		t.Errorf("EachEntry(all, after the last) = %v, want none", rest)
+	}
+
+	errStop := errors.New("stop")
+	calls := 0
+	err := history.EachEntry(ctx, "user1", 0, func(entity.LedgerEntry) error {
+		calls++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || calls != 1 {
+		t.Errorf("EachEntry() with failing fn = %v after %d calls, want the fn error after 1 call", err, calls)
+	}
+}
+
+// testBatch checks that a batch is applied all or nothing
+func testBatch(t *testing.T, repo port.LedgerRepository) {
+	batchRepo, ok := repo.(port.BatchLedgerRepository)
+	if !ok {
+		t.Skip("repository does not implement port.BatchLedgerRepository")
+	}
+	ctx := context.Background()
+
+	err := batchRepo.AddEntries(ctx, []entity.LedgerEntry{
+		{User: "user1", Asset: "BTC", Amount: "1"},
+		{User: "user2", Asset: "BTC", Amount: "invalid"},
+	})
+	if err == nil {
+		t.Fatal("AddEntries() with an invalid amount error = nil, want error")
+	}
+	balance, err := repo.GetBalance(ctx, "user1")
+	if err != nil {
+		t.Fatalf("GetBalance() error = %v", err)
+	}
+	if _, ok := balance.Balances["BTC"]; ok {
+		t.Errorf("failed batch changed balance to %v", balance.Balances)
+	}
+
+	if err := batchRepo.AddEntries(ctx, []entity.LedgerEntry{
+		{User: "user1", Asset: "BTC", Amount: "1"},
+		{User: "user2", Asset: "BTC", Amount: "2"},
+		{User: "user1", Asset: "BTC", Amount: "0.5"},
+	}); err != nil {
+		t.Fatalf("AddEntries() error = %v", err)
+	}
+	for user, want := range map[string]string{"user1": "1.5", "user2": "2"} {
+		balance, err := repo.GetBalance(ctx, user)
+		if err != nil {
+			t.Fatalf("GetBalance(%s) error = %v", user, err)
+		}
+		assertDecimal(t, user+" balance after batch", balance.Balances["BTC"], want)
+	}
+}
+
+// testCanceled checks that operations fail with the context's error once it
+// is done, applying nothing
+func testCanceled(t *testing.T, repo port.LedgerRepository) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	entry := entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"}
+
+	if err := repo.AddEntry(ctx, entry); !errors.Is(err, context.Canceled) {
+		t.Errorf("AddEntry() error = %v, want context.Canceled", err)
+	}
+	if batchRepo, ok := repo.(port.BatchLedgerRepository); ok {
+		if err := batchRepo.AddEntries(ctx, []entity.LedgerEntry{entry}); !errors.Is(err, context.Canceled) {
+			t.Errorf("AddEntries() error = %v, want context.Canceled", err)
+		}
+	}
+	if _, err := repo.GetBalance(ctx, "user1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetBalance() error = %v, want context.Canceled", err)
+	}
+	if history, ok := repo.(port.LedgerHistoryRepository); ok {
+		err := history.EachEntry(ctx, "", 0, func(entity.LedgerEntry) error { return nil })
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("EachEntry() error = %v, want context.Canceled", err)
+		}
+	}
+
+	balance, err := repo.GetBalance(context.Background(), "user1")
+	if err != nil {
+		t.Fatalf("GetBalance() error = %v", err)
+	}
+	if len(balance.Balances) != 0 {
+		t.Errorf("balances = %v, want none applied", balance.Balances)
+	}
+}
+
+// testHolds checks that holds are reported apart from the totals until they
+// are released, captured or expire
+func testHolds(t *testing.T, repo port.LedgerRepository) {
+	holds, ok := repo.(port.LedgerHoldRepository)
+	if !ok {
+		t.Skip("repository does not implement port.LedgerHoldRepository")
+	}
+	ctx := context.Background()
+	mustAdd(t, repo, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "10"})
+
+	balance, err := repo.GetBalance(ctx, "user1")
+	if err != nil {
+		t.Fatalf("GetBalance() error = %v", err)
+	}
+	if len(balance.Held) != 0 || len(balance.Available) != 0 {
+		t.Errorf("balance without holds = %+v, want totals only", balance)
+	}
+
+	for _, amount := range []string{"0", "-1", "abc"} {
+		if err := holds.PlaceHold(ctx, entity.Hold{ID: "bad", User: "user1", Asset: "BTC", Amount: amount}); err == nil {
+			t.Errorf("PlaceHold(amount %q) error = nil, want error", amount)
+		}
+	}
+	for _, hold := range []entity.Hold{
+		{ID: "hold-btc", User: "user1", Asset: "BTC", Amount: "3"},
+		{ID: "hold-eth", User: "user1", Asset: "ETH", Amount: "1"},
+		{ID: "hold-expired", User: "user1", Asset: "BTC", Amount: "5", ExpiresAt: time.Now().Add(-time.Minute)},
+	} {
+		if err := holds.PlaceHold(ctx, hold); err != nil {
+			t.Fatalf("PlaceHold(%+v) error = %v", hold, err)
+		}
+	}
+
+	balance, err = repo.GetBalance(ctx, "user1")
+	if err != nil {
+		t.Fatalf("GetBalance() error = %v", err)
+	}
+	assertDecimal(t, "BTC total", balance.Balances["BTC"], "10")
+	assertDecimal(t, "BTC held", balance.Held["BTC"], "3")
+	assertDecimal(t, "BTC available", balance.Available["BTC"], "7")
+	assertDecimal(t, "ETH held", balance.Held["ETH"], "1")
+	assertDecimal(t, "ETH available", balance.Available["ETH"], "-1")
+
+	for id, want := range map[string]bool{"hold-eth": true, "hold-expired": false, "no-such-hold": false} {
+		released, err := holds.ReleaseHold(ctx, id)
+		if err != nil || released != want {
+			t.Errorf("ReleaseHold(%s) = %v, %v, want %v", id, released, err, want)
+		}
+	}
+
+	if err := holds.CaptureHold(ctx, "hold-btc", entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "-3"}); err != nil {
+		t.Fatalf("CaptureHold() error = %v", err)
+	}
+	if released, _ := holds.ReleaseHold(ctx, "hold-btc"); released {
+		t.Error("ReleaseHold() of a captured hold = true, want false")
+	}
+	balance, err = repo.GetBalance(ctx, "user1")
+	if err != nil {
+		t.Fatalf("GetBalance() error = %v", err)
+	}
+	assertDecimal(t, "BTC total after capture", balance.Balances["BTC"], "7")
+	if len(balance.Held) != 0 || len(balance.Available) != 0 {
+		t.Errorf("balance after capture = %+v, want totals only", balance)
+	}
+}
+
+// testConcurrentCaptures checks that a hold and the entry capturing it are
+// never both or neither seen by a balance read, so what is available does
+// not change while holds are captured
+func testConcurrentCaptures(t *testing.T, repo port.LedgerRepository) {
+	holds, ok := repo.(port.LedgerHoldRepository)
+	if !ok {
+		t.Skip("repository does not implement port.LedgerHoldRepository")
+	}
+	const n = 50
+	ctx := context.Background()
+	mustAdd(t, repo, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "100"})
+	for i := range n {
+		if err := holds.PlaceHold(ctx, entity.Hold{ID: fmt.Sprintf("hold-%d", i), User: "user1", Asset: "BTC", Amount: "1"}); err != nil {
+			t.Fatalf("PlaceHold() error = %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*n)
+	for i := range n {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- holds.CaptureHold(ctx, fmt.Sprintf("hold-%d", i), entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "-1"})
+		}()
+		go func() {
+			defer wg.Done()
+			balance, err := repo.GetBalance(ctx, "user1")
+			if err == nil && balance.Available["BTC"] != "" {
+				var available decimal.Decimal
+				if available, err = decimal.NewFromString(balance.Available["BTC"]); err == nil && !available.Equal(decimal.NewFromInt(100-n)) {
+					err = fmt.Errorf("available = %s during captures, want %d", balance.Available["BTC"], 100-n)
+				}
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	balance, err := repo.GetBalance(ctx, "user1")
+	if err != nil {
+		t.Fatalf("GetBalance() error = %v", err)
+	}
+	assertDecimal(t, "BTC total after captures", balance.Balances["BTC"], fmt.Sprint(100-n))
+	if len(balance.Held) != 0 {
+		t.Errorf("held after captures = %v, want none", balance.Held)
+	}
+}
+
+// mustAdd adds entry, failing the test on error
+func mustAdd(t *testing.T, repo port.LedgerRepository, entry entity.LedgerEntry) {
+	t.Helper()
+	if err := repo.AddEntry(context.Background(), entry); err != nil {
+		t.Fatalf("AddEntry(%+v) error = %v", entry, err)
+	}
+}
+
+// assertDecimal compares balances as decimals, since backends may format
+// them with different numbers of trailing zeros
+func assertDecimal(t *testing.T, name, got, want string) {
+	t.Helper()
+	gotDec, err := decimal.NewFromString(got)
+	if err != nil {
+		t.Errorf("%s = %q, not a decimal (want %s)", name, got, want)
+		return
+	}
+	if !gotDec.Equal(decimal.RequireFromString(want)) {
+		t.Errorf("%s = %s, want %s", name, got, want)
+	}
+}
@@ -0,0 +1,318 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+	"kii.com/internal/infrastructure/logger"
+)
+
+// ResilientLedgerConfig configures a ResilientLedger. Operations are tried
+// up to MaxAttempts times, waiting Backoff before the first retry and twice as
+// long before each further one. After FailureThreshold failures in a row,
+// operations fail fast for OpenTimeout; 0 disables the circuit breaker. Each
+// attempt to read a balance is bounded by ReadTimeout and each write by
+// WriteTimeout, unless they are 0.
+type ResilientLedgerConfig struct {
+	MaxAttempts      int
+	Backoff          time.Duration
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	ReadTimeout      time.Duration
+	WriteTimeout     time.Duration
+}
+
+// ResilientLedger bounds the operations of a repository in time, retries
+// those that fail with entity.ErrStorageTransient, and stops calling it once
+// FailureThreshold operations in a row have failed or timed out, so that
+// callers fail fast with entity.ErrStorageUnavailable instead of waiting on a
+// backend that is down. After OpenTimeout one operation is let through to
+// probe the backend: the circuit closes again if it succeeds.
+type ResilientLedger struct {
+	repo   port.LedgerRepository
+	cfg    ResilientLedgerConfig
+	logger logger.Logger
+	now    func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	// openedAt is when the circuit opened, zero while it is closed
+	openedAt time.Time
+	// probing is set while an operation probes an open circuit
+	probing bool
+}
+
+// NewResilientLedger wraps repo
+func NewResilientLedger(repo port.LedgerRepository, cfg ResilientLedgerConfig, logger logger.Logger) *ResilientLedger {
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	return &ResilientLedger{
+		repo:   repo,
+		cfg:    cfg,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// AddEntry adds entry to the repository
+func (l *ResilientLedger) AddEntry(ctx context.Context, entry entity.LedgerEntry) error {
+	return l.do(ctx, true, l.cfg.WriteTimeout, func(ctx context.Context) error {
+		return l.repo.AddEntry(ctx, entry)
+	})
+}
+
+// AddEntries adds entries to the repository in one transaction
+func (l *ResilientLedger) AddEntries(ctx context.Context, entries []entity.LedgerEntry) error {
+	batchRepo, ok := l.repo.(port.BatchLedgerRepository)
+	if !ok {
+		return entity.ErrBatchUnsupported
+	}
+	return l.do(ctx, true, l.cfg.WriteTimeout, func(ctx context.Context) error {
+		return batchRepo.AddEntries(ctx, entries)
+	})
+}
+
+// GetBalance returns the balance for a specific user
+func (l *ResilientLedger) GetBalance(ctx context.Context, user string) (*entity.BalanceResponse, error) {
+	var balance *entity.BalanceResponse
+	err := l.do(ctx, true, l.cfg.ReadTimeout, func(ctx context.Context) error {
+		var err error
+		balance, err = l.repo.GetBalance(ctx, user)
+		return err
+	})
+	return balance, err
+}
+
+// EachEntry lists entries from the repository. It is not retried, as fn may
+// already have seen some of them, nor bounded in time, as fn may write to a
+// slow client.
+func (l *ResilientLedger) EachEntry(ctx context.Context, user string, after uint64, fn func(entity.LedgerEntry) error) error {
+	history, ok := l.repo.(port.LedgerHistoryRepository)
+	if !ok {
+		return entity.ErrHistoryUnsupported
+	}
+	return l.do(ctx, false, 0, func(ctx context.Context) error {
+		return history.EachEntry(ctx, user, after, fn)
+	})
+}
+
+// Compact compacts the repository. It is not retried; the next run picks up
+// where a failed one stopped.
+func (l *ResilientLedger) Compact(ctx context.Context, idleSince time.Time, archive func(entity.ArchivedUser) error) (entity.CompactionResult, error) {
+	compactor, ok := l.repo.(port.LedgerCompactor)
+	if !ok {
+		return entity.CompactionResult{}, entity.ErrCompactionUnsupported
+	}
+	var result entity.CompactionResult
+	err := l.do(ctx, false, 0, func(ctx context.Context) error {
+		var err error
+		result, err = compactor.Compact(ctx, idleSince, archive)
+		return err
+	})
+	return result, err
+}
+
+// Prune prunes the repository. It is not retried; the next run picks up
+// where a failed one stopped.
+func (l *ResilientLedger) Prune(ctx context.Context, before time.Time, archive func([]entity.LedgerEntry) error) (int, error) {
+	pruner, ok := l.repo.(port.LedgerPruner)
+	if !ok {
+		return 0, entity.ErrPruningUnsupported
+	}
+	var pruned int
+	err := l.do(ctx, false, 0, func(ctx context.Context) error {
+		var err error
+		pruned, err = pruner.Prune(ctx, before, archive)
+		return err
+	})
+	return pruned, err
+}
+
+// TopHolders ranks the holders of asset in the repository
+func (l *ResilientLedger) TopHolders(ctx context.Context, asset string, n int) ([]entity.Holder, error) {
+	holdings, ok := l.repo.(port.LedgerHoldingsRepository)
+	if !ok {
+		return nil, entity.ErrHoldingsUnsupported
+	}
+	var holders []entity.Holder
+	err := l.do(ctx, true, l.cfg.ReadTimeout, func(ctx context.Context) error {
+		var err error
+		holders, err = holdings.TopHolders(ctx, asset, n)
+		return err
+	})
+	return holders, err
+}
+
+// BalanceDistributions returns how balances are spread in the repository
+func (l *ResilientLedger) BalanceDistributions(ctx context.Context, asset string) ([]entity.BalanceDistribution, error) {
+	holdings, ok := l.repo.(port.LedgerHoldingsRepository)
+	if !ok {
+		return nil, entity.ErrHoldingsUnsupported
+	}
+	var distributions []entity.BalanceDistribution
+	err := l.do(ctx, true, l.cfg.ReadTimeout, func(ctx context.Context) error {
+		var err error
+		distributions, err = holdings.BalanceDistributions(ctx, asset)
+		return err
+	})
+	return distributions, err
+}
+
+// PlaceHold sets hold aside in the repository
+func (l *ResilientLedger) PlaceHold(ctx context.Context, hold entity.Hold) error {
+	holds, ok := l.repo.(port.LedgerHoldRepository)
+	if !ok {
+		return entity.ErrHoldsUnsupported
+	}
+	return l.do(ctx, true, l.cfg.WriteTimeout, func(ctx context.Context) error {
+		return holds.PlaceHold(ctx, hold)
+	})
+}
+
+// ReleaseHold drops the hold id from the repository
+func (l *ResilientLedger) ReleaseHold(ctx context.Context, id string) (bool, error) {
+	holds, ok := l.repo.(port.LedgerHoldRepository)
+	if !ok {
+		return false, entity.ErrHoldsUnsupported
+	}
+	var released bool
+	err := l.do(ctx, true, l.cfg.WriteTimeout, func(ctx context.Context) error {
+		var err error
+		released, err = holds.ReleaseHold(ctx, id)
+		return err
+	})
+	return released, err
+}
+
+// CaptureHold applies entry and drops the hold id in the repository
+func (l *ResilientLedger) CaptureHold(ctx context.Context, id string, entry entity.LedgerEntry) error {
+	holds, ok := l.repo.(port.LedgerHoldRepository)
+	if !ok {
+		return entity.ErrHoldsUnsupported
+	}
+	return l.do(ctx, true, l.cfg.WriteTimeout, func(ctx context.Context) error {
+		return holds.CaptureHold(ctx, id, entry)
+	})
+}
+
+// Shared reports whether the repository is shared between replicas
+func (l *ResilientLedger) Shared() bool {
+	shared, ok := l.repo.(port.SharedStore)
+	return ok && shared.Shared()
+}
+
+// EntryCount returns the number of entries in the repository, or -1 if it
+// cannot report it
+func (l *ResilientLedger) EntryCount() int {
+	if counter, ok := l.repo.(interface{ EntryCount() int }); ok {
+		return counter.EntryCount()
+	}
+	return -1
+}
+
+// do runs op through the circuit breaker, each attempt within timeout unless
+// it is 0, retrying it on transient errors when retry is set
+func (l *ResilientLedger) do(ctx context.Context, retry bool, timeout time.Duration, op func(context.Context) error) error {
+	probe, err := l.allow()
+	if err != nil {
+		return err
+	}
+
+	attempts := 1
+	if retry {
+		attempts = l.cfg.MaxAttempts
+	}
+	backoff := l.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		err = runWithTimeout(ctx, timeout, op)
+		if attempt == attempts || !errors.Is(err, entity.ErrStorageTransient) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			l.record(ctx, probe, err)
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	l.record(ctx, probe, err)
+	return err
+}
+
+// runWithTimeout runs op once, within timeout unless it is 0
+func runWithTimeout(ctx context.Context, timeout time.Duration, op func(context.Context) error) error {
+	if timeout <= 0 {
+		return op(ctx)
+	}
+	opCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := op(opCtx)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return fmt.Errorf("storage operation timed out after %s: %w", timeout, err)
+	}
+	return err
+}
+
+// allow reports whether an operation may call the repository, and whether
+// it is the one probing an open circuit
+func (l *ResilientLedger) allow() (bool, error) {
+	if l.cfg.FailureThreshold < 1 {
+		return false, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.openedAt.IsZero() {
+		return false, nil
+	}
+	if l.probing || l.now().Sub(l.openedAt) < l.cfg.OpenTimeout {
+		return false, entity.ErrStorageUnavailable
+	}
+	l.probing = true
+	return true, nil
+}
+
+// record counts the outcome of an operation towards opening the circuit
+func (l *ResilientLedger) record(ctx context.Context, probe bool, err error) {
+	if l.cfg.FailureThreshold < 1 {
+		return
+	}
+	failed := errors.Is(err, entity.ErrStorageTransient) ||
+		(errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if probe {
+		l.probing = false
+	}
+	if !failed {
+		if !l.openedAt.IsZero() {
+			l.logger.LogInfo(ctx, "Storage backend recovered, circuit closed")
+		}
+		l.failures = 0
+		l.openedAt = time.Time{}
+		return
+	}
+	l.failures++
+	if probe || (l.openedAt.IsZero() && l.failures >= l.cfg.FailureThreshold) {
+		if l.openedAt.IsZero() {
+			l.logger.LogError(ctx, "Storage backend failing, circuit opened", err,
+				"failures", l.failures,
+				"open_timeout", l.cfg.OpenTimeout.String())
+		}
+		l.openedAt = l.now()
+	}
+}
+
+// CircuitOpen reports whether operations are currently failed fast
+func (l *ResilientLedger) CircuitOpen() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return !l.openedAt.IsZero()
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/infrastructure/logger"
+)
+
+// flakyLedger fails the next failures calls with err
+type flakyLedger struct {
+	*InMemoryLedger
+	failures int
+	err      error
+	calls    int
+}
+
+func (l *flakyLedger) AddEntry(ctx context.Context, entry entity.LedgerEntry) error {
+	l.calls++
+	if l.failures > 0 {
+		l.failures--
+		return l.err
+	}
+	return l.InMemoryLedger.AddEntry(ctx, entry)
+}
+
+func newFlakyLedger(failures int, err error) *flakyLedger {
+	return &flakyLedger{InMemoryLedger: NewInMemoryLedger(logger.NewLogger()).(*InMemoryLedger), failures: failures, err: err}
+}
+
+func TestResilientLedger_RetriesTransientErrors(t *testing.T) {
+	transient := fmt.Errorf("connection reset: %w", entity.ErrStorageTransient)
+	entry := entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"}
+
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "recovers", failures: 2, err: transient, wantCalls: 3},
+		{name: "gives up", failures: 5, err: transient, wantErr: entity.ErrStorageTransient, wantCalls: 3},
+		{name: "permanent error", failures: 1, err: entity.ErrInvalidUser, wantErr: entity.ErrInvalidUser, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFlakyLedger(tt.failures, tt.err)
+			ledger := NewResilientLedger(repo, ResilientLedgerConfig{MaxAttempts: 3, Backoff: time.Millisecond}, logger.NewLogger())
+
+			err := ledger.AddEntry(context.Background(), entry)
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("AddEntry() error = %v, want %v", err, tt.wantErr)
+			}
+			if repo.calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", repo.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestResilientLedger_CircuitBreaker(t *testing.T) {
+	repo := newFlakyLedger(3, fmt.Errorf("connection refused: %w", entity.ErrStorageTransient))
+	ledger := NewResilientLedger(repo, ResilientLedgerConfig{FailureThreshold: 3, OpenTimeout: time.Minute}, logger.NewLogger())
+	now := time.Now()
+	ledger.now = func() time.Time { return now }
+	ctx := context.Background()
+	entry := entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"}
+
+	for range 3 {
+		if err := ledger.AddEntry(ctx, entry); !errors.Is(err, entity.ErrStorageTransient) {
+			t.Fatalf("AddEntry() error = %v, want the backend's error", err)
+		}
+	}
+	if !ledger.CircuitOpen() {
+		t.Fatal("circuit is closed after 3 failures")
+	}
+
+	// While open, operations fail without reaching the backend
+	if err := ledger.AddEntry(ctx, entry); !errors.Is(err, entity.ErrStorageUnavailable) {
+		t.Errorf("AddEntry() error = %v, want ErrStorageUnavailable", err)
+	}
+	if _, err := ledger.GetBalance(ctx, "user1"); !errors.Is(err, entity.ErrStorageUnavailable) {
+		t.Errorf("GetBalance() error = %v, want ErrStorageUnavailable", err)
+	}
+	if repo.calls != 3 {
+		t.Errorf("calls = %d, want 3", repo.calls)
+	}
+
+	// After the open timeout a probe goes through and closes the circuit
+	now = now.Add(time.Minute)
+	if err := ledger.AddEntry(ctx, entry); err != nil {
+		t.Fatalf("AddEntry() error = %v after the backend recovered", err)
+	}
+	if ledger.CircuitOpen() {
+		t.Error("circuit is open after a successful probe")
+	}
+}
+
+func TestResilientLedger_FailedProbeReopens(t *testing.T) {
+	repo := newFlakyLedger(2, fmt.Errorf("connection refused: %w", entity.ErrStorageTransient))
+	ledger := NewResilientLedger(repo, ResilientLedgerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}, logger.NewLogger())
+	now := time.Now()
+	ledger.now = func() time.Time { return now }
+	ctx := context.Background()
+	entry := entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"}
+
+	_ = ledger.AddEntry(ctx, entry)
+	now = now.Add(time.Minute)
+	if err := ledger.AddEntry(ctx, entry); !errors.Is(err, entity.ErrStorageTransient) {
+		t.Fatalf("AddEntry() error = %v, want the probe to reach the backend", err)
+	}
+	if err := ledger.AddEntry(ctx, entry); !errors.Is(err, entity.ErrStorageUnavailable) {
+		t.Errorf("AddEntry() error = %v, want the circuit open again", err)
+	}
+}
+
+// slowLedger blocks reads until they are cancelled
+type slowLedger struct {
+	*InMemoryLedger
+}
+
+func (slowLedger) GetBalance(ctx context.Context, _ string) (*entity.BalanceResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestResilientLedger_Timeouts(t *testing.T) {
+	repo := slowLedger{NewInMemoryLedger(logger.NewLogger()).(*InMemoryLedger)}
+	ledger := NewResilientLedger(repo, ResilientLedgerConfig{
+		FailureThreshold: 2,
+		OpenTimeout:      time.Minute,
+		ReadTimeout:      10 * time.Millisecond,
+		WriteTimeout:     10 * time.Millisecond,
+	}, logger.NewLogger())
+	ctx := context.Background()
+
+	start := time.Now()
+	if _, err := ledger.GetBalance(ctx, "user1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetBalance() error = %v, want a deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GetBalance() returned after %v, want within the read timeout", elapsed)
+	}
+	// Writes get a timeout of their own and are not slow here
+	if err := ledger.AddEntry(ctx, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"}); err != nil {
+		t.Fatalf("AddEntry() error = %v", err)
+	}
+
+	// Timeouts count towards opening the circuit
+	_, _ = ledger.GetBalance(ctx, "user1")
+	_, _ = ledger.GetBalance(ctx, "user1")
+	if !ledger.CircuitOpen() {
+		t.Error("circuit is closed after 2 timeouts in a row")
+	}
+
+	// A caller giving up is not the backend's failure
+	ledger = NewResilientLedger(repo, ResilientLedgerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}, logger.NewLogger())
+	canceled, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := ledger.GetBalance(canceled, "user1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetBalance() error = %v, want the caller's deadline exceeded", err)
+	}
+	if ledger.CircuitOpen() {
+		t.Error("circuit opened on the caller's own deadline")
+	}
+}
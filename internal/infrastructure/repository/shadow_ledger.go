@@ -0,0 +1,398 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/queue"
+)
+
+// ShadowLedger serves from a primary repository and copies every write it
+// applies to a shadow one, such as a new storage backend to be verified before
+// switching to it. Shadow writes are queued and applied in the background, in
+// order, so the shadow never slows down or fails a write; writes that find the
+// queue full are dropped and counted, and shadow write failures are logged.
+// Compare reports where the shadow's balances differ from the primary's.
+// Compaction and pruning apply to the primary only.
+type ShadowLedger struct {
+	primary port.LedgerRepository
+	shadow  port.LedgerRepository
+	logger  logger.Logger
+
+	// queue holds the writes applied to the primary but not yet to the
+	// shadow
+	queue *queue.Queue[shadowWrite]
+
+	// stateMu guards what a comparison needs to know about the writes
+	stateMu sync.Mutex
+	// written are the users written since the last comparison
+	written map[string]struct{}
+	// pending counts the writes of each user started on the primary and not
+	// yet applied to the shadow, or dropped
+	pending map[string]int
+	// versions grows with each write of a user, so a comparison can tell
+	// whether one started while it read the user's balances
+	versions map[string]uint64
+	// dropped counts the writes dropped since the last comparison
+	dropped int
+}
+
+// shadowWrite is a write waiting to be applied to the shadow, in one
+// transaction if batch is set and the shadow supports them
+type shadowWrite struct {
+	entries []entity.LedgerEntry
+	batch   bool
+}
+
+// ShadowMismatch is a user whose balances differ between the primary and the
+// shadow repository
+type ShadowMismatch struct {
+	User    string
+	Primary map[string]string
+	Shadow  map[string]string
+}
+
+// ShadowComparison is the outcome of ShadowLedger.Compare. Dropped is the
+// number of shadow writes dropped since the last comparison.
+type ShadowComparison struct {
+	Users      int
+	Mismatches []ShadowMismatch
+	Dropped    int
+}
+
+// NewShadowLedger serves from primary and copies its writes to shadow, with
+// up to queueSize writes waiting. The shadow must start with the primary's
+// balances, e.g. both empty or restored from the same backup; users whose
+// earlier entries it lacks are reported as mismatches.
+func NewShadowLedger(primary, shadow port.LedgerRepository, queueSize int, logger logger.Logger) (*ShadowLedger, error) {
+	if queueSize < 1 {
+		return nil, fmt.Errorf("storage.shadow.queueSize must be positive")
+	}
+	l := &ShadowLedger{
+		primary:  primary,
+		shadow:   shadow,
+		logger:   logger,
+		written:  make(map[string]struct{}),
+		pending:  make(map[string]int),
+		versions: make(map[string]uint64),
+	}
+	// One worker keeps the writes in order
+	l.queue = queue.New(queueSize, 1, l.run)
+	return l, nil
+}
+
+// AddEntry applies entry to the primary repository and queues it for the
+// shadow
+func (l *ShadowLedger) AddEntry(ctx context.Context, entry entity.LedgerEntry) error {
+	l.begin(entry)
+	if err := l.primary.AddEntry(ctx, entry); err != nil {
+		l.done(entry)
+		return err
+	}
+	l.enqueue(shadowWrite{entries: []entity.LedgerEntry{entry}})
+	return nil
+}
+
+// AddEntries applies entries to the primary repository in one transaction
+// and queues them for the shadow, to be applied in one transaction too if it
+// supports them
+func (l *ShadowLedger) AddEntries(ctx context.Context, entries []entity.LedgerEntry) error {
+	batchRepo, ok := l.primary.(port.BatchLedgerRepository)
+	if !ok {
+		return entity.ErrBatchUnsupported
+	}
+	l.begin(entries...)
+	if err := batchRepo.AddEntries(ctx, entries); err != nil {
+		l.done(entries...)
+		return err
+	}
+	l.enqueue(shadowWrite{entries: entries, batch: true})
+	return nil
+}
+
+// begin records that writes of the users of entries are under way
+func (l *ShadowLedger) begin(entries ...entity.LedgerEntry) {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	for _, entry := range entries {
+		l.pending[entry.User]++
+		l.versions[entry.User]++
+	}
+}
+
+// done records that the writes of the users of entries have reached the
+// shadow, or never will
+func (l *ShadowLedger) done(entries ...entity.LedgerEntry) {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	for _, entry := range entries {
+		if l.pending[entry.User]--; l.pending[entry.User] <= 0 {
+			delete(l.pending, entry.User)
+		}
+	}
+}
+
+// enqueue marks the users of the write, applied to the primary, for the next
+// comparison and queues it for the shadow, dropping it if the queue is full
+func (l *ShadowLedger) enqueue(write shadowWrite) {
+	l.markWritten(write.entries...)
+	if l.queue.Push(write) == nil {
+		return
+	}
+	l.stateMu.Lock()
+	l.dropped++
+	l.stateMu.Unlock()
+	l.done(write.entries...)
+}
+
+// run applies queued writes to the shadow until the queue is closed
+func (l *ShadowLedger) run(ctx context.Context, writes <-chan shadowWrite) {
+	for write := range writes {
+		l.apply(ctx, write)
+		l.done(write.entries...)
+	}
+}
+
+// apply applies write to the shadow, logging failures
+func (l *ShadowLedger) apply(ctx context.Context, write shadowWrite) {
+	if shadowBatch, ok := l.shadow.(port.BatchLedgerRepository); ok && write.batch {
+		if err := shadowBatch.AddEntries(ctx, write.entries); err != nil {
+			l.logger.LogError(ctx, "Failed to write entries to the shadow repository", err,
+				"entries", len(write.entries))
+		}
+		return
+	}
+	for _, entry := range write.entries {
+		if err := l.shadow.AddEntry(ctx, entry); err != nil {
+			l.logger.LogError(ctx, "Failed to write entry to the shadow repository", err,
+				"user", entry.User)
+		}
+	}
+}
+
+// Close stops accepting shadow writes and returns once the queued ones have
+// been applied
+func (l *ShadowLedger) Close() {
+	l.queue.Close()
+}
+
+// markWritten records the users of entries for the next comparison
+func (l *ShadowLedger) markWritten(entries ...entity.LedgerEntry) {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	for _, entry := range entries {
+		l.written[entry.User] = struct{}{}
+	}
+}
+
+// GetBalance returns the balance for a specific user from the primary
+func (l *ShadowLedger) GetBalance(ctx context.Context, user string) (*entity.BalanceResponse, error) {
+	return l.primary.GetBalance(ctx, user)
+}
+
+// Compare compares the balances of the users written since the last call.
+// Zero balances are left out, as compaction drops them from the primary
+// only, and amounts are compared as numbers, so "1.50" matches "1.5". Users
+// with a write still on its way to the shadow, or whose balances cannot be
+// read, are compared again next time. Compare must not be called
+// concurrently.
+func (l *ShadowLedger) Compare(ctx context.Context) (ShadowComparison, error) {
+	var result ShadowComparison
+	l.stateMu.Lock()
+	users := slices.Sorted(maps.Keys(l.written))
+	l.written = make(map[string]struct{})
+	result.Dropped, l.dropped = l.dropped, 0
+	l.stateMu.Unlock()
+
+	var unsettled []string
+	defer func() { l.markWritten(usersAsEntries(unsettled)...) }()
+	for i, user := range users {
+		if err := ctx.Err(); err != nil {
+			unsettled = append(unsettled, users[i:]...)
+			return result, err
+		}
+		primary, shadow, settled, err := l.balances(ctx, user)
+		if err != nil {
+			unsettled = append(unsettled, users[i:]...)
+			return result, err
+		}
+		if !settled {
+			unsettled = append(unsettled, user)
+			continue
+		}
+		result.Users++
+		if !maps.Equal(primary, shadow) {
+			result.Mismatches = append(result.Mismatches, ShadowMismatch{User: user, Primary: primary, Shadow: shadow})
+		}
+	}
+	return result, nil
+}
+
+// balances reads user's nonzero balances from both repositories, normalized
+// for comparison. They are not settled if a write of user was under way
+// before or while they were read, as it may have reached only one of them.
+func (l *ShadowLedger) balances(ctx context.Context, user string) (map[string]string, map[string]string, bool, error) {
+	version, idle := l.writeState(user)
+	if !idle {
+		return nil, nil, false, nil
+	}
+	primary, err := l.primary.GetBalance(ctx, user)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to read balance of %s from the primary repository: %w", user, err)
+	}
+	shadow, err := l.shadow.GetBalance(ctx, user)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to read balance of %s from the shadow repository: %w", user, err)
+	}
+
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	if l.pending[user] > 0 || l.versions[user] != version {
+		return nil, nil, false, nil
+	}
+	// Later writes count again from zero; only Compare removes versions,
+	// so none can be mistaken for this one
+	delete(l.versions, user)
+	return nonzeroBalances(primary), nonzeroBalances(shadow), true, nil
+}
+
+// writeState returns the version of user's writes and whether none is under
+// way
+func (l *ShadowLedger) writeState(user string) (uint64, bool) {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	return l.versions[user], l.pending[user] == 0
+}
+
+// nonzeroBalances returns the nonzero balances of balance in canonical form
+func nonzeroBalances(balance *entity.BalanceResponse) map[string]string {
+	result := make(map[string]string)
+	if balance == nil {
+		return result
+	}
+	for asset, amount := range balance.Balances {
+		value, err := decimal.NewFromString(amount)
+		if err != nil {
+			result[asset] = amount
+			continue
+		}
+		if !value.IsZero() {
+			result[asset] = value.String()
+		}
+	}
+	return result
+}
+
+// usersAsEntries returns an entry per user, to mark them written again
+func usersAsEntries(users []string) []entity.LedgerEntry {
+	entries := make([]entity.LedgerEntry, len(users))
+	for i, user := range users {
+		entries[i].User = user
+	}
+	return entries
+}
+
+// EachEntry lists entries from the primary repository
+func (l *ShadowLedger) EachEntry(ctx context.Context, user string, after uint64, fn func(entity.LedgerEntry) error) error {
+	history, ok := l.primary.(port.LedgerHistoryRepository)
+	if !ok {
+		return entity.ErrHistoryUnsupported
+	}
+	return history.EachEntry(ctx, user, after, fn)
+}
+
+// Compact compacts the primary repository
+func (l *ShadowLedger) Compact(ctx context.Context, idleSince time.Time, archive func(entity.ArchivedUser) error) (entity.CompactionResult, error) {
+	compactor, ok := l.primary.(port.LedgerCompactor)
+	if !ok {
+		return entity.CompactionResult{}, entity.ErrCompactionUnsupported
+	}
+	return compactor.Compact(ctx, idleSince, archive)
+}
+
+// Prune prunes the primary repository
+func (l *ShadowLedger) Prune(ctx context.Context, before time.Time, archive func([]entity.LedgerEntry) error) (int, error) {
+	pruner, ok := l.primary.(port.LedgerPruner)
+	if !ok {
+		return 0, entity.ErrPruningUnsupported
+	}
+	return pruner.Prune(ctx, before, archive)
+}
+
+// TopHolders ranks the holders of asset in the primary repository
+func (l *ShadowLedger) TopHolders(ctx context.Context, asset string, n int) ([]entity.Holder, error) {
+	holdings, ok := l.primary.(port.LedgerHoldingsRepository)
+	if !ok {
+		return nil, entity.ErrHoldingsUnsupported
+	}
+	return holdings.TopHolders(ctx, asset, n)
+}
+
+// BalanceDistributions returns how balances are spread in the primary
+// repository
+func (l *ShadowLedger) BalanceDistributions(ctx context.Context, asset string) ([]entity.BalanceDistribution, error) {
+	holdings, ok := l.primary.(port.LedgerHoldingsRepository)
+	if !ok {
+		return nil, entity.ErrHoldingsUnsupported
+	}
+	return holdings.BalanceDistributions(ctx, asset)
+}
+
+// PlaceHold sets hold aside in the primary repository. Holds change no
+// balance, so the shadow does not get them.
+func (l *ShadowLedger) PlaceHold(ctx context.Context, hold entity.Hold) error {
+	holds, ok := l.primary.(port.LedgerHoldRepository)
+	if !ok {
+		return entity.ErrHoldsUnsupported
+	}
+	return holds.PlaceHold(ctx, hold)
+}
+
+// ReleaseHold drops the hold id from the primary repository
+func (l *ShadowLedger) ReleaseHold(ctx context.Context, id string) (bool, error) {
+	holds, ok := l.primary.(port.LedgerHoldRepository)
+	if !ok {
+		return false, entity.ErrHoldsUnsupported
+	}
+	return holds.ReleaseHold(ctx, id)
+}
+
+// CaptureHold captures the hold id in the primary repository and queues
+// entry for the shadow
+func (l *ShadowLedger) CaptureHold(ctx context.Context, id string, entry entity.LedgerEntry) error {
+	holds, ok := l.primary.(port.LedgerHoldRepository)
+	if !ok {
+		return entity.ErrHoldsUnsupported
+	}
+	l.begin(entry)
+	if err := holds.CaptureHold(ctx, id, entry); err != nil {
+		l.done(entry)
+		return err
+	}
+	l.enqueue(shadowWrite{entries: []entity.LedgerEntry{entry}})
+	return nil
+}
+
+// Shared reports whether the primary repository is shared between replicas
+func (l *ShadowLedger) Shared() bool {
+	shared, ok := l.primary.(port.SharedStore)
+	return ok && shared.Shared()
+}
+
+// EntryCount returns the number of entries in the primary repository, or -1
+// if it cannot report it
+func (l *ShadowLedger) EntryCount() int {
+	if counter, ok := l.primary.(interface{ EntryCount() int }); ok {
+		return counter.EntryCount()
+	}
+	return -1
+}
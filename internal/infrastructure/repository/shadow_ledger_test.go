@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+	"kii.com/internal/infrastructure/logger"
+)
+
+// failingLedger rejects every write
+type failingLedger struct {
+	*InMemoryLedger
+}
+
+func (failingLedger) AddEntry(context.Context, entity.LedgerEntry) error {
+	return errors.New("shadow unavailable")
+}
+
+// newTestShadowLedger creates a shadow ledger closed when the test ends
+func newTestShadowLedger(t *testing.T, primary, shadow port.LedgerRepository, queueSize int) *ShadowLedger {
+	t.Helper()
+	ledger, err := NewShadowLedger(primary, shadow, queueSize, logger.NewLogger())
+	if err != nil {
+		t.Fatalf("NewShadowLedger() error = %v", err)
+	}
+	t.Cleanup(ledger.Close)
+	return ledger
+}
+
+// waitForShadow waits until ledger has applied every queued write to its
+// shadow
+func waitForShadow(t *testing.T, ledger *ShadowLedger) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ledger.stateMu.Lock()
+		pending := len(ledger.pending)
+		ledger.stateMu.Unlock()
+		if pending == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("shadow writes still pending")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestShadowLedger_MirrorsWrites(t *testing.T) {
+	primary := NewInMemoryLedger(logger.NewLogger())
+	shadow := NewInMemoryLedger(logger.NewLogger())
+	ledger := newTestShadowLedger(t, primary, shadow, 10)
+	ctx := context.Background()
+
+	if err := ledger.AddEntry(ctx, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1.5"}); err != nil {
+		t.Fatalf("AddEntry() error = %v", err)
+	}
+	if err := ledger.AddEntries(ctx, []entity.LedgerEntry{
+		{User: "user1", Asset: "ETH", Amount: "2"},
+		{User: "user2", Asset: "BTC", Amount: "3"},
+	}); err != nil {
+		t.Fatalf("AddEntries() error = %v", err)
+	}
+	waitForShadow(t, ledger)
+
+	for _, user := range []string{"user1", "user2"} {
+		want, _ := primary.GetBalance(ctx, user)
+		got, _ := shadow.GetBalance(ctx, user)
+		if len(got.Balances) != len(want.Balances) {
+			t.Errorf("shadow balances of %s = %v, want %v", user, got.Balances, want.Balances)
+		}
+	}
+
+	result, err := ledger.Compare(ctx)
+	if err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+	if result.Users != 2 || len(result.Mismatches) != 0 {
+		t.Errorf("Compare() = %+v, want 2 users without mismatches", result)
+	}
+
+	// Only users written since the last comparison are compared again
+	result, _ = ledger.Compare(ctx)
+	if result.Users != 0 {
+		t.Errorf("Compare() users = %d, want 0 without new writes", result.Users)
+	}
+}
+
+func TestShadowLedger_ReportsMismatches(t *testing.T) {
+	primary := NewInMemoryLedger(logger.NewLogger())
+	shadow := NewInMemoryLedger(logger.NewLogger())
+	ledger := newTestShadowLedger(t, primary, shadow, 10)
+	ctx := context.Background()
+
+	// The shadow lacks an entry applied before it was added
+	if err := primary.AddEntry(ctx, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"}); err != nil {
+		t.Fatalf("AddEntry() error = %v", err)
+	}
+	if err := ledger.AddEntry(ctx, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"}); err != nil {
+		t.Fatalf("AddEntry() error = %v", err)
+	}
+	// A zero balance the shadow has no record of is not a mismatch
+	if err := primary.AddEntry(ctx, entity.LedgerEntry{User: "user2", Asset: "ETH", Amount: "0"}); err != nil {
+		t.Fatalf("AddEntry() error = %v", err)
+	}
+	if err := ledger.AddEntry(ctx, entity.LedgerEntry{User: "user2", Asset: "BTC", Amount: "1"}); err != nil {
+		t.Fatalf("AddEntry() error = %v", err)
+	}
+	waitForShadow(t, ledger)
+
+	result, err := ledger.Compare(ctx)
+	if err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+	if result.Users != 2 || len(result.Mismatches) != 1 {
+		t.Fatalf("Compare() = %+v, want 1 mismatch among 2 users", result)
+	}
+	mismatch := result.Mismatches[0]
+	if mismatch.User != "user1" || mismatch.Primary["BTC"] != "2" || mismatch.Shadow["BTC"] != "1" {
+		t.Errorf("mismatch = %+v, want user1 with BTC 2 in the primary and 1 in the shadow", mismatch)
+	}
+}
+
+func TestShadowLedger_ShadowFailuresAreNotReturned(t *testing.T) {
+	primary := NewInMemoryLedger(logger.NewLogger())
+	shadow := failingLedger{NewInMemoryLedger(logger.NewLogger()).(*InMemoryLedger)}
+	ledger := newTestShadowLedger(t, primary, shadow, 10)
+	ctx := context.Background()
+
+	if err := ledger.AddEntry(ctx, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"}); err != nil {
+		t.Fatalf("AddEntry() error = %v, want the shadow's failure logged only", err)
+	}
+	balance, _ := ledger.GetBalance(ctx, "user1")
+	if balance.Balances["BTC"] != "1.00000000" {
+		t.Errorf("balance = %v, want 1.00000000 from the primary", balance.Balances["BTC"])
+	}
+	waitForShadow(t, ledger)
+	result, _ := ledger.Compare(ctx)
+	if len(result.Mismatches) != 1 {
+		t.Errorf("Compare() = %+v, want the missed write reported", result)
+	}
+}
+
+func TestShadowLedger_BatchNeedsBatchPrimary(t *testing.T) {
+	primary := struct{ port.LedgerRepository }{NewInMemoryLedger(logger.NewLogger())}
+	ledger := newTestShadowLedger(t, primary, NewInMemoryLedger(logger.NewLogger()), 10)
+
+	err := ledger.AddEntries(context.Background(), []entity.LedgerEntry{{User: "user1", Asset: "BTC", Amount: "1"}})
+	if !errors.Is(err, entity.ErrBatchUnsupported) {
+		t.Errorf("AddEntries() error = %v, want ErrBatchUnsupported", err)
+	}
+}
+
+// blockingLedger holds every write until release is closed
+type blockingLedger struct {
+	*InMemoryLedger
+	release chan struct{}
+}
+
+func (l blockingLedger) AddEntry(ctx context.Context, entry entity.LedgerEntry) error {
+	<-l.release
+	return l.InMemoryLedger.AddEntry(ctx, entry)
+}
+
+func TestShadowLedger_SlowShadow(t *testing.T) {
+	primary := NewInMemoryLedger(logger.NewLogger())
+	shadow := blockingLedger{NewInMemoryLedger(logger.NewLogger()).(*InMemoryLedger), make(chan struct{})}
+	ledger := newTestShadowLedger(t, primary, shadow, 1)
+	ctx := context.Background()
+
+	// Writes return without waiting for the shadow; the one finding the
+	// queue full is dropped
+	for range 3 {
+		if err := ledger.AddEntry(ctx, entity.LedgerEntry{User: "user1", Asset: "BTC", Amount: "1"}); err != nil {
+			t.Fatalf("AddEntry() error = %v", err)
+		}
+	}
+
+	// A user with a write on its way is not compared yet
+	result, err := ledger.Compare(ctx)
+	if err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+	if result.Users != 0 || result.Dropped == 0 {
+		t.Errorf("Compare() with pending writes = %+v, want no users and the dropped write", result)
+	}
+
+	close(shadow.release)
+	waitForShadow(t, ledger)
+	result, _ = ledger.Compare(ctx)
+	if result.Users != 1 || len(result.Mismatches) != 1 || result.Dropped != 0 {
+		t.Errorf("Compare() = %+v, want user1 compared later and the dropped write reported as a mismatch", result)
+	}
+}
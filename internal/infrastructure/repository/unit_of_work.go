@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"maps"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+)
+
+// StagingUnitOfWork implements port.UnitOfWork over any repository that can
+// apply a batch atomically: entries added in a unit of work are staged in
+// memory and written with a single AddEntries once it succeeds. Balances
+// read in a unit of work are those of the repository plus the entries staged
+// so far; they are not locked, so a check against them can be overtaken by a
+// concurrent write before the commit.
+type StagingUnitOfWork struct {
+	repo port.BatchLedgerRepository
+}
+
+// NewUnitOfWork creates a unit of work that commits to repo
+func NewUnitOfWork(repo port.BatchLedgerRepository) *StagingUnitOfWork {
+	return &StagingUnitOfWork{repo: repo}
+}
+
+// Do calls fn with a transaction staging its entries, and applies them all
+// once fn returns nil. A unit of work that added nothing writes nothing.
+func (u *StagingUnitOfWork) Do(ctx context.Context, fn func(tx port.LedgerRepository) error) (err error) {
+	ctx, span := startSpan(ctx, "StagingUnitOfWork.Do")
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	tx := &stagingTx{repo: u.repo}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.Int("ledger.batch_size", len(tx.entries)))
+	if len(tx.entries) == 0 {
+		return nil
+	}
+	return u.repo.AddEntries(ctx, tx.entries)
+}
+
+// stagingTx is the repository a StagingUnitOfWork hands to its function. It
+// is only used from that function's goroutine.
+type stagingTx struct {
+	repo    port.LedgerRepository
+	entries []entity.LedgerEntry
+}
+
+// AddEntry stages entry, rejecting an invalid amount at once
+func (tx *stagingTx) AddEntry(ctx context.Context, entry entity.LedgerEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if _, err := parseAmount(entry.Amount); err != nil {
+		return entity.ErrInvalidAmount.Wrap(err)
+	}
+	tx.entries = append(tx.entries, entry)
+	return nil
+}
+
+// GetBalance returns the balance of user in the repository with the entries
+// staged for them added to the totals and what is available
+func (tx *stagingTx) GetBalance(ctx context.Context, user string) (*entity.BalanceResponse, error) {
+	balance, err := tx.repo.GetBalance(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	staged := &entity.BalanceResponse{
+		User:     balance.User,
+		Balances: maps.Clone(balance.Balances),
+		Held:     balance.Held,
+		Sequence: balance.Sequence,
+	}
+	if staged.Balances == nil {
+		staged.Balances = make(map[string]string)
+	}
+	for _, entry := range tx.entries {
+		if entry.User != user {
+			continue
+		}
+		newBalance, err := addDecimalStrings(staged.Balances[entry.Asset], entry.Amount)
+		if err != nil {
+			return nil, entity.ErrInvalidAmount.Wrap(err)
+		}
+		staged.Balances[entry.Asset] = newBalance
+	}
+	if balance.Held != nil {
+		staged.Available = availableBalances(staged.Balances, staged.Held)
+	}
+	return staged, nil
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+	"kii.com/internal/infrastructure/logger"
+)
+
+func TestStagingUnitOfWork_Do(t *testing.T) {
+	ctx := context.Background()
+	repo := &recordingLedger{InMemoryLedger: NewInMemoryLedger(logger.NewLogger()).(*InMemoryLedger)}
+	if err := repo.AddEntry(ctx, entity.LedgerEntry{User: "alice", Asset: "BTC", Amount: "5"}); err != nil {
+		t.Fatalf("AddEntry() error = %v", err)
+	}
+	uow := NewUnitOfWork(repo)
+
+	// A transfer reads the balance it debits, including what it staged
+	err := uow.Do(ctx, func(tx port.LedgerRepository) error {
+		if err := tx.AddEntry(ctx, entity.LedgerEntry{User: "alice", Asset: "BTC", Amount: "-2"}); err != nil {
+			return err
+		}
+		if err := tx.AddEntry(ctx, entity.LedgerEntry{User: "bob", Asset: "BTC", Amount: "2"}); err != nil {
+			return err
+		}
+		balance, err := tx.GetBalance(ctx, "alice")
+		if err != nil {
+			return err
+		}
+		if balance.Balances["BTC"] != "3.00000000" {
+			t.Errorf("staged balance = %v, want 3.00000000", balance.Balances["BTC"])
+		}
+		// Nothing is applied before the commit
+		if applied, _ := repo.GetBalance(ctx, "bob"); len(applied.Balances) != 0 {
+			t.Errorf("balance before commit = %v, want none", applied.Balances)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if len(repo.batches) != 1 || repo.batches[0] != 2 {
+		t.Errorf("batches = %v, want one batch of 2", repo.batches)
+	}
+	for user, want := range map[string]string{"alice": "3.00000000", "bob": "2.00000000"} {
+		balance, _ := repo.GetBalance(ctx, user)
+		if balance.Balances["BTC"] != want {
+			t.Errorf("%s balance = %v, want %v", user, balance.Balances["BTC"], want)
+		}
+	}
+}
+
+func TestStagingUnitOfWork_Rollback(t *testing.T) {
+	ctx := context.Background()
+	errAbort := errors.New("abort")
+
+	tests := []struct {
+		name    string
+		fn      func(tx port.LedgerRepository) error
+		wantErr error
+	}{
+		{
+			name: "function fails",
+			fn: func(tx port.LedgerRepository) error {
+				if err := tx.AddEntry(ctx, entity.LedgerEntry{User: "alice", Asset: "BTC", Amount: "1"}); err != nil {
+					return err
+				}
+				return errAbort
+			},
+			wantErr: errAbort,
+		},
+		{
+			name: "invalid amount",
+			fn: func(tx port.LedgerRepository) error {
+				if err := tx.AddEntry(ctx, entity.LedgerEntry{User: "alice", Asset: "BTC", Amount: "1"}); err != nil {
+					return err
+				}
+				return tx.AddEntry(ctx, entity.LedgerEntry{User: "bob", Asset: "BTC", Amount: "lots"})
+			},
+			wantErr: entity.ErrInvalidAmount,
+		},
+		{
+			name:    "nothing added",
+			fn:      func(tx port.LedgerRepository) error { return nil },
+			wantErr: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &recordingLedger{InMemoryLedger: NewInMemoryLedger(logger.NewLogger()).(*InMemoryLedger)}
+			err := NewUnitOfWork(repo).Do(ctx, tt.fn)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Do() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(repo.batches) != 0 {
+				t.Errorf("batches = %v, want nothing written", repo.batches)
+			}
+			if repo.EntryCount() != 0 {
+				t.Errorf("EntryCount() = %d, want 0", repo.EntryCount())
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"kii.com/internal/domain/entity"
+)
+
+// FileUserArchive implements the UserArchive port by appending each archived
+// user as a line of JSON to a file, synced before Archive returns
+type FileUserArchive struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenFileUserArchive opens the archive at path for appending, creating it
+// if needed
+func OpenFileUserArchive(path string) (*FileUserArchive, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open user archive: %w", err)
+	}
+	return &FileUserArchive{file: file}, nil
+}
+
+// Archive appends user to the archive
+func (a *FileUserArchive) Archive(_ context.Context, user entity.ArchivedUser) error {
+	line, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write user archive: %w", err)
+	}
+	return a.file.Sync()
+}
+
+// Close closes the archive file
+func (a *FileUserArchive) Close() error {
+	return a.file.Close()
+}
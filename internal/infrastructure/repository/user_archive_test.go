@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kii.com/internal/domain/entity"
+)
+
+func TestFileUserArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.ndjson")
+	ctx := context.Background()
+
+	// Reopening appends to the archive instead of replacing it
+	for _, user := range []string{"user1", "user2"} {
+		archive, err := OpenFileUserArchive(path)
+		if err != nil {
+			t.Fatalf("OpenFileUserArchive() error = %v", err)
+		}
+		if err := archive.Archive(ctx, entity.ArchivedUser{
+			User:         user,
+			LastActivity: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			Entries:      []entity.LedgerEntry{{Sequence: 1, UserSequence: 1, User: user, Asset: "BTC", Amount: "1"}},
+		}); err != nil {
+			t.Fatalf("Archive() error = %v", err)
+		}
+		if err := archive.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var users []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var archived entity.ArchivedUser
+		if err := json.Unmarshal(scanner.Bytes(), &archived); err != nil {
+			t.Fatalf("archive line %q: %v", scanner.Text(), err)
+		}
+		users = append(users, archived.User)
+	}
+	if len(users) != 2 || users[0] != "user1" || users[1] != "user2" {
+		t.Errorf("archived users = %v, want [user1 user2]", users)
+	}
+}
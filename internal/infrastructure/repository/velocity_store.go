@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// credit is an amount recorded by InMemoryVelocityStore
+type credit struct {
+	amount decimal.Decimal
+	at     time.Time
+}
+
+// InMemoryVelocityStore implements the VelocityStore port. Credits older
+// than the retention are dropped, so it only needs to be at least the
+// longest velocity window.
+type InMemoryVelocityStore struct {
+	mu        sync.Mutex
+	credits   map[string][]credit
+	retention time.Duration
+}
+
+// NewInMemoryVelocityStore creates a velocity store keeping credits for
+// retention
+func NewInMemoryVelocityStore(retention time.Duration) *InMemoryVelocityStore {
+	return &InMemoryVelocityStore{
+		credits:   make(map[string][]credit),
+		retention: retention,
+	}
+}
+
+// Add records amount credited to user in asset at the given time
+func (s *InMemoryVelocityStore) Add(user, asset string, amount decimal.Decimal, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := velocityKey(user, asset)
+	credits := s.credits[key]
+	// Credits are added in roughly time order, so expired ones are at the front
+	cutoff := at.Add(-s.retention)
+	expired := 0
+	for expired < len(credits) && credits[expired].at.Before(cutoff) {
+		expired++
+	}
+	s.credits[key] = append(credits[expired:], credit{amount: amount, at: at})
+}
+
+// Sum returns the total credited to user in asset since the given time
+func (s *InMemoryVelocityStore) Sum(user, asset string, since time.Time) decimal.Decimal {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sum := decimal.Zero
+	for _, c := range s.credits[velocityKey(user, asset)] {
+		if !c.at.Before(since) {
+			sum = sum.Add(c.amount)
+		}
+	}
+	return sum
+}
+
+func velocityKey(user, asset string) string {
+	return user + "\x00" + asset
+}
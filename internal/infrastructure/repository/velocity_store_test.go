@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestInMemoryVelocityStore(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	store := NewInMemoryVelocityStore(time.Hour)
+	store.Add("user1", "BTC", decimal.RequireFromString("1"), now.Add(-50*time.Minute))
+	store.Add("user1", "BTC", decimal.RequireFromString("2"), now.Add(-10*time.Minute))
+	store.Add("user1", "BTC", decimal.RequireFromString("-2"), now.Add(-5*time.Minute))
+	store.Add("user1", "ETH", decimal.RequireFromString("4"), now)
+	store.Add("user2", "BTC", decimal.RequireFromString("8"), now)
+
+	tests := []struct {
+		user  string
+		asset string
+		since time.Time
+		want  string
+	}{
+		{"user1", "BTC", now.Add(-time.Hour), "1"},
+		{"user1", "BTC", now.Add(-30 * time.Minute), "0"},
+		{"user1", "ETH", now.Add(-time.Hour), "4"},
+		{"user2", "BTC", now, "8"},
+		{"user3", "BTC", now.Add(-time.Hour), "0"},
+	}
+	for _, tt := range tests {
+		if got := store.Sum(tt.user, tt.asset, tt.since); !got.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("Sum(%s, %s, %s) = %s, want %s", tt.user, tt.asset, tt.since.Format(time.Kitchen), got, tt.want)
+		}
+	}
+
+	// Credits past the retention are dropped when the user is credited again
+	store.Add("user1", "BTC", decimal.RequireFromString("3"), now.Add(20*time.Minute))
+	if got := len(store.credits[velocityKey("user1", "BTC")]); got != 3 {
+		t.Errorf("kept %d credits, want 3 within the retention", got)
+	}
+}
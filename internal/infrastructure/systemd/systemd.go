@@ -0,0 +1,108 @@
+// Package systemd integrates the server with systemd: it takes over the
+// listeners passed by socket activation and reports the service state to
+// the service manager, as sd_listen_fds(3) and sd_notify(3) describe
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// listenFDsStart is the first file descriptor passed by socket activation
+const listenFDsStart = 3
+
+// Service states sent with Notify
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Listeners returns the listeners passed by socket activation, or none when
+// the process was not socket-activated. The activation variables are unset
+// so that child processes do not take the listeners for theirs.
+func Listeners() ([]net.Listener, error) {
+	defer func() {
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	return listeners(os.Getenv, listenFDsStart)
+}
+
+// listeners returns the listeners passed from firstFD on, as described by
+// the activation variables read with getenv
+func listeners(getenv func(string) string, firstFD int) ([]net.Listener, error) {
+	if pid, err := strconv.Atoi(getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", getenv("LISTEN_FDS"))
+	}
+	names := strings.Split(getenv("LISTEN_FDNAMES"), ":")
+
+	result := make([]net.Listener, 0, count)
+	for i := range count {
+		fd := firstFD + i
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		syscall.CloseOnExec(fd)
+		file := os.NewFile(uintptr(fd), name)
+		listener, err := net.FileListener(file)
+		// FileListener works on a duplicate of the descriptor
+		_ = file.Close()
+		if err != nil {
+			for _, l := range result {
+				_ = l.Close()
+			}
+			return nil, fmt.Errorf("socket activation descriptor %d (%s): %w", fd, name, err)
+		}
+		result = append(result, listener)
+	}
+	return result, nil
+}
+
+// Notify sends state, such as Ready, to the service manager. It reports
+// false without an error when the service manager expects no notifications.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// A leading @ names a socket in the abstract namespace
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to NOTIFY_SOCKET: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("failed to notify systemd: %w", err)
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns how often the service manager expects Watchdog
+// notifications: half its watchdog timeout, as sd_watchdog_enabled(3)
+// recommends. It returns zero when the watchdog is disabled.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseUint(os.Getenv("WATCHDOG_USEC"), 10, 63)
+	if err != nil || usec == 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
@@ -0,0 +1,97 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestListeners(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer tcp.Close()
+	file, err := tcp.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	// listeners takes ownership of the descriptor, as of those systemd passes
+	fd, err := syscall.Dup(int(file.Fd()))
+	_ = file.Close()
+	if err != nil {
+		t.Fatalf("Dup() error = %v", err)
+	}
+
+	env := map[string]string{
+		"LISTEN_PID":     strconv.Itoa(os.Getpid()),
+		"LISTEN_FDS":     "1",
+		"LISTEN_FDNAMES": "kii",
+	}
+	got, err := listeners(func(key string) string { return env[key] }, fd)
+	if err != nil {
+		t.Fatalf("listeners() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Addr().String() != tcp.Addr().String() {
+		t.Fatalf("listeners() = %v, want the listener on %s", got, tcp.Addr())
+	}
+	_ = got[0].Close()
+
+	// Activation meant for another process is ignored
+	env["LISTEN_PID"] = "1"
+	if got, err := listeners(func(key string) string { return env[key] }, fd); len(got) != 0 || err != nil {
+		t.Errorf("listeners() for another process = %v, %v, want none", got, err)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	if sent, err := Notify(Ready); sent || err != nil {
+		t.Errorf("Notify() without NOTIFY_SOCKET = %v, %v, want nothing sent", sent, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("ListenUnixgram() error = %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	if sent, err := Notify(Ready); !sent || err != nil {
+		t.Fatalf("Notify() = %v, %v, want sent", sent, err)
+	}
+	buf := make([]byte, 64)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != Ready {
+		t.Errorf("received %q, %v, want %q", buf[:n], err, Ready)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		name string
+		usec string
+		pid  string
+		want time.Duration
+	}{
+		{name: "disabled", want: 0},
+		{name: "enabled", usec: "30000000", want: 15 * time.Second},
+		{name: "for this process", usec: "30000000", pid: strconv.Itoa(os.Getpid()), want: 15 * time.Second},
+		{name: "for another process", usec: "30000000", pid: "1", want: 0},
+		{name: "invalid", usec: "soon", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+			if got := WatchdogInterval(); got != tt.want {
+				t.Errorf("WatchdogInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package validator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/metrics"
+)
+
+// Canary comparison results, tagged on the webhook.canary counter
+const (
+	CanaryAgree             = "agree"
+	CanaryCandidateRejected = "candidate_rejected"
+	CanaryCandidateAccepted = "candidate_accepted"
+)
+
+// CanaryValidator checks each webhook with a primary validator, whose verdict
+// stands, and in parallel with a candidate, such as one with a new secret or
+// signature scheme. The candidate's verdicts are only counted, and logged
+// where they differ, so a migration can be made once both agree on real
+// traffic.
+type CanaryValidator struct {
+	name      string
+	primary   port.WebhookValidator
+	candidate port.WebhookValidator
+	metrics   metrics.Emitter
+	logger    logger.Logger
+}
+
+// NewCanaryValidator creates a validator deciding with primary and comparing
+// candidate to it. name tells the endpoints' canaries apart in logs and
+// metrics. The candidate needs a nonce store of its own: one shared with the
+// primary would take every webhook for a replay.
+func NewCanaryValidator(
+	name string,
+	primary, candidate port.WebhookValidator,
+	emitter metrics.Emitter,
+	logger logger.Logger,
+) *CanaryValidator {
+	return &CanaryValidator{
+		name:      name,
+		primary:   primary,
+		candidate: candidate,
+		metrics:   emitter,
+		logger:    logger,
+	}
+}
+
+// ValidateRequest returns the primary validator's verdict, once the candidate
+// has given its own
+func (v *CanaryValidator) ValidateRequest(ctx context.Context, r *http.Request, body []byte) error {
+	candidateErr := make(chan error, 1)
+	go func() {
+		// A candidate under test must not take the process down
+		defer func() {
+			if p := recover(); p != nil {
+				candidateErr <- fmt.Errorf("candidate validator panicked: %v", p)
+			}
+		}()
+		candidateErr <- v.candidate.ValidateRequest(ctx, r, body)
+	}()
+
+	err := v.primary.ValidateRequest(ctx, r, body)
+	v.compare(ctx, err, <-candidateErr)
+	return err
+}
+
+// compare counts and logs how the candidate's verdict relates to the
+// primary's. Replays are not compared: the candidate's nonce store is not
+// shared with other instances, so it cannot tell a webhook resent to another
+// one.
+func (v *CanaryValidator) compare(ctx context.Context, primaryErr, candidateErr error) {
+	if errors.Is(primaryErr, entity.ErrReplayDetected) {
+		return
+	}
+
+	result := CanaryAgree
+	switch {
+	case primaryErr == nil && candidateErr != nil:
+		result = CanaryCandidateRejected
+		v.logger.LogWarning(ctx, "Canary validator rejected an accepted webhook",
+			"canary", v.name,
+			"candidate_error", candidateErr.Error())
+	case primaryErr != nil && candidateErr == nil:
+		result = CanaryCandidateAccepted
+		v.logger.LogWarning(ctx, "Canary validator accepted a rejected webhook",
+			"canary", v.name,
+			"primary_error", primaryErr.Error())
+	}
+	v.metrics.Count("webhook.canary", 1, "canary:"+v.name, "result:"+result)
+}
+
+// TimestampTolerance returns the timestamp tolerance of the primary
+// validator, zero when it has none
+func (v *CanaryValidator) TimestampTolerance() time.Duration {
+	if getter, ok := v.primary.(interface{ TimestampTolerance() time.Duration }); ok {
+		return getter.TimestampTolerance()
+	}
+	return 0
+}
+
+// SetTimestampTolerance changes the timestamp tolerance of both validators,
+// when they have one, so that they keep checking alike
+func (v *CanaryValidator) SetTimestampTolerance(tolerance time.Duration) {
+	for _, validator := range []port.WebhookValidator{v.primary, v.candidate} {
+		if setter, ok := validator.(interface{ SetTimestampTolerance(time.Duration) }); ok {
+			setter.SetTimestampTolerance(tolerance)
+		}
+	}
+}
+
+// ReleaseNonce forgets the nonce of r in both validators, when they record
+// nonces, so that a retry is not taken for a replay by either
+func (v *CanaryValidator) ReleaseNonce(r *http.Request) {
+	for _, validator := range []port.WebhookValidator{v.primary, v.candidate} {
+		if releaser, ok := validator.(port.NonceReleaser); ok {
+			releaser.ReleaseNonce(r)
+		}
+	}
+}
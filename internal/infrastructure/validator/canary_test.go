@@ -0,0 +1,152 @@
+package validator
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/metrics"
+)
+
+// validatorFunc adapts a function to port.WebhookValidator
+type validatorFunc func(ctx context.Context, r *http.Request, body []byte) error
+
+func (f validatorFunc) ValidateRequest(ctx context.Context, r *http.Request, body []byte) error {
+	return f(ctx, r, body)
+}
+
+// countingEmitter records the tags of each counter increment
+type countingEmitter struct {
+	metrics.NopEmitter
+	mu     sync.Mutex
+	counts []string
+}
+
+func (e *countingEmitter) Count(name string, _ int64, tags ...string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.counts = append(e.counts, name+" "+strings.Join(tags, ","))
+}
+
+func TestCanaryValidator(t *testing.T) {
+	invalid := errors.New("invalid signature")
+	replay := fmt.Errorf("%w: possible replay attack", entity.ErrReplayDetected)
+
+	tests := []struct {
+		name         string
+		primaryErr   error
+		candidate    validatorFunc
+		wantErr      error
+		wantCounts   string
+		wantNoCounts bool
+	}{
+		{
+			name:       "both accept",
+			candidate:  func(context.Context, *http.Request, []byte) error { return nil },
+			wantCounts: "webhook.canary canary:default,result:agree",
+		},
+		{
+			name:       "both reject",
+			primaryErr: invalid,
+			candidate:  func(context.Context, *http.Request, []byte) error { return invalid },
+			wantErr:    invalid,
+			wantCounts: "webhook.canary canary:default,result:agree",
+		},
+		{
+			name:       "candidate rejects",
+			candidate:  func(context.Context, *http.Request, []byte) error { return invalid },
+			wantCounts: "webhook.canary canary:default,result:candidate_rejected",
+		},
+		{
+			name:       "candidate accepts",
+			primaryErr: invalid,
+			candidate:  func(context.Context, *http.Request, []byte) error { return nil },
+			wantErr:    invalid,
+			wantCounts: "webhook.canary canary:default,result:candidate_accepted",
+		},
+		{
+			name:       "candidate panics",
+			candidate:  func(context.Context, *http.Request, []byte) error { panic("boom") },
+			wantCounts: "webhook.canary canary:default,result:candidate_rejected",
+		},
+		{
+			name:         "replay is not compared",
+			primaryErr:   replay,
+			candidate:    func(context.Context, *http.Request, []byte) error { return nil },
+			wantErr:      replay,
+			wantNoCounts: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emitter := &countingEmitter{}
+			primary := validatorFunc(func(context.Context, *http.Request, []byte) error { return tt.primaryErr })
+			v := NewCanaryValidator("default", primary, tt.candidate, emitter, logger.NewLogger())
+
+			err := v.ValidateRequest(context.Background(), &http.Request{Header: http.Header{}}, nil)
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("ValidateRequest() error = %v, want the primary's %v", err, tt.wantErr)
+			}
+			got := strings.Join(emitter.counts, ";")
+			if tt.wantNoCounts {
+				if got != "" {
+					t.Errorf("counts = %q, want none", got)
+				}
+				return
+			}
+			if got != tt.wantCounts {
+				t.Errorf("counts = %q, want %q", got, tt.wantCounts)
+			}
+		})
+	}
+}
+
+func TestCanaryValidator_SchemeMigration(t *testing.T) {
+	// The sender signs with the new secret and scheme while the old ones
+	// still decide
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	body := []byte(`{"user":"user1"}`)
+	signature, _ := ComputeSignature("old-secret", timestamp, "nonce-1", body)
+	mac := hmac.New(sha256.New, []byte("new-secret"))
+	writeCanonicalMessage(mac, timestamp, "nonce-1", body)
+
+	scheme, _ := WithScheme(SchemeHMACSHA256Base64)
+	primary := NewHMACValidatorWithNonceStore("old-secret", 5*time.Minute, NewNonceStore(), logger.NewLogger())
+	candidate := NewHMACValidatorWithNonceStore("new-secret", 5*time.Minute, NewNonceStore(), logger.NewLogger(),
+		WithHeaders(DefaultTimestampHeader, DefaultNonceHeader, "X-Signature-V2"), scheme)
+	emitter := &countingEmitter{}
+	v := NewCanaryValidator("default", primary, candidate, emitter, logger.NewLogger())
+
+	r := &http.Request{Header: http.Header{
+		"X-Timestamp":    {timestamp},
+		"X-Nonce":        {"nonce-1"},
+		"X-Signature":    {signature},
+		"X-Signature-V2": {base64.StdEncoding.EncodeToString(mac.Sum(nil))},
+	}}
+	if err := v.ValidateRequest(context.Background(), r, body); err != nil {
+		t.Fatalf("ValidateRequest() error = %v", err)
+	}
+	if got := strings.Join(emitter.counts, ";"); got != "webhook.canary canary:default,result:agree" {
+		t.Errorf("counts = %q, want the candidate to agree", got)
+	}
+
+	v.SetTimestampTolerance(time.Minute)
+	if primary.(*HMACValidator).TimestampTolerance() != time.Minute || candidate.(*HMACValidator).TimestampTolerance() != time.Minute {
+		t.Error("SetTimestampTolerance() did not reach both validators")
+	}
+	if v.TimestampTolerance() != time.Minute {
+		t.Errorf("TimestampTolerance() = %v, want the primary's", v.TimestampTolerance())
+	}
+}
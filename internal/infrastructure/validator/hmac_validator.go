@@ -4,72 +4,170 @@ import (
 	"context"
 	"crypto/hmac"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"hash"
+	"io"
 	"net/http"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"kii.com/internal/domain/entity"
 	"kii.com/internal/domain/port"
+	"kii.com/internal/infrastructure/clock"
 	"kii.com/internal/infrastructure/logger"
 )
 
-// NonceStore tracks used nonces to prevent replay attacks
-type NonceStore struct {
-	mu     sync.RWMutex
-	nonces map[string]time.Time
+// tracer creates spans for signature validation
+var tracer = otel.Tracer("kii.com/internal/infrastructure/validator") //nolint:gochecknoglobals
+
+// signatureHexLen is the length of a hex-encoded HMAC SHA256 signature, the
+// longest supported encoding
+const signatureHexLen = 2 * sha256.Size
+
+// Signature schemes a sender can use
+const (
+	// SchemeHMACSHA256 signs with HMAC SHA256, hex encoded
+	SchemeHMACSHA256 = "hmac-sha256"
+	// SchemeHMACSHA256Base64 signs with HMAC SHA256, standard base64 encoded
+	SchemeHMACSHA256Base64 = "hmac-sha256-base64"
+)
+
+// Timestamp formats a sender can use
+const (
+	// TimestampAuto accepts any of the other formats, telling epoch seconds
+	// from milliseconds by magnitude (the default)
+	TimestampAuto = "auto"
+	// TimestampSeconds is UNIX time in seconds
+	TimestampSeconds = "seconds"
+	// TimestampMilliseconds is UNIX time in milliseconds
+	TimestampMilliseconds = "milliseconds"
+	// TimestampRFC3339 is an RFC 3339 date and time, e.g. 2026-10-01T12:00:00Z
+	TimestampRFC3339 = "rfc3339"
+)
+
+// minEpochMillis is the smallest epoch value read as milliseconds by
+// TimestampAuto. As seconds it would be in the year 5138; as milliseconds it
+// is in 1973.
+const minEpochMillis = 100_000_000_000
+
+// Default request headers carrying the signature inputs
+const (
+	DefaultTimestampHeader = "X-Timestamp"
+	DefaultNonceHeader     = "X-Nonce"
+	DefaultSignatureHeader = "X-Signature"
+)
+
+// HMACValidator implements the WebhookValidator port
+type HMACValidator struct {
+	key                atomic.Pointer[signingKey]
+	nonceStore         port.NonceStore
+	tenant             string
+	timestampTolerance atomic.Int64
+	clock              port.Clock
+	logger             logger.Logger
+	timestampHeader    string
+	nonceHeader        string
+	signatureHeader    string
+	base64             bool
+	timestampFormat    string
+	skew               SkewRecorder
 }
 
-// NewNonceStore creates a new nonce store
-func NewNonceStore() *NonceStore {
-	return &NonceStore{
-		nonces: make(map[string]time.Time),
+// HMACOption configures how an HMACValidator reads and checks signatures
+type HMACOption func(*HMACValidator)
+
+// WithHeaders reads the timestamp, nonce and signature from the given
+// headers instead of X-Timestamp, X-Nonce and X-Signature
+func WithHeaders(timestamp, nonce, signature string) HMACOption {
+	return func(v *HMACValidator) {
+		v.timestampHeader = timestamp
+		v.nonceHeader = nonce
+		v.signatureHeader = signature
 	}
 }
 
-// IsValid checks if a nonce is valid (not seen before) and records it
-func (ns *NonceStore) IsValid(nonce string, timestamp time.Time) bool {
-	ns.mu.Lock()
-	defer ns.mu.Unlock()
-
-	// Check if nonce was already used
-	if existingTime, exists := ns.nonces[nonce]; exists {
-		// Allow cleanup of old nonces (older than 1 hour)
-		if time.Since(existingTime) > time.Hour {
-			delete(ns.nonces, nonce)
-		} else {
-			return false
-		}
+// WithTenant checks nonces within tenant's namespace of the nonce store, so
+// that they only need to be unique among the webhooks tenant sends
+func WithTenant(tenant string) HMACOption {
+	return func(v *HMACValidator) {
+		v.tenant = tenant
 	}
+}
 
-	// Record the nonce
-	ns.nonces[nonce] = timestamp
+// SkewRecorder records the clock skew of signed webhooks: the server's time
+// less their timestamp
+type SkewRecorder interface {
+	RecordSkew(tenant string, skew time.Duration, withinTolerance bool)
+}
 
-	// Cleanup old nonces periodically (simple approach - could be optimized)
-	if len(ns.nonces) > 10000 {
-		ns.cleanup()
+// WithSkewRecorder records the skew of each webhook carrying a valid
+// signature with recorder, including those rejected for their timestamp.
+// Webhooks with an invalid signature are left out, so forged requests cannot
+// distort it, and so are replays within the tolerance.
+func WithSkewRecorder(recorder SkewRecorder) HMACOption {
+	return func(v *HMACValidator) {
+		v.skew = recorder
 	}
+}
 
-	return true
+// WithClock checks timestamps against clock instead of the system clock
+func WithClock(clock port.Clock) HMACOption {
+	return func(v *HMACValidator) {
+		v.clock = clock
+	}
 }
 
-// cleanup removes nonces older than 1 hour
-func (ns *NonceStore) cleanup() {
-	now := time.Now()
-	for nonce, timestamp := range ns.nonces {
-		if now.Sub(timestamp) > time.Hour {
-			delete(ns.nonces, nonce)
-		}
+// WithScheme checks signatures using scheme, one of SchemeHMACSHA256 (the
+// default) or SchemeHMACSHA256Base64
+func WithScheme(scheme string) (HMACOption, error) {
+	switch scheme {
+	case SchemeHMACSHA256, "":
+		return func(v *HMACValidator) { v.base64 = false }, nil
+	case SchemeHMACSHA256Base64:
+		return func(v *HMACValidator) { v.base64 = true }, nil
+	default:
+		return nil, fmt.Errorf("unsupported signature scheme %q (want %s or %s)", scheme, SchemeHMACSHA256, SchemeHMACSHA256Base64)
 	}
 }
 
-// HMACValidator implements the WebhookValidator port
-type HMACValidator struct {
-	secret             string
-	nonceStore         *NonceStore
-	timestampTolerance time.Duration
-	logger             logger.Logger
+// WithTimestampFormat reads the timestamp header in format, one of
+// TimestampAuto (the default), TimestampSeconds, TimestampMilliseconds or
+// TimestampRFC3339
+func WithTimestampFormat(format string) (HMACOption, error) {
+	switch format {
+	case TimestampAuto, TimestampSeconds, TimestampMilliseconds, TimestampRFC3339:
+	case "":
+		format = TimestampAuto
+	default:
+		return nil, fmt.Errorf("unsupported timestamp format %q (want %s, %s, %s or %s)", format,
+			TimestampAuto, TimestampSeconds, TimestampMilliseconds, TimestampRFC3339)
+	}
+	return func(v *HMACValidator) { v.timestampFormat = format }, nil
+}
+
+// signingKey is a secret with its pool of HMAC writers, so signing a request
+// does not rebuild the HMAC state. It is replaced as a whole when the secret
+// changes, so a request is never signed with a writer for an older secret.
+type signingKey struct {
+	macs sync.Pool
+}
+
+// newSigningKey creates a signing key for secret
+func newSigningKey(secret string) *signingKey {
+	k := &signingKey{}
+	k.macs.New = func() any {
+		return hmac.New(sha256.New, []byte(secret))
+	}
+	return k
 }
 
 // NewHMACValidator creates a new HMAC validator
@@ -78,90 +176,303 @@ func NewHMACValidator(
 	timestampTolerance time.Duration,
 	logger logger.Logger,
 ) port.WebhookValidator {
-	return &HMACValidator{
-		secret:             secret,
-		nonceStore:         NewNonceStore(),
-		timestampTolerance: timestampTolerance,
-		logger:             logger,
+	return NewHMACValidatorWithNonceStore(secret, timestampTolerance, NewNonceStore(), logger)
+}
+
+// NewHMACValidatorWithNonceStore creates a new HMAC validator backed by the
+// given nonce store, so the store can be shared with other components
+func NewHMACValidatorWithNonceStore(
+	secret string,
+	timestampTolerance time.Duration,
+	nonceStore port.NonceStore,
+	logger logger.Logger,
+	opts ...HMACOption,
+) port.WebhookValidator {
+	v := &HMACValidator{
+		nonceStore:      nonceStore,
+		clock:           clock.System{},
+		logger:          logger,
+		timestampHeader: DefaultTimestampHeader,
+		nonceHeader:     DefaultNonceHeader,
+		signatureHeader: DefaultSignatureHeader,
+		timestampFormat: TimestampAuto,
 	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	v.SetSecret(secret)
+	v.SetTimestampTolerance(timestampTolerance)
+	return v
+}
+
+// SetSecret replaces the HMAC secret; it is safe to call while requests are
+// being validated
+func (v *HMACValidator) SetSecret(secret string) {
+	v.key.Store(newSigningKey(secret))
+}
+
+// TimestampTolerance returns the maximum allowed request timestamp skew
+func (v *HMACValidator) TimestampTolerance() time.Duration {
+	return time.Duration(v.timestampTolerance.Load())
+}
+
+// SetTimestampTolerance changes the maximum allowed request timestamp skew;
+// it is safe to call while requests are being validated
+func (v *HMACValidator) SetTimestampTolerance(tolerance time.Duration) {
+	v.timestampTolerance.Store(int64(tolerance))
+}
+
+// ReleaseNonce forgets the nonce of r, which the validator accepted
+func (v *HMACValidator) ReleaseNonce(r *http.Request) {
+	v.nonceStore.Delete(v.tenant, r.Header.Get(v.nonceHeader))
 }
 
 // ValidateRequest validates the incoming webhook request
-func (v *HMACValidator) ValidateRequest(ctx context.Context, r *http.Request, body []byte) error {
-	// Extract headers
-	timestampStr := r.Header.Get("X-Timestamp")
-	nonce := r.Header.Get("X-Nonce")
-	signature := r.Header.Get("X-Signature")
+func (v *HMACValidator) ValidateRequest(ctx context.Context, r *http.Request, body []byte) (err error) {
+	ctx, span := tracer.Start(ctx, "HMACValidator.ValidateRequest",
+		trace.WithAttributes(attribute.Int("webhook.body_bytes", len(body))))
+	defer func() { endSpan(span, err) }()
 
-	if timestampStr == "" {
-		return fmt.Errorf("missing X-Timestamp header")
+	verifier, err := v.begin(r)
+	if err != nil {
+		return err
+	}
+	_, _ = verifier.Write(body)
+	return verifier.verify(ctx, body)
+}
+
+// BeginRequest checks that r carries the signature headers and a timestamp
+// that parses, before its body is read. The returned verifier signs the body
+// as it is written and then validates the request like ValidateRequest.
+func (v *HMACValidator) BeginRequest(_ context.Context, r *http.Request) (port.BodyVerifier, error) {
+	verifier, err := v.begin(r)
+	if err != nil {
+		return nil, err
+	}
+	return &verifier, nil
+}
+
+// begin reads the signature headers of r and starts signing its canonical
+// message. The verifier is returned by value so that ValidateRequest can
+// keep it off the heap.
+func (v *HMACValidator) begin(r *http.Request) (hmacVerifier, error) {
+	timestamp := r.Header.Get(v.timestampHeader)
+	nonce := r.Header.Get(v.nonceHeader)
+	signature := r.Header.Get(v.signatureHeader)
+
+	if timestamp == "" {
+		return hmacVerifier{}, entity.ErrMissingHeader.WithDetail("%s", v.timestampHeader)
 	}
 	if nonce == "" {
-		return fmt.Errorf("missing X-Nonce header")
+		return hmacVerifier{}, entity.ErrMissingHeader.WithDetail("%s", v.nonceHeader)
 	}
 	if signature == "" {
-		return fmt.Errorf("missing X-Signature header")
+		return hmacVerifier{}, entity.ErrMissingHeader.WithDetail("%s", v.signatureHeader)
 	}
 
-	// Parse timestamp
-	timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
+	requestTime, err := parseTimestamp(v.timestampFormat, timestamp)
 	if err != nil {
-		return fmt.Errorf("invalid X-Timestamp format: %w", err)
+		return hmacVerifier{}, entity.ErrInvalidTimestamp.WithDetail("%s: %v", v.timestampHeader, err)
 	}
-	requestTime := time.Unix(timestamp, 0)
+
+	key := v.key.Load()
+	mac := key.macs.Get().(hash.Hash)
+	mac.Reset()
+	writeCanonicalMessage(mac, timestamp, nonce, nil)
+	return hmacVerifier{
+		v:           v,
+		key:         key,
+		mac:         mac,
+		timestamp:   timestamp,
+		nonce:       nonce,
+		signature:   signature,
+		requestTime: requestTime,
+	}, nil
+}
+
+// hmacVerifier signs the body of a request as it is read. Its HMAC writer
+// goes back to the key's pool once the request is verified.
+type hmacVerifier struct {
+	v           *HMACValidator
+	key         *signingKey
+	mac         hash.Hash
+	timestamp   string
+	nonce       string
+	signature   string
+	requestTime time.Time
+}
+
+// Write adds p to the signed message
+func (h *hmacVerifier) Write(p []byte) (int, error) {
+	return h.mac.Write(p)
+}
+
+// Verify validates the request whose whole body has been written
+func (h *hmacVerifier) Verify(ctx context.Context, body []byte) (err error) {
+	ctx, span := tracer.Start(ctx, "HMACValidator.Verify",
+		trace.WithAttributes(attribute.Int("webhook.body_bytes", len(body))))
+	defer func() { endSpan(span, err) }()
+	return h.verify(ctx, body)
+}
+
+// verify checks the timestamp, nonce and signature of the request, in that
+// order
+func (h *hmacVerifier) verify(ctx context.Context, body []byte) error {
+	v := h.v
+	var buf [signatureHexLen]byte
+	expected := buf[:h.sum(buf[:])]
+	timestamp := h.requestTime.Unix()
 
 	// Validate timestamp is within tolerance
-	now := time.Now()
-	timeDiff := now.Sub(requestTime)
+	now := v.clock.Now()
+	skew := now.Sub(h.requestTime)
+	timeDiff := skew
 	if timeDiff < 0 {
 		timeDiff = -timeDiff
 	}
-	if timeDiff > v.timestampTolerance {
+	tolerance := v.TimestampTolerance()
+	// Compared as times, since the difference saturates for timestamps
+	// centuries away and its absolute value can overflow
+	if h.requestTime.Before(now.Add(-tolerance)) || h.requestTime.After(now.Add(tolerance)) {
 		v.logger.LogWarning(ctx, "Request timestamp out of tolerance",
 			"timestamp", timestamp,
 			"current_time", now.Unix(),
 			"difference_seconds", timeDiff.Seconds(),
-			"tolerance_seconds", v.timestampTolerance.Seconds())
-		return fmt.Errorf("timestamp out of tolerance: difference is %v, max allowed is %v", timeDiff, v.timestampTolerance)
+			"tolerance_seconds", tolerance.Seconds())
+		// Only the sender can have signed it, so its clock is off
+		if v.skew != nil && hmac.Equal(expected, []byte(h.signature)) {
+			v.skew.RecordSkew(v.tenant, skew, false)
+		}
+		return entity.ErrTimestampOutOfTolerance.WithDetail("difference is %v, max allowed is %v", timeDiff, tolerance)
 	}
 
 	// Validate nonce (prevent replay attacks)
-	if !v.nonceStore.IsValid(nonce, requestTime) {
+	if !v.nonceStore.IsValid(v.tenant, h.nonce, h.requestTime) {
 		v.logger.LogWarning(ctx, "Duplicate nonce detected (replay attack)",
-			"nonce", nonce,
+			"tenant", v.tenant,
+			"nonce", h.nonce,
 			"timestamp", timestamp)
-		return fmt.Errorf("duplicate nonce detected: possible replay attack")
-	}
-
-	// Compute expected signature
-	expectedSignature, err := v.computeSignature(timestampStr, nonce, body)
-	if err != nil {
-		return fmt.Errorf("failed to compute signature: %w", err)
+		return entity.ErrReplayDetected.WithDetail("possible replay attack")
 	}
 
 	// Compare signatures (constant-time comparison to prevent timing attacks)
-	if !hmac.Equal([]byte(expectedSignature), []byte(signature)) {
+	if !hmac.Equal(expected, []byte(h.signature)) {
 		v.logger.LogWarning(ctx, "Invalid signature",
-			"expected", expectedSignature,
-			"received", signature)
-		return fmt.Errorf("invalid signature")
+			"expected", string(expected),
+			"received", h.signature)
+		return &entity.SignatureMismatchError{
+			Scheme:           v.scheme(),
+			CanonicalMessage: CanonicalMessage(h.timestamp, h.nonce, body),
+		}
+	}
+
+	if v.skew != nil {
+		v.skew.RecordSkew(v.tenant, skew, true)
 	}
+	v.logger.LogDebug(ctx, "Webhook signature verified",
+		"nonce", h.nonce,
+		"timestamp", timestamp,
+		"skew_seconds", timeDiff.Seconds())
 
 	return nil
 }
 
+// sum writes the encoded signature of the message written into dst, which
+// must hold signatureHexLen bytes, and hands the HMAC writer back to its
+// pool. It returns the length of the signature.
+func (h *hmacVerifier) sum(dst []byte) int {
+	defer h.key.macs.Put(h.mac)
+	return h.v.encode(dst, h.mac)
+}
+
+// endSpan records err, if any, on span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// scheme returns the signature scheme signatures are checked with
+func (v *HMACValidator) scheme() string {
+	if v.base64 {
+		return SchemeHMACSHA256Base64
+	}
+	return SchemeHMACSHA256
+}
+
+// parseTimestamp parses a timestamp header value in format
+func parseTimestamp(format, value string) (time.Time, error) {
+	if format == TimestampRFC3339 {
+		return time.Parse(time.RFC3339, value)
+	}
+
+	epoch, err := strconv.ParseInt(value, 10, 64)
+	switch {
+	case err != nil && format == TimestampAuto:
+		return time.Parse(time.RFC3339, value)
+	case err != nil:
+		return time.Time{}, err
+	case format == TimestampMilliseconds || format == TimestampAuto && (epoch >= minEpochMillis || epoch <= -minEpochMillis):
+		return time.UnixMilli(epoch), nil
+	default:
+		return time.Unix(epoch, 0), nil
+	}
+}
+
 // computeSignature computes the HMAC SHA256 signature
 // Format: X-Timestamp + "\n" + X-Nonce + "\n" + <raw_request_body_bytes_as_string>
 func (v *HMACValidator) computeSignature(timestamp, nonce string, body []byte) (string, error) {
-	// Construct the message to sign
-	message := timestamp + "\n" + nonce + "\n" + string(body)
+	var signature [signatureHexLen]byte
+	n := v.signInto(signature[:], timestamp, nonce, body)
+	return string(signature[:n]), nil
+}
 
-	// Compute HMAC SHA256
-	mac := hmac.New(sha256.New, []byte(v.secret))
-	_, err := mac.Write([]byte(message))
-	if err != nil {
-		return "", err
+// signInto writes the encoded signature into dst, which must hold
+// signatureHexLen bytes, using a pooled HMAC writer. It returns the length of
+// the signature.
+func (v *HMACValidator) signInto(dst []byte, timestamp, nonce string, body []byte) int {
+	key := v.key.Load()
+	mac := key.macs.Get().(hash.Hash)
+	defer key.macs.Put(mac)
+
+	mac.Reset()
+	writeCanonicalMessage(mac, timestamp, nonce, body)
+	return v.encode(dst, mac)
+}
+
+// encode writes the signature of the message written to mac into dst in the
+// validator's encoding, returning its length
+func (v *HMACValidator) encode(dst []byte, mac hash.Hash) int {
+	var sum [sha256.Size]byte
+	if v.base64 {
+		base64.StdEncoding.Encode(dst, mac.Sum(sum[:0]))
+		return base64.StdEncoding.EncodedLen(sha256.Size)
 	}
+	return hex.Encode(dst, mac.Sum(sum[:0]))
+}
+
+// writeCanonicalMessage writes the signed byte sequence for a request to w
+// part by part, without building it as one string. Writes to a hash never fail.
+func writeCanonicalMessage(w io.Writer, timestamp, nonce string, body []byte) {
+	_, _ = io.WriteString(w, timestamp)
+	_, _ = io.WriteString(w, "\n")
+	_, _ = io.WriteString(w, nonce)
+	_, _ = io.WriteString(w, "\n")
+	_, _ = w.Write(body)
+}
+
+// CanonicalMessage builds the exact byte sequence that is signed for a request
+func CanonicalMessage(timestamp, nonce string, body []byte) []byte {
+	return []byte(timestamp + "\n" + nonce + "\n" + string(body))
+}
+
+// ComputeSignature computes the hex-encoded HMAC SHA256 signature of the
+// canonical message using the given secret
+func ComputeSignature(secret, timestamp, nonce string, body []byte) (string, error) {
+	mac := hmac.New(sha256.New, []byte(secret))
+	writeCanonicalMessage(mac, timestamp, nonce, body)
 
 	// Return hex-encoded signature
 	return hex.EncodeToString(mac.Sum(nil)), nil
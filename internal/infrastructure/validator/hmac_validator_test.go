@@ -4,13 +4,24 @@ import (
 	"context"
 	"crypto/hmac"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/infrastructure/clock"
 	"kii.com/internal/infrastructure/logger"
 )
 
@@ -21,80 +32,71 @@ func TestHMACValidator_ValidateRequest(t *testing.T) {
 	validator := NewHMACValidator(secret, tolerance, logger).(*HMACValidator)
 
 	tests := []struct {
-		name        string
-		timestamp   int64
-		nonce       string
-		body        string
-		signature   string
-		wantErr     bool
-		errContains string
+		name      string
+		timestamp int64
+		nonce     string
+		body      string
+		signature string
+		wantErr   error
 	}{
 		{
 			name:      "valid request",
 			timestamp: time.Now().Unix(),
 			nonce:     "unique-nonce-1",
 			body:      `{"user":"user1","asset":"BTC","amount":"100.5"}`,
-			wantErr:   false,
 		},
 		{
-			name:        "missing timestamp header",
-			timestamp:   0,
-			nonce:       "unique-nonce-2",
-			body:        `{"user":"user1","asset":"BTC","amount":"100.5"}`,
-			wantErr:     true,
-			errContains: "missing X-Timestamp",
+			name:      "missing timestamp header",
+			timestamp: 0,
+			nonce:     "unique-nonce-2",
+			body:      `{"user":"user1","asset":"BTC","amount":"100.5"}`,
+			wantErr:   entity.ErrMissingHeader,
 		},
 		{
-			name:        "missing nonce header",
-			timestamp:   time.Now().Unix(),
-			nonce:       "",
-			body:        `{"user":"user1","asset":"BTC","amount":"100.5"}`,
-			wantErr:     true,
-			errContains: "missing X-Nonce",
+			name:      "missing nonce header",
+			timestamp: time.Now().Unix(),
+			nonce:     "",
+			body:      `{"user":"user1","asset":"BTC","amount":"100.5"}`,
+			wantErr:   entity.ErrMissingHeader,
 		},
 		{
-			name:        "missing signature header",
-			timestamp:   time.Now().Unix(),
-			nonce:       "unique-nonce-3",
-			body:        `{"user":"user1","asset":"BTC","amount":"100.5"}`,
-			signature:   "",
-			wantErr:     true,
-			errContains: "missing X-Signature",
+			name:      "missing signature header",
+			timestamp: time.Now().Unix(),
+			nonce:     "unique-nonce-3",
+			body:      `{"user":"user1","asset":"BTC","amount":"100.5"}`,
+			signature: "",
+			wantErr:   entity.ErrMissingHeader,
 		},
 		{
-			name:        "invalid timestamp format",
-			timestamp:   0,
-			nonce:       "unique-nonce-4",
-			body:        `{"user":"user1","asset":"BTC","amount":"100.5"}`,
-			wantErr:     true,
-			errContains: "missing X-Timestamp", // Will fail on missing header check first
+			name:      "invalid timestamp format",
+			timestamp: 0,
+			nonce:     "unique-nonce-4",
+			body:      `{"user":"user1","asset":"BTC","amount":"100.5"}`,
+			wantErr:   entity.ErrMissingHeader, // Will fail on missing header check first
 		},
 		{
-			name:        "timestamp out of tolerance (future)",
-			timestamp:   time.Now().Add(10 * time.Minute).Unix(),
-			nonce:       "unique-nonce-5",
-			body:        `{"user":"user1","asset":"BTC","amount":"100.5"}`,
-			signature:   "dummy-signature", // Set signature so it doesn't fail on missing signature check
-			wantErr:     true,
-			errContains: "timestamp out of tolerance",
+			name:      "timestamp out of tolerance (future)",
+			timestamp: time.Now().Add(10 * time.Minute).Unix(),
+			nonce:     "unique-nonce-5",
+			body:      `{"user":"user1","asset":"BTC","amount":"100.5"}`,
+			signature: "dummy-signature", // Set signature so it doesn't fail on missing signature check
+			wantErr:   entity.ErrTimestampOutOfTolerance,
 		},
 		{
-			name:        "timestamp out of tolerance (past)",
-			timestamp:   time.Now().Add(-10 * time.Minute).Unix(),
-			nonce:       "unique-nonce-6",
-			body:        `{"user":"user1","asset":"BTC","amount":"100.5"}`,
-			signature:   "dummy-signature", // Set signature so it doesn't fail on missing signature check
-			wantErr:     true,
-			errContains: "timestamp out of tolerance",
+			name:      "timestamp out of tolerance (past)",
+			timestamp: time.Now().Add(-10 * time.Minute).Unix(),
+			nonce:     "unique-nonce-6",
+			body:      `{"user":"user1","asset":"BTC","amount":"100.5"}`,
+			signature: "dummy-signature", // Set signature so it doesn't fail on missing signature check
+			wantErr:   entity.ErrTimestampOutOfTolerance,
 		},
 		{
-			name:        "invalid signature",
-			timestamp:   time.Now().Unix(),
-			nonce:       "unique-nonce-7",
-			body:        `{"user":"user1","asset":"BTC","amount":"100.5"}`,
-			signature:   "invalid-signature",
-			wantErr:     true,
-			errContains: "invalid signature",
+			name:      "invalid signature",
+			timestamp: time.Now().Unix(),
+			nonce:     "unique-nonce-7",
+			body:      `{"user":"user1","asset":"BTC","amount":"100.5"}`,
+			signature: "invalid-signature",
+			wantErr:   entity.ErrInvalidSignature,
 		},
 	}
 
@@ -114,7 +116,7 @@ func TestHMACValidator_ValidateRequest(t *testing.T) {
 			}
 
 			// Compute signature if not provided or if it's a valid test case
-			if tt.signature == "" && !tt.wantErr && tt.timestamp != 0 {
+			if tt.signature == "" && tt.wantErr == nil && tt.timestamp != 0 {
 				// For valid cases, compute the correct signature
 				message := strconv.FormatInt(tt.timestamp, 10) + "\n" + tt.nonce + "\n" + tt.body
 				mac := hmac.New(sha256.New, []byte(secret))
@@ -127,14 +129,8 @@ func TestHMACValidator_ValidateRequest(t *testing.T) {
 
 			// Validate
 			err := validator.ValidateRequest(context.Background(), req, bodyBytes)
-			if (err != nil) != tt.wantErr {
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
 				t.Errorf("HMACValidator.ValidateRequest() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if tt.wantErr && tt.errContains != "" && err != nil {
-				if !contains(err.Error(), tt.errContains) {
-					t.Errorf("HMACValidator.ValidateRequest() error = %v, should contain %v", err, tt.errContains)
-				}
 			}
 		})
 	}
@@ -173,29 +169,337 @@ func TestHMACValidator_ReplayAttack(t *testing.T) {
 	if err == nil {
 		t.Error("Replay attack should be detected, but validation succeeded")
 	}
-	if !contains(err.Error(), "duplicate nonce") {
+	if !errors.Is(err, entity.ErrReplayDetected) {
 		t.Errorf("Expected duplicate nonce error, got: %v", err)
 	}
 }
 
+func TestHMACValidator_SetTimestampTolerance(t *testing.T) {
+	v := NewHMACValidator("test-secret-key", 5*time.Minute, logger.NewLogger()).(*HMACValidator)
+	timestamp := strconv.FormatInt(time.Now().Add(-3*time.Minute).Unix(), 10)
+	body := []byte(`{}`)
+
+	request := func(nonce string) *http.Request {
+		signature, _ := ComputeSignature("test-secret-key", timestamp, nonce, body)
+		return &http.Request{Header: http.Header{
+			"X-Timestamp": {timestamp},
+			"X-Nonce":     {nonce},
+			"X-Signature": {signature},
+		}}
+	}
+
+	if err := v.ValidateRequest(context.Background(), request("n1"), body); err != nil {
+		t.Fatalf("ValidateRequest() within 5m tolerance error = %v", err)
+	}
+	v.SetTimestampTolerance(time.Minute)
+	if v.TimestampTolerance() != time.Minute {
+		t.Errorf("TimestampTolerance() = %v, want 1m", v.TimestampTolerance())
+	}
+	if err := v.ValidateRequest(context.Background(), request("n2"), body); !errors.Is(err, entity.ErrTimestampOutOfTolerance) {
+		t.Errorf("ValidateRequest() after tightening tolerance error = %v, want out of tolerance", err)
+	}
+}
+
+func TestHMACValidator_Clock(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	v := NewHMACValidatorWithNonceStore("test-secret-key", 5*time.Minute, NewNonceStoreWithClock(fake), logger.NewLogger(),
+		WithClock(fake))
+	body := []byte(`{}`)
+
+	request := func(timestamp time.Time, nonce string) *http.Request {
+		ts := strconv.FormatInt(timestamp.Unix(), 10)
+		signature, _ := ComputeSignature("test-secret-key", ts, nonce, body)
+		return &http.Request{Header: http.Header{
+			"X-Timestamp": {ts},
+			"X-Nonce":     {nonce},
+			"X-Signature": {signature},
+		}}
+	}
+
+	tests := []struct {
+		name      string
+		timestamp time.Time
+		wantErr   bool
+	}{
+		{"exactly at the past edge", now.Add(-5 * time.Minute), false},
+		{"one second past the edge", now.Add(-5*time.Minute - time.Second), true},
+		{"exactly at the future edge", now.Add(5 * time.Minute), false},
+		{"one second beyond the future edge", now.Add(5*time.Minute + time.Second), true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.ValidateRequest(context.Background(), request(tt.timestamp, fmt.Sprintf("edge-%d", i)), body)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// A request that was on time is late once the clock moves on
+	sent := now
+	if err := v.ValidateRequest(context.Background(), request(sent, "late-1"), body); err != nil {
+		t.Fatalf("ValidateRequest() on time error = %v", err)
+	}
+	fake.Advance(6 * time.Minute)
+	if err := v.ValidateRequest(context.Background(), request(sent, "late-2"), body); err == nil {
+		t.Error("ValidateRequest() 6 minutes late error = nil, want out of tolerance")
+	}
+}
+
+func TestHMACValidator_TimestampFormats(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	seconds := strconv.FormatInt(now.Unix(), 10)
+	millis := strconv.FormatInt(now.UnixMilli(), 10)
+	rfc3339 := now.Format(time.RFC3339)
+
+	tests := []struct {
+		format    string
+		timestamp string
+		wantErr   bool
+	}{
+		{TimestampAuto, seconds, false},
+		{TimestampAuto, millis, false},
+		{TimestampAuto, rfc3339, false},
+		{TimestampAuto, "2026-10-01T14:00:00.250+02:00", false},
+		{TimestampAuto, "2026-10-01 12:00:00", true},
+		{TimestampSeconds, seconds, false},
+		{TimestampSeconds, millis, true},
+		{TimestampSeconds, "9223372036854775807", true},
+		{TimestampSeconds, "-9223372036854775808", true},
+		{TimestampSeconds, rfc3339, true},
+		{TimestampMilliseconds, millis, false},
+		{TimestampMilliseconds, seconds, true},
+		{TimestampRFC3339, rfc3339, false},
+		{TimestampRFC3339, seconds, true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.format+" "+tt.timestamp, func(t *testing.T) {
+			opt, err := WithTimestampFormat(tt.format)
+			if err != nil {
+				t.Fatalf("WithTimestampFormat(%q) error = %v", tt.format, err)
+			}
+			v := fuzzValidator("test-secret-key", now, opt)
+			nonce := fmt.Sprintf("format-%d", i)
+			body := []byte(`{}`)
+			signature, _ := ComputeSignature("test-secret-key", tt.timestamp, nonce, body)
+			req := &http.Request{Header: http.Header{
+				"X-Timestamp": {tt.timestamp},
+				"X-Nonce":     {nonce},
+				"X-Signature": {signature},
+			}}
+
+			err = v.ValidateRequest(context.Background(), req, body)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := WithTimestampFormat("unix"); err == nil {
+		t.Error("WithTimestampFormat(unix) error = nil, want error")
+	}
+}
+
+func TestHMACValidator_SetSecret(t *testing.T) {
+	v := NewHMACValidator("old-secret", 5*time.Minute, logger.NewLogger()).(*HMACValidator)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	body := []byte(`{}`)
+
+	request := func(secret, nonce string) *http.Request {
+		signature, _ := ComputeSignature(secret, timestamp, nonce, body)
+		return &http.Request{Header: http.Header{
+			"X-Timestamp": {timestamp},
+			"X-Nonce":     {nonce},
+			"X-Signature": {signature},
+		}}
+	}
+
+	if err := v.ValidateRequest(context.Background(), request("old-secret", "n1"), body); err != nil {
+		t.Fatalf("ValidateRequest() with current secret error = %v", err)
+	}
+	v.SetSecret("new-secret")
+	if err := v.ValidateRequest(context.Background(), request("old-secret", "n2"), body); err == nil {
+		t.Error("ValidateRequest() with replaced secret should fail")
+	}
+	if err := v.ValidateRequest(context.Background(), request("new-secret", "n3"), body); err != nil {
+		t.Errorf("ValidateRequest() with new secret error = %v", err)
+	}
+}
+
+func TestHMACValidator_Options(t *testing.T) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	body := []byte(`{"user":"user1"}`)
+	mac := hmac.New(sha256.New, []byte("test-secret-key"))
+	writeCanonicalMessage(mac, timestamp, "nonce-1", body)
+	base64Signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	scheme, err := WithScheme(SchemeHMACSHA256Base64)
+	if err != nil {
+		t.Fatalf("WithScheme() error = %v", err)
+	}
+	v := NewHMACValidatorWithNonceStore("test-secret-key", 5*time.Minute, NewNonceStore(), logger.NewLogger(),
+		WithHeaders("X-Time", "X-Id", "X-Sig"), scheme)
+
+	r := &http.Request{Header: http.Header{}}
+	r.Header.Set("X-Time", timestamp)
+	r.Header.Set("X-Id", "nonce-1")
+	r.Header.Set("X-Sig", base64Signature)
+	if err := v.ValidateRequest(context.Background(), r, body); err != nil {
+		t.Errorf("ValidateRequest() with custom headers and base64 scheme error = %v", err)
+	}
+
+	r = &http.Request{Header: http.Header{"X-Timestamp": {timestamp}}}
+	if err := v.ValidateRequest(context.Background(), r, body); !errors.Is(err, entity.ErrMissingHeader) {
+		t.Errorf("ValidateRequest() error = %v, want %v", err, entity.ErrMissingHeader)
+	}
+
+	if _, err := WithScheme("rsa-sha256"); err == nil {
+		t.Error("WithScheme() with an unsupported scheme should fail")
+	}
+}
+
+func TestHMACValidator_SignatureMismatch(t *testing.T) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	body := []byte(`{"user":"user1"}`)
+	scheme, _ := WithScheme(SchemeHMACSHA256Base64)
+	v := NewHMACValidatorWithNonceStore("test-secret-key", 5*time.Minute, NewNonceStore(), logger.NewLogger(), scheme)
+
+	// Signed over the body without the nonce, a common integration mistake
+	mac := hmac.New(sha256.New, []byte("test-secret-key"))
+	mac.Write([]byte(timestamp + "\n" + string(body)))
+	r := &http.Request{Header: http.Header{
+		"X-Timestamp": {timestamp},
+		"X-Nonce":     {"nonce-1"},
+		"X-Signature": {base64.StdEncoding.EncodeToString(mac.Sum(nil))},
+	}}
+
+	err := v.ValidateRequest(context.Background(), r, body)
+	var mismatch *entity.SignatureMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("ValidateRequest() error = %v, want a SignatureMismatchError", err)
+	}
+	if mismatch.Scheme != SchemeHMACSHA256Base64 {
+		t.Errorf("Scheme = %q, want %q", mismatch.Scheme, SchemeHMACSHA256Base64)
+	}
+	if want := timestamp + "\nnonce-1\n" + string(body); string(mismatch.CanonicalMessage) != want {
+		t.Errorf("CanonicalMessage = %q, want %q", mismatch.CanonicalMessage, want)
+	}
+	if err.Error() != "invalid signature" {
+		t.Errorf("Error() = %q, want %q", err.Error(), "invalid signature")
+	}
+}
+
+func TestHMACValidator_BeginRequest(t *testing.T) {
+	v := NewHMACValidator("test-secret-key", 5*time.Minute, logger.NewLogger()).(*HMACValidator)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	body := []byte(`{"user":"user1","asset":"BTC","amount":"100.5"}`)
+	request := func(nonce string, body []byte) *http.Request {
+		signature, _ := ComputeSignature("test-secret-key", timestamp, nonce, body)
+		return &http.Request{Header: http.Header{
+			"X-Timestamp": {timestamp},
+			"X-Nonce":     {nonce},
+			"X-Signature": {signature},
+		}}
+	}
+
+	// The body is signed as it is written, in any number of parts
+	verifier, err := v.BeginRequest(context.Background(), request("nonce-1", body))
+	if err != nil {
+		t.Fatalf("BeginRequest() error = %v", err)
+	}
+	for part := range slices.Chunk(body, 7) {
+		_, _ = verifier.Write(part)
+	}
+	if err := verifier.Verify(context.Background(), body); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+
+	// The nonce is only checked by Verify, and still only accepted once
+	verifier, err = v.BeginRequest(context.Background(), request("nonce-1", body))
+	if err != nil {
+		t.Fatalf("BeginRequest() with a reused nonce error = %v", err)
+	}
+	_, _ = verifier.Write(body)
+	if err := verifier.Verify(context.Background(), body); !errors.Is(err, entity.ErrReplayDetected) {
+		t.Errorf("Verify() with a reused nonce error = %v, want %v", err, entity.ErrReplayDetected)
+	}
+
+	// A body other than the signed one is rejected
+	verifier, _ = v.BeginRequest(context.Background(), request("nonce-2", body))
+	_, _ = verifier.Write(body[1:])
+	if err := verifier.Verify(context.Background(), body[1:]); !errors.Is(err, entity.ErrInvalidSignature) {
+		t.Errorf("Verify() of another body error = %v, want %v", err, entity.ErrInvalidSignature)
+	}
+
+	// Requests without the headers are rejected before the body is read
+	r := request("nonce-3", body)
+	r.Header.Del("X-Signature")
+	if _, err := v.BeginRequest(context.Background(), r); !errors.Is(err, entity.ErrMissingHeader) {
+		t.Errorf("BeginRequest() without a signature error = %v, want %v", err, entity.ErrMissingHeader)
+	}
+}
+
 func TestNonceStore_IsValid(t *testing.T) {
 	store := NewNonceStore()
 	now := time.Now()
 
 	// First use of nonce should be valid
-	if !store.IsValid("nonce-1", now) {
+	if !store.IsValid("", "nonce-1", now) {
 		t.Error("First use of nonce should be valid")
 	}
 
 	// Second use of same nonce should be invalid
-	if store.IsValid("nonce-1", now) {
+	if store.IsValid("", "nonce-1", now) {
 		t.Error("Reuse of nonce should be invalid")
 	}
 
 	// Different nonce should be valid
-	if !store.IsValid("nonce-2", now) {
+	if !store.IsValid("", "nonce-2", now) {
 		t.Error("Different nonce should be valid")
 	}
+
+	// Each tenant has its own namespace
+	if !store.IsValid("partner-a", "nonce-1", now) {
+		t.Error("Nonce used by another tenant should be valid")
+	}
+	if store.IsValid("partner-a", "nonce-1", now) {
+		t.Error("Reuse of nonce within a tenant should be invalid")
+	}
+}
+
+func TestHMACValidator_Tenants(t *testing.T) {
+	const secret = "test-secret-key"
+	store := NewNonceStore()
+	partnerA := NewHMACValidatorWithNonceStore(secret, 5*time.Minute, store, logger.NewLogger(), WithTenant("partner-a"))
+	partnerB := NewHMACValidatorWithNonceStore(secret, 5*time.Minute, store, logger.NewLogger(), WithTenant("partner-b"))
+
+	body := []byte(`{"user":"user1","asset":"BTC","amount":"100.5"}`)
+	request := func() *http.Request {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		signature, _ := ComputeSignature(secret, timestamp, "delivery-1", body)
+		req := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+		req.Header.Set("X-Timestamp", timestamp)
+		req.Header.Set("X-Nonce", "delivery-1")
+		req.Header.Set("X-Signature", signature)
+		return req
+	}
+
+	if err := partnerA.ValidateRequest(context.Background(), request(), body); err != nil {
+		t.Fatalf("partner-a ValidateRequest() error = %v", err)
+	}
+	// The same nonce from another tenant is not a replay
+	if err := partnerB.ValidateRequest(context.Background(), request(), body); err != nil {
+		t.Errorf("partner-b ValidateRequest() error = %v, want nil", err)
+	}
+	if err := partnerA.ValidateRequest(context.Background(), request(), body); !errors.Is(err, entity.ErrReplayDetected) {
+		t.Errorf("partner-a replay error = %v, want %v", err, entity.ErrReplayDetected)
+	}
+
+	records := store.List("delivery-", 0)
+	if len(records) != 2 || records[0].Tenant == records[1].Tenant {
+		t.Errorf("List() = %v, want the nonce once per tenant", records)
+	}
 }
 
 func TestHMACValidator_ComputeSignature(t *testing.T) {
@@ -230,17 +534,399 @@ func TestHMACValidator_ComputeSignature(t *testing.T) {
 	}
 }
 
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || len(substr) == 0 ||
-		(len(s) > len(substr) && (s[:len(substr)] == substr || s[len(s)-len(substr):] == substr ||
-			containsSubstring(s, substr))))
+func TestHMACValidator_ComputeSignature_Pooled(t *testing.T) {
+	validator := NewHMACValidator("test-secret-key", 5*time.Minute, logger.NewLogger()).(*HMACValidator)
+
+	// Pooled writers are reused, so repeated and concurrent signing must
+	// match a freshly keyed HMAC every time
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				nonce := fmt.Sprintf("nonce-%d-%d", i, j)
+				body := []byte(fmt.Sprintf(`{"user":"user%d","asset":"BTC","amount":"%d"}`, i, j))
+				got, _ := validator.computeSignature("1234567890", nonce, body)
+				want, _ := ComputeSignature("test-secret-key", "1234567890", nonce, body)
+				if got != want {
+					t.Errorf("computeSignature(%s) = %s, want %s", nonce, got, want)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
 }
 
-func containsSubstring(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return true
+func BenchmarkHMACValidator_ValidateRequest(b *testing.B) {
+	validator := NewHMACValidator("test-secret-key", 5*time.Minute, logger.NewLogger()).(*HMACValidator)
+	body := []byte(`{"user":"user1","asset":"BTC","amount":"100.5"}`)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	b.ReportAllocs()
+	for i := range b.N {
+		nonce := "bench-" + strconv.Itoa(i)
+		signature, _ := ComputeSignature("test-secret-key", timestamp, nonce, body)
+		req := &http.Request{Header: http.Header{
+			"X-Timestamp": {timestamp},
+			"X-Nonce":     {nonce},
+			"X-Signature": {signature},
+		}}
+		if err := validator.ValidateRequest(context.Background(), req, body); err != nil {
+			b.Fatalf("ValidateRequest() error = %v", err)
 		}
 	}
-	return false
+}
+
+func BenchmarkHMACValidator_ComputeSignature(b *testing.B) {
+	validator := NewHMACValidator("test-secret-key", 5*time.Minute, logger.NewLogger()).(*HMACValidator)
+	body := []byte(`{"user":"user1","asset":"BTC","amount":"100.5"}`)
+
+	b.ReportAllocs()
+	for range b.N {
+		_, _ = validator.computeSignature("1234567890", "bench-nonce", body)
+	}
+}
+
+func TestCanonicalMessage(t *testing.T) {
+	got := string(CanonicalMessage("1234567890", "test-nonce", []byte(`{"a":1}`)))
+	want := "1234567890\ntest-nonce\n{\"a\":1}"
+	if got != want {
+		t.Errorf("CanonicalMessage() = %q, want %q", got, want)
+	}
+}
+
+// skewRecorder records the skews it is given
+type skewRecorder struct {
+	skews []string
+}
+
+func (r *skewRecorder) RecordSkew(tenant string, skew time.Duration, withinTolerance bool) {
+	r.skews = append(r.skews, fmt.Sprintf("%s %v %t", tenant, skew, withinTolerance))
+}
+
+func TestHMACValidator_SkewRecorder(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	recorder := &skewRecorder{}
+	v := NewHMACValidatorWithNonceStore("test-secret-key", 5*time.Minute, NewNonceStoreWithClock(fake), logger.NewLogger(),
+		WithClock(fake), WithTenant("partner"), WithSkewRecorder(recorder))
+	body := []byte(`{}`)
+
+	request := func(timestamp time.Time, nonce, secret string) *http.Request {
+		ts := strconv.FormatInt(timestamp.Unix(), 10)
+		signature, _ := ComputeSignature(secret, ts, nonce, body)
+		return &http.Request{Header: http.Header{
+			"X-Timestamp": {ts},
+			"X-Nonce":     {nonce},
+			"X-Signature": {signature},
+		}}
+	}
+
+	requests := []*http.Request{
+		request(now.Add(-3*time.Second), "signed", "test-secret-key"),
+		request(now.Add(-3*time.Second), "signed", "test-secret-key"),
+		request(now.Add(-time.Second), "forged", "other-secret"),
+		request(now.Add(10*time.Minute), "ahead", "test-secret-key"),
+		request(now.Add(-time.Hour), "forged-late", "other-secret"),
+	}
+	for _, r := range requests {
+		_ = v.ValidateRequest(context.Background(), r, body)
+	}
+
+	// The replay, the forgery and the late forgery are left out
+	want := "partner 3s true;partner -10m0s false"
+	if got := strings.Join(recorder.skews, ";"); got != want {
+		t.Errorf("recorded skews %q, want %q", got, want)
+	}
+}
+
+func TestNonceStore_Expiry(t *testing.T) {
+	now := time.Now()
+	fake := clock.NewFake(now)
+	store := NewNonceStoreWithClock(fake)
+
+	store.IsValid("", "old", now.Add(-50*time.Minute))
+	store.IsValid("", "new", now)
+
+	// Deleted and re-recorded nonces must not be expired by their stale heap entry
+	store.IsValid("", "readded", now.Add(-55*time.Minute))
+	store.Delete("", "readded")
+	store.IsValid("", "readded", now.Add(-5*time.Minute))
+
+	now = now.Add(15 * time.Minute)
+	fake.Set(now)
+	store.IsValid("", "trigger", now)
+
+	if store.Len() != 3 {
+		t.Errorf("Len() = %d, want 3 after expiring old", store.Len())
+	}
+	if store.Evicted() != 1 {
+		t.Errorf("Evicted() = %d, want 1", store.Evicted())
+	}
+	if !store.IsValid("", "old", now) {
+		t.Error("expired nonce should be accepted again")
+	}
+	if store.IsValid("", "readded", now) {
+		t.Error("re-recorded nonce should still be tracked")
+	}
+}
+
+func TestNonceStore_SetRetention(t *testing.T) {
+	now := time.Now()
+	fake := clock.NewFake(now)
+	store := NewNonceStoreWithClock(fake)
+	if store.Retention() != DefaultNonceRetention {
+		t.Errorf("Retention() = %v, want %v", store.Retention(), DefaultNonceRetention)
+	}
+
+	// Until a nonce is tracked, a shorter retention applies at once
+	store.SetRetention(30 * time.Minute)
+	if store.Retention() != 30*time.Minute {
+		t.Errorf("Retention() = %v, want 30m", store.Retention())
+	}
+
+	store.IsValid("", "old", now.Add(-20*time.Minute))
+	store.IsValid("", "recent", now.Add(-5*time.Minute))
+
+	// A shorter retention waits for the previous one to pass
+	store.SetRetention(10 * time.Minute)
+	if store.Retention() != 30*time.Minute {
+		t.Errorf("Retention() = %v, want 30m until it has passed", store.Retention())
+	}
+	if store.Len() != 2 || store.Evicted() != 0 {
+		t.Errorf("Len() = %d, Evicted() = %d, want 2 and 0", store.Len(), store.Evicted())
+	}
+
+	// The longest retention stays in effect for its own length after it was
+	// last replaced, however often the retention changes
+	fake.Advance(15 * time.Minute)
+	store.IsValid("", "mid", fake.Now())
+	store.SetRetention(20 * time.Minute)
+	store.SetRetention(10 * time.Minute)
+	fake.Advance(25 * time.Minute)
+	if store.Retention() != 30*time.Minute {
+		t.Errorf("Retention() = %v, want 30m until it has passed", store.Retention())
+	}
+	if store.IsValid("", "mid", now.Add(15*time.Minute)) {
+		t.Error("nonce within the longest recent retention should still be tracked")
+	}
+
+	// Once it has passed, the shorter one applies
+	fake.Advance(6 * time.Minute)
+	if store.Retention() != 10*time.Minute {
+		t.Errorf("Retention() = %v, want 10m", store.Retention())
+	}
+	store.IsValid("", "new", fake.Now())
+	if store.Len() != 1 || store.Evicted() != 3 {
+		t.Errorf("Len() = %d, Evicted() = %d, want 1 and 3", store.Len(), store.Evicted())
+	}
+
+	// A longer retention applies at once
+	store.SetRetention(time.Hour)
+	if store.Retention() != time.Hour {
+		t.Errorf("Retention() = %v, want 1h", store.Retention())
+	}
+}
+
+func BenchmarkNonceStore_IsValid(b *testing.B) {
+	store := NewNonceStore()
+	now := time.Now()
+	for i := range 1_000_000 {
+		store.IsValid("", "seed-"+strconv.Itoa(i), now)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range b.N {
+		store.IsValid("", "bench-"+strconv.Itoa(i), now)
+	}
+}
+
+func TestNonceStore_ListDeletePurge(t *testing.T) {
+	store := NewNonceStore()
+	now := time.Now()
+
+	store.IsValid("", "a-1", now.Add(-time.Minute))
+	store.IsValid("", "a-2", now)
+	store.IsValid("", "b-1", now)
+
+	if got := store.List("a-", 0); len(got) != 2 || got[0].Nonce != "a-2" {
+		t.Errorf("List(a-) = %v, want [a-2 a-1]", got)
+	}
+	if got := store.List("", 1); len(got) != 1 {
+		t.Errorf("List with limit 1 returned %d records", len(got))
+	}
+
+	if !store.Delete("", "a-1") {
+		t.Error("Delete of tracked nonce should return true")
+	}
+	if store.Delete("", "a-1") {
+		t.Error("Delete of unknown nonce should return false")
+	}
+
+	if purged := store.Purge(); purged != 2 {
+		t.Errorf("Purge() = %d, want 2", purged)
+	}
+	if store.Len() != 0 {
+		t.Errorf("Len() after purge = %d, want 0", store.Len())
+	}
+}
+
+func TestNonceStore_SaveLoad(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(now)
+	path := filepath.Join(t.TempDir(), "nonces.json")
+
+	// A missing file leaves the store empty
+	store := NewNonceStoreWithClock(fake)
+	if err := store.Load(path); err != nil || store.Len() != 0 {
+		t.Fatalf("Load() of missing file = %v with %d nonces, want nil and 0", err, store.Len())
+	}
+
+	store.IsValid("", "old", now.Add(-50*time.Minute))
+	store.IsValid("", "new", now)
+	store.IsValid("partner-a", "new", now)
+	if err := CheckSave(path); err != nil {
+		t.Fatalf("CheckSave() error = %v", err)
+	}
+	if err := store.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// After a restart 15 minutes later "old" has expired and "new" is still a replay
+	fake.Advance(15 * time.Minute)
+	restored := NewNonceStoreWithClock(fake)
+	if err := restored.Load(path); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if restored.Len() != 2 {
+		t.Errorf("Len() after Load = %d, want 2", restored.Len())
+	}
+	if restored.IsValid("", "new", fake.Now()) {
+		t.Error("restored nonce should be rejected as a replay")
+	}
+	if restored.IsValid("partner-a", "new", fake.Now()) {
+		t.Error("restored nonce should be rejected as a replay within its tenant")
+	}
+	if !restored.IsValid("", "old", fake.Now()) {
+		t.Error("nonce expired before the restart should be accepted")
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewNonceStore().Load(path); err == nil {
+		t.Error("Load() of a corrupt file error = nil, want error")
+	}
+	if err := CheckSave(filepath.Join(path, "missing", "nonces.json")); err == nil {
+		t.Error("CheckSave() in a missing directory error = nil, want error")
+	}
+}
+
+// fuzzValidator returns a validator with a fresh nonce store and a fixed
+// clock, so inputs replay identically. Only errors are logged.
+func fuzzValidator(secret string, now time.Time, opts ...HMACOption) *HMACValidator {
+	level := new(slog.LevelVar)
+	level.Set(slog.LevelError)
+	fake := clock.NewFake(now)
+	opts = append(opts, WithClock(fake))
+	return NewHMACValidatorWithNonceStore(secret, 5*time.Minute, NewNonceStoreWithClock(fake),
+		logger.NewLoggerWithLevel(level), opts...).(*HMACValidator)
+}
+
+func FuzzHMACValidator_Headers(f *testing.F) {
+	const secret = "fuzz-secret"
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"user":"user1","asset":"BTC","amount":"100.5"}`)
+	signature, _ := ComputeSignature(secret, "1700000000", "nonce-1", body)
+
+	f.Add("1700000000", "nonce-1", signature, body)
+	f.Add("1700000000", "nonce-1", signature[:32], body)
+	f.Add("1700000000", "nonce-1", signature+"00", body)
+	f.Add("1700000000123", "nonce-1", signature, body)
+	f.Add("2023-11-14T22:13:20Z", "nonce-1", signature, body)
+	f.Add("2023-11-14T22:13:20.5+01:00", "nonce-1", signature, body)
+	f.Add("+1700000000", "nonce-1", signature, body)
+	f.Add("1700000000.5", "nonce-1", signature, body)
+	f.Add("-9223372036854775808", "nonce-1", signature, body)
+	f.Add("9223372036854775807", "nonce-1", signature, body)
+	f.Add("99999999999999999999", "nonce-1", signature, body)
+	f.Add("", "", "", []byte(nil))
+	f.Add("1700000000", "nonce\n1", "\x00", []byte("\xff\xfe"))
+
+	f.Fuzz(func(t *testing.T, timestamp, nonce, signature string, body []byte) {
+		v := fuzzValidator(secret, now)
+		req := &http.Request{Header: http.Header{
+			"X-Timestamp": {timestamp},
+			"X-Nonce":     {nonce},
+			"X-Signature": {signature},
+		}}
+		if err := v.ValidateRequest(context.Background(), req, body); err != nil {
+			return
+		}
+
+		// Accepted requests must carry the one valid signature, within tolerance
+		want, _ := ComputeSignature(secret, timestamp, nonce, body)
+		if signature != want {
+			t.Errorf("accepted signature %q, want %q", signature, want)
+		}
+		requestTime, err := parseTimestamp(TimestampAuto, timestamp)
+		if err != nil {
+			t.Fatalf("accepted unparsable timestamp %q", timestamp)
+		}
+		if diff := now.Sub(requestTime); diff > 5*time.Minute || diff < -5*time.Minute {
+			t.Errorf("accepted timestamp %q, %v from now", timestamp, diff)
+		}
+	})
+}
+
+func FuzzHMACValidator_Signature(f *testing.F) {
+	const secret = "fuzz-secret"
+	now := time.Unix(1700000000, 0)
+
+	f.Add("nonce-1", []byte(`{"user":"user1","asset":"BTC","amount":"100.5"}`), "", false)
+	f.Add("nonce-1", []byte(`{}`), "0000000000000000000000000000000000000000000000000000000000000000", false)
+	f.Add("nonce-é", []byte("\x00\xff"), "A", true)
+	f.Add("n", []byte(nil), "====", true)
+
+	f.Fuzz(func(t *testing.T, nonce string, body []byte, forged string, useBase64 bool) {
+		if nonce == "" {
+			return
+		}
+		scheme := SchemeHMACSHA256
+		if useBase64 {
+			scheme = SchemeHMACSHA256Base64
+		}
+		opt, err := WithScheme(scheme)
+		if err != nil {
+			t.Fatalf("WithScheme(%q) error = %v", scheme, err)
+		}
+		timestamp := strconv.FormatInt(now.Unix(), 10)
+		request := func(signature string) *http.Request {
+			return &http.Request{Header: http.Header{
+				"X-Timestamp": {timestamp},
+				"X-Nonce":     {nonce},
+				"X-Signature": {signature},
+			}}
+		}
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(CanonicalMessage(timestamp, nonce, body))
+		signature := hex.EncodeToString(mac.Sum(nil))
+		if useBase64 {
+			signature = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		}
+
+		if err := fuzzValidator(secret, now, opt).ValidateRequest(context.Background(), request(signature), body); err != nil {
+			t.Errorf("ValidateRequest() with valid signature error = %v", err)
+		}
+		if forged == signature {
+			return
+		}
+		if err := fuzzValidator(secret, now, opt).ValidateRequest(context.Background(), request(forged), body); err == nil {
+			t.Errorf("ValidateRequest() accepted forged signature %q, want %q", forged, signature)
+		}
+	})
 }
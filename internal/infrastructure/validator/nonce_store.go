@@ -0,0 +1,331 @@
+package validator
+
+import (
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+	"kii.com/internal/infrastructure/clock"
+)
+
+// DefaultNonceRetention is how long a NonceStore remembers a used nonce,
+// after its timestamp, until SetRetention changes it
+const DefaultNonceRetention = time.Hour
+
+// nonceKey is a nonce within the namespace of the tenant that sent it
+type nonceKey struct {
+	tenant string
+	nonce  string
+}
+
+// nonceExpiry is a nonce queued for expiry at timestamp + retention
+type nonceExpiry struct {
+	key       nonceKey
+	timestamp time.Time
+}
+
+// expiryHeap is a min-heap of nonces ordered by timestamp
+type expiryHeap []nonceExpiry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].timestamp.Before(h[j].timestamp) }
+func (h expiryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x any)        { *h = append(*h, x.(nonceExpiry)) }
+func (h *expiryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// NonceStore tracks used nonces to prevent replay attacks. Each tenant has
+// its own namespace, so tenants using the same nonce do not collide. Nonces are
+// expired oldest first from a min-heap, so each check only touches the
+// nonces that have expired rather than scanning the whole store. A nonce is
+// remembered for the store's retention after its timestamp; a timestamp
+// tolerance longer than that lets replays of older webhooks through.
+type NonceStore struct {
+	mu sync.RWMutex
+	// nonces maps each tenant's nonces to their timestamps. Tenants have a
+	// map each, so the nonces are keyed by themselves alone.
+	nonces    map[string]map[string]time.Time
+	count     int
+	expiry    expiryHeap
+	clock     port.Clock
+	retention time.Duration
+	// floors are the longer retentions the store had within their own
+	// length; used reports whether it has tracked a nonce
+	floors  []retentionFloor
+	used    bool
+	evicted int64
+}
+
+// retentionFloor is a retention that is still in effect until a time,
+// though a shorter one has been set since
+type retentionFloor struct {
+	retention time.Duration
+	until     time.Time
+}
+
+// NewNonceStore creates a new nonce store
+func NewNonceStore() *NonceStore {
+	return NewNonceStoreWithClock(clock.System{})
+}
+
+// NewNonceStoreWithClock creates a nonce store expiring nonces by clock
+func NewNonceStoreWithClock(clock port.Clock) *NonceStore {
+	return &NonceStore{
+		nonces:    make(map[string]map[string]time.Time),
+		clock:     clock,
+		retention: DefaultNonceRetention,
+	}
+}
+
+// Retention returns how long a used nonce is remembered after its
+// timestamp: the longest retention the store has had within the last period
+// of that retention
+func (ns *NonceStore) Retention() time.Duration {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	return ns.effectiveRetention(ns.clock.Now())
+}
+
+// SetRetention changes how long a used nonce is remembered after its
+// timestamp. A longer retention applies at once. A shorter one applies once
+// the previous one has passed since it was replaced, so that lowering a
+// timestamp tolerance and raising it again never lets replays through; until
+// the store tracks its first nonce, it applies at once.
+func (ns *NonceStore) SetRetention(retention time.Duration) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	now := ns.clock.Now()
+	if previous := ns.effectiveRetention(now); ns.used && retention < previous {
+		floor := retentionFloor{retention: previous, until: now.Add(previous)}
+		// Floors that the new one outlasts and outranks no longer matter
+		ns.floors = slices.DeleteFunc(ns.floors, func(f retentionFloor) bool {
+			return f.retention <= floor.retention && !f.until.After(floor.until)
+		})
+		ns.floors = append(ns.floors, floor)
+	}
+	ns.retention = retention
+	ns.expire(now)
+}
+
+// effectiveRetention returns the longest of the retention and the floors
+// still in effect at now, dropping the others
+func (ns *NonceStore) effectiveRetention(now time.Time) time.Duration {
+	ns.floors = slices.DeleteFunc(ns.floors, func(f retentionFloor) bool {
+		return !f.until.After(now)
+	})
+	retention := ns.retention
+	for _, floor := range ns.floors {
+		retention = max(retention, floor.retention)
+	}
+	return retention
+}
+
+// IsValid checks if a nonce is valid (not seen before from tenant) and
+// records it
+func (ns *NonceStore) IsValid(tenant, nonce string, timestamp time.Time) bool {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	ns.expire(ns.clock.Now())
+
+	// Check if nonce was already used
+	key := nonceKey{tenant: tenant, nonce: nonce}
+	if _, exists := ns.lookup(key); exists {
+		return false
+	}
+
+	// Record the nonce
+	ns.record(key, timestamp)
+	return true
+}
+
+// lookup returns the timestamp of a tracked nonce. ns.mu must be held.
+func (ns *NonceStore) lookup(key nonceKey) (time.Time, bool) {
+	timestamp, exists := ns.nonces[key.tenant][key.nonce]
+	return timestamp, exists
+}
+
+// record tracks a nonce that is not tracked yet. ns.mu must be held.
+func (ns *NonceStore) record(key nonceKey, timestamp time.Time) {
+	nonces := ns.nonces[key.tenant]
+	if nonces == nil {
+		nonces = make(map[string]time.Time)
+		ns.nonces[key.tenant] = nonces
+	}
+	nonces[key.nonce] = timestamp
+	ns.count++
+	ns.used = true
+	heap.Push(&ns.expiry, nonceExpiry{key: key, timestamp: timestamp})
+}
+
+// forget stops tracking a nonce, reporting whether it was tracked. Its heap
+// entry is left behind. ns.mu must be held.
+func (ns *NonceStore) forget(key nonceKey) bool {
+	nonces := ns.nonces[key.tenant]
+	if _, exists := nonces[key.nonce]; !exists {
+		return false
+	}
+	delete(nonces, key.nonce)
+	if len(nonces) == 0 {
+		delete(ns.nonces, key.tenant)
+	}
+	ns.count--
+	return true
+}
+
+// expire removes nonces older than the retention in effect. Heap entries
+// left behind by Delete no longer match the map and are discarded without
+// effect.
+func (ns *NonceStore) expire(now time.Time) {
+	cutoff := now.Add(-ns.effectiveRetention(now))
+	for len(ns.expiry) > 0 && ns.expiry[0].timestamp.Before(cutoff) {
+		oldest := heap.Pop(&ns.expiry).(nonceExpiry)
+		if timestamp, exists := ns.lookup(oldest.key); exists && timestamp.Equal(oldest.timestamp) {
+			ns.forget(oldest.key)
+			ns.evicted++
+		}
+	}
+}
+
+// List returns up to limit tracked nonces of every tenant starting with
+// prefix, newest first. A non-positive limit returns all matches.
+func (ns *NonceStore) List(prefix string, limit int) []entity.NonceRecord {
+	ns.mu.RLock()
+	records := make([]entity.NonceRecord, 0)
+	for tenant, nonces := range ns.nonces {
+		for nonce, timestamp := range nonces {
+			if strings.HasPrefix(nonce, prefix) {
+				records = append(records, entity.NonceRecord{Tenant: tenant, Nonce: nonce, Timestamp: timestamp})
+			}
+		}
+	}
+	ns.mu.RUnlock()
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Timestamp.After(records[j].Timestamp)
+	})
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records
+}
+
+// Delete forgets a nonce of tenant, reporting whether it was tracked
+func (ns *NonceStore) Delete(tenant, nonce string) bool {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	return ns.forget(nonceKey{tenant: tenant, nonce: nonce})
+}
+
+// Purge forgets all nonces and returns how many were removed
+func (ns *NonceStore) Purge() int {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	count := ns.count
+	ns.nonces = make(map[string]map[string]time.Time)
+	ns.count = 0
+	ns.expiry = nil
+	return count
+}
+
+// Len returns the number of tracked nonces
+func (ns *NonceStore) Len() int {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+
+	return ns.count
+}
+
+// Evicted returns the number of nonces expired since the store was created
+func (ns *NonceStore) Evicted() int64 {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+
+	return ns.evicted
+}
+
+// Save writes the tracked nonces to path as JSON. The file is replaced
+// atomically, so a crash never leaves a partial store behind.
+func (ns *NonceStore) Save(path string) error {
+	data, err := json.Marshal(ns.List("", 0))
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save nonces: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save nonces: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save nonces: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save nonces: %w", err)
+	}
+	return nil
+}
+
+// CheckSave reports whether Save could write to path, by creating and
+// removing a file next to it as Save does
+func CheckSave(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("cannot save nonces: %w", err)
+	}
+	_ = tmp.Close()
+	return os.Remove(tmp.Name())
+}
+
+// Load adds the nonces saved at path by Save to the store, skipping those
+// that have expired since. A missing file is not an error, so a new
+// deployment starts empty. Nonces saved without a tenant, as before tenants
+// had namespaces, belong to the default endpoint.
+func (ns *NonceStore) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load nonces: %w", err)
+	}
+
+	var records []entity.NonceRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("failed to load nonces from %s: %w", path, err)
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	for _, record := range records {
+		key := nonceKey{tenant: record.Tenant, nonce: record.Nonce}
+		if _, exists := ns.lookup(key); exists {
+			continue
+		}
+		ns.record(key, record.Timestamp)
+	}
+	ns.expire(ns.clock.Now())
+	return nil
+}
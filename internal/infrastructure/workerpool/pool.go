@@ -0,0 +1,181 @@
+// Package workerpool runs jobs on a fixed number of workers behind a bounded
+// queue, rejecting work instead of queueing without limit. Each worker has
+// its own share of the queue, so jobs submitted with the same key run one at
+// a time in submission order.
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrQueueFull is returned by Submit when the queue is at capacity
+	ErrQueueFull = errors.New("worker pool queue is full")
+	// ErrClosed is returned by Submit after Shutdown has been called
+	ErrClosed = errors.New("worker pool is shut down")
+	// ErrNotStarted is returned by Submit, wrapping ctx's error, when ctx is
+	// done before a worker starts the job; the job never runs
+	ErrNotStarted = errors.New("job not started")
+)
+
+// States of a queued job. A job leaves jobQueued exactly once, either when
+// a worker starts it or when it is abandoned before that.
+const (
+	jobQueued int32 = iota
+	jobStarted
+	jobAbandoned
+)
+
+// Job is a unit of work run by the pool
+type Job func(ctx context.Context) error
+
+type queuedJob struct {
+	ctx   context.Context
+	run   Job
+	done  chan error
+	state *atomic.Int32
+}
+
+// Pool runs submitted jobs on a fixed set of workers
+type Pool struct {
+	mu     sync.RWMutex
+	closed bool
+	shards []chan queuedJob
+	next   atomic.Uint64
+	wg     sync.WaitGroup
+}
+
+// New starts a pool with the given number of workers and queue depth. The
+// queue depth is split evenly between the workers.
+func New(workers, queueDepth int) (*Pool, error) {
+	if workers <= 0 || queueDepth < 0 {
+		return nil, fmt.Errorf("worker pool needs at least one worker and a non-negative queue depth")
+	}
+
+	p := &Pool{
+		shards: make([]chan queuedJob, workers),
+	}
+	p.wg.Add(workers)
+	for i := range p.shards {
+		depth := queueDepth / workers
+		if i < queueDepth%workers {
+			depth++
+		}
+		p.shards[i] = make(chan queuedJob, depth)
+		go p.work(p.shards[i])
+	}
+	return p, nil
+}
+
+func (p *Pool) work(queue <-chan queuedJob) {
+	defer p.wg.Done()
+	for job := range queue {
+		// Skip jobs whose caller has already given up
+		if err := job.ctx.Err(); err != nil {
+			if job.state.CompareAndSwap(jobQueued, jobAbandoned) {
+				job.done <- fmt.Errorf("%w: %w", ErrNotStarted, err)
+			}
+			continue
+		}
+		if !job.state.CompareAndSwap(jobQueued, jobStarted) {
+			continue
+		}
+		job.done <- job.run(job.ctx)
+	}
+}
+
+// Submit queues job and waits for it to finish, returning its error. It
+// returns ErrQueueFull immediately if the queue is at capacity, and
+// ErrNotStarted if ctx is done before a worker starts the job. Once started,
+// the job is waited for even if ctx is done, so its error is never lost.
+// Jobs are spread over the workers in turn.
+func (p *Pool) Submit(ctx context.Context, job Job) error {
+	shard := (p.next.Add(1) - 1) % uint64(len(p.shards))
+	return p.submit(ctx, p.shards[shard], job)
+}
+
+// SubmitKeyed is Submit for a job that must run after the jobs submitted
+// earlier with the same key, such as the webhooks of one user. All jobs of
+// a key go to the same worker, so a busy key only fills that worker's share
+// of the queue.
+func (p *Pool) SubmitKeyed(ctx context.Context, key string, job Job) error {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(key))
+	return p.submit(ctx, p.shards[hash.Sum64()%uint64(len(p.shards))], job)
+}
+
+func (p *Pool) submit(ctx context.Context, queue chan<- queuedJob, job Job) error {
+	queued := queuedJob{ctx: ctx, run: job, done: make(chan error, 1), state: new(atomic.Int32)}
+
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return ErrClosed
+	}
+	select {
+	case queue <- queued:
+		p.mu.RUnlock()
+	default:
+		p.mu.RUnlock()
+		return ErrQueueFull
+	}
+
+	select {
+	case err := <-queued.done:
+		return err
+	case <-ctx.Done():
+		if queued.state.CompareAndSwap(jobQueued, jobAbandoned) {
+			return fmt.Errorf("%w: %w", ErrNotStarted, ctx.Err())
+		}
+		return <-queued.done
+	}
+}
+
+// QueueLength returns the number of jobs waiting for a worker
+func (p *Pool) QueueLength() int {
+	length := 0
+	for _, queue := range p.shards {
+		length += len(queue)
+	}
+	return length
+}
+
+// QueueCapacity returns the maximum number of waiting jobs
+func (p *Pool) QueueCapacity() int {
+	capacity := 0
+	for _, queue := range p.shards {
+		capacity += cap(queue)
+	}
+	return capacity
+}
+
+// Shutdown stops accepting jobs and waits for queued jobs to finish or ctx
+// to be done
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		for _, queue := range p.shards {
+			close(queue)
+		}
+	}
+	p.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
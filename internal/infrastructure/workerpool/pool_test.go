@@ -0,0 +1,205 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPool_Submit(t *testing.T) {
+	pool, err := New(4, 16)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	var ran atomic.Int32
+	for range 10 {
+		if err := pool.Submit(context.Background(), func(context.Context) error {
+			ran.Add(1)
+			return nil
+		}); err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+	}
+	if ran.Load() != 10 {
+		t.Errorf("ran %d jobs, want 10", ran.Load())
+	}
+
+	wantErr := errors.New("ledger unavailable")
+	if err := pool.Submit(context.Background(), func(context.Context) error { return wantErr }); !errors.Is(err, wantErr) {
+		t.Errorf("Submit() error = %v, want %v", err, wantErr)
+	}
+
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if err := pool.Submit(context.Background(), func(context.Context) error { return nil }); !errors.Is(err, ErrClosed) {
+		t.Errorf("Submit() after Shutdown error = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestPool_Backpressure(t *testing.T) {
+	pool, err := New(1, 1)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	release := make(chan struct{})
+	started := make(chan struct{})
+	blocking := func(context.Context) error {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		return nil
+	}
+
+	// One job occupies the worker, one fills the queue
+	results := make(chan error, 2)
+	go func() { results <- pool.Submit(context.Background(), blocking) }()
+	<-started
+	go func() { results <- pool.Submit(context.Background(), blocking) }()
+	for pool.QueueLength() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := pool.Submit(context.Background(), blocking); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Submit() on full queue error = %v, want %v", err, ErrQueueFull)
+	}
+
+	close(release)
+	for range 2 {
+		if err := <-results; err != nil {
+			t.Errorf("queued Submit() error = %v", err)
+		}
+	}
+	_ = pool.Shutdown(context.Background())
+}
+
+func TestPool_SubmitKeyed(t *testing.T) {
+	pool, err := New(4, 64)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer pool.Shutdown(context.Background())
+	if pool.QueueCapacity() != 64 {
+		t.Errorf("QueueCapacity() = %d, want 64", pool.QueueCapacity())
+	}
+
+	// The first job holds the key's worker while the others queue behind it
+	release := make(chan struct{})
+	started := make(chan struct{})
+	first := make(chan error, 1)
+	go func() {
+		first <- pool.SubmitKeyed(context.Background(), "user1", func(context.Context) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	var (
+		mu    sync.Mutex
+		order []int
+	)
+	results := make(chan error, 8)
+	for i := range 8 {
+		go func() {
+			results <- pool.SubmitKeyed(context.Background(), "user1", func(context.Context) error {
+				mu.Lock()
+				defer mu.Unlock()
+				order = append(order, i)
+				return nil
+			})
+		}()
+		for pool.QueueLength() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// Idle workers do not take the key's queued jobs
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	if len(order) != 0 {
+		t.Errorf("jobs %v ran before the key's first job finished", order)
+	}
+	mu.Unlock()
+
+	close(release)
+	if err := <-first; err != nil {
+		t.Fatalf("SubmitKeyed() error = %v", err)
+	}
+	for range 8 {
+		if err := <-results; err != nil {
+			t.Fatalf("SubmitKeyed() error = %v", err)
+		}
+	}
+	for i, job := range order {
+		if job != i {
+			t.Fatalf("jobs ran in order %v, want submission order", order)
+		}
+	}
+}
+
+func TestPool_SubmitContextCanceled(t *testing.T) {
+	pool, err := New(1, 1)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer pool.Shutdown(context.Background())
+
+	// A started job is waited for and its result returned
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = pool.Submit(ctx, func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Submit() of a started job error = %v, want nil", err)
+	}
+
+	// A job still queued when its context is done never runs
+	started, release := make(chan struct{}), make(chan struct{})
+	busy := make(chan error, 1)
+	go func() {
+		busy <- pool.Submit(context.Background(), func(context.Context) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	var ran atomic.Bool
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = pool.Submit(ctx, func(context.Context) error {
+		ran.Store(true)
+		return nil
+	})
+	if !errors.Is(err, ErrNotStarted) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Submit() of a queued job error = %v, want %v and %v", err, ErrNotStarted, context.DeadlineExceeded)
+	}
+
+	close(release)
+	if err := <-busy; err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if ran.Load() {
+		t.Error("job abandoned before it started ran")
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	if _, err := New(0, 10); err == nil {
+		t.Error("New() with no workers should fail")
+	}
+}
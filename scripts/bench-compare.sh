@@ -0,0 +1,59 @@
+#!/usr/bin/env bash
+# Compares `go test -bench` output against a stored baseline and fails when a
+# benchmark got slower than the allowed threshold or allocates more per op.
+#
+# Usage: scripts/bench-compare.sh <baseline.txt> <current.txt> [threshold-percent]
+#
+# With -count > 1 the fastest run of each benchmark is compared, which is the
+# least noisy figure on a shared machine. Allocations only fail the check when
+# every current run allocates more than every baseline run.
+set -euo pipefail
+
+baseline=${1:?baseline file required}
+current=${2:?current results file required}
+threshold=${3:-20}
+
+awk -v threshold="$threshold" '
+	# Benchmark lines: name iterations ns/op-value "ns/op" [B/op "B/op" allocs "allocs/op"]
+	/^Benchmark/ {
+		name = $1
+		sub(/-[0-9]+$/, "", name)
+		ns = ""; allocs = ""
+		for (i = 3; i < NF; i++) {
+			if ($(i + 1) == "ns/op") ns = $i
+			if ($(i + 1) == "allocs/op") allocs = $i
+		}
+		if (ns == "") next
+		if (FILENAME == ARGV[1]) {
+			if (!(name in baseNs) || ns + 0 < baseNs[name]) baseNs[name] = ns + 0
+			if (allocs != "" && (!(name in baseAllocs) || allocs + 0 > baseAllocs[name])) baseAllocs[name] = allocs + 0
+		} else {
+			if (!(name in curNs) || ns + 0 < curNs[name]) curNs[name] = ns + 0
+			if (allocs != "" && (!(name in curAllocs) || allocs + 0 < curAllocs[name])) curAllocs[name] = allocs + 0
+			order[++n] = name
+		}
+	}
+	END {
+		failed = 0
+		printf "%-60s %14s %14s %8s\n", "benchmark", "baseline ns/op", "current ns/op", "delta"
+		for (i = 1; i <= n; i++) {
+			name = order[i]
+			if (seen[name]++) continue
+			if (!(name in baseNs)) {
+				printf "%-60s %14s %14.1f %8s\n", name, "-", curNs[name], "new"
+				continue
+			}
+			delta = (curNs[name] - baseNs[name]) / baseNs[name] * 100
+			status = ""
+			if (delta > threshold) { status = "  REGRESSION"; failed = 1 }
+			if ((name in baseAllocs) && (name in curAllocs) && curAllocs[name] > baseAllocs[name]) {
+				status = status sprintf("  allocs %d -> %d", baseAllocs[name], curAllocs[name]); failed = 1
+			}
+			printf "%-60s %14.1f %14.1f %+7.1f%%%s\n", name, baseNs[name], curNs[name], delta, status
+		}
+		if (failed) {
+			printf "\nperformance regression beyond %s%% (or more allocations) against %s\n", threshold, ARGV[1]
+			exit 1
+		}
+	}
+' "$baseline" "$current"
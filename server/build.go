@@ -0,0 +1,886 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"kii.com/internal/application/usecase"
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+	"kii.com/internal/infrastructure/analytics"
+	"kii.com/internal/infrastructure/anomaly"
+	"kii.com/internal/infrastructure/archive"
+	"kii.com/internal/infrastructure/attestation"
+	"kii.com/internal/infrastructure/audit"
+	"kii.com/internal/infrastructure/clock"
+	"kii.com/internal/infrastructure/config"
+	"kii.com/internal/infrastructure/events"
+	httphandler "kii.com/internal/infrastructure/http"
+	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/mapper"
+	"kii.com/internal/infrastructure/metrics"
+	"kii.com/internal/infrastructure/mirror"
+	"kii.com/internal/infrastructure/repository"
+	"kii.com/internal/infrastructure/systemd"
+	"kii.com/internal/infrastructure/validator"
+	"kii.com/internal/infrastructure/workerpool"
+)
+
+// builder holds what New assembles a Server from while it runs its build
+// steps, each of which uses what the steps before it built
+type builder struct {
+	*Server
+
+	auditLog *audit.Logger
+	emitter  metrics.Emitter
+
+	shadowLedger *repository.ShadowLedger
+	// The capabilities of the storage backend itself, which the ledger
+	// chain wrapping it in repo only passes through
+	compactable bool
+	prunable    bool
+	batchable   bool
+	holdable    bool
+	holdsFunds  bool
+
+	clock          port.Clock
+	pendingStore   port.PendingEntryStore
+	velocityStore  port.VelocityStore
+	duplicateStore port.DuplicateStore
+	freezeStore    *repository.InMemoryFreezeStore
+	webhookOpts    []usecase.ProcessWebhookOption
+
+	skewTracker *metrics.SkewTracker
+	sources     map[string]httphandler.WebhookSource
+	// placeholderSecret reports whether POST /webhook is validated with
+	// config.DefaultHMACSecret
+	placeholderSecret bool
+
+	userPolicy      entity.UserPolicy
+	eventBus        *events.Bus
+	processWebhook  *usecase.ProcessWebhookUseCase
+	getBalance      *usecase.GetBalanceUseCase
+	streamLedger    *usecase.StreamLedgerUseCase
+	statement       *usecase.GenerateStatementUseCase
+	attestBalance   *usecase.AttestBalanceUseCase
+	attestationKeys []attestation.JWK
+	ledgerArchive   port.LedgerArchive
+	webhookMirror   *mirror.Mirror
+	// outbound are the queues of the background senders by name
+	outbound        map[string]outboundQueue
+	usage           *metrics.UsageMeter
+	stats           *metrics.Collector
+	checkRepository func(context.Context) error
+	mux             *http.ServeMux
+}
+
+// buildLogger builds the logger from the log config, unless the embedding
+// program set its own
+func (s *Server) buildLogger() error {
+	if s.logger != nil {
+		return nil
+	}
+	level, err := logger.ParseLevel(s.cfg.Log.Level)
+	if err != nil {
+		return err
+	}
+	if s.logLevel == nil {
+		s.logLevel = new(slog.LevelVar)
+	}
+	s.logLevel.Set(level)
+	if s.logger, err = logger.New(s.cfg.Log.Backend, s.cfg.Log.Format, s.logLevel); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	if s.cfg.Log.SampleRate > 1 {
+		s.logger = logger.NewSamplingLogger(s.logger)
+	}
+	return nil
+}
+
+// buildSinks opens the audit log and the metrics emitter
+func (b *builder) buildSinks() error {
+	// Security events go to a separate audit sink (disabled unless audit.sink is set)
+	auditLog, err := audit.Open(b.cfg.Audit, b.logger)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	b.auditLog = auditLog
+	b.closers = append(b.closers, func() { _ = auditLog.Close() })
+
+	// Push metrics to StatsD/DogStatsD when configured
+	emitter, err := metrics.NewEmitter(b.cfg.Metrics)
+	if err != nil {
+		return fmt.Errorf("failed to initialize metrics emitter: %w", err)
+	}
+	b.emitter = emitter
+	b.closers = append(b.closers, func() { _ = emitter.Close() })
+	return nil
+}
+
+// buildLedger wraps the ledger repository in the chain configured under
+// storage: timeouts, retries and a circuit breaker, then the shadow
+// repository, then batching
+func (b *builder) buildLedger() error {
+	cfg := b.cfg
+	ledgerRepo := b.repo
+	if ledgerRepo == nil {
+		var err error
+		if ledgerRepo, err = newLedgerRepository(cfg.Storage.Backend, b.logger); err != nil {
+			return fmt.Errorf("failed to initialize repository: %w", err)
+		}
+	}
+
+	// Compaction, pruning, batching, holdings queries and holds need the capability from the storage
+	// backend itself, which the shadow and batching wrappers only pass through
+	_, b.compactable = ledgerRepo.(port.LedgerCompactor)
+	_, b.prunable = ledgerRepo.(port.LedgerPruner)
+	_, b.batchable = ledgerRepo.(port.BatchLedgerRepository)
+	_, b.holdable = ledgerRepo.(port.LedgerHoldingsRepository)
+	_, b.holdsFunds = ledgerRepo.(port.LedgerHoldRepository)
+
+	// Storage operations are bounded in time, transient errors are retried,
+	// and a failing backend is given time to recover while operations fail
+	// fast
+	ledgerRepo = repository.NewResilientLedger(ledgerRepo, repository.ResilientLedgerConfig{
+		MaxAttempts:      cfg.Storage.Retry.MaxAttempts,
+		Backoff:          cfg.Storage.Retry.Backoff,
+		FailureThreshold: cfg.Storage.CircuitBreaker.FailureThreshold,
+		OpenTimeout:      cfg.Storage.CircuitBreaker.OpenTimeout,
+		ReadTimeout:      cfg.Storage.ReadTimeout,
+		WriteTimeout:     cfg.Storage.WriteTimeout,
+	}, b.logger)
+
+	// Mirror writes to a shadow repository when storage.shadow.backend is
+	// set, to compare a new backend with the current one before switching
+	if b.shadow == nil && cfg.Storage.Shadow.Backend != "" {
+		var err error
+		if b.shadow, err = newLedgerRepository(cfg.Storage.Shadow.Backend, b.logger); err != nil {
+			return fmt.Errorf("failed to initialize shadow repository: %w", err)
+		}
+	}
+	if b.shadow != nil {
+		var err error
+		if b.shadowLedger, err = repository.NewShadowLedger(ledgerRepo, b.shadow, cfg.Storage.Shadow.QueueSize, b.logger); err != nil {
+			return err
+		}
+		b.closers = append(b.closers, b.shadowLedger.Close)
+		ledgerRepo = b.shadowLedger
+	}
+
+	// Group ledger writes into transactions when storage.batchSize is set
+	if cfg.Storage.BatchSize > 1 {
+		batchRepo, ok := ledgerRepo.(port.BatchLedgerRepository)
+		if !ok || !b.batchable {
+			return fmt.Errorf("storage backend %q does not support batched writes", cfg.Storage.Backend)
+		}
+		batchingLedger := repository.NewBatchingLedger(batchRepo, cfg.Storage.BatchSize, cfg.Storage.BatchWindow, b.logger)
+		b.closers = append(b.closers, func() { _ = batchingLedger.Close() })
+		ledgerRepo = batchingLedger
+	}
+	b.repo = ledgerRepo
+	return nil
+}
+
+// buildStores builds the stores webhooks are checked against: used nonces,
+// parked entries, velocity, duplicates, freezes and the anomaly detector
+func (b *builder) buildStores() error {
+	cfg := b.cfg
+
+	// Timestamps and nonce expiry are checked against the system clock,
+	// corrected by webhook.clockOffset on a host with known skew
+	b.clock = clock.WithOffset(clock.System{}, cfg.Webhook.ClockOffset)
+	if cfg.Webhook.ClockOffset != 0 {
+		b.logger.LogWarning(context.TODO(), "Correcting the system clock for webhook validation",
+			"clock_offset", cfg.Webhook.ClockOffset.String())
+	}
+	nonceStore := validator.NewNonceStoreWithClock(b.clock)
+	if cfg.Webhook.NonceRetentionMargin < 0 {
+		return fmt.Errorf("webhook.nonceRetentionMargin must not be negative")
+	}
+	b.nonceStore = nonceStore
+	b.nonceRetentionMargin = cfg.Webhook.NonceRetentionMargin
+	// The retention is set before any nonce is tracked, so that the default
+	// it replaces is not kept in effect
+	longest := cfg.Webhook.TimestampTolerance
+	for _, source := range cfg.Sources {
+		longest = max(longest, source.TimestampTolerance)
+	}
+	nonceStore.SetRetention(longest + b.nonceRetentionMargin)
+
+	// Used nonces outlive a restart when webhook.nonceStorePath is set; they
+	// are saved after the last webhook has been validated
+	if path := cfg.Webhook.NonceStorePath; path != "" {
+		if err := nonceStore.Load(path); err != nil {
+			return err
+		}
+		b.logger.LogInfo(context.TODO(), "Nonce store restored", "path", path, "nonces", nonceStore.Len())
+		appLogger := b.logger
+		b.closers = append(b.closers, func() {
+			if err := nonceStore.Save(path); err != nil {
+				appLogger.LogError(context.TODO(), "Failed to save nonce store", err, "path", path)
+				return
+			}
+			appLogger.LogInfo(context.TODO(), "Nonce store saved", "path", path, "nonces", nonceStore.Len())
+		})
+	}
+
+	// High-value entries wait for a second webhook when approval.threshold is set
+	if cfg.Approval.Threshold != "" {
+		threshold, err := decimal.NewFromString(cfg.Approval.Threshold)
+		if err != nil {
+			return fmt.Errorf("approval.threshold: %w", err)
+		}
+		b.pendingStore = repository.NewInMemoryPendingStore(cfg.Approval.PendingTTL)
+		b.webhookOpts = append(b.webhookOpts, usecase.WithApproval(threshold, b.pendingStore, cfg.Approval.DistinctSources))
+		b.logger.LogInfo(context.TODO(), "Approval required for high-value entries",
+			"threshold", threshold.String(),
+			"pending_ttl", cfg.Approval.PendingTTL.String(),
+			"distinct_sources", cfg.Approval.DistinctSources)
+	}
+
+	// Credits over a velocity limit are rejected or parked for review
+	if len(cfg.Velocity.Rules) > 0 {
+		rules, retention, err := velocityRules(cfg.Velocity.Rules)
+		if err != nil {
+			return err
+		}
+		var review port.PendingEntryStore
+		switch cfg.Velocity.Action {
+		case "reject":
+		case "review":
+			if b.pendingStore == nil {
+				b.pendingStore = repository.NewInMemoryPendingStore(cfg.Approval.PendingTTL)
+			}
+			review = b.pendingStore
+		default:
+			return fmt.Errorf("velocity.action: unknown action %q: want reject or review", cfg.Velocity.Action)
+		}
+		b.velocityStore = repository.NewInMemoryVelocityStore(retention)
+		b.webhookOpts = append(b.webhookOpts, usecase.WithVelocityLimits(rules, b.velocityStore, review))
+		b.logger.LogInfo(context.TODO(), "Velocity limits enabled",
+			"rules", len(rules),
+			"action", cfg.Velocity.Action)
+	}
+
+	// Events re-posted under a fresh nonce are logged or rejected
+	if cfg.Duplicates.Window > 0 {
+		if cfg.Duplicates.Action != "log" && cfg.Duplicates.Action != "reject" {
+			return fmt.Errorf("duplicates.action: unknown action %q: want log or reject", cfg.Duplicates.Action)
+		}
+		b.duplicateStore = repository.NewInMemoryDuplicateStore(cfg.Duplicates.Window)
+		b.logger.LogInfo(context.TODO(), "Duplicate detection enabled",
+			"window", cfg.Duplicates.Window.String(),
+			"action", cfg.Duplicates.Action)
+	}
+
+	// Operators pause the webhooks of an asset, e.g. during a chain halt,
+	// with the admin API; freezes outlive a restart when freezes.path is set
+	freezeStore, err := repository.NewInMemoryFreezeStore(cfg.Freezes.Path)
+	if err != nil {
+		return err
+	}
+	b.freezeStore = freezeStore
+	b.webhookOpts = append(b.webhookOpts, usecase.WithAssetFreezes(freezeStore))
+	for _, freeze := range freezeStore.List() {
+		b.logger.LogWarning(context.TODO(), "Asset frozen",
+			"asset", freeze.Asset,
+			"reason", freeze.Reason,
+			"frozen_at", freeze.FrozenAt.Format(time.RFC3339))
+	}
+
+	// Suspicious entries are held for review
+	if b.detector == nil && (cfg.Anomaly.AmountFactor > 0 || cfg.Anomaly.BurstCount > 0) {
+		b.detector = anomaly.NewDetector(anomaly.Rules{
+			AmountFactor: decimal.NewFromFloat(cfg.Anomaly.AmountFactor),
+			MinHistory:   cfg.Anomaly.MinHistory,
+			BurstCount:   cfg.Anomaly.BurstCount,
+			BurstWindow:  cfg.Anomaly.BurstWindow,
+		}, b.clock)
+		b.logger.LogInfo(context.TODO(), "Anomaly detection enabled",
+			"amount_factor", cfg.Anomaly.AmountFactor,
+			"min_history", cfg.Anomaly.MinHistory,
+			"burst_count", cfg.Anomaly.BurstCount,
+			"burst_window", cfg.Anomaly.BurstWindow.String())
+	}
+	if b.detector != nil {
+		if b.pendingStore == nil {
+			b.pendingStore = repository.NewInMemoryPendingStore(cfg.Approval.PendingTTL)
+		}
+		b.webhookOpts = append(b.webhookOpts, usecase.WithAnomalyDetector(b.detector, b.pendingStore))
+	}
+
+	// Every replica must see the same state in cluster mode, as must the
+	// process a handover starts
+	b.stateStores = b.stores()
+	if cfg.Cluster.Enabled {
+		return requireSharedState("cluster mode", b.stateStores)
+	}
+	return nil
+}
+
+// stores returns the stores holding state webhooks are checked against, by
+// the name they are reported with
+func (b *builder) stores() map[string]any {
+	stores := map[string]any{
+		"ledger (storage.backend=" + b.cfg.Storage.Backend + ")": b.repo,
+		"nonce store": b.nonceStore,
+	}
+	if b.velocityStore != nil {
+		stores["velocity store"] = b.velocityStore
+	}
+	if b.duplicateStore != nil {
+		stores["duplicate store"] = b.duplicateStore
+	}
+	if b.detector != nil {
+		stores["anomaly detector"] = b.detector
+	}
+	if b.pendingStore != nil {
+		stores["pending entry store"] = b.pendingStore
+	}
+	return stores
+}
+
+// buildValidators builds the validators of POST /webhook and of the named
+// sources, with their canaries, and sizes the nonce retention after their
+// tolerances
+func (b *builder) buildValidators() error {
+	cfg := b.cfg
+
+	// The clock skew of signed webhooks is tracked per source, telling
+	// senders' clock skew apart from replays
+	b.skewTracker = metrics.NewSkewTracker(b.emitter)
+	if b.validator == nil {
+		b.placeholderSecret = cfg.Webhook.HMACSecret == config.DefaultHMACSecret
+		b.validator = validator.NewHMACValidatorWithNonceStore(
+			cfg.Webhook.HMACSecret,
+			cfg.Webhook.TimestampTolerance,
+			b.nonceStore,
+			b.logger,
+			validator.WithClock(b.clock),
+			validator.WithSkewRecorder(b.skewTracker),
+		)
+	}
+
+	// Named senders served at /webhook/{source}, each with its own secret
+	if err := config.ValidateSecrets(cfg); err != nil {
+		return err
+	}
+	sources, err := webhookSources(cfg.Sources, b.nonceStore, b.clock, b.skewTracker, b.logger)
+	if err != nil {
+		return err
+	}
+	b.sources = sources
+
+	// Mounted secret files are re-read when they change
+	if setter, ok := b.validator.(secretSetter); ok && cfg.Webhook.HMACSecretFile != "" {
+		b.closers = append(b.closers, watchSecretFile(config.DefaultSource, cfg.Webhook.HMACSecretFile, cfg.Webhook.HMACSecret, setter, b.auditLog, b.logger))
+	}
+	for name, source := range sources {
+		sourceCfg := cfg.Sources[name]
+		if setter, ok := source.Validator.(secretSetter); ok && sourceCfg.SecretFile != "" {
+			b.closers = append(b.closers, watchSecretFile(name, sourceCfg.SecretFile, sourceCfg.Secret, setter, b.auditLog, b.logger))
+		}
+	}
+
+	// Candidate validators are checked alongside the endpoints' own, which
+	// alone decide. The secret file watches above keep updating the primaries.
+	if b.canary == nil && cfg.Webhook.Canary.Secret != "" {
+		if b.canary, err = canaryValidator(cfg.Webhook.Canary, cfg.Webhook.TimestampTolerance, b.clock, b.logger); err != nil {
+			return fmt.Errorf("webhook.canary: %w", err)
+		}
+	}
+	if b.canary != nil {
+		b.validator = validator.NewCanaryValidator("default", b.validator, b.canary, b.emitter, b.logger)
+		b.logger.LogInfo(context.TODO(), "Canary validator enabled", "canary", "default")
+	}
+	for name, source := range sources {
+		sourceCfg := cfg.Sources[name]
+		if sourceCfg.Canary.Secret == "" {
+			continue
+		}
+		candidate, err := canaryValidator(sourceCfg.Canary, sourceCfg.TimestampTolerance, b.clock, b.logger)
+		if err != nil {
+			return fmt.Errorf("sources.%s.canary: %w", name, err)
+		}
+		source.Validator = validator.NewCanaryValidator(name, source.Validator, candidate, b.emitter, b.logger)
+		sources[name] = source
+		b.logger.LogInfo(context.TODO(), "Canary validator enabled", "canary", name)
+	}
+	b.tolerances = make(map[string]httphandler.ToleranceValidator)
+	for name, source := range sources {
+		if v, ok := source.Validator.(httphandler.ToleranceValidator); ok {
+			b.tolerances[name] = v
+		}
+	}
+	if v, ok := b.validator.(httphandler.ToleranceValidator); ok {
+		b.tolerances[config.DefaultSource] = v
+	}
+
+	// Used nonces are remembered as long as a replay could pass the
+	// timestamp check, following the tolerances as they change
+	b.updateNonceRetention()
+	b.logger.LogInfo(context.TODO(), "Remembering used nonces",
+		"retention", b.nonceStore.Retention().String(),
+		"margin", b.nonceRetentionMargin.String())
+	return nil
+}
+
+// buildUseCases builds the use cases the handlers serve, applying the user,
+// amount and hold policies to webhooks
+func (b *builder) buildUseCases() error {
+	cfg := b.cfg
+
+	// Parked debits are held, so balances show what is available until they
+	// are approved, rejected or expire
+	if b.pendingStore != nil && b.holdsFunds {
+		b.webhookOpts = append(b.webhookOpts, usecase.WithHolds(b.repo.(port.LedgerHoldRepository), cfg.Approval.PendingTTL))
+	}
+
+	// Junk user identifiers are rejected instead of creating ledger accounts
+	userPolicy, err := newUserPolicy(cfg.Users)
+	if err != nil {
+		return err
+	}
+	b.userPolicy = userPolicy
+	if userPolicy.Pattern != nil || userPolicy.MaxLength > 0 || userPolicy.Case != entity.UserCasePreserve {
+		b.webhookOpts = append(b.webhookOpts, usecase.WithUserPolicy(userPolicy))
+		b.logger.LogInfo(context.TODO(), "User policy enabled",
+			"pattern", cfg.Users.Pattern,
+			"max_length", cfg.Users.MaxLength,
+			"case", string(userPolicy.Case))
+	}
+
+	// Amounts with more decimal places than their asset keeps are rounded
+	// as configured, rather than by the ledger when it formats balances
+	amountPolicy, err := newAmountPolicy(cfg.Assets)
+	if err != nil {
+		return err
+	}
+	b.webhookOpts = append(b.webhookOpts, usecase.WithAmountPolicy(amountPolicy))
+	for asset, precision := range amountPolicy.Assets {
+		b.logger.LogInfo(context.TODO(), "Asset precision configured",
+			"asset", asset,
+			"scale", precision.Scale,
+			"rounding", string(precision.Rounding))
+	}
+
+	// Every entry applied is published as a balance event in process, and
+	// to the broker selected by events.publisher
+	b.eventBus = events.NewBus()
+	for _, publisher := range b.publishers {
+		b.eventBus.Subscribe(publisher)
+	}
+	b.webhookOpts = append(b.webhookOpts, usecase.WithEventPublisher(b.eventBus))
+
+	// Batches and trades are applied as one unit of work: the embedding
+	// program's, or else one staging their entries for a single AddEntries
+	if b.unitOfWork == nil && b.batchable {
+		if batchRepo, ok := b.repo.(port.BatchLedgerRepository); ok {
+			b.unitOfWork = repository.NewUnitOfWork(batchRepo)
+		}
+	}
+	if b.unitOfWork != nil {
+		b.webhookOpts = append(b.webhookOpts, usecase.WithUnitOfWork(b.unitOfWork))
+	}
+
+	b.processWebhook = usecase.NewProcessWebhookUseCase(b.validator, b.repo, b.webhookOpts...)
+	b.getBalance = usecase.NewGetBalanceUseCase(b.repo)
+	b.streamLedger = usecase.NewStreamLedgerUseCase(b.repo)
+	b.statement = usecase.NewGenerateStatementUseCase(b.repo, b.clock)
+
+	// Balances are attested with signatures third parties verify offline
+	// against the published public key
+	if cfg.Attestation.KeyFile != "" {
+		signer, err := attestation.LoadSigner(cfg.Attestation.KeyFile, cfg.Attestation.KeyID)
+		if err != nil {
+			return err
+		}
+		b.attestBalance = usecase.NewAttestBalanceUseCase(b.repo, signer, b.clock)
+		b.attestationKeys = []attestation.JWK{signer.PublicKey()}
+		b.logger.LogInfo(context.TODO(), "Balance attestations enabled", "key_id", signer.PublicKey().Kid)
+	}
+	return nil
+}
+
+// buildBackgroundWork starts the work done apart from requests: retention,
+// mirroring, event publishing and export, shadow comparison, the worker pool
+// and usage persistence
+func (b *builder) buildBackgroundWork() error {
+	cfg := b.cfg
+	b.outbound = make(map[string]outboundQueue)
+
+	// Entries pruned from the ledger are kept in object storage, readable
+	// through the admin API even while pruning is off
+	if cfg.Retention.ObjectStore.Backend != "" {
+		objectArchive, err := archive.Open(cfg.Retention.ObjectStore)
+		if err != nil {
+			return fmt.Errorf("retention: %w", err)
+		}
+		b.ledgerArchive = objectArchive
+	}
+
+	// Zero balances and idle users are compacted away, and old entries
+	// pruned, in the background
+	if cfg.Retention.MaxAge > 0 && cfg.Retention.Interval <= 0 {
+		return fmt.Errorf("retention.interval is required to prune entries after retention.maxAge")
+	}
+	if cfg.Retention.Interval > 0 {
+		if !b.compactable {
+			return fmt.Errorf("retention: %w", entity.ErrCompactionUnsupported)
+		}
+		var userArchive port.UserArchive
+		if cfg.Retention.IdleAfter > 0 {
+			if cfg.Retention.ArchivePath == "" {
+				return fmt.Errorf("retention.archivePath is required to archive idle users")
+			}
+			fileArchive, err := repository.OpenFileUserArchive(cfg.Retention.ArchivePath)
+			if err != nil {
+				return err
+			}
+			b.closers = append(b.closers, func() { _ = fileArchive.Close() })
+			userArchive = fileArchive
+		}
+		compactLedgerUseCase := usecase.NewCompactLedgerUseCase(b.repo, userArchive, cfg.Retention.IdleAfter, b.clock)
+
+		var pruneLedgerUseCase *usecase.PruneLedgerUseCase
+		if cfg.Retention.MaxAge > 0 {
+			if !b.prunable {
+				return fmt.Errorf("retention: %w", entity.ErrPruningUnsupported)
+			}
+			if b.ledgerArchive == nil {
+				return fmt.Errorf("retention.objectStore.backend is required to prune entries after retention.maxAge")
+			}
+			pruneLedgerUseCase = usecase.NewPruneLedgerUseCase(b.repo, b.ledgerArchive, cfg.Retention.MaxAge, b.clock)
+		}
+
+		b.closers = append(b.closers, retainPeriodically(compactLedgerUseCase, pruneLedgerUseCase, cfg.Retention.Interval, b.logger))
+		b.logger.LogInfo(context.TODO(), "Ledger retention enabled",
+			"interval", cfg.Retention.Interval.String(),
+			"idle_after", cfg.Retention.IdleAfter.String(),
+			"archive_path", cfg.Retention.ArchivePath,
+			"max_age", cfg.Retention.MaxAge.String(),
+			"object_store", cfg.Retention.ObjectStore.Backend)
+	}
+
+	// Validated webhooks are copied to a staging deployment when mirror.url
+	// is set, re-signed with its secret
+	if cfg.Mirror.URL != "" {
+		var err error
+		if b.webhookMirror, err = mirror.New(cfg.Mirror, b.emitter, b.logger); err != nil {
+			return err
+		}
+		b.closers = append(b.closers, b.webhookMirror.Close)
+		b.outbound["mirror"] = b.webhookMirror
+		b.logger.LogInfo(context.TODO(), "Mirroring webhooks", "url", b.webhookMirror.URL())
+	}
+
+	if publisher, err := eventPublisher(cfg.Events, b.emitter, b.logger); err != nil {
+		return err
+	} else if publisher != nil {
+		b.eventBus.Subscribe(publisher)
+		b.closers = append(b.closers, publisher.Close)
+		b.outbound["events"] = publisher
+	}
+
+	// Applied entries are exported to object storage for the data warehouse
+	// when analytics.objectStore.backend is set
+	if cfg.Analytics.ObjectStore.Backend != "" {
+		store, err := archive.OpenStore(cfg.Analytics.ObjectStore)
+		if err != nil {
+			return fmt.Errorf("analytics: %w", err)
+		}
+		exporter, err := analytics.NewExporter(store, cfg.Analytics, b.emitter, b.logger)
+		if err != nil {
+			return err
+		}
+		b.eventBus.Subscribe(exporter)
+		b.closers = append(b.closers, exporter.Close)
+		b.outbound["analytics"] = exporter
+		b.logger.LogInfo(context.TODO(), "Exporting balance events for analytics",
+			"object_store", cfg.Analytics.ObjectStore.Backend,
+			"interval", cfg.Analytics.Interval.String())
+	}
+
+	if b.shadowLedger != nil {
+		b.closers = append(b.closers, compareShadowPeriodically(b.shadowLedger, cfg.Storage.Shadow.CompareInterval, b.emitter, b.logger))
+		b.logger.LogInfo(context.TODO(), "Shadow repository enabled",
+			"backend", cfg.Storage.Shadow.Backend,
+			"compare_interval", cfg.Storage.Shadow.CompareInterval.String())
+	}
+
+	// Webhooks are applied to the ledger on a bounded pool so bursts queue
+	// up to workers.queueDepth and are rejected with 503 beyond that
+	var err error
+	if b.pool, err = workerpool.New(cfg.Workers.PoolSize, cfg.Workers.QueueDepth); err != nil {
+		return fmt.Errorf("invalid worker pool configuration: %w", err)
+	}
+
+	// Monthly usage per tenant (webhook source) for billing, persisted
+	// when usage.path is set
+	b.usage = metrics.NewUsageMeter()
+	if cfg.Usage.Path != "" {
+		if err := b.usage.Load(cfg.Usage.Path); err != nil {
+			return fmt.Errorf("failed to load usage: %w", err)
+		}
+	}
+	b.closers = append(b.closers, persistUsage(b.usage, cfg.Usage.Path, b.logger))
+	b.closers = append(b.closers, emitGauges(b.emitter, b.nonceStore, b.duplicateStore, b.pool))
+	return nil
+}
+
+// buildHandlers registers the webhook, balance, health, admin and debug
+// routes
+func (b *builder) buildHandlers() error {
+	cfg := b.cfg
+
+	// Sources whose failed webhooks are logged in full; adjustable via the
+	// admin API and Reload
+	var err error
+	if b.capture, err = httphandler.NewDebugCapture(cfg.Debug.CaptureSources); err != nil {
+		return err
+	}
+
+	// Senders that cannot emit string amounts may send JSON numbers to
+	// POST /webhook when webhook.lenientAmounts is set
+	payloadMapper := mapper.NewNative()
+	if cfg.Webhook.LenientAmounts {
+		payloadMapper = mapper.NewLenient()
+		b.logger.LogInfo(context.TODO(), "Accepting numeric webhook amounts")
+	}
+
+	// Error messages reworded or translated by code; codes and statuses
+	// are unchanged
+	var errorCatalog *httphandler.ErrorCatalog
+	if len(cfg.Errors.Messages) > 0 || len(cfg.Errors.Locales) > 0 {
+		if errorCatalog, err = httphandler.NewErrorCatalog(cfg.Errors.Messages, cfg.Errors.Locales); err != nil {
+			return fmt.Errorf("errors: %w", err)
+		}
+		b.logger.LogInfo(context.TODO(), "Error messages overridden",
+			"messages", len(cfg.Errors.Messages),
+			"locales", len(cfg.Errors.Locales))
+	}
+
+	b.stats = metrics.NewCollector()
+	handler := httphandler.NewHandler(
+		b.processWebhook,
+		b.getBalance,
+		b.validator,
+		b.logger,
+		httphandler.WithStats(b.stats),
+		httphandler.WithMetrics(b.emitter),
+		httphandler.WithAssetTags(slices.Collect(maps.Keys(cfg.Assets))),
+		httphandler.WithAudit(b.auditLog),
+		httphandler.WithLogSampler(logger.NewSampler(cfg.Log.SampleRate)),
+		httphandler.WithDebugCapture(b.capture),
+		httphandler.WithSignatureHints(cfg.Debug.SignatureHints),
+		httphandler.WithMaxBodyBytes(cfg.Webhook.MaxBodyBytes),
+		httphandler.WithMirror(b.webhookMirror),
+		httphandler.WithDuplicateCheck(b.duplicateStore, cfg.Duplicates.Action == "reject"),
+		httphandler.WithClock(b.clock),
+		httphandler.WithWorkerPool(b.pool),
+		httphandler.WithLedgerHistory(b.streamLedger),
+		httphandler.WithStatements(b.statement),
+		httphandler.WithSources(b.sources),
+		httphandler.WithPayloadMapper(payloadMapper),
+		httphandler.WithUsage(b.usage),
+		httphandler.WithAttestation(b.attestBalance, b.attestationKeys),
+		httphandler.WithErrorCatalog(errorCatalog),
+		httphandler.WithUserPolicy(b.userPolicy),
+		httphandler.WithMock(b.mock),
+		httphandler.WithReadOnly(b.readOnly),
+	)
+	b.mux = handler.SetupRoutes()
+
+	b.buildHealth()
+
+	// Under a systemd watchdog, the service is restarted once the ledger
+	// stops responding
+	if interval := systemd.WatchdogInterval(); interval > 0 {
+		b.closers = append(b.closers, watchdogPeriodically(b.checkRepository, interval, b.logger))
+	}
+
+	b.buildAdmin()
+	return nil
+}
+
+// buildHealth registers liveness and per-dependency health for
+// orchestrators and dashboards
+func (b *builder) buildHealth() {
+	cfg := b.cfg
+	health := httphandler.NewHealthHandler(b.logger)
+	ledgerRepo := b.repo
+	b.checkRepository = func(ctx context.Context) error {
+		_, err := ledgerRepo.GetBalance(ctx, "kii-healthcheck")
+		return err
+	}
+	health.AddCheck("repository", b.checkRepository)
+	// The nonce store itself is in memory; what can fail is saving it
+	if path := cfg.Webhook.NonceStorePath; path != "" {
+		health.AddCheck("nonce store", func(context.Context) error {
+			return validator.CheckSave(path)
+		})
+	}
+	placeholder := b.placeholderSecret
+	health.AddCheck("secret provider", func(context.Context) error {
+		if placeholder {
+			return errors.New("webhook.hmacSecret is the placeholder secret")
+		}
+		return checkSecretFiles(cfg)
+	})
+	s := b.Server
+	health.AddCheck("shutdown", func(context.Context) error {
+		if s.draining.Load() {
+			return errors.New("shutting down")
+		}
+		return nil
+	})
+	health.AddCheck("worker pool", func(context.Context) error {
+		if s.pool.QueueLength() >= s.pool.QueueCapacity() {
+			return errors.New("webhook queue is full")
+		}
+		return nil
+	})
+	// Background senders drop what they are handed while their queue is full
+	if len(b.outbound) > 0 {
+		outbound := b.outbound
+		health.AddCheck("outbound queue", func(context.Context) error {
+			var full []string
+			for _, name := range slices.Sorted(maps.Keys(outbound)) {
+				if q := outbound[name]; q.QueueLength() >= q.QueueCapacity() {
+					full = append(full, name)
+				}
+			}
+			if len(full) > 0 {
+				return fmt.Errorf("%s queue is full", strings.Join(full, ", "))
+			}
+			return nil
+		})
+	}
+	health.RegisterRoutes(b.mux)
+}
+
+// outboundQueue is the queue of a background sender
+type outboundQueue interface {
+	QueueLength() int
+	QueueCapacity() int
+}
+
+// checkSecretFiles reports the first of the secret files in cfg that cannot
+// be read, so that a secret that stops rotating is noticed
+func checkSecretFiles(cfg *config.Config) error {
+	if path := cfg.Webhook.HMACSecretFile; path != "" {
+		if _, err := config.ReadSecretFile(path); err != nil {
+			return fmt.Errorf("webhook.hmacSecretFile: %w", err)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Sources)) {
+		if path := cfg.Sources[name].SecretFile; path != "" {
+			if _, err := config.ReadSecretFile(path); err != nil {
+				return fmt.Errorf("sources.%s.secretFile: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// buildAdmin registers the admin API, which is only exposed when a token is
+// configured, and the debug endpoints sharing its token. Without a level
+// variable there is nothing for /admin/log-level to change.
+func (b *builder) buildAdmin() {
+	cfg := b.cfg
+	if cfg.Admin.Token != "" {
+		adminOpts := []httphandler.AdminOption{
+			httphandler.WithAdminDebugCapture(b.capture),
+			httphandler.WithAdminExport(b.streamLedger),
+			httphandler.WithAdminUsage(b.usage),
+			httphandler.WithAdminQueue(b.pool),
+			httphandler.WithAdminTolerances(b.retainingTolerances()),
+			httphandler.WithAdminClockSkew(b.skewTracker),
+			httphandler.WithAdminFreezes(b.freezeStore),
+			httphandler.WithAdminReadOnly(b.readOnly),
+		}
+		if b.pendingStore != nil {
+			adminOpts = append(adminOpts,
+				httphandler.WithAdminPending(b.pendingStore),
+				httphandler.WithAdminApprover(b.processWebhook),
+				httphandler.WithAdminHoldReleaser(b.processWebhook))
+		}
+		if b.duplicateStore != nil {
+			adminOpts = append(adminOpts, httphandler.WithAdminDuplicates(b.duplicateStore))
+		}
+		if b.ledgerArchive != nil {
+			adminOpts = append(adminOpts, httphandler.WithAdminArchive(b.ledgerArchive))
+		}
+		if b.holdable {
+			adminOpts = append(adminOpts, httphandler.WithAdminHoldings(usecase.NewQueryHoldingsUseCase(b.repo)))
+		}
+		adminHandler := httphandler.NewAdminHandler(b.nonceStore, b.stats, b.auditLog, b.logLevel, b.logger, adminOpts...)
+		adminHandler.RegisterRoutes(b.mux, cfg.Admin.Token)
+	} else {
+		b.logger.LogInfo(context.TODO(), "Admin API disabled (admin.token not set)")
+	}
+
+	if cfg.Debug.Enabled {
+		if cfg.Admin.Token != "" {
+			debugHandler := httphandler.NewDebugHandler(b.nonceStore, b.repo, b.logger)
+			debugHandler.RegisterRoutes(b.mux, cfg.Admin.Token)
+			b.logger.LogWarning(context.TODO(), "Debug endpoints enabled under /debug/")
+		} else {
+			b.logger.LogWarning(context.TODO(), "Debug endpoints not served: debug.enabled requires admin.token")
+		}
+	}
+}
+
+// buildListeners wraps the routes in the access log and builds the HTTP
+// server the listeners are served with
+func (b *builder) buildListeners() error {
+	cfg := b.cfg
+
+	// Optional web-server-style access log covering every route
+	accessLog, closeAccessLog, err := openAccessLog(cfg.AccessLog)
+	if err != nil {
+		return fmt.Errorf("failed to open access log: %w", err)
+	}
+	b.closers = append(b.closers, closeAccessLog)
+
+	s := b.Server
+	s.handler = httphandler.AccessLogMiddleware(b.mux.ServeHTTP, accessLog)
+	// After a handover each connection closes once its request is answered
+	s.httpServer = newHTTPServer(cfg.Server, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.handedOver.Load() {
+			w.Header().Set("Connection", "close")
+		}
+		s.handler.ServeHTTP(w, r)
+	}))
+	if cfg.Server.TLSCertFile != "" {
+		if err := s.loadCertificate(cfg.Server); err != nil {
+			return err
+		}
+		s.httpServer.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return s.certificate.Load(), nil
+			},
+		}
+	}
+	s.httpServer.ConnState = func(_ net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			s.openConns.Add(1)
+		case http.StateClosed, http.StateHijacked:
+			s.openConns.Add(-1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"kii.com/internal/infrastructure/audit"
+	"kii.com/internal/infrastructure/config"
+	"kii.com/internal/infrastructure/logger"
+)
+
+// secretFilePollInterval is how often a mounted secret file is re-read. A
+// variable so tests can poll faster.
+var secretFilePollInterval = 10 * time.Second
+
+// secretSetter is implemented by validators whose HMAC secret can be
+// replaced at runtime
+type secretSetter interface {
+	SetSecret(secret string)
+}
+
+// watchSecretFile re-reads the HMAC secret file of source every
+// secretFilePollInterval and applies the secret when it changes. Polling also follows Kubernetes
+// secret volumes, which are updated by swapping a symlink rather than writing
+// the file. While the file cannot be read the current secret is kept. The
+// returned function stops watching.
+func watchSecretFile(source, path, current string, setter secretSetter, auditLog *audit.Logger, appLogger logger.Logger) func() {
+	ticker := time.NewTicker(secretFilePollInterval)
+	done := make(chan struct{})
+
+	go func() {
+		failing := false
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				secret, err := config.ReadSecretFile(path)
+				if err != nil {
+					// Log once per outage rather than on every poll
+					if !failing {
+						appLogger.LogError(context.TODO(), "Failed to re-read HMAC secret file, keeping current secret", err,
+							"source", source,
+							"path", path)
+					}
+					failing = true
+					continue
+				}
+				failing = false
+				if secret == current {
+					continue
+				}
+
+				setter.SetSecret(secret)
+				current = secret
+				fingerprint := audit.Fingerprint(secret)
+				appLogger.LogWarning(context.TODO(), "HMAC secret reloaded from file",
+					"source", source,
+					"path", path,
+					"fingerprint", fingerprint)
+				auditLog.Record(context.TODO(), audit.Event{
+					Type: audit.EventSecretRotated,
+					Details: map[string]string{
+						"source":      source,
+						"secret_file": path,
+						"fingerprint": fingerprint,
+					},
+				})
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
@@ -0,0 +1,1299 @@
+// Package server embeds the webhook receiver and ledger in another Go
+// program. It serves the same routes as the kii server command, assembled
+// from a Config, and lets the host program supply its own ledger repository,
+// webhook validator and logger:
+//
+//	cfg, err := server.LoadConfig("config")
+//	if err != nil { ... }
+//	srv, err := server.New(cfg, server.WithRepository(myLedger))
+//	if err != nil { ... }
+//	go srv.ListenAndServe()
+//	defer srv.Shutdown(ctx)
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"golang.org/x/net/netutil"
+
+	defaultconfig "kii.com/cmd/config"
+	"kii.com/internal/application/usecase"
+	"kii.com/internal/domain/entity"
+	"kii.com/internal/domain/port"
+	"kii.com/internal/infrastructure/config"
+	"kii.com/internal/infrastructure/events"
+	"kii.com/internal/infrastructure/handover"
+	httphandler "kii.com/internal/infrastructure/http"
+	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/mapper"
+	"kii.com/internal/infrastructure/metrics"
+	"kii.com/internal/infrastructure/proxyproto"
+	"kii.com/internal/infrastructure/repository"
+	"kii.com/internal/infrastructure/systemd"
+	"kii.com/internal/infrastructure/validator"
+	"kii.com/internal/infrastructure/workerpool"
+)
+
+// usageSaveInterval is how often usage is saved to usage.path
+const usageSaveInterval = time.Minute
+
+// Types the embedding program implements or configures. They are aliases, so
+// values are interchangeable with the ones used inside kii.
+type (
+	// Config is the server configuration, as loaded by LoadConfig
+	Config = config.Config
+	// LedgerEntry is a single balance change
+	LedgerEntry = entity.LedgerEntry
+	// BalanceResponse is a user's balance per asset
+	BalanceResponse = entity.BalanceResponse
+	// LedgerRepository stores ledger entries and balances
+	LedgerRepository = port.LedgerRepository
+	// BatchLedgerRepository is a LedgerRepository that can apply several
+	// entries in one transaction, required for storage.batchSize
+	BatchLedgerRepository = port.BatchLedgerRepository
+	// UnitOfWork runs the entries of a batch or trade as one transaction of
+	// the storage backend
+	UnitOfWork = port.UnitOfWork
+	// LedgerHistoryRepository is a LedgerRepository that can stream a user's
+	// entries, required for GET /ledger/{user} and the export admin API
+	LedgerHistoryRepository = port.LedgerHistoryRepository
+	// LedgerCompactor is a LedgerRepository that can remove zero balances and
+	// archive idle users, required for retention.interval
+	LedgerCompactor = port.LedgerCompactor
+	// LedgerPruner is a LedgerRepository that can move old entries to the
+	// archive, required for retention.maxAge
+	LedgerPruner = port.LedgerPruner
+	// LedgerHoldRepository is a LedgerRepository that can set funds aside,
+	// required to hold parked debits
+	LedgerHoldRepository = port.LedgerHoldRepository
+	// Hold is an amount of a user's asset set aside
+	Hold = entity.Hold
+	// LedgerHoldingsRepository is a LedgerRepository that ranks holders and
+	// buckets balances by asset, required for the holdings admin API
+	LedgerHoldingsRepository = port.LedgerHoldingsRepository
+	// Holder is a user's balance of one asset
+	Holder = entity.Holder
+	// BalanceDistribution describes how an asset's balances are spread
+	BalanceDistribution = entity.BalanceDistribution
+	// ArchivedUser is an idle user's history handed to the archive
+	ArchivedUser = entity.ArchivedUser
+	// CompactionResult counts what one compaction removed
+	CompactionResult = entity.CompactionResult
+	// SharedStore is implemented by stores that keep their state outside the
+	// process, required for every store in cluster mode
+	SharedStore = port.SharedStore
+	// WebhookValidator authenticates webhooks sent to POST /webhook
+	WebhookValidator = port.WebhookValidator
+	// StreamingWebhookValidator is a WebhookValidator that signs the body as
+	// it is read
+	StreamingWebhookValidator = port.StreamingWebhookValidator
+	// BodyVerifier is written a webhook's body by a StreamingWebhookValidator
+	// and then validates it
+	BodyVerifier = port.BodyVerifier
+	// NonceReleaser is a WebhookValidator that can forget the nonce of a
+	// webhook that was not applied, so that its sender can retry it as sent
+	NonceReleaser = port.NonceReleaser
+	// AnomalyDetector decides which entries are held for review before they
+	// are applied
+	AnomalyDetector = port.AnomalyDetector
+	// EventPublisher is handed a BalanceEvent for every entry applied
+	EventPublisher = port.EventPublisher
+	// BalanceEvent announces an entry applied to the ledger
+	BalanceEvent = entity.BalanceEvent
+	// Logger is the logger the server writes to
+	Logger = logger.Logger
+)
+
+// ErrStorageTransient is wrapped by repository errors that left nothing
+// applied, so that storage.retry retries the operation and repeated ones open
+// the circuit breaker
+var ErrStorageTransient = entity.ErrStorageTransient
+
+// toleranceSetter is implemented by validators whose timestamp tolerance can
+// be changed at runtime
+type toleranceSetter interface {
+	SetTimestampTolerance(tolerance time.Duration)
+}
+
+// Server is a webhook receiver and ledger assembled from a Config
+type Server struct {
+	cfg        *Config
+	logger     Logger
+	logLevel   *slog.LevelVar
+	repo       LedgerRepository
+	shadow     LedgerRepository
+	unitOfWork UnitOfWork
+	validator  WebhookValidator
+	canary     WebhookValidator
+	detector   AnomalyDetector
+	publishers []EventPublisher
+	capture    *httphandler.DebugCapture
+	// tolerances are the validators of the webhook sources, by name, whose
+	// timestamp tolerance can be changed at runtime
+	tolerances map[string]httphandler.ToleranceValidator
+	pool       *workerpool.Pool
+	handler    http.Handler
+	httpServer *http.Server
+	// nonceStore remembers used nonces for the longest of the tolerances
+	// plus nonceRetentionMargin; retentionMu orders its updates
+	nonceStore           *validator.NonceStore
+	nonceRetentionMargin time.Duration
+	retentionMu          sync.Mutex
+	// certificate is served on TCP listeners when server.tlsCertFile is set,
+	// and replaced by Reload
+	certificate atomic.Pointer[tls.Certificate]
+	// draining is set once Shutdown starts
+	draining atomic.Bool
+	// listeners are the ones being served, before the connection limit,
+	// kept for Handover
+	listenersMu sync.Mutex
+	listeners   []net.Listener
+	// stateStores are the stores holding state webhooks are checked
+	// against, by the name they are reported with
+	stateStores map[string]any
+	// handedOver is set once another process serves on the listeners
+	handedOver atomic.Bool
+	// openConns counts open client connections, which finish before the
+	// server shuts down after a handover
+	openConns atomic.Int64
+	// mock accepts webhooks that fail validation and keeps nothing beyond
+	// memory; see WithMock
+	mock bool
+	// readOnly rejects webhooks and leaves the ledger to the server that
+	// writes it; see WithReadOnly
+	readOnly bool
+	// closers release resources in reverse order on Shutdown
+	closers []func()
+}
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithRepository sets the ledger repository instead of the one selected by
+// storage.backend
+func WithRepository(repo LedgerRepository) Option {
+	return func(s *Server) {
+		s.repo = repo
+	}
+}
+
+// WithShadowRepository mirrors ledger writes to repo, instead of the
+// repository selected by storage.shadow.backend, and compares its balances
+// with the ledger's every storage.shadow.compareInterval. repo must start with
+// the same balances as the ledger; its write errors are only logged.
+func WithShadowRepository(repo LedgerRepository) Option {
+	return func(s *Server) {
+		s.shadow = repo
+	}
+}
+
+// WithUnitOfWork applies batches and trades in transactions of unitOfWork
+// instead of with AddEntries, for repositories that have transactions but
+// cannot apply a batch in one call. Its writes bypass the shadow repository,
+// storage.retry and the storage timeouts.
+func WithUnitOfWork(unitOfWork UnitOfWork) Option {
+	return func(s *Server) {
+		s.unitOfWork = unitOfWork
+	}
+}
+
+// WithValidator sets the validator of POST /webhook instead of the HMAC
+// validator built from the webhook config
+func WithValidator(v WebhookValidator) Option {
+	return func(s *Server) {
+		s.validator = v
+	}
+}
+
+// WithCanaryValidator checks every webhook to POST /webhook with v too,
+// instead of the candidate built from webhook.canary, to try a new signature
+// scheme before switching to it. Only the endpoint's own validator decides;
+// v's verdicts are counted as webhook.canary and logged where they differ. v
+// needs a nonce store of its own.
+func WithCanaryValidator(v WebhookValidator) Option {
+	return func(s *Server) {
+		s.canary = v
+	}
+}
+
+// WithAnomalyDetector holds the entries detector finds suspicious for
+// review, instead of the detector built from the anomaly config
+func WithAnomalyDetector(detector AnomalyDetector) Option {
+	return func(s *Server) {
+		s.detector = detector
+	}
+}
+
+// WithEventPublisher hands the event of every entry applied to publisher, in
+// addition to the broker selected by events.publisher. It is called on the
+// webhook's goroutine and must not block.
+func WithEventPublisher(publisher EventPublisher) Option {
+	return func(s *Server) {
+		s.publishers = append(s.publishers, publisher)
+	}
+}
+
+// WithLogger sets the logger instead of the one built from the log config
+func WithLogger(l Logger) Option {
+	return func(s *Server) {
+		s.logger = l
+	}
+}
+
+// WithLogLevel sets the level variable the logger was built with, so the
+// admin API can change it at runtime. Without a logger of its own the server
+// builds one from the log config at this level.
+func WithLogLevel(level *slog.LevelVar) Option {
+	return func(s *Server) {
+		s.logLevel = level
+	}
+}
+
+// ValidationReportHeader tells, under WithMock, whether a webhook would
+// have been accepted: "valid", or "invalid" with the code and message it
+// would have been rejected with
+const ValidationReportHeader = httphandler.ValidationReportHeader
+
+// WithMock runs the server as a sandbox for partners integrating with it.
+// Webhooks are applied whether or not they validate, each answered with a
+// ValidationReportHeader telling whether it would have been, and
+// nothing is kept beyond memory: the settings that persist state or send it
+// elsewhere are ignored, see mockConfig.
+func WithMock() Option {
+	return func(s *Server) {
+		s.mock = true
+	}
+}
+
+// WithReadOnly runs the server as a read-only replica, serving balances,
+// history and statements from a ledger repository another server writes,
+// such as a replica of its database, to scale reads or stand by for
+// failover. Webhooks, and admin requests changing pending entries, nonces,
+// duplicates or freezes, are rejected with 405 and code read_only, and the
+// retention runs, which would remove entries, are not started; see
+// readOnlyConfig. It cannot be combined with WithMock.
+func WithReadOnly() Option {
+	return func(s *Server) {
+		s.readOnly = true
+	}
+}
+
+// LoadConfig loads the configuration for the current CONFIG_ENV from dir, on
+// top of the built-in defaults and with opts. dir need not exist; the
+// defaults and KII_ environment variables are used then.
+func LoadConfig(dir string, opts ...config.LoadOption) (*Config, error) {
+	return config.LoadConfig(dir, append([]config.LoadOption{config.WithDefaults(defaultconfig.ServerDefaults, "yaml")}, opts...)...)
+}
+
+// New assembles a server from cfg. Background work such as usage persistence
+// and secret file watching starts immediately, so every Server must be
+// stopped with Shutdown.
+func New(cfg *Config, opts ...Option) (_ *Server, err error) {
+	s := &Server{cfg: cfg}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.mock && s.readOnly {
+		return nil, fmt.Errorf("mock and read-only modes cannot be combined")
+	}
+	if s.mock {
+		cfg = mockConfig(cfg)
+		s.cfg = cfg
+	}
+	if s.readOnly {
+		cfg = readOnlyConfig(cfg)
+		s.cfg = cfg
+	}
+	defer func() {
+		if err != nil {
+			s.close()
+		}
+	}()
+
+	if err := s.buildLogger(); err != nil {
+		return nil, err
+	}
+	if s.mock {
+		s.logger.LogWarning(context.TODO(), "Running in mock mode: webhooks are applied whether or not they validate, and nothing is persisted")
+	}
+	if s.readOnly {
+		s.logger.LogInfo(context.TODO(), "Running as a read-only replica: webhooks are rejected and retention is off")
+	}
+
+	// Listener settings are checked up front, since ListenAndServe only
+	// reports errors once the server is running
+	if err := checkListeners(cfg.Server); err != nil {
+		return nil, err
+	}
+
+	b := &builder{Server: s}
+	for _, build := range []func() error{
+		b.buildSinks,
+		b.buildLedger,
+		b.buildStores,
+		b.buildValidators,
+		b.buildUseCases,
+		b.buildBackgroundWork,
+		b.buildHandlers,
+		b.buildListeners,
+	} {
+		if err := build(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Handler returns the server's routes, for mounting in the embedding
+// program's own HTTP server instead of calling Serve
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// ListenAndServe listens on server.port unless server.disableTcp is set,
+// and on server.unixSocket when set, each capped at server.maxConnections
+// concurrent connections when set and reading PROXY protocol headers with
+// server.proxyProtocol, and serves until Shutdown, with TLS on TCP when
+// server.tlsCertFile is set
+func (s *Server) ListenAndServe() error {
+	listeners, err := listen(s.cfg.Server)
+	if err != nil {
+		return err
+	}
+	s.setListeners(listeners)
+
+	served := make([]net.Listener, len(listeners))
+	for i, listener := range listeners {
+		if s.cfg.Server.ProxyProtocol {
+			// Validated by New; the header read is bounded like the request's
+			listener, _ = proxyproto.NewListener(listener, s.cfg.Server.ProxyProtocolSources, s.cfg.Server.ReadHeaderTimeout)
+		}
+		if limit := s.cfg.Server.MaxConnections; limit > 0 {
+			listener = netutil.LimitListener(listener, limit)
+		}
+		served[i] = listener
+	}
+	return s.serve(served...)
+}
+
+// Serve serves on listener until Shutdown. Like http.Server, it returns
+// http.ErrServerClosed after Shutdown.
+func (s *Server) Serve(listener net.Listener) error {
+	s.setListeners([]net.Listener{listener})
+	return s.serve(listener)
+}
+
+// setListeners records the listeners being served, for Handover
+func (s *Server) setListeners(listeners []net.Listener) {
+	s.listenersMu.Lock()
+	defer s.listenersMu.Unlock()
+	s.listeners = append(s.listeners, listeners...)
+}
+
+// serve serves on every listener until Shutdown, or until one of them
+// fails, which closes the others. TCP listeners serve TLS when configured;
+// the Unix socket, reachable only on the host, never does.
+func (s *Server) serve(listeners ...net.Listener) error {
+	errs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		useTLS := s.httpServer.TLSConfig != nil && listener.Addr().Network() != "unix"
+		s.logger.LogInfo(context.TODO(), "Starting server",
+			"address", listener.Addr().String(),
+			"network", listener.Addr().Network(),
+			"tls", useTLS,
+			"http2", !s.cfg.Server.DisableHTTP2 && (useTLS || s.cfg.Server.H2C),
+			"timestamp_tolerance", s.cfg.Webhook.TimestampTolerance.String(),
+			"max_connections", s.cfg.Server.MaxConnections)
+		if useTLS {
+			go func() { errs <- s.httpServer.ServeTLS(listener, "", "") }()
+		} else {
+			go func() { errs <- s.httpServer.Serve(listener) }()
+		}
+	}
+	s.notifySystemd(systemd.Ready)
+	if err := handover.Ready(); err != nil {
+		s.logger.LogError(context.TODO(), "Failed to complete handover", err)
+	}
+
+	err := <-errs
+	if s.handedOver.Load() && errors.Is(err, net.ErrClosed) {
+		// The listeners were closed to drain after Handover
+		return http.ErrServerClosed
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		_ = s.httpServer.Close()
+	}
+	return err
+}
+
+// Shutdown drains the server until ctx is done. It stops accepting webhooks,
+// which get 503 with Retry-After so senders retry them elsewhere, and fails
+// the shutdown health check. Queued webhooks are then applied and in-flight
+// requests finished before the listener closes. Finally batched ledger
+// writes are flushed and the nonce store and usage are saved, even when ctx
+// expires first. After Handover it drains without turning webhooks away.
+// A Server cannot be reused after Shutdown.
+func (s *Server) Shutdown(ctx context.Context) error {
+	defer s.close()
+	if s.handedOver.Load() {
+		return s.shutdownHandedOver(ctx)
+	}
+	s.draining.Store(true)
+	s.notifySystemd(systemd.Stopping)
+
+	s.logger.LogInfo(context.TODO(), "Draining webhook queue", "queue_length", s.pool.QueueLength())
+	if err := s.pool.Shutdown(ctx); err != nil {
+		_ = s.httpServer.Close()
+		return fmt.Errorf("failed to drain worker pool: %w", err)
+	}
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		_ = s.httpServer.Close()
+		return fmt.Errorf("failed to stop HTTP server: %w", err)
+	}
+	return nil
+}
+
+// shutdownHandedOver drains after Handover. The new process already serves
+// on the listeners, so they close first and no webhook is turned away: each
+// connection already accepted closes after answering its next request, and
+// idle ones left when ctx is done are closed. Queued webhooks are then
+// applied. http.Server.Shutdown is left for last, as it drops requests read
+// after it starts, and closes idle connections a sender may be reusing.
+func (s *Server) shutdownHandedOver(ctx context.Context) error {
+	s.logger.LogInfo(context.TODO(), "Finishing in-flight requests after handover", "connections", s.openConns.Load())
+	s.listenersMu.Lock()
+	for _, listener := range s.listeners {
+		_ = listener.Close()
+	}
+	s.listenersMu.Unlock()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for s.openConns.Load() > 0 && ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+
+	if err := s.httpServer.Shutdown(ctx); err != nil && !errors.Is(err, net.ErrClosed) {
+		_ = s.httpServer.Close()
+		return fmt.Errorf("failed to stop HTTP server: %w", err)
+	}
+	if err := s.pool.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to drain worker pool: %w", err)
+	}
+	return nil
+}
+
+// Handover starts a new copy of the running executable, with the same
+// arguments and environment, and hands it the listeners. It returns once the
+// new process serves on them, or fails and leaves this process serving when
+// the new one exits first or ctx is done. Shutdown then drains without
+// closing the sockets or turning webhooks away. Under systemd the new
+// process becomes the service's main process. It is refused unless every
+// store keeps its state outside the process, as in cluster mode, since the
+// two processes serve side by side for a moment.
+func (s *Server) Handover(ctx context.Context) error {
+	if err := requireSharedState("handover", s.stateStores); err != nil {
+		return err
+	}
+	s.listenersMu.Lock()
+	listeners := slices.Clone(s.listeners)
+	s.listenersMu.Unlock()
+
+	pid, err := handover.Start(ctx, listeners)
+	if err != nil {
+		return err
+	}
+	s.handedOver.Store(true)
+	// The socket files now belong to the new process
+	for _, listener := range listeners {
+		if unix, ok := listener.(*net.UnixListener); ok {
+			unix.SetUnlinkOnClose(false)
+		}
+	}
+	s.notifySystemd("MAINPID=" + strconv.Itoa(pid))
+	s.logger.LogInfo(context.TODO(), "Listeners handed over", "pid", pid)
+	return nil
+}
+
+// Reload applies the settings of cfg that can change without a restart: the
+// timestamp tolerances of POST /webhook and of the configured sources, the
+// nonce retention margin, debug capture sources, and the TLS certificate, reread from server.tlsCertFile
+// and server.tlsKeyFile when serving TLS. cfg is validated first, so an
+// invalid config is rejected and the running one kept. Sources added or
+// removed, and turning TLS on or off, need a restart.
+func (s *Server) Reload(cfg *Config) error {
+	if cfg.Webhook.TimestampTolerance <= 0 {
+		return fmt.Errorf("webhook.timestampTolerance must be positive, got %s", cfg.Webhook.TimestampTolerance)
+	}
+	for name, source := range cfg.Sources {
+		if source.TimestampTolerance <= 0 {
+			return fmt.Errorf("sources.%s.timestampTolerance must be positive, got %s", name, source.TimestampTolerance)
+		}
+	}
+	if cfg.Webhook.NonceRetentionMargin < 0 {
+		return fmt.Errorf("webhook.nonceRetentionMargin must not be negative")
+	}
+	if _, err := httphandler.NewDebugCapture(cfg.Debug.CaptureSources); err != nil {
+		return err
+	}
+	if s.httpServer.TLSConfig != nil {
+		if err := s.loadCertificate(cfg.Server); err != nil {
+			return err
+		}
+	}
+
+	// The margin is applied first, so that a raised margin is in effect
+	// before any raised tolerance
+	s.retentionMu.Lock()
+	s.nonceRetentionMargin = cfg.Webhook.NonceRetentionMargin
+	s.retentionMu.Unlock()
+	s.retainNonces()
+	if setter, ok := s.validator.(toleranceSetter); ok {
+		setter.SetTimestampTolerance(cfg.Webhook.TimestampTolerance)
+	}
+	for name, source := range cfg.Sources {
+		if v, ok := s.tolerances[name]; ok {
+			v.SetTimestampTolerance(source.TimestampTolerance)
+		}
+	}
+	s.retainNonces()
+	_ = s.capture.SetSources(cfg.Debug.CaptureSources)
+	return nil
+}
+
+// updateNonceRetention remembers used nonces for the longest timestamp
+// tolerance of the webhook endpoints plus webhook.nonceRetentionMargin, past
+// which a replay is rejected for its timestamp anyway. The retention is kept
+// when no endpoint's tolerance is known. A shorter retention only takes
+// effect once the previous one has passed, as the nonce store keeps the
+// longest one set within it. It returns the previous retention in effect and
+// the new one.
+func (s *Server) updateNonceRetention() (previous, retention time.Duration) {
+	s.retentionMu.Lock()
+	defer s.retentionMu.Unlock()
+
+	previous = s.nonceStore.Retention()
+	var longest time.Duration
+	for _, v := range s.tolerances {
+		longest = max(longest, v.TimestampTolerance())
+	}
+	if longest == 0 {
+		return previous, previous
+	}
+	s.nonceStore.SetRetention(longest + s.nonceRetentionMargin)
+	return previous, s.nonceStore.Retention()
+}
+
+// retainNonces updates the nonce retention after tolerances changed, logging
+// a change
+func (s *Server) retainNonces() {
+	if previous, retention := s.updateNonceRetention(); retention != previous {
+		s.logger.LogInfo(context.TODO(), "Nonce retention changed",
+			"from", previous.String(),
+			"to", retention.String())
+	}
+}
+
+// retainingTolerance is a validator whose tolerance changes update the nonce
+// retention
+type retainingTolerance struct {
+	httphandler.ToleranceValidator
+	server *Server
+}
+
+// SetTimestampTolerance changes the tolerance, then the nonce retention
+func (t retainingTolerance) SetTimestampTolerance(tolerance time.Duration) {
+	t.ToleranceValidator.SetTimestampTolerance(tolerance)
+	t.server.retainNonces()
+}
+
+// retainingTolerances returns the validators whose tolerance can be changed
+// at runtime, by name, updating the nonce retention as they are changed
+func (s *Server) retainingTolerances() map[string]httphandler.ToleranceValidator {
+	validators := make(map[string]httphandler.ToleranceValidator, len(s.tolerances))
+	for name, v := range s.tolerances {
+		validators[name] = retainingTolerance{ToleranceValidator: v, server: s}
+	}
+	return validators
+}
+
+// loadCertificate reads the certificate and key of cfg and serves them on new
+// TLS connections
+func (s *Server) loadCertificate(cfg config.Server) error {
+	certificate, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load server.tlsCertFile: %w", err)
+	}
+	s.certificate.Store(&certificate)
+	return nil
+}
+
+// notifySystemd reports state to systemd when it manages the process
+func (s *Server) notifySystemd(state string) {
+	sent, err := systemd.Notify(state)
+	if err != nil {
+		s.logger.LogError(context.TODO(), "Failed to notify systemd", err, "state", state)
+	} else if sent {
+		s.logger.LogDebug(context.TODO(), "Notified systemd", "state", state)
+	}
+}
+
+// close runs the closers in reverse order; each runs at most once
+func (s *Server) close() {
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		s.closers[i]()
+	}
+	s.closers = nil
+}
+
+// requireSharedState fails if any of the named stores keeps its state in
+// process, which would let replicas, or the old and new process of a
+// handover, disagree on balances and replays
+func requireSharedState(purpose string, stores map[string]any) error {
+	var local []string
+	for name, store := range stores {
+		if shared, ok := store.(port.SharedStore); !ok || !shared.Shared() {
+			local = append(local, name)
+		}
+	}
+	if len(local) == 0 {
+		return nil
+	}
+	sort.Strings(local)
+	return fmt.Errorf("%s requires external stores, but these are in-memory: %s", purpose, strings.Join(local, ", "))
+}
+
+// newHTTPServer creates the HTTP server with the configured timeouts, limits
+// and protocols
+func newHTTPServer(cfg config.Server, handler http.Handler) *http.Server {
+	server := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+	server.SetKeepAlivesEnabled(!cfg.DisableKeepAlives)
+
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(!cfg.DisableHTTP2)
+	protocols.SetUnencryptedHTTP2(cfg.H2C && !cfg.DisableHTTP2)
+	server.Protocols = &protocols
+	server.HTTP2 = &http.HTTP2Config{MaxConcurrentStreams: cfg.HTTP2MaxConcurrentStreams}
+	return server
+}
+
+// listen opens the server's listeners: those passed by systemd socket
+// activation if any, then those handed over by a previous process, otherwise
+// the configured ones
+func listen(cfg config.Server) ([]net.Listener, error) {
+	listeners, err := systemd.Listeners()
+	if err != nil || len(listeners) > 0 {
+		return listeners, err
+	}
+
+	listeners, err = handover.Listeners()
+	if err != nil || len(listeners) > 0 {
+		// The configured socket file is removed on shutdown as if this
+		// process had created it
+		for _, listener := range listeners {
+			if unix, ok := listener.(*net.UnixListener); ok && cfg.UnixSocket != "" && unix.Addr().String() == cfg.UnixSocket {
+				unix.SetUnlinkOnClose(true)
+			}
+		}
+		return listeners, err
+	}
+	return openListeners(cfg)
+}
+
+// openListeners opens TCP on cfg.Port unless DisableTCP, and the Unix socket
+// when set
+func openListeners(cfg config.Server) ([]net.Listener, error) {
+	var listeners []net.Listener
+	if !cfg.DisableTCP {
+		listener, err := net.Listen("tcp", ":"+cfg.Port)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	if cfg.UnixSocket != "" {
+		listener, err := listenUnix(cfg)
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// listenUnix listens on the Unix socket cfg.UnixSocket with the configured
+// permissions and group. A socket file left behind by a server that is no
+// longer running is replaced; the listener removes it again when closed.
+func listenUnix(cfg config.Server) (net.Listener, error) {
+	path := cfg.UnixSocket
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&fs.ModeSocket == 0 {
+			return nil, fmt.Errorf("server.unixSocket %s exists and is not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("server.unixSocket %s is in use by another process", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale unix socket: %w", err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := unixSocketMode(cfg.UnixSocketMode)
+	if err == nil {
+		err = os.Chmod(path, mode)
+	}
+	if err == nil && cfg.UnixSocketGroup != "" {
+		var gid int
+		if gid, err = lookupGroup(cfg.UnixSocketGroup); err == nil {
+			err = os.Chown(path, -1, gid)
+		}
+	}
+	if err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("failed to set unix socket permissions: %w", err)
+	}
+	return listener, nil
+}
+
+// checkListeners validates the listener settings of cfg
+func checkListeners(cfg config.Server) error {
+	if cfg.ProxyProtocol {
+		if _, err := proxyproto.NewListener(nil, cfg.ProxyProtocolSources, 0); err != nil {
+			return fmt.Errorf("server.proxyProtocolSources: %w", err)
+		}
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return fmt.Errorf("server.tlsCertFile and server.tlsKeyFile must be set together")
+	}
+	if cfg.H2C && cfg.DisableHTTP2 {
+		return fmt.Errorf("server.h2c requires HTTP/2, but server.disableHttp2 is set")
+	}
+	if cfg.HTTP2MaxConcurrentStreams < 0 {
+		return fmt.Errorf("server.http2MaxConcurrentStreams must not be negative")
+	}
+	if cfg.UnixSocket == "" {
+		if cfg.DisableTCP {
+			return fmt.Errorf("server.disableTcp requires server.unixSocket")
+		}
+		return nil
+	}
+	if _, err := unixSocketMode(cfg.UnixSocketMode); err != nil {
+		return err
+	}
+	if cfg.UnixSocketGroup != "" {
+		if _, err := lookupGroup(cfg.UnixSocketGroup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unixSocketMode parses server.unixSocketMode, octal permission bits
+func unixSocketMode(mode string) (os.FileMode, error) {
+	bits, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || bits > 0o777 {
+		return 0, fmt.Errorf("invalid server.unixSocketMode %q, want octal permissions such as 0660", mode)
+	}
+	return os.FileMode(bits), nil
+}
+
+// lookupGroup returns the ID of the group given by name or number
+func lookupGroup(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, fmt.Errorf("invalid server.unixSocketGroup: %w", err)
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// webhookSources builds the validator and payload mapper of each configured
+// webhook source. Sources share the nonce store and clock with the default
+// endpoint, each checking nonces in a namespace of its own.
+func webhookSources(cfgs map[string]config.Source, nonceStore port.NonceStore, clock port.Clock, skew validator.SkewRecorder, appLogger logger.Logger) (map[string]httphandler.WebhookSource, error) {
+	sources := make(map[string]httphandler.WebhookSource, len(cfgs))
+	paths := make(map[string]string)
+	for name, cfg := range cfgs {
+		if strings.EqualFold(name, config.DefaultSource) {
+			return nil, fmt.Errorf("sources.%s: the name %q is reserved for POST /webhook", name, config.DefaultSource)
+		}
+		scheme, err := validator.WithScheme(cfg.Scheme)
+		if err != nil {
+			return nil, fmt.Errorf("sources.%s: %w", name, err)
+		}
+		timestampFormat, err := validator.WithTimestampFormat(cfg.TimestampFormat)
+		if err != nil {
+			return nil, fmt.Errorf("sources.%s: %w", name, err)
+		}
+		payloadMapper, err := mapper.NewJSONPath(cfg.Mapping.User, cfg.Mapping.Asset, cfg.Mapping.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("sources.%s.mapping: %w", name, err)
+		}
+		if cfg.Method != http.MethodPost && cfg.Method != http.MethodPut {
+			return nil, fmt.Errorf("sources.%s.method: unsupported method %q (want POST or PUT)", name, cfg.Method)
+		}
+		if cfg.Path != "" {
+			if err := httphandler.CheckSourcePath(cfg.Path); err != nil {
+				return nil, fmt.Errorf("sources.%s: %w", name, err)
+			}
+			if other, ok := paths[cfg.Path]; ok {
+				return nil, fmt.Errorf("sources.%s: path %s is also the path of sources.%s", name, cfg.Path, other)
+			}
+			paths[cfg.Path] = name
+		}
+		var response *httphandler.SuccessResponse
+		if cfg.Response.Status != 0 || cfg.Response.Body != "" {
+			response, err = httphandler.NewSuccessResponse(cfg.Response.Status, cfg.Response.ContentType, cfg.Response.Body)
+			if err != nil {
+				return nil, fmt.Errorf("sources.%s.response: %w", name, err)
+			}
+		}
+		sources[name] = httphandler.WebhookSource{
+			Validator: validator.NewHMACValidatorWithNonceStore(
+				cfg.Secret,
+				cfg.TimestampTolerance,
+				nonceStore,
+				appLogger,
+				validator.WithHeaders(cfg.Headers.Timestamp, cfg.Headers.Nonce, cfg.Headers.Signature),
+				validator.WithClock(clock),
+				validator.WithTenant(name),
+				validator.WithSkewRecorder(skew),
+				scheme,
+				timestampFormat,
+			),
+			Mapper:          payloadMapper,
+			Response:        response,
+			Method:          cfg.Method,
+			Path:            cfg.Path,
+			TimestampHeader: cfg.Headers.Timestamp,
+			NonceHeader:     cfg.Headers.Nonce,
+		}
+		appLogger.LogInfo(context.TODO(), "Webhook source configured",
+			"source", name,
+			"path", "/webhook/"+name,
+			"own_path", cfg.Path,
+			"method", cfg.Method,
+			"scheme", cfg.Scheme,
+			"timestamp_format", cfg.TimestampFormat,
+			"timestamp_tolerance", cfg.TimestampTolerance.String())
+	}
+	return sources, nil
+}
+
+// eventPublisher builds the broker publisher selected by cfg.Publisher, nil
+// when none is
+func eventPublisher(cfg config.Events, emitter metrics.Emitter, appLogger logger.Logger) (*events.Publisher, error) {
+	var publisher *events.Publisher
+	var destination []any
+	var err error
+	switch cfg.Publisher {
+	case "":
+		return nil, nil
+	case "kafka":
+		publisher, err = events.NewKafka(cfg, emitter, appLogger)
+		destination = []any{"topic", cfg.Kafka.Topic}
+	case "nats":
+		publisher, err = events.NewNATS(cfg, emitter, appLogger)
+		destination = []any{"subject", cfg.NATS.Subject}
+	default:
+		return nil, fmt.Errorf("events.publisher: unknown publisher %q: want kafka or nats", cfg.Publisher)
+	}
+	if err != nil {
+		return nil, err
+	}
+	appLogger.LogInfo(context.TODO(), "Publishing balance events", append([]any{"publisher", cfg.Publisher}, destination...)...)
+	return publisher, nil
+}
+
+// canaryValidator builds the candidate validator configured by cfg. It has a
+// nonce store of its own, as the endpoint's validator records every nonce
+// first.
+func canaryValidator(cfg config.Canary, tolerance time.Duration, clock port.Clock, appLogger logger.Logger) (port.WebhookValidator, error) {
+	scheme, err := validator.WithScheme(cfg.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	timestampFormat, err := validator.WithTimestampFormat(cfg.TimestampFormat)
+	if err != nil {
+		return nil, err
+	}
+	return validator.NewHMACValidatorWithNonceStore(
+		cfg.Secret,
+		tolerance,
+		validator.NewNonceStoreWithClock(clock),
+		appLogger,
+		validator.WithHeaders(cfg.Headers.Timestamp, cfg.Headers.Nonce, cfg.Headers.Signature),
+		validator.WithClock(clock),
+		scheme,
+		timestampFormat,
+	), nil
+}
+
+// openAccessLog opens the configured access log file. It returns a nil
+// access log, which disables access logging, when no path is configured.
+func openAccessLog(cfg config.AccessLog) (*httphandler.AccessLog, func(), error) {
+	if cfg.Path == "" {
+		return nil, func() {}, nil
+	}
+
+	f, err := os.OpenFile(cfg.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, nil, err
+	}
+	accessLog, err := httphandler.NewAccessLog(f, cfg.Format)
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	return accessLog, func() { _ = f.Close() }, nil
+}
+
+// emitGauges periodically reports gauges that are not tied to a request,
+// along with the nonces expired since the last report. The returned function
+// stops reporting.
+func emitGauges(emitter metrics.Emitter, nonceStore port.NonceStore, duplicateStore port.DuplicateStore, pool *workerpool.Pool) func() {
+	if _, ok := emitter.(metrics.NopEmitter); ok {
+		return func() {}
+	}
+
+	ticker := time.NewTicker(10 * time.Second)
+	done := make(chan struct{})
+	go func() {
+		var evicted int64
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				emitter.Gauge("nonce_store.size", float64(nonceStore.Len()))
+				if store, ok := nonceStore.(interface{ Retention() time.Duration }); ok {
+					emitter.Gauge("nonce_store.retention", store.Retention().Seconds())
+				}
+				if counter, ok := nonceStore.(interface{ Evicted() int64 }); ok {
+					total := counter.Evicted()
+					emitter.Count("nonce_store.evictions", total-evicted)
+					evicted = total
+				}
+				if counter, ok := duplicateStore.(interface{ Len() int }); ok {
+					emitter.Gauge("duplicate_store.size", float64(counter.Len()))
+				}
+				emitter.Gauge("worker_pool.queue_length", float64(pool.QueueLength()))
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// persistUsage saves usage to path every usageSaveInterval and once more when
+// the returned function is called. Without a path usage is only kept in memory.
+func persistUsage(usage *metrics.UsageMeter, path string, appLogger logger.Logger) func() {
+	if path == "" {
+		return func() {}
+	}
+
+	save := func() {
+		if err := usage.Save(path); err != nil {
+			appLogger.LogError(context.TODO(), "Failed to save usage", err, "path", path)
+		}
+	}
+	ticker := time.NewTicker(usageSaveInterval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				save()
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+		save()
+	}
+}
+
+// retainPeriodically compacts the ledger every interval, then prunes it
+// unless prune is nil. The returned function stops it, waiting for a run in
+// progress to be cancelled.
+func retainPeriodically(compact *usecase.CompactLedgerUseCase, prune *usecase.PruneLedgerUseCase, interval time.Duration, appLogger logger.Logger) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	ticker := time.NewTicker(interval)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				result, err := compact.Execute(ctx)
+				if err != nil {
+					appLogger.LogError(ctx, "Ledger compaction failed", err,
+						"archived_users", result.ArchivedUsers)
+				} else {
+					log := appLogger.LogInfo
+					if result == (entity.CompactionResult{}) {
+						log = appLogger.LogDebug
+					}
+					log(ctx, "Ledger compacted",
+						"zero_balances", result.ZeroBalances,
+						"archived_users", result.ArchivedUsers,
+						"archived_entries", result.ArchivedEntries,
+						"removed_users", result.RemovedUsers)
+				}
+				if prune == nil {
+					continue
+				}
+				pruned, err := prune.Execute(ctx)
+				switch {
+				case err != nil:
+					appLogger.LogError(ctx, "Ledger pruning failed", err)
+				case pruned.Entries > 0:
+					appLogger.LogInfo(ctx, "Ledger pruned",
+						"entries", pruned.Entries,
+						"segment", pruned.Segment)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		cancel()
+		<-stopped
+	}
+}
+
+// shadowMismatchLogLimit is the most mismatches logged per comparison
+const shadowMismatchLogLimit = 10
+
+// compareShadowPeriodically compares the shadow repository with the ledger
+// every interval, logging and counting the users whose balances differ. The
+// returned function stops it, waiting for a comparison in progress to be
+// cancelled.
+func compareShadowPeriodically(shadow *repository.ShadowLedger, interval time.Duration, emitter metrics.Emitter, appLogger logger.Logger) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	ticker := time.NewTicker(interval)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				result, err := shadow.Compare(ctx)
+				if err != nil && ctx.Err() == nil {
+					appLogger.LogError(ctx, "Shadow repository comparison failed", err,
+						"users", result.Users)
+				}
+				for i, mismatch := range result.Mismatches {
+					if i == shadowMismatchLogLimit {
+						break
+					}
+					appLogger.LogWarning(ctx, "Shadow repository balance mismatch",
+						"user", mismatch.User,
+						"primary", mismatch.Primary,
+						"shadow", mismatch.Shadow)
+				}
+				emitter.Count("shadow.compared", int64(result.Users))
+				emitter.Count("shadow.mismatches", int64(len(result.Mismatches)))
+				emitter.Count("shadow.dropped", int64(result.Dropped))
+				log := appLogger.LogInfo
+				if len(result.Mismatches) == 0 && result.Dropped == 0 {
+					log = appLogger.LogDebug
+				}
+				log(ctx, "Shadow repository compared",
+					"users", result.Users,
+					"mismatches", len(result.Mismatches),
+					"dropped", result.Dropped)
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		cancel()
+		<-stopped
+	}
+}
+
+// watchdogPeriodically sends systemd a watchdog notification every interval
+// while check passes, within the interval. The returned function stops it.
+func watchdogPeriodically(check func(context.Context) error, interval time.Duration, appLogger logger.Logger) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				err := check(ctx)
+				cancel()
+				if err != nil {
+					appLogger.LogWarning(context.TODO(), "Withholding systemd watchdog notification", "error", err.Error())
+					continue
+				}
+				if _, err := systemd.Notify(systemd.Watchdog); err != nil {
+					appLogger.LogError(context.TODO(), "Failed to notify systemd watchdog", err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// newLedgerRepository creates a ledger repository of the given backend
+func newLedgerRepository(backend string, appLogger logger.Logger) (port.LedgerRepository, error) {
+	switch backend {
+	case "memory":
+		return repository.NewInMemoryLedger(appLogger), nil
+	default:
+		return nil, fmt.Errorf("unsupported storage backend %q", backend)
+	}
+}
+
+// mockConfig returns a copy of cfg for WithMock, with the in-memory ledger
+// and without the settings that persist state or send it elsewhere: the
+// shadow repository, nonce, usage and freeze files, archiving and pruning,
+// the analytics export, the mirror, the event broker and cluster mode. Logs,
+// including the audit log, are kept.
+func mockConfig(cfg *Config) *Config {
+	mock := *cfg
+	mock.Storage.Backend = "memory"
+	mock.Storage.Shadow = config.Shadow{}
+	mock.Webhook.NonceStorePath = ""
+	mock.Usage.Path = ""
+	mock.Freezes.Path = ""
+	mock.Retention.IdleAfter = 0
+	mock.Retention.ArchivePath = ""
+	mock.Retention.MaxAge = 0
+	mock.Retention.ObjectStore = config.ObjectStore{}
+	mock.Analytics.ObjectStore = config.ObjectStore{}
+	mock.Mirror.URL = ""
+	mock.Events.Publisher = ""
+	mock.Cluster.Enabled = false
+	return &mock
+}
+
+// readOnlyConfig returns a copy of cfg for WithReadOnly, without the
+// retention runs, which compact, archive and prune the ledger its writer
+// owns. The archive object store is kept, so that pruned segments can still
+// be listed.
+func readOnlyConfig(cfg *Config) *Config {
+	replica := *cfg
+	replica.Retention.Interval = 0
+	replica.Retention.IdleAfter = 0
+	replica.Retention.MaxAge = 0
+	return &replica
+}
+
+// newUserPolicy builds the user policy from the users config
+func newUserPolicy(cfg config.Users) (entity.UserPolicy, error) {
+	userCase, err := entity.ParseUserCase(cfg.Case)
+	if err != nil {
+		return entity.UserPolicy{}, fmt.Errorf("users.case: %w", err)
+	}
+	if cfg.MaxLength < 0 {
+		return entity.UserPolicy{}, fmt.Errorf("users.maxLength must not be negative")
+	}
+	policy := entity.UserPolicy{MaxLength: cfg.MaxLength, Case: userCase}
+	if cfg.Pattern != "" {
+		if policy.Pattern, err = entity.CompileUserPattern(cfg.Pattern); err != nil {
+			return entity.UserPolicy{}, fmt.Errorf("users.pattern: %w", err)
+		}
+	}
+	return policy, nil
+}
+
+// newAmountPolicy builds the amount policy from the assets config. Other
+// assets keep entity.DefaultScale decimal places, rounded half-up.
+func newAmountPolicy(cfgs map[string]config.Asset) (entity.AmountPolicy, error) {
+	policy := entity.AmountPolicy{
+		Assets:  make(map[string]entity.AssetPrecision, len(cfgs)),
+		Default: entity.AssetPrecision{Scale: entity.DefaultScale, Rounding: entity.RoundHalfUp},
+	}
+	for name, cfg := range cfgs {
+		if cfg.Scale < 0 || cfg.Scale > entity.DefaultScale {
+			return entity.AmountPolicy{}, fmt.Errorf("assets.%s.scale must be between 0 and %d", name, entity.DefaultScale)
+		}
+		rounding, err := entity.ParseRoundingMode(cfg.Rounding)
+		if err != nil {
+			return entity.AmountPolicy{}, fmt.Errorf("assets.%s.rounding: %w", name, err)
+		}
+		policy.Assets[strings.ToLower(name)] = entity.AssetPrecision{Scale: int32(cfg.Scale), Rounding: rounding}
+	}
+	return policy, nil
+}
+
+// velocityRules parses the velocity rules from the config, returning them
+// with the longest window, for which credits must be kept
+func velocityRules(cfgs []config.VelocityRule) ([]usecase.VelocityRule, time.Duration, error) {
+	rules := make([]usecase.VelocityRule, len(cfgs))
+	var longest time.Duration
+	for i, cfg := range cfgs {
+		if cfg.Window <= 0 {
+			return nil, 0, fmt.Errorf("velocity.rules[%d].window must be positive", i)
+		}
+		maxCredit, err := decimal.NewFromString(cfg.MaxCredit)
+		if err != nil {
+			return nil, 0, fmt.Errorf("velocity.rules[%d].maxCredit: %w", i, err)
+		}
+		rules[i] = usecase.VelocityRule{Asset: cfg.Asset, Window: cfg.Window, MaxCredit: maxCredit}
+		longest = max(longest, cfg.Window)
+	}
+	return rules, longest, nil
+}
@@ -0,0 +1,1194 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"kii.com/internal/infrastructure/config"
+	httphandler "kii.com/internal/infrastructure/http"
+	"kii.com/webhooktest"
+)
+
+// recordingLedger is a LedgerRepository supplied by the embedding program
+type recordingLedger struct {
+	mu      sync.Mutex
+	entries []LedgerEntry
+}
+
+func (l *recordingLedger) AddEntry(_ context.Context, entry LedgerEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, entry)
+	return nil
+}
+
+func (l *recordingLedger) GetBalance(_ context.Context, user string) (*BalanceResponse, error) {
+	return &BalanceResponse{User: user, Balances: map[string]string{"BTC": "42"}}, nil
+}
+
+// headerValidator accepts webhooks carrying the expected X-Api-Key
+type headerValidator struct {
+	key string
+}
+
+func (v headerValidator) ValidateRequest(_ context.Context, r *http.Request, _ []byte) error {
+	if r.Header.Get("X-Api-Key") != v.key {
+		return errors.New("invalid API key")
+	}
+	return nil
+}
+
+func testConfig(t *testing.T) *Config {
+	t.Helper()
+	cfg, err := LoadConfig(t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	cfg.Log.Level = "error"
+	return cfg
+}
+
+func TestServer_Handler(t *testing.T) {
+	ledger := &recordingLedger{}
+	srv, err := New(testConfig(t), WithRepository(ledger), WithValidator(headerValidator{key: "secret"}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Shutdown(context.Background()) })
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		apiKey     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "webhook accepted by custom validator",
+			method:     http.MethodPost,
+			path:       "/webhook",
+			apiKey:     "secret",
+			body:       `{"user":"user1","asset":"BTC","amount":"1.5"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "webhook rejected by custom validator",
+			method:     http.MethodPost,
+			path:       "/webhook",
+			apiKey:     "wrong",
+			body:       `{"user":"user1","asset":"BTC","amount":"2"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "balance from custom repository",
+			method:     http.MethodGet,
+			path:       "/balance/user1",
+			wantStatus: http.StatusOK,
+			wantBody:   `"BTC":"42"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("X-Api-Key", tt.apiKey)
+			w := httptest.NewRecorder()
+
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	ledger.mu.Lock()
+	defer ledger.mu.Unlock()
+	want := LedgerEntry{User: "user1", Asset: "BTC", Amount: "1.5"}
+	if len(ledger.entries) != 1 || ledger.entries[0] != want {
+		t.Errorf("entries = %+v, want [%+v]", ledger.entries, want)
+	}
+}
+
+// holdAllDetector finds every entry suspicious
+type holdAllDetector struct{}
+
+func (holdAllDetector) Inspect(context.Context, LedgerEntry) (string, error) {
+	return "held for review", nil
+}
+
+func (holdAllDetector) Record(context.Context, LedgerEntry) {}
+
+func TestServer_AnomalyDetector(t *testing.T) {
+	ledger := &recordingLedger{}
+	srv, err := New(testConfig(t), WithRepository(ledger), WithValidator(headerValidator{key: "secret"}),
+		WithAnomalyDetector(holdAllDetector{}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Shutdown(context.Background()) })
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"user":"user1","asset":"BTC","amount":"1"}`))
+	req.Header.Set("X-Api-Key", "secret")
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body.String())
+	}
+	ledger.mu.Lock()
+	defer ledger.mu.Unlock()
+	if len(ledger.entries) != 0 {
+		t.Errorf("entries = %+v, want the entry held", ledger.entries)
+	}
+}
+
+// ledgerUnitOfWork applies the entries of a transaction to ledger at once
+type ledgerUnitOfWork struct {
+	ledger *recordingLedger
+}
+
+func (u ledgerUnitOfWork) Do(ctx context.Context, fn func(tx LedgerRepository) error) error {
+	tx := &recordingLedger{}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	u.ledger.mu.Lock()
+	defer u.ledger.mu.Unlock()
+	u.ledger.entries = append(u.ledger.entries, tx.entries...)
+	return nil
+}
+
+func TestServer_UnitOfWork(t *testing.T) {
+	body := `{"entries":[{"user":"user1","asset":"BTC","amount":"1"},{"user":"user2","asset":"BTC","amount":"-1"}]}`
+
+	tests := []struct {
+		name        string
+		unitOfWork  bool
+		wantStatus  int
+		wantEntries int
+	}{
+		{name: "repository without batches", wantStatus: http.StatusNotImplemented},
+		{name: "unit of work", unitOfWork: true, wantStatus: http.StatusOK, wantEntries: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := &recordingLedger{}
+			opts := []Option{WithRepository(ledger), WithValidator(headerValidator{key: "secret"})}
+			if tt.unitOfWork {
+				opts = append(opts, WithUnitOfWork(ledgerUnitOfWork{ledger: ledger}))
+			}
+			srv, err := New(testConfig(t), opts...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			t.Cleanup(func() { _ = srv.Shutdown(context.Background()) })
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+			req.Header.Set("X-Api-Key", "secret")
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			ledger.mu.Lock()
+			defer ledger.mu.Unlock()
+			if len(ledger.entries) != tt.wantEntries {
+				t.Errorf("entries = %+v, want %d", ledger.entries, tt.wantEntries)
+			}
+		})
+	}
+}
+
+func TestServer_ServeAndShutdown(t *testing.T) {
+	srv, err := New(testConfig(t))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(listener) }()
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/healthz")
+	if err != nil {
+		t.Fatalf("GET /healthz error = %v", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /healthz status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("Serve() error = %v, want %v", err, http.ErrServerClosed)
+	}
+}
+
+// writeCertificate writes a self-signed certificate for 127.0.0.1 and its key
+// to dir, returning their paths and the certificate
+func writeCertificate(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("rand.Int() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "kii"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() error = %v", err)
+	}
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	cert, _ = x509.ParseCertificate(der)
+	return certFile, keyFile, cert
+}
+
+// serveTCP serves srv on a local TCP listener until the test ends, returning
+// its address
+func serveTCP(t *testing.T, srv *Server) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go func() { _ = srv.Serve(listener) }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	})
+	return listener.Addr().String()
+}
+
+func TestServer_TLS(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(t)
+	var cert *x509.Certificate
+	cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile, cert = writeCertificate(t, dir)
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	addr := serveTCP(t, srv)
+
+	get := func(cert *x509.Certificate, protocols func(*http.Protocols)) *http.Response {
+		t.Helper()
+		roots := x509.NewCertPool()
+		roots.AddCert(cert)
+		transport := &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots},
+			ForceAttemptHTTP2: true,
+		}
+		if protocols != nil {
+			transport.Protocols = new(http.Protocols)
+			protocols(transport.Protocols)
+		}
+		defer transport.CloseIdleConnections()
+		resp, err := (&http.Client{Transport: transport}).Get("https://" + addr + "/healthz")
+		if err != nil {
+			t.Fatalf("GET /healthz error = %v", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	if resp := get(cert, nil); resp.StatusCode != http.StatusOK || resp.ProtoMajor != 2 {
+		t.Errorf("GET /healthz = %d over %s, want 200 over HTTP/2", resp.StatusCode, resp.Proto)
+	}
+	// Clients without HTTP/2 are still served
+	if resp := get(cert, func(p *http.Protocols) { p.SetHTTP1(true) }); resp.StatusCode != http.StatusOK || resp.ProtoMajor != 1 {
+		t.Errorf("GET /healthz = %d over %s, want 200 over HTTP/1.1", resp.StatusCode, resp.Proto)
+	}
+
+	// Reload serves a rotated certificate on new connections
+	rotated := testConfig(t)
+	rotated.Server.TLSCertFile, rotated.Server.TLSKeyFile, cert = writeCertificate(t, dir)
+	if err := srv.Reload(rotated); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if resp := get(cert, nil); resp.TLS.PeerCertificates[0].SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		t.Error("GET /healthz after Reload() served the old certificate")
+	}
+
+	// A certificate that fails to load keeps the running one
+	if err := os.WriteFile(rotated.Server.TLSKeyFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := srv.Reload(rotated); err == nil {
+		t.Error("Reload() with an invalid key error = nil, want an error")
+	}
+	if resp := get(cert, nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /healthz after a failed Reload() status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestServer_HTTP2Cleartext(t *testing.T) {
+	tests := []struct {
+		name      string
+		modify    func(*config.Server)
+		wantHTTP2 bool
+	}{
+		{
+			name:      "h2c",
+			modify:    func(cfg *config.Server) { cfg.H2C = true },
+			wantHTTP2: true,
+		},
+		{
+			name:   "without h2c",
+			modify: func(*config.Server) {},
+		},
+		{
+			name:   "http2 disabled",
+			modify: func(cfg *config.Server) { cfg.DisableHTTP2 = true },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			tt.modify(&cfg.Server)
+			srv, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			addr := serveTCP(t, srv)
+
+			// The client speaks HTTP/2 with prior knowledge and nothing else
+			transport := &http.Transport{Protocols: new(http.Protocols)}
+			transport.Protocols.SetUnencryptedHTTP2(true)
+			defer transport.CloseIdleConnections()
+			resp, err := (&http.Client{Transport: transport}).Get("http://" + addr + "/healthz")
+			if !tt.wantHTTP2 {
+				if err == nil {
+					_ = resp.Body.Close()
+					t.Errorf("GET /healthz over h2c = %d, want it refused", resp.StatusCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GET /healthz over h2c error = %v", err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 2 {
+				t.Errorf("GET /healthz = %d over %s, want 200 over HTTP/2", resp.StatusCode, resp.Proto)
+			}
+		})
+	}
+}
+
+func TestServer_ListenAndServeUnixSocket(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Server.UnixSocket = filepath.Join(t.TempDir(), "kii.sock")
+	cfg.Server.UnixSocketMode = "0600"
+	cfg.Server.DisableTCP = true
+
+	// A socket left behind by a crashed server is replaced
+	stale, err := net.Listen("unix", cfg.Server.UnixSocket)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.ListenAndServe() }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", cfg.Server.UnixSocket)
+		},
+	}}
+	var resp *http.Response
+	for range 50 {
+		if resp, err = client.Get("http://kii/healthz"); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET /healthz over the socket error = %v", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /healthz status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if info, err := os.Stat(cfg.Server.UnixSocket); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("socket mode = %v (%v), want 0600", info.Mode().Perm(), err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("ListenAndServe() error = %v, want %v", err, http.ErrServerClosed)
+	}
+	if _, err := os.Stat(cfg.Server.UnixSocket); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("socket after shutdown: %v, want it removed", err)
+	}
+}
+
+func TestServer_ListenAndServeProxyProtocol(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Server.UnixSocket = filepath.Join(t.TempDir(), "kii.sock")
+	cfg.Server.DisableTCP = true
+	cfg.Server.ProxyProtocol = true
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	go func() { _ = srv.ListenAndServe() }()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}()
+
+	get := func(header string) string {
+		var conn net.Conn
+		for range 50 {
+			if conn, err = net.Dial("unix", cfg.Server.UnixSocket); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("Dial() error = %v", err)
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		_, _ = io.WriteString(conn, header+"GET /healthz HTTP/1.1\r\nHost: kii\r\nConnection: close\r\n\r\n")
+		resp, _ := io.ReadAll(conn)
+		status, _, _ := strings.Cut(string(resp), "\r\n")
+		return status
+	}
+
+	if got := get("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"); got != "HTTP/1.1 200 OK" {
+		t.Errorf("with a PROXY header got %q, want 200", got)
+	}
+	// A connection without the header is rejected
+	if got := get(""); got != "HTTP/1.1 400 Bad Request" {
+		t.Errorf("without a PROXY header got %q, want 400", got)
+	}
+}
+
+func TestServer_HandoverWithInMemoryStores(t *testing.T) {
+	srv, err := New(testConfig(t))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Nothing is started while the new process would lose the in-memory
+	// state, and the server still shuts down as usual
+	err = srv.Handover(ctx)
+	if err == nil || !strings.Contains(err.Error(), "in-memory: ledger") {
+		t.Fatalf("Handover() with in-memory stores error = %v, want them refused", err)
+	}
+	if srv.handedOver.Load() {
+		t.Error("Handover() failed but marked the server handed over")
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+}
+
+func TestServer_NotifiesSystemd(t *testing.T) {
+	notifySocket := filepath.Join(t.TempDir(), "notify.sock")
+	notifications, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: notifySocket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("ListenUnixgram() error = %v", err)
+	}
+	defer notifications.Close()
+	t.Setenv("NOTIFY_SOCKET", notifySocket)
+
+	srv, err := New(testConfig(t))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go func() { _ = srv.Serve(listener) }()
+
+	receive := func() string {
+		buf := make([]byte, 64)
+		_ = notifications.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := notifications.Read(buf)
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		return string(buf[:n])
+	}
+	if state := receive(); state != "READY=1" {
+		t.Errorf("first notification = %q, want READY=1", state)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if state := receive(); state != "STOPPING=1" {
+		t.Errorf("notification on shutdown = %q, want STOPPING=1", state)
+	}
+}
+
+func TestServer_ShutdownDrainsAndPersists(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Webhook.NonceStorePath = filepath.Join(t.TempDir(), "nonces.json")
+	body := webhooktest.Payload("user1", "BTC", "1")
+	sent := webhooktest.NewRequest(t, "http://kii", cfg.Webhook.HMACSecret, body)
+	send := func(srv *Server, signed *http.Request) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+		req.Header = signed.Header.Clone()
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if w := send(srv, sent); w.Code != http.StatusOK {
+		t.Fatalf("webhook status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	// Webhooks arriving during shutdown are turned away for a retry
+	late := webhooktest.NewRequest(t, "http://kii", cfg.Webhook.HMACSecret, body)
+	if w := send(srv, late); w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("webhook after Shutdown status = %d, Retry-After %q, want 503 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz/details", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET /healthz/details after Shutdown status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+
+	// The saved nonce still rejects the replay after a restart
+	restarted, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() after restart error = %v", err)
+	}
+	t.Cleanup(func() { _ = restarted.Shutdown(context.Background()) })
+	if w := send(restarted, sent); w.Code != http.StatusUnauthorized {
+		t.Errorf("replay after restart status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestServer_HealthDetails(t *testing.T) {
+	// The checks of /healthz/details by name, with their errors
+	checks := func(t *testing.T, srv *Server) map[string]string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz/details", nil))
+		var report httphandler.HealthReport
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatalf("GET /healthz/details body = %s: %v", w.Body.String(), err)
+		}
+		results := make(map[string]string)
+		for _, check := range report.Checks {
+			results[check.Name] = check.Error
+		}
+		return results
+	}
+	newServer := func(t *testing.T, cfg *Config) *Server {
+		t.Helper()
+		srv, err := New(cfg)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		t.Cleanup(func() { _ = srv.Shutdown(context.Background()) })
+		return srv
+	}
+
+	t.Run("placeholder secret", func(t *testing.T) {
+		got := checks(t, newServer(t, testConfig(t)))["secret provider"]
+		if !strings.Contains(got, "placeholder") {
+			t.Errorf("secret provider error = %q, want the placeholder reported", got)
+		}
+	})
+
+	t.Run("unreadable secret files", func(t *testing.T) {
+		dir := t.TempDir()
+		hmacSecretFile := filepath.Join(dir, "hmac")
+		partnerSecretFile := filepath.Join(dir, "partner")
+		for _, path := range []string{hmacSecretFile, partnerSecretFile} {
+			if err := os.WriteFile(path, []byte(filepath.Base(path)+"-secret"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		yaml := "webhook:\n  hmacSecretFile: " + hmacSecretFile + "\nsources:\n  partner:\n    secretFile: " + partnerSecretFile + "\n"
+		if err := os.WriteFile(filepath.Join(dir, "local.yaml"), []byte(yaml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadConfig(dir)
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+		cfg.Log.Level = "error"
+		srv := newServer(t, cfg)
+
+		if got := checks(t, srv)["secret provider"]; got != "" {
+			t.Errorf("secret provider error = %q, want none", got)
+		}
+		if err := os.Remove(partnerSecretFile); err != nil {
+			t.Fatal(err)
+		}
+		if got := checks(t, srv)["secret provider"]; !strings.Contains(got, "sources.partner.secretFile") {
+			t.Errorf("secret provider error = %q, want sources.partner.secretFile reported", got)
+		}
+		if err := os.Remove(hmacSecretFile); err != nil {
+			t.Fatal(err)
+		}
+		if got := checks(t, srv)["secret provider"]; !strings.Contains(got, "webhook.hmacSecretFile") {
+			t.Errorf("secret provider error = %q, want webhook.hmacSecretFile reported", got)
+		}
+	})
+
+	t.Run("outbound queue", func(t *testing.T) {
+		release := make(chan struct{})
+		staging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer staging.Close()
+		defer close(release)
+
+		cfg := testConfig(t)
+		cfg.Webhook.HMACSecret = "hmac-secret"
+		if got := checks(t, newServer(t, cfg)); got["outbound queue"] != "" {
+			t.Errorf("outbound queue checked without background senders: %q", got["outbound queue"])
+		}
+
+		cfg.Mirror.URL = staging.URL
+		cfg.Mirror.Secret = "staging-secret"
+		cfg.Mirror.QueueSize = 1
+		srv := newServer(t, cfg)
+		if got, ok := checks(t, srv)["outbound queue"]; !ok || got != "" {
+			t.Errorf("outbound queue error = %q (checked %v), want none", got, ok)
+		}
+
+		// The mirror's workers are kept busy until its queue fills up
+		for i := 0; checks(t, srv)["outbound queue"] == "" && i < 100; i++ {
+			body := webhooktest.Payload("user1", "BTC", "1")
+			req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+			req.Header = webhooktest.NewRequest(t, "http://kii", cfg.Webhook.HMACSecret, body).Header.Clone()
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("webhook %d status = %d: %s", i, w.Code, w.Body.String())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		if got := checks(t, srv)["outbound queue"]; got != "mirror queue is full" {
+			t.Errorf("outbound queue error = %q, want mirror queue is full", got)
+		}
+	})
+}
+
+func TestServer_Mock(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(t)
+	cfg.Cluster.Enabled = true
+	cfg.Webhook.NonceStorePath = filepath.Join(dir, "nonces.json")
+	cfg.Usage.Path = filepath.Join(dir, "usage.json")
+	cfg.Freezes.Path = filepath.Join(dir, "freezes.json")
+
+	srv, err := New(cfg, WithMock())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// A webhook signed with the wrong secret is applied, and reported
+	body := webhooktest.Payload("user1", "BTC", "1")
+	signed := webhooktest.NewRequest(t, "http://kii", "wrong-secret", body)
+	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+	req.Header = signed.Header.Clone()
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("webhook status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if report := w.Header().Get(ValidationReportHeader); !strings.HasPrefix(report, "invalid; code=invalid_signature") {
+		t.Errorf("%s = %q, want invalid_signature", ValidationReportHeader, report)
+	}
+
+	// Nothing is written to disk, even at shutdown
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+		t.Errorf("files written in mock mode: %v", entries)
+	}
+	if !cfg.Cluster.Enabled || cfg.Usage.Path == "" {
+		t.Error("WithMock changed the caller's config")
+	}
+}
+
+// compactingLedger is a recordingLedger that counts compactions
+type compactingLedger struct {
+	recordingLedger
+	compactions atomic.Int32
+}
+
+func (l *compactingLedger) Compact(context.Context, time.Time, func(ArchivedUser) error) (CompactionResult, error) {
+	l.compactions.Add(1)
+	return CompactionResult{}, nil
+}
+
+func TestServer_ReadOnly(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Retention.Interval = time.Millisecond
+	cfg.Admin.Token = "admin-token"
+	cfg.Approval.Threshold = "1000"
+	cfg.Duplicates.Window = time.Hour
+	ledger := &compactingLedger{}
+	srv, err := New(cfg, WithRepository(ledger), WithReadOnly())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Shutdown(context.Background()) })
+
+	// Webhooks, approvals included, are refused before they are validated
+	for _, approvalID := range []string{"", "pending-1"} {
+		req := webhooktest.NewRequest(t, "http://kii", cfg.Webhook.HMACSecret, webhooktest.Payload("user1", "BTC", "1"))
+		if approvalID != "" {
+			req.Header.Set("X-Approval-Id", approvalID)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		if w.Code != http.StatusMethodNotAllowed || !strings.Contains(w.Body.String(), `"code":"read_only"`) {
+			t.Errorf("webhook = %d %s, want 405 read_only", w.Code, w.Body.String())
+		}
+	}
+
+	// Admin routes that change the ledger or shared stores are refused,
+	// their reads served
+	for _, route := range []struct{ method, path string }{
+		{http.MethodPost, "/admin/pending/pending-1/approve"},
+		{http.MethodDelete, "/admin/pending/pending-1"},
+		{http.MethodDelete, "/admin/nonces/nonce-1"},
+		{http.MethodDelete, "/admin/nonces"},
+		{http.MethodDelete, "/admin/duplicates/key-1"},
+		{http.MethodPut, "/admin/freezes/BTC"},
+		{http.MethodDelete, "/admin/freezes/BTC"},
+		{http.MethodGet, "/admin/pending"},
+		{http.MethodGet, "/admin/freezes"},
+	} {
+		req := httptest.NewRequest(route.method, route.path, strings.NewReader(`{"reason":"chain halt"}`))
+		req.Header.Set("Authorization", "Bearer admin-token")
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		refused := w.Code == http.StatusMethodNotAllowed && strings.Contains(w.Body.String(), `"code":"read_only"`)
+		if refused != (route.method != http.MethodGet) {
+			t.Errorf("%s %s = %d %s, want refused: %t", route.method, route.path, w.Code, w.Body.String(), route.method != http.MethodGet)
+		}
+	}
+	if len(ledger.entries) != 0 {
+		t.Errorf("entries = %v, want none applied", ledger.entries)
+	}
+
+	// Balances are served from the replicated store
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/balance/user1", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"BTC":"42"`) {
+		t.Errorf("balance = %d %s, want the replicated balance", w.Code, w.Body.String())
+	}
+
+	// Retention is left to the server writing the store
+	time.Sleep(20 * time.Millisecond)
+	if n := ledger.compactions.Load(); n != 0 {
+		t.Errorf("compactions = %d, want none on a replica", n)
+	}
+	if cfg.Retention.Interval != time.Millisecond {
+		t.Error("WithReadOnly changed the caller's config")
+	}
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		opts   []Option
+	}{
+		{
+			name:   "unsupported storage backend",
+			modify: func(cfg *Config) { cfg.Storage.Backend = "bogus" },
+		},
+		{
+			name:   "invalid approval threshold",
+			modify: func(cfg *Config) { cfg.Approval.Threshold = "lots" },
+		},
+		{
+			name:   "batching without batch support",
+			modify: func(cfg *Config) { cfg.Storage.BatchSize = 10 },
+			opts:   []Option{WithRepository(&recordingLedger{})},
+		},
+		{
+			name:   "mock read-only replica",
+			modify: func(cfg *Config) {},
+			opts:   []Option{WithMock(), WithReadOnly()},
+		},
+		{
+			name:   "invalid user pattern",
+			modify: func(cfg *Config) { cfg.Users.Pattern = "[a-z" },
+		},
+		{
+			name:   "unknown user case",
+			modify: func(cfg *Config) { cfg.Users.Case = "title" },
+		},
+		{
+			name: "velocity rule without window",
+			modify: func(cfg *Config) {
+				cfg.Velocity.Rules = []config.VelocityRule{{MaxCredit: "1"}}
+			},
+		},
+		{
+			name: "invalid velocity limit",
+			modify: func(cfg *Config) {
+				cfg.Velocity.Rules = []config.VelocityRule{{Window: time.Hour, MaxCredit: "lots"}}
+			},
+		},
+		{
+			name: "unknown velocity action",
+			modify: func(cfg *Config) {
+				cfg.Velocity.Action = "flag"
+				cfg.Velocity.Rules = []config.VelocityRule{{Window: time.Hour, MaxCredit: "1"}}
+			},
+		},
+		{
+			name:   "tcp disabled without a unix socket",
+			modify: func(cfg *Config) { cfg.Server.DisableTCP = true },
+		},
+		{
+			name: "invalid proxy protocol source",
+			modify: func(cfg *Config) {
+				cfg.Server.ProxyProtocol = true
+				cfg.Server.ProxyProtocolSources = []string{"lb.example.com"}
+			},
+		},
+		{
+			name: "invalid unix socket mode",
+			modify: func(cfg *Config) {
+				cfg.Server.UnixSocket = filepath.Join(t.TempDir(), "kii.sock")
+				cfg.Server.UnixSocketMode = "rw-rw----"
+			},
+		},
+		{
+			name:   "tls certificate without a key",
+			modify: func(cfg *Config) { cfg.Server.TLSCertFile = filepath.Join(t.TempDir(), "cert.pem") },
+		},
+		{
+			name: "missing tls certificate",
+			modify: func(cfg *Config) {
+				cfg.Server.TLSCertFile = filepath.Join(t.TempDir(), "cert.pem")
+				cfg.Server.TLSKeyFile = filepath.Join(t.TempDir(), "key.pem")
+			},
+		},
+		{
+			name: "h2c with http2 disabled",
+			modify: func(cfg *Config) {
+				cfg.Server.H2C = true
+				cfg.Server.DisableHTTP2 = true
+			},
+		},
+		{
+			name: "source response with an error status",
+			modify: func(cfg *Config) {
+				cfg.Sources = map[string]config.Source{"partner": {
+					Secret:             "partner-secret",
+					TimestampTolerance: time.Minute,
+					Mapping:            config.SourceMapping{User: "user", Asset: "asset", Amount: "amount"},
+					Response:           config.SourceResponse{Status: http.StatusBadRequest},
+				}}
+			},
+		},
+		{
+			name: "source with an unsupported method",
+			modify: func(cfg *Config) {
+				cfg.Sources = map[string]config.Source{"legacy": {
+					Secret:             "legacy-secret",
+					TimestampTolerance: time.Minute,
+					Mapping:            config.SourceMapping{User: "user", Asset: "asset", Amount: "amount"},
+					Method:             http.MethodPatch,
+				}}
+			},
+		},
+		{
+			name: "sources sharing a path",
+			modify: func(cfg *Config) {
+				source := config.Source{
+					Secret:             "legacy-secret",
+					TimestampTolerance: time.Minute,
+					Mapping:            config.SourceMapping{User: "user", Asset: "asset", Amount: "amount"},
+					Method:             http.MethodPut,
+					Path:               "/callbacks",
+				}
+				cfg.Sources = map[string]config.Source{"legacy": source, "other": source}
+			},
+		},
+		{
+			name:   "negative nonce retention margin",
+			modify: func(cfg *Config) { cfg.Webhook.NonceRetentionMargin = -time.Minute },
+		},
+		{
+			name:   "message for an unknown error code",
+			modify: func(cfg *Config) { cfg.Errors.Messages = map[string]string{"no_such_code": "Nope"} },
+		},
+		{
+			name: "invalid error message language tag",
+			modify: func(cfg *Config) {
+				cfg.Errors.Locales = map[string]map[string]string{"not a tag": {"asset_frozen": "Nope"}}
+			},
+		},
+		{
+			name:   "missing attestation key",
+			modify: func(cfg *Config) { cfg.Attestation.KeyFile = filepath.Join(t.TempDir(), "missing.pem") },
+		},
+		{
+			name: "idle users without an archive",
+			modify: func(cfg *Config) {
+				cfg.Retention.Interval = time.Hour
+				cfg.Retention.IdleAfter = time.Hour
+			},
+		},
+		{
+			name:   "pruning without an interval",
+			modify: func(cfg *Config) { cfg.Retention.MaxAge = time.Hour },
+		},
+		{
+			name: "pruning without an object store",
+			modify: func(cfg *Config) {
+				cfg.Retention.Interval = time.Hour
+				cfg.Retention.MaxAge = time.Hour
+			},
+		},
+		{
+			name:   "unsupported object store backend",
+			modify: func(cfg *Config) { cfg.Retention.ObjectStore.Backend = "ftp" },
+		},
+		{
+			name:   "retention without compaction support",
+			modify: func(cfg *Config) { cfg.Retention.Interval = time.Hour },
+			opts:   []Option{WithRepository(&recordingLedger{})},
+		},
+		{
+			name:   "cluster mode with in-memory stores",
+			modify: func(cfg *Config) { cfg.Cluster.Enabled = true },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			tt.modify(cfg)
+			if _, err := New(cfg, tt.opts...); err == nil {
+				t.Error("New() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestServer_SourceSecretFileRotation(t *testing.T) {
+	interval := secretFilePollInterval
+	secretFilePollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { secretFilePollInterval = interval })
+
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "partner")
+	auditFile := filepath.Join(dir, "audit.log")
+	if err := os.WriteFile(secretFile, []byte("partner-secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	yaml := "audit:\n  sink: file\n  path: " + auditFile + "\nsources:\n  partner:\n    secretFile: " + secretFile + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "local.yaml"), []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	cfg.Log.Level = "error"
+	srv, err := New(cfg, WithRepository(&recordingLedger{}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Shutdown(context.Background()) })
+
+	send := func(secret string) int {
+		req := webhooktest.NewRequest(t, "http://kii", secret, webhooktest.Payload("user1", "BTC", "1"))
+		req.URL.Path = "/webhook/partner"
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if status := send("partner-secret"); status != http.StatusOK {
+		t.Fatalf("webhook signed with the file's secret = %d, want %d", status, http.StatusOK)
+	}
+	if err := os.WriteFile(secretFile, []byte("partner-secret-next"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for send("partner-secret-next") != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("webhook signed with the rotated secret is still rejected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := send("partner-secret"); status != http.StatusUnauthorized {
+		t.Errorf("webhook signed with the old secret = %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	// The rotation is audited with the source, never the secret
+	audited, err := os.ReadFile(auditFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(audited, []byte(`"secret.rotated"`)) || !bytes.Contains(audited, []byte(`"source":"partner"`)) {
+		t.Errorf("audit log = %s, want the rotation of source partner", audited)
+	}
+	if bytes.Contains(audited, []byte("partner-secret-next")) {
+		t.Errorf("audit log = %s, want the secret left out", audited)
+	}
+}
+
+func TestServer_Tolerances(t *testing.T) {
+	dir := t.TempDir()
+	yaml := "admin:\n  token: admin-token\nsources:\n  partner:\n    secret: partner-secret\n    timestampTolerance: 2m\n"
+	if err := os.WriteFile(filepath.Join(dir, "local.yaml"), []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	cfg.Log.Level = "error"
+	srv, err := New(cfg, WithRepository(&recordingLedger{}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Shutdown(context.Background()) })
+
+	admin := func(method, path, body string) (int, string) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer admin-token")
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	if status, body := admin(http.MethodGet, "/admin/tolerances", ""); status != http.StatusOK ||
+		!strings.Contains(body, `{"source":"default","tolerance":"5m0s","seconds":300}`) ||
+		!strings.Contains(body, `{"source":"partner","tolerance":"2m0s","seconds":120}`) ||
+		!strings.Contains(body, `"nonceRetention":"10m0s"`) {
+		t.Errorf("GET /admin/tolerances = %d %s, want both sources and the longest tolerance plus the margin", status, body)
+	}
+	if status, body := admin(http.MethodPut, "/admin/tolerances/partner", `{"tolerance":"30s"}`); status != http.StatusOK || !strings.Contains(body, `"tolerance":"30s"`) {
+		t.Errorf("PUT /admin/tolerances/partner = %d %s, want 30s", status, body)
+	}
+
+	// Nonces are remembered for as long as the longest tolerance needs
+	if status, _ := admin(http.MethodPut, "/admin/tolerances/partner", `{"tolerance":"2h"}`); status != http.StatusOK {
+		t.Errorf("PUT /admin/tolerances/partner = %d, want %d", status, http.StatusOK)
+	}
+	if _, body := admin(http.MethodGet, "/admin/tolerances", ""); !strings.Contains(body, `"nonceRetention":"2h5m0s"`) {
+		t.Errorf("GET /admin/tolerances = %s, want the nonce retention raised to 2h5m0s", body)
+	}
+
+	// A reload sets the tolerances back to the config's
+	if err := srv.Reload(cfg); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if status, body := admin(http.MethodGet, "/admin/tolerances/partner", ""); status != http.StatusOK || !strings.Contains(body, `"tolerance":"2m0s"`) {
+		t.Errorf("GET /admin/tolerances/partner after reload = %d %s, want 2m0s", status, body)
+	}
+	if _, body := admin(http.MethodGet, "/admin/tolerances", ""); !strings.Contains(body, `"nonceRetention":"10m0s"`) {
+		t.Errorf("GET /admin/tolerances after reload = %s, want the nonce retention back at 10m0s", body)
+	}
+
+	// The margin is reloaded too
+	cfg.Webhook.NonceRetentionMargin = time.Hour
+	if err := srv.Reload(cfg); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if _, body := admin(http.MethodGet, "/admin/tolerances", ""); !strings.Contains(body, `"nonceRetention":"1h5m0s"`) {
+		t.Errorf("GET /admin/tolerances after reload = %s, want the nonce retention raised to 1h5m0s", body)
+	}
+	cfg.Webhook.NonceRetentionMargin = -time.Minute
+	if err := srv.Reload(cfg); err == nil {
+		t.Error("Reload() with a negative margin error = nil, want an error")
+	}
+}
@@ -0,0 +1,197 @@
+// Package webhooktest provides helpers for integration tests against the
+// webhook API: an in-memory server, signed webhook requests and balance
+// assertions. Services that send webhooks to kii can use it to test their
+// integration without running a real deployment.
+package webhooktest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"kii.com/internal/application/usecase"
+	httphandler "kii.com/internal/infrastructure/http"
+	"kii.com/internal/infrastructure/logger"
+	"kii.com/internal/infrastructure/repository"
+	"kii.com/internal/infrastructure/validator"
+)
+
+// DefaultSecret is the HMAC secret of a Server unless WithSecret is given
+const DefaultSecret = "webhooktest-secret"
+
+// Server is an in-memory webhook server with its own ledger and nonce store,
+// serving the same POST /webhook, GET /balance/{user} and GET /ledger/{user}
+// endpoints as kii
+type Server struct {
+	*httptest.Server
+	// Secret is the HMAC secret webhooks must be signed with
+	Secret string
+}
+
+// Option configures a Server
+type Option func(*options)
+
+type options struct {
+	secret    string
+	tolerance time.Duration
+}
+
+// WithSecret sets the HMAC secret the server validates webhooks with
+func WithSecret(secret string) Option {
+	return func(o *options) {
+		o.secret = secret
+	}
+}
+
+// WithTimestampTolerance sets how far a webhook's timestamp may be from the
+// server's clock (default: 5 minutes)
+func WithTimestampTolerance(tolerance time.Duration) Option {
+	return func(o *options) {
+		o.tolerance = tolerance
+	}
+}
+
+// NewServer starts a server that is closed when the test finishes. Only
+// errors are logged, to stdout.
+func NewServer(tb testing.TB, opts ...Option) *Server {
+	tb.Helper()
+	o := options{secret: DefaultSecret, tolerance: 5 * time.Minute}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	level := new(slog.LevelVar)
+	level.Set(slog.LevelError)
+	appLogger := logger.NewLoggerWithLevel(level)
+
+	ledgerRepo := repository.NewInMemoryLedger(appLogger)
+	webhookValidator := validator.NewHMACValidator(o.secret, o.tolerance, appLogger)
+	handler := httphandler.NewHandler(
+		usecase.NewProcessWebhookUseCase(webhookValidator, ledgerRepo),
+		usecase.NewGetBalanceUseCase(ledgerRepo),
+		webhookValidator,
+		appLogger,
+		httphandler.WithLedgerHistory(usecase.NewStreamLedgerUseCase(ledgerRepo)),
+	)
+
+	server := httptest.NewServer(handler.SetupRoutes())
+	tb.Cleanup(server.Close)
+	return &Server{Server: server, Secret: o.secret}
+}
+
+// Payload returns the JSON body of a webhook crediting amount of asset to
+// user; debits have a negative amount
+func Payload(user, asset, amount string) []byte {
+	body, _ := json.Marshal(map[string]string{"user": user, "asset": asset, "amount": amount})
+	return body
+}
+
+// NewRequest builds a POST /webhook request to baseURL carrying body, signed
+// with secret using the current time and a fresh nonce
+func NewRequest(tb testing.TB, baseURL, secret string, body []byte) *http.Request {
+	tb.Helper()
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := uuid.New().String()
+	signature, err := validator.ComputeSignature(secret, timestamp, nonce, body)
+	if err != nil {
+		tb.Fatalf("webhooktest: failed to sign request: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(baseURL, "/")+"/webhook", bytes.NewReader(body))
+	if err != nil {
+		tb.Fatalf("webhooktest: failed to build request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Timestamp", timestamp)
+	req.Header.Set("X-Nonce", nonce)
+	req.Header.Set("X-Signature", signature)
+	return req
+}
+
+// Send signs body with the server's secret and posts it. The response body
+// is read in full, so callers need not close it.
+func (s *Server) Send(tb testing.TB, body []byte) *http.Response {
+	tb.Helper()
+	return s.do(tb, NewRequest(tb, s.URL, s.Secret, body))
+}
+
+// Credit sends a signed webhook applying amount of asset to user and fails
+// the test unless it is accepted
+func (s *Server) Credit(tb testing.TB, user, asset, amount string) {
+	tb.Helper()
+	resp := s.Send(tb, Payload(user, asset, amount))
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		tb.Fatalf("webhooktest: webhook for %s %s %s got status %d: %s", user, amount, asset, resp.StatusCode, body)
+	}
+}
+
+// Balances returns user's balance per asset
+func (s *Server) Balances(tb testing.TB, user string) map[string]string {
+	tb.Helper()
+	req, err := http.NewRequest(http.MethodGet, s.URL+"/balance/"+url.PathEscape(user), nil)
+	if err != nil {
+		tb.Fatalf("webhooktest: failed to build request: %v", err)
+	}
+	resp := s.do(tb, req)
+	if resp.StatusCode != http.StatusOK {
+		tb.Fatalf("webhooktest: balance of %s got status %d", user, resp.StatusCode)
+	}
+
+	var balance struct {
+		Balances map[string]string `json:"balances"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&balance); err != nil {
+		tb.Fatalf("webhooktest: failed to decode balance of %s: %v", user, err)
+	}
+	return balance.Balances
+}
+
+// AssertBalance fails the test unless user's balance of asset equals want.
+// Balances are compared as decimals, so "1.5" matches "1.50000000"; an asset
+// the user never received has a zero balance.
+func (s *Server) AssertBalance(tb testing.TB, user, asset, want string) {
+	tb.Helper()
+	wantDec, err := decimal.NewFromString(want)
+	if err != nil {
+		tb.Fatalf("webhooktest: invalid expected balance %q: %v", want, err)
+	}
+
+	got := decimal.Zero
+	if balance, ok := s.Balances(tb, user)[asset]; ok {
+		if got, err = decimal.NewFromString(balance); err != nil {
+			tb.Fatalf("webhooktest: invalid balance %q of %s %s: %v", balance, user, asset, err)
+		}
+	}
+	if !got.Equal(wantDec) {
+		tb.Errorf("balance of %s %s = %s, want %s", user, asset, got, wantDec)
+	}
+}
+
+// do sends req and buffers the response body
+func (s *Server) do(tb testing.TB, req *http.Request) *http.Response {
+	tb.Helper()
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		tb.Fatalf("webhooktest: %s %s failed: %v", req.Method, req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		tb.Fatalf("webhooktest: failed to read response of %s %s: %v", req.Method, req.URL.Path, err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp
+}
@@ -0,0 +1,44 @@
+package webhooktest
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	server := NewServer(t, WithSecret("test-secret"))
+
+	server.Credit(t, "user1", "BTC", "1.5")
+	server.Credit(t, "user1", "BTC", "-0.25")
+	server.Credit(t, "user1", "ETH", "10")
+
+	server.AssertBalance(t, "user1", "BTC", "1.25")
+	server.AssertBalance(t, "user1", "ETH", "10.0")
+	server.AssertBalance(t, "user1", "SOL", "0")
+	server.AssertBalance(t, "user2", "BTC", "0")
+
+	tests := []struct {
+		name       string
+		req        *http.Request
+		wantStatus int
+	}{
+		{
+			name:       "wrong secret",
+			req:        NewRequest(t, server.URL, "other-secret", Payload("user1", "BTC", "1")),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "missing field",
+			req:        NewRequest(t, server.URL, "test-secret", Payload("", "BTC", "1")),
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := server.do(t, tt.req); resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+	server.AssertBalance(t, "user1", "BTC", "1.25")
+}